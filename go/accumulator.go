@@ -0,0 +1,356 @@
+package topayz512
+
+import (
+	"sync"
+)
+
+// Hash-based dynamic accumulator for set membership proofs
+//
+// The accumulator is a sparse Merkle tree over the 256-bit keys of its
+// elements. Its root commits to the whole set; a witness of 256 siblings,
+// compressed by omitting empty subtrees, proves that an element is or is not
+// a member. Every change publishes an AccumulatorUpdate from which holders of
+// other witnesses update them without seeing the set.
+
+// Accumulator parameters
+const (
+	// AccumulatorKeySize is the size of the keys elements are placed by
+	AccumulatorKeySize = 32
+
+	// AccumulatorDepth is the height of the tree, one level per key bit
+	AccumulatorDepth = AccumulatorKeySize * 8
+)
+
+// AccumulatorKey places an element in the accumulator tree
+type AccumulatorKey [AccumulatorKeySize]byte
+
+// AccumulatorKeyOf derives the key of an element
+func AccumulatorKeyOf(element []byte) AccumulatorKey {
+	hash := HashConcat([]byte("TOPAY-Z512-ACCUMULATOR-KEY"), element)
+	var key AccumulatorKey
+	copy(key[:], hash[:])
+	return key
+}
+
+// bit returns bit i of the key, counting from the most significant
+func (ak AccumulatorKey) bit(i int) byte {
+	return (ak[i/8] >> (7 - uint(i%8))) & 1
+}
+
+// prefix returns the key with all but its first bits bits cleared
+func (ak AccumulatorKey) prefix(bits int) AccumulatorKey {
+	var result AccumulatorKey
+	copy(result[:], ak[:bits/8])
+	if bits%8 != 0 {
+		result[bits/8] = ak[bits/8] & (0xFF << (8 - uint(bits%8)))
+	}
+	return result
+}
+
+// accumulatorLeaf returns the leaf value for a key, empty when absent
+func accumulatorLeaf(key AccumulatorKey, member bool) Hash {
+	if !member {
+		return Hash{}
+	}
+	return HashMultiple([]byte{0}, key[:])
+}
+
+// accumulatorNode hashes two children into their parent
+func accumulatorNode(left, right Hash) Hash {
+	return HashMultiple([]byte{1}, left[:], right[:])
+}
+
+// accumulatorParent combines a node with its sibling at level, ordering them
+// by the key bit that separates them
+func accumulatorParent(key AccumulatorKey, level int, node, sibling Hash) Hash {
+	if key.bit(AccumulatorDepth-1-level) == 0 {
+		return accumulatorNode(node, sibling)
+	}
+	return accumulatorNode(sibling, node)
+}
+
+var (
+	accumulatorDefaultsOnce sync.Once
+	accumulatorDefaults     [AccumulatorDepth + 1]Hash
+)
+
+// accumulatorDefault returns the root of an empty subtree at level
+func accumulatorDefault(level int) Hash {
+	accumulatorDefaultsOnce.Do(func() {
+		for i := 0; i < AccumulatorDepth; i++ {
+			accumulatorDefaults[i+1] = accumulatorNode(accumulatorDefaults[i], accumulatorDefaults[i])
+		}
+	})
+	return accumulatorDefaults[level]
+}
+
+// AccumulatorProof holds the siblings of a key's path from leaf to root.
+// Bitmap bit l is set when the sibling at level l is not an empty subtree;
+// only those siblings are stored, in level order.
+type AccumulatorProof struct {
+	Bitmap   [AccumulatorDepth / 8]byte `json:"bitmap"`
+	Siblings []Hash                     `json:"siblings"`
+}
+
+// expand returns all siblings, filling in empty subtrees
+func (ap *AccumulatorProof) expand() ([AccumulatorDepth]Hash, error) {
+	var siblings [AccumulatorDepth]Hash
+	next := 0
+	for level := 0; level < AccumulatorDepth; level++ {
+		if ap.Bitmap[level/8]&(1<<uint(level%8)) == 0 {
+			siblings[level] = accumulatorDefault(level)
+			continue
+		}
+		if next >= len(ap.Siblings) {
+			return siblings, ErrInvalidProof
+		}
+		siblings[level] = ap.Siblings[next]
+		next++
+	}
+	if next != len(ap.Siblings) {
+		return siblings, ErrInvalidProof
+	}
+	return siblings, nil
+}
+
+// compressAccumulatorProof builds a proof from all siblings
+func compressAccumulatorProof(siblings *[AccumulatorDepth]Hash) AccumulatorProof {
+	var proof AccumulatorProof
+	for level, sibling := range siblings {
+		if sibling != accumulatorDefault(level) {
+			proof.Bitmap[level/8] |= 1 << uint(level%8)
+			proof.Siblings = append(proof.Siblings, sibling)
+		}
+	}
+	return proof
+}
+
+// Bytes serializes the proof as Bitmap + Siblings
+func (ap *AccumulatorProof) Bytes() []byte {
+	data := make([]byte, 0, len(ap.Bitmap)+len(ap.Siblings)*HashSize)
+	data = append(data, ap.Bitmap[:]...)
+	for _, sibling := range ap.Siblings {
+		data = append(data, sibling[:]...)
+	}
+	return data
+}
+
+// AccumulatorProofFromBytes deserializes a proof
+func AccumulatorProofFromBytes(data []byte) (AccumulatorProof, error) {
+	var proof AccumulatorProof
+	if len(data) < len(proof.Bitmap) || (len(data)-len(proof.Bitmap))%HashSize != 0 {
+		return AccumulatorProof{}, ErrInvalidProof
+	}
+
+	copy(proof.Bitmap[:], data)
+	for offset := len(proof.Bitmap); offset < len(data); offset += HashSize {
+		var sibling Hash
+		copy(sibling[:], data[offset:])
+		proof.Siblings = append(proof.Siblings, sibling)
+	}
+	if _, err := proof.expand(); err != nil {
+		return AccumulatorProof{}, err
+	}
+	return proof, nil
+}
+
+// rootFromProof recomputes the root from a key's leaf and siblings
+func rootFromProof(key AccumulatorKey, member bool, siblings *[AccumulatorDepth]Hash) Hash {
+	node := accumulatorLeaf(key, member)
+	for level := 0; level < AccumulatorDepth; level++ {
+		node = accumulatorParent(key, level, node, siblings[level])
+	}
+	return node
+}
+
+// AccumulatorWitness proves an element's membership, or non-membership, in
+// the set committed to by a root
+type AccumulatorWitness struct {
+	Key    AccumulatorKey   `json:"key"`
+	Member bool             `json:"member"`
+	Proof  AccumulatorProof `json:"proof"`
+}
+
+// AccumulatorUpdate describes one addition or removal. The proof is the
+// changed key's own path, whose siblings the change leaves untouched.
+type AccumulatorUpdate struct {
+	Key    AccumulatorKey   `json:"key"`
+	Member bool             `json:"member"`
+	Proof  AccumulatorProof `json:"proof"`
+}
+
+// Verify reports whether the witness holds against root
+func (aw *AccumulatorWitness) Verify(root Hash) bool {
+	siblings, err := aw.Proof.expand()
+	if err != nil {
+		return false
+	}
+	return HashEqual(rootFromProof(aw.Key, aw.Member, &siblings), root)
+}
+
+// Update brings the witness up to date with a change to the set, returning
+// the new root the change produced
+func (aw *AccumulatorWitness) Update(update AccumulatorUpdate) (Hash, error) {
+	siblings, err := aw.Proof.expand()
+	if err != nil {
+		return Hash{}, err
+	}
+	changed, err := update.Proof.expand()
+	if err != nil {
+		return Hash{}, err
+	}
+
+	if update.Key == aw.Key {
+		aw.Member = update.Member
+		return rootFromProof(aw.Key, aw.Member, &siblings), nil
+	}
+
+	// The paths share their top bits; below the first differing bit, the
+	// changed key's subtree is this witness's sibling
+	shared := 0
+	for aw.Key.bit(shared) == update.Key.bit(shared) {
+		shared++
+	}
+	level := AccumulatorDepth - 1 - shared
+
+	node := accumulatorLeaf(update.Key, update.Member)
+	for l := 0; l < level; l++ {
+		node = accumulatorParent(update.Key, l, node, changed[l])
+	}
+	siblings[level] = node
+
+	aw.Proof = compressAccumulatorProof(&siblings)
+	return rootFromProof(aw.Key, aw.Member, &siblings), nil
+}
+
+// accumulatorNodeID identifies a tree node by level and key prefix
+type accumulatorNodeID struct {
+	level  int
+	prefix AccumulatorKey
+}
+
+// Accumulator maintains the full set and its tree. Light clients keep only
+// the root and their own witnesses.
+type Accumulator struct {
+	nodes map[accumulatorNodeID]Hash
+	count int
+	mutex sync.RWMutex
+}
+
+// NewAccumulator creates an empty accumulator
+func NewAccumulator() *Accumulator {
+	return &Accumulator{nodes: make(map[accumulatorNodeID]Hash)}
+}
+
+// node returns the node at level on key's path
+func (acc *Accumulator) node(level int, key AccumulatorKey) Hash {
+	if node, ok := acc.nodes[accumulatorNodeID{level, key.prefix(AccumulatorDepth - level)}]; ok {
+		return node
+	}
+	return accumulatorDefault(level)
+}
+
+// siblings returns the siblings on key's path
+func (acc *Accumulator) siblings(key AccumulatorKey) [AccumulatorDepth]Hash {
+	var siblings [AccumulatorDepth]Hash
+	for level := 0; level < AccumulatorDepth; level++ {
+		sibling := key
+		bit := AccumulatorDepth - 1 - level
+		sibling[bit/8] ^= 1 << (7 - uint(bit%8))
+		siblings[level] = acc.node(level, sibling)
+	}
+	return siblings
+}
+
+// set changes key's membership and rehashes its path
+func (acc *Accumulator) set(key AccumulatorKey, member bool) AccumulatorUpdate {
+	siblings := acc.siblings(key)
+
+	node := accumulatorLeaf(key, member)
+	for level := 0; level <= AccumulatorDepth; level++ {
+		id := accumulatorNodeID{level, key.prefix(AccumulatorDepth - level)}
+		if node == accumulatorDefault(level) {
+			delete(acc.nodes, id)
+		} else {
+			acc.nodes[id] = node
+		}
+		if level < AccumulatorDepth {
+			node = accumulatorParent(key, level, node, siblings[level])
+		}
+	}
+
+	return AccumulatorUpdate{Key: key, Member: member, Proof: compressAccumulatorProof(&siblings)}
+}
+
+// Add inserts an element, reporting whether it was new. The update lets
+// witness holders follow the change.
+func (acc *Accumulator) Add(element []byte) (AccumulatorUpdate, bool) {
+	key := AccumulatorKeyOf(element)
+
+	acc.mutex.Lock()
+	defer acc.mutex.Unlock()
+
+	if acc.contains(key) {
+		return AccumulatorUpdate{}, false
+	}
+	acc.count++
+	return acc.set(key, true), true
+}
+
+// Remove deletes an element, reporting whether it was present
+func (acc *Accumulator) Remove(element []byte) (AccumulatorUpdate, bool) {
+	key := AccumulatorKeyOf(element)
+
+	acc.mutex.Lock()
+	defer acc.mutex.Unlock()
+
+	if !acc.contains(key) {
+		return AccumulatorUpdate{}, false
+	}
+	acc.count--
+	return acc.set(key, false), true
+}
+
+// contains reports whether key's leaf is present
+func (acc *Accumulator) contains(key AccumulatorKey) bool {
+	_, ok := acc.nodes[accumulatorNodeID{0, key}]
+	return ok
+}
+
+// Contains reports whether element is a member
+func (acc *Accumulator) Contains(element []byte) bool {
+	acc.mutex.RLock()
+	defer acc.mutex.RUnlock()
+	return acc.contains(AccumulatorKeyOf(element))
+}
+
+// Len returns the number of members
+func (acc *Accumulator) Len() int {
+	acc.mutex.RLock()
+	defer acc.mutex.RUnlock()
+	return acc.count
+}
+
+// Root returns the commitment to the current set
+func (acc *Accumulator) Root() Hash {
+	acc.mutex.RLock()
+	defer acc.mutex.RUnlock()
+	return acc.node(AccumulatorDepth, AccumulatorKey{})
+}
+
+// Prove returns a witness of element's membership or non-membership
+func (acc *Accumulator) Prove(element []byte) AccumulatorWitness {
+	key := AccumulatorKeyOf(element)
+
+	acc.mutex.RLock()
+	defer acc.mutex.RUnlock()
+
+	siblings := acc.siblings(key)
+	return AccumulatorWitness{Key: key, Member: acc.contains(key), Proof: compressAccumulatorProof(&siblings)}
+}
+
+// VerifyMembership reports whether witness proves element is a member of the
+// set committed to by root
+func VerifyMembership(root Hash, element []byte, witness *AccumulatorWitness) bool {
+	return witness.Member && witness.Key == AccumulatorKeyOf(element) && witness.Verify(root)
+}
@@ -0,0 +1,264 @@
+// Package address derives checksummed blockchain addresses from TOPAY-Z512
+// public keys and parses them back.
+//
+// An address commits to a public key with a 32-byte domain-separated hash,
+// so it is shorter than the key and reveals nothing about it until the key
+// signs. Addresses come in three encodings of the same network, version and
+// hash:
+//
+//   - Bech32m (BIP 350), the default, like "topay1q...": lowercase, with a
+//     checksum that detects any four character errors and a human-readable
+//     part naming the network.
+//   - Bech32 (BIP 173), the same layout with the original checksum, for
+//     tooling that predates Bech32m.
+//   - Base58Check, a network prefix byte, the version, the hash and a 4-byte
+//     checksum in Bitcoin's Base58 alphabet.
+//
+// Parse accepts all three and reports which one it read, so wallets can
+// display an address the way the user entered it.
+package address
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// HashSize is the size of the public key hash an address holds
+const HashSize = 32
+
+// Version0 is the version of addresses holding the hash of a signature
+// public key
+const Version0 = 0
+
+// Hash domains
+const (
+	hashDomain     = "TOPAY-Z512-ADDRESS"
+	checksumDomain = "TOPAY-Z512-ADDRESS-CHECKSUM"
+)
+
+// checksumSize is the size of a Base58Check checksum
+const checksumSize = 4
+
+var (
+	// ErrInvalidAddress indicates a string that isn't a well-formed address
+	ErrInvalidAddress = errors.New("address: invalid address")
+
+	// ErrChecksumMismatch indicates an address whose checksum doesn't match,
+	// usually a typing error
+	ErrChecksumMismatch = errors.New("address: checksum mismatch")
+
+	// ErrUnknownNetwork indicates an address of no known network
+	ErrUnknownNetwork = errors.New("address: unknown network")
+
+	// ErrUnsupportedVersion indicates an address version this package can't use
+	ErrUnsupportedVersion = errors.New("address: unsupported version")
+)
+
+// Network identifies the chain an address belongs to
+type Network struct {
+	Name string
+	// HRP is the Bech32 human-readable part
+	HRP string
+	// Base58Prefix is the first byte of a Base58Check address
+	Base58Prefix byte
+}
+
+// Known networks
+var (
+	Mainnet = Network{Name: "mainnet", HRP: "topay", Base58Prefix: 0x41}
+	Testnet = Network{Name: "testnet", HRP: "ttopay", Base58Prefix: 0x7f}
+)
+
+// Networks lists the networks Parse recognizes
+var Networks = []Network{Mainnet, Testnet}
+
+// Format is an address encoding
+type Format int
+
+// Address encodings
+const (
+	Bech32m Format = iota
+	Bech32
+	Base58Check
+)
+
+// String returns the name of the format
+func (f Format) String() string {
+	switch f {
+	case Bech32m:
+		return "bech32m"
+	case Bech32:
+		return "bech32"
+	case Base58Check:
+		return "base58check"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Address is a decoded address
+type Address struct {
+	Network Network
+	Version byte
+	Hash    [HashSize]byte
+}
+
+// FromPublicKey returns the version 0 address of publicKey on network
+func FromPublicKey(publicKey topayz512.PublicKey, network Network) Address {
+	address := Address{Network: network, Version: Version0}
+	digest := topayz512.HashWithDomain(hashDomain, publicKey[:])
+	copy(address.Hash[:], digest[:HashSize])
+	return address
+}
+
+// Matches reports whether the address belongs to publicKey
+func (a Address) Matches(publicKey topayz512.PublicKey) bool {
+	expected := FromPublicKey(publicKey, a.Network)
+	return a.Version == Version0 && topayz512.ConstantTimeEqual(a.Hash[:], expected.Hash[:])
+}
+
+// Encode returns the address in format. It returns ErrInvalidAddress for an
+// unknown format or a version too large for Bech32.
+func (a Address) Encode(format Format) (string, error) {
+	switch format {
+	case Bech32m, Bech32:
+		if a.Version > 31 {
+			return "", ErrInvalidAddress
+		}
+		data := append([]byte{a.Version}, convertBits(a.Hash[:], 8, 5, true)...)
+		return bech32Encode(a.Network.HRP, data, format == Bech32m)
+	case Base58Check:
+		body := make([]byte, 0, 2+HashSize+checksumSize)
+		body = append(body, a.Network.Base58Prefix, a.Version)
+		body = append(body, a.Hash[:]...)
+		return base58Encode(append(body, checksum(body)...)), nil
+	default:
+		return "", ErrInvalidAddress
+	}
+}
+
+// String returns the Bech32m encoding of the address
+func (a Address) String() string {
+	encoded, err := a.Encode(Bech32m)
+	if err != nil {
+		return fmt.Sprintf("address(%s, version %d, %x)", a.Network.Name, a.Version, a.Hash)
+	}
+	return encoded
+}
+
+// Parse decodes an address in any format, returning the format it was in.
+// Errors match ErrInvalidAddress, ErrChecksumMismatch, ErrUnknownNetwork or
+// ErrUnsupportedVersion.
+func Parse(s string) (Address, Format, error) {
+	if hrp, _, ok := splitBech32(s); ok && knownHRP(hrp) {
+		return parseBech32(s)
+	}
+	address, err := parseBase58Check(s)
+	return address, Base58Check, err
+}
+
+// ParseForNetwork decodes an address like Parse and checks that it belongs
+// to network
+func ParseForNetwork(s string, network Network) (Address, Format, error) {
+	address, format, err := Parse(s)
+	if err != nil {
+		return Address{}, format, err
+	}
+	if address.Network != network {
+		return Address{}, format, fmt.Errorf("%w: %s address on %s", ErrUnknownNetwork, address.Network.Name, network.Name)
+	}
+	return address, format, nil
+}
+
+// Validate reports whether s is a valid address, returning the error Parse
+// would
+func Validate(s string) error {
+	_, _, err := Parse(s)
+	return err
+}
+
+// knownHRP reports whether hrp names a known network, in either case
+func knownHRP(hrp string) bool {
+	_, ok := networkByHRP(hrp)
+	return ok
+}
+
+// networkByHRP returns the network with a human-readable part
+func networkByHRP(hrp string) (Network, bool) {
+	for _, network := range Networks {
+		if strings.EqualFold(network.HRP, hrp) {
+			return network, true
+		}
+	}
+	return Network{}, false
+}
+
+// parseBech32 decodes a Bech32 or Bech32m address
+func parseBech32(s string) (Address, Format, error) {
+	hrp, data, modified, err := bech32Decode(s)
+	if err != nil {
+		return Address{}, Bech32m, err
+	}
+	format := Bech32
+	if modified {
+		format = Bech32m
+	}
+	network, ok := networkByHRP(hrp)
+	if !ok {
+		return Address{}, format, ErrUnknownNetwork
+	}
+	if len(data) == 0 {
+		return Address{}, format, ErrInvalidAddress
+	}
+	hash, ok := revertBits(data[1:])
+	if !ok || len(hash) != HashSize {
+		return Address{}, format, ErrInvalidAddress
+	}
+	if data[0] != Version0 {
+		return Address{}, format, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+
+	address := Address{Network: network, Version: data[0]}
+	copy(address.Hash[:], hash)
+	return address, format, nil
+}
+
+// parseBase58Check decodes a Base58Check address
+func parseBase58Check(s string) (Address, error) {
+	decoded, ok := base58Decode(s)
+	if !ok || len(decoded) != 2+HashSize+checksumSize {
+		return Address{}, ErrInvalidAddress
+	}
+	body, sum := decoded[:len(decoded)-checksumSize], decoded[len(decoded)-checksumSize:]
+	if !topayz512.ConstantTimeEqual(checksum(body), sum) {
+		return Address{}, ErrChecksumMismatch
+	}
+
+	var network Network
+	found := false
+	for _, candidate := range Networks {
+		if candidate.Base58Prefix == body[0] {
+			network, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		return Address{}, ErrUnknownNetwork
+	}
+	if body[1] != Version0 {
+		return Address{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, body[1])
+	}
+
+	address := Address{Network: network, Version: body[1]}
+	copy(address.Hash[:], body[2:])
+	return address, nil
+}
+
+// checksum returns the Base58Check checksum of body
+func checksum(body []byte) []byte {
+	digest := topayz512.HashWithDomain(checksumDomain, body)
+	return digest[:checksumSize]
+}
@@ -0,0 +1,139 @@
+package address
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Test the encodings against the BIP 173, BIP 350 and Base58 vectors
+func TestEncodingVectors(t *testing.T) {
+	for _, valid := range []struct {
+		s        string
+		modified bool
+	}{
+		{"A12UEL5L", false},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", false},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", false},
+		{"A1LQFN3A", true},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", true},
+		{"split1checkupstagehandshakeupstreamerranterredcaperredlc445v", true},
+	} {
+		_, _, modified, err := bech32Decode(valid.s)
+		if err != nil || modified != valid.modified {
+			t.Errorf("bech32Decode(%q) = %v, %v", valid.s, modified, err)
+		}
+	}
+	for _, invalid := range []string{
+		"a12UEL5L",      // mixed case
+		"pzry9x0s0muk",  // no separator
+		"1pzry9x0s0muk", // empty human-readable part
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxx", // wrong checksum
+	} {
+		if _, _, _, err := bech32Decode(invalid); err == nil {
+			t.Errorf("bech32Decode(%q) succeeded", invalid)
+		}
+	}
+
+	for _, vector := range []struct{ data, encoded string }{
+		{"", ""},
+		{"\x00\x00\x01", "112"},
+		{"Hello World!", "2NEpo7TZRRrLZSi2U"},
+		{"The quick brown fox jumps over the lazy dog.", "USm3fpXnKG5EUBx2ndxBDMPVciP5hGey2Jh4NDv6gmeo1LkMeiKrLJUUBk6Z"},
+	} {
+		if encoded := base58Encode([]byte(vector.data)); encoded != vector.encoded {
+			t.Errorf("base58Encode(%q) = %q, want %q", vector.data, encoded, vector.encoded)
+		}
+		if decoded, ok := base58Decode(vector.encoded); !ok || !bytes.Equal(decoded, []byte(vector.data)) {
+			t.Errorf("base58Decode(%q) = %q", vector.encoded, decoded)
+		}
+	}
+	if _, ok := base58Decode("0OIl"); ok {
+		t.Error("base58Decode accepted characters outside the alphabet")
+	}
+}
+
+// Test deriving, encoding and parsing addresses in every format
+func TestAddresses(t *testing.T) {
+	_, publicKey, err := topayz512.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	_, otherKey, err := topayz512.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+
+	for _, network := range Networks {
+		address := FromPublicKey(publicKey, network)
+		if !address.Matches(publicKey) || address.Matches(otherKey) {
+			t.Errorf("%s address matches the wrong key", network.Name)
+		}
+		if !strings.HasPrefix(address.String(), network.HRP+"1") {
+			t.Errorf("String() = %q lacks the %s prefix", address, network.HRP)
+		}
+
+		for _, format := range []Format{Bech32m, Bech32, Base58Check} {
+			encoded, err := address.Encode(format)
+			if err != nil {
+				t.Fatalf("Encode(%s) failed: %v", format, err)
+			}
+			parsed, parsedFormat, err := Parse(encoded)
+			if err != nil || parsed != address || parsedFormat != format {
+				t.Errorf("Parse(%q) = %v, %s, %v", encoded, parsed, parsedFormat, err)
+			}
+			if _, _, err := ParseForNetwork(encoded, network); err != nil {
+				t.Errorf("ParseForNetwork(%q, %s) failed: %v", encoded, network.Name, err)
+			}
+
+			// A single changed character is caught by the checksum
+			typo := []byte(encoded)
+			position := len(typo) - 10
+			if typo[position] == 'q' || typo[position] == '2' {
+				typo[position] = 'p'
+			} else {
+				typo[position] = 'q'
+				if format == Base58Check {
+					typo[position] = '2'
+				}
+			}
+			if err := Validate(string(typo)); !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("%s typo: expected ErrChecksumMismatch, got %v", format, err)
+			}
+		}
+
+		upper := strings.ToUpper(address.String())
+		if parsed, _, err := Parse(upper); err != nil || parsed != address {
+			t.Errorf("Uppercase address didn't parse: %v", err)
+		}
+	}
+
+	mainnet, _ := FromPublicKey(publicKey, Mainnet).Encode(Base58Check)
+	if _, _, err := ParseForNetwork(mainnet, Testnet); !errors.Is(err, ErrUnknownNetwork) {
+		t.Errorf("Mainnet address on testnet: expected ErrUnknownNetwork, got %v", err)
+	}
+
+	other := FromPublicKey(publicKey, Network{Name: "other", HRP: "other", Base58Prefix: 0x01})
+	for _, format := range []Format{Bech32m, Base58Check} {
+		encoded, _ := other.Encode(format)
+		if err := Validate(encoded); err == nil {
+			t.Errorf("%s address of an unknown network validated", format)
+		}
+	}
+
+	versioned := FromPublicKey(publicKey, Mainnet)
+	versioned.Version = 1
+	encoded, _ := versioned.Encode(Bech32m)
+	if err := Validate(encoded); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if err := Validate(""); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Empty address: expected ErrInvalidAddress, got %v", err)
+	}
+	if _, err := versioned.Encode(Format(9)); err != ErrInvalidAddress {
+		t.Errorf("Unknown format: expected ErrInvalidAddress, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package address
+
+// base58Alphabet is Bitcoin's Base58 alphabet, which leaves out 0, O, I and l
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Values maps alphabet characters to their values, and others to 0xff
+var base58Values = func() [256]byte {
+	var values [256]byte
+	for i := range values {
+		values[i] = 0xff
+	}
+	for i := 0; i < len(base58Alphabet); i++ {
+		values[base58Alphabet[i]] = byte(i)
+	}
+	return values
+}()
+
+// base58Encode encodes data in Base58, each leading zero byte as a '1'
+func base58Encode(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+
+	// Repeatedly divide the big-endian number by 58, collecting remainders;
+	// log(256)/log(58) < 1.38 bounds the digit count
+	digits := make([]byte, 0, len(data)*138/100+1)
+	for _, b := range data[zeros:] {
+		carry := int(b)
+		for i := range digits {
+			carry += int(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+
+	out := make([]byte, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out[i] = base58Alphabet[0]
+	}
+	for i, digit := range digits {
+		out[len(out)-1-i] = base58Alphabet[digit]
+	}
+	return string(out)
+}
+
+// base58Decode decodes a Base58 string, reporting false for characters
+// outside the alphabet
+func base58Decode(s string) ([]byte, bool) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	// Little-endian base 256 digits of the number
+	bytes := make([]byte, 0, len(s)*733/1000+1)
+	for i := zeros; i < len(s); i++ {
+		value := base58Values[s[i]]
+		if value == 0xff {
+			return nil, false
+		}
+		carry := int(value)
+		for j := range bytes {
+			carry += int(bytes[j]) * 58
+			bytes[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			bytes = append(bytes, byte(carry))
+			carry >>= 8
+		}
+	}
+
+	out := make([]byte, zeros+len(bytes))
+	for i, b := range bytes {
+		out[len(out)-1-i] = b
+	}
+	return out, true
+}
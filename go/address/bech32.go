@@ -0,0 +1,163 @@
+package address
+
+import "strings"
+
+// bech32Charset maps 5-bit values to characters
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Checksum constants: BIP 173 Bech32 XORs 1 into the polymod, BIP 350
+// Bech32m this constant
+const (
+	bech32Constant  = 1
+	bech32mConstant = 0x2bc830a3
+)
+
+// Length limits from BIP 173
+const (
+	bech32MaxLength    = 90
+	bech32ChecksumSize = 6
+)
+
+// bech32Polymod computes the BCH checksum over 5-bit values
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := range generator {
+			if (top>>uint(i))&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+// bech32ExpandHRP spreads the human-readable part over 5-bit values for the
+// checksum
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// bech32Encode encodes 5-bit data under hrp with a Bech32m or Bech32 checksum
+func bech32Encode(hrp string, data []byte, modified bool) (string, error) {
+	if len(hrp) == 0 || len(hrp)+1+len(data)+bech32ChecksumSize > bech32MaxLength {
+		return "", ErrInvalidAddress
+	}
+	constant := uint32(bech32Constant)
+	if modified {
+		constant = bech32mConstant
+	}
+	hrp = strings.ToLower(hrp)
+	values := append(bech32ExpandHRP(hrp), data...)
+	polymod := bech32Polymod(append(values, make([]byte, bech32ChecksumSize)...)) ^ constant
+
+	var sb strings.Builder
+	sb.Grow(len(hrp) + 1 + len(data) + bech32ChecksumSize)
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, value := range data {
+		sb.WriteByte(bech32Charset[value])
+	}
+	for i := 0; i < bech32ChecksumSize; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+// splitBech32 splits s at its last '1' into the human-readable part and the
+// data characters
+func splitBech32(s string) (string, string, bool) {
+	separator := strings.LastIndexByte(s, '1')
+	if separator < 1 || separator+1+bech32ChecksumSize > len(s) {
+		return "", "", false
+	}
+	return s[:separator], s[separator+1:], true
+}
+
+// bech32Decode decodes a Bech32 or Bech32m string, returning the lowercase
+// human-readable part, the 5-bit data without the checksum and whether the
+// checksum is Bech32m. Mixed case is rejected, as BIP 173 requires.
+func bech32Decode(s string) (string, []byte, bool, error) {
+	if len(s) > bech32MaxLength {
+		return "", nil, false, ErrInvalidAddress
+	}
+	lower, upper := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			return "", nil, false, ErrInvalidAddress
+		}
+		lower = lower || ('a' <= c && c <= 'z')
+		upper = upper || ('A' <= c && c <= 'Z')
+	}
+	if lower && upper {
+		return "", nil, false, ErrInvalidAddress
+	}
+	s = strings.ToLower(s)
+
+	hrp, encoded, ok := splitBech32(s)
+	if !ok {
+		return "", nil, false, ErrInvalidAddress
+	}
+	data := make([]byte, len(encoded))
+	for i := 0; i < len(encoded); i++ {
+		value := strings.IndexByte(bech32Charset, encoded[i])
+		if value < 0 {
+			return "", nil, false, ErrInvalidAddress
+		}
+		data[i] = byte(value)
+	}
+
+	switch bech32Polymod(append(bech32ExpandHRP(hrp), data...)) {
+	case bech32mConstant:
+		return hrp, data[:len(data)-bech32ChecksumSize], true, nil
+	case bech32Constant:
+		return hrp, data[:len(data)-bech32ChecksumSize], false, nil
+	default:
+		return "", nil, false, ErrChecksumMismatch
+	}
+}
+
+// convertBits regroups data from fromBits-bit to toBits-bit values, padding
+// the last group with zeros if pad is set
+func convertBits(data []byte, fromBits, toBits uint, pad bool) []byte {
+	var acc, bits uint
+	maxValue := uint(1)<<toBits - 1
+	out := make([]byte, 0, (uint(len(data))*fromBits+toBits-1)/toBits)
+	for _, value := range data {
+		acc = acc<<fromBits | uint(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad && bits > 0 {
+		out = append(out, byte(acc<<(toBits-bits)&maxValue))
+	}
+	return out
+}
+
+// revertBits regroups 5-bit values into bytes, reporting false if the
+// padding is longer than 4 bits or not zero
+func revertBits(data []byte) ([]byte, bool) {
+	out := convertBits(data, 5, 8, false)
+	bits := uint(len(data)) * 5 % 8
+	if bits >= 5 {
+		return nil, false
+	}
+	if len(data) > 0 && data[len(data)-1]&(1<<bits-1) != 0 {
+		return nil, false
+	}
+	return out, true
+}
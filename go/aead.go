@@ -0,0 +1,192 @@
+package topayz512
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+)
+
+// Authenticated encryption keyed by a KEM shared secret
+//
+// A shared secret yields two AES-256-GCM keys, one per direction, so the
+// encapsulating and decapsulating parties can both send without ever using a
+// nonce twice under one key. Each sealed message is the 8-byte big-endian
+// nonce counter followed by the GCM ciphertext; the receiver rederives the
+// nonce from the counter.
+
+// Domain separation strings for AEAD keys and nonces
+const (
+	aeadKeyDomain   = "TOPAY-Z512-AEAD-KEY"
+	aeadNonceDomain = "TOPAY-Z512-AEAD-NONCE"
+)
+
+// aeadKeySize is the size of an AES-256 key
+const aeadKeySize = 32
+
+// AEADOverhead is the number of bytes Seal adds to a plaintext: the nonce
+// counter and the GCM tag
+const AEADOverhead = nonceCounterSize + 16
+
+// AEADRole selects which direction of a shared secret an AEAD sends on
+type AEADRole uint8
+
+// AEAD roles. The party that called KEMEncapsulate is the initiator and the
+// party that called KEMDecapsulate the responder; each opens what the other
+// seals.
+const (
+	AEADInitiator AEADRole = iota
+	AEADResponder
+)
+
+// String returns the name of an AEADRole
+func (r AEADRole) String() string {
+	switch r {
+	case AEADInitiator:
+		return "initiator"
+	case AEADResponder:
+		return "responder"
+	default:
+		return "unknown"
+	}
+}
+
+// AEADOptions configures an AEAD
+type AEADOptions struct {
+	// Nonces configures the sending nonce sequence; set Nonces.Store to keep
+	// counters unique when the same shared secret is used across restarts
+	Nonces *NonceSequenceOptions
+}
+
+// AEAD seals and opens messages between the two holders of a shared secret.
+// It is safe for concurrent use.
+type AEAD struct {
+	role     AEADRole
+	send     cipher.AEAD
+	receive  cipher.AEAD
+	sendKey  []byte
+	openKey  []byte
+	sequence *NonceSequence
+	erased   atomic.Bool
+}
+
+// NewAEAD derives an AES-256-GCM AEAD for role from a shared secret. A nil
+// opts keeps the nonce counter in memory. A secret erased with
+// SecureEraseSharedSecret returns ErrKeyDestroyed.
+func (ss SharedSecret) NewAEAD(role AEADRole, opts *AEADOptions) (*AEAD, error) {
+	if role != AEADInitiator && role != AEADResponder {
+		return nil, ErrInvalidAEADRole
+	}
+	if isErased(ss[:]) {
+		return nil, ErrKeyDestroyed
+	}
+	var nonceOptions *NonceSequenceOptions
+	if opts != nil {
+		nonceOptions = opts.Nonces
+	}
+
+	sendKey := deriveAEADKey(ss, role)
+	openKey := deriveAEADKey(ss, 1-role)
+	send, err := newAESGCM(sendKey)
+	if err != nil {
+		return nil, err
+	}
+	receive, err := newAESGCM(openKey)
+	if err != nil {
+		return nil, err
+	}
+	sequence, err := NewNonceSequence(sendKey, []byte(aeadNonceDomain), nonceOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AEAD{
+		role:     role,
+		send:     send,
+		receive:  receive,
+		sendKey:  sendKey,
+		openKey:  openKey,
+		sequence: sequence,
+	}, nil
+}
+
+// Role returns the role the AEAD sends as
+func (a *AEAD) Role() AEADRole {
+	return a.role
+}
+
+// Seal encrypts and authenticates plaintext and authenticates additionalData,
+// returning the counter-prefixed ciphertext. It returns ErrNonceExhausted once
+// the nonce counter runs out, and ErrKeyDestroyed after Wipe.
+func (a *AEAD) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	if a.erased.Load() {
+		return nil, ErrKeyDestroyed
+	}
+	if len(plaintext) > math.MaxInt-AEADOverhead {
+		return nil, ErrTooLarge
+	}
+	nonce, counter, err := a.sequence.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, nonceCounterSize, len(plaintext)+AEADOverhead)
+	binary.BigEndian.PutUint64(sealed, counter)
+	return a.send.Seal(sealed, nonce[:], plaintext, additionalData), nil
+}
+
+// Open authenticates and decrypts a message sealed by the other role with the
+// same additionalData. It returns ErrAuthenticationFailed for anything else.
+// Open doesn't detect replays; callers needing that can track the counter in
+// the first 8 bytes of each message. It returns ErrKeyDestroyed after Wipe.
+func (a *AEAD) Open(sealed, additionalData []byte) ([]byte, error) {
+	if a.erased.Load() {
+		return nil, ErrKeyDestroyed
+	}
+	if len(sealed) < AEADOverhead {
+		return nil, ErrAuthenticationFailed
+	}
+	counter := binary.BigEndian.Uint64(sealed)
+	nonce := DeriveNonce(a.openKey, counter, []byte(aeadNonceDomain))
+	plaintext, err := a.receive.Open(nil, nonce[:], sealed[nonceCounterSize:], additionalData)
+	if err != nil {
+		return nil, ErrAuthenticationFailed
+	}
+	return plaintext, nil
+}
+
+// Wipe erases the derived key copies. The AES key schedules inside the GCM
+// instances can't be reached and are left to the garbage collector. It does
+// nothing for a nil AEAD.
+func (a *AEAD) Wipe() {
+	if a == nil {
+		return
+	}
+	a.erased.Store(true)
+	SecureZero(a.sendKey)
+	SecureZero(a.openKey)
+}
+
+// Erased reports whether Wipe has been called
+func (a *AEAD) Erased() bool {
+	return a.erased.Load()
+}
+
+// deriveAEADKey derives the key role seals with
+func deriveAEADKey(secret SharedSecret, role AEADRole) []byte {
+	digest := HashMultiple([]byte(aeadKeyDomain), []byte{byte(role)}, secret[:])
+	key := make([]byte, aeadKeySize)
+	copy(key, digest[:aeadKeySize])
+	SecureZero(digest[:])
+	return key
+}
+
+// newAESGCM returns AES-GCM keyed with key
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,228 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Algorithm registry
+//
+// Every algorithm, hash variant and envelope format has a stable numeric ID
+// and a stable name. Serialized artifacts embed the ID, so a decoder can
+// dispatch on it and reject an unknown algorithm with ErrUnknownAlgorithm
+// instead of misreading the bytes. The names of algorithms that policies
+// govern are the policy names. IDs are never reused: a retired algorithm
+// stays registered and is marked Deprecated.
+//
+// The high byte of an ID is the algorithm kind:
+//
+//	0x01xx   hashes and MACs
+//	0x02xx   signatures
+//	0x03xx   KEMs
+//	0x04xx   envelope formats
+
+// AlgorithmID is the stable numeric identifier of a registered algorithm
+type AlgorithmID uint16
+
+// AlgorithmIDSize is the size of an encoded AlgorithmID
+const AlgorithmIDSize = 2
+
+// Registered algorithm IDs
+const (
+	AlgorithmIDHash       AlgorithmID = 0x0101
+	AlgorithmIDLegacySHA3 AlgorithmID = 0x0102
+	AlgorithmIDMAC        AlgorithmID = 0x0103
+
+	AlgorithmIDSignature       AlgorithmID = 0x0201
+	AlgorithmIDWOTS            AlgorithmID = 0x0202
+	AlgorithmIDXMSS            AlgorithmID = 0x0203
+	AlgorithmIDHybridSignature AlgorithmID = 0x0204
+
+	AlgorithmIDKEM         AlgorithmID = 0x0301
+	AlgorithmIDHybridKEM   AlgorithmID = 0x0302
+	AlgorithmIDMLKEM768    AlgorithmID = 0x0303
+	AlgorithmIDPlaceholder AlgorithmID = 0x0304
+
+	AlgorithmIDLegacyFragment   AlgorithmID = 0x0401
+	AlgorithmIDFragment         AlgorithmID = 0x0402
+	AlgorithmIDFileSignature    AlgorithmID = 0x0403
+	AlgorithmIDBuildAttestation AlgorithmID = 0x0404
+	AlgorithmIDBackup           AlgorithmID = 0x0405
+	AlgorithmIDKeystore         AlgorithmID = 0x0406
+	AlgorithmIDMerkleTree       AlgorithmID = 0x0407
+	AlgorithmIDMerkleProof      AlgorithmID = 0x0408
+)
+
+// AlgorithmKind groups registered algorithms
+type AlgorithmKind string
+
+// Algorithm kinds
+const (
+	AlgorithmKindHash      AlgorithmKind = "hash"
+	AlgorithmKindMAC       AlgorithmKind = "mac"
+	AlgorithmKindSignature AlgorithmKind = "signature"
+	AlgorithmKindKEM       AlgorithmKind = "kem"
+	AlgorithmKindEnvelope  AlgorithmKind = "envelope"
+)
+
+// Algorithm describes a registered algorithm. Sizes that don't apply, or
+// depend on parameters chosen at key generation, are zero.
+type Algorithm struct {
+	ID   AlgorithmID   `json:"id"`
+	Name string        `json:"name"`
+	Kind AlgorithmKind `json:"kind"`
+	// Hash names the hash variant the algorithm is built on
+	Hash string `json:"hash,omitempty"`
+	// Version is the format version of an envelope
+	Version int `json:"version,omitempty"`
+	// OID is the dotted object identifier of PEM and DER key encodings
+	OID string `json:"oid,omitempty"`
+	// SecurityLevel is the classical security level in bits
+	SecurityLevel int `json:"security_level,omitempty"`
+
+	PublicKeySize  int `json:"public_key_size,omitempty"`
+	SecretKeySize  int `json:"secret_key_size,omitempty"`
+	SignatureSize  int `json:"signature_size,omitempty"`
+	CiphertextSize int `json:"ciphertext_size,omitempty"`
+	// OutputSize is the size of a digest, tag or shared secret
+	OutputSize int `json:"output_size,omitempty"`
+
+	// Deprecated marks algorithms kept only to read existing artifacts
+	Deprecated bool `json:"deprecated,omitempty"`
+}
+
+// Hash variant names
+const (
+	hashVariantZ512 = "topayz512"
+	hashVariantSHA3 = "sha3-512"
+)
+
+// oidPrefix is the dotted form of the UUID arc under which pem.go's OIDs live
+const oidPrefix = "2.25.204137026632617517533622656149190760471."
+
+// algorithms is the registry, in ID order. It must not be modified.
+var algorithms = []Algorithm{
+	{ID: AlgorithmIDHash, Name: "topayz512-hash", Kind: AlgorithmKindHash, Hash: hashVariantZ512,
+		SecurityLevel: 512, OutputSize: HashSize},
+	{ID: AlgorithmIDLegacySHA3, Name: "sha3-512", Kind: AlgorithmKindHash, Hash: hashVariantSHA3,
+		SecurityLevel: 512, OutputSize: HashSize, Deprecated: true},
+	{ID: AlgorithmIDMAC, Name: "hmac-z512", Kind: AlgorithmKindMAC, Hash: hashVariantZ512,
+		SecurityLevel: 512, OutputSize: HashSize},
+
+	{ID: AlgorithmIDSignature, Name: AlgorithmSignature, Kind: AlgorithmKindSignature, Hash: hashVariantZ512,
+		OID: oidPrefix + "1", SecurityLevel: 512,
+		PublicKeySize: PublicKeySize, SecretKeySize: PrivateKeySize, SignatureSize: SignatureSize},
+	{ID: AlgorithmIDWOTS, Name: "wots", Kind: AlgorithmKindSignature, Hash: hashVariantZ512,
+		SecurityLevel: 256},
+	{ID: AlgorithmIDXMSS, Name: AlgorithmXMSS, Kind: AlgorithmKindSignature, Hash: hashVariantZ512,
+		SecurityLevel: 256},
+	{ID: AlgorithmIDHybridSignature, Name: AlgorithmHybridSignature, Kind: AlgorithmKindSignature, Hash: hashVariantZ512,
+		SecurityLevel: 512, PublicKeySize: HybridSignaturePublicKeySize, SignatureSize: HybridSignatureSize},
+
+	{ID: AlgorithmIDKEM, Name: AlgorithmKEM, Kind: AlgorithmKindKEM, Hash: hashVariantZ512,
+		OID: oidPrefix + "2", SecurityLevel: 512,
+		PublicKeySize: KEMPublicKeySize, SecretKeySize: KEMSecretKeySize, CiphertextSize: CiphertextSize,
+		OutputSize: SharedSecretSize},
+	{ID: AlgorithmIDHybridKEM, Name: AlgorithmHybridKEM, Kind: AlgorithmKindKEM, Hash: hashVariantZ512,
+		SecurityLevel: 512, PublicKeySize: HybridPublicKeySize, CiphertextSize: HybridCiphertextSize,
+		OutputSize: SharedSecretSize},
+	{ID: AlgorithmIDMLKEM768, Name: AlgorithmMLKEM768, Kind: AlgorithmKindKEM, Hash: hashVariantSHA3,
+		SecurityLevel: 192, PublicKeySize: MLKEM768PublicKeySize, SecretKeySize: MLKEM768SecretKeySize,
+		CiphertextSize: MLKEM768CiphertextSize, OutputSize: MLKEMSharedSecretSize},
+	{ID: AlgorithmIDPlaceholder, Name: AlgorithmPlaceholder, Kind: AlgorithmKindKEM, Hash: hashVariantZ512,
+		Deprecated: true},
+
+	{ID: AlgorithmIDLegacyFragment, Name: "fragment-v1", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: 1, Deprecated: true},
+	{ID: AlgorithmIDFragment, Name: "fragment", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: 2},
+	{ID: AlgorithmIDFileSignature, Name: "file-signature", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: FileSignatureVersion},
+	{ID: AlgorithmIDBuildAttestation, Name: "build-attestation", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: BuildAttestationVersion},
+	{ID: AlgorithmIDBackup, Name: "backup", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: BackupVersion},
+	{ID: AlgorithmIDKeystore, Name: "keystore", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: 1},
+	{ID: AlgorithmIDMerkleTree, Name: "merkle-tree", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: 2},
+	{ID: AlgorithmIDMerkleProof, Name: "merkle-proof", Kind: AlgorithmKindEnvelope, Hash: hashVariantZ512,
+		Version: 1},
+}
+
+// LookupAlgorithm returns the registered algorithm with an ID. It returns
+// ErrUnknownAlgorithm for an unregistered ID.
+func LookupAlgorithm(id AlgorithmID) (Algorithm, error) {
+	for _, algorithm := range algorithms {
+		if algorithm.ID == id {
+			return algorithm, nil
+		}
+	}
+	return Algorithm{}, fmt.Errorf("%w: id %s", ErrUnknownAlgorithm, id)
+}
+
+// LookupAlgorithmName returns the registered algorithm with a name. It
+// returns ErrUnknownAlgorithm for an unregistered name.
+func LookupAlgorithmName(name string) (Algorithm, error) {
+	for _, algorithm := range algorithms {
+		if algorithm.Name == name {
+			return algorithm, nil
+		}
+	}
+	return Algorithm{}, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, name)
+}
+
+// Algorithms returns every registered algorithm in ID order
+func Algorithms() []Algorithm {
+	return append([]Algorithm(nil), algorithms...)
+}
+
+// String returns the ID as four hex digits, like "0x0301"
+func (id AlgorithmID) String() string {
+	return fmt.Sprintf("0x%04x", uint16(id))
+}
+
+// MarshalText encodes the ID as its registered name, or its number if it
+// isn't registered
+func (id AlgorithmID) MarshalText() ([]byte, error) {
+	if algorithm, err := LookupAlgorithm(id); err == nil {
+		return []byte(algorithm.Name), nil
+	}
+	return []byte(strconv.Itoa(int(id))), nil
+}
+
+// UnmarshalText decodes a registered name or a number
+func (id *AlgorithmID) UnmarshalText(text []byte) error {
+	if algorithm, err := LookupAlgorithmName(string(text)); err == nil {
+		*id = algorithm.ID
+		return nil
+	}
+	n, err := strconv.ParseUint(string(text), 10, 16)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnknownAlgorithm, text)
+	}
+	*id = AlgorithmID(n)
+	return nil
+}
+
+// AppendAlgorithmID appends the big-endian encoding of id to dst
+func AppendAlgorithmID(dst []byte, id AlgorithmID) []byte {
+	return binary.BigEndian.AppendUint16(dst, uint16(id))
+}
+
+// ReadAlgorithmID decodes the algorithm ID at the start of data, returning
+// the registered algorithm and the rest of data. It returns
+// ErrUnknownAlgorithm for an unregistered ID and io.ErrUnexpectedEOF if data
+// is too short.
+func ReadAlgorithmID(data []byte) (Algorithm, []byte, error) {
+	if len(data) < AlgorithmIDSize {
+		return Algorithm{}, nil, io.ErrUnexpectedEOF
+	}
+	algorithm, err := LookupAlgorithm(AlgorithmID(binary.BigEndian.Uint16(data)))
+	if err != nil {
+		return Algorithm{}, nil, err
+	}
+	return algorithm, data[AlgorithmIDSize:], nil
+}
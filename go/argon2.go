@@ -0,0 +1,267 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+)
+
+// Argon2id (RFC 9106), version 0x13
+
+// Argon2 constants
+const (
+	argon2Version   = 0x13
+	argon2idType    = 2
+	argon2SyncPoint = 4
+	argon2BlockSize = 1024
+	argon2Words     = argon2BlockSize / 8
+)
+
+// argon2Block is one 1 KiB memory block
+type argon2Block [argon2Words]uint64
+
+// argon2idKey derives keyLen bytes with Argon2id. time, memory (in KiB) and
+// threads must be at least 1; memory is rounded as the RFC requires.
+func argon2idKey(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	lanes := uint32(threads)
+
+	// H0, followed by room for the block and lane indices of the first blocks
+	var h0 [64 + 8]byte
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:], lanes)
+	binary.LittleEndian.PutUint32(header[4:], keyLen)
+	binary.LittleEndian.PutUint32(header[8:], memory)
+	binary.LittleEndian.PutUint32(header[12:], time)
+	binary.LittleEndian.PutUint32(header[16:], argon2Version)
+	binary.LittleEndian.PutUint32(header[20:], argon2idType)
+	h := newBlake2b(64)
+	h.Write(header[:])
+	for _, field := range [][]byte{password, salt, secret, data} {
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(field)))
+		h.Write(length[:])
+		h.Write(field)
+	}
+	h.Sum(h0[:64])
+
+	memory = memory / (argon2SyncPoint * lanes) * (argon2SyncPoint * lanes)
+	if memory < 2*argon2SyncPoint*lanes {
+		memory = 2 * argon2SyncPoint * lanes
+	}
+	laneLength := memory / lanes
+	segmentLength := laneLength / argon2SyncPoint
+
+	blocks := make([]argon2Block, memory)
+	defer func() {
+		for i := range blocks {
+			blocks[i] = argon2Block{}
+		}
+	}()
+
+	var encoded [argon2BlockSize]byte
+	for lane := uint32(0); lane < lanes; lane++ {
+		binary.LittleEndian.PutUint32(h0[68:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[64:], i)
+			argon2Hash(encoded[:], h0[:])
+			block := &blocks[lane*laneLength+i]
+			for w := range block {
+				block[w] = binary.LittleEndian.Uint64(encoded[8*w:])
+			}
+		}
+	}
+	SecureZero(h0[:])
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoint; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < lanes; lane++ {
+				wg.Add(1)
+				go func(lane uint32) {
+					defer wg.Done()
+					argon2Segment(blocks, pass, slice, lane, lanes, laneLength, segmentLength, memory, time)
+				}(lane)
+			}
+			wg.Wait()
+		}
+	}
+
+	// XOR the last block of every lane and hash it to the output length
+	final := blocks[laneLength-1]
+	for lane := uint32(1); lane < lanes; lane++ {
+		last := &blocks[lane*laneLength+laneLength-1]
+		for w := range final {
+			final[w] ^= last[w]
+		}
+	}
+	for w, word := range final {
+		binary.LittleEndian.PutUint64(encoded[8*w:], word)
+	}
+	key := make([]byte, keyLen)
+	argon2Hash(key, encoded[:])
+	SecureZero(encoded[:])
+	return key
+}
+
+// argon2Segment fills one segment of one lane
+func argon2Segment(blocks []argon2Block, pass, slice, lane, lanes, laneLength, segmentLength, memory, time uint32) {
+	// Argon2id indexes data-independently in the first half of the first pass
+	independent := pass == 0 && slice < argon2SyncPoint/2
+	var address, input, zero argon2Block
+	if independent {
+		input[0] = uint64(pass)
+		input[1] = uint64(lane)
+		input[2] = uint64(slice)
+		input[3] = uint64(memory)
+		input[4] = uint64(time)
+		input[5] = argon2idType
+	}
+	nextAddresses := func() {
+		input[6]++
+		argon2Compress(&address, &input, &zero, false)
+		argon2Compress(&address, &address, &zero, false)
+	}
+
+	index := uint32(0)
+	if pass == 0 && slice == 0 {
+		// The first two blocks of each lane come from H0
+		index = 2
+		if independent {
+			nextAddresses()
+		}
+	}
+
+	offset := lane*laneLength + slice*segmentLength + index
+	for ; index < segmentLength; index, offset = index+1, offset+1 {
+		previous := offset - 1
+		if index == 0 && slice == 0 {
+			previous += laneLength
+		}
+
+		var random uint64
+		if independent {
+			if index%argon2Words == 0 {
+				nextAddresses()
+			}
+			random = address[index%argon2Words]
+		} else {
+			random = blocks[previous][0]
+		}
+
+		reference := argon2Reference(random, pass, slice, lane, index, lanes, laneLength, segmentLength)
+		argon2Compress(&blocks[offset], &blocks[previous], &blocks[reference], pass > 0)
+	}
+}
+
+// argon2Reference maps a pseudo-random value to the block the current block
+// references
+func argon2Reference(random uint64, pass, slice, lane, index, lanes, laneLength, segmentLength uint32) uint32 {
+	referenceLane := uint32(random>>32) % lanes
+	if pass == 0 && slice == 0 {
+		referenceLane = lane
+	}
+	sameLane := referenceLane == lane
+
+	// The reference area excludes the segment being computed in other lanes
+	// and the block immediately before the current one
+	var area, start uint32
+	if pass == 0 {
+		area = slice * segmentLength
+		if sameLane {
+			area += index
+		}
+	} else {
+		area = laneLength - segmentLength
+		if sameLane {
+			area += index
+		}
+		start = (slice + 1) % argon2SyncPoint * segmentLength
+	}
+	if sameLane || index == 0 {
+		area--
+	}
+
+	x := random & 0xffffffff
+	x = x * x >> 32
+	x = uint64(area) - 1 - uint64(area)*x>>32
+	return referenceLane*laneLength + uint32((uint64(start)+x)%uint64(laneLength))
+}
+
+// argon2Compress sets out to G(x, y), XORed into out's previous contents when
+// xor is set, as passes after the first require
+func argon2Compress(out, x, y *argon2Block, xor bool) {
+	var r, z argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	z = r
+
+	// Rows of 16 words, then columns of pairs of words
+	for i := 0; i < argon2Words; i += 16 {
+		blamkaRound(&z, i, i+1, i+2, i+3, i+4, i+5, i+6, i+7,
+			i+8, i+9, i+10, i+11, i+12, i+13, i+14, i+15)
+	}
+	for i := 0; i < 16; i += 2 {
+		blamkaRound(&z, i, i+1, i+16, i+17, i+32, i+33, i+48, i+49,
+			i+64, i+65, i+80, i+81, i+96, i+97, i+112, i+113)
+	}
+
+	for i := range out {
+		if xor {
+			out[i] ^= r[i] ^ z[i]
+		} else {
+			out[i] = r[i] ^ z[i]
+		}
+	}
+}
+
+// blamkaRound is the BLAKE2b round with multiplication-hardened mixing,
+// applied to 16 words of z
+func blamkaRound(z *argon2Block, v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 int) {
+	g := func(a, b, c, d int) {
+		z[a] = blamka(z[a], z[b])
+		z[d] = bits.RotateLeft64(z[d]^z[a], -32)
+		z[c] = blamka(z[c], z[d])
+		z[b] = bits.RotateLeft64(z[b]^z[c], -24)
+		z[a] = blamka(z[a], z[b])
+		z[d] = bits.RotateLeft64(z[d]^z[a], -16)
+		z[c] = blamka(z[c], z[d])
+		z[b] = bits.RotateLeft64(z[b]^z[c], -63)
+	}
+	g(v0, v4, v8, v12)
+	g(v1, v5, v9, v13)
+	g(v2, v6, v10, v14)
+	g(v3, v7, v11, v15)
+	g(v0, v5, v10, v15)
+	g(v1, v6, v11, v12)
+	g(v2, v7, v8, v13)
+	g(v3, v4, v9, v14)
+}
+
+// blamka is x + y + 2 * lo32(x) * lo32(y)
+func blamka(x, y uint64) uint64 {
+	return x + y + 2*(x&0xffffffff)*(y&0xffffffff)
+}
+
+// argon2Hash is the variable-length hash H' filling out
+func argon2Hash(out, input []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+	if len(out) <= 64 {
+		blake2bSum(out, length[:], input)
+		return
+	}
+
+	// 32 bytes from each 64-byte digest in the chain, then the rest of the last
+	var v [64]byte
+	blake2bSum(v[:], length[:], input)
+	for len(out) > 64 {
+		copy(out, v[:32])
+		out = out[32:]
+		if len(out) > 64 {
+			blake2bSum(v[:], v[:])
+		}
+	}
+	blake2bSum(out, v[:])
+	SecureZero(v[:])
+}
@@ -0,0 +1,321 @@
+package topayz512
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Multi-transfer reassembly
+//
+// A FragmentAssembler takes fragments straight off a shared channel, from
+// any number of concurrent transfers and in any order, and hands back each
+// payload as its last fragment arrives. Fragments are grouped by ID and
+// verified on receipt, duplicates are ignored, and every transfer and the
+// assembler as a whole have a memory budget, so a sender can't make the
+// receiver buffer without bound. Transfers that stall can be expired.
+
+// Default FragmentAssembler limits
+const (
+	// DefaultMaxTransferSize is the most a single transfer may buffer
+	DefaultMaxTransferSize = 64 << 20
+
+	// DefaultMaxBufferedSize is the most all transfers may buffer together
+	DefaultMaxBufferedSize = 256 << 20
+)
+
+// AssemblerOptions configures a FragmentAssembler
+type AssemblerOptions struct {
+	// Key keys the fragment checksums; nil checks plain hashes
+	Key *FragmentKey
+	// Committer checks fragments instead of Key when set
+	Committer Committer
+	// MaxTransfers bounds the transfers in progress; zero uses
+	// DefaultMaxPayloads
+	MaxTransfers int
+	// MaxTransferSize bounds the bytes one transfer buffers; zero uses
+	// DefaultMaxTransferSize
+	MaxTransferSize int64
+	// MaxBufferedSize bounds the bytes all transfers buffer; zero uses
+	// DefaultMaxBufferedSize
+	MaxBufferedSize int64
+	// Timeout is how long a transfer may go without a new fragment before
+	// Expire drops it; zero keeps transfers until they complete or are
+	// dropped
+	Timeout time.Duration
+	// Clock returns the current time; nil uses time.Now
+	Clock func() time.Time
+}
+
+// AssembledPayload is a payload whose transfer completed
+type AssembledPayload struct {
+	ID       ID
+	Data     []byte
+	Metadata FragmentMetadata
+}
+
+// TransferStatus describes a transfer in progress
+type TransferStatus struct {
+	ID ID
+	// Received is the number of distinct fragments received of Total
+	Received uint32
+	Total    uint32
+	// Buffered is the number of payload bytes held
+	Buffered int64
+	// Started and LastActivity are when the first and latest new
+	// fragments arrived
+	Started      time.Time
+	LastActivity time.Time
+}
+
+// transfer is the state of one transfer in progress
+type transfer struct {
+	status    TransferStatus
+	fragments [][]byte
+}
+
+// FragmentAssembler reassembles payloads from the interleaved fragments of
+// concurrent transfers. It is safe for concurrent use.
+type FragmentAssembler struct {
+	options    AssemblerOptions
+	commitment fragmentCommitment
+	transfers  map[ID]*transfer
+	buffered   int64
+	mutex      sync.Mutex
+}
+
+// NewFragmentAssembler creates an assembler; nil options use the defaults
+func NewFragmentAssembler(opts *AssemblerOptions) *FragmentAssembler {
+	var options AssemblerOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.MaxTransfers <= 0 {
+		options.MaxTransfers = DefaultMaxPayloads
+	}
+	if options.MaxTransferSize <= 0 {
+		options.MaxTransferSize = DefaultMaxTransferSize
+	}
+	if options.MaxBufferedSize <= 0 {
+		options.MaxBufferedSize = DefaultMaxBufferedSize
+	}
+	if options.Clock == nil {
+		options.Clock = time.Now
+	}
+
+	var commitment fragmentCommitment = keyedCommitment{key: options.Key}
+	if options.Committer != nil {
+		commitment = committerCommitment{committer: options.Committer}
+	}
+	return &FragmentAssembler{
+		options:    options,
+		commitment: commitment,
+		transfers:  make(map[ID]*transfer),
+	}
+}
+
+// Add verifies a fragment and buffers it with the rest of its transfer. It
+// returns the payload when the fragment completes the transfer, and nil
+// otherwise, including for fragments already received.
+//
+// Fragments failing their checksum return ErrReconstructionFailed, ones
+// with an index out of range ErrInvalidFragmentIndex, ones whose count
+// disagrees with their transfer's ErrInvalidFragmentCount, and
+// a new transfer beyond MaxTransfers ErrTooManyPayloads. None of these
+// affect the transfer. A fragment taking its transfer beyond
+// MaxTransferSize returns a *TooLargeError and drops the transfer; one that
+// would take the assembler beyond MaxBufferedSize returns a *TooLargeError
+// and can be retried once other transfers complete.
+func (a *FragmentAssembler) Add(fragment Fragment) (*AssembledPayload, error) {
+	if fragment.Total == 0 || fragment.Total > MaxFragments {
+		return nil, ErrInvalidFragmentCount
+	}
+	if fragment.Index >= fragment.Total {
+		return nil, ErrInvalidFragmentIndex
+	}
+	if !a.commitment.verify(fragment) {
+		return nil, ErrReconstructionFailed
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := a.options.Clock()
+	t, ok := a.transfers[fragment.ID]
+	if !ok {
+		if err := a.checkNewTransfer(fragment); err != nil {
+			return nil, err
+		}
+		if len(a.transfers) >= a.options.MaxTransfers {
+			a.expire(now)
+			if len(a.transfers) >= a.options.MaxTransfers {
+				return nil, ErrTooManyPayloads
+			}
+		}
+		t = &transfer{
+			status:    TransferStatus{ID: fragment.ID, Total: fragment.Total, Started: now},
+			fragments: make([][]byte, fragment.Total),
+		}
+		a.transfers[fragment.ID] = t
+	}
+	if fragment.Total != t.status.Total {
+		return nil, ErrInvalidFragmentCount
+	}
+	if t.fragments[fragment.Index] != nil {
+		return nil, nil
+	}
+
+	size := int64(len(fragment.Data))
+	if t.status.Buffered+size > a.options.MaxTransferSize {
+		a.drop(fragment.ID)
+		return nil, &TooLargeError{Limit: "transfer size", Size: uint64(t.status.Buffered + size), Max: uint64(a.options.MaxTransferSize)}
+	}
+	if a.buffered+size > a.options.MaxBufferedSize {
+		if t.status.Received == 0 {
+			delete(a.transfers, fragment.ID)
+		}
+		return nil, &TooLargeError{Limit: "buffered size", Size: uint64(a.buffered + size), Max: uint64(a.options.MaxBufferedSize)}
+	}
+
+	// Keep a non-nil slice for empty fragments so they count as received
+	data := append(make([]byte, 0, max(size, 1)), fragment.Data...)
+	t.fragments[fragment.Index] = data
+	t.status.Received++
+	t.status.Buffered += size
+	t.status.LastActivity = now
+	a.buffered += size
+	if t.status.Received < t.status.Total {
+		return nil, nil
+	}
+
+	a.drop(fragment.ID)
+	payload := bytes.Join(t.fragments, nil)
+	return &AssembledPayload{
+		ID:   fragment.ID,
+		Data: payload,
+		Metadata: FragmentMetadata{
+			OriginalSize:  uint64(len(payload)),
+			FragmentCount: t.status.Total,
+			FragmentSize:  uint32(len(t.fragments[0])),
+			Timestamp:     now,
+			Algorithm:     "TOPAY-Z512",
+			Checksum:      ComputeHash(payload),
+		},
+	}, nil
+}
+
+// checkNewTransfer rejects the first fragment of a transfer that can't fit
+// MaxTransferSize: every fragment but the last is the same size, so one of
+// them bounds the payload from below
+func (a *FragmentAssembler) checkNewTransfer(fragment Fragment) error {
+	if fragment.Index == fragment.Total-1 {
+		return nil
+	}
+	minimum := uint64(len(fragment.Data))*uint64(fragment.Total-1) + 1
+	if minimum > uint64(a.options.MaxTransferSize) {
+		return &TooLargeError{Limit: "transfer size", Size: minimum, Max: uint64(a.options.MaxTransferSize)}
+	}
+	return nil
+}
+
+// AddSerialized deserializes a fragment from the channel and adds it
+func (a *FragmentAssembler) AddSerialized(data []byte) (*AssembledPayload, error) {
+	fragment, err := DeserializeFragment(data)
+	if err != nil {
+		return nil, err
+	}
+	return a.Add(fragment)
+}
+
+// Status returns the progress of a transfer, and false when it isn't in
+// progress
+func (a *FragmentAssembler) Status(id ID) (TransferStatus, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	t, ok := a.transfers[id]
+	if !ok {
+		return TransferStatus{}, false
+	}
+	return t.status, true
+}
+
+// Transfers returns the progress of every transfer in progress, in ID order
+func (a *FragmentAssembler) Transfers() []TransferStatus {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	statuses := make([]TransferStatus, 0, len(a.transfers))
+	for _, t := range a.transfers {
+		statuses = append(statuses, t.status)
+	}
+	slices.SortFunc(statuses, func(x, y TransferStatus) int { return bytes.Compare(x.ID[:], y.ID[:]) })
+	return statuses
+}
+
+// Missing returns the indices a transfer still lacks, so the sender can be
+// asked for just those, and nil when it isn't in progress
+func (a *FragmentAssembler) Missing(id ID) []uint32 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	t, ok := a.transfers[id]
+	if !ok {
+		return nil
+	}
+	var missing []uint32
+	for index, data := range t.fragments {
+		if data == nil {
+			missing = append(missing, uint32(index))
+		}
+	}
+	return missing
+}
+
+// Buffered returns the number of payload bytes held across all transfers
+func (a *FragmentAssembler) Buffered() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.buffered
+}
+
+// Drop abandons a transfer, returning whether it was in progress
+func (a *FragmentAssembler) Drop(id ID) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.drop(id)
+}
+
+// drop removes a transfer; the mutex must be held
+func (a *FragmentAssembler) drop(id ID) bool {
+	t, ok := a.transfers[id]
+	if ok {
+		a.buffered -= t.status.Buffered
+		delete(a.transfers, id)
+	}
+	return ok
+}
+
+// Expire drops the transfers without a new fragment for longer than
+// Timeout and returns their last status. It does nothing without a Timeout.
+func (a *FragmentAssembler) Expire() []TransferStatus {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.expire(a.options.Clock())
+}
+
+// expire drops idle transfers as of now; the mutex must be held
+func (a *FragmentAssembler) expire(now time.Time) []TransferStatus {
+	if a.options.Timeout <= 0 {
+		return nil
+	}
+	var expired []TransferStatus
+	for id, t := range a.transfers {
+		if now.Sub(t.status.LastActivity) > a.options.Timeout {
+			expired = append(expired, t.status)
+			a.drop(id)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,163 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Signed build provenance attestations
+
+// BuildAttestationVersion is the current attestation format version
+const BuildAttestationVersion = 1
+
+// buildAttestationDomain separates attestation statements from other signed messages
+const buildAttestationDomain = "TOPAY-Z512-BUILD-ATTESTATION"
+
+// BuildArtifact is one output of a build
+type BuildArtifact struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+	Hash Hash   `json:"hash"`
+}
+
+// BuildAttestation binds the source tree, build environment and output
+// artifacts of a build under a signature
+type BuildAttestation struct {
+	Version           uint32          `json:"version"`
+	SourceHash        Hash            `json:"source_hash"`
+	EnvironmentDigest Hash            `json:"environment_digest"`
+	Artifacts         []BuildArtifact `json:"artifacts"`
+	BuiltAt           time.Time       `json:"built_at"`
+	Signer            Hash            `json:"signer"`
+	Signature         []byte          `json:"signature,omitempty"`
+}
+
+// EnvironmentDigest hashes build environment variables (toolchain version,
+// target platform, flags) independently of their order
+func EnvironmentDigest(environment map[string]string) Hash {
+	keys := make([]string, 0, len(environment))
+	for key := range environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hs := GetHashState()
+	defer PutHashState(hs)
+
+	var length [8]byte
+	hs.Update([]byte("TOPAY-Z512-BUILD-ENV"))
+	for _, key := range keys {
+		for _, field := range []string{key, environment[key]} {
+			binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+			hs.Update(length[:])
+			hs.Update([]byte(field))
+		}
+	}
+	return hs.Finalize()
+}
+
+// NewBuildAttestation creates an unsigned attestation for a build
+func NewBuildAttestation(sourceHash, environmentDigest Hash, artifacts []BuildArtifact) *BuildAttestation {
+	return &BuildAttestation{
+		Version:           BuildAttestationVersion,
+		SourceHash:        sourceHash,
+		EnvironmentDigest: environmentDigest,
+		Artifacts:         append([]BuildArtifact(nil), artifacts...),
+		BuiltAt:           time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// AddArtifactFile hashes the file at path and records it under name
+func (ba *BuildAttestation) AddArtifactFile(name, path string) error {
+	hash, size, err := HashFile(path)
+	if err != nil {
+		return err
+	}
+	ba.Artifacts = append(ba.Artifacts, BuildArtifact{Name: name, Size: size, Hash: hash})
+	return nil
+}
+
+// CanonicalJSON returns the deterministic encoding covered by the signature:
+// the attestation without its signature, with artifacts sorted by name and
+// the timestamp in UTC
+func (ba *BuildAttestation) CanonicalJSON() ([]byte, error) {
+	canonical := *ba
+	canonical.Signature = nil
+	canonical.BuiltAt = ba.BuiltAt.UTC()
+	canonical.Artifacts = append([]BuildArtifact(nil), ba.Artifacts...)
+	sort.Slice(canonical.Artifacts, func(i, j int) bool { return canonical.Artifacts[i].Name < canonical.Artifacts[j].Name })
+
+	return json.Marshal(canonical)
+}
+
+// statement returns the signed bytes of the attestation
+func (ba *BuildAttestation) statement() ([]byte, error) {
+	canonical, err := ba.CanonicalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(buildAttestationDomain), canonical...), nil
+}
+
+// Sign records the signer and signs the canonical form with key
+func (ba *BuildAttestation) Sign(key *XMSSPrivateKey) error {
+	ba.Signer = key.Public().Fingerprint()
+
+	statement, err := ba.statement()
+	if err != nil {
+		return err
+	}
+	signature, err := key.Sign(statement)
+	if err != nil {
+		return err
+	}
+	ba.Signature = signature.Bytes()
+	return nil
+}
+
+// Verify checks the attestation signature against trustedKeys and returns the signer
+func (ba *BuildAttestation) Verify(trustedKeys []XMSSPublicKey) (XMSSPublicKey, error) {
+	if ba.Version != BuildAttestationVersion {
+		return XMSSPublicKey{}, ErrUnsupportedVersion
+	}
+
+	signer := findTrustedKey(trustedKeys, ba.Signer)
+	if signer == nil {
+		return XMSSPublicKey{}, ErrUntrustedSigner
+	}
+
+	signature, err := XMSSSignatureFromBytes(signer.Params, ba.Signature)
+	if err != nil {
+		return XMSSPublicKey{}, err
+	}
+	statement, err := ba.statement()
+	if err != nil {
+		return XMSSPublicKey{}, err
+	}
+	if !signer.Verify(statement, signature) {
+		return XMSSPublicKey{}, ErrInvalidSignature
+	}
+	return *signer, nil
+}
+
+// VerifyArtifactFile checks that the file at path matches the artifact recorded
+// under name. It does not check the signature; call Verify first.
+func (ba *BuildAttestation) VerifyArtifactFile(name, path string) error {
+	for _, artifact := range ba.Artifacts {
+		if artifact.Name != name {
+			continue
+		}
+
+		hash, size, err := HashFile(path)
+		if err != nil {
+			return err
+		}
+		if size != artifact.Size || !HashEqual(hash, artifact.Hash) {
+			return ErrFileModified
+		}
+		return nil
+	}
+	return ErrUnknownArtifact
+}
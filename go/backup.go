@@ -0,0 +1,382 @@
+package topayz512
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// End-to-end encrypted backups built from fragmentation, parity and KEM
+
+// Backup format constants
+const (
+	// BackupVersion is the current backup archive format version
+	BackupVersion = 1
+
+	// DefaultBackupParityShards is the parity shard count used when none is configured
+	DefaultBackupParityShards = 2
+
+	// backupKeySize is the size of the AES-256 content key
+	backupKeySize = 32
+)
+
+// Shard kinds recorded in sealed backup shards
+const (
+	backupShardData   = 0
+	backupShardParity = 1
+)
+
+// BackupOptions configures CreateBackup
+type BackupOptions struct {
+	// ParityShards is the number of parity shards protecting the archive
+	ParityShards int
+	// Label is a free-form description stored unencrypted in the manifest
+	Label string
+}
+
+// BackupRecipient holds the content key wrapped for a single KEM public key
+type BackupRecipient struct {
+	KeyID      Hash       `json:"key_id"`
+	Ciphertext Ciphertext `json:"ciphertext"`
+	WrappedKey []byte     `json:"wrapped_key"`
+}
+
+// BackupManifest describes a backup and lets any recipient recover the content key
+type BackupManifest struct {
+	Version      uint32            `json:"version"`
+	BackupID     Hash              `json:"backup_id"`
+	Label        string            `json:"label"`
+	CreatedAt    time.Time         `json:"created_at"`
+	OriginalSize uint64            `json:"original_size"`
+	DataShards   uint32            `json:"data_shards"`
+	ParityShards uint32            `json:"parity_shards"`
+	Recipients   []BackupRecipient `json:"recipients"`
+}
+
+// BackupShard is a single encrypted data fragment or parity shard
+type BackupShard struct {
+	Kind   uint8  `json:"kind"`
+	Index  uint32 `json:"index"`
+	Sealed []byte `json:"sealed"`
+}
+
+// BackupArchive is a complete encrypted backup with its recovery manifest
+type BackupArchive struct {
+	Manifest BackupManifest `json:"manifest"`
+	Shards   []BackupShard  `json:"shards"`
+}
+
+// CreateBackup reads all data from r and produces an encrypted, erasure-coded
+// archive that any of the recipients can restore with their KEM secret key
+func CreateBackup(r io.Reader, recipients []KEMPublicKey, opts *BackupOptions) (*BackupArchive, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	var options BackupOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.ParityShards <= 0 {
+		options.ParityShards = DefaultBackupParityShards
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(data)
+
+	fragResult, err := FragmentData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	parity, err := GenerateParity(fragResult.Fragments, options.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	contentKey, err := SecureRandom(backupKeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(contentKey)
+
+	idBytes, err := SecureRandom(HashSize)
+	if err != nil {
+		return nil, err
+	}
+	backupID := ComputeHash(idBytes)
+
+	manifest := BackupManifest{
+		Version:      BackupVersion,
+		BackupID:     backupID,
+		Label:        options.Label,
+		CreatedAt:    time.Now().UTC(),
+		OriginalSize: fragResult.Metadata.OriginalSize,
+		DataShards:   fragResult.Metadata.FragmentCount,
+		ParityShards: uint32(len(parity)),
+	}
+
+	// Wrap the content key for every recipient
+	for _, publicKey := range recipients {
+		ciphertext, sharedSecret, err := KEMEncapsulate(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		kek := kemWrapKey("TOPAY-Z512-BACKUP-KEK", sharedSecret, backupID)
+		wrapped, err := sealAESGCM(kek, backupNonce(backupShardData, 0), contentKey, backupID[:])
+		SecureZero(kek)
+		SecureEraseSharedSecret(&sharedSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Recipients = append(manifest.Recipients, BackupRecipient{
+			KeyID:      ComputeHash(publicKey[:]),
+			Ciphertext: ciphertext,
+			WrappedKey: wrapped,
+		})
+	}
+
+	// Seal every fragment and parity shard under the content key
+	shards := make([]BackupShard, 0, len(fragResult.Fragments)+len(parity))
+	for _, fragment := range fragResult.Fragments {
+		sealed, err := sealAESGCM(contentKey, backupNonce(backupShardData, fragment.Index),
+			SerializeFragment(fragment), backupShardAAD(backupID, backupShardData, fragment.Index))
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, BackupShard{Kind: backupShardData, Index: fragment.Index, Sealed: sealed})
+	}
+	for _, shard := range parity {
+		sealed, err := sealAESGCM(contentKey, backupNonce(backupShardParity, shard.Index),
+			serializeParityShard(shard), backupShardAAD(backupID, backupShardParity, shard.Index))
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, BackupShard{Kind: backupShardParity, Index: shard.Index, Sealed: sealed})
+	}
+
+	return &BackupArchive{
+		Manifest: manifest,
+		Shards:   shards,
+	}, nil
+}
+
+// RestoreBackup decrypts and reassembles an archive using a recipient's KEM secret key.
+// Missing or damaged shards are repaired from parity when possible.
+func RestoreBackup(archive *BackupArchive, identity KEMSecretKey) ([]byte, error) {
+	if archive == nil {
+		return nil, ErrEmptyData
+	}
+
+	manifest := archive.Manifest
+	if manifest.Version != BackupVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	contentKey, err := unwrapBackupKey(manifest, identity)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(contentKey)
+
+	var fragments []Fragment
+	var parity []ParityShard
+	for _, shard := range archive.Shards {
+		plaintext, err := openAESGCM(contentKey, backupNonce(shard.Kind, shard.Index),
+			shard.Sealed, backupShardAAD(manifest.BackupID, shard.Kind, shard.Index))
+		if err != nil {
+			// Damaged shards are treated as erasures
+			continue
+		}
+
+		switch shard.Kind {
+		case backupShardData:
+			if fragment, err := DeserializeFragment(plaintext); err == nil && fragment.Index == shard.Index {
+				fragments = append(fragments, fragment)
+			}
+		case backupShardParity:
+			if parityShard, err := deserializeParityShard(plaintext); err == nil && parityShard.Index == shard.Index {
+				parity = append(parity, parityShard)
+			}
+		}
+	}
+
+	repaired, err := RepairFromParity(fragments, parity)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ReconstructData(repaired)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Metadata.OriginalSize != manifest.OriginalSize {
+		return nil, ErrReconstructionFailed
+	}
+
+	return result.Data, nil
+}
+
+// unwrapBackupKey recovers the content key for the recipient holding identity
+func unwrapBackupKey(manifest BackupManifest, identity KEMSecretKey) ([]byte, error) {
+	publicKey := deriveKEMPublicKey(identity)
+	keyID := ComputeHash(publicKey[:])
+
+	for _, recipient := range manifest.Recipients {
+		if !HashEqual(recipient.KeyID, keyID) {
+			continue
+		}
+
+		sharedSecret, err := KEMDecapsulate(identity, recipient.Ciphertext)
+		if err != nil {
+			return nil, err
+		}
+
+		kek := kemWrapKey("TOPAY-Z512-BACKUP-KEK", sharedSecret, manifest.BackupID)
+		contentKey, err := openAESGCM(kek, backupNonce(backupShardData, 0), recipient.WrappedKey, manifest.BackupID[:])
+		SecureZero(kek)
+		SecureEraseSharedSecret(&sharedSecret)
+		if err != nil {
+			return nil, ErrDecapsulationFailed
+		}
+
+		return contentKey, nil
+	}
+
+	return nil, ErrNoMatchingRecipient
+}
+
+// kemWrapKey derives a domain-separated AES key from a KEM shared secret,
+// used to wrap content keys and secret shares for a recipient
+func kemWrapKey(domain string, sharedSecret SharedSecret, context Hash) []byte {
+	digest := HashMultiple([]byte(domain), context[:], sharedSecret[:])
+	key := make([]byte, backupKeySize)
+	copy(key, digest[:backupKeySize])
+	SecureZero(digest[:])
+	return key
+}
+
+// backupNonce returns the unique GCM nonce for a shard
+func backupNonce(kind uint8, index uint32) []byte {
+	nonce := make([]byte, 12)
+	nonce[0] = kind
+	binary.BigEndian.PutUint32(nonce[8:], index)
+	return nonce
+}
+
+// backupShardAAD binds a sealed shard to its backup and position
+func backupShardAAD(backupID Hash, kind uint8, index uint32) []byte {
+	aad := make([]byte, HashSize+5)
+	copy(aad, backupID[:])
+	aad[HashSize] = kind
+	binary.BigEndian.PutUint32(aad[HashSize+1:], index)
+	return aad
+}
+
+// sealAESGCM encrypts plaintext with AES-GCM
+func sealAESGCM(key, nonce, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// openAESGCM decrypts and authenticates ciphertext with AES-GCM
+func openAESGCM(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+// serializeParityShard converts a parity shard to bytes
+func serializeParityShard(shard ParityShard) []byte {
+	// ID + Index + DataShards + ParityShards + FragmentSize + OriginalSize + DataLen + Data + Checksum
+	result := make([]byte, IDSize+4*4+8+4+len(shard.Data)+HashSize)
+	offset := 0
+
+	copy(result[offset:], shard.ID[:])
+	offset += IDSize
+
+	for _, field := range []uint32{shard.Index, shard.DataShards, shard.ParityShards, shard.FragmentSize} {
+		binary.BigEndian.PutUint32(result[offset:], field)
+		offset += 4
+	}
+
+	binary.BigEndian.PutUint64(result[offset:], shard.OriginalSize)
+	offset += 8
+
+	binary.BigEndian.PutUint32(result[offset:], uint32(len(shard.Data)))
+	offset += 4
+
+	copy(result[offset:], shard.Data)
+	offset += len(shard.Data)
+
+	copy(result[offset:], shard.Checksum[:])
+
+	return result
+}
+
+// deserializeParityShard converts bytes to a parity shard
+func deserializeParityShard(data []byte) (ParityShard, error) {
+	const headerSize = IDSize + 4*4 + 8 + 4
+	if len(data) < headerSize+HashSize {
+		return ParityShard{}, ErrInvalidFragmentCount
+	}
+
+	var id ID
+	copy(id[:], data)
+	offset := IDSize
+
+	var fields [4]uint32
+	for i := range fields {
+		fields[i] = binary.BigEndian.Uint32(data[offset:])
+		offset += 4
+	}
+
+	originalSize := binary.BigEndian.Uint64(data[offset:])
+	offset += 8
+
+	dataLen := binary.BigEndian.Uint32(data[offset:])
+	offset += 4
+
+	if uint64(len(data)) != uint64(offset)+uint64(dataLen)+uint64(HashSize) {
+		return ParityShard{}, ErrInvalidFragmentCount
+	}
+
+	shardData := make([]byte, dataLen)
+	copy(shardData, data[offset:offset+int(dataLen)])
+	offset += int(dataLen)
+
+	var checksum Hash
+	copy(checksum[:], data[offset:])
+
+	return ParityShard{
+		ID:           id,
+		Index:        fields[0],
+		DataShards:   fields[1],
+		ParityShards: fields[2],
+		FragmentSize: fields[3],
+		OriginalSize: originalSize,
+		Data:         shardData,
+		Checksum:     checksum,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Unkeyed BLAKE2b (RFC 7693), the hash Argon2 is built on. Like the Keccak
+// sponge it is implemented here so the module keeps no dependencies.
+
+// blake2bBlockSize is the BLAKE2b block size in bytes
+const blake2bBlockSize = 128
+
+// blake2bIV is the BLAKE2b initialization vector, the SHA-512 initial values
+var blake2bIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+// blake2bSigma is the message word schedule of each round
+var blake2bSigma = [12][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+}
+
+// blake2bState is an unkeyed BLAKE2b hash with a fixed output size
+type blake2bState struct {
+	h      [8]uint64
+	t      uint64
+	buffer [blake2bBlockSize]byte
+	offset int
+	size   int
+}
+
+// newBlake2b returns a BLAKE2b state producing size bytes, 1 to 64
+func newBlake2b(size int) *blake2bState {
+	s := &blake2bState{h: blake2bIV, size: size}
+	s.h[0] ^= 0x01010000 ^ uint64(size)
+	return s
+}
+
+// compress processes the buffered block; final marks the last block
+func (s *blake2bState) compress(final bool) {
+	var m, v [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(s.buffer[8*i:])
+	}
+	copy(v[:8], s.h[:])
+	copy(v[8:], blake2bIV[:])
+	v[12] ^= s.t
+	if final {
+		v[14] = ^v[14]
+	}
+
+	g := func(a, b, c, d int, x, y uint64) {
+		v[a] += v[b] + x
+		v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+		v[a] += v[b] + y
+		v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+	}
+	for _, sigma := range blake2bSigma {
+		g(0, 4, 8, 12, m[sigma[0]], m[sigma[1]])
+		g(1, 5, 9, 13, m[sigma[2]], m[sigma[3]])
+		g(2, 6, 10, 14, m[sigma[4]], m[sigma[5]])
+		g(3, 7, 11, 15, m[sigma[6]], m[sigma[7]])
+		g(0, 5, 10, 15, m[sigma[8]], m[sigma[9]])
+		g(1, 6, 11, 12, m[sigma[10]], m[sigma[11]])
+		g(2, 7, 8, 13, m[sigma[12]], m[sigma[13]])
+		g(3, 4, 9, 14, m[sigma[14]], m[sigma[15]])
+	}
+
+	for i := range s.h {
+		s.h[i] ^= v[i] ^ v[i+8]
+	}
+}
+
+// Write absorbs p. The last block is kept buffered until Sum, since BLAKE2b
+// flags the final block.
+func (s *blake2bState) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if s.offset == blake2bBlockSize {
+			s.t += blake2bBlockSize
+			s.compress(false)
+			s.offset = 0
+		}
+		n := copy(s.buffer[s.offset:], p)
+		s.offset += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Sum writes the digest into out, which must hold size bytes, and clears the
+// state
+func (s *blake2bState) Sum(out []byte) {
+	s.t += uint64(s.offset)
+	for i := s.offset; i < blake2bBlockSize; i++ {
+		s.buffer[i] = 0
+	}
+	s.compress(true)
+
+	var digest [64]byte
+	for i, word := range s.h {
+		binary.LittleEndian.PutUint64(digest[8*i:], word)
+	}
+	copy(out, digest[:s.size])
+
+	SecureZero(digest[:])
+	SecureZero(s.buffer[:])
+	s.h = [8]uint64{}
+}
+
+// blake2bSum fills out, 1 to 64 bytes, with BLAKE2b of the concatenated inputs
+func blake2bSum(out []byte, inputs ...[]byte) {
+	s := newBlake2b(len(out))
+	for _, input := range inputs {
+		s.Write(input)
+	}
+	s.Sum(out)
+}
@@ -0,0 +1,364 @@
+// Package chainapi hashes, encrypts and signs TOPAY chain objects the one
+// way every client must agree on. Each helper fixes the domain tag and the
+// canonical encoding of its object, so block hashes, transaction IDs, memo
+// ciphertexts and vote signatures computed by different clients match
+// without each of them composing the low-level primitives on its own:
+//
+//   - HashBlockHeader and HashTxPayload hash a BlockHeader or TxPayload
+//   - EncryptMemo and DecryptMemo seal a transaction memo to a recipient's
+//     KEM key, padded so ciphertexts reveal only the memo's rough length
+//   - SignVote and VerifyVote sign and check a consensus Vote
+//
+// Canonical encodings write fields in declaration order, integers as
+// big-endian, fixed-size hashes as their bytes, and variable-length fields
+// with a big-endian uint32 length prefix. MarshalBinary produces them and
+// UnmarshalBinary accepts only them, so an object has exactly one encoding
+// and one hash. Domain tags end in a version, which changes with the
+// encoding.
+package chainapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/address"
+)
+
+// Domain tags
+const (
+	blockHeaderDomain = "TOPAY-Z512-CHAIN-BLOCK-HEADER-V1"
+	txPayloadDomain   = "TOPAY-Z512-CHAIN-TX-PAYLOAD-V1"
+	memoDomain        = "TOPAY-Z512-CHAIN-MEMO-V1"
+	voteDomain        = "TOPAY-Z512-CHAIN-VOTE-V1"
+)
+
+// Field limits
+const (
+	// MaxChainIDSize is the longest chain ID in bytes
+	MaxChainIDSize = 64
+
+	// MaxMemoSize is the longest memo plaintext in bytes
+	MaxMemoSize = 1024
+
+	// MaxTxDataSize is the most call data a transaction carries
+	MaxTxDataSize = 64 << 10
+
+	// memoBlockSize is the granularity memos are padded to
+	memoBlockSize = 64
+)
+
+var (
+	// ErrInvalidEncoding indicates bytes that aren't a canonical encoding
+	ErrInvalidEncoding = errors.New("chainapi: invalid encoding")
+
+	// ErrFieldTooLarge indicates a field beyond its limit
+	ErrFieldTooLarge = errors.New("chainapi: field too large")
+
+	// ErrInvalidVote indicates a vote of unknown type
+	ErrInvalidVote = errors.New("chainapi: invalid vote")
+)
+
+// AddressHash is the public key hash held by an address
+type AddressHash [address.HashSize]byte
+
+// BlockHeader is the header of a block
+type BlockHeader struct {
+	Version uint32
+	ChainID string
+	Height  uint64
+	// Time is the block time in Unix milliseconds
+	Time         int64
+	PreviousHash topayz512.Hash
+	// TxRoot is the Merkle root of the block's transaction hashes
+	TxRoot    topayz512.Hash
+	StateRoot topayz512.Hash
+	Proposer  AddressHash
+}
+
+// MarshalBinary returns the canonical encoding of the header
+func (h *BlockHeader) MarshalBinary() ([]byte, error) {
+	if len(h.ChainID) > MaxChainIDSize {
+		return nil, fmt.Errorf("%w: chain ID is %d bytes", ErrFieldTooLarge, len(h.ChainID))
+	}
+	var e encoder
+	e.uint32(h.Version)
+	e.bytes([]byte(h.ChainID))
+	e.uint64(h.Height)
+	e.uint64(uint64(h.Time))
+	e.fixed(h.PreviousHash[:])
+	e.fixed(h.TxRoot[:])
+	e.fixed(h.StateRoot[:])
+	e.fixed(h.Proposer[:])
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a canonical encoding
+func (h *BlockHeader) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	var decoded BlockHeader
+	decoded.Version = d.uint32()
+	decoded.ChainID = string(d.bytes(MaxChainIDSize))
+	decoded.Height = d.uint64()
+	decoded.Time = int64(d.uint64())
+	d.fixed(decoded.PreviousHash[:])
+	d.fixed(decoded.TxRoot[:])
+	d.fixed(decoded.StateRoot[:])
+	d.fixed(decoded.Proposer[:])
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*h = decoded
+	return nil
+}
+
+// HashBlockHeader returns the block hash: the domain-separated hash of the
+// header's canonical encoding. It returns ErrFieldTooLarge for a chain ID
+// beyond MaxChainIDSize.
+func HashBlockHeader(h *BlockHeader) (topayz512.Hash, error) {
+	encoded, err := h.MarshalBinary()
+	if err != nil {
+		return topayz512.Hash{}, err
+	}
+	return topayz512.HashWithDomain(blockHeaderDomain, encoded), nil
+}
+
+// TxPayload is the signed content of a transaction
+type TxPayload struct {
+	ChainID string
+	// Nonce orders the sender's transactions and prevents replays
+	Nonce  uint64
+	From   AddressHash
+	To     AddressHash
+	Amount uint64
+	Fee    uint64
+	// Memo is an EncryptMemo ciphertext, or empty
+	Memo []byte
+	// Data is contract call data, or empty
+	Data []byte
+}
+
+// MarshalBinary returns the canonical encoding of the payload
+func (tx *TxPayload) MarshalBinary() ([]byte, error) {
+	switch {
+	case len(tx.ChainID) > MaxChainIDSize:
+		return nil, fmt.Errorf("%w: chain ID is %d bytes", ErrFieldTooLarge, len(tx.ChainID))
+	case len(tx.Memo) > MaxMemoCiphertextSize:
+		return nil, fmt.Errorf("%w: memo is %d bytes", ErrFieldTooLarge, len(tx.Memo))
+	case len(tx.Data) > MaxTxDataSize:
+		return nil, fmt.Errorf("%w: data is %d bytes", ErrFieldTooLarge, len(tx.Data))
+	}
+	var e encoder
+	e.bytes([]byte(tx.ChainID))
+	e.uint64(tx.Nonce)
+	e.fixed(tx.From[:])
+	e.fixed(tx.To[:])
+	e.uint64(tx.Amount)
+	e.uint64(tx.Fee)
+	e.bytes(tx.Memo)
+	e.bytes(tx.Data)
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a canonical encoding
+func (tx *TxPayload) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	var decoded TxPayload
+	decoded.ChainID = string(d.bytes(MaxChainIDSize))
+	decoded.Nonce = d.uint64()
+	d.fixed(decoded.From[:])
+	d.fixed(decoded.To[:])
+	decoded.Amount = d.uint64()
+	decoded.Fee = d.uint64()
+	decoded.Memo = d.bytes(MaxMemoCiphertextSize)
+	decoded.Data = d.bytes(MaxTxDataSize)
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*tx = decoded
+	return nil
+}
+
+// HashTxPayload returns the transaction ID: the domain-separated hash of
+// the payload's canonical encoding. It returns ErrFieldTooLarge for a field
+// beyond its limit.
+func HashTxPayload(tx *TxPayload) (topayz512.Hash, error) {
+	encoded, err := tx.MarshalBinary()
+	if err != nil {
+		return topayz512.Hash{}, err
+	}
+	return topayz512.HashWithDomain(txPayloadDomain, encoded), nil
+}
+
+// VoteType is the consensus step a vote is cast in
+type VoteType uint8
+
+// Vote types
+const (
+	Prevote   VoteType = 1
+	Precommit VoteType = 2
+)
+
+// String returns the name of the vote type
+func (t VoteType) String() string {
+	switch t {
+	case Prevote:
+		return "prevote"
+	case Precommit:
+		return "precommit"
+	default:
+		return fmt.Sprintf("VoteType(%d)", uint8(t))
+	}
+}
+
+// Vote is a validator's consensus vote for a block
+type Vote struct {
+	Type    VoteType
+	ChainID string
+	Height  uint64
+	Round   uint32
+	// BlockHash is the HashBlockHeader of the block voted for; zero votes
+	// for no block
+	BlockHash topayz512.Hash
+}
+
+// MarshalBinary returns the canonical encoding of the vote
+func (v *Vote) MarshalBinary() ([]byte, error) {
+	if v.Type != Prevote && v.Type != Precommit {
+		return nil, ErrInvalidVote
+	}
+	if len(v.ChainID) > MaxChainIDSize {
+		return nil, fmt.Errorf("%w: chain ID is %d bytes", ErrFieldTooLarge, len(v.ChainID))
+	}
+	var e encoder
+	e.buf = append(e.buf, byte(v.Type))
+	e.bytes([]byte(v.ChainID))
+	e.uint64(v.Height)
+	e.uint32(v.Round)
+	e.fixed(v.BlockHash[:])
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a canonical encoding
+func (v *Vote) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	var decoded Vote
+	var voteType [1]byte
+	d.fixed(voteType[:])
+	decoded.Type = VoteType(voteType[0])
+	decoded.ChainID = string(d.bytes(MaxChainIDSize))
+	decoded.Height = d.uint64()
+	decoded.Round = d.uint32()
+	d.fixed(decoded.BlockHash[:])
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if decoded.Type != Prevote && decoded.Type != Precommit {
+		return ErrInvalidVote
+	}
+	*v = decoded
+	return nil
+}
+
+// voteDigest returns the domain-separated hash of a vote's encoding, which
+// is what gets signed
+func voteDigest(v *Vote) (topayz512.Hash, error) {
+	encoded, err := v.MarshalBinary()
+	if err != nil {
+		return topayz512.Hash{}, err
+	}
+	return topayz512.HashWithDomain(voteDomain, encoded), nil
+}
+
+// SignVote signs a vote. It returns ErrInvalidVote for a vote of unknown
+// type, so a signature always names the step it was cast in.
+func SignVote(key topayz512.PrivateKey, v *Vote) (topayz512.Signature, error) {
+	digest, err := voteDigest(v)
+	if err != nil {
+		return topayz512.Signature{}, err
+	}
+	return topayz512.Sign(key, digest[:])
+}
+
+// VerifyVote reports whether signature is publicKey's signature of the vote
+func VerifyVote(publicKey topayz512.PublicKey, v *Vote, signature topayz512.Signature) bool {
+	digest, err := voteDigest(v)
+	if err != nil {
+		return false
+	}
+	return topayz512.Verify(publicKey, digest[:], signature)
+}
+
+// encoder builds a canonical encoding
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint32(v uint32) { e.buf = binary.BigEndian.AppendUint32(e.buf, v) }
+func (e *encoder) uint64(v uint64) { e.buf = binary.BigEndian.AppendUint64(e.buf, v) }
+func (e *encoder) fixed(b []byte)  { e.buf = append(e.buf, b...) }
+
+// bytes appends a length-prefixed byte string
+func (e *encoder) bytes(b []byte) {
+	e.uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// decoder reads a canonical encoding, remembering the first failure so
+// fields can be read without checking each one
+type decoder struct {
+	data   []byte
+	failed bool
+}
+
+// take returns the next n bytes
+func (d *decoder) take(n int) []byte {
+	if d.failed || n > len(d.data) {
+		d.failed = true
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) fixed(dst []byte) {
+	copy(dst, d.take(len(dst)))
+}
+
+// bytes reads a length-prefixed byte string of at most limit bytes. Empty
+// strings decode as nil, so decoding and encoding again is stable.
+func (d *decoder) bytes(limit int) []byte {
+	n := d.uint32()
+	if uint64(n) > uint64(limit) {
+		d.failed = true
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	return append([]byte(nil), d.take(int(n))...)
+}
+
+// finish reports a short or overlong encoding
+func (d *decoder) finish() error {
+	if d.failed || len(d.data) != 0 {
+		return ErrInvalidEncoding
+	}
+	return nil
+}
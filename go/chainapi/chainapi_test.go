@@ -0,0 +1,206 @@
+package chainapi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Test the canonical block header layout and hash
+func TestBlockHeader(t *testing.T) {
+	header := &BlockHeader{Version: 1, ChainID: "topay-1", Height: 7, Time: -1}
+	header.PreviousHash[0] = 0xaa
+	header.Proposer[31] = 0xbb
+
+	encoded, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	prefix := "00000001" + "00000007" + hex.EncodeToString([]byte("topay-1")) + "0000000000000007" + "ffffffffffffffff" + "aa"
+	if !strings.HasPrefix(hex.EncodeToString(encoded), prefix) {
+		t.Errorf("Encoding starts %x, want %s", encoded[:len(prefix)/2], prefix)
+	}
+	if want := 4 + 4 + 7 + 8 + 8 + 3*topayz512.HashSize + 32; len(encoded) != want || encoded[len(encoded)-1] != 0xbb {
+		t.Errorf("Encoding is %d bytes, want %d ending in the proposer", len(encoded), want)
+	}
+
+	var decoded BlockHeader
+	if err := decoded.UnmarshalBinary(encoded); err != nil || decoded != *header {
+		t.Fatalf("UnmarshalBinary = %+v, %v", decoded, err)
+	}
+
+	hash, err := HashBlockHeader(header)
+	if err != nil || hash != topayz512.HashWithDomain(blockHeaderDomain, encoded) {
+		t.Errorf("HashBlockHeader isn't the domain hash of the encoding: %v", err)
+	}
+	header.Height++
+	if other, _ := HashBlockHeader(header); other == hash {
+		t.Error("Hash doesn't cover the height")
+	}
+
+	header.ChainID = strings.Repeat("x", MaxChainIDSize+1)
+	if _, err := HashBlockHeader(header); !errors.Is(err, ErrFieldTooLarge) {
+		t.Errorf("Long chain ID: got %v, want ErrFieldTooLarge", err)
+	}
+}
+
+// Test that decoding accepts only canonical encodings
+func TestStrictDecoding(t *testing.T) {
+	tx := &TxPayload{ChainID: "topay-1", Nonce: 3, Amount: 100, Fee: 1, Data: []byte("call")}
+	encoded, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var decoded TxPayload
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if again, _ := decoded.MarshalBinary(); !bytes.Equal(again, encoded) {
+		t.Error("Decoding and encoding again changed the bytes")
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"truncated": encoded[:len(encoded)-1],
+		"trailing":  append(append([]byte(nil), encoded...), 0),
+		"oversized": append([]byte{0xff, 0xff, 0xff, 0xff}, encoded[4:]...),
+	} {
+		if err := decoded.UnmarshalBinary(data); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("%s: got %v, want ErrInvalidEncoding", name, err)
+		}
+	}
+
+	hash, err := HashTxPayload(tx)
+	if err != nil || hash != topayz512.HashWithDomain(txPayloadDomain, encoded) {
+		t.Errorf("HashTxPayload isn't the domain hash of the encoding: %v", err)
+	}
+	header := &BlockHeader{}
+	if headerHash, _ := HashBlockHeader(header); headerHash == topayz512.HashWithDomain(txPayloadDomain, mustMarshal(t, header)) {
+		t.Error("Block and transaction hashes share a domain")
+	}
+
+	tx.Data = make([]byte, MaxTxDataSize+1)
+	if _, err := HashTxPayload(tx); !errors.Is(err, ErrFieldTooLarge) {
+		t.Errorf("Long data: got %v, want ErrFieldTooLarge", err)
+	}
+}
+
+func mustMarshal(t *testing.T, h *BlockHeader) []byte {
+	encoded, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+// Test memo encryption, padding and binding to the memo domain
+func TestMemo(t *testing.T) {
+	publicKey, secretKey, err := topayz512.KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen failed: %v", err)
+	}
+
+	for _, memo := range [][]byte{{}, []byte("invoice 42"), bytes.Repeat([]byte{0}, 62), make([]byte, MaxMemoSize)} {
+		box, err := EncryptMemo(publicKey, memo)
+		if err != nil {
+			t.Fatalf("EncryptMemo failed: %v", err)
+		}
+		if want := topayz512.CiphertextSize + topayz512.AEADOverhead + paddedMemoSize(len(memo)); len(box) != want {
+			t.Errorf("%d-byte memo: box is %d bytes, want %d", len(memo), len(box), want)
+		}
+		opened, err := DecryptMemo(secretKey, box)
+		if err != nil || !bytes.Equal(opened, memo) {
+			t.Errorf("%d-byte memo doesn't round-trip: %v", len(memo), err)
+		}
+	}
+
+	short, _ := EncryptMemo(publicKey, []byte("a"))
+	long, _ := EncryptMemo(publicKey, bytes.Repeat([]byte("a"), 62))
+	if len(short) != len(long) {
+		t.Error("Memos in the same block have different sizes")
+	}
+	if len(long) > MaxMemoCiphertextSize {
+		t.Error("Box exceeds MaxMemoCiphertextSize")
+	}
+
+	if _, err := EncryptMemo(publicKey, make([]byte, MaxMemoSize+1)); !errors.Is(err, ErrFieldTooLarge) {
+		t.Errorf("Long memo: got %v, want ErrFieldTooLarge", err)
+	}
+
+	// A plain sealed box to the same key isn't a memo
+	box, _ := topayz512.Encrypt(publicKey, make([]byte, memoBlockSize))
+	if _, err := DecryptMemo(secretKey, box); err == nil {
+		t.Error("DecryptMemo opened a sealed box")
+	}
+	tampered := append([]byte(nil), short...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := DecryptMemo(secretKey, tampered); !errors.Is(err, topayz512.ErrAuthenticationFailed) {
+		t.Errorf("Tampered memo: got %v, want ErrAuthenticationFailed", err)
+	}
+
+	for _, padded := range [][]byte{
+		{0, 1, 'a'}, // not a whole block
+		append([]byte{0, 1, 'a', 1}, make([]byte, 60)...), // nonzero padding
+		append([]byte{0, 70}, make([]byte, 62)...),        // length beyond the block
+	} {
+		if _, err := unpadMemo(padded); !errors.Is(err, ErrInvalidMemo) {
+			t.Errorf("unpadMemo(%x) = %v, want ErrInvalidMemo", padded[:4], err)
+		}
+	}
+}
+
+// Test vote signing and that signatures cover every field
+func TestVote(t *testing.T) {
+	privateKey, publicKey, err := topayz512.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	vote := &Vote{Type: Precommit, ChainID: "topay-1", Height: 10, Round: 2}
+	vote.BlockHash[0] = 1
+
+	signature, err := SignVote(privateKey, vote)
+	if err != nil {
+		t.Fatalf("SignVote failed: %v", err)
+	}
+	if !VerifyVote(publicKey, vote, signature) {
+		t.Fatal("Vote signature doesn't verify")
+	}
+
+	encoded, _ := vote.MarshalBinary()
+	var decoded Vote
+	if err := decoded.UnmarshalBinary(encoded); err != nil || decoded != *vote {
+		t.Errorf("UnmarshalBinary = %+v, %v", decoded, err)
+	}
+
+	for name, change := range map[string]func(*Vote){
+		"type":   func(v *Vote) { v.Type = Prevote },
+		"chain":  func(v *Vote) { v.ChainID = "topay-2" },
+		"height": func(v *Vote) { v.Height++ },
+		"round":  func(v *Vote) { v.Round++ },
+		"block":  func(v *Vote) { v.BlockHash = topayz512.Hash{} },
+	} {
+		changed := *vote
+		change(&changed)
+		if VerifyVote(publicKey, &changed, signature) {
+			t.Errorf("Signature verifies with a different %s", name)
+		}
+	}
+
+	// The signature is over the vote domain, not the raw encoding
+	plain, _ := topayz512.Sign(privateKey, encoded)
+	if VerifyVote(publicKey, vote, plain) {
+		t.Error("A signature of the raw encoding verifies as a vote")
+	}
+
+	if _, err := SignVote(privateKey, &Vote{Type: 3}); !errors.Is(err, ErrInvalidVote) {
+		t.Errorf("Unknown vote type: got %v, want ErrInvalidVote", err)
+	}
+	encoded[0] = 0
+	if err := decoded.UnmarshalBinary(encoded); !errors.Is(err, ErrInvalidVote) {
+		t.Errorf("Decoding an unknown vote type: got %v, want ErrInvalidVote", err)
+	}
+}
@@ -0,0 +1,114 @@
+package chainapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Memos
+//
+// A memo is sealed like a topayz512.Encrypt box, but the shared secret is
+// bound to the memo domain with KEMWithContext and the domain is the AEAD's
+// additional data, so a memo can't be opened as any other box. Before
+// sealing, the memo is prefixed with its big-endian uint16 length and
+// zero-padded to a multiple of 64 bytes.
+
+// maxPaddedMemoSize is the padded size of the longest memo
+const maxPaddedMemoSize = (2 + MaxMemoSize + memoBlockSize - 1) / memoBlockSize * memoBlockSize
+
+// MaxMemoCiphertextSize is the size of the longest EncryptMemo ciphertext
+const MaxMemoCiphertextSize = topayz512.CiphertextSize + topayz512.AEADOverhead + maxPaddedMemoSize
+
+// ErrInvalidMemo indicates a memo that decrypts but isn't padded canonically
+var ErrInvalidMemo = errors.New("chainapi: invalid memo")
+
+// EncryptMemo seals a memo so only the holder of the secret key matching
+// recipient can read it. It returns ErrFieldTooLarge for a memo longer than
+// MaxMemoSize.
+func EncryptMemo(recipient topayz512.KEMPublicKey, memo []byte) ([]byte, error) {
+	if len(memo) > MaxMemoSize {
+		return nil, fmt.Errorf("%w: memo is %d bytes", ErrFieldTooLarge, len(memo))
+	}
+	ciphertext, sharedSecret, err := topayz512.KEMWithContext(recipient, []byte(memoDomain))
+	if err != nil {
+		return nil, err
+	}
+	defer topayz512.SecureEraseSharedSecret(&sharedSecret)
+
+	aead, err := sharedSecret.NewAEAD(topayz512.AEADInitiator, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer aead.Wipe()
+	padded := padMemo(memo)
+	defer clear(padded)
+	sealed, err := aead.Seal(padded, []byte(memoDomain))
+	if err != nil {
+		return nil, err
+	}
+
+	box := make([]byte, 0, topayz512.CiphertextSize+len(sealed))
+	box = append(box, ciphertext[:]...)
+	return append(box, sealed...), nil
+}
+
+// DecryptMemo opens a memo sealed by EncryptMemo. It returns
+// topayz512.ErrAuthenticationFailed for a memo sealed to another key,
+// truncated or modified.
+func DecryptMemo(secretKey topayz512.KEMSecretKey, box []byte) ([]byte, error) {
+	if len(box) < topayz512.CiphertextSize+topayz512.AEADOverhead || len(box) > MaxMemoCiphertextSize {
+		return nil, topayz512.ErrAuthenticationFailed
+	}
+	var ciphertext topayz512.Ciphertext
+	copy(ciphertext[:], box)
+	sharedSecret, err := topayz512.KEMDecapsulateWithContext(secretKey, ciphertext, []byte(memoDomain))
+	if err != nil {
+		return nil, err
+	}
+	defer topayz512.SecureEraseSharedSecret(&sharedSecret)
+
+	aead, err := sharedSecret.NewAEAD(topayz512.AEADResponder, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer aead.Wipe()
+	padded, err := aead.Open(box[topayz512.CiphertextSize:], []byte(memoDomain))
+	if err != nil {
+		return nil, err
+	}
+	defer clear(padded)
+	return unpadMemo(padded)
+}
+
+// padMemo prefixes memo with its length and pads it to the block size
+func padMemo(memo []byte) []byte {
+	padded := make([]byte, paddedMemoSize(len(memo)))
+	binary.BigEndian.PutUint16(padded, uint16(len(memo)))
+	copy(padded[2:], memo)
+	return padded
+}
+
+// unpadMemo reverses padMemo, accepting only the padding it produces
+func unpadMemo(padded []byte) ([]byte, error) {
+	if len(padded) < 2 {
+		return nil, ErrInvalidMemo
+	}
+	n := int(binary.BigEndian.Uint16(padded))
+	if n > MaxMemoSize || len(padded) != paddedMemoSize(n) {
+		return nil, ErrInvalidMemo
+	}
+	for _, b := range padded[2+n:] {
+		if b != 0 {
+			return nil, ErrInvalidMemo
+		}
+	}
+	return append([]byte(nil), padded[2:2+n]...), nil
+}
+
+// paddedMemoSize returns the padded size of an n-byte memo
+func paddedMemoSize(n int) int {
+	return (2 + n + memoBlockSize - 1) / memoBlockSize * memoBlockSize
+}
@@ -0,0 +1,137 @@
+package topayz512
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Checksum files in the format of sha256sum, using Z512
+
+// ChecksumFileName is the conventional name of a published checksum file
+const ChecksumFileName = "Z512SUMS"
+
+// ChecksumEntry is one line of a checksum file
+type ChecksumEntry struct {
+	Hash Hash
+	Path string
+	// Binary marks the entry with '*' as sha256sum does for binary mode;
+	// files are hashed identically either way
+	Binary bool
+}
+
+// ChecksumResult is the verification outcome of one entry; Err is nil if the
+// file matched
+type ChecksumResult struct {
+	Path string
+	Err  error
+}
+
+// ChecksumFileEntry hashes the file at root/path and returns its entry
+func ChecksumFileEntry(root, path string) (ChecksumEntry, error) {
+	hash, _, err := HashFile(checksumPath(root, path))
+	if err != nil {
+		return ChecksumEntry{}, err
+	}
+	return ChecksumEntry{Hash: hash, Path: filepath.ToSlash(path)}, nil
+}
+
+// WriteChecksumFile writes entries as "<hex hash>  <path>" lines. Like
+// sha256sum, a path containing a backslash or newline is escaped and its line
+// prefixed with a backslash.
+func WriteChecksumFile(w io.Writer, entries []ChecksumEntry) error {
+	bw := bufio.NewWriter(w)
+	for _, entry := range entries {
+		path := entry.Path
+		if strings.ContainsAny(path, "\\\n") {
+			bw.WriteByte('\\')
+			path = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(path)
+		}
+
+		mode := byte(' ')
+		if entry.Binary {
+			mode = '*'
+		}
+		fmt.Fprintf(bw, "%s %c%s\n", entry.Hash, mode, path)
+	}
+	return bw.Flush()
+}
+
+// ReadChecksumFile parses a checksum file written by WriteChecksumFile or a
+// compatible tool. Blank lines and lines starting with '#' are skipped.
+func ReadChecksumFile(r io.Reader) ([]ChecksumEntry, error) {
+	var entries []ChecksumEntry
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		escaped := line[0] == '\\'
+		if escaped {
+			line = line[1:]
+		}
+
+		hashHex, rest, ok := strings.Cut(line, " ")
+		if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '*') || len(rest) < 2 {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidChecksumFile, lineNumber)
+		}
+		hash, err := HashFromHex(hashHex)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidChecksumFile, lineNumber, err)
+		}
+
+		path := rest[1:]
+		if escaped {
+			path = strings.NewReplacer("\\\\", "\\", "\\n", "\n").Replace(path)
+		}
+		entries = append(entries, ChecksumEntry{Hash: hash, Path: path, Binary: rest[0] == '*'})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// VerifyChecksumFile checks every entry of a checksum file against the files
+// under root, which relative paths are resolved against. It returns a result
+// per entry and ErrChecksumMismatch if any file is missing or differs.
+func VerifyChecksumFile(r io.Reader, root string) ([]ChecksumResult, error) {
+	entries, err := ReadChecksumFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ChecksumResult, len(entries))
+	failed := false
+	for i, entry := range entries {
+		results[i].Path = entry.Path
+
+		hash, _, err := HashFile(checksumPath(root, entry.Path))
+		if err == nil && !HashEqual(hash, entry.Hash) {
+			err = ErrChecksumMismatch
+		}
+		if err != nil {
+			results[i].Err = err
+			failed = true
+		}
+	}
+
+	if failed {
+		return results, ErrChecksumMismatch
+	}
+	return results, nil
+}
+
+// checksumPath resolves a checksum file path against root
+func checksumPath(root, path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(root, path)
+}
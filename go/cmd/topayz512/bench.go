@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// benchCase is one operation of the standardized benchmark suite. setup
+// prepares inputs outside the timed loop and returns the operation
+type benchCase struct {
+	name  string
+	bytes int
+	setup func() (func() error, error)
+}
+
+// hardwareInfo describes the machine a report was produced on
+type hardwareInfo struct {
+	CPUModel    string   `json:"cpu_model"`
+	Cores       int      `json:"cores"`
+	GOMAXPROCS  int      `json:"gomaxprocs"`
+	OS          string   `json:"os"`
+	Arch        string   `json:"arch"`
+	GoVersion   string   `json:"go_version"`
+	SIMD        []string `json:"simd"`
+	HardwareRNG bool     `json:"hardware_rng"`
+	PureGo      bool     `json:"purego"`
+}
+
+// benchResult is the measurement of one benchmark case
+type benchResult struct {
+	Name        string  `json:"name"`
+	Iterations  int     `json:"iterations"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	OpsPerSec   float64 `json:"ops_per_sec"`
+	MBPerSec    float64 `json:"mb_per_sec,omitempty"`
+	BytesPerOp  uint64  `json:"bytes_per_op"`
+	AllocsPerOp uint64  `json:"allocs_per_op"`
+}
+
+// benchReport is the shareable output of bench
+type benchReport struct {
+	Version   string        `json:"version"`
+	Timestamp time.Time     `json:"timestamp"`
+	BenchTime string        `json:"bench_time"`
+	Hardware  hardwareInfo  `json:"hardware"`
+	Results   []benchResult `json:"results"`
+}
+
+// setupBench runs the benchmark suite and prints a markdown or JSON report
+func setupBench(flags *flag.FlagSet) func() error {
+	benchTime := flags.Duration("benchtime", time.Second, "minimum run time of each benchmark")
+	run := flags.String("run", "", "only run benchmarks whose name contains this string")
+	out := flags.String("o", "", "write the report to this file instead of standard output")
+
+	return func() error {
+		if *benchTime <= 0 {
+			return usageError{fmt.Errorf("invalid -benchtime %v", *benchTime)}
+		}
+
+		report := benchReport{
+			Version:   topayz512.Version,
+			Timestamp: time.Now().UTC(),
+			BenchTime: benchTime.String(),
+			Hardware:  detectHardware(),
+			Results:   []benchResult{},
+		}
+		for _, bc := range benchSuite() {
+			if !strings.Contains(bc.name, *run) {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "running %s\n", bc.name)
+			result, err := runBenchCase(bc, *benchTime)
+			if err != nil {
+				return fmt.Errorf("%s: %w", bc.name, err)
+			}
+			report.Results = append(report.Results, result)
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		if jsonOutput {
+			return writeJSON(w, report)
+		}
+		return writeBenchMarkdown(w, report)
+	}
+}
+
+// benchSuite returns the standardized benchmark cases in report order
+func benchSuite() []benchCase {
+	hashCase := func(size int) benchCase {
+		return benchCase{fmt.Sprintf("hash/%s", formatSize(size)), size, func() (func() error, error) {
+			data := make([]byte, size)
+			return func() error {
+				topayz512.ComputeHash(data)
+				return nil
+			}, nil
+		}}
+	}
+
+	return []benchCase{
+		hashCase(64),
+		hashCase(1024),
+		hashCase(64 * 1024),
+		{"hash/batch-100x1KiB", 100 * 1024, func() (func() error, error) {
+			inputs := make([][]byte, 100)
+			for i := range inputs {
+				inputs[i] = make([]byte, 1024)
+			}
+			return func() error {
+				topayz512.BatchHash(inputs)
+				return nil
+			}, nil
+		}},
+		{"keypair/generate", 0, func() (func() error, error) {
+			return func() error {
+				_, _, err := topayz512.GenerateKeyPair()
+				return err
+			}, nil
+		}},
+		{"signature/sign", 0, func() (func() error, error) {
+			privateKey, _, err := topayz512.GenerateKeyPair()
+			if err != nil {
+				return nil, err
+			}
+			message := []byte("benchmark message")
+			return func() error {
+				_, err := topayz512.Sign(privateKey, message)
+				return err
+			}, nil
+		}},
+		{"signature/verify", 0, func() (func() error, error) {
+			privateKey, publicKey, err := topayz512.GenerateKeyPair()
+			if err != nil {
+				return nil, err
+			}
+			message := []byte("benchmark message")
+			signature, err := topayz512.Sign(privateKey, message)
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				if !topayz512.Verify(publicKey, message, signature) {
+					return topayz512.ErrInvalidSignature
+				}
+				return nil
+			}, nil
+		}},
+		{"kem/keygen", 0, func() (func() error, error) {
+			return func() error {
+				_, _, err := topayz512.KEMKeyGen()
+				return err
+			}, nil
+		}},
+		{"kem/encapsulate", 0, func() (func() error, error) {
+			publicKey, _, err := topayz512.KEMKeyGen()
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				_, _, err := topayz512.KEMEncapsulate(publicKey)
+				return err
+			}, nil
+		}},
+		{"kem/decapsulate", 0, func() (func() error, error) {
+			publicKey, secretKey, err := topayz512.KEMKeyGen()
+			if err != nil {
+				return nil, err
+			}
+			ciphertext, _, err := topayz512.KEMEncapsulate(publicKey)
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				_, err := topayz512.KEMDecapsulate(secretKey, ciphertext)
+				return err
+			}, nil
+		}},
+		{"fragment/1MiB", 1 << 20, func() (func() error, error) {
+			data := make([]byte, 1<<20)
+			return func() error {
+				_, err := topayz512.FragmentData(data)
+				return err
+			}, nil
+		}},
+		{"reconstruct/1MiB", 1 << 20, func() (func() error, error) {
+			result, err := topayz512.FragmentData(make([]byte, 1<<20))
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				_, err := topayz512.ReconstructData(result.Fragments)
+				return err
+			}, nil
+		}},
+	}
+}
+
+// runBenchCase repeats a case, doubling the iteration count until a round
+// takes at least benchTime, and measures the final round
+func runBenchCase(bc benchCase, benchTime time.Duration) (benchResult, error) {
+	op, err := bc.setup()
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	iterations := 1
+	for {
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		for i := 0; i < iterations; i++ {
+			if err := op(); err != nil {
+				return benchResult{}, err
+			}
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if elapsed >= benchTime {
+			n := uint64(iterations)
+			result := benchResult{
+				Name:        bc.name,
+				Iterations:  iterations,
+				NsPerOp:     float64(elapsed.Nanoseconds()) / float64(iterations),
+				OpsPerSec:   float64(iterations) / elapsed.Seconds(),
+				BytesPerOp:  (after.TotalAlloc - before.TotalAlloc) / n,
+				AllocsPerOp: (after.Mallocs - before.Mallocs) / n,
+			}
+			if bc.bytes > 0 {
+				result.MBPerSec = float64(bc.bytes) * result.OpsPerSec / 1e6
+			}
+			return result, nil
+		}
+		iterations *= 2
+	}
+}
+
+// detectHardware collects the machine description for a report
+func detectHardware() hardwareInfo {
+	return hardwareInfo{
+		CPUModel:    cpuModel(),
+		Cores:       runtime.NumCPU(),
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		GoVersion:   runtime.Version(),
+		SIMD:        topayz512.DetectSIMDCapabilities().Features(),
+		HardwareRNG: topayz512.HasHardwareRNG(),
+		PureGo:      topayz512.PureGo,
+	}
+}
+
+// cpuModel returns the processor name, or "unknown" if the platform doesn't expose it
+func cpuModel() string {
+	switch runtime.GOOS {
+	case "linux":
+		file, err := os.Open("/proc/cpuinfo")
+		if err != nil {
+			break
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if !ok {
+				continue
+			}
+			switch strings.TrimSpace(key) {
+			case "model name", "Model", "cpu model":
+				return strings.TrimSpace(value)
+			}
+		}
+	case "darwin":
+		if model, err := exec.Command("sysctl", "-n", "machdep.cpu.brand_string").Output(); err == nil {
+			return strings.TrimSpace(string(model))
+		}
+	}
+	return "unknown"
+}
+
+// writeBenchMarkdown writes a report as a markdown document
+func writeBenchMarkdown(w io.Writer, report benchReport) error {
+	hw := report.Hardware
+	var b strings.Builder
+	fmt.Fprintf(&b, "# TOPAY-Z512 benchmark report\n\n")
+	fmt.Fprintf(&b, "- Library version: %s\n", report.Version)
+	fmt.Fprintf(&b, "- Date: %s\n", report.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- CPU: %s (%d cores, GOMAXPROCS %d)\n", hw.CPUModel, hw.Cores, hw.GOMAXPROCS)
+	fmt.Fprintf(&b, "- Platform: %s/%s, %s\n", hw.OS, hw.Arch, hw.GoVersion)
+	fmt.Fprintf(&b, "- SIMD: %s\n", strings.Join(hw.SIMD, ", "))
+	fmt.Fprintf(&b, "- Hardware RNG: %v\n", hw.HardwareRNG)
+	fmt.Fprintf(&b, "- Pure Go build: %v\n", hw.PureGo)
+	fmt.Fprintf(&b, "- Minimum run time per benchmark: %s\n\n", report.BenchTime)
+
+	fmt.Fprintf(&b, "| Benchmark | Iterations | ns/op | ops/s | MB/s | B/op | allocs/op |\n")
+	fmt.Fprintf(&b, "|---|---:|---:|---:|---:|---:|---:|\n")
+	for _, r := range report.Results {
+		throughput := "-"
+		if r.MBPerSec > 0 {
+			throughput = fmt.Sprintf("%.2f", r.MBPerSec)
+		}
+		fmt.Fprintf(&b, "| %s | %d | %.0f | %.2f | %s | %d | %d |\n",
+			r.Name, r.Iterations, r.NsPerOp, r.OpsPerSec, throughput, r.BytesPerOp, r.AllocsPerOp)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatSize renders a byte count with a binary unit
+func formatSize(size int) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", size>>10)
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// commandFlag describes a flag for completion scripts
+type commandFlag struct {
+	name     string
+	usage    string
+	hasValue bool
+}
+
+// setupCompletion prints a completion script for the named shell
+func setupCompletion(flags *flag.FlagSet) func() error {
+	return func() error {
+		if flags.NArg() != 1 {
+			return usageError{errors.New("expected one shell: bash, zsh or fish")}
+		}
+
+		switch shell := flags.Arg(0); shell {
+		case "bash":
+			writeBashCompletion(os.Stdout)
+		case "zsh":
+			writeZshCompletion(os.Stdout)
+		case "fish":
+			writeFishCompletion(os.Stdout)
+		default:
+			return usageError{fmt.Errorf("unsupported shell %q", shell)}
+		}
+		return nil
+	}
+}
+
+// commandFlags lists the flags a command registers, in name order
+func commandFlags(cmd command) []commandFlag {
+	flags := newFlagSet(cmd)
+	cmd.setup(flags)
+
+	var result []commandFlag
+	flags.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		result = append(result, commandFlag{
+			name:     f.Name,
+			usage:    f.Usage,
+			hasValue: !ok || !boolFlag.IsBoolFlag(),
+		})
+	})
+	return result
+}
+
+// commandNames lists all subcommand names
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+// writeBashCompletion writes a bash completion script
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# bash completion for topayz512")
+	fmt.Fprintln(w, "_topayz512() {")
+	fmt.Fprintln(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} flags")
+	fmt.Fprintln(w, "\tif [ \"$COMP_CWORD\" -eq 1 ]; then")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcase ${COMP_WORDS[1]} in")
+	for _, cmd := range commands {
+		var names []string
+		for _, f := range commandFlags(cmd) {
+			names = append(names, "-"+f.name)
+		}
+		fmt.Fprintf(w, "\t%s) flags=%q ;;\n", cmd.name, strings.Join(names, " "))
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tif [[ $cur == -* ]]; then")
+	fmt.Fprintln(w, "\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))")
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o filenames -F _topayz512 topayz512")
+}
+
+// writeZshCompletion writes a zsh completion script
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintln(w, "#compdef topayz512")
+	fmt.Fprintln(w, "_topayz512() {")
+	fmt.Fprintln(w, "\tlocal -a commands")
+	fmt.Fprintln(w, "\tcommands=(")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t\t%s\n", zshQuote(cmd.name+":"+cmd.summary))
+	}
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, "\tif (( CURRENT == 2 )); then")
+	fmt.Fprintln(w, "\t\t_describe 'command' commands")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tlocal cmd=$words[2]")
+	fmt.Fprintln(w, "\tshift words")
+	fmt.Fprintln(w, "\t(( CURRENT-- ))")
+	fmt.Fprintln(w, "\tcase $cmd in")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\t%s)\n\t\t_arguments", cmd.name)
+		for _, f := range commandFlags(cmd) {
+			spec := "-" + f.name + "[" + zshEscape(f.usage) + "]"
+			if f.hasValue {
+				spec += ":" + f.name + ":_files"
+			}
+			fmt.Fprintf(w, " \\\n\t\t\t%s", zshQuote(spec))
+		}
+		fmt.Fprintln(w, " \\\n\t\t\t'*:file:_files'")
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "compdef _topayz512 topayz512")
+}
+
+// writeFishCompletion writes a fish completion script
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for topayz512")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c topayz512 -f -n __fish_use_subcommand -a %s -d %s\n", cmd.name, fishQuote(cmd.summary))
+	}
+	for _, cmd := range commands {
+		for _, f := range commandFlags(cmd) {
+			line := fmt.Sprintf("complete -c topayz512 -n '__fish_seen_subcommand_from %s' -o %s -d %s", cmd.name, f.name, fishQuote(f.usage))
+			if f.hasValue {
+				line += " -r"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// zshEscape escapes the characters _arguments treats specially in descriptions
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// zshQuote single-quotes s for zsh
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote single-quotes s for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/fixtures"
+)
+
+// setupFixtures generates the JSON test fixture corpus for the other ports.
+// The corpus is JSON either way, so -json changes nothing.
+func setupFixtures(flags *flag.FlagSet) func() error {
+	out := flags.String("o", "", "write the corpus to this file instead of standard output")
+
+	return func() error {
+		corpus, err := fixtures.Generate()
+		if err != nil {
+			return err
+		}
+		data, err := fixtures.Marshal(corpus)
+		if err != nil {
+			return err
+		}
+		if *out != "" {
+			return os.WriteFile(*out, data, 0o644)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/keystore"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/termio"
+)
+
+// keystoreResult is the JSON output of keystore and unlock
+type keystoreResult struct {
+	KeystoreFile string         `json:"keystore_file"`
+	Fingerprint  topayz512.Hash `json:"fingerprint"`
+	PublicKey    string         `json:"public_key"`
+}
+
+// pinentryFlag registers the -pinentry flag shared by the passphrase commands
+func pinentryFlag(flags *flag.FlagSet) *string {
+	return flags.String("pinentry", "", "pinentry program to read the passphrase with instead of the terminal")
+}
+
+// setupKeystore generates a key pair and writes it to a passphrase-protected keystore
+func setupKeystore(flags *flag.FlagSet) func() error {
+	out := flags.String("out", "topayz512.keystore", "keystore file to write")
+	pinentry := pinentryFlag(flags)
+
+	return func() error {
+		if _, err := os.Stat(*out); err == nil {
+			return fmt.Errorf("%s already exists", *out)
+		}
+
+		prompter := termio.NewPrompter(&termio.Options{
+			Pinentry:    *pinentry,
+			Description: "Choose a passphrase for the new keystore " + *out,
+		})
+		passphrase, err := prompter.ReadNewPassphrase("Passphrase: ", "Repeat passphrase: ")
+		if err != nil {
+			return err
+		}
+		defer topayz512.SecureZero(passphrase)
+
+		privateKey, publicKey, err := topayz512.GenerateKeyPair()
+		if err != nil {
+			return err
+		}
+		defer topayz512.SecureErasePrivateKey(&privateKey)
+		if err := keystore.Save(privateKey, passphrase, *out); err != nil {
+			return err
+		}
+		return printKeystore(*out, publicKey, "Wrote")
+	}
+}
+
+// setupUnlock unlocks a keystore with its passphrase and prints its public key
+func setupUnlock(flags *flag.FlagSet) func() error {
+	pinentry := pinentryFlag(flags)
+
+	return func() error {
+		if flags.NArg() != 1 {
+			return usageError{errors.New("expected one keystore file")}
+		}
+		path := flags.Arg(0)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		prompter := termio.NewPrompter(&termio.Options{
+			Pinentry:    *pinentry,
+			Description: "Enter the passphrase for " + path,
+		})
+		var publicKey topayz512.PublicKey
+		err = prompter.Unlock("Passphrase: ", func(passphrase []byte) error {
+			privateKey, err := keystore.Decrypt(data, passphrase)
+			if err != nil {
+				return err
+			}
+			publicKey = topayz512.DerivePublicKey(privateKey)
+			topayz512.SecureErasePrivateKey(&privateKey)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return printKeystore(path, publicKey, "Unlocked")
+	}
+}
+
+// printKeystore reports a keystore's key after verb
+func printKeystore(path string, publicKey topayz512.PublicKey, verb string) error {
+	result := keystoreResult{
+		KeystoreFile: path,
+		Fingerprint:  topayz512.PublicKeyFingerprint(publicKey),
+		PublicKey:    topayz512.FastHexEncode(publicKey[:]),
+	}
+	if jsonOutput {
+		return printJSON(result)
+	}
+	fmt.Printf("%s %s\n", verb, path)
+	fmt.Printf("Fingerprint: %s\n", result.Fingerprint)
+	fmt.Printf("Public key: %s\n", result.PublicKey)
+	return nil
+}
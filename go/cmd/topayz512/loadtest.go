@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/loadtest"
+)
+
+// loadtestReport is the shareable output of loadtest
+type loadtestReport struct {
+	Version   string           `json:"version"`
+	Timestamp time.Time        `json:"timestamp"`
+	Hardware  hardwareInfo     `json:"hardware"`
+	Result    *loadtest.Report `json:"result"`
+}
+
+// setupLoadtest simulates concurrent handshakes and prints a markdown or JSON report
+func setupLoadtest(flags *flag.FlagSet) func() error {
+	sessions := flags.Int("sessions", loadtest.DefaultSessions, "number of handshakes to simulate")
+	concurrency := flags.Int("concurrency", 0, "sessions in flight at once (default all)")
+	messages := flags.Int("messages", loadtest.DefaultMessages, "messages each side sends per session")
+	size := flags.Int("size", loadtest.DefaultMessageSize, "message size in bytes")
+	out := flags.String("o", "", "write the report to this file instead of standard output")
+
+	return func() error {
+		if *sessions <= 0 || *concurrency < 0 || *messages <= 0 || *size <= 0 {
+			return usageError{errors.New("-sessions, -messages and -size must be positive and -concurrency not negative")}
+		}
+
+		// An interrupt stops the run and still reports the finished sessions
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		fmt.Fprintf(os.Stderr, "simulating %d sessions\n", *sessions)
+		result, err := loadtest.Run(ctx, loadtest.Config{
+			Sessions:    *sessions,
+			Concurrency: *concurrency,
+			Messages:    *messages,
+			MessageSize: *size,
+		})
+		if result == nil {
+			return err
+		}
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "interrupted after %d sessions\n", result.Completed)
+		} else if err != nil {
+			return err
+		}
+
+		report := loadtestReport{
+			Version:   topayz512.Version,
+			Timestamp: time.Now().UTC(),
+			Hardware:  detectHardware(),
+			Result:    result,
+		}
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		if jsonOutput {
+			return writeJSON(w, report)
+		}
+		return writeLoadtestMarkdown(w, report)
+	}
+}
+
+// writeLoadtestMarkdown writes a load test report as a markdown document
+func writeLoadtestMarkdown(w io.Writer, report loadtestReport) error {
+	hw := report.Hardware
+	result := report.Result
+	cfg := result.Config
+	var b strings.Builder
+	fmt.Fprintf(&b, "# TOPAY-Z512 load test report\n\n")
+	fmt.Fprintf(&b, "- Library version: %s\n", report.Version)
+	fmt.Fprintf(&b, "- Date: %s\n", report.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- CPU: %s (%d cores, GOMAXPROCS %d)\n", hw.CPUModel, hw.Cores, hw.GOMAXPROCS)
+	fmt.Fprintf(&b, "- Platform: %s/%s, %s\n", hw.OS, hw.Arch, hw.GoVersion)
+	fmt.Fprintf(&b, "- Sessions: %d completed, %d failed of %d, %d concurrent\n", result.Completed, result.Failed, cfg.Sessions, cfg.Concurrency)
+	fmt.Fprintf(&b, "- Traffic per session: %d messages of %s each way\n", cfg.Messages, formatSize(cfg.MessageSize))
+	fmt.Fprintf(&b, "- Elapsed: %s\n", result.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "- Throughput: %.2f handshakes/s, %.2f MB/s of traffic\n\n", result.HandshakesPerSec, result.TrafficMBPerSec)
+
+	fmt.Fprintf(&b, "| Phase | Count | mean | p50 | p90 | p99 | p99.9 | max |\n")
+	fmt.Fprintf(&b, "|---|---:|---:|---:|---:|---:|---:|---:|\n")
+	for _, l := range result.Latencies {
+		fmt.Fprintf(&b, "| %s | %d | %s | %s | %s | %s | %s | %s |\n",
+			l.Phase, l.Count, roundLatency(l.Mean), roundLatency(l.P50), roundLatency(l.P90),
+			roundLatency(l.P99), roundLatency(l.P999), roundLatency(l.Max))
+	}
+
+	mem := result.Memory
+	fmt.Fprintf(&b, "\n| Memory | |\n|---|---:|\n")
+	fmt.Fprintf(&b, "| Peak heap in use | %s |\n", formatBytes(mem.PeakHeapInuse))
+	fmt.Fprintf(&b, "| Peak from OS | %s |\n", formatBytes(mem.PeakSys))
+	fmt.Fprintf(&b, "| Allocated | %s |\n", formatBytes(mem.TotalAlloc))
+	fmt.Fprintf(&b, "| Allocated per session | %s |\n", formatBytes(mem.BytesPerSession))
+	fmt.Fprintf(&b, "| GC cycles | %d |\n", mem.GCCycles)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// roundLatency drops digits below a thousandth of a latency for display
+func roundLatency(d time.Duration) time.Duration {
+	switch {
+	case d >= 100*time.Millisecond:
+		return d.Round(time.Millisecond)
+	case d >= 100*time.Microsecond:
+		return d.Round(time.Microsecond)
+	}
+	return d
+}
+
+// formatBytes renders a memory size in MiB with two decimals
+func formatBytes(n uint64) string {
+	return fmt.Sprintf("%.2f MiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,139 @@
+// Command topayz512 exposes TOPAY-Z512 operations on the command line
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Exit codes shared by all subcommands
+const (
+	// exitOK reports success
+	exitOK = 0
+
+	// exitFailed reports that a signature or checksum did not verify
+	exitFailed = 1
+
+	// exitUsage reports invalid flags or arguments
+	exitUsage = 2
+
+	// exitError reports any other error, such as unreadable files or keys
+	exitError = 3
+)
+
+// command is a topayz512 subcommand. setup registers the command's flags and
+// returns the action to run once they are parsed
+type command struct {
+	name    string
+	summary string
+	setup   func(flags *flag.FlagSet) func() error
+}
+
+// commands lists the subcommands in the order shown by usage
+var commands = []command{
+	{"keygen", "generate a stateful signing key pair", setupKeygen},
+	{"sign", "write a detached .tzsig signature for files", setupSign},
+	{"verify", "verify files against their detached signatures", setupVerify},
+	{"keystore", "create a passphrase-protected keystore holding a new key pair", setupKeystore},
+	{"unlock", "unlock a keystore with its passphrase and print its public key", setupUnlock},
+	{"sum", "print or check Z512SUMS checksums", setupSum},
+	{"bench", "run the benchmark suite and print a hardware report", setupBench},
+	{"loadtest", "simulate concurrent handshakes and report latency and memory", setupLoadtest},
+	{"migrate", "rewrite legacy checksum files and fragments in current formats", setupMigrate},
+	{"fixtures", "generate the JSON test fixture corpus for other implementations", setupFixtures},
+}
+
+func init() {
+	// completion lists commands itself, so it can't appear in their initializer
+	commands = append(commands, command{"completion", "print a bash, zsh or fish completion script", setupCompletion})
+}
+
+// jsonOutput is set by the -json flag every subcommand accepts
+var jsonOutput bool
+
+// usageError is an error caused by invalid arguments
+type usageError struct {
+	error
+}
+
+// failedError reports that verification ran and found failures
+type failedError struct {
+	error
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "topayz512: unknown command %q\n", name)
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	flags := newFlagSet(cmd)
+	action := cmd.setup(flags)
+	flags.Parse(os.Args[2:])
+	if err := action(); err != nil {
+		fmt.Fprintf(os.Stderr, "topayz512 %s: %v\n", name, err)
+		os.Exit(exitCode(err))
+	}
+	os.Exit(exitOK)
+}
+
+// findCommand looks up a subcommand by name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// newFlagSet creates the flag set for cmd with the flags shared by all commands
+func newFlagSet(cmd command) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	flags.BoolVar(&jsonOutput, "json", false, "write machine-readable JSON to standard output")
+	return flags
+}
+
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	var usageErr usageError
+	var failedErr failedError
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &failedErr):
+		return exitFailed
+	default:
+		return exitError
+	}
+}
+
+// usage prints the list of subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: topayz512 <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'topayz512 <command> -h' for command flags.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Exit status is 0 on success, 1 if a signature or checksum fails to")
+	fmt.Fprintln(os.Stderr, "verify, 2 for invalid usage and 3 for any other error.")
+}
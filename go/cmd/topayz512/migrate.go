@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/migrate"
+)
+
+// setupMigrate rewrites legacy checksum files and fragments in the current
+// formats and reports what it found
+func setupMigrate(flags *flag.FlagSet) func() error {
+	dryRun := flags.Bool("n", false, "dry run: report what would change without writing")
+	backup := flags.Bool("backup", false, "keep the original of each rewritten file with a .bak suffix")
+
+	return func() error {
+		if flags.NArg() == 0 {
+			return usageError{errors.New("no files to migrate")}
+		}
+
+		opts := &migrate.Options{DryRun: *dryRun, Backup: *backup}
+		results := make([]migrate.Result, 0, flags.NArg())
+		failed := 0
+		for _, path := range flags.Args() {
+			result := migrate.Migrate(path, opts)
+			results = append(results, result)
+			if result.Status == migrate.StatusFailed {
+				failed++
+			}
+			if !jsonOutput {
+				line := fmt.Sprintf("%s: %s %s", result.Path, result.Kind, result.Status)
+				if result.Detail != "" {
+					line += " (" + result.Detail + ")"
+				}
+				fmt.Println(line)
+			}
+		}
+
+		if jsonOutput {
+			if err := printJSON(results); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return failedError{fmt.Errorf("%d of %d files failed to migrate", failed, len(results))}
+		}
+		return nil
+	}
+}
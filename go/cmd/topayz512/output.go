@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// printJSON writes v to standard output as indented JSON
+func printJSON(v any) error {
+	return writeJSON(os.Stdout, v)
+}
+
+// writeJSON writes v to w as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// fileResult is the JSON form of a per-file verification outcome
+type fileResult struct {
+	Path  string `json:"path"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
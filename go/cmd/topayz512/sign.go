@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// keygenResult is the JSON output of keygen
+type keygenResult struct {
+	KeyFile             string         `json:"key_file"`
+	PublicKeyFile       string         `json:"public_key_file"`
+	Fingerprint         topayz512.Hash `json:"fingerprint"`
+	SignaturesAvailable uint64         `json:"signatures_available"`
+}
+
+// signResult is the JSON output of sign
+type signResult struct {
+	Files               []string `json:"files"`
+	SignaturesRemaining uint64   `json:"signatures_remaining"`
+}
+
+// verifyResult is the JSON form of one file checked by verify
+type verifyResult struct {
+	fileResult
+	Signer    *topayz512.Hash `json:"signer,omitempty"`
+	Timestamp *time.Time      `json:"timestamp,omitempty"`
+}
+
+// setupKeygen writes <name>.key, <name>.pub and the key's state file
+func setupKeygen(flags *flag.FlagSet) func() error {
+	out := flags.String("out", "topayz512", "output path prefix for the key files")
+	height := flags.Int("height", topayz512.DefaultXMSSHeight, "tree height; the key signs 2^height files")
+
+	return func() error {
+		keyPath := *out + ".key"
+		if _, err := os.Stat(keyPath); err == nil {
+			return fmt.Errorf("%s already exists", keyPath)
+		}
+
+		// The state file is created first and exclusively, so keygen never
+		// takes over the leaf index of an existing key
+		statePath := keyPath + ".state"
+		state, err := os.OpenFile(statePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = state.WriteString("0\n")
+		if closeErr := state.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(statePath)
+			return err
+		}
+
+		params := topayz512.DefaultXMSSParams()
+		params.Height = *height
+		key, err := topayz512.GenerateXMSSKey(params, &topayz512.XMSSOptions{Store: stateStore(keyPath)})
+		if err != nil {
+			os.Remove(statePath)
+			return err
+		}
+		defer key.Wipe()
+
+		if err := os.WriteFile(keyPath, []byte(topayz512.FastHexEncode(key.Bytes())+"\n"), 0o600); err != nil {
+			return err
+		}
+		public := key.Public()
+		if err := os.WriteFile(*out+".pub", []byte(topayz512.FastHexEncode(public.Bytes())+"\n"), 0o644); err != nil {
+			return err
+		}
+
+		if jsonOutput {
+			return printJSON(keygenResult{
+				KeyFile:             keyPath,
+				PublicKeyFile:       *out + ".pub",
+				Fingerprint:         public.Fingerprint(),
+				SignaturesAvailable: params.MaxSignatures(),
+			})
+		}
+		fmt.Printf("Wrote %s and %s.pub\n", keyPath, *out)
+		fmt.Printf("Fingerprint: %s\n", public.Fingerprint())
+		fmt.Printf("Signatures available: %d\n", params.MaxSignatures())
+		return nil
+	}
+}
+
+// setupSign writes <file>.tzsig for every file argument
+func setupSign(flags *flag.FlagSet) func() error {
+	keyPath := flags.String("key", "topayz512.key", "private key file")
+
+	return func() error {
+		if flags.NArg() == 0 {
+			return usageError{errors.New("no files to sign")}
+		}
+
+		data, err := readHexFile(*keyPath)
+		if err != nil {
+			return err
+		}
+		key, err := topayz512.LoadXMSSKey(data, &topayz512.XMSSOptions{Store: stateStore(*keyPath)})
+		topayz512.SecureZero(data)
+		if errors.Is(err, topayz512.ErrStateNotFound) {
+			// Starting over at leaf 0 could sign with a used one-time key
+			return fmt.Errorf("%w; restore it from where %s was last used, since signing without it could reuse one-time leaves", err, *keyPath)
+		}
+		if err != nil {
+			return err
+		}
+		defer key.Wipe()
+
+		result := signResult{Files: []string{}}
+		for _, path := range flags.Args() {
+			sig, err := topayz512.SignFile(path, key)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			sigPath := path + topayz512.FileSignatureExtension
+			if err := topayz512.WriteFileSignature(sigPath, sig); err != nil {
+				return err
+			}
+			result.Files = append(result.Files, sigPath)
+			if !jsonOutput {
+				fmt.Printf("%s: signed\n", path)
+			}
+		}
+
+		result.SignaturesRemaining = key.Remaining()
+		if jsonOutput {
+			return printJSON(result)
+		}
+		fmt.Printf("Signatures remaining: %d\n", key.Remaining())
+		return nil
+	}
+}
+
+// setupVerify checks every file argument against <file>.tzsig
+func setupVerify(flags *flag.FlagSet) func() error {
+	trusted := flags.String("trust", "topayz512.pub", "comma-separated trusted public key files")
+
+	return func() error {
+		if flags.NArg() == 0 {
+			return usageError{errors.New("no files to verify")}
+		}
+
+		var keys []topayz512.XMSSPublicKey
+		for _, path := range strings.Split(*trusted, ",") {
+			data, err := readHexFile(path)
+			if err != nil {
+				return err
+			}
+			key, err := topayz512.XMSSPublicKeyFromBytes(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			keys = append(keys, key)
+		}
+
+		failed := 0
+		results := make([]verifyResult, 0, flags.NArg())
+		for _, path := range flags.Args() {
+			sig, err := topayz512.ReadFileSignature(path + topayz512.FileSignatureExtension)
+			if err == nil {
+				_, err = topayz512.VerifyFile(path, sig, keys)
+			}
+			if err != nil {
+				results = append(results, verifyResult{fileResult: fileResult{Path: path, Error: err.Error()}})
+				if !jsonOutput {
+					fmt.Printf("%s: FAILED (%v)\n", path, err)
+				}
+				failed++
+				continue
+			}
+			results = append(results, verifyResult{
+				fileResult: fileResult{Path: path, OK: true},
+				Signer:     &sig.Signer,
+				Timestamp:  &sig.Timestamp,
+			})
+			if !jsonOutput {
+				fmt.Printf("%s: OK (signed %s by %s)\n", path, sig.Timestamp.Format("2006-01-02 15:04:05 MST"), sig.Signer.String()[:16])
+			}
+		}
+
+		if jsonOutput {
+			if err := printJSON(results); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return failedError{fmt.Errorf("%d of %d files failed verification", failed, flags.NArg())}
+		}
+		return nil
+	}
+}
+
+// stateStore returns the persistent leaf index store kept next to a key file
+func stateStore(keyPath string) topayz512.CounterStore {
+	return topayz512.NewFileCounterStore(keyPath + ".state")
+}
+
+// readHexFile reads a hex-encoded file
+func readHexFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return topayz512.FastHexDecode(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// sumEntry is the JSON form of one computed checksum
+type sumEntry struct {
+	Path string         `json:"path"`
+	Hash topayz512.Hash `json:"hash"`
+}
+
+// setupSum prints Z512SUMS lines for files, or checks them with -c
+func setupSum(flags *flag.FlagSet) func() error {
+	check := flags.Bool("c", false, "read checksums from the files and check them")
+	out := flags.String("o", "", "write checksums to this file instead of standard output")
+
+	return func() error {
+		if *check {
+			return checkSums(flags.Args())
+		}
+		if flags.NArg() == 0 {
+			return usageError{errors.New("no files to checksum")}
+		}
+
+		entries := make([]topayz512.ChecksumEntry, 0, flags.NArg())
+		for _, path := range flags.Args() {
+			entry, err := topayz512.ChecksumFileEntry("", path)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+
+		if *out == "" && jsonOutput {
+			return printSums(entries)
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		if err := topayz512.WriteChecksumFile(w, entries); err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printSums(entries)
+		}
+		return nil
+	}
+}
+
+// printSums writes checksum entries as JSON
+func printSums(entries []topayz512.ChecksumEntry) error {
+	sums := make([]sumEntry, len(entries))
+	for i, entry := range entries {
+		sums[i] = sumEntry{Path: entry.Path, Hash: entry.Hash}
+	}
+	return printJSON(sums)
+}
+
+// checkSums verifies each checksum file against the files next to it
+func checkSums(paths []string) error {
+	if len(paths) == 0 {
+		paths = []string{topayz512.ChecksumFileName}
+	}
+
+	failed := 0
+	results := []fileResult{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		checked, err := topayz512.VerifyChecksumFile(file, filepath.Dir(path))
+		file.Close()
+		if err != nil && !errors.Is(err, topayz512.ErrChecksumMismatch) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, result := range checked {
+			if result.Err != nil {
+				results = append(results, fileResult{Path: result.Path, Error: result.Err.Error()})
+				if !jsonOutput {
+					fmt.Printf("%s: FAILED (%v)\n", result.Path, result.Err)
+				}
+				failed++
+				continue
+			}
+			results = append(results, fileResult{Path: result.Path, OK: true})
+			if !jsonOutput {
+				fmt.Printf("%s: OK\n", result.Path)
+			}
+		}
+	}
+
+	if jsonOutput {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return failedError{fmt.Errorf("%d of %d files failed verification", failed, len(results))}
+	}
+	return nil
+}
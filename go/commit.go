@@ -0,0 +1,181 @@
+package topayz512
+
+// Pluggable commitments
+//
+// A Committer produces and checks the commitments modules store next to data:
+// fragment checksums, manifest entries, content addresses. Modules that take
+// a Committer rather than calling ComputeHash directly can move to another
+// algorithm by swapping the Committer.
+
+// DefaultMerkleChunkSize is the chunk size of a zero MerkleCommitter
+const DefaultMerkleChunkSize = 4096
+
+// Merkle tree node tags, as in RFC 6962 and the MMR
+const (
+	merkleLeafTag = 0
+	merkleNodeTag = 1
+)
+
+// Committer commits to data. Verify must compare in constant time. The
+// commitments fragments store must be HashSize bytes, which every Committer
+// in this package produces.
+type Committer interface {
+	// Commit returns the commitment to data
+	Commit(data []byte) []byte
+	// Verify reports whether commitment is the commitment to data
+	Verify(data, commitment []byte) bool
+}
+
+// Z512Committer commits to data with ComputeHash. It only detects accidental
+// corruption: anyone can recompute the commitment of modified data.
+type Z512Committer struct{}
+
+// Commit returns ComputeHash(data)
+func (Z512Committer) Commit(data []byte) []byte {
+	hash := ComputeHash(data)
+	return hash[:]
+}
+
+// Verify reports whether commitment is ComputeHash(data)
+func (Z512Committer) Verify(data, commitment []byte) bool {
+	hash := ComputeHash(data)
+	return ConstantTimeEqual(hash[:], commitment)
+}
+
+// MACCommitter commits to data with HMAC-Z512 under a secret key, so only
+// holders of the key can produce valid commitments
+type MACCommitter struct {
+	key []byte
+}
+
+// NewMACCommitter returns a MACCommitter keyed with a copy of key
+func NewMACCommitter(key []byte) *MACCommitter {
+	return &MACCommitter{key: append([]byte(nil), key...)}
+}
+
+// Commit returns MAC(key, data)
+func (mc *MACCommitter) Commit(data []byte) []byte {
+	tag := MAC(mc.key, data)
+	return tag[:]
+}
+
+// Verify reports whether commitment is MAC(key, data)
+func (mc *MACCommitter) Verify(data, commitment []byte) bool {
+	return VerifyMAC(mc.key, data, commitment)
+}
+
+// Wipe erases the key. It does nothing for a nil MACCommitter.
+func (mc *MACCommitter) Wipe() {
+	if mc != nil {
+		SecureZero(mc.key)
+	}
+}
+
+// MerkleCommitter commits to data with the root of a binary Merkle tree over
+// ChunkSize-byte chunks, so a single chunk can later be proven against the
+// commitment without the rest of the data. Leaves are H(0x00 || chunk) and
+// inner nodes H(0x01 || left || right), with the left subtree of n leaves
+// holding the largest power of two below n, as in RFC 6962. Empty data
+// commits to ComputeHash of nothing.
+type MerkleCommitter struct {
+	// ChunkSize is the leaf size; zero uses DefaultMerkleChunkSize
+	ChunkSize int
+}
+
+// Commit returns the Merkle root of data's chunks
+func (mc MerkleCommitter) Commit(data []byte) []byte {
+	root := mc.root(data)
+	return root[:]
+}
+
+// Verify reports whether commitment is the Merkle root of data's chunks
+func (mc MerkleCommitter) Verify(data, commitment []byte) bool {
+	root := mc.root(data)
+	return ConstantTimeEqual(root[:], commitment)
+}
+
+// root hashes data's chunks and returns the tree root
+func (mc MerkleCommitter) root(data []byte) Hash {
+	if len(data) == 0 {
+		return ComputeHash(nil)
+	}
+	chunkSize := mc.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultMerkleChunkSize
+	}
+
+	leaves := make([]Hash, 0, (len(data)+chunkSize-1)/chunkSize)
+	for start := 0; start < len(data); start += chunkSize {
+		leaves = append(leaves, merkleLeaf(data[start:min(start+chunkSize, len(data))]))
+	}
+	return merkleRoot(leaves)
+}
+
+// merkleLeaf hashes leaf data
+func merkleLeaf(data []byte) Hash {
+	return HashMultiple([]byte{merkleLeafTag}, data)
+}
+
+// merkleNode hashes two children into their parent
+func merkleNode(left, right Hash) Hash {
+	return HashMultiple([]byte{merkleNodeTag}, left[:], right[:])
+}
+
+// merkleRoot returns the root over one or more leaf hashes
+func merkleRoot(leaves []Hash) Hash {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	split := 1
+	for split*2 < len(leaves) {
+		split *= 2
+	}
+	return merkleNode(merkleRoot(leaves[:split]), merkleRoot(leaves[split:]))
+}
+
+// commitmentHash converts a commitment to a fragment checksum
+func commitmentHash(commitment []byte) (Hash, error) {
+	var hash Hash
+	if len(commitment) != HashSize {
+		return hash, ErrInvalidHashSize
+	}
+	copy(hash[:], commitment)
+	return hash, nil
+}
+
+// fragmentCommitment computes and checks fragment checksums
+type fragmentCommitment interface {
+	commit(fragment Fragment) (Hash, error)
+	verify(fragment Fragment) bool
+}
+
+// keyedCommitment checksums fragments with a FragmentKey, or plain hashes
+// for a nil key
+type keyedCommitment struct {
+	key *FragmentKey
+}
+
+// commit returns the fragment's checksum
+func (kc keyedCommitment) commit(fragment Fragment) (Hash, error) {
+	return fragmentChecksum(kc.key, fragment), nil
+}
+
+// verify reports whether the fragment's checksum is correct
+func (kc keyedCommitment) verify(fragment Fragment) bool {
+	return HashEqual(fragmentChecksum(kc.key, fragment), fragment.Checksum)
+}
+
+// committerCommitment checksums fragment data with a Committer
+type committerCommitment struct {
+	committer Committer
+}
+
+// commit returns the commitment to the fragment's data
+func (cc committerCommitment) commit(fragment Fragment) (Hash, error) {
+	return commitmentHash(cc.committer.Commit(fragment.Data))
+}
+
+// verify reports whether the fragment's checksum commits to its data
+func (cc committerCommitment) verify(fragment Fragment) bool {
+	return cc.committer.Verify(fragment.Data, fragment.Checksum[:])
+}
@@ -0,0 +1,346 @@
+// Package conformance is the test suite an alternative TOPAY-Z512 backend
+// (liboqs, a hardware module, a GPU implementation) must pass to be
+// interchangeable with the reference implementation in topayz512.
+//
+// A backend package runs the suite from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//	    conformance.Run(t, myBackend{})
+//	}
+//
+// The suite checks hash vectors, KEM round trips in both directions
+// against the reference implementation, decapsulation of fixed ciphertexts
+// including implicit rejection, error behavior, and that decapsulation time
+// doesn't depend on whether a ciphertext is rejected. The timing check is
+// statistical and skipped in -short mode.
+package conformance
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Backend is an implementation of the TOPAY-Z512 primitives under test.
+// Keys, ciphertexts and shared secrets use the reference encodings.
+type Backend interface {
+	// Name identifies the backend in test output
+	Name() string
+
+	// Hash computes the TOPAY-Z512 hash of data
+	Hash(data []byte) topayz512.Hash
+
+	// KEMKeyGen generates a KEM key pair
+	KEMKeyGen() (topayz512.KEMPublicKey, topayz512.KEMSecretKey, error)
+
+	// KEMEncapsulate encapsulates a fresh shared secret to publicKey
+	KEMEncapsulate(publicKey topayz512.KEMPublicKey) (topayz512.Ciphertext, topayz512.SharedSecret, error)
+
+	// KEMDecapsulate decapsulates a ciphertext, returning
+	// topayz512.ErrWrongRecipient for one bound to another key
+	KEMDecapsulate(secretKey topayz512.KEMSecretKey, ciphertext topayz512.Ciphertext) (topayz512.SharedSecret, error)
+}
+
+// Reference is the topayz512 package as a Backend, for comparison and for
+// testing the suite itself
+var Reference Backend = reference{}
+
+// reference implements Backend with the topayz512 package
+type reference struct{}
+
+func (reference) Name() string { return "reference" }
+
+func (reference) Hash(data []byte) topayz512.Hash { return topayz512.ComputeHash(data) }
+
+func (reference) KEMKeyGen() (topayz512.KEMPublicKey, topayz512.KEMSecretKey, error) {
+	return topayz512.KEMKeyGen()
+}
+
+func (reference) KEMEncapsulate(publicKey topayz512.KEMPublicKey) (topayz512.Ciphertext, topayz512.SharedSecret, error) {
+	return topayz512.KEMEncapsulate(publicKey)
+}
+
+func (reference) KEMDecapsulate(secretKey topayz512.KEMSecretKey, ciphertext topayz512.Ciphertext) (topayz512.SharedSecret, error) {
+	return topayz512.KEMDecapsulate(secretKey, ciphertext)
+}
+
+// vectorsJSON holds the known-answer vectors, generated with the reference
+// implementation. The KEM vectors encapsulate fixed messages to keys with
+// fixed seeds; each rejected ciphertext is its vector's ciphertext with one
+// bit flipped and the recipient tag recomputed, so it reaches implicit
+// rejection.
+//
+//go:embed vectors.json
+var vectorsJSON []byte
+
+// hashVector is a hash known answer
+type hashVector struct {
+	Input hexBytes `json:"input"`
+	Hash  hexBytes `json:"hash"`
+}
+
+// kemVector is a KEM known answer
+type kemVector struct {
+	SecretKey            hexBytes `json:"secret_key"`
+	PublicKey            hexBytes `json:"public_key"`
+	Ciphertext           hexBytes `json:"ciphertext"`
+	SharedSecret         hexBytes `json:"shared_secret"`
+	RejectedCiphertext   hexBytes `json:"rejected_ciphertext"`
+	RejectedSharedSecret hexBytes `json:"rejected_shared_secret"`
+}
+
+// vectors is the parsed form of vectors.json
+type vectors struct {
+	Hash []hashVector `json:"hash"`
+	KEM  []kemVector  `json:"kem"`
+}
+
+// hexBytes is a byte string stored as hex
+type hexBytes []byte
+
+// UnmarshalText decodes hex
+func (h *hexBytes) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(string(text))
+	*h = decoded
+	return err
+}
+
+// loadVectors parses the embedded vectors
+func loadVectors(t *testing.T) vectors {
+	t.Helper()
+	var v vectors
+	if err := json.Unmarshal(vectorsJSON, &v); err != nil {
+		t.Fatalf("conformance vectors are invalid: %v", err)
+	}
+	return v
+}
+
+// Timing check parameters
+const (
+	// timingSamples is the number of decapsulations timed per class
+	timingSamples = 400
+
+	// timingThreshold is the Welch t statistic above which decapsulation
+	// time is taken to depend on rejection. dudect reports a likely leak
+	// from 4.5; the higher bound keeps scheduler noise from failing runs.
+	timingThreshold = 10
+)
+
+// Run runs the conformance suite against backend as subtests of t
+func Run(t *testing.T, backend Backend) {
+	v := loadVectors(t)
+	t.Run(backend.Name()+"/HashVectors", func(t *testing.T) { testHashVectors(t, backend, v) })
+	t.Run(backend.Name()+"/KEMRoundTrip", func(t *testing.T) { testKEMRoundTrip(t, backend) })
+	t.Run(backend.Name()+"/KEMInterop", func(t *testing.T) { testKEMInterop(t, backend) })
+	t.Run(backend.Name()+"/KEMVectors", func(t *testing.T) { testKEMVectors(t, backend, v) })
+	t.Run(backend.Name()+"/WrongRecipient", func(t *testing.T) { testWrongRecipient(t, backend) })
+	t.Run(backend.Name()+"/ConstantTimeDecapsulation", func(t *testing.T) { testConstantTime(t, backend, v) })
+}
+
+// testHashVectors checks the hash known answers
+func testHashVectors(t *testing.T, backend Backend, v vectors) {
+	for i, vector := range v.Hash {
+		if got := backend.Hash(vector.Input); string(got[:]) != string(vector.Hash) {
+			t.Errorf("hash vector %d (%d bytes): got %x, want %x", i, len(vector.Input), got, []byte(vector.Hash))
+		}
+	}
+}
+
+// testKEMRoundTrip checks that the backend decapsulates its own
+// encapsulations and produces fresh keys and secrets
+func testKEMRoundTrip(t *testing.T, backend Backend) {
+	publicKey, secretKey, err := backend.KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen: %v", err)
+	}
+	otherPublic, _, err := backend.KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen: %v", err)
+	}
+	if otherPublic == publicKey {
+		t.Error("KEMKeyGen returned the same key twice")
+	}
+
+	var previous topayz512.SharedSecret
+	for i := 0; i < 4; i++ {
+		ciphertext, sharedSecret, err := backend.KEMEncapsulate(publicKey)
+		if err != nil {
+			t.Fatalf("KEMEncapsulate: %v", err)
+		}
+		decapsulated, err := backend.KEMDecapsulate(secretKey, ciphertext)
+		if err != nil {
+			t.Fatalf("KEMDecapsulate: %v", err)
+		}
+		if decapsulated != sharedSecret {
+			t.Fatal("decapsulated secret differs from the encapsulated one")
+		}
+		if sharedSecret == previous {
+			t.Fatal("KEMEncapsulate repeated a shared secret")
+		}
+		previous = sharedSecret
+	}
+}
+
+// testKEMInterop checks the backend against the reference in both
+// directions, including that its key pairs use the reference key derivation
+func testKEMInterop(t *testing.T, backend Backend) {
+	publicKey, secretKey, err := backend.KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen: %v", err)
+	}
+	if !topayz512.VerifyKEMKeyPair(publicKey, secretKey) {
+		t.Fatal("backend key pair doesn't match the reference key derivation")
+	}
+
+	ciphertext, sharedSecret, err := topayz512.KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("reference KEMEncapsulate to a backend key: %v", err)
+	}
+	decapsulated, err := backend.KEMDecapsulate(secretKey, ciphertext)
+	if err != nil || decapsulated != sharedSecret {
+		t.Errorf("backend can't decapsulate a reference ciphertext: %v", err)
+	}
+
+	ciphertext, sharedSecret, err = backend.KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("KEMEncapsulate: %v", err)
+	}
+	decapsulated, err = topayz512.KEMDecapsulate(secretKey, ciphertext)
+	if err != nil || decapsulated != sharedSecret {
+		t.Errorf("reference can't decapsulate a backend ciphertext: %v", err)
+	}
+}
+
+// testKEMVectors checks decapsulation of the fixed ciphertexts, accepted
+// and implicitly rejected, and encapsulation to the fixed public keys
+func testKEMVectors(t *testing.T, backend Backend, v vectors) {
+	for i, vector := range v.KEM {
+		secretKey, err := topayz512.KEMSecretKeyFromBytes(vector.SecretKey)
+		if err != nil {
+			t.Fatalf("KEM vector %d: %v", i, err)
+		}
+		publicKey, _ := topayz512.KEMPublicKeyFromBytes(vector.PublicKey)
+		ciphertext, _ := topayz512.CiphertextFromBytes(vector.Ciphertext)
+		rejected, _ := topayz512.CiphertextFromBytes(vector.RejectedCiphertext)
+
+		sharedSecret, err := backend.KEMDecapsulate(secretKey, ciphertext)
+		if err != nil || string(sharedSecret[:]) != string(vector.SharedSecret) {
+			t.Errorf("KEM vector %d: wrong shared secret (%v)", i, err)
+		}
+		sharedSecret, err = backend.KEMDecapsulate(secretKey, rejected)
+		if err != nil || string(sharedSecret[:]) != string(vector.RejectedSharedSecret) {
+			t.Errorf("KEM vector %d: wrong implicit rejection secret (%v)", i, err)
+		}
+
+		ciphertext, sharedSecret, err = backend.KEMEncapsulate(publicKey)
+		if err != nil {
+			t.Fatalf("KEM vector %d: KEMEncapsulate: %v", i, err)
+		}
+		decapsulated, err := topayz512.KEMDecapsulate(secretKey, ciphertext)
+		if err != nil || decapsulated != sharedSecret {
+			t.Errorf("KEM vector %d: encapsulation to the fixed key doesn't decapsulate (%v)", i, err)
+		}
+	}
+}
+
+// testWrongRecipient checks that a ciphertext for another key is refused
+// and a non-canonical public key can't be encapsulated to
+func testWrongRecipient(t *testing.T, backend Backend) {
+	publicKey, _, err := backend.KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen: %v", err)
+	}
+	_, otherSecret, err := backend.KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen: %v", err)
+	}
+	ciphertext, _, err := backend.KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("KEMEncapsulate: %v", err)
+	}
+	if _, err := backend.KEMDecapsulate(otherSecret, ciphertext); !errors.Is(err, topayz512.ErrWrongRecipient) {
+		t.Errorf("expected ErrWrongRecipient, got %v", err)
+	}
+
+	var invalid topayz512.KEMPublicKey
+	for i := range invalid {
+		invalid[i] = 0xff
+	}
+	if _, _, err := backend.KEMEncapsulate(invalid); err == nil {
+		t.Error("KEMEncapsulate accepted a non-canonical public key")
+	}
+}
+
+// testConstantTime compares decapsulation times of an accepted and an
+// implicitly rejected ciphertext with Welch's t-test, interleaving the two
+// classes in random order and cropping the slowest tenth of each
+func testConstantTime(t *testing.T, backend Backend, v vectors) {
+	if testing.Short() {
+		t.Skip("timing check skipped in short mode")
+	}
+	vector := v.KEM[0]
+	secretKey, _ := topayz512.KEMSecretKeyFromBytes(vector.SecretKey)
+	var classes [2]topayz512.Ciphertext
+	classes[0], _ = topayz512.CiphertextFromBytes(vector.Ciphertext)
+	classes[1], _ = topayz512.CiphertextFromBytes(vector.RejectedCiphertext)
+
+	order := make([]int, 2*timingSamples)
+	for i := range order {
+		order[i] = i % 2
+	}
+	rng := rand.New(rand.NewSource(1))
+	rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+
+	var samples [2][]float64
+	for _, class := range order {
+		start := time.Now()
+		backend.KEMDecapsulate(secretKey, classes[class])
+		samples[class] = append(samples[class], float64(time.Since(start)))
+	}
+
+	statistic := welchT(crop(samples[0]), crop(samples[1]))
+	if math.Abs(statistic) > timingThreshold {
+		t.Errorf("decapsulation time depends on rejection: |t| = %.1f", math.Abs(statistic))
+	}
+}
+
+// crop drops the slowest tenth of the samples, which mostly measure
+// preemption rather than the code
+func crop(samples []float64) []float64 {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	return sorted[:len(sorted)*9/10]
+}
+
+// welchT returns Welch's t statistic of two samples
+func welchT(a, b []float64) float64 {
+	meanA, varianceA := meanVariance(a)
+	meanB, varianceB := meanVariance(b)
+	denominator := math.Sqrt(varianceA/float64(len(a)) + varianceB/float64(len(b)))
+	if denominator == 0 {
+		return 0
+	}
+	return (meanA - meanB) / denominator
+}
+
+// meanVariance returns the mean and sample variance
+func meanVariance(samples []float64) (float64, float64) {
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+	mean := sum / float64(len(samples))
+	var squares float64
+	for _, s := range samples {
+		squares += (s - mean) * (s - mean)
+	}
+	return mean, squares / float64(len(samples)-1)
+}
@@ -0,0 +1,8 @@
+package conformance
+
+import "testing"
+
+// Test that the reference implementation conforms
+func TestReference(t *testing.T) {
+	Run(t, Reference)
+}
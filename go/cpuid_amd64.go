@@ -0,0 +1,61 @@
+//go:build !purego
+
+package topayz512
+
+// cpuid executes CPUID with EAX=eaxArg and ECX=ecxArg
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+// xgetbv reads extended control register 0, the state the OS saves
+func xgetbv() (eax, edx uint32)
+
+// CPUID feature bits
+const (
+	cpuidSSE2    = 1 << 26 // leaf 1 EDX
+	cpuidSSE3    = 1 << 0  // leaf 1 ECX
+	cpuidSSSE3   = 1 << 9  // leaf 1 ECX
+	cpuidSSE41   = 1 << 19 // leaf 1 ECX
+	cpuidSSE42   = 1 << 20 // leaf 1 ECX
+	cpuidOSXSAVE = 1 << 27 // leaf 1 ECX
+	cpuidAVX     = 1 << 28 // leaf 1 ECX
+	cpuidAVX2    = 1 << 5  // leaf 7 EBX
+	cpuidAVX512F = 1 << 16 // leaf 7 EBX
+)
+
+// XCR0 state components: SSE and AVX registers, then the AVX-512 opmask and
+// upper ZMM registers
+const (
+	xcr0AVX    = 0x06
+	xcr0AVX512 = 0xe6
+)
+
+// detectSIMD reads the instruction sets from CPUID. AVX and AVX-512 also
+// need the OS to save their registers, which XGETBV reports.
+func detectSIMD() SIMDCapabilities {
+	maxLeaf, _, _, _ := cpuid(0, 0)
+	if maxLeaf < 1 {
+		return SIMDCapabilities{SSE2: true}
+	}
+	_, _, ecx1, edx1 := cpuid(1, 0)
+
+	var osAVX, osAVX512 bool
+	if ecx1&cpuidOSXSAVE != 0 {
+		xcr0, _ := xgetbv()
+		osAVX = xcr0&xcr0AVX == xcr0AVX
+		osAVX512 = xcr0&xcr0AVX512 == xcr0AVX512
+	}
+
+	caps := SIMDCapabilities{
+		SSE2:  edx1&cpuidSSE2 != 0,
+		SSE3:  ecx1&cpuidSSE3 != 0,
+		SSSE3: ecx1&cpuidSSSE3 != 0,
+		SSE41: ecx1&cpuidSSE41 != 0,
+		SSE42: ecx1&cpuidSSE42 != 0,
+		AVX:   ecx1&cpuidAVX != 0 && osAVX,
+	}
+	if maxLeaf >= 7 {
+		_, ebx7, _, _ := cpuid(7, 0)
+		caps.AVX2 = ebx7&cpuidAVX2 != 0 && osAVX
+		caps.AVX512 = ebx7&cpuidAVX512F != 0 && osAVX512
+	}
+	return caps
+}
@@ -0,0 +1,6 @@
+package topayz512
+
+// detectSIMD reports NEON, which ARMv8-A, Go's arm64 baseline, always has
+func detectSIMD() SIMDCapabilities {
+	return SIMDCapabilities{NEON: true}
+}
@@ -0,0 +1,11 @@
+//go:build !arm64 && (!amd64 || purego)
+
+package topayz512
+
+import "runtime"
+
+// detectSIMD can't execute CPUID here, so it reports only SSE2, which every
+// amd64 CPU has, and nothing on other architectures
+func detectSIMD() SIMDCapabilities {
+	return SIMDCapabilities{SSE2: runtime.GOARCH == "amd64"}
+}
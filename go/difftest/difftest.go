@@ -0,0 +1,352 @@
+// Package difftest generates reproducible random inputs and checks that the
+// sequential and parallel implementations in topayz512 agree on them.
+//
+// Every check is driven by a seed, so a failure reported by Run can be
+// replayed exactly:
+//
+//	if err := difftest.Run(seed, 100); err != nil {
+//	    log.Fatal(err) // the error names the seed and case
+//	}
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Corruption is a way of damaging data
+type Corruption int
+
+// Corruption patterns
+const (
+	// BitFlip flips a single bit
+	BitFlip Corruption = iota
+	// Truncate drops trailing bytes
+	Truncate
+	// Extend appends random bytes
+	Extend
+	// ZeroRun overwrites a run of bytes with zeros
+	ZeroRun
+
+	corruptionCount
+)
+
+// String returns the name of a corruption pattern
+func (c Corruption) String() string {
+	switch c {
+	case BitFlip:
+		return "bit-flip"
+	case Truncate:
+		return "truncate"
+	case Extend:
+		return "extend"
+	case ZeroRun:
+		return "zero-run"
+	}
+	return "unknown"
+}
+
+// boundarySizes are sizes where block, fragment and threshold logic changes
+var boundarySizes = []int{
+	1, 2, 63, 64, 65, 127, 128, 129,
+	topayz512.FragmentSize - 1, topayz512.FragmentSize, topayz512.FragmentSize + 1,
+	topayz512.MinFragmentThreshold - 1, topayz512.MinFragmentThreshold, topayz512.MinFragmentThreshold + 1,
+	topayz512.FragmentSize * topayz512.MaxFragments, topayz512.FragmentSize*topayz512.MaxFragments + 1,
+}
+
+// Generator produces reproducible random inputs from a seed
+type Generator struct {
+	seed int64
+	rng  *rand.Rand
+}
+
+// NewGenerator creates a generator; the same seed always yields the same inputs
+func NewGenerator(seed int64) *Generator {
+	return &Generator{seed: seed, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Seed returns the generator's seed
+func (g *Generator) Seed() int64 {
+	return g.seed
+}
+
+// Size returns a size in [1, max], favouring boundary sizes a third of the time
+func (g *Generator) Size(max int) int {
+	if g.rng.Intn(3) == 0 {
+		candidates := make([]int, 0, len(boundarySizes))
+		for _, size := range boundarySizes {
+			if size <= max {
+				candidates = append(candidates, size)
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[g.rng.Intn(len(candidates))]
+		}
+	}
+	return 1 + g.rng.Intn(max)
+}
+
+// Bytes returns random data of a random size in [1, max]
+func (g *Generator) Bytes(max int) []byte {
+	data := make([]byte, g.Size(max))
+	g.rng.Read(data)
+	return data
+}
+
+// Inputs returns count random inputs of up to maxSize bytes
+func (g *Generator) Inputs(count, maxSize int) [][]byte {
+	inputs := make([][]byte, count)
+	for i := range inputs {
+		inputs[i] = g.Bytes(maxSize)
+	}
+	return inputs
+}
+
+// Chunks splits data into random-sized consecutive pieces
+func (g *Generator) Chunks(data []byte) [][]byte {
+	var chunks [][]byte
+	for len(data) > 0 {
+		n := 1 + g.rng.Intn(len(data))
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+// Corrupt returns a damaged copy of data and the pattern used
+func (g *Generator) Corrupt(data []byte) ([]byte, Corruption) {
+	pattern := Corruption(g.rng.Intn(int(corruptionCount)))
+	corrupted := append([]byte(nil), data...)
+
+	switch pattern {
+	case BitFlip:
+		if len(corrupted) == 0 {
+			return append(corrupted, 1), Extend
+		}
+		corrupted[g.rng.Intn(len(corrupted))] ^= 1 << uint(g.rng.Intn(8))
+	case Truncate:
+		if len(corrupted) == 0 {
+			return append(corrupted, 1), Extend
+		}
+		corrupted = corrupted[:g.rng.Intn(len(corrupted))]
+	case Extend:
+		extra := make([]byte, 1+g.rng.Intn(16))
+		g.rng.Read(extra)
+		corrupted = append(corrupted, extra...)
+	case ZeroRun:
+		if len(corrupted) == 0 {
+			return append(corrupted, 1), Extend
+		}
+		start := g.rng.Intn(len(corrupted))
+		end := start + 1 + g.rng.Intn(len(corrupted)-start)
+		changed := false
+		for i := start; i < end; i++ {
+			changed = changed || corrupted[i] != 0
+			corrupted[i] = 0
+		}
+		if !changed {
+			corrupted[start] = 1
+		}
+	}
+
+	return corrupted, pattern
+}
+
+// Shuffle returns the fragments in a random order
+func (g *Generator) Shuffle(fragments []topayz512.Fragment) []topayz512.Fragment {
+	shuffled := append([]topayz512.Fragment(nil), fragments...)
+	g.rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return shuffled
+}
+
+// Mismatch reports implementations disagreeing on a generated case
+type Mismatch struct {
+	Check  string
+	Seed   int64
+	Case   int
+	Detail string
+}
+
+// Error implements error
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("difftest: %s mismatch (seed %d, case %d): %s", m.Check, m.Seed, m.Case, m.Detail)
+}
+
+// Run executes cases rounds of every check with inputs generated from seed
+// and returns the first mismatch
+func Run(seed int64, cases int) error {
+	g := NewGenerator(seed)
+
+	checks := []struct {
+		name string
+		run  func(g *Generator) error
+	}{
+		{"fragmentation", CheckFragmentation},
+		{"reconstruction", CheckReconstruction},
+		{"batch-hash", CheckBatchHash},
+		{"streaming-hash", CheckStreamingHash},
+		{"fragmented-hash", CheckFragmentedHash},
+	}
+
+	for i := 0; i < cases; i++ {
+		for _, check := range checks {
+			if err := check.run(g); err != nil {
+				return &Mismatch{Check: check.name, Seed: seed, Case: i, Detail: err.Error()}
+			}
+		}
+	}
+	return nil
+}
+
+// maxInputSize bounds generated inputs so fragmentation covers the
+// MaxFragments cap without making runs slow
+const maxInputSize = topayz512.FragmentSize*topayz512.MaxFragments + 4096
+
+// CheckFragmentation compares FragmentData with ParallelFragmentData. IDs and
+// timestamps are fresh per call and excluded.
+func CheckFragmentation(g *Generator) error {
+	data := g.Bytes(maxInputSize)
+
+	sequential, err := topayz512.FragmentData(data)
+	if err != nil {
+		return fmt.Errorf("FragmentData: %w", err)
+	}
+	parallel, err := topayz512.ParallelFragmentData(data)
+	if err != nil {
+		return fmt.Errorf("ParallelFragmentData: %w", err)
+	}
+
+	if len(sequential.Fragments) != len(parallel.Fragments) {
+		return fmt.Errorf("%d-byte input: %d vs %d fragments", len(data), len(sequential.Fragments), len(parallel.Fragments))
+	}
+	for i := range sequential.Fragments {
+		s, p := sequential.Fragments[i], parallel.Fragments[i]
+		if s.Index != p.Index || s.Total != p.Total || !bytes.Equal(s.Data, p.Data) || s.Checksum != p.Checksum {
+			return fmt.Errorf("%d-byte input: fragment %d differs", len(data), i)
+		}
+	}
+	if sequential.Metadata.OriginalSize != parallel.Metadata.OriginalSize ||
+		sequential.Metadata.FragmentCount != parallel.Metadata.FragmentCount ||
+		sequential.Metadata.Checksum != parallel.Metadata.Checksum {
+		return fmt.Errorf("%d-byte input: metadata differs", len(data))
+	}
+	return nil
+}
+
+// CheckReconstruction compares ReconstructData with ParallelReconstructData on
+// shuffled fragments, both intact and with one fragment corrupted
+func CheckReconstruction(g *Generator) error {
+	data := g.Bytes(maxInputSize)
+	result, err := topayz512.FragmentData(data)
+	if err != nil {
+		return fmt.Errorf("FragmentData: %w", err)
+	}
+
+	fragments := g.Shuffle(result.Fragments)
+	if err := compareReconstruction(fragments); err != nil {
+		return err
+	}
+
+	sequential, err := topayz512.ReconstructData(fragments)
+	if err != nil || !bytes.Equal(sequential.Data, data) {
+		return fmt.Errorf("%d-byte input: shuffled fragments didn't reconstruct: %v", len(data), err)
+	}
+
+	victim := g.rng.Intn(len(fragments))
+	corrupted := append([]topayz512.Fragment(nil), fragments...)
+	var pattern Corruption
+	corrupted[victim].Data, pattern = g.Corrupt(corrupted[victim].Data)
+	if err := compareReconstruction(corrupted); err != nil {
+		return fmt.Errorf("%s: %w", pattern, err)
+	}
+	if _, err := topayz512.ReconstructData(corrupted); err == nil {
+		return fmt.Errorf("%s corruption of fragment %d was accepted", pattern, victim)
+	}
+	return nil
+}
+
+// compareReconstruction checks both reconstruction paths return the same data and error
+func compareReconstruction(fragments []topayz512.Fragment) error {
+	sequential, seqErr := topayz512.ReconstructData(fragments)
+	parallel, parErr := topayz512.ParallelReconstructData(fragments)
+
+	if seqErr != parErr {
+		return fmt.Errorf("errors differ: %v vs %v", seqErr, parErr)
+	}
+	if !bytes.Equal(sequential.Data, parallel.Data) {
+		return fmt.Errorf("reconstructed data differs")
+	}
+	return nil
+}
+
+// CheckBatchHash compares BatchHash and BatchHashWithSalt with per-input loops
+func CheckBatchHash(g *Generator) error {
+	inputs := g.Inputs(1+g.rng.Intn(64), 4096)
+	salt := g.Bytes(64)
+
+	batch := topayz512.BatchHash(inputs)
+	salted := topayz512.BatchHashWithSalt(inputs, salt)
+	if len(batch) != len(inputs) || len(salted) != len(inputs) {
+		return fmt.Errorf("%d inputs: got %d and %d hashes", len(inputs), len(batch), len(salted))
+	}
+
+	for i, input := range inputs {
+		if batch[i] != topayz512.ComputeHash(input) {
+			return fmt.Errorf("BatchHash input %d (%d bytes) differs from ComputeHash", i, len(input))
+		}
+		if salted[i] != topayz512.HashWithSalt(input, salt) {
+			return fmt.Errorf("BatchHashWithSalt input %d (%d bytes) differs from HashWithSalt", i, len(input))
+		}
+	}
+	return nil
+}
+
+// CheckStreamingHash compares StreamingHash fed random chunks with ComputeHash
+func CheckStreamingHash(g *Generator) error {
+	data := g.Bytes(8192)
+
+	sh := topayz512.NewStreamingHash()
+	defer sh.Close()
+	for _, chunk := range g.Chunks(data) {
+		sh.Write(chunk)
+	}
+
+	if sh.Sum() != topayz512.ComputeHash(data) {
+		return fmt.Errorf("%d-byte input: streaming hash differs from ComputeHash", len(data))
+	}
+	return nil
+}
+
+// CheckFragmentedHash compares FragmentedHash with a sequential reference of
+// its definition. For inputs of MinFragmentThreshold bytes or more it is the
+// hash of the fragment hashes, which deliberately differs from ComputeHash.
+func CheckFragmentedHash(g *Generator) error {
+	data := g.Bytes(maxInputSize)
+
+	fragmented, err := topayz512.FragmentedHash(data)
+	if err != nil {
+		return fmt.Errorf("FragmentedHash: %w", err)
+	}
+
+	reference := topayz512.ComputeHash(data)
+	if topayz512.ShouldFragment(len(data)) {
+		result, err := topayz512.FragmentData(data)
+		if err != nil {
+			return fmt.Errorf("FragmentData: %w", err)
+		}
+		hs := topayz512.NewHashState()
+		for _, fragment := range result.Fragments {
+			fragmentHash := topayz512.ComputeHash(fragment.Data)
+			hs.Update(fragmentHash[:])
+		}
+		reference = hs.Finalize()
+	}
+
+	if fragmented != reference {
+		return fmt.Errorf("%d-byte input: FragmentedHash differs from the sequential reference", len(data))
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package topayz512
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Public key discovery through DNS TXT records
+//
+// A domain publishes its keys as TXT records at _topayz512.<domain>, one key
+// per record, in the form
+//
+//	v=tz512; k=kem; fp=<hex fingerprint>; p=<base64 key>
+//
+// The p field is optional: a fingerprint-only record pins a key delivered by
+// other means, like a TLSA record. A full KEM key is far longer than 255
+// bytes, so it spans many character strings of one record; resolvers join
+// them, and DNS falls back to TCP for the large response.
+
+// DNSKeyPrefix is the label under which a domain publishes its keys
+const DNSKeyPrefix = "_topayz512."
+
+// dnsKeyVersion is the version tag every key record starts with
+const dnsKeyVersion = "tz512"
+
+// DefaultDNSKeyCacheTTL is how long DNSKeyResolver keeps lookup results
+const DefaultDNSKeyCacheTTL = 5 * time.Minute
+
+// Key kinds published in DNS records
+const (
+	// DNSKeyKEM is a KEM public key, fingerprinted by KEMKeyID
+	DNSKeyKEM = "kem"
+	// DNSKeySigning is a signing public key, fingerprinted by PublicKeyFingerprint
+	DNSKeySigning = "sig"
+)
+
+// DNSKeyRecord is one key published in a DNS TXT record
+type DNSKeyRecord struct {
+	Kind        string `json:"kind"`
+	Fingerprint Hash   `json:"fingerprint"`
+	// Key is the full public key, or nil for a fingerprint-only record
+	Key []byte `json:"key,omitempty"`
+}
+
+// PublicKeyFingerprint identifies a signing public key in DNS records
+func PublicKeyFingerprint(publicKey PublicKey) Hash {
+	return HashConcat([]byte("TOPAY-Z512-FINGERPRINT"), publicKey[:])
+}
+
+// NewKEMKeyRecord describes a KEM public key, with the full key if includeKey is set
+func NewKEMKeyRecord(publicKey KEMPublicKey, includeKey bool) DNSKeyRecord {
+	record := DNSKeyRecord{Kind: DNSKeyKEM, Fingerprint: KEMKeyID(publicKey)}
+	if includeKey {
+		record.Key = publicKey.AppendBytes(nil)
+	}
+	return record
+}
+
+// NewSigningKeyRecord describes a signing public key, with the full key if includeKey is set
+func NewSigningKeyRecord(publicKey PublicKey, includeKey bool) DNSKeyRecord {
+	record := DNSKeyRecord{Kind: DNSKeySigning, Fingerprint: PublicKeyFingerprint(publicKey)}
+	if includeKey {
+		record.Key = publicKey.AppendBytes(nil)
+	}
+	return record
+}
+
+// String returns the TXT record text
+func (r DNSKeyRecord) String() string {
+	var sb strings.Builder
+	sb.WriteString("v=" + dnsKeyVersion + "; k=" + r.Kind + "; fp=" + r.Fingerprint.String())
+	if r.Key != nil {
+		sb.WriteString("; p=" + base64.StdEncoding.EncodeToString(r.Key))
+	}
+	return sb.String()
+}
+
+// TXTChunks splits the record text into character strings of at most 255
+// bytes, as zone files and DNS update APIs require
+func (r DNSKeyRecord) TXTChunks() []string {
+	text := r.String()
+	chunks := make([]string, 0, len(text)/255+1)
+	for len(text) > 255 {
+		chunks = append(chunks, text[:255])
+		text = text[255:]
+	}
+	return append(chunks, text)
+}
+
+// KEMPublicKey returns the full KEM key of a record. It returns ErrUnknownKey
+// for a fingerprint-only or non-KEM record.
+func (r DNSKeyRecord) KEMPublicKey() (KEMPublicKey, error) {
+	if r.Kind != DNSKeyKEM || r.Key == nil {
+		return KEMPublicKey{}, ErrUnknownKey
+	}
+	var publicKey KEMPublicKey
+	copy(publicKey[:], r.Key)
+	return publicKey, nil
+}
+
+// PublicKey returns the full signing key of a record. It returns
+// ErrUnknownKey for a fingerprint-only or non-signing record.
+func (r DNSKeyRecord) PublicKey() (PublicKey, error) {
+	if r.Kind != DNSKeySigning || r.Key == nil {
+		return PublicKey{}, ErrUnknownKey
+	}
+	var publicKey PublicKey
+	copy(publicKey[:], r.Key)
+	return publicKey, nil
+}
+
+// ParseDNSKeyRecord parses TXT record text. It returns ErrInvalidKeyRecord
+// unless the record is well formed, of a known kind, and any included key is
+// valid and matches the fingerprint.
+func ParseDNSKeyRecord(text string) (DNSKeyRecord, error) {
+	fields := make(map[string]string)
+	for i, field := range strings.Split(text, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok || name == "" {
+			if i > 0 && strings.TrimSpace(field) == "" {
+				continue
+			}
+			return DNSKeyRecord{}, ErrInvalidKeyRecord
+		}
+		if _, duplicate := fields[name]; duplicate {
+			return DNSKeyRecord{}, ErrInvalidKeyRecord
+		}
+		// The version tag must come first so other TXT records are told apart
+		if i == 0 && (name != "v" || value != dnsKeyVersion) {
+			return DNSKeyRecord{}, ErrInvalidKeyRecord
+		}
+		fields[name] = value
+	}
+
+	fingerprint, err := HashFromHex(fields["fp"])
+	if err != nil {
+		return DNSKeyRecord{}, ErrInvalidKeyRecord
+	}
+	record := DNSKeyRecord{Kind: fields["k"], Fingerprint: fingerprint}
+
+	encoded, hasKey := fields["p"]
+	if hasKey {
+		if record.Key, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return DNSKeyRecord{}, ErrInvalidKeyRecord
+		}
+	}
+
+	switch record.Kind {
+	case DNSKeyKEM:
+		if hasKey {
+			if len(record.Key) != KEMPublicKeySize {
+				return DNSKeyRecord{}, ErrInvalidKeyRecord
+			}
+			publicKey, _ := record.KEMPublicKey()
+			if !IsValidKEMPublicKey(publicKey) || KEMKeyID(publicKey) != fingerprint {
+				return DNSKeyRecord{}, ErrInvalidKeyRecord
+			}
+		}
+	case DNSKeySigning:
+		if hasKey {
+			if len(record.Key) != PublicKeySize {
+				return DNSKeyRecord{}, ErrInvalidKeyRecord
+			}
+			publicKey, _ := record.PublicKey()
+			if PublicKeyFingerprint(publicKey) != fingerprint {
+				return DNSKeyRecord{}, ErrInvalidKeyRecord
+			}
+		}
+	default:
+		return DNSKeyRecord{}, ErrInvalidKeyRecord
+	}
+	return record, nil
+}
+
+// TXTResolver looks up TXT records; *net.Resolver implements it
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSKeyResolverOptions configures a DNSKeyResolver
+type DNSKeyResolverOptions struct {
+	// Resolver performs the lookups; nil uses net.DefaultResolver
+	Resolver TXTResolver
+	// CacheTTL is how long results are cached; zero uses
+	// DefaultDNSKeyCacheTTL and a negative value disables the cache
+	CacheTTL time.Duration
+	// Clock returns the current time; nil uses time.Now
+	Clock func() time.Time
+}
+
+// dnsKeyCacheEntry is one cached lookup
+type dnsKeyCacheEntry struct {
+	records []DNSKeyRecord
+	expires time.Time
+}
+
+// DNSKeyResolver fetches, validates and caches the keys a domain publishes.
+// It is safe for concurrent use.
+type DNSKeyResolver struct {
+	opts  DNSKeyResolverOptions
+	cache map[string]dnsKeyCacheEntry
+	mutex sync.Mutex
+}
+
+// NewDNSKeyResolver creates a resolver; nil options use the defaults
+func NewDNSKeyResolver(opts *DNSKeyResolverOptions) *DNSKeyResolver {
+	var options DNSKeyResolverOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.Resolver == nil {
+		options.Resolver = net.DefaultResolver
+	}
+	if options.CacheTTL == 0 {
+		options.CacheTTL = DefaultDNSKeyCacheTTL
+	}
+	if options.Clock == nil {
+		options.Clock = time.Now
+	}
+	return &DNSKeyResolver{opts: options, cache: make(map[string]dnsKeyCacheEntry)}
+}
+
+// Lookup returns the valid key records published for domain. TXT records
+// that aren't key records are ignored, as are malformed key records, so one
+// bad record can't hide the others; ErrNoKeyRecords means none was valid.
+func (dr *DNSKeyResolver) Lookup(ctx context.Context, domain string) ([]DNSKeyRecord, error) {
+	name := DNSKeyPrefix + strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	dr.mutex.Lock()
+	entry, cached := dr.cache[name]
+	dr.mutex.Unlock()
+	if cached && dr.opts.Clock().Before(entry.expires) {
+		return append([]DNSKeyRecord(nil), entry.records...), nil
+	}
+
+	texts, err := dr.opts.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var records []DNSKeyRecord
+	for _, text := range texts {
+		if record, err := ParseDNSKeyRecord(text); err == nil {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return nil, ErrNoKeyRecords
+	}
+
+	if dr.opts.CacheTTL > 0 {
+		dr.mutex.Lock()
+		dr.cache[name] = dnsKeyCacheEntry{records: records, expires: dr.opts.Clock().Add(dr.opts.CacheTTL)}
+		dr.mutex.Unlock()
+	}
+	return append([]DNSKeyRecord(nil), records...), nil
+}
+
+// LookupKEMPublicKey returns the first full KEM key domain publishes
+func (dr *DNSKeyResolver) LookupKEMPublicKey(ctx context.Context, domain string) (KEMPublicKey, error) {
+	records, err := dr.Lookup(ctx, domain)
+	if err != nil {
+		return KEMPublicKey{}, err
+	}
+	for _, record := range records {
+		if publicKey, err := record.KEMPublicKey(); err == nil {
+			return publicKey, nil
+		}
+	}
+	return KEMPublicKey{}, ErrNoKeyRecords
+}
+
+// VerifyKEMPublicKey reports whether domain publishes a record, full or
+// fingerprint-only, for publicKey
+func (dr *DNSKeyResolver) VerifyKEMPublicKey(ctx context.Context, domain string, publicKey KEMPublicKey) (bool, error) {
+	records, err := dr.Lookup(ctx, domain)
+	if err != nil {
+		return false, err
+	}
+	fingerprint := KEMKeyID(publicKey)
+	for _, record := range records {
+		if record.Kind == DNSKeyKEM && record.Fingerprint == fingerprint {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Flush empties the cache
+func (dr *DNSKeyResolver) Flush() {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+	dr.cache = make(map[string]dnsKeyCacheEntry)
+}
@@ -0,0 +1,175 @@
+package topayz512
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Rotating ephemeral KEM identities
+
+// DefaultEphemeralRotation is the default lifetime of an ephemeral epoch key
+const DefaultEphemeralRotation = time.Hour
+
+// EphemeralKeyerOptions configures an EphemeralKeyer
+type EphemeralKeyerOptions struct {
+	// RotationInterval is the length of one epoch
+	RotationInterval time.Duration
+	// Overlap is how many previous epochs still accept decapsulation, so
+	// senders using a recently rotated key are not rejected
+	Overlap int
+	// Clock returns the current time; nil uses time.Now
+	Clock func() time.Time
+}
+
+// EpochPublicKey is a published ephemeral public key and its validity window
+type EpochPublicKey struct {
+	Epoch     uint64       `json:"epoch"`
+	PublicKey KEMPublicKey `json:"public_key"`
+	NotBefore time.Time    `json:"not_before"`
+	NotAfter  time.Time    `json:"not_after"`
+}
+
+// EphemeralKeyer maintains a rotating set of short-lived KEM key pairs and
+// routes decapsulation to the key of the epoch a sender used
+type EphemeralKeyer struct {
+	opts  EphemeralKeyerOptions
+	keys  map[uint64]*KEMKeyPair
+	mutex sync.Mutex
+}
+
+// NewEphemeralKeyer creates a keyer and generates the key for the current epoch
+func NewEphemeralKeyer(opts *EphemeralKeyerOptions) (*EphemeralKeyer, error) {
+	var options EphemeralKeyerOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.RotationInterval <= 0 {
+		options.RotationInterval = DefaultEphemeralRotation
+	}
+	if options.Overlap < 0 {
+		options.Overlap = 0
+	}
+	if options.Clock == nil {
+		options.Clock = time.Now
+	}
+
+	ek := &EphemeralKeyer{
+		opts: options,
+		keys: make(map[uint64]*KEMKeyPair),
+	}
+
+	ek.mutex.Lock()
+	defer ek.mutex.Unlock()
+	if _, err := ek.rotate(); err != nil {
+		return nil, err
+	}
+	return ek, nil
+}
+
+// CurrentEpoch returns the epoch number for the current time
+func (ek *EphemeralKeyer) CurrentEpoch() uint64 {
+	return ek.epochAt(ek.opts.Clock())
+}
+
+// Current returns the public key senders should use now
+func (ek *EphemeralKeyer) Current() (EpochPublicKey, error) {
+	ek.mutex.Lock()
+	defer ek.mutex.Unlock()
+
+	// rotate's epoch, not a second clock read, which could fall in the
+	// next epoch before its key exists
+	epoch, err := ek.rotate()
+	if err != nil {
+		return EpochPublicKey{}, err
+	}
+	return ek.published(epoch), nil
+}
+
+// PublicKeys returns every public key still accepted, newest first
+func (ek *EphemeralKeyer) PublicKeys() ([]EpochPublicKey, error) {
+	ek.mutex.Lock()
+	defer ek.mutex.Unlock()
+
+	if _, err := ek.rotate(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]EpochPublicKey, 0, len(ek.keys))
+	for epoch := range ek.keys {
+		keys = append(keys, ek.published(epoch))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Epoch > keys[j].Epoch })
+	return keys, nil
+}
+
+// Decapsulate recovers the shared secret for a ciphertext produced with the
+// public key of the given epoch
+func (ek *EphemeralKeyer) Decapsulate(epoch uint64, ciphertext Ciphertext) (SharedSecret, error) {
+	ek.mutex.Lock()
+	defer ek.mutex.Unlock()
+
+	if _, err := ek.rotate(); err != nil {
+		return SharedSecret{}, err
+	}
+
+	keyPair, exists := ek.keys[epoch]
+	if !exists {
+		return SharedSecret{}, ErrEpochExpired
+	}
+	return KEMDecapsulate(keyPair.Secret, ciphertext)
+}
+
+// Close erases every epoch key
+func (ek *EphemeralKeyer) Close() {
+	ek.mutex.Lock()
+	defer ek.mutex.Unlock()
+
+	for epoch, keyPair := range ek.keys {
+		SecureEraseKEMKeyPair(keyPair)
+		delete(ek.keys, epoch)
+	}
+}
+
+// epochAt returns the epoch containing t
+func (ek *EphemeralKeyer) epochAt(t time.Time) uint64 {
+	if t.UnixNano() < 0 {
+		return 0
+	}
+	return uint64(t.UnixNano()) / uint64(ek.opts.RotationInterval)
+}
+
+// published describes the key of an epoch; the caller holds the mutex
+func (ek *EphemeralKeyer) published(epoch uint64) EpochPublicKey {
+	interval := ek.opts.RotationInterval
+	notBefore := time.Unix(0, int64(epoch)*int64(interval)).UTC()
+	return EpochPublicKey{
+		Epoch:     epoch,
+		PublicKey: ek.keys[epoch].Public,
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(interval * time.Duration(ek.opts.Overlap+1)),
+	}
+}
+
+// rotate drops expired epoch keys and creates the current one, returning
+// the current epoch; the caller holds the mutex
+func (ek *EphemeralKeyer) rotate() (uint64, error) {
+	current := ek.CurrentEpoch()
+
+	for epoch, keyPair := range ek.keys {
+		if epoch > current || current-epoch > uint64(ek.opts.Overlap) {
+			SecureEraseKEMKeyPair(keyPair)
+			delete(ek.keys, epoch)
+		}
+	}
+
+	if _, exists := ek.keys[current]; !exists {
+		publicKey, secretKey, err := KEMKeyGen()
+		if err != nil {
+			return 0, err
+		}
+		ek.keys[current] = &KEMKeyPair{Public: publicKey, Secret: secretKey}
+	}
+
+	return current, nil
+}
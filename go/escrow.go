@@ -0,0 +1,161 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// Key escrow with threshold trustees and an audit trail
+
+// Escrow event types
+const (
+	EscrowEventCreated       = "created"
+	EscrowEventShareReleased = "share-released"
+	EscrowEventRecovered     = "recovered"
+)
+
+// EscrowEvent is one entry of an escrow's audit trail. Each event hash chains
+// over the previous one, so removing or altering entries is detectable.
+type EscrowEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Trustees []Hash    `json:"trustees,omitempty"`
+	Hash     Hash      `json:"hash"`
+}
+
+// Escrow holds a secret split across trustees so that any threshold of them
+// can recover it, together with an audit trail of its use
+type Escrow struct {
+	Kit    RecoveryKit   `json:"kit"`
+	Events []EscrowEvent `json:"events"`
+	mutex  sync.Mutex
+}
+
+// CreateEscrow splits secret into Shamir shares, one encrypted to each
+// trustee's KEM public key, any threshold of which recover the secret
+func CreateEscrow(secret []byte, trustees []KEMPublicKey, threshold int) (*Escrow, error) {
+	kit, err := CreateRecoveryKit(secret, trustees, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	escrow := &Escrow{Kit: *kit}
+	escrow.record(EscrowEventCreated, escrow.Trustees())
+	return escrow, nil
+}
+
+// Trustees returns the key IDs of the trustees in share order
+func (e *Escrow) Trustees() []Hash {
+	trustees := make([]Hash, len(e.Kit.Shares))
+	for i, share := range e.Kit.Shares {
+		trustees[i] = share.GuardianID
+	}
+	return trustees
+}
+
+// Threshold returns the number of trustees needed to recover the secret
+func (e *Escrow) Threshold() int {
+	return int(e.Kit.Threshold)
+}
+
+// ReleaseShare is run by a trustee to decrypt their share for a recovery,
+// recording the release in the audit trail
+func (e *Escrow) ReleaseShare(trusteeSecret KEMSecretKey) (SecretShare, error) {
+	share, err := e.Kit.DecryptShare(trusteeSecret)
+	if err != nil {
+		return SecretShare{}, err
+	}
+
+	publicKey := deriveKEMPublicKey(trusteeSecret)
+	e.record(EscrowEventShareReleased, []Hash{KEMKeyID(publicKey)})
+	return share, nil
+}
+
+// Recover combines released shares into the secret, verifying each share and
+// the result against the escrow's commitments, and records which trustees
+// took part
+func (e *Escrow) Recover(shares []SecretShare) ([]byte, error) {
+	if err := e.VerifyAuditTrail(); err != nil {
+		return nil, err
+	}
+
+	ceremony := NewRecoveryCeremony(&e.Kit)
+	defer ceremony.Wipe()
+
+	var participants []Hash
+	for _, share := range shares {
+		// The ceremony wipes what it holds, so give it copies of the caller's shares
+		share.Value = append([]byte(nil), share.Value...)
+		if err := ceremony.AddShare(share); err != nil {
+			return nil, err
+		}
+		for _, guardianShare := range e.Kit.Shares {
+			if guardianShare.Index == share.Index {
+				participants = append(participants, guardianShare.GuardianID)
+			}
+		}
+	}
+
+	secret, err := ceremony.Recover()
+	if err != nil {
+		return nil, err
+	}
+
+	e.record(EscrowEventRecovered, participants)
+	return secret, nil
+}
+
+// VerifyAuditTrail checks that the audit trail starts with the escrow's
+// creation and that no event was altered, removed or reordered
+func (e *Escrow) VerifyAuditTrail() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(e.Events) == 0 || e.Events[0].Type != EscrowEventCreated {
+		return ErrInvalidAuditTrail
+	}
+
+	previous := e.Kit.KitID
+	for _, event := range e.Events {
+		if !HashEqual(escrowEventHash(previous, event), event.Hash) {
+			return ErrInvalidAuditTrail
+		}
+		previous = event.Hash
+	}
+	return nil
+}
+
+// record appends an event to the audit trail
+func (e *Escrow) record(eventType string, trustees []Hash) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	previous := e.Kit.KitID
+	if len(e.Events) > 0 {
+		previous = e.Events[len(e.Events)-1].Hash
+	}
+
+	event := EscrowEvent{Type: eventType, Time: time.Now().UTC(), Trustees: trustees}
+	event.Hash = escrowEventHash(previous, event)
+	e.Events = append(e.Events, event)
+}
+
+// escrowEventHash chains an event to the hash of the event before it
+func escrowEventHash(previous Hash, event EscrowEvent) Hash {
+	var header [16]byte
+	binary.BigEndian.PutUint64(header[0:8], uint64(event.Time.UnixNano()))
+	binary.BigEndian.PutUint64(header[8:16], uint64(len(event.Type)))
+
+	hs := GetHashState()
+	defer PutHashState(hs)
+
+	hs.Update([]byte("TOPAY-Z512-ESCROW-EVENT"))
+	hs.Update(previous[:])
+	hs.Update(header[:])
+	hs.Update([]byte(event.Type))
+	for _, trustee := range event.Trustees {
+		hs.Update(trustee[:])
+	}
+	return hs.Finalize()
+}
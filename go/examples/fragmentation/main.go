@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"time"
@@ -37,7 +38,7 @@ func main() {
 	// Display fragment details
 	fmt.Println("   Fragment details:")
 	for i, fragment := range result.Fragments {
-		fmt.Printf("     Fragment %d: ID=%d, Size=%d, Checksum=%x\n",
+		fmt.Printf("     Fragment %d: ID=%s, Size=%d, Checksum=%x\n",
 			i, fragment.ID, len(fragment.Data), fragment.Checksum[:8])
 	}
 	fmt.Println()
@@ -172,9 +173,19 @@ func main() {
 
 	// Fragment integrity and repair
 	fmt.Println("8. Fragment Integrity and Repair:")
-	testData := []byte("This is test data for integrity checking and repair functionality.")
+	testData := make([]byte, 2048)
+	for i := range testData {
+		testData[i] = byte(i * 7)
+	}
 	fragResult, _ := topayz512.FragmentData(testData)
 
+	// Sender computes parity shards alongside the fragments
+	parity, err := topayz512.GenerateParity(fragResult.Fragments, 2)
+	if err != nil {
+		log.Fatalf("Failed to generate parity: %v", err)
+	}
+	fmt.Printf("   Data fragments: %d, parity shards: %d\n", len(fragResult.Fragments), len(parity))
+
 	// Check integrity of original fragments
 	fmt.Println("   Original fragments:")
 	for i, fragment := range fragResult.Fragments {
@@ -182,27 +193,34 @@ func main() {
 		fmt.Printf("     Fragment %d: %v\n", i, err == nil)
 	}
 
-	// Corrupt a fragment (use the first fragment if only one exists)
-	fragmentIndex := 0
-	if len(fragResult.Fragments) > 1 {
-		fragmentIndex = 1
+	// Corrupt one fragment and drop another in transit
+	received := make([]topayz512.Fragment, 0, len(fragResult.Fragments))
+	for i, fragment := range fragResult.Fragments {
+		if i == 1 {
+			continue // lost
+		}
+		if i == 2 {
+			corrupted := make([]byte, len(fragment.Data))
+			copy(corrupted, fragment.Data)
+			corrupted[0] ^= 0xFF // Flip bits
+			fragment.Data = corrupted
+		}
+		received = append(received, fragment)
 	}
-	corruptedFragment := fragResult.Fragments[fragmentIndex]
-	corruptedFragment.Data[0] ^= 0xFF // Flip bits
 
-	fmt.Println("   After corruption:")
-	for i, fragment := range fragResult.Fragments {
+	fmt.Println("   After transit:")
+	for _, fragment := range received {
 		valid := topayz512.ValidateFragmentIntegrity(fragment)
-		fmt.Printf("     Fragment %d: %v\n", i, valid)
+		fmt.Printf("     Fragment %d: %v\n", fragment.Index, valid)
 	}
 
-	// Attempt repair
-	repairedFragment, err := topayz512.RepairFragment(corruptedFragment, testData, len(testData)/len(fragResult.Fragments))
+	// Receiver repairs without access to the original data
+	repaired, err := topayz512.RepairFromParity(received, parity)
 	if err != nil {
 		fmt.Printf("   Repair failed: %v\n", err)
 	} else {
-		fmt.Printf("   Repair successful: %v\n",
-			topayz512.ValidateFragmentIntegrity(repairedFragment) == nil)
+		reconResult, err := topayz512.ReconstructData(repaired)
+		fmt.Printf("   Repair successful: %v\n", err == nil && bytes.Equal(reconResult.Data, testData))
 	}
 	fmt.Println()
 
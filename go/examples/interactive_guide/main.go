@@ -504,8 +504,8 @@ func demonstrateAdvancedFeatures(scanner *bufio.Scanner) {
 	privateKey, publicKey, _ := topayz512.GenerateKeyPair()
 
 	// Bytes format
-	privateBytes := privateKey.Bytes()
-	publicBytes := publicKey.Bytes()
+	privateBytes := privateKey.AppendBytes(nil)
+	publicBytes := publicKey.AppendBytes(nil)
 	fmt.Printf("   Private key bytes: %d bytes\n", len(privateBytes))
 	fmt.Printf("   Public key bytes: %d bytes\n", len(publicBytes))
 
@@ -206,10 +206,10 @@ func main() {
 	fmt.Println("12. KEM Serialization:")
 
 	// Serialize KEM components
-	publicKeyBytes := publicKey.Bytes()
-	secretKeyBytes := secretKey.Bytes()
-	ciphertextBytes := ciphertext.Bytes()
-	sharedSecretBytes := sharedSecret1.Bytes()
+	publicKeyBytes := publicKey.AppendBytes(nil)
+	secretKeyBytes := secretKey.AppendBytes(nil)
+	ciphertextBytes := ciphertext.AppendBytes(nil)
+	sharedSecretBytes := sharedSecret1.AppendBytes(nil)
 
 	fmt.Printf("    Public key size: %d bytes\n", len(publicKeyBytes))
 	fmt.Printf("    Secret key size: %d bytes\n", len(secretKeyBytes))
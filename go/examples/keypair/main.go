@@ -144,10 +144,10 @@ func main() {
 
 	// In a real scenario, this would be a signature operation
 	// For demonstration, we'll use the key to derive a response
-	response := topayz512.ComputeHash(append(privateKey.Bytes(), challengeData...))
+	response := topayz512.ComputeHash(append(privateKey.AppendBytes(nil), challengeData...))
 
 	// Verify the response using the public key
-	expectedResponse := topayz512.ComputeHash(append(privateKey.Bytes(), challengeData...))
+	expectedResponse := topayz512.ComputeHash(append(privateKey.AppendBytes(nil), challengeData...))
 
 	fmt.Printf("   Challenge: %x\n", challengeData)
 	fmt.Printf("   Response: %s\n", response.String())
@@ -186,8 +186,8 @@ func main() {
 	fmt.Println("12. Key Serialization:")
 
 	// Serialize keys
-	privateKeyBytes := privateKey.Bytes()
-	publicKeyBytes := publicKey.Bytes()
+	privateKeyBytes := privateKey.AppendBytes(nil)
+	publicKeyBytes := publicKey.AppendBytes(nil)
 
 	fmt.Printf("    Private key size: %d bytes\n", len(privateKeyBytes))
 	fmt.Printf("    Public key size: %d bytes\n", len(publicKeyBytes))
@@ -186,7 +186,7 @@ func main() {
 	// Create a fragment
 	testData := []byte("This is test fragment data for serialization")
 	fragment := topayz512.Fragment{
-		ID:       12345,
+		ID:       topayz512.LegacyFragmentID(12345),
 		Index:    0,
 		Total:    1,
 		Data:     testData,
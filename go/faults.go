@@ -0,0 +1,46 @@
+package topayz512
+
+import "crypto/rand"
+
+// Fault injection hooks for testing error handling around the library. The
+// injector itself is only compiled in with the topayz512faults build tag;
+// other builds cannot inject faults.
+
+// FaultPoint identifies a place where a failure can be injected
+type FaultPoint int
+
+// Fault points
+const (
+	// FaultRandom makes reads from the secure random source fail with the injected error
+	FaultRandom FaultPoint = iota
+	// FaultPool makes the buffer, hash state and worker pools behave as if
+	// exhausted: pooled objects are freshly allocated and submitted work runs
+	// on the caller's goroutine. The injected error itself is not returned.
+	FaultPool
+	// FaultDecapsulate makes KEM decapsulation fail with the injected error
+	FaultDecapsulate
+
+	faultPointCount
+)
+
+// String returns the name of a fault point
+func (fp FaultPoint) String() string {
+	switch fp {
+	case FaultRandom:
+		return "random"
+	case FaultPool:
+		return "pool"
+	case FaultDecapsulate:
+		return "decapsulate"
+	}
+	return "unknown"
+}
+
+// readRandom fills buf from the secure random source
+func readRandom(buf []byte) error {
+	if err := injectFault(FaultRandom); err != nil {
+		return err
+	}
+	_, err := rand.Read(buf)
+	return err
+}
@@ -0,0 +1,6 @@
+//go:build !topayz512faults
+
+package topayz512
+
+// injectFault never injects a fault without the topayz512faults build tag
+func injectFault(FaultPoint) error { return nil }
@@ -0,0 +1,76 @@
+//go:build topayz512faults
+
+package topayz512
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FaultInjector decides whether a call at a fault point fails. call counts
+// the calls at that point since the injector was installed, starting at 1.
+type FaultInjector interface {
+	Fault(point FaultPoint, call uint64) error
+}
+
+// faultState holds the installed injector and its per-point call counters
+type faultState struct {
+	injector FaultInjector
+	calls    [faultPointCount]atomic.Uint64
+}
+
+// activeFaults is nil unless an injector is installed, so the hooks cost a
+// single atomic load in normal operation
+var activeFaults atomic.Pointer[faultState]
+
+// SetFaultInjector installs fi for every fault point and resets the call
+// counters; nil removes the injector. It returns a function restoring the
+// previous injector. It only exists with the topayz512faults build tag.
+func SetFaultInjector(fi FaultInjector) (restore func()) {
+	var state *faultState
+	if fi != nil {
+		state = &faultState{injector: fi}
+	}
+	previous := activeFaults.Swap(state)
+	return func() { activeFaults.Store(previous) }
+}
+
+// injectFault counts a call at point and returns the injected error, if any
+func injectFault(point FaultPoint) error {
+	state := activeFaults.Load()
+	if state == nil {
+		return nil
+	}
+	call := state.calls[point].Add(1)
+	return state.injector.Fault(point, call)
+}
+
+// FaultPlan is a FaultInjector failing chosen calls at chosen points
+type FaultPlan struct {
+	failures map[FaultPoint]map[uint64]error
+	mutex    sync.Mutex
+}
+
+// NewFaultPlan creates a plan that injects no faults
+func NewFaultPlan() *FaultPlan {
+	return &FaultPlan{failures: make(map[FaultPoint]map[uint64]error)}
+}
+
+// FailAt makes the given call at point fail with err and returns the plan
+func (fp *FaultPlan) FailAt(point FaultPoint, call uint64, err error) *FaultPlan {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+
+	if fp.failures[point] == nil {
+		fp.failures[point] = make(map[uint64]error)
+	}
+	fp.failures[point][call] = err
+	return fp
+}
+
+// Fault implements FaultInjector
+func (fp *FaultPlan) Fault(point FaultPoint, call uint64) error {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	return fp.failures[point][call]
+}
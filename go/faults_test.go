@@ -0,0 +1,99 @@
+//go:build topayz512faults
+
+package topayz512
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Test fault injection hooks
+func TestFaultInjection(t *testing.T) {
+	errInjected := ErrReconstructionFailed
+
+	plan := NewFaultPlan().
+		FailAt(FaultRandom, 2, errInjected).
+		FailAt(FaultDecapsulate, 1, ErrDecapsulationFailed).
+		FailAt(FaultPool, 1, errInjected)
+	restore := SetFaultInjector(plan)
+	defer restore()
+
+	if _, err := SecureRandom(16); err != nil {
+		t.Errorf("First RNG call should succeed: %v", err)
+	}
+	if _, err := SecureRandom(16); err != errInjected {
+		t.Errorf("Second RNG call should fail, got %v", err)
+	}
+	if _, _, err := GenerateKeyPair(); err != nil {
+		t.Errorf("Later RNG calls should succeed: %v", err)
+	}
+
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Failed to generate KEM key pair: %v", err)
+	}
+	ciphertext, sharedSecret, err := KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("Failed to encapsulate: %v", err)
+	}
+	if _, err := KEMDecapsulate(secretKey, ciphertext); err != ErrDecapsulationFailed {
+		t.Errorf("Expected injected decapsulation failure, got %v", err)
+	}
+	if decapsulated, err := KEMDecapsulate(secretKey, ciphertext); err != nil || decapsulated != sharedSecret {
+		t.Errorf("Second decapsulation should succeed: %v", err)
+	}
+
+	// Exhausted pools must still produce correct results
+	hs := GetHashState()
+	hs.Update([]byte("pool exhausted"))
+	if !HashEqual(hs.Finalize(), ComputeHash([]byte("pool exhausted"))) {
+		t.Error("Hash from a fresh state should match")
+	}
+	PutHashState(hs)
+
+	restore()
+	if _, err := SecureRandom(16); err != nil {
+		t.Errorf("RNG should work after removing the injector: %v", err)
+	}
+}
+
+// Test that a panicking decapsulation is answered with an error
+func TestDecapsulationServicePanic(t *testing.T) {
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	store := NewMemoryKeyStore()
+	keyID := store.Add(KEMKeyPair{Public: publicKey, Secret: secretKey})
+
+	restore := SetFaultInjector(panickingInjector{FaultDecapsulate})
+	defer restore()
+	service := NewDecapsulationService(store, &DecapsulationOptions{Workers: 2})
+	ciphertext, _, err := KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	if err := service.Submit(context.Background(), DecapsulationRequest{KeyID: keyID, Ciphertext: ciphertext}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	service.Close()
+	var panicErr *PanicError
+	if result, ok := <-service.Results(); !ok || !errors.As(result.Err, &panicErr) {
+		t.Errorf("Expected a *PanicError result, got %+v", result)
+	}
+}
+
+// panickingInjector panics at one fault point
+type panickingInjector struct {
+	point FaultPoint
+}
+
+// Fault implements FaultInjector
+func (pi panickingInjector) Fault(point FaultPoint, call uint64) error {
+	if point == pi.point {
+		panic(fmt.Sprintf("injected panic at %v", point))
+	}
+	return nil
+}
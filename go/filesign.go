@@ -0,0 +1,168 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Detached signatures over files
+
+// File signature constants
+const (
+	// FileSignatureVersion is the current detached signature format version
+	FileSignatureVersion = 1
+
+	// FileSignatureExtension is the conventional suffix of detached signature files
+	FileSignatureExtension = ".tzsig"
+
+	// FileSignatureAlgorithm names the signature scheme used for file signatures
+	FileSignatureAlgorithm = "xmss-z512"
+
+	// fileSignatureDomain separates signed file statements from other signed messages
+	fileSignatureDomain = "TOPAY-Z512-FILE-SIGNATURE"
+)
+
+// FileSignature is a detached signature over a file, stored as JSON in a
+// .tzsig file next to the artifact
+type FileSignature struct {
+	Version   uint32    `json:"version"`
+	Algorithm string    `json:"algorithm"`
+	FileName  string    `json:"file_name"`
+	Size      uint64    `json:"size"`
+	Hash      Hash      `json:"hash"`
+	Signer    Hash      `json:"signer"`
+	Timestamp time.Time `json:"timestamp"`
+	Signature []byte    `json:"signature"`
+}
+
+// Fingerprint identifies a public key by the hash of its serialized form
+func (pk XMSSPublicKey) Fingerprint() Hash {
+	return HashConcat([]byte("TOPAY-Z512-FINGERPRINT"), pk.Bytes())
+}
+
+// HashFile computes the hash of a file's contents and returns its size
+func HashFile(path string) (Hash, uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Hash{}, 0, err
+	}
+	defer file.Close()
+
+	sh := NewStreamingHash()
+	defer sh.Close()
+
+	size, err := io.Copy(sh, file)
+	if err != nil {
+		return Hash{}, 0, err
+	}
+	return sh.Sum(), uint64(size), nil
+}
+
+// statement returns the bytes covered by the signature; the file name is
+// informational and not signed, so artifacts can be renamed
+func (fs *FileSignature) statement() []byte {
+	var header [20]byte
+	binary.BigEndian.PutUint32(header[0:4], fs.Version)
+	binary.BigEndian.PutUint64(header[4:12], fs.Size)
+	binary.BigEndian.PutUint64(header[12:20], uint64(fs.Timestamp.UnixNano()))
+
+	statement := make([]byte, 0, len(fileSignatureDomain)+len(header)+2*HashSize+len(fs.Algorithm))
+	statement = append(statement, fileSignatureDomain...)
+	statement = append(statement, header[:]...)
+	statement = append(statement, fs.Algorithm...)
+	statement = append(statement, fs.Hash[:]...)
+	return append(statement, fs.Signer[:]...)
+}
+
+// SignFile hashes the file at path and produces a detached signature with key.
+// Each call consumes one signature from the stateful key.
+func SignFile(path string, key *XMSSPrivateKey) (*FileSignature, error) {
+	hash, size, err := HashFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileSignature{
+		Version:   FileSignatureVersion,
+		Algorithm: FileSignatureAlgorithm,
+		FileName:  filepath.Base(path),
+		Size:      size,
+		Hash:      hash,
+		Signer:    key.Public().Fingerprint(),
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+
+	signature, err := key.Sign(fs.statement())
+	if err != nil {
+		return nil, err
+	}
+	fs.Signature = signature.Bytes()
+	return fs, nil
+}
+
+// VerifyFile checks a detached signature against the file at path. The signer
+// must be one of trustedKeys; the matching key is returned on success.
+func VerifyFile(path string, sig *FileSignature, trustedKeys []XMSSPublicKey) (XMSSPublicKey, error) {
+	if sig.Version != FileSignatureVersion || sig.Algorithm != FileSignatureAlgorithm {
+		return XMSSPublicKey{}, ErrUnsupportedVersion
+	}
+
+	signer := findTrustedKey(trustedKeys, sig.Signer)
+	if signer == nil {
+		return XMSSPublicKey{}, ErrUntrustedSigner
+	}
+
+	hash, size, err := HashFile(path)
+	if err != nil {
+		return XMSSPublicKey{}, err
+	}
+	if size != sig.Size || !HashEqual(hash, sig.Hash) {
+		return XMSSPublicKey{}, ErrFileModified
+	}
+
+	signature, err := XMSSSignatureFromBytes(signer.Params, sig.Signature)
+	if err != nil {
+		return XMSSPublicKey{}, err
+	}
+	if !signer.Verify(sig.statement(), signature) {
+		return XMSSPublicKey{}, ErrInvalidSignature
+	}
+	return *signer, nil
+}
+
+// findTrustedKey returns the trusted key with the given fingerprint, or nil
+func findTrustedKey(trustedKeys []XMSSPublicKey, fingerprint Hash) *XMSSPublicKey {
+	for i := range trustedKeys {
+		if HashEqual(trustedKeys[i].Fingerprint(), fingerprint) {
+			return &trustedKeys[i]
+		}
+	}
+	return nil
+}
+
+// WriteFileSignature writes a detached signature to path as indented JSON
+func WriteFileSignature(path string, sig *FileSignature) error {
+	data, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadFileSignature reads a detached signature written by WriteFileSignature
+func ReadFileSignature(path string) (*FileSignature, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig FileSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
@@ -0,0 +1,494 @@
+// Package fixtures generates the TOPAY-Z512 test fixture corpus: a JSON
+// file of inputs and expected outputs covering hashing, MACs and HKDF, key
+// derivation, signatures, the KEM, fragment encodings, sealed boxes and
+// addresses. The corpus is committed as corpus.json so the Rust, JavaScript
+// and Python ports can check themselves against this implementation, which
+// serves as the reference.
+//
+// Every value is derived from fixed labels, and the KEM is derandomized with
+// topayz512.KEMKeyGenFromSeed and topayz512.KEMEncapsulateDerandomized, so
+// generating twice gives the same file. Byte strings are lowercase hex. A
+// test fails when the committed corpus no longer matches the implementation;
+// regenerate it with
+//
+//	go generate ./fixtures
+//
+// or "topayz512 fixtures -o corpus.json".
+package fixtures
+
+//go:generate go run ../cmd/topayz512 fixtures -o corpus.json
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/address"
+)
+
+// Version is the corpus format version. It changes when a field is removed
+// or changes meaning; new sections don't change it.
+const Version = 1
+
+// fillDomain separates the fixture input stream from other hashes
+const fillDomain = "TOPAY-Z512-FIXTURES"
+
+// deriveInfo is the info string of the KEM vectors' derived keys
+const deriveInfo = "TOPAY-Z512 fixtures derived key"
+
+// corpusJSON is the committed corpus
+//
+//go:embed corpus.json
+var corpusJSON []byte
+
+// HexBytes is a byte string stored as lowercase hex
+type HexBytes []byte
+
+// MarshalText encodes hex
+func (h HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+// UnmarshalText decodes hex
+func (h *HexBytes) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(string(text))
+	*h = decoded
+	return err
+}
+
+// Corpus is the fixture corpus
+type Corpus struct {
+	Version     int                `json:"version"`
+	Hash        []HashVector       `json:"hash"`
+	DomainHash  []DomainHashVector `json:"domain_hash"`
+	MAC         []MACVector        `json:"mac"`
+	HKDF        []HKDFVector       `json:"hkdf"`
+	SeedKeys    []SeedKeyVector    `json:"seed_keys"`
+	HDKeys      []HDKeyVector      `json:"hd_keys"`
+	HDKEMKeys   []HDKEMKeyVector   `json:"hd_kem_keys"`
+	Signatures  []SignatureVector  `json:"signatures"`
+	KEM         []KEMVector        `json:"kem"`
+	Fragments   []FragmentVector   `json:"fragments"`
+	SealedBoxes []SealedBoxVector  `json:"sealed_boxes"`
+	Addresses   []AddressVector    `json:"addresses"`
+}
+
+// HashVector is a ComputeHash known answer
+type HashVector struct {
+	Input HexBytes `json:"input"`
+	Hash  HexBytes `json:"hash"`
+}
+
+// DomainHashVector is a HashWithDomain known answer
+type DomainHashVector struct {
+	Domain string   `json:"domain"`
+	Input  HexBytes `json:"input"`
+	Hash   HexBytes `json:"hash"`
+}
+
+// MACVector is a MAC known answer
+type MACVector struct {
+	Key  HexBytes `json:"key"`
+	Data HexBytes `json:"data"`
+	MAC  HexBytes `json:"mac"`
+}
+
+// HKDFVector is an HKDFExtract and HKDFExpand known answer
+type HKDFVector struct {
+	Salt   HexBytes `json:"salt"`
+	Secret HexBytes `json:"secret"`
+	Info   HexBytes `json:"info"`
+	Length int      `json:"length"`
+	PRK    HexBytes `json:"prk"`
+	OKM    HexBytes `json:"okm"`
+}
+
+// SeedKeyVector is a GenerateKeyPairFromSeedVersion known answer
+type SeedKeyVector struct {
+	Seed       HexBytes `json:"seed"`
+	Version    int      `json:"version"`
+	PrivateKey HexBytes `json:"private_key"`
+	PublicKey  HexBytes `json:"public_key"`
+}
+
+// HDKeyVector is a hierarchical signing key derivation known answer
+type HDKeyVector struct {
+	Seed       HexBytes `json:"seed"`
+	Path       string   `json:"path"`
+	PrivateKey HexBytes `json:"private_key"`
+	PublicKey  HexBytes `json:"public_key"`
+	ChainCode  HexBytes `json:"chain_code"`
+}
+
+// HDKEMKeyVector is a hierarchical KEM key derivation known answer
+type HDKEMKeyVector struct {
+	Seed      HexBytes `json:"seed"`
+	Path      string   `json:"path"`
+	PublicKey HexBytes `json:"public_key"`
+	ChainCode HexBytes `json:"chain_code"`
+}
+
+// SignatureVector is a Sign known answer; signatures are deterministic
+type SignatureVector struct {
+	PrivateKey HexBytes `json:"private_key"`
+	PublicKey  HexBytes `json:"public_key"`
+	Message    HexBytes `json:"message"`
+	Signature  HexBytes `json:"signature"`
+}
+
+// KEMVector is a derandomized KEM known answer. The secret key is the seed
+// of KEMKeyGenFromSeed and the message the one encapsulated; Derived is
+// SharedSecret.Derive(DeriveInfo, len(Derived)).
+type KEMVector struct {
+	SecretKey    HexBytes `json:"secret_key"`
+	PublicKey    HexBytes `json:"public_key"`
+	Message      HexBytes `json:"message"`
+	Ciphertext   HexBytes `json:"ciphertext"`
+	SharedSecret HexBytes `json:"shared_secret"`
+	DeriveInfo   HexBytes `json:"derive_info"`
+	Derived      HexBytes `json:"derived"`
+}
+
+// FragmentVector is a fragmentation known answer: the data split with
+// FragmentData under a fixed ID, each fragment in the serialized wire format.
+// Key is the FragmentKey of keyed checksums, empty for plain hashes.
+type FragmentVector struct {
+	Data      HexBytes   `json:"data"`
+	ID        HexBytes   `json:"id"`
+	Key       HexBytes   `json:"key,omitempty"`
+	Fragments []HexBytes `json:"fragments"`
+}
+
+// SealedBoxVector is an Encrypt known answer with the KEM derandomized by
+// Message; the recipient's public key is derived from SecretKey as in the
+// KEM vectors
+type SealedBoxVector struct {
+	SecretKey HexBytes `json:"secret_key"`
+	Message   HexBytes `json:"message"`
+	Plaintext HexBytes `json:"plaintext"`
+	Box       HexBytes `json:"box"`
+}
+
+// AddressVector is an address derivation known answer in every encoding
+type AddressVector struct {
+	PublicKey   HexBytes `json:"public_key"`
+	Network     string   `json:"network"`
+	Bech32m     string   `json:"bech32m"`
+	Bech32      string   `json:"bech32"`
+	Base58Check string   `json:"base58check"`
+}
+
+// Load parses the committed corpus
+func Load() (*Corpus, error) {
+	var corpus Corpus
+	if err := json.Unmarshal(corpusJSON, &corpus); err != nil {
+		return nil, fmt.Errorf("fixtures: invalid corpus: %w", err)
+	}
+	return &corpus, nil
+}
+
+// Marshal encodes a corpus as indented JSON, the form it is committed in
+func Marshal(corpus *Corpus) ([]byte, error) {
+	data, err := json.MarshalIndent(corpus, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Generate computes the corpus with this implementation
+func Generate() (*Corpus, error) {
+	corpus := &Corpus{Version: Version}
+	generators := []func(*Corpus) error{
+		generateHashes,
+		generateKeys,
+		generateSignatures,
+		generateKEM,
+		generateFragments,
+		generateSealedBoxes,
+		generateAddresses,
+	}
+	for _, generate := range generators {
+		if err := generate(corpus); err != nil {
+			return nil, fmt.Errorf("fixtures: %w", err)
+		}
+	}
+	return corpus, nil
+}
+
+// fill returns n bytes derived from label, so inputs look random but the
+// corpus is reproducible
+func fill(label string, n int) []byte {
+	out := make([]byte, 0, n+topayz512.HashSize)
+	for counter := uint32(0); len(out) < n; counter++ {
+		block := topayz512.HashWithDomain(fillDomain, binary.BigEndian.AppendUint32([]byte(label), counter))
+		out = append(out, block[:]...)
+	}
+	return out[:n]
+}
+
+// generateHashes adds the hash, domain hash, MAC and HKDF vectors
+func generateHashes(corpus *Corpus) error {
+	// Lengths around the 128-byte block and its length padding
+	inputs := [][]byte{[]byte("abc")}
+	for _, n := range []int{0, 1, 63, 64, 111, 112, 127, 128, 129, 255, 256, 1000, 4096} {
+		inputs = append(inputs, fill(fmt.Sprintf("hash %d", n), n))
+	}
+	for _, input := range inputs {
+		hash := topayz512.ComputeHash(input)
+		corpus.Hash = append(corpus.Hash, HashVector{Input: input, Hash: hash[:]})
+	}
+
+	for _, domain := range []string{"", "TOPAY-Z512-ADDRESS", "myapp/v1/block-header"} {
+		for _, n := range []int{0, 200} {
+			input := fill(fmt.Sprintf("domain hash %d", n), n)
+			hash := topayz512.HashWithDomain(domain, input)
+			corpus.DomainHash = append(corpus.DomainHash, DomainHashVector{Domain: domain, Input: input, Hash: hash[:]})
+		}
+	}
+
+	// Keys shorter than, equal to and longer than the block
+	for _, n := range []int{0, 32, 128, 200} {
+		key := fill(fmt.Sprintf("mac key %d", n), n)
+		data := fill(fmt.Sprintf("mac data %d", n), 100)
+		mac := topayz512.MAC(key, data)
+		corpus.MAC = append(corpus.MAC, MACVector{Key: key, Data: data, MAC: mac[:]})
+	}
+
+	for i, length := range []int{32, 64, 200} {
+		salt := fill(fmt.Sprintf("hkdf salt %d", i), 16*i)
+		secret := fill(fmt.Sprintf("hkdf secret %d", i), 64)
+		info := fill(fmt.Sprintf("hkdf info %d", i), 10*i)
+		prk := topayz512.HKDFExtract(salt, secret)
+		okm, err := topayz512.HKDFExpand(prk, info, length)
+		if err != nil {
+			return err
+		}
+		corpus.HKDF = append(corpus.HKDF, HKDFVector{Salt: salt, Secret: secret, Info: info, Length: length, PRK: prk[:], OKM: okm})
+	}
+	return nil
+}
+
+// generateKeys adds the seed and hierarchical key derivation vectors
+func generateKeys(corpus *Corpus) error {
+	for _, version := range []topayz512.SeedVersion{topayz512.SeedVersionLegacy, topayz512.SeedVersion2} {
+		for _, n := range []int{topayz512.MinSeedSize, 64} {
+			seed := fill(fmt.Sprintf("seed %d", n), n)
+			privateKey, publicKey, err := topayz512.GenerateKeyPairFromSeedVersion(seed, version)
+			if err != nil {
+				return err
+			}
+			corpus.SeedKeys = append(corpus.SeedKeys, SeedKeyVector{
+				Seed:       seed,
+				Version:    int(version),
+				PrivateKey: privateKey[:],
+				PublicKey:  publicKey[:],
+			})
+		}
+	}
+
+	seed := fill("hd seed", 64)
+	for _, text := range []string{"m", "m/0", "m/44'/7'/0'/0/1"} {
+		path, err := topayz512.ParseDerivationPath(text)
+		if err != nil {
+			return err
+		}
+		master, err := topayz512.NewMasterKey(seed)
+		if err != nil {
+			return err
+		}
+		key, err := master.Derive(path)
+		if err != nil {
+			return err
+		}
+		publicKey := key.PublicKey()
+		corpus.HDKeys = append(corpus.HDKeys, HDKeyVector{
+			Seed:       seed,
+			Path:       text,
+			PrivateKey: key.PrivateKey[:],
+			PublicKey:  publicKey[:],
+			ChainCode:  key.ChainCode[:],
+		})
+	}
+
+	seed = fill("hd kem seed", 64)
+	for _, text := range []string{"m", "m/0'/1"} {
+		path, err := topayz512.ParseDerivationPath(text)
+		if err != nil {
+			return err
+		}
+		master, err := topayz512.NewMasterKEMKey(seed)
+		if err != nil {
+			return err
+		}
+		key, err := master.Derive(path)
+		if err != nil {
+			return err
+		}
+		extended := key.Extended()
+		corpus.HDKEMKeys = append(corpus.HDKEMKeys, HDKEMKeyVector{
+			Seed:      seed,
+			Path:      text,
+			PublicKey: extended.PublicKey[:],
+			ChainCode: extended.ChainCode[:],
+		})
+	}
+	return nil
+}
+
+// generateSignatures adds the signature vectors. Signatures are large, so
+// there are only two.
+func generateSignatures(corpus *Corpus) error {
+	privateKey, publicKey, err := topayz512.GenerateKeyPairFromSeed(fill("signing seed", 32))
+	if err != nil {
+		return err
+	}
+	for _, message := range [][]byte{{}, fill("signed message", 100)} {
+		signature, err := topayz512.Sign(privateKey, message)
+		if err != nil {
+			return err
+		}
+		corpus.Signatures = append(corpus.Signatures, SignatureVector{
+			PrivateKey: privateKey[:],
+			PublicKey:  publicKey[:],
+			Message:    message,
+			Signature:  signature[:],
+		})
+	}
+	return nil
+}
+
+// generateKEM adds the derandomized KEM vectors
+func generateKEM(corpus *Corpus) error {
+	for i := 0; i < 3; i++ {
+		publicKey, secretKey, err := topayz512.KEMKeyGenFromSeed(fill(fmt.Sprintf("kem seed %d", i), topayz512.KEMSecretKeySize))
+		if err != nil {
+			return err
+		}
+		message := fill(fmt.Sprintf("kem message %d", i), topayz512.SharedSecretSize)
+		ciphertext, sharedSecret, err := topayz512.KEMEncapsulateDerandomized(publicKey, message)
+		if err != nil {
+			return err
+		}
+		derived, err := sharedSecret.Derive([]byte(deriveInfo), 32)
+		if err != nil {
+			return err
+		}
+		corpus.KEM = append(corpus.KEM, KEMVector{
+			SecretKey:    secretKey[:],
+			PublicKey:    publicKey[:],
+			Message:      message,
+			Ciphertext:   ciphertext[:],
+			SharedSecret: sharedSecret[:],
+			DeriveInfo:   []byte(deriveInfo),
+			Derived:      derived,
+		})
+	}
+	return nil
+}
+
+// generateFragments adds the fragment vectors: one fragment, several, and
+// several with checksums keyed from the first KEM vector's shared secret
+func generateFragments(corpus *Corpus) error {
+	var id topayz512.ID
+	copy(id[:], fill("fragment id", topayz512.IDSize))
+	var sharedSecret topayz512.SharedSecret
+	copy(sharedSecret[:], corpus.KEM[0].SharedSecret)
+	key := topayz512.DeriveFragmentKey(sharedSecret)
+
+	for _, test := range []struct {
+		size int
+		key  *topayz512.FragmentKey
+	}{
+		{100, nil},
+		{1000, nil},
+		{700, &key},
+	} {
+		data := fill(fmt.Sprintf("fragment data %d", test.size), test.size)
+		result, err := topayz512.FragmentData(data)
+		if err != nil {
+			return err
+		}
+
+		vector := FragmentVector{Data: data, ID: id[:]}
+		if test.key != nil {
+			vector.Key = test.key[:]
+		}
+		for _, fragment := range result.Fragments {
+			// The ID is random; replacing it changes only keyed checksums
+			fragment.ID = id
+			if test.key != nil {
+				fragment.Checksum = test.key.Checksum(fragment)
+			}
+			vector.Fragments = append(vector.Fragments, topayz512.SerializeFragment(fragment))
+		}
+		corpus.Fragments = append(corpus.Fragments, vector)
+	}
+	return nil
+}
+
+// generateSealedBoxes adds sealed box vectors, building each box as Encrypt
+// does with the KEM derandomized and checking that Decrypt opens it
+func generateSealedBoxes(corpus *Corpus) error {
+	seed := fill("sealed box seed", topayz512.KEMSecretKeySize)
+	publicKey, secretKey, err := topayz512.KEMKeyGenFromSeed(seed)
+	if err != nil {
+		return err
+	}
+	for _, n := range []int{0, 300} {
+		message := fill(fmt.Sprintf("sealed box message %d", n), topayz512.SharedSecretSize)
+		plaintext := fill(fmt.Sprintf("sealed box plaintext %d", n), n)
+		ciphertext, sharedSecret, err := topayz512.KEMEncapsulateDerandomized(publicKey, message)
+		if err != nil {
+			return err
+		}
+		aead, err := sharedSecret.NewAEAD(topayz512.AEADInitiator, nil)
+		if err != nil {
+			return err
+		}
+		sealed, err := aead.Seal(plaintext, nil)
+		aead.Wipe()
+		if err != nil {
+			return err
+		}
+
+		box := append(ciphertext[:], sealed...)
+		if opened, err := topayz512.Decrypt(secretKey, box); err != nil || string(opened) != string(plaintext) {
+			return fmt.Errorf("sealed box layout differs from Encrypt: %v", err)
+		}
+		corpus.SealedBoxes = append(corpus.SealedBoxes, SealedBoxVector{
+			SecretKey: secretKey[:],
+			Message:   message,
+			Plaintext: plaintext,
+			Box:       box,
+		})
+	}
+	return nil
+}
+
+// generateAddresses adds address vectors for the signature vectors' key on
+// every known network
+func generateAddresses(corpus *Corpus) error {
+	publicKey, err := topayz512.PublicKeyFromBytes(corpus.Signatures[0].PublicKey)
+	if err != nil {
+		return err
+	}
+	for _, network := range address.Networks {
+		a := address.FromPublicKey(publicKey, network)
+		vector := AddressVector{PublicKey: publicKey[:], Network: network.Name}
+		for format, encoded := range map[address.Format]*string{
+			address.Bech32m:     &vector.Bech32m,
+			address.Bech32:      &vector.Bech32,
+			address.Base58Check: &vector.Base58Check,
+		} {
+			if *encoded, err = a.Encode(format); err != nil {
+				return err
+			}
+		}
+		corpus.Addresses = append(corpus.Addresses, vector)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package fixtures
+
+import (
+	"bytes"
+	"testing"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/address"
+)
+
+// Test that the committed corpus matches the implementation
+func TestCorpusUpToDate(t *testing.T) {
+	corpus, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	data, err := Marshal(corpus)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !bytes.Equal(data, corpusJSON) {
+		t.Fatal("corpus.json is out of date; run go generate ./fixtures and review the diff")
+	}
+}
+
+// Test the committed vectors the way another implementation would consume
+// them, through the public API in the opposite direction where there is one
+func TestCorpusVectors(t *testing.T) {
+	corpus, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if corpus.Version != Version {
+		t.Fatalf("Corpus version is %d, want %d", corpus.Version, Version)
+	}
+
+	for i, vector := range corpus.Signatures {
+		publicKey, _ := topayz512.PublicKeyFromBytes(vector.PublicKey)
+		var signature topayz512.Signature
+		copy(signature[:], vector.Signature)
+		if !topayz512.Verify(publicKey, vector.Message, signature) {
+			t.Errorf("Signature vector %d doesn't verify", i)
+		}
+	}
+
+	for i, vector := range corpus.KEM {
+		secretKey, err := topayz512.KEMSecretKeyFromBytes(vector.SecretKey)
+		if err != nil {
+			t.Fatalf("KEM vector %d: %v", i, err)
+		}
+		ciphertext, _ := topayz512.CiphertextFromBytes(vector.Ciphertext)
+		sharedSecret, err := topayz512.KEMDecapsulate(secretKey, ciphertext)
+		if err != nil || !bytes.Equal(sharedSecret[:], vector.SharedSecret) {
+			t.Errorf("KEM vector %d doesn't decapsulate: %v", i, err)
+		}
+	}
+
+	for i, vector := range corpus.Fragments {
+		var key *topayz512.FragmentKey
+		if len(vector.Key) > 0 {
+			key = new(topayz512.FragmentKey)
+			copy(key[:], vector.Key)
+		}
+		var fragments []topayz512.Fragment
+		for _, encoded := range vector.Fragments {
+			fragment, err := topayz512.DeserializeFragment(encoded)
+			if err != nil {
+				t.Fatalf("Fragment vector %d: %v", i, err)
+			}
+			fragments = append(fragments, fragment)
+		}
+		result, err := topayz512.ReconstructDataWithKey(fragments, key)
+		if err != nil || !bytes.Equal(result.Data, vector.Data) {
+			t.Errorf("Fragment vector %d doesn't reconstruct: %v", i, err)
+		}
+	}
+
+	for i, vector := range corpus.SealedBoxes {
+		secretKey, _ := topayz512.KEMSecretKeyFromBytes(vector.SecretKey)
+		plaintext, err := topayz512.Decrypt(secretKey, vector.Box)
+		if err != nil || !bytes.Equal(plaintext, vector.Plaintext) {
+			t.Errorf("Sealed box vector %d doesn't open: %v", i, err)
+		}
+	}
+
+	for i, vector := range corpus.Addresses {
+		publicKey, _ := topayz512.PublicKeyFromBytes(vector.PublicKey)
+		for _, encoded := range []string{vector.Bech32m, vector.Bech32, vector.Base58Check} {
+			parsed, _, err := address.Parse(encoded)
+			if err != nil || parsed.Network.Name != vector.Network || !parsed.Matches(publicKey) {
+				t.Errorf("Address vector %d: %q doesn't parse to the key: %v", i, encoded, err)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package topayz512
 
 import (
 	"encoding/binary"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -10,12 +11,15 @@ import (
 
 // Fragment represents a single data fragment
 type Fragment struct {
-	ID       uint32 `json:"id"`
+	ID       ID     `json:"id"`
 	Index    uint32 `json:"index"`
 	Total    uint32 `json:"total"`
 	Data     []byte `json:"data"`
 	Checksum Hash   `json:"checksum"`
 	Size     uint32 `json:"size"`
+	// Priority is an optional sending hint, higher first; it is not part of
+	// the serialized wire format
+	Priority uint8 `json:"priority,omitempty"`
 }
 
 // FragmentationResult contains the result of data fragmentation
@@ -28,19 +32,25 @@ type FragmentationResult struct {
 
 // FragmentMetadata contains metadata about the fragmentation
 type FragmentMetadata struct {
-	OriginalSize  uint64    `json:"original_size"`
-	FragmentCount uint32    `json:"fragment_count"`
-	Timestamp     time.Time `json:"timestamp"`
-	Algorithm     string    `json:"algorithm"`
-	Checksum      Hash      `json:"checksum"`
+	OriginalSize  uint64 `json:"original_size"`
+	FragmentCount uint32 `json:"fragment_count"`
+	// FragmentSize is the size of every fragment but the last; zero means
+	// the default layout for OriginalSize
+	FragmentSize uint32    `json:"fragment_size,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+	Algorithm    string    `json:"algorithm"`
+	Checksum     Hash      `json:"checksum"`
 }
 
 // ReconstructionResult contains the result of data reconstruction
 type ReconstructionResult struct {
-	Data         []byte           `json:"data"`
-	IsComplete   bool             `json:"is_complete"`
-	MissingCount uint32           `json:"missing_count"`
-	Metadata     FragmentMetadata `json:"metadata"`
+	Data         []byte `json:"data"`
+	IsComplete   bool   `json:"is_complete"`
+	MissingCount uint32 `json:"missing_count"`
+	// MissingIndices lists the missing fragments in index order when a
+	// result is incomplete
+	MissingIndices []uint32         `json:"missing_indices,omitempty"`
+	Metadata       FragmentMetadata `json:"metadata"`
 }
 
 // ShouldFragment determines if data should be fragmented based on size
@@ -62,21 +72,61 @@ func CalculateFragmentCount(dataSize int) int {
 	return fragmentCount
 }
 
-// FragmentData splits data into fragments for parallel processing
-func FragmentData(data []byte) (FragmentationResult, error) {
+// FragmentData splits data into fragments for parallel processing. Options
+// tune the fragment size and count; without them the defaults are
+// FragmentSize, MinFragmentThreshold and MaxFragments. WithContext and
+// WithProgress abandon or report on long runs.
+func FragmentData(data []byte, opts ...FragmentOption) (FragmentationResult, error) {
+	return FragmentDataWithKey(data, nil, opts...)
+}
+
+// FragmentDataWithKey splits data into fragments whose checksums are keyed
+// with key; nil key uses plain unkeyed checksums
+func FragmentDataWithKey(data []byte, key *FragmentKey, opts ...FragmentOption) (FragmentationResult, error) {
+	return fragmentData(data, keyedCommitment{key}, opts)
+}
+
+// FragmentDataWithCommitter splits data into fragments whose checksums are
+// committer's commitments to their data. The commitments must be HashSize
+// bytes; others fail with ErrInvalidHashSize.
+func FragmentDataWithCommitter(data []byte, committer Committer, opts ...FragmentOption) (FragmentationResult, error) {
+	return fragmentData(data, committerCommitment{committer}, opts)
+}
+
+// fragmentDataLayout validates data for fragmentation and returns the fragment
+// size and count config selects for it, and a fresh fragment ID
+func fragmentDataLayout(data []byte, config fragmentConfig) (int, int, ID, error) {
 	if len(data) == 0 {
-		return FragmentationResult{}, ErrEmptyData
+		return 0, 0, ID{}, ErrEmptyData
+	}
+	if err := checkFragmentedDataSize(len(data)); err != nil {
+		return 0, 0, ID{}, err
+	}
+	fragmentSize, fragmentCount, err := config.layout(len(data))
+	if err != nil {
+		return 0, 0, ID{}, err
 	}
 
-	fragmentCount := CalculateFragmentCount(len(data))
-	fragmentSize := (len(data) + fragmentCount - 1) / fragmentCount
+	// Generate unique 128-bit fragment ID
+	var fragmentID ID
+	if config.legacyID {
+		fragmentID, err = newLegacyFragmentID()
+	} else {
+		fragmentID, err = NewID()
+	}
+	return fragmentSize, fragmentCount, fragmentID, err
+}
 
-	// Generate unique fragment ID
-	idBytes, err := SecureRandom(4)
+// fragmentData splits data into fragments checksummed by commitment
+func fragmentData(data []byte, commitment fragmentCommitment, opts []FragmentOption) (FragmentationResult, error) {
+	config, err := newFragmentConfig(opts)
+	if err != nil {
+		return FragmentationResult{}, err
+	}
+	fragmentSize, fragmentCount, fragmentID, err := fragmentDataLayout(data, config)
 	if err != nil {
 		return FragmentationResult{}, err
 	}
-	fragmentID := binary.BigEndian.Uint32(idBytes)
 
 	// Calculate total checksum
 	totalChecksum := ComputeHash(data)
@@ -85,43 +135,78 @@ func FragmentData(data []byte) (FragmentationResult, error) {
 	fragments := make([]Fragment, fragmentCount)
 
 	for i := 0; i < fragmentCount; i++ {
+		if err := config.step(); err != nil {
+			return FragmentationResult{}, err
+		}
+
 		start := i * fragmentSize
 		end := start + fragmentSize
 		if end > len(data) {
 			end = len(data)
 		}
 
-		fragmentData := make([]byte, end-start)
-		copy(fragmentData, data[start:end])
-
-		// Calculate fragment checksum
-		fragmentChecksum := ComputeHash(fragmentData)
+		fragmentData := data[start:end:end]
+		if !config.sharedData {
+			fragmentData = make([]byte, end-start)
+			copy(fragmentData, data[start:end])
+		}
 
 		fragments[i] = Fragment{
-			ID:       fragmentID,
-			Index:    uint32(i),
-			Total:    uint32(fragmentCount),
-			Data:     fragmentData,
-			Checksum: fragmentChecksum,
+			ID:    fragmentID,
+			Index: uint32(i),
+			Total: uint32(fragmentCount),
+			Data:  fragmentData,
+		}
+
+		// Calculate fragment checksum
+		if fragments[i].Checksum, err = commitment.commit(fragments[i]); err != nil {
+			return FragmentationResult{}, err
 		}
+		config.report(i+1, fragmentCount)
 	}
 
 	metadata := FragmentMetadata{
 		OriginalSize:  uint64(len(data)),
 		FragmentCount: uint32(fragmentCount),
+		FragmentSize:  uint32(fragmentSize),
 		Timestamp:     time.Now(),
 		Algorithm:     "TOPAY-Z512",
 		Checksum:      totalChecksum,
 	}
 
 	return FragmentationResult{
-		Fragments: fragments,
-		Metadata:  metadata,
+		Fragments:    fragments,
+		FragmentSize: uint32(fragmentSize),
+		Metadata:     metadata,
 	}, nil
 }
 
-// ReconstructData reconstructs original data from fragments
-func ReconstructData(fragments []Fragment) (ReconstructionResult, error) {
+// ReconstructData reconstructs original data from fragments. WithContext
+// and WithProgress apply per verified fragment; layout options are ignored,
+// since the fragments carry their layout.
+func ReconstructData(fragments []Fragment, opts ...FragmentOption) (ReconstructionResult, error) {
+	return ReconstructDataWithKey(fragments, nil, opts...)
+}
+
+// ReconstructDataWithKey reconstructs original data from fragments whose
+// checksums were keyed with key; nil key checks plain unkeyed checksums
+func ReconstructDataWithKey(fragments []Fragment, key *FragmentKey, opts ...FragmentOption) (ReconstructionResult, error) {
+	return reconstructData(fragments, keyedCommitment{key}, opts)
+}
+
+// ReconstructDataWithCommitter reconstructs original data from fragments
+// written by FragmentDataWithCommitter with the same committer
+func ReconstructDataWithCommitter(fragments []Fragment, committer Committer, opts ...FragmentOption) (ReconstructionResult, error) {
+	return reconstructData(fragments, committerCommitment{committer}, opts)
+}
+
+// reconstructData reconstructs original data from fragments checksummed by
+// commitment
+func reconstructData(fragments []Fragment, commitment fragmentCommitment, opts []FragmentOption) (ReconstructionResult, error) {
+	config, err := newFragmentConfig(opts)
+	if err != nil {
+		return ReconstructionResult{}, err
+	}
 	if len(fragments) == 0 {
 		return ReconstructionResult{}, ErrEmptyData
 	}
@@ -162,10 +247,13 @@ func ReconstructData(fragments []Fragment) (ReconstructionResult, error) {
 		}
 
 		// Verify fragment checksum
-		computedChecksum := ComputeHash(fragment.Data)
-		if !HashEqual(computedChecksum, fragment.Checksum) {
+		if err := config.step(); err != nil {
+			return ReconstructionResult{}, err
+		}
+		if !commitment.verify(fragment) {
 			return ReconstructionResult{}, ErrReconstructionFailed
 		}
+		config.report(i+1, len(sortedFragments))
 	}
 
 	// Reconstruct data
@@ -200,21 +288,18 @@ func ReconstructData(fragments []Fragment) (ReconstructionResult, error) {
 
 // Parallel fragmentation operations
 
-// ParallelFragmentData fragments data using parallel processing
-func ParallelFragmentData(data []byte) (FragmentationResult, error) {
-	if len(data) == 0 {
-		return FragmentationResult{}, ErrEmptyData
+// ParallelFragmentData fragments data using parallel processing, taking the
+// same options as FragmentData. Progress is reported on the calling
+// goroutine as workers finish fragments, in no particular order.
+func ParallelFragmentData(data []byte, opts ...FragmentOption) (FragmentationResult, error) {
+	config, err := newFragmentConfig(opts)
+	if err != nil {
+		return FragmentationResult{}, err
 	}
-
-	fragmentCount := CalculateFragmentCount(len(data))
-	fragmentSize := (len(data) + fragmentCount - 1) / fragmentCount
-
-	// Generate unique fragment ID
-	idBytes, err := SecureRandom(4)
+	fragmentSize, fragmentCount, fragmentID, err := fragmentDataLayout(data, config)
 	if err != nil {
 		return FragmentationResult{}, err
 	}
-	fragmentID := binary.BigEndian.Uint32(idBytes)
 
 	// Calculate total checksum
 	totalChecksum := ComputeHash(data)
@@ -243,6 +328,15 @@ func ParallelFragmentData(data []byte) (FragmentationResult, error) {
 		go func() {
 			defer wg.Done()
 			for index := range workChan {
+				if err := config.step(); err != nil {
+					resultChan <- struct {
+						index    int
+						fragment Fragment
+						err      error
+					}{index, Fragment{}, err}
+					continue
+				}
+
 				start := index * fragmentSize
 				end := start + fragmentSize
 				if end > len(data) {
@@ -287,35 +381,41 @@ func ParallelFragmentData(data []byte) (FragmentationResult, error) {
 	}()
 
 	// Collect results
+	done := 0
 	for result := range resultChan {
 		if result.err != nil {
 			return FragmentationResult{}, result.err
 		}
 		fragments[result.index] = result.fragment
+		done++
+		config.report(done, fragmentCount)
 	}
 
 	metadata := FragmentMetadata{
 		OriginalSize:  uint64(len(data)),
 		FragmentCount: uint32(fragmentCount),
+		FragmentSize:  uint32(fragmentSize),
 		Timestamp:     time.Now(),
 		Algorithm:     "TOPAY-Z512",
 		Checksum:      totalChecksum,
 	}
 
 	return FragmentationResult{
-		Fragments: fragments,
-		Metadata:  metadata,
+		Fragments:    fragments,
+		FragmentSize: uint32(fragmentSize),
+		Metadata:     metadata,
 	}, nil
 }
 
-// ParallelReconstructData reconstructs data using parallel processing
-func ParallelReconstructData(fragments []Fragment) (ReconstructionResult, error) {
+// ParallelReconstructData reconstructs data using parallel processing,
+// taking the same options as ReconstructData
+func ParallelReconstructData(fragments []Fragment, opts ...FragmentOption) (ReconstructionResult, error) {
 	if len(fragments) == 0 {
 		return ReconstructionResult{}, ErrEmptyData
 	}
 
 	// Validate and sort fragments first
-	result, err := ReconstructData(fragments)
+	result, err := ReconstructData(fragments, opts...)
 	if err != nil {
 		return result, err
 	}
@@ -327,18 +427,75 @@ func ParallelReconstructData(fragments []Fragment) (ReconstructionResult, error)
 
 // Fragment serialization
 
+// Fragment wire format constants
+const (
+	// fragmentMagic prefixes fragments serialized with 128-bit IDs
+	fragmentMagic = "TZF\x02"
+
+	// fragmentHeaderSize is the header size: Magic + ID + Index + Total + DataLen
+	fragmentHeaderSize = len(fragmentMagic) + IDSize + 4 + 4 + 4
+
+	// legacyFragmentHeaderSize is the header size of the original 32-bit ID format
+	legacyFragmentHeaderSize = 4 + 4 + 4 + 4
+)
+
+// LegacyFragmentID maps a 32-bit fragment ID from the original wire format into
+// the 128-bit ID space. Legacy IDs occupy the last four bytes with a zero prefix.
+func LegacyFragmentID(id uint32) ID {
+	var result ID
+	binary.BigEndian.PutUint32(result[IDSize-4:], id)
+	return result
+}
+
+// IsLegacyFragmentID reports whether id lies in the 32-bit legacy range, so
+// SerializeFragmentLegacy can carry it. IDs from NewID never do: their
+// timestamp prefix is nonzero.
+func IsLegacyFragmentID(id ID) bool {
+	var zero [IDSize - 4]byte
+	return [IDSize - 4]byte(id[:IDSize-4]) == zero
+}
+
+// newLegacyFragmentID draws a random ID from the legacy range
+func newLegacyFragmentID() (ID, error) {
+	random, err := SecureRandom(4)
+	if err != nil {
+		return ID{}, err
+	}
+	return LegacyFragmentID(binary.BigEndian.Uint32(random)), nil
+}
+
+// SerializeFragmentLegacy converts a fragment to the original wire format
+// with a 32-bit ID, for peers that predate 128-bit IDs. It returns
+// ErrNotLegacyFragmentID unless the fragment was made with WithLegacyID.
+func SerializeFragmentLegacy(fragment Fragment) ([]byte, error) {
+	if !IsLegacyFragmentID(fragment.ID) {
+		return nil, ErrNotLegacyFragmentID
+	}
+	result := make([]byte, 0, legacyFragmentHeaderSize+len(fragment.Data)+HashSize)
+	result = append(result, fragment.ID[IDSize-4:]...)
+	result = binary.BigEndian.AppendUint32(result, fragment.Index)
+	result = binary.BigEndian.AppendUint32(result, fragment.Total)
+	result = binary.BigEndian.AppendUint32(result, uint32(len(fragment.Data)))
+	result = append(result, fragment.Data...)
+	return append(result, fragment.Checksum[:]...), nil
+}
+
 // SerializeFragment converts a fragment to bytes
 func SerializeFragment(fragment Fragment) []byte {
 	// Calculate total size needed
 	dataLen := len(fragment.Data)
-	totalSize := 4 + 4 + 4 + 4 + dataLen + HashSize // ID + Index + Total + DataLen + Data + Checksum
+	totalSize := fragmentHeaderSize + dataLen + HashSize
 
 	result := make([]byte, totalSize)
 	offset := 0
 
+	// Write Magic
+	copy(result[offset:], fragmentMagic)
+	offset += len(fragmentMagic)
+
 	// Write ID
-	binary.BigEndian.PutUint32(result[offset:], fragment.ID)
-	offset += 4
+	copy(result[offset:], fragment.ID[:])
+	offset += IDSize
 
 	// Write Index
 	binary.BigEndian.PutUint32(result[offset:], fragment.Index)
@@ -362,17 +519,89 @@ func SerializeFragment(fragment Fragment) []byte {
 	return result
 }
 
-// DeserializeFragment converts bytes to a fragment
+// DefaultMaxFragmentDataSize is the largest fragment payload DeserializeFragment
+// accepts unless the caller sets a different limit
+const DefaultMaxFragmentDataSize = 16 << 20
+
+// FragmentLimits bounds what DeserializeFragmentWithLimits accepts, so a
+// single malicious packet can't force a large allocation
+type FragmentLimits struct {
+	// MaxDataSize is the largest accepted payload; zero uses DefaultMaxFragmentDataSize
+	MaxDataSize uint32
+	// MaxTotal is the largest accepted fragment count; zero uses MaxFragments
+	MaxTotal uint32
+	// OriginalSize is the size of the fragmented data when known from
+	// metadata; zero skips the checks against it
+	OriginalSize uint64
+}
+
+// FragmentDecodeError reports why a serialized fragment was rejected. Err is
+// one of ErrFragmentTruncated, ErrFragmentTooLarge or ErrInvalidFragmentIndex.
+type FragmentDecodeError struct {
+	Field string
+	Value uint64
+	Limit uint64
+	Err   error
+}
+
+// Error implements error
+func (e *FragmentDecodeError) Error() string {
+	return fmt.Sprintf("%v: %s is %d, limit %d", e.Err, e.Field, e.Value, e.Limit)
+}
+
+// Unwrap returns the underlying sentinel error
+func (e *FragmentDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DeserializeFragment converts bytes to a fragment using the default limits.
+// Both the current format and the original format with 32-bit IDs are accepted.
 func DeserializeFragment(data []byte) (Fragment, error) {
-	if len(data) < 16+HashSize { // Minimum size: 4 fields + checksum
-		return Fragment{}, ErrInvalidFragmentCount
+	return DeserializeFragmentWithLimits(data, nil)
+}
+
+// DeserializeFragmentWithLimits converts bytes to a fragment, rejecting
+// payloads, counts and indices outside limits before allocating anything
+func DeserializeFragmentWithLimits(data []byte, limits *FragmentLimits) (Fragment, error) {
+	var options FragmentLimits
+	if limits != nil {
+		options = *limits
+	}
+	if options.MaxDataSize == 0 {
+		options.MaxDataSize = DefaultMaxFragmentDataSize
+	}
+	if options.MaxTotal == 0 {
+		options.MaxTotal = MaxFragments
+	}
+
+	if len(data) >= fragmentHeaderSize+HashSize && string(data[:len(fragmentMagic)]) == fragmentMagic {
+		// A legacy fragment whose 32-bit ID happens to spell the magic is only
+		// recognised by its length matching the legacy layout exactly
+		dataLen := binary.BigEndian.Uint32(data[fragmentHeaderSize-4:])
+		legacyDataLen := binary.BigEndian.Uint32(data[legacyFragmentHeaderSize-4:])
+		if uint64(len(data)) == uint64(fragmentHeaderSize)+uint64(dataLen)+uint64(HashSize) ||
+			uint64(len(data)) != uint64(legacyFragmentHeaderSize)+uint64(legacyDataLen)+uint64(HashSize) {
+			var id ID
+			copy(id[:], data[len(fragmentMagic):])
+			return decodeFragmentBody(id, data[len(fragmentMagic)+IDSize:], &options)
+		}
 	}
 
-	offset := 0
+	// Fall back to the legacy layout: ID(4) + Index + Total + DataLen + Data + Checksum
+	if len(data) < legacyFragmentHeaderSize+HashSize {
+		return Fragment{}, &FragmentDecodeError{
+			Field: "length",
+			Value: uint64(len(data)),
+			Limit: uint64(legacyFragmentHeaderSize + HashSize),
+			Err:   ErrFragmentTruncated,
+		}
+	}
+	return decodeFragmentBody(LegacyFragmentID(binary.BigEndian.Uint32(data)), data[4:], &options)
+}
 
-	// Read ID
-	id := binary.BigEndian.Uint32(data[offset:])
-	offset += 4
+// decodeFragmentBody decodes Index + Total + DataLen + Data + Checksum
+func decodeFragmentBody(id ID, data []byte, limits *FragmentLimits) (Fragment, error) {
+	offset := 0
 
 	// Read Index
 	index := binary.BigEndian.Uint32(data[offset:])
@@ -386,8 +615,12 @@ func DeserializeFragment(data []byte) (Fragment, error) {
 	dataLen := binary.BigEndian.Uint32(data[offset:])
 	offset += 4
 
-	if len(data) < offset+int(dataLen)+HashSize {
-		return Fragment{}, ErrInvalidFragmentCount
+	if err := limits.check(index, total, dataLen); err != nil {
+		return Fragment{}, err
+	}
+
+	if need := uint64(offset) + uint64(dataLen) + uint64(HashSize); uint64(len(data)) < need {
+		return Fragment{}, &FragmentDecodeError{Field: "length", Value: uint64(len(data)), Limit: need, Err: ErrFragmentTruncated}
 	}
 
 	// Read Data
@@ -408,6 +641,33 @@ func DeserializeFragment(data []byte) (Fragment, error) {
 	}, nil
 }
 
+// check validates a fragment header against the limits
+func (fl *FragmentLimits) check(index, total, dataLen uint32) error {
+	if total == 0 || total > fl.MaxTotal {
+		return &FragmentDecodeError{Field: "total", Value: uint64(total), Limit: uint64(fl.MaxTotal), Err: ErrInvalidFragmentIndex}
+	}
+	if index >= total {
+		return &FragmentDecodeError{Field: "index", Value: uint64(index), Limit: uint64(total) - 1, Err: ErrInvalidFragmentIndex}
+	}
+
+	maxData := uint64(fl.MaxDataSize)
+	if fl.OriginalSize > 0 {
+		// Every fragment but the last has the same size and the last holds at
+		// least one byte, so no fragment exceeds OriginalSize / (total-1)
+		bound := fl.OriginalSize
+		if total > 1 {
+			bound = fl.OriginalSize / uint64(total-1)
+		}
+		if bound < maxData {
+			maxData = bound
+		}
+	}
+	if uint64(dataLen) > maxData {
+		return &FragmentDecodeError{Field: "data length", Value: uint64(dataLen), Limit: maxData, Err: ErrFragmentTooLarge}
+	}
+	return nil
+}
+
 // Mobile optimization
 
 // MobileLatencyEstimate estimates processing latency for mobile devices
@@ -614,9 +874,25 @@ func BenchmarkFragmentation(dataSize int) FragmentationBenchmark {
 
 // ValidateFragmentIntegrity validates the integrity of a fragment
 func ValidateFragmentIntegrity(fragment Fragment) error {
+	return ValidateFragmentIntegrityWithKey(fragment, nil)
+}
+
+// ValidateFragmentIntegrityWithKey validates a fragment whose checksum was
+// keyed with key; nil key checks a plain unkeyed checksum
+func ValidateFragmentIntegrityWithKey(fragment Fragment, key *FragmentKey) error {
+	return validateFragmentIntegrity(fragment, keyedCommitment{key})
+}
+
+// ValidateFragmentIntegrityWithCommitter validates a fragment written by
+// FragmentDataWithCommitter with committer
+func ValidateFragmentIntegrityWithCommitter(fragment Fragment, committer Committer) error {
+	return validateFragmentIntegrity(fragment, committerCommitment{committer})
+}
+
+// validateFragmentIntegrity validates a fragment checksummed by commitment
+func validateFragmentIntegrity(fragment Fragment, commitment fragmentCommitment) error {
 	// Verify checksum
-	computedChecksum := ComputeHash(fragment.Data)
-	if !HashEqual(computedChecksum, fragment.Checksum) {
+	if !commitment.verify(fragment) {
 		return ErrReconstructionFailed
 	}
 
@@ -633,6 +909,9 @@ func ValidateFragmentIntegrity(fragment Fragment) error {
 }
 
 // RepairFragment attempts to repair a corrupted fragment
+//
+// Deprecated: RepairFragment needs the original data, which a receiver does not
+// have. Use GenerateParity on the sender and RepairFromParity on the receiver.
 func RepairFragment(fragment Fragment, originalData []byte, fragmentSize int) (Fragment, error) {
 	// Calculate expected fragment data
 	start := int(fragment.Index) * fragmentSize
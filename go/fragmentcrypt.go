@@ -0,0 +1,137 @@
+package topayz512
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"sync"
+)
+
+// Fragment encryption
+//
+// EncryptFragments seals each fragment separately under an AES-256-GCM key
+// derived from a shared secret, so fragments can cross untrusted relays and
+// still be sent, dropped and retransmitted one at a time. The nonce of each
+// fragment is derived from its ID and index, which never repeat under one
+// key because IDs are random, and the ID, index and count are authenticated,
+// so a relay can't move a fragment to another position or payload. The
+// original checksum is sealed with the data, and the encrypted fragment gets
+// a plain checksum of its ciphertext that relays can check with
+// ValidateFragmentIntegrity without learning anything about the payload.
+
+// Domain separation strings for fragment encryption
+const (
+	fragmentEncryptionKeyDomain   = "TOPAY-Z512-FRAGMENT-ENCRYPTION-KEY"
+	fragmentEncryptionNonceDomain = "TOPAY-Z512-FRAGMENT-ENCRYPTION-NONCE"
+)
+
+// EncryptedFragmentOverhead is the number of bytes EncryptFragments adds to
+// each fragment's data: the sealed original checksum and the GCM tag
+const EncryptedFragmentOverhead = HashSize + 16
+
+// EncryptFragments returns copies of fragments with their data and checksums
+// sealed under a key derived from sharedSecret. A secret erased with
+// SecureEraseSharedSecret returns ErrKeyDestroyed.
+func EncryptFragments(fragments []Fragment, sharedSecret SharedSecret) ([]Fragment, error) {
+	gcm, key, err := newFragmentCipher(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(key)
+
+	encrypted := make([]Fragment, len(fragments))
+	for i, fragment := range fragments {
+		encrypted[i] = sealFragment(gcm, key, fragment)
+	}
+	return encrypted, nil
+}
+
+// DecryptFragments reverses EncryptFragments with the same shared secret,
+// restoring the original data and checksums. It returns
+// ErrAuthenticationFailed if any fragment was sealed under another secret,
+// modified or moved to another ID, index or count.
+func DecryptFragments(fragments []Fragment, sharedSecret SharedSecret) ([]Fragment, error) {
+	gcm, key, err := newFragmentCipher(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(key)
+
+	decrypted := make([]Fragment, len(fragments))
+	for i, fragment := range fragments {
+		if decrypted[i], err = openFragment(gcm, key, fragment); err != nil {
+			return nil, err
+		}
+	}
+	return decrypted, nil
+}
+
+// sealBuffers pools the buffers plaintexts are staged in while sealing
+var sealBuffers sync.Pool
+
+// sealFragment encrypts one fragment
+func sealFragment(gcm cipher.AEAD, key []byte, fragment Fragment) Fragment {
+	buf, _ := sealBuffers.Get().(*[]byte)
+	if buf == nil {
+		buf = new([]byte)
+	}
+	plaintext := append((*buf)[:0], fragment.Checksum[:]...)
+	plaintext = append(plaintext, fragment.Data...)
+
+	nonce, header := fragmentNonce(key, fragment), fragmentHeader(fragment)
+	fragment.Data = gcm.Seal(nil, nonce, plaintext, header)
+	SecureZero(plaintext)
+	*buf = plaintext
+	sealBuffers.Put(buf)
+	fragment.Checksum = fragmentChecksum(nil, fragment)
+	return fragment
+}
+
+// openFragment decrypts one fragment sealed by sealFragment
+func openFragment(gcm cipher.AEAD, key []byte, fragment Fragment) (Fragment, error) {
+	if len(fragment.Data) < EncryptedFragmentOverhead {
+		return Fragment{}, ErrAuthenticationFailed
+	}
+	nonce, header := fragmentNonce(key, fragment), fragmentHeader(fragment)
+	plaintext, err := gcm.Open(nil, nonce, fragment.Data, header)
+	if err != nil {
+		return Fragment{}, ErrAuthenticationFailed
+	}
+	copy(fragment.Checksum[:], plaintext)
+	fragment.Data = plaintext[HashSize:]
+	return fragment, nil
+}
+
+// newFragmentCipher derives the fragment encryption key and its cipher
+func newFragmentCipher(sharedSecret SharedSecret) (cipher.AEAD, []byte, error) {
+	if isErased(sharedSecret[:]) {
+		return nil, nil, ErrKeyDestroyed
+	}
+	digest := HashMultiple([]byte(fragmentEncryptionKeyDomain), sharedSecret[:])
+	key := make([]byte, aeadKeySize)
+	copy(key, digest[:aeadKeySize])
+	SecureZero(digest[:])
+
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		SecureZero(key)
+		return nil, nil, err
+	}
+	return gcm, key, nil
+}
+
+// fragmentNonce derives the GCM nonce of a fragment from its ID and index
+func fragmentNonce(key []byte, fragment Fragment) []byte {
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], fragment.Index)
+	digest := HashMultiple([]byte(fragmentEncryptionNonceDomain), key, fragment.ID[:], index[:])
+	return digest[:12]
+}
+
+// fragmentHeader returns the ID, index and count a fragment's encryption
+// authenticates
+func fragmentHeader(fragment Fragment) []byte {
+	header := make([]byte, 0, IDSize+8)
+	header = append(header, fragment.ID[:]...)
+	header = binary.BigEndian.AppendUint32(header, fragment.Index)
+	return binary.BigEndian.AppendUint32(header, fragment.Total)
+}
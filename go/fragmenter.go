@@ -0,0 +1,183 @@
+package topayz512
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Streaming fragmentation
+//
+// A Fragmenter reads a payload from an io.Reader and returns its fragments
+// one at a time, holding a single fragment's data in memory, so files far
+// larger than memory can be fragmented. The fragments are those FragmentData
+// would produce for the same bytes, apart from the random ID. Every fragment
+// carries the fragment count, so the payload size must be known up front:
+// from FragmenterOptions.Size, or from a reader with a Len method or one
+// that can seek, such as an *os.File or a *bytes.Reader.
+
+// FragmenterOptions configures a Fragmenter
+type FragmenterOptions struct {
+	// Size is the number of bytes to read; zero determines it from the reader
+	Size int64
+	// Key keys the fragment checksums; nil uses plain hashes
+	Key *FragmentKey
+	// Committer checksums fragments instead of Key when set
+	Committer Committer
+}
+
+// Fragmenter splits a payload read from an io.Reader into fragments
+type Fragmenter struct {
+	r            io.Reader
+	id           ID
+	size         uint64
+	fragmentSize int
+	total        uint32
+	next         uint32
+	commitment   fragmentCommitment
+	checksum     *HashState
+	metadata     FragmentMetadata
+	err          error
+}
+
+// NewFragmenter creates a Fragmenter reading from r; nil opts determines the
+// size from r and uses plain checksums. It returns ErrUnknownSize when the
+// size isn't set and r can't report it, ErrEmptyData for an empty payload and
+// a *TooLargeError beyond MaxFragmentedDataSize.
+func NewFragmenter(r io.Reader, opts *FragmenterOptions) (*Fragmenter, error) {
+	var options FragmenterOptions
+	if opts != nil {
+		options = *opts
+	}
+	size := options.Size
+	if size == 0 {
+		var ok bool
+		if size, ok = readerSize(r); !ok {
+			return nil, ErrUnknownSize
+		}
+	}
+	if size <= 0 {
+		return nil, ErrEmptyData
+	}
+	if uint64(size) > MaxFragmentedDataSize {
+		return nil, &TooLargeError{Limit: "fragmented data size", Size: uint64(size), Max: MaxFragmentedDataSize}
+	}
+
+	var commitment fragmentCommitment = keyedCommitment{key: options.Key}
+	if options.Committer != nil {
+		commitment = committerCommitment{committer: options.Committer}
+	}
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	count := uint64(CalculateFragmentCount(int(size)))
+	fragmentSize := (uint64(size) + count - 1) / count
+	total := uint32((uint64(size) + fragmentSize - 1) / fragmentSize)
+	return &Fragmenter{
+		r:            r,
+		id:           id,
+		size:         uint64(size),
+		fragmentSize: int(fragmentSize),
+		total:        total,
+		commitment:   commitment,
+		checksum:     NewHashState(),
+		metadata: FragmentMetadata{
+			OriginalSize:  uint64(size),
+			FragmentCount: total,
+			FragmentSize:  uint32(fragmentSize),
+			Timestamp:     time.Now(),
+			Algorithm:     "TOPAY-Z512",
+		},
+	}, nil
+}
+
+// readerSize returns the number of bytes left in r, if r can tell
+func readerSize(r io.Reader) (int64, bool) {
+	if sized, ok := r.(interface{ Len() int }); ok {
+		return int64(sized.Len()), true
+	}
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return 0, false
+	}
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return 0, false
+	}
+	return end - current, true
+}
+
+// ID returns the ID shared by the payload's fragments
+func (f *Fragmenter) ID() ID {
+	return f.id
+}
+
+// Total returns the number of fragments the payload is split into
+func (f *Fragmenter) Total() uint32 {
+	return f.total
+}
+
+// Next reads and returns the next fragment. After the last one it returns
+// io.EOF, having checked that the reader holds no more data than the size.
+// A reader ending early returns io.ErrUnexpectedEOF. Errors are sticky.
+func (f *Fragmenter) Next() (Fragment, error) {
+	if f.err != nil {
+		return Fragment{}, f.err
+	}
+	if f.next == f.total {
+		f.err = f.finish()
+		return Fragment{}, f.err
+	}
+
+	start := uint64(f.next) * uint64(f.fragmentSize)
+	length := min(uint64(f.fragmentSize), f.size-start)
+	data := make([]byte, length)
+	if _, err := io.ReadFull(f.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		f.err = err
+		return Fragment{}, err
+	}
+	f.checksum.Update(data)
+
+	fragment := Fragment{ID: f.id, Index: f.next, Total: f.total, Data: data}
+	checksum, err := f.commitment.commit(fragment)
+	if err != nil {
+		f.err = err
+		return Fragment{}, err
+	}
+	fragment.Checksum = checksum
+	f.next++
+	return fragment, nil
+}
+
+// finish checks that the payload ended at its size and completes the
+// metadata, returning io.EOF when it did
+func (f *Fragmenter) finish() error {
+	var extra [1]byte
+	n, err := io.ReadFull(f.r, extra[:])
+	if n > 0 {
+		return fmt.Errorf("%w: reader holds more than %d bytes", ErrFragmentationFailed, f.size)
+	}
+	if err != io.EOF {
+		return err
+	}
+	f.metadata.Checksum = f.checksum.Finalize()
+	return io.EOF
+}
+
+// Metadata returns the payload's metadata. Its Checksum, the hash of the
+// whole payload, is set once Next has returned io.EOF.
+func (f *Fragmenter) Metadata() FragmentMetadata {
+	return f.metadata
+}
@@ -0,0 +1,52 @@
+package topayz512
+
+import "encoding/binary"
+
+// Keyed fragment checksums
+
+// Domain separation strings for keyed fragment checksums
+const (
+	fragmentKeyDomain = "TOPAY-Z512-FRAGMENT-KEY"
+	fragmentMACDomain = "TOPAY-Z512-FRAGMENT-MAC"
+)
+
+// FragmentKey keys the checksums of one transfer's fragments. Unkeyed checksums
+// only catch accidental corruption: a relay modifying a fragment can simply
+// recompute them. With a key shared by sender and receiver alone, it can't.
+type FragmentKey [HashSize]byte
+
+// DeriveFragmentKey derives the fragment checksum key for a transfer from the
+// KEM shared secret established for it
+func DeriveFragmentKey(secret SharedSecret) FragmentKey {
+	return FragmentKey(HashConcat([]byte(fragmentKeyDomain), secret[:]))
+}
+
+// Checksum computes the keyed checksum of a fragment. It covers the ID, index
+// and total as well as the data, so fragments can't be moved between positions
+// or transfers either.
+func (fk *FragmentKey) Checksum(fragment Fragment) Hash {
+	var header [IDSize + 8]byte
+	copy(header[:], fragment.ID[:])
+	binary.BigEndian.PutUint32(header[IDSize:], fragment.Index)
+	binary.BigEndian.PutUint32(header[IDSize+4:], fragment.Total)
+
+	// HMAC construction, so the length extension property of the
+	// Merkle-Damgard compression can't be used to forge checksums
+	return hmacHash(fk[:], []byte(fragmentMACDomain), header[:], fragment.Data)
+}
+
+// Wipe clears the key. It does nothing for a nil key.
+func (fk *FragmentKey) Wipe() {
+	if fk == nil {
+		return
+	}
+	SecureZero(fk[:])
+}
+
+// fragmentChecksum computes a fragment's checksum, keyed when key is non-nil
+func fragmentChecksum(key *FragmentKey, fragment Fragment) Hash {
+	if key == nil {
+		return ComputeHash(fragment.Data)
+	}
+	return key.Checksum(fragment)
+}
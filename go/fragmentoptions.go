@@ -0,0 +1,177 @@
+package topayz512
+
+import (
+	"context"
+	"fmt"
+)
+
+// Fragmentation options
+//
+// By default FragmentData splits data of at least MinFragmentThreshold bytes
+// into fragments of about FragmentSize bytes, at most MaxFragments of them.
+// FragmentOptions tune this per call: mobile and IoT links want small
+// fragments, servers a few large ones. Fragments are always evened out, so a
+// payload is split into equal fragments with a shorter last one, and the
+// fragment count never exceeds MaxFragments, which receivers enforce.
+//
+// WithContext and WithProgress also apply to reconstruction, so long jobs
+// on either side can report progress and be abandoned.
+
+// FragmentOption tunes how data is split into fragments. Options return an
+// updated copy rather than taking a pointer, which would move the
+// configuration of every FragmentData call to the heap.
+type FragmentOption func(fragmentConfig) fragmentConfig
+
+// fragmentConfig is the layout FragmentOptions select
+type fragmentConfig struct {
+	fragmentSize int
+	threshold    int
+	maxFragments int
+	targetCount  int
+	legacyID     bool
+	ctx          context.Context
+	progress     func(done, total int)
+	sharedData   bool
+}
+
+// WithFragmentSize sets the largest fragment size in bytes, FragmentSize by
+// default. It must be between 1 and DefaultMaxFragmentDataSize.
+func WithFragmentSize(n int) FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.fragmentSize = n
+		return c
+	}
+}
+
+// WithMaxFragments caps the fragment count, MaxFragments by default; data
+// that would need more fragments gets larger ones. It must be between 1 and
+// MaxFragments.
+func WithMaxFragments(m int) FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.maxFragments = m
+		return c
+	}
+}
+
+// WithTargetCount splits data into k fragments regardless of the fragment
+// size, or fewer when the data has fewer than k bytes or the count is
+// capped. Data below the threshold still stays in one fragment. It must be
+// between 1 and MaxFragments.
+func WithTargetCount(k int) FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.targetCount = k
+		return c
+	}
+}
+
+// WithFragmentThreshold sets the size below which data stays in a single
+// fragment, MinFragmentThreshold by default; zero fragments any data
+func WithFragmentThreshold(n int) FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.threshold = n
+		return c
+	}
+}
+
+// WithLegacyID draws the fragment ID from the 32-bit range of the original
+// wire format, so SerializeFragmentLegacy can send the fragments to peers
+// that predate 128-bit IDs. Random 32-bit IDs collide once tens of thousands
+// of payloads share a channel, so use it only while such peers remain.
+func WithLegacyID() FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.legacyID = true
+		return c
+	}
+}
+
+// WithContext abandons fragmentation or reconstruction once ctx ends,
+// returning its error. It is checked before each fragment.
+func WithContext(ctx context.Context) FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.ctx = ctx
+		return c
+	}
+}
+
+// WithProgress calls progress after each fragment is made or verified,
+// with the number done so far and the fragment count, on the calling
+// goroutine
+func WithProgress(progress func(done, total int)) FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.progress = progress
+		return c
+	}
+}
+
+// withSharedData makes fragments reference the input instead of copying it,
+// for FragmentFile's read-only mapping
+func withSharedData() FragmentOption {
+	return func(c fragmentConfig) fragmentConfig {
+		c.sharedData = true
+		return c
+	}
+}
+
+// step checks the context before a fragment is processed
+func (c fragmentConfig) step() error {
+	if c.ctx != nil {
+		return c.ctx.Err()
+	}
+	return nil
+}
+
+// report passes progress to the WithProgress callback, if any
+func (c fragmentConfig) report(done, total int) {
+	if c.progress != nil {
+		c.progress(done, total)
+	}
+}
+
+// newFragmentConfig applies opts to the defaults. It returns a wrapped
+// ErrInvalidFragmentOption for a value out of range.
+func newFragmentConfig(opts []FragmentOption) (fragmentConfig, error) {
+	config := fragmentConfig{
+		fragmentSize: FragmentSize,
+		threshold:    MinFragmentThreshold,
+		maxFragments: MaxFragments,
+		targetCount:  -1,
+	}
+	for _, opt := range opts {
+		config = opt(config)
+	}
+	switch {
+	case config.fragmentSize < 1 || config.fragmentSize > DefaultMaxFragmentDataSize:
+		return fragmentConfig{}, fmt.Errorf("%w: fragment size %d", ErrInvalidFragmentOption, config.fragmentSize)
+	case config.maxFragments < 1 || config.maxFragments > MaxFragments:
+		return fragmentConfig{}, fmt.Errorf("%w: max fragments %d", ErrInvalidFragmentOption, config.maxFragments)
+	case config.targetCount == 0 || config.targetCount < -1 || config.targetCount > MaxFragments:
+		return fragmentConfig{}, fmt.Errorf("%w: target count %d", ErrInvalidFragmentOption, config.targetCount)
+	case config.threshold < 0:
+		return fragmentConfig{}, fmt.Errorf("%w: threshold %d", ErrInvalidFragmentOption, config.threshold)
+	}
+	return config, nil
+}
+
+// layout returns the fragment size and count for dataSize bytes, which must
+// be positive. It returns a *TooLargeError when the fragments would exceed
+// DefaultMaxFragmentDataSize, so receivers using the default limits accept
+// them.
+func (c fragmentConfig) layout(dataSize int) (fragmentSize, count int, err error) {
+	switch {
+	case dataSize < c.threshold:
+		count = 1
+	case c.targetCount > 0:
+		count = c.targetCount
+	default:
+		count = (dataSize + c.fragmentSize - 1) / c.fragmentSize
+	}
+	count = min(count, c.maxFragments, dataSize)
+	fragmentSize = (dataSize + count - 1) / count
+	if fragmentSize > DefaultMaxFragmentDataSize {
+		return 0, 0, &TooLargeError{Limit: "fragment size", Size: uint64(fragmentSize), Max: DefaultMaxFragmentDataSize}
+	}
+
+	// Rounding the size up can leave trailing fragments empty once the count
+	// is capped, so recount from the rounded size
+	return fragmentSize, (dataSize + fragmentSize - 1) / fragmentSize, nil
+}
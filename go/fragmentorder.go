@@ -0,0 +1,101 @@
+package topayz512
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// Fragment ordering for progressive decoding
+
+// FragmentOrder is a strategy for the order fragments are sent in
+type FragmentOrder int
+
+// Fragment ordering strategies
+const (
+	// OrderSequential sends fragments by index
+	OrderSequential FragmentOrder = iota
+	// OrderInterleaved sends fragments in bit-reversed index order, so every
+	// prefix of the stream covers the payload evenly at increasing resolution
+	OrderInterleaved
+	// OrderHeaderFirst sends fragments by descending priority, then by index,
+	// so headers or other marked fragments arrive before the bulk
+	OrderHeaderFirst
+)
+
+// String returns the name of an ordering strategy
+func (fo FragmentOrder) String() string {
+	switch fo {
+	case OrderSequential:
+		return "sequential"
+	case OrderInterleaved:
+		return "interleaved"
+	case OrderHeaderFirst:
+		return "header-first"
+	}
+	return "unknown"
+}
+
+// OrderFragments returns the fragments in the order the strategy sends them.
+// The input slice is not modified.
+func OrderFragments(fragments []Fragment, order FragmentOrder) ([]Fragment, error) {
+	ordered := make([]Fragment, len(fragments))
+	copy(ordered, fragments)
+
+	switch order {
+	case OrderSequential:
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Index < ordered[j].Index })
+	case OrderInterleaved:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return bits.Reverse32(ordered[i].Index) < bits.Reverse32(ordered[j].Index)
+		})
+	case OrderHeaderFirst:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if ordered[i].Priority != ordered[j].Priority {
+				return ordered[i].Priority > ordered[j].Priority
+			}
+			return ordered[i].Index < ordered[j].Index
+		})
+	default:
+		return nil, ErrInvalidFragmentOrder
+	}
+	return ordered, nil
+}
+
+// SetHeaderPriority gives priority to the fragments covering the first
+// headerSize bytes of the payload, for use with OrderHeaderFirst
+func SetHeaderPriority(fragments []Fragment, headerSize int, priority uint8) {
+	sorted, _ := OrderFragments(fragments, OrderSequential)
+
+	covered := 0
+	for _, fragment := range sorted {
+		if covered >= headerSize {
+			break
+		}
+		for i := range fragments {
+			if fragments[i].Index == fragment.Index {
+				fragments[i].Priority = priority
+			}
+		}
+		covered += len(fragment.Data)
+	}
+}
+
+// AvailablePrefix returns the longest prefix of the payload that the received
+// fragments cover contiguously from index 0, so a receiver can start decoding
+// before every fragment arrives. Fragments failing their checksum, keyed with
+// key or plain when key is nil, end the prefix.
+func AvailablePrefix(fragments []Fragment, key *FragmentKey) []byte {
+	byIndex := make(map[uint32]Fragment, len(fragments))
+	for _, fragment := range fragments {
+		byIndex[fragment.Index] = fragment
+	}
+
+	var prefix []byte
+	for index := uint32(0); ; index++ {
+		fragment, ok := byIndex[index]
+		if !ok || !HashEqual(fragmentChecksum(key, fragment), fragment.Checksum) {
+			return prefix
+		}
+		prefix = append(prefix, fragment.Data...)
+	}
+}
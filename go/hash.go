@@ -3,6 +3,7 @@ package topayz512
 import (
 	"crypto/sha512"
 	"encoding/binary"
+	"hash"
 	"sync"
 	"time"
 )
@@ -15,31 +16,73 @@ type HashState struct {
 	buffer    [128]byte
 	bufferLen int
 	totalLen  uint64
+
+	// personal is XORed into the initial state; nil leaves it unpersonalized
+	personal *[8]uint64
+}
+
+// hashIV is the unpersonalized initial state, the SHA-512 initial values
+var hashIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
 }
 
+// hashPersonalDomain separates personalization digests from other hashes
+const hashPersonalDomain = "TOPAY-Z512-PERSONAL"
+
 // NewHashState creates a new hash state
 func NewHashState() *HashState {
+	hashStatesAllocated.Add(1)
 	hs := &HashState{}
 	hs.Reset()
 	return hs
 }
 
-// Reset resets the hash state to initial values
+// Reset resets the hash state to initial values, keeping any personalization
 func (hs *HashState) Reset() {
-	// Initialize with SHA-512 initial values
-	hs.state[0] = 0x6a09e667f3bcc908
-	hs.state[1] = 0xbb67ae8584caa73b
-	hs.state[2] = 0x3c6ef372fe94f82b
-	hs.state[3] = 0xa54ff53a5f1d36f1
-	hs.state[4] = 0x510e527fade682d1
-	hs.state[5] = 0x9b05688c2b3e6c1f
-	hs.state[6] = 0x1f83d9abfb41bd6b
-	hs.state[7] = 0x5be0cd19137e2179
+	hs.state = hashIV
+	if hs.personal != nil {
+		for i := range hs.state {
+			hs.state[i] ^= hs.personal[i]
+		}
+	}
 
 	hs.bufferLen = 0
 	hs.totalLen = 0
 }
 
+// Personalize resets the state with an application-specific personalization
+// mixed into the initial state, in the manner of BLAKE2's personalization
+// parameter. The initial state is the SHA-512 initial values XORed with
+// SHA-512("TOPAY-Z512-PERSONAL" || uint64be(len(personal)) || personal), so
+// hashes under different personalizations are unrelated functions. An empty
+// personalization restores the standard hash.
+func (hs *HashState) Personalize(personal []byte) {
+	hs.personal = personalWords(personal)
+	hs.Reset()
+}
+
+// personalWords returns the words a personalization XORs into the initial
+// state, or nil for an empty personalization
+func personalWords(personal []byte) *[8]uint64 {
+	if len(personal) == 0 {
+		return nil
+	}
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(personal)))
+	digest := sha512.New()
+	digest.Write([]byte(hashPersonalDomain))
+	digest.Write(length[:])
+	digest.Write(personal)
+	sum := digest.Sum(nil)
+
+	words := new([8]uint64)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(sum[i*8:])
+	}
+	return words
+}
+
 // Update adds data to the hash state
 func (hs *HashState) Update(data []byte) {
 	hs.totalLen += uint64(len(data))
@@ -112,15 +155,44 @@ func (hs *HashState) Finalize() Hash {
 	return result
 }
 
+// HashState implements hash.Hash, so it works with io.Copy, io.MultiWriter
+// and other code written against the standard library interfaces
+var _ hash.Hash = (*HashState)(nil)
+
+// Write adds data to the hash state, implementing io.Writer. It never
+// returns an error.
+func (hs *HashState) Write(data []byte) (int, error) {
+	hs.Update(data)
+	return len(data), nil
+}
+
+// Sum appends the hash of everything written so far to b. Unlike Finalize
+// it doesn't change the state, so writing can continue.
+func (hs *HashState) Sum(b []byte) []byte {
+	snapshot := *hs
+	sum := snapshot.Finalize()
+	return append(b, sum[:]...)
+}
+
+// Size returns HashSize
+func (hs *HashState) Size() int {
+	return HashSize
+}
+
+// BlockSize returns the 128-byte block size
+func (hs *HashState) BlockSize() int {
+	return hashBlockSize
+}
+
 // processBlock processes a single 128-byte block with optimizations
 func (hs *HashState) processBlock(block []byte) {
-	// Use optimized SHA-512 implementation with SIMD when available
-	hasher := sha512.New()
-	hasher.Write(block)
-	digest := hasher.Sum(nil)
+	// Use optimized SHA-512 implementation with SIMD when available; the
+	// array-returning form avoids a heap allocation per block
+	sum := sha512.Sum512(block)
+	digest := sum[:]
 
 	// XOR with current state for additional mixing using SIMD
-	if simdCaps.SSE2 && len(digest) >= 64 {
+	if simdCaps.vector() && len(digest) >= 64 {
 		// Process 8 bytes at a time using vectorized XOR
 		for i := 0; i < 8; i++ {
 			val := binary.BigEndian.Uint64(digest[i*8:])
@@ -145,7 +217,9 @@ func ComputeHash(data []byte) Hash {
 	return hs.Finalize()
 }
 
-// HashWithSalt computes the hash with a salt value using optimized operations
+// HashWithSalt computes the hash with a salt value using optimized operations.
+// It hashes salt || data, which is open to length extension, so it must not
+// be used as a MAC with a secret salt; use MAC or NewMAC.
 func HashWithSalt(data, salt []byte) Hash {
 	hs := GetHashState()
 	defer PutHashState(hs)
@@ -166,6 +240,81 @@ func HashMultiple(chunks ...[]byte) Hash {
 	return hs.Finalize()
 }
 
+// ComputePersonalizedHash computes the hash of data under an application
+// personalization; see HashState.Personalize
+func ComputePersonalizedHash(personal, data []byte) Hash {
+	hs := GetHashState()
+	defer PutHashState(hs)
+
+	hs.Personalize(personal)
+	hs.Update(data)
+	return hs.Finalize()
+}
+
+// HashWithDomain computes the hash of data under a domain tag, such as
+// "myapp/v1/block-header", so structurally different objects hashed by one
+// application, or by different protocols, can't collide. It is
+// ComputePersonalizedHash with the domain as the personalization; an empty
+// domain gives the standard hash.
+func HashWithDomain(domain string, data []byte) Hash {
+	return ComputePersonalizedHash([]byte(domain), data)
+}
+
+// Hasher hashes values under one domain tag, computing the personalization
+// once rather than per hash. A Hasher is immutable and safe for concurrent
+// use; HashWithDomain(domain, data) equals NewHasher(domain).Hash(data).
+type Hasher struct {
+	domain   string
+	personal *[8]uint64
+}
+
+// NewHasher returns a Hasher for domain; see HashWithDomain
+func NewHasher(domain string) *Hasher {
+	return &Hasher{domain: domain, personal: personalWords([]byte(domain))}
+}
+
+// Domain returns the Hasher's domain tag
+func (h *Hasher) Domain() string {
+	return h.domain
+}
+
+// state returns a pooled state personalized for the domain
+func (h *Hasher) state() *HashState {
+	hs := GetHashState()
+	hs.personal = h.personal
+	hs.Reset()
+	return hs
+}
+
+// Hash computes the hash of data under the domain
+func (h *Hasher) Hash(data []byte) Hash {
+	hs := h.state()
+	defer PutHashState(hs)
+	hs.Update(data)
+	return hs.Finalize()
+}
+
+// HashFields hashes a structured value under the domain. Each field is
+// prefixed with its uint64 big-endian length, so moving bytes between
+// fields always changes the hash.
+func (h *Hasher) HashFields(fields ...[]byte) Hash {
+	hs := h.state()
+	defer PutHashState(hs)
+	var length [8]byte
+	for _, field := range fields {
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		hs.Update(length[:])
+		hs.Update(field)
+	}
+	return hs.Finalize()
+}
+
+// New returns a streaming hash under the domain. Reset keeps the domain;
+// Close returns its pooled state.
+func (h *Hasher) New() *StreamingHash {
+	return &StreamingHash{state: h.state()}
+}
+
 // HashString computes the hash of a string
 func HashString(s string) Hash {
 	return ComputeHash([]byte(s))
@@ -200,7 +349,9 @@ func BatchHash(inputs [][]byte) []Hash {
 	return OptimizedBatchHash(inputs)
 }
 
-// StreamingHash provides streaming hash computation with memory pooling
+// StreamingHash provides streaming hash computation with memory pooling. A
+// StreamingHash must be used from one goroutine at a time; use
+// SyncStreamingHash to share one between goroutines.
 type StreamingHash struct {
 	state *HashState
 }
@@ -212,20 +363,55 @@ func NewStreamingHash() *StreamingHash {
 	}
 }
 
-// Write adds data to the streaming hash
+// NewPersonalizedHash creates a streaming hash whose initial state mixes in
+// an application-specific personalization string, so applications using
+// different strings can never produce colliding hashes by construction; see
+// HashState.Personalize. Reset keeps the personalization.
+func NewPersonalizedHash(personal []byte) *StreamingHash {
+	state := GetHashState()
+	state.Personalize(personal)
+	return &StreamingHash{state: state}
+}
+
+// Write adds data to the streaming hash. Writes that would take the total
+// past MaxHashInputSize are rejected with ErrTooLarge.
 func (sh *StreamingHash) Write(data []byte) (int, error) {
+	if sh.state == nil {
+		return 0, ErrHashClosed
+	}
+	if uint64(len(data)) > MaxHashInputSize-sh.state.totalLen {
+		return 0, &TooLargeError{Limit: "hash input size", Size: sh.state.totalLen + uint64(len(data)), Max: MaxHashInputSize}
+	}
 	sh.state.Update(data)
 	return len(data), nil
 }
 
-// Sum returns the final hash and resets the state
+// Sum returns the hash of everything written so far. Like hash.Hash it does
+// not change the state, so writing can continue; call Reset to start over.
+// After Close it returns the zero Hash.
 func (sh *StreamingHash) Sum() Hash {
-	result := sh.state.Finalize()
-	sh.state.Reset()
-	return result
+	return sh.Peek()
+}
+
+// Peek returns the hash of everything written so far by finalizing a copy of
+// the state, leaving the stream open for further writes
+func (sh *StreamingHash) Peek() Hash {
+	if sh.state == nil {
+		return Hash{}
+	}
+	snapshot := *sh.state
+	return snapshot.Finalize()
 }
 
-// Close releases resources
+// Reset discards everything written so far
+func (sh *StreamingHash) Reset() {
+	if sh.state != nil {
+		sh.state.Reset()
+	}
+}
+
+// Close returns the pooled state. It is safe to call more than once; later
+// writes fail with ErrHashClosed.
 func (sh *StreamingHash) Close() {
 	if sh.state != nil {
 		PutHashState(sh.state)
@@ -233,6 +419,55 @@ func (sh *StreamingHash) Close() {
 	}
 }
 
+// SyncStreamingHash is a StreamingHash safe for concurrent use. Each Write is
+// absorbed atomically, so concurrent writers never interleave within one
+// call; the order between calls is whatever order they acquire the lock in.
+type SyncStreamingHash struct {
+	sh    StreamingHash
+	mutex sync.Mutex
+}
+
+// NewSyncStreamingHash creates a new concurrency-safe streaming hash
+func NewSyncStreamingHash() *SyncStreamingHash {
+	return &SyncStreamingHash{sh: StreamingHash{state: GetHashState()}}
+}
+
+// Write adds data to the hash
+func (ssh *SyncStreamingHash) Write(data []byte) (int, error) {
+	ssh.mutex.Lock()
+	defer ssh.mutex.Unlock()
+	return ssh.sh.Write(data)
+}
+
+// Sum returns the hash of everything written so far without changing the state
+func (ssh *SyncStreamingHash) Sum() Hash {
+	ssh.mutex.Lock()
+	defer ssh.mutex.Unlock()
+	return ssh.sh.Sum()
+}
+
+// Peek returns the hash of everything written so far without changing the state
+func (ssh *SyncStreamingHash) Peek() Hash {
+	ssh.mutex.Lock()
+	defer ssh.mutex.Unlock()
+	return ssh.sh.Peek()
+}
+
+// Reset discards everything written so far
+func (ssh *SyncStreamingHash) Reset() {
+	ssh.mutex.Lock()
+	defer ssh.mutex.Unlock()
+	ssh.sh.Reset()
+}
+
+// Close returns the pooled state; it is safe to call more than once and
+// from several goroutines
+func (ssh *SyncStreamingHash) Close() {
+	ssh.mutex.Lock()
+	defer ssh.mutex.Unlock()
+	ssh.sh.Close()
+}
+
 // HashBenchmark represents hash performance metrics
 type HashBenchmark struct {
 	ThroughputMBps float64
@@ -379,6 +614,52 @@ func BatchHashWithSalt(inputs [][]byte, salt []byte) []Hash {
 	return results
 }
 
+// BatchHashWithSalts computes HashWithSalt(inputs[i], salts[i]) for every input
+// in parallel. inputs and salts must have the same length.
+func BatchHashWithSalts(inputs, salts [][]byte) ([]Hash, error) {
+	if len(inputs) != len(salts) {
+		return nil, ErrInvalidFragmentCount
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	if err := checkBatchSize(len(inputs)); err != nil {
+		return nil, err
+	}
+
+	results := make([]Hash, len(inputs))
+
+	// Use optimal number of goroutines
+	numWorkers := OptimalThreadCount()
+	if numWorkers > len(inputs) {
+		numWorkers = len(inputs)
+	}
+
+	// Channel for work distribution
+	workChan := make(chan int, len(inputs))
+
+	// Start workers; each writes only its own result slots
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range workChan {
+				results[index] = HashWithSalt(inputs[index], salts[index])
+			}
+		}()
+	}
+
+	// Send work
+	for i := range inputs {
+		workChan <- i
+	}
+	close(workChan)
+
+	wg.Wait()
+	return results, nil
+}
+
 // Hash verification and utilities
 
 // VerifyHash verifies if the given data produces the expected hash
@@ -0,0 +1,163 @@
+package topayz512
+
+import (
+	"math"
+	"sync"
+)
+
+// Hash chains for one-time passwords and hash-based signature building blocks
+
+// hashChainDomain separates hash chain links from other uses of the hash
+const hashChainDomain = "TOPAY-Z512-HASH-CHAIN"
+
+// chainStep advances a hash chain by one link
+func chainStep(link Hash) Hash {
+	return HashConcat([]byte(hashChainDomain), link[:])
+}
+
+// LazyHashChain is a hash chain x_0 = H(seed), x_i+1 = H(x_i) of a fixed length.
+// Links are computed on demand; checkpoints every sqrt(length) links bound the
+// work for any lookup without storing the whole chain.
+type LazyHashChain struct {
+	seed        []byte
+	length      int
+	interval    int
+	checkpoints []Hash
+	cursor      int
+	mutex       sync.Mutex
+}
+
+// HashChain creates a lazy hash chain of length links above the seed. The tip
+// (link length) is published; links are then revealed in reverse order.
+func HashChain(seed []byte, length int) (*LazyHashChain, error) {
+	if len(seed) == 0 {
+		return nil, ErrEmptyData
+	}
+	if length <= 0 {
+		return nil, ErrInvalidChainLength
+	}
+
+	interval := int(math.Ceil(math.Sqrt(float64(length))))
+
+	return &LazyHashChain{
+		seed:     append([]byte(nil), seed...),
+		length:   length,
+		interval: interval,
+		cursor:   length,
+	}, nil
+}
+
+// Length returns the number of links above the seed
+func (hc *LazyHashChain) Length() int {
+	return hc.length
+}
+
+// Tip returns the final link, which is published as the chain commitment
+func (hc *LazyHashChain) Tip() Hash {
+	link, _ := hc.At(hc.length)
+	return link
+}
+
+// At returns link i, where link 0 is the hash of the seed
+func (hc *LazyHashChain) At(i int) (Hash, error) {
+	if i < 0 || i > hc.length {
+		return Hash{}, ErrInvalidChainLength
+	}
+
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.buildCheckpoints()
+
+	checkpoint := i / hc.interval
+	link := hc.checkpoints[checkpoint]
+	for j := checkpoint * hc.interval; j < i; j++ {
+		link = chainStep(link)
+	}
+	return link, nil
+}
+
+// Next returns the next link to reveal, walking from the tip towards the seed.
+// It returns false once every link below the tip has been revealed.
+func (hc *LazyHashChain) Next() (Hash, int, bool) {
+	hc.mutex.Lock()
+	if hc.cursor == 0 {
+		hc.mutex.Unlock()
+		return Hash{}, 0, false
+	}
+	hc.cursor--
+	index := hc.cursor
+	hc.mutex.Unlock()
+
+	link, _ := hc.At(index)
+	return link, index, true
+}
+
+// Remaining returns how many links are left to reveal
+func (hc *LazyHashChain) Remaining() int {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	return hc.cursor
+}
+
+// Checkpoints returns the stored checkpoint links, one every CheckpointInterval links
+func (hc *LazyHashChain) Checkpoints() []Hash {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.buildCheckpoints()
+	checkpoints := make([]Hash, len(hc.checkpoints))
+	copy(checkpoints, hc.checkpoints)
+	return checkpoints
+}
+
+// CheckpointInterval returns the number of links between checkpoints
+func (hc *LazyHashChain) CheckpointInterval() int {
+	return hc.interval
+}
+
+// Wipe erases the seed and all checkpoints. It does nothing for a nil chain.
+func (hc *LazyHashChain) Wipe() {
+	if hc == nil {
+		return
+	}
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	SecureZero(hc.seed)
+	for i := range hc.checkpoints {
+		SecureZero(hc.checkpoints[i][:])
+	}
+	hc.checkpoints = nil
+}
+
+// buildCheckpoints walks the chain once on first use; the caller holds the mutex
+func (hc *LazyHashChain) buildCheckpoints() {
+	if hc.checkpoints != nil {
+		return
+	}
+
+	hc.checkpoints = make([]Hash, 0, hc.length/hc.interval+1)
+	link := ComputeHash(hc.seed)
+	for i := 0; i <= hc.length; i++ {
+		if i%hc.interval == 0 {
+			hc.checkpoints = append(hc.checkpoints, link)
+		}
+		if i < hc.length {
+			link = chainStep(link)
+		}
+	}
+}
+
+// VerifyChainLink checks that hashing preimage distance times yields tip
+func VerifyChainLink(tip, preimage Hash, distance int) bool {
+	if distance < 0 {
+		return false
+	}
+
+	link := preimage
+	for i := 0; i < distance; i++ {
+		link = chainStep(link)
+	}
+	return HashEqual(link, tip)
+}
@@ -0,0 +1,289 @@
+package topayz512
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Hash collections with canonical iteration order
+//
+// Go map iteration order is randomized, which breaks determinism wherever a
+// collection of hashes is encoded or hashed, as consensus code must. These
+// types always iterate and serialize in ascending byte order.
+
+// CompareHash orders hashes by their bytes, returning -1, 0 or 1
+func CompareHash(h1, h2 Hash) int {
+	return bytes.Compare(h1[:], h2[:])
+}
+
+// sortHashes sorts hashes in canonical order
+func sortHashes(hashes []Hash) {
+	sort.Slice(hashes, func(i, j int) bool { return CompareHash(hashes[i], hashes[j]) < 0 })
+}
+
+// HashSet is a set of hashes. The zero value is an empty set ready to use.
+type HashSet struct {
+	items map[Hash]struct{}
+}
+
+// NewHashSet creates a set holding the given hashes
+func NewHashSet(hashes ...Hash) *HashSet {
+	hs := &HashSet{items: make(map[Hash]struct{}, len(hashes))}
+	for _, hash := range hashes {
+		hs.items[hash] = struct{}{}
+	}
+	return hs
+}
+
+// Add inserts a hash, reporting whether it was new
+func (hs *HashSet) Add(hash Hash) bool {
+	if hs.items == nil {
+		hs.items = make(map[Hash]struct{})
+	}
+	if _, ok := hs.items[hash]; ok {
+		return false
+	}
+	hs.items[hash] = struct{}{}
+	return true
+}
+
+// Remove deletes a hash, reporting whether it was present
+func (hs *HashSet) Remove(hash Hash) bool {
+	if _, ok := hs.items[hash]; !ok {
+		return false
+	}
+	delete(hs.items, hash)
+	return true
+}
+
+// Contains reports whether the set holds hash
+func (hs *HashSet) Contains(hash Hash) bool {
+	_, ok := hs.items[hash]
+	return ok
+}
+
+// Len returns the number of hashes in the set
+func (hs *HashSet) Len() int {
+	return len(hs.items)
+}
+
+// Sorted returns the hashes in canonical order
+func (hs *HashSet) Sorted() []Hash {
+	hashes := make([]Hash, 0, len(hs.items))
+	for hash := range hs.items {
+		hashes = append(hashes, hash)
+	}
+	sortHashes(hashes)
+	return hashes
+}
+
+// Range calls fn for each hash in canonical order until fn returns false
+func (hs *HashSet) Range(fn func(hash Hash) bool) {
+	for _, hash := range hs.Sorted() {
+		if !fn(hash) {
+			return
+		}
+	}
+}
+
+// Union returns a new set holding the hashes of both sets
+func (hs *HashSet) Union(other *HashSet) *HashSet {
+	result := NewHashSet()
+	for hash := range hs.items {
+		result.items[hash] = struct{}{}
+	}
+	for hash := range other.items {
+		result.items[hash] = struct{}{}
+	}
+	return result
+}
+
+// Intersection returns a new set holding the hashes in both sets
+func (hs *HashSet) Intersection(other *HashSet) *HashSet {
+	result := NewHashSet()
+	for hash := range hs.items {
+		if other.Contains(hash) {
+			result.items[hash] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Difference returns a new set holding the hashes not in other
+func (hs *HashSet) Difference(other *HashSet) *HashSet {
+	result := NewHashSet()
+	for hash := range hs.items {
+		if !other.Contains(hash) {
+			result.items[hash] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Equal reports whether both sets hold the same hashes
+func (hs *HashSet) Equal(other *HashSet) bool {
+	if hs.Len() != other.Len() {
+		return false
+	}
+	for hash := range hs.items {
+		if !other.Contains(hash) {
+			return false
+		}
+	}
+	return true
+}
+
+// Digest commits to the set's contents independently of insertion order
+func (hs *HashSet) Digest() Hash {
+	state := GetHashState()
+	defer PutHashState(state)
+
+	state.Update([]byte("TOPAY-Z512-HASH-SET"))
+	for _, hash := range hs.Sorted() {
+		state.Update(hash[:])
+	}
+	return state.Finalize()
+}
+
+// MarshalBinary encodes the set as its hashes concatenated in canonical order
+func (hs *HashSet) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, hs.Len()*HashSize)
+	for _, hash := range hs.Sorted() {
+		data = append(data, hash[:]...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a set encoded by MarshalBinary, rejecting input
+// that isn't strictly ascending so every set has one encoding
+func (hs *HashSet) UnmarshalBinary(data []byte) error {
+	if len(data)%HashSize != 0 {
+		return ErrInvalidHashSize
+	}
+
+	items := make(map[Hash]struct{}, len(data)/HashSize)
+	var previous Hash
+	for offset := 0; offset < len(data); offset += HashSize {
+		var hash Hash
+		copy(hash[:], data[offset:])
+		if offset > 0 && CompareHash(previous, hash) >= 0 {
+			return ErrNonCanonicalEncoding
+		}
+		items[hash] = struct{}{}
+		previous = hash
+	}
+	hs.items = items
+	return nil
+}
+
+// MarshalJSON encodes the set as a sorted array of hex hashes
+func (hs *HashSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hs.Sorted())
+}
+
+// UnmarshalJSON decodes an array of hex hashes in any order
+func (hs *HashSet) UnmarshalJSON(data []byte) error {
+	var hashes []Hash
+	if err := json.Unmarshal(data, &hashes); err != nil {
+		return err
+	}
+	*hs = *NewHashSet(hashes...)
+	return nil
+}
+
+// HashMap maps hashes to values. The zero value is an empty map ready to use.
+type HashMap[V any] struct {
+	items map[Hash]V
+}
+
+// hashMapEntry is one serialized HashMap entry
+type hashMapEntry[V any] struct {
+	Key   Hash `json:"key"`
+	Value V    `json:"value"`
+}
+
+// NewHashMap creates an empty map
+func NewHashMap[V any]() *HashMap[V] {
+	return &HashMap[V]{items: make(map[Hash]V)}
+}
+
+// Set stores value under key
+func (hm *HashMap[V]) Set(key Hash, value V) {
+	if hm.items == nil {
+		hm.items = make(map[Hash]V)
+	}
+	hm.items[key] = value
+}
+
+// Get returns the value stored under key
+func (hm *HashMap[V]) Get(key Hash) (V, bool) {
+	value, ok := hm.items[key]
+	return value, ok
+}
+
+// Delete removes key, reporting whether it was present
+func (hm *HashMap[V]) Delete(key Hash) bool {
+	if _, ok := hm.items[key]; !ok {
+		return false
+	}
+	delete(hm.items, key)
+	return true
+}
+
+// Len returns the number of entries
+func (hm *HashMap[V]) Len() int {
+	return len(hm.items)
+}
+
+// Keys returns the keys in canonical order
+func (hm *HashMap[V]) Keys() []Hash {
+	keys := make([]Hash, 0, len(hm.items))
+	for key := range hm.items {
+		keys = append(keys, key)
+	}
+	sortHashes(keys)
+	return keys
+}
+
+// KeySet returns the keys as a set
+func (hm *HashMap[V]) KeySet() *HashSet {
+	return NewHashSet(hm.Keys()...)
+}
+
+// Range calls fn for each entry in canonical key order until fn returns false
+func (hm *HashMap[V]) Range(fn func(key Hash, value V) bool) {
+	for _, key := range hm.Keys() {
+		if !fn(key, hm.items[key]) {
+			return
+		}
+	}
+}
+
+// MarshalJSON encodes the map as an array of key/value entries sorted by key
+func (hm *HashMap[V]) MarshalJSON() ([]byte, error) {
+	entries := make([]hashMapEntry[V], 0, hm.Len())
+	hm.Range(func(key Hash, value V) bool {
+		entries = append(entries, hashMapEntry[V]{Key: key, Value: value})
+		return true
+	})
+	return json.Marshal(entries)
+}
+
+// UnmarshalJSON decodes entries encoded by MarshalJSON, rejecting duplicate keys
+func (hm *HashMap[V]) UnmarshalJSON(data []byte) error {
+	var entries []hashMapEntry[V]
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	items := make(map[Hash]V, len(entries))
+	for _, entry := range entries {
+		if _, ok := items[entry.Key]; ok {
+			return ErrNonCanonicalEncoding
+		}
+		items[entry.Key] = entry.Value
+	}
+	hm.items = items
+	return nil
+}
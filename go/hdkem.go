@@ -0,0 +1,371 @@
+package topayz512
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+)
+
+// Watch-only hierarchical deterministic KEM keys
+//
+// HDKey signing keys need the parent private key for every child, but KEM
+// public keys are Module-LWE samples t̂ = Â ŝ + ê, so a child can be derived
+// from its parent's public key alone: a normal child at index i takes
+//
+//	I = HMAC-SHA512(chain code, parent public key || i)
+//
+// samples a small offset δ from I[:32] and has public key t̂ + Â δ̂ under the
+// same matrix, secret ŝ + δ̂ and chain code I[32:]. Its implicit rejection key
+// is HMAC-SHA512(I[:32], parent rejection key). An ExtendedKEMPublicKey, the
+// public key and chain code, thus lets a receive-only service hand out fresh
+// encryption keys without holding any secret.
+//
+// As with BIP-32 normal derivation, anyone holding an extended public key and
+// one normal child's secret can compute the parent's secret, and children of
+// one extended key share its matrix seed, so they are linkable. Hardened
+// children, i >= 2^31, take I = HMAC-SHA512(chain code, 0x00 || parent
+// rejection key || i) and are fresh key pairs expanded from I[:32], which
+// also resets the noise the offsets add to the secret.
+
+// hdKEMDomain is the HMAC key deriving the master KEM key
+const hdKEMDomain = "TOPAY-Z512-HD-KEM"
+
+// hdKEMKeyGenDomain expands derivation output into a KEM secret key
+const hdKEMKeyGenDomain = "TOPAY-Z512-HD-KEM-KEYGEN"
+
+// MaxWatchOnlyDerivations is the number of normal derivations allowed since
+// the last hardened one. Each offset adds noise to the secret and raises the
+// decapsulation failure rate, so the limit keeps it negligible; it covers the
+// usual account/change/index layout below a hardened account key.
+const MaxWatchOnlyDerivations = 2
+
+// ExtendedKEMPublicKeySize is the size of an encoded ExtendedKEMPublicKey
+const ExtendedKEMPublicKeySize = 1 + 1 + 4 + 32 + KEMPublicKeySize
+
+// HDKEMKey is a KEM key pair with the chain code its children are derived with
+type HDKEMKey struct {
+	ChainCode [32]byte
+	// Depth is the number of derivations from the master key
+	Depth int
+	// Index is the index this key was derived at; zero for the master key
+	Index uint32
+	// Offsets is the number of normal derivations since the last hardened one
+	Offsets int
+
+	publicKey    KEMPublicKey
+	secret       *mlweSecretKey
+	rejectionKey [kemSeedSize]byte
+	erased       bool
+}
+
+// ExtendedKEMPublicKey is a KEM public key with the chain code its normal
+// children are derived with: the watch-only counterpart of an HDKEMKey
+type ExtendedKEMPublicKey struct {
+	PublicKey KEMPublicKey
+	ChainCode [32]byte
+	Depth     int
+	Index     uint32
+	Offsets   int
+}
+
+// newHDKEMKey expands the first 32 bytes of a derivation output I into a
+// fresh key pair with chain code I[32:]
+func newHDKEMKey(digest []byte, depth int, index uint32) *HDKEMKey {
+	var secretKey KEMSecretKey
+	shake256(secretKey[:], []byte(hdKEMKeyGenDomain), digest[:32])
+	defer SecureZero(secretKey[:])
+
+	pk, sk := expandKEMSecretKey(secretKey)
+	key := &HDKEMKey{Depth: depth, Index: index, secret: sk}
+	copy(key.publicKey[:], kemParams.encodePublicKey(pk))
+	copy(key.rejectionKey[:], secretKey[kemSeedSize:])
+	copy(key.ChainCode[:], digest[32:])
+	return key
+}
+
+// NewMasterKEMKey derives the master KEM key of a seed of at least
+// MinSeedSize bytes. It is independent of the master signing key of the
+// same seed.
+func NewMasterKEMKey(seed []byte) (*HDKEMKey, error) {
+	if len(seed) < MinSeedSize {
+		return nil, ErrInvalidKeySize
+	}
+	mac := hmac.New(sha512.New, []byte(hdKEMDomain))
+	mac.Write(seed)
+	digest := mac.Sum(nil)
+	defer SecureZero(digest)
+	return newHDKEMKey(digest, 0, 0), nil
+}
+
+// PublicKey returns the public key of the key
+func (k *HDKEMKey) PublicKey() KEMPublicKey {
+	return k.publicKey
+}
+
+// Extended returns the extended public key, which derives the same normal
+// children as the key without its secret
+func (k *HDKEMKey) Extended() *ExtendedKEMPublicKey {
+	return &ExtendedKEMPublicKey{
+		PublicKey: k.publicKey,
+		ChainCode: k.ChainCode,
+		Depth:     k.Depth,
+		Index:     k.Index,
+		Offsets:   k.Offsets,
+	}
+}
+
+// hdKEMOffset samples the offset δ̂ of a normal child from I[:32], in the
+// NTT domain
+func hdKEMOffset(digest []byte) [][]lwePoly {
+	offset := make([][]lwePoly, kemColumns)
+	var nonce byte
+	for c := range offset {
+		offset[c] = kemParams.sampleVectorNTT(kemEta2, digest[:32], &nonce)
+	}
+	return offset
+}
+
+// wipeHDKEMOffset erases an offset
+func wipeHDKEMOffset(offset [][]lwePoly) {
+	(&mlweSecretKey{s: offset}).wipe()
+}
+
+// hdKEMNormalDigest returns I of the normal child at index
+func hdKEMNormalDigest(chainCode [32]byte, publicKey KEMPublicKey, index uint32) []byte {
+	var serializedIndex [4]byte
+	binary.BigEndian.PutUint32(serializedIndex[:], index)
+	mac := hmac.New(sha512.New, chainCode[:])
+	mac.Write(publicKey[:])
+	mac.Write(serializedIndex[:])
+	return mac.Sum(nil)
+}
+
+// checkNormalChild returns an error if a key at depth with offsets normal
+// derivations can't have a normal child
+func checkNormalChild(depth, offsets int) error {
+	if depth >= MaxHDDepth {
+		return ErrInvalidDerivationPath
+	}
+	if offsets >= MaxWatchOnlyDerivations {
+		return fmt.Errorf("%w: more than %d normal derivations since a hardened one", ErrInvalidDerivationPath, MaxWatchOnlyDerivations)
+	}
+	return nil
+}
+
+// Child derives the child at index; indices from HardenedKeyStart are hardened.
+// It returns ErrKeyDestroyed after Wipe.
+func (k *HDKEMKey) Child(index uint32) (*HDKEMKey, error) {
+	if k.erased {
+		return nil, ErrKeyDestroyed
+	}
+	if index >= HardenedKeyStart {
+		if k.Depth >= MaxHDDepth {
+			return nil, ErrInvalidDerivationPath
+		}
+		var serializedIndex [4]byte
+		binary.BigEndian.PutUint32(serializedIndex[:], index)
+		mac := hmac.New(sha512.New, k.ChainCode[:])
+		mac.Write([]byte{0})
+		mac.Write(k.rejectionKey[:])
+		mac.Write(serializedIndex[:])
+		digest := mac.Sum(nil)
+		defer SecureZero(digest)
+		return newHDKEMKey(digest, k.Depth+1, index), nil
+	}
+
+	if err := checkNormalChild(k.Depth, k.Offsets); err != nil {
+		return nil, err
+	}
+	digest := hdKEMNormalDigest(k.ChainCode, k.publicKey, index)
+	defer SecureZero(digest)
+	offset := hdKEMOffset(digest)
+	defer wipeHDKEMOffset(offset)
+
+	publicKey, err := (&ExtendedKEMPublicKey{PublicKey: k.publicKey}).offsetPublicKey(offset)
+	if err != nil {
+		return nil, err
+	}
+	child := &HDKEMKey{
+		Depth:     k.Depth + 1,
+		Index:     index,
+		Offsets:   k.Offsets + 1,
+		publicKey: publicKey,
+		secret:    &mlweSecretKey{s: make([][]lwePoly, kemColumns)},
+	}
+	for c := range offset {
+		child.secret.s[c] = append([]lwePoly(nil), k.secret.s[c]...)
+		for i := range offset[c] {
+			child.secret.s[c][i].add(&offset[c][i])
+		}
+	}
+
+	mac := hmac.New(sha512.New, digest[:32])
+	mac.Write(k.rejectionKey[:])
+	rejectionKey := mac.Sum(nil)
+	defer SecureZero(rejectionKey)
+	copy(child.rejectionKey[:], rejectionKey)
+	copy(child.ChainCode[:], digest[32:])
+	return child, nil
+}
+
+// Derive follows path from this key
+func (k *HDKEMKey) Derive(path DerivationPath) (*HDKEMKey, error) {
+	if k.erased {
+		return nil, ErrKeyDestroyed
+	}
+	if k.Depth+len(path) > MaxHDDepth {
+		return nil, ErrInvalidDerivationPath
+	}
+	current := k
+	for _, index := range path {
+		child, err := current.Child(index)
+		if current != k {
+			current.Wipe()
+		}
+		if err != nil {
+			return nil, err
+		}
+		current = child
+	}
+	if current == k {
+		copied := *k
+		copied.secret = &mlweSecretKey{s: make([][]lwePoly, kemColumns)}
+		for c := range k.secret.s {
+			copied.secret.s[c] = append([]lwePoly(nil), k.secret.s[c]...)
+		}
+		return &copied, nil
+	}
+	return current, nil
+}
+
+// Decapsulate decapsulates the shared secret of a ciphertext encapsulated to
+// the key's public key, like KEMDecapsulate
+func (k *HDKEMKey) Decapsulate(ciphertext Ciphertext) (SharedSecret, error) {
+	sharedSecret, err := k.decapsulate(ciphertext)
+	auditKEM(KEMOpDecapsulate, k.PublicKey, &ciphertext, err)
+	return sharedSecret, err
+}
+
+// decapsulate implements Decapsulate without auditing
+func (k *HDKEMKey) decapsulate(ciphertext Ciphertext) (SharedSecret, error) {
+	if err := injectFault(FaultDecapsulate); err != nil {
+		return SharedSecret{}, err
+	}
+	if k.erased {
+		return SharedSecret{}, ErrKeyDestroyed
+	}
+	pk, ok := kemParams.decodePublicKey(k.publicKey[:])
+	if !ok {
+		return SharedSecret{}, ErrInvalidKEMPublicKey
+	}
+	return kemDecapsulateExpanded(pk, k.secret, k.rejectionKey[:], ciphertext)
+}
+
+// Wipe erases the secret, rejection key and chain code. It does nothing for
+// a nil key.
+func (k *HDKEMKey) Wipe() {
+	if k == nil {
+		return
+	}
+	if k.secret != nil {
+		k.secret.wipe()
+	}
+	SecureZero(k.rejectionKey[:])
+	SecureZero(k.ChainCode[:])
+	k.erased = true
+}
+
+// Erased reports whether Wipe has been called
+func (k *HDKEMKey) Erased() bool {
+	return k.erased
+}
+
+// offsetPublicKey returns the public key t̂ + Â δ̂
+func (x *ExtendedKEMPublicKey) offsetPublicKey(offset [][]lwePoly) (KEMPublicKey, error) {
+	pk, ok := kemParams.decodePublicKey(x.PublicKey[:])
+	if !ok {
+		return KEMPublicKey{}, ErrInvalidKEMPublicKey
+	}
+	for c := range pk.t {
+		for i := range pk.t[c] {
+			for j := range offset[c] {
+				pk.t[c][i].mulAddNTT(&pk.a[i][j], &offset[c][j])
+			}
+		}
+	}
+	var publicKey KEMPublicKey
+	copy(publicKey[:], kemParams.encodePublicKey(pk))
+	return publicKey, nil
+}
+
+// Child derives the public key of the normal child at index. It returns
+// ErrHardenedDerivation for hardened indices, which need the private key.
+func (x *ExtendedKEMPublicKey) Child(index uint32) (*ExtendedKEMPublicKey, error) {
+	if index >= HardenedKeyStart {
+		return nil, ErrHardenedDerivation
+	}
+	if err := checkNormalChild(x.Depth, x.Offsets); err != nil {
+		return nil, err
+	}
+	digest := hdKEMNormalDigest(x.ChainCode, x.PublicKey, index)
+	offset := hdKEMOffset(digest)
+
+	publicKey, err := x.offsetPublicKey(offset)
+	if err != nil {
+		return nil, err
+	}
+	child := &ExtendedKEMPublicKey{PublicKey: publicKey, Depth: x.Depth + 1, Index: index, Offsets: x.Offsets + 1}
+	copy(child.ChainCode[:], digest[32:])
+	return child, nil
+}
+
+// Derive follows a path of normal indices from this key
+func (x *ExtendedKEMPublicKey) Derive(path DerivationPath) (*ExtendedKEMPublicKey, error) {
+	current := x
+	for _, index := range path {
+		child, err := current.Child(index)
+		if err != nil {
+			return nil, err
+		}
+		current = child
+	}
+	if current == x {
+		copied := *x
+		return &copied, nil
+	}
+	return current, nil
+}
+
+// Bytes encodes the key as depth (1 byte), offsets (1 byte), index (4 bytes),
+// chain code, public key
+func (x *ExtendedKEMPublicKey) Bytes() []byte {
+	data := make([]byte, 6, ExtendedKEMPublicKeySize)
+	data[0] = byte(x.Depth)
+	data[1] = byte(x.Offsets)
+	binary.BigEndian.PutUint32(data[2:6], x.Index)
+	data = append(data, x.ChainCode[:]...)
+	return append(data, x.PublicKey[:]...)
+}
+
+// ExtendedKEMPublicKeyFromBytes decodes a key written by Bytes, rejecting
+// non-canonical public keys
+func ExtendedKEMPublicKeyFromBytes(data []byte) (*ExtendedKEMPublicKey, error) {
+	if len(data) != ExtendedKEMPublicKeySize {
+		return nil, ErrInvalidKeySize
+	}
+	x := &ExtendedKEMPublicKey{
+		Depth:   int(data[0]),
+		Offsets: int(data[1]),
+		Index:   binary.BigEndian.Uint32(data[2:6]),
+	}
+	if x.Offsets > MaxWatchOnlyDerivations || x.Offsets > x.Depth {
+		return nil, ErrInvalidDerivationPath
+	}
+	copy(x.ChainCode[:], data[6:38])
+	copy(x.PublicKey[:], data[38:])
+	if !IsValidKEMPublicKey(x.PublicKey) {
+		return nil, ErrInvalidKEMPublicKey
+	}
+	return x, nil
+}
@@ -0,0 +1,213 @@
+package topayz512
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// Hierarchical deterministic keys with BIP-32 style paths
+//
+// The master key of a seed is the key GenerateKeyPairFromSeed derives, with
+// a chain code of HMAC-SHA512("TOPAY-Z512-HD-CHAIN", seed). A child at index
+// i takes
+//
+//	I = HMAC-SHA512(chain code, 0x00 || parent private key || i)   hardened, i >= 2^31
+//	I = HMAC-SHA512(chain code, parent public key || i)            normal
+//
+// with i as a big-endian uint32, and its private key is
+// HMAC-SHA512(I[:32], parent private key) and its chain code I[32:]. As in
+// BIP-32, the normal derivation only mixes public data into I, but since
+// TOPAY-Z512 signing keys have no algebraic structure both kinds still need
+// the parent private key. Paths use the BIP-32 notation, like m/44'/0'/0'/0/5.
+
+// HardenedKeyStart is the first hardened child index
+const HardenedKeyStart = 0x80000000
+
+// hdChainDomain is the HMAC key deriving the master chain code
+const hdChainDomain = "TOPAY-Z512-HD-CHAIN"
+
+// MaxHDDepth is the deepest path HDKey derives
+const MaxHDDepth = 255
+
+// DerivationPath is a list of child indices from the master key; hardened
+// indices have HardenedKeyStart set
+type DerivationPath []uint32
+
+// ParseDerivationPath parses a path like m/44'/0'/0'/0/5. Hardened indices
+// end in ', h or H; "m" alone is the master key. It returns
+// ErrInvalidDerivationPath for anything else.
+func ParseDerivationPath(path string) (DerivationPath, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" || len(parts)-1 > MaxHDDepth {
+		return nil, ErrInvalidDerivationPath
+	}
+
+	result := make(DerivationPath, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") || strings.HasSuffix(part, "H")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		// Leading zeros and signs would give one index several spellings
+		if part == "" || (len(part) > 1 && part[0] == '0') || part[0] == '+' {
+			return nil, ErrInvalidDerivationPath
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= HardenedKeyStart {
+			return nil, ErrInvalidDerivationPath
+		}
+		if hardened {
+			index += HardenedKeyStart
+		}
+		result = append(result, uint32(index))
+	}
+	return result, nil
+}
+
+// String formats the path in BIP-32 notation, marking hardened indices with '
+func (p DerivationPath) String() string {
+	var sb strings.Builder
+	sb.WriteString("m")
+	for _, index := range p {
+		sb.WriteString("/")
+		if index >= HardenedKeyStart {
+			sb.WriteString(strconv.FormatUint(uint64(index-HardenedKeyStart), 10) + "'")
+		} else {
+			sb.WriteString(strconv.FormatUint(uint64(index), 10))
+		}
+	}
+	return sb.String()
+}
+
+// HDKey is a private key with the chain code its children are derived with
+type HDKey struct {
+	PrivateKey PrivateKey
+	ChainCode  [32]byte
+	// Depth is the number of derivations from the master key
+	Depth int
+	// Index is the index this key was derived at; zero for the master key
+	Index uint32
+
+	erased bool
+}
+
+// NewMasterKey derives the master key of a seed of at least MinSeedSize bytes
+func NewMasterKey(seed []byte) (*HDKey, error) {
+	privateKey, err := DerivePrivateKeyFromSeed(seed, CurrentSeedVersion)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha512.New, []byte(hdChainDomain))
+	mac.Write(seed)
+	digest := mac.Sum(nil)
+	defer SecureZero(digest)
+
+	key := &HDKey{PrivateKey: privateKey}
+	copy(key.ChainCode[:], digest)
+	return key, nil
+}
+
+// PublicKey returns the public key of the key
+func (k *HDKey) PublicKey() PublicKey {
+	return DerivePublicKey(k.PrivateKey)
+}
+
+// Child derives the child at index; indices from HardenedKeyStart are hardened.
+// It returns ErrKeyDestroyed after Wipe.
+func (k *HDKey) Child(index uint32) (*HDKey, error) {
+	if k.erased {
+		return nil, ErrKeyDestroyed
+	}
+	if k.Depth >= MaxHDDepth {
+		return nil, ErrInvalidDerivationPath
+	}
+
+	var serializedIndex [4]byte
+	binary.BigEndian.PutUint32(serializedIndex[:], index)
+	mac := hmac.New(sha512.New, k.ChainCode[:])
+	if index >= HardenedKeyStart {
+		mac.Write([]byte{0})
+		mac.Write(k.PrivateKey[:])
+	} else {
+		publicKey := k.PublicKey()
+		mac.Write(publicKey[:])
+	}
+	mac.Write(serializedIndex[:])
+	digest := mac.Sum(nil)
+	defer SecureZero(digest)
+
+	keyMAC := hmac.New(sha512.New, digest[:32])
+	keyMAC.Write(k.PrivateKey[:])
+	childPrivate := keyMAC.Sum(nil)
+	defer SecureZero(childPrivate)
+
+	child := &HDKey{Depth: k.Depth + 1, Index: index}
+	copy(child.PrivateKey[:], childPrivate)
+	copy(child.ChainCode[:], digest[32:])
+	return child, nil
+}
+
+// Derive follows path from this key
+func (k *HDKey) Derive(path DerivationPath) (*HDKey, error) {
+	if k.erased {
+		return nil, ErrKeyDestroyed
+	}
+	if k.Depth+len(path) > MaxHDDepth {
+		return nil, ErrInvalidDerivationPath
+	}
+	current := k
+	for _, index := range path {
+		child, err := current.Child(index)
+		if current != k {
+			current.Wipe()
+		}
+		if err != nil {
+			return nil, err
+		}
+		current = child
+	}
+	if current == k {
+		copied := *k
+		return &copied, nil
+	}
+	return current, nil
+}
+
+// Wipe erases the private key and chain code. It does nothing for a nil key.
+func (k *HDKey) Wipe() {
+	if k == nil {
+		return
+	}
+	SecureZero(k.PrivateKey[:])
+	SecureZero(k.ChainCode[:])
+	k.erased = true
+}
+
+// Erased reports whether Wipe has been called
+func (k *HDKey) Erased() bool {
+	return k.erased
+}
+
+// DeriveAtPath derives the key pair at a BIP-32 style path, like
+// m/44'/0'/0'/0/5, from a seed of at least MinSeedSize bytes
+func DeriveAtPath(seed []byte, path string) (PrivateKey, PublicKey, error) {
+	parsed, err := ParseDerivationPath(path)
+	if err != nil {
+		return PrivateKey{}, PublicKey{}, err
+	}
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return PrivateKey{}, PublicKey{}, err
+	}
+	defer master.Wipe()
+
+	key, err := master.Derive(parsed)
+	if err != nil {
+		return PrivateKey{}, PublicKey{}, err
+	}
+	defer key.Wipe()
+	return key.PrivateKey, key.PublicKey(), nil
+}
@@ -0,0 +1,178 @@
+package topayz512
+
+import "hash"
+
+// HMAC and HKDF (RFC 2104, RFC 5869) over the TOPAY-Z512 hash
+
+// hashBlockSize is the block size of the hash compression function
+const hashBlockSize = 128
+
+// hkdfSharedSecretSalt is the HKDF salt for keys derived from shared secrets
+const hkdfSharedSecretSalt = "TOPAY-Z512-HKDF"
+
+// MaxHKDFLength is the most output one HKDF expansion produces: 255 hash blocks
+const MaxHKDFLength = 255 * HashSize
+
+// hmacPads returns the inner and outer HMAC key blocks. Keys longer than a
+// block are hashed first, as RFC 2104 requires.
+func hmacPads(key []byte) (ipad, opad [hashBlockSize]byte) {
+	if len(key) > hashBlockSize {
+		digest := ComputeHash(key)
+		copy(ipad[:], digest[:])
+		SecureZero(digest[:])
+	} else {
+		copy(ipad[:], key)
+	}
+	copy(opad[:], ipad[:])
+	for i := range ipad {
+		ipad[i] ^= 0x36
+		opad[i] ^= 0x5c
+	}
+	return ipad, opad
+}
+
+// hmacHash computes HMAC over the concatenated chunks
+func hmacHash(key []byte, chunks ...[]byte) Hash {
+	ipad, opad := hmacPads(key)
+
+	hs := GetHashState()
+	defer PutHashState(hs)
+	hs.Update(ipad[:])
+	for _, chunk := range chunks {
+		hs.Update(chunk)
+	}
+	inner := hs.Finalize()
+
+	hs.Reset()
+	hs.Update(opad[:])
+	hs.Update(inner[:])
+	outer := hs.Finalize()
+
+	SecureZero(ipad[:])
+	SecureZero(opad[:])
+	SecureZero(inner[:])
+	return outer
+}
+
+// MAC computes HMAC-Z512, HMAC (RFC 2104) over the TOPAY-Z512 hash, of data
+// under key. Unlike HashWithSalt, which only prefixes the salt, it resists
+// length extension and is safe as a message authentication code.
+func MAC(key, data []byte) Hash {
+	return hmacHash(key, data)
+}
+
+// VerifyMAC reports whether tag is the HMAC-Z512 of data under key,
+// comparing in constant time
+func VerifyMAC(key, data, tag []byte) bool {
+	expected := hmacHash(key, data)
+	defer SecureZero(expected[:])
+	return ConstantTimeEqual(expected[:], tag)
+}
+
+// hmacState is a streaming HMAC-Z512. The key blocks are absorbed once, and
+// Reset and Sum restart from copies of those states.
+type hmacState struct {
+	inner      HashState
+	innerStart HashState
+	outerStart HashState
+}
+
+// NewMAC returns a streaming HMAC-Z512 keyed with key, a hash.Hash whose Sum
+// appends the tag MAC computes for the data written. Compare tags with
+// hmac.Equal or ConstantTimeEqual, never bytes.Equal.
+func NewMAC(key []byte) hash.Hash {
+	ipad, opad := hmacPads(key)
+	defer SecureZero(ipad[:])
+	defer SecureZero(opad[:])
+
+	m := &hmacState{}
+	m.innerStart.Reset()
+	m.innerStart.Update(ipad[:])
+	m.outerStart.Reset()
+	m.outerStart.Update(opad[:])
+	m.inner = m.innerStart
+	return m
+}
+
+// Write adds data to the MAC. It never returns an error.
+func (m *hmacState) Write(data []byte) (int, error) {
+	m.inner.Update(data)
+	return len(data), nil
+}
+
+// Sum appends the tag of everything written so far to b without changing
+// the state
+func (m *hmacState) Sum(b []byte) []byte {
+	inner := m.inner
+	innerHash := inner.Finalize()
+	outer := m.outerStart
+	outer.Update(innerHash[:])
+	tag := outer.Finalize()
+	SecureZero(innerHash[:])
+	return append(b, tag[:]...)
+}
+
+// Reset discards everything written, keeping the key
+func (m *hmacState) Reset() {
+	m.inner = m.innerStart
+}
+
+// Size returns HashSize
+func (m *hmacState) Size() int {
+	return HashSize
+}
+
+// BlockSize returns the 128-byte block size
+func (m *hmacState) BlockSize() int {
+	return hashBlockSize
+}
+
+// HKDFExtract computes the HKDF pseudorandom key from input keying material
+// and an optional salt; a nil salt stands for HashSize zero bytes
+func HKDFExtract(salt, secret []byte) Hash {
+	if len(salt) == 0 {
+		salt = make([]byte, HashSize)
+	}
+	return hmacHash(salt, secret)
+}
+
+// HKDFExpand expands a pseudorandom key into length bytes bound to info.
+// Distinct info strings give independent outputs, and a shorter output is a
+// prefix of a longer one for the same info. It returns ErrInvalidKeySize for
+// a negative length and ErrTooLarge above MaxHKDFLength.
+func HKDFExpand(prk Hash, info []byte, length int) ([]byte, error) {
+	if length < 0 {
+		return nil, ErrInvalidKeySize
+	}
+	if length > MaxHKDFLength {
+		return nil, &TooLargeError{Limit: "HKDF output", Size: uint64(length), Max: uint64(MaxHKDFLength)}
+	}
+
+	output := make([]byte, 0, length+HashSize)
+	var block Hash
+	for counter := 1; len(output) < length; counter++ {
+		if counter == 1 {
+			block = hmacHash(prk[:], info, []byte{byte(counter)})
+		} else {
+			block = hmacHash(prk[:], block[:], info, []byte{byte(counter)})
+		}
+		output = append(output, block[:]...)
+	}
+	SecureZero(block[:])
+	SecureZero(output[length:])
+	return output[:length:length], nil
+}
+
+// Derive derives length bytes of key material for the purpose named by info
+// with HKDF, so one KEM exchange can key several primitives (an encryption
+// key, a MAC key, an IV) independently instead of using the raw secret. The
+// HKDF salt is "TOPAY-Z512-HKDF". A secret erased with SecureEraseSharedSecret
+// returns ErrKeyDestroyed.
+func (ss SharedSecret) Derive(info []byte, length int) ([]byte, error) {
+	if isErased(ss[:]) {
+		return nil, ErrKeyDestroyed
+	}
+	prk := HKDFExtract([]byte(hkdfSharedSecretSalt), ss[:])
+	defer SecureZero(prk[:])
+	return HKDFExpand(prk, info, length)
+}
@@ -0,0 +1,216 @@
+package topayz512
+
+import (
+	"crypto/ecdh"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/params"
+)
+
+// Hybrid X25519 + TOPAY-Z512 KEM
+//
+// A hybrid encapsulation runs an X25519 exchange against an ephemeral key and
+// a TOPAY-Z512 KEM encapsulation, and combines the two secrets as
+//
+//	SHAKE256("TOPAY-Z512-HYBRID" || ss_KEM || ss_X25519 || ct_X25519 || pk_X25519, 64)
+//
+// following the X-Wing combiner. The result stays secret as long as either
+// X25519 or the lattice KEM is unbroken.
+
+// hybridDomain separates hybrid shared secrets from other hashes
+const hybridDomain = "TOPAY-Z512-HYBRID"
+
+// x25519KeySize is the size of an X25519 key or shared secret
+const x25519KeySize = int(params.X25519KeySize)
+
+// HybridPublicKey is an X25519 public key followed by a KEM public key
+type HybridPublicKey [HybridPublicKeySize]byte
+
+// HybridCiphertext is an ephemeral X25519 public key followed by a KEM
+// ciphertext
+type HybridCiphertext [HybridCiphertextSize]byte
+
+// HybridKEM is a hybrid key pair holding an X25519 key and a KEM key
+type HybridKEM struct {
+	x25519    *ecdh.PrivateKey
+	kemSecret KEMSecretKey
+	public    HybridPublicKey
+	erased    bool
+}
+
+// NewHybridKEM generates a hybrid key pair
+func NewHybridKEM() (*HybridKEM, error) {
+	x25519, err := generateX25519Key()
+	if err != nil {
+		return nil, err
+	}
+	kemPublic, kemSecret, err := KEMKeyGen()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HybridKEM{x25519: x25519, kemSecret: kemSecret}
+	copy(h.public[:], x25519.PublicKey().Bytes())
+	copy(h.public[x25519KeySize:], kemPublic[:])
+	return h, nil
+}
+
+// PublicKey returns the hybrid public key to publish
+func (h *HybridKEM) PublicKey() HybridPublicKey {
+	return h.public
+}
+
+// Decapsulate recovers the combined shared secret of a hybrid ciphertext. It
+// returns ErrKeyDestroyed after Wipe.
+func (h *HybridKEM) Decapsulate(ciphertext HybridCiphertext) (SharedSecret, error) {
+	if h.erased {
+		return SharedSecret{}, ErrKeyDestroyed
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ciphertext[:x25519KeySize])
+	if err != nil {
+		return SharedSecret{}, err
+	}
+	classical, err := h.x25519.ECDH(ephemeral)
+	if err != nil {
+		return SharedSecret{}, err
+	}
+	defer SecureZero(classical)
+
+	var kemCiphertext Ciphertext
+	copy(kemCiphertext[:], ciphertext[x25519KeySize:])
+	postQuantum, err := KEMDecapsulate(h.kemSecret, kemCiphertext)
+	if err != nil {
+		return SharedSecret{}, err
+	}
+	defer SecureEraseSharedSecret(&postQuantum)
+
+	return hybridCombine(postQuantum, classical, ciphertext[:x25519KeySize], h.public[:x25519KeySize]), nil
+}
+
+// Wipe erases the secret keys. It does nothing for a nil key pair.
+func (h *HybridKEM) Wipe() {
+	if h == nil {
+		return
+	}
+	SecureEraseKEMSecretKey(&h.kemSecret)
+	h.x25519 = nil
+	h.erased = true
+}
+
+// Erased reports whether Wipe has been called
+func (h *HybridKEM) Erased() bool {
+	return h.erased
+}
+
+// HybridEncapsulate encapsulates a combined shared secret to a hybrid public key
+func HybridEncapsulate(publicKey HybridPublicKey) (HybridCiphertext, SharedSecret, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey[:x25519KeySize])
+	if err != nil {
+		return HybridCiphertext{}, SharedSecret{}, err
+	}
+	ephemeral, err := generateX25519Key()
+	if err != nil {
+		return HybridCiphertext{}, SharedSecret{}, err
+	}
+	classical, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return HybridCiphertext{}, SharedSecret{}, err
+	}
+	defer SecureZero(classical)
+
+	kemCiphertext, postQuantum, err := KEMEncapsulate(publicKey.KEMPublicKey())
+	if err != nil {
+		return HybridCiphertext{}, SharedSecret{}, err
+	}
+	defer SecureEraseSharedSecret(&postQuantum)
+
+	var ciphertext HybridCiphertext
+	copy(ciphertext[:], ephemeral.PublicKey().Bytes())
+	copy(ciphertext[x25519KeySize:], kemCiphertext[:])
+	return ciphertext, hybridCombine(postQuantum, classical, ciphertext[:x25519KeySize], publicKey[:x25519KeySize]), nil
+}
+
+// generateX25519Key generates an X25519 key from the library's random source
+func generateX25519Key() (*ecdh.PrivateKey, error) {
+	seed := make([]byte, x25519KeySize)
+	if err := readRandom(seed); err != nil {
+		return nil, err
+	}
+	defer SecureZero(seed)
+	return ecdh.X25519().NewPrivateKey(seed)
+}
+
+// hybridCombine derives the hybrid shared secret from both component secrets
+func hybridCombine(postQuantum SharedSecret, classical, ephemeralPublic, recipientPublic []byte) SharedSecret {
+	var sharedSecret SharedSecret
+	shake256(sharedSecret[:], []byte(hybridDomain), postQuantum[:], classical, ephemeralPublic, recipientPublic)
+	return sharedSecret
+}
+
+// Bytes returns a newly allocated copy of a HybridPublicKey.
+//
+// Deprecated: use AppendBytes or CopyTo.
+func (hpk HybridPublicKey) Bytes() []byte {
+	return append([]byte(nil), hpk[:]...)
+}
+
+// AppendBytes appends the bytes of a HybridPublicKey to dst and returns the extended slice
+func (hpk HybridPublicKey) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, hpk[:])
+}
+
+// CopyTo copies a HybridPublicKey into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than HybridPublicKeySize
+func (hpk HybridPublicKey) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, hpk[:])
+}
+
+// KEMPublicKey returns the KEM component of a hybrid public key
+func (hpk HybridPublicKey) KEMPublicKey() KEMPublicKey {
+	var kemPublic KEMPublicKey
+	copy(kemPublic[:], hpk[x25519KeySize:])
+	return kemPublic
+}
+
+// Bytes returns a newly allocated copy of a HybridCiphertext.
+//
+// Deprecated: use AppendBytes or CopyTo.
+func (hc HybridCiphertext) Bytes() []byte {
+	return append([]byte(nil), hc[:]...)
+}
+
+// AppendBytes appends the bytes of a HybridCiphertext to dst and returns the extended slice
+func (hc HybridCiphertext) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, hc[:])
+}
+
+// CopyTo copies a HybridCiphertext into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than HybridCiphertextSize
+func (hc HybridCiphertext) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, hc[:])
+}
+
+// HybridPublicKeyFromBytes parses a hybrid public key, checking both components
+func HybridPublicKeyFromBytes(data []byte) (HybridPublicKey, error) {
+	if len(data) != HybridPublicKeySize {
+		return HybridPublicKey{}, ErrInvalidKeySize
+	}
+	var publicKey HybridPublicKey
+	copy(publicKey[:], data)
+	if _, err := ecdh.X25519().NewPublicKey(data[:x25519KeySize]); err != nil {
+		return HybridPublicKey{}, err
+	}
+	if !IsValidKEMPublicKey(publicKey.KEMPublicKey()) {
+		return HybridPublicKey{}, ErrInvalidKEMPublicKey
+	}
+	return publicKey, nil
+}
+
+// HybridCiphertextFromBytes parses a hybrid ciphertext
+func HybridCiphertextFromBytes(data []byte) (HybridCiphertext, error) {
+	if len(data) != HybridCiphertextSize {
+		return HybridCiphertext{}, ErrInvalidCiphertextSize
+	}
+	var ciphertext HybridCiphertext
+	copy(ciphertext[:], data)
+	return ciphertext, nil
+}
@@ -0,0 +1,211 @@
+package topayz512
+
+import (
+	"crypto/ed25519"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/params"
+)
+
+// Hybrid Ed25519 + TOPAY-Z512 signatures
+//
+// A hybrid signature is an Ed25519 signature and a stateless hash-based
+// signature over the same payload
+//
+//	"TOPAY-Z512-HYBRID-SIG" || hybrid public key || message
+//
+// and is valid only if both are. Signing the full hybrid public key binds the
+// two signatures together, so neither can be stripped off and presented as a
+// plain signature of the same message. The result stays unforgeable as long
+// as either Ed25519 or the hash-based scheme is unbroken.
+
+// hybridSignatureDomain separates hybrid signature payloads from other messages
+const hybridSignatureDomain = "TOPAY-Z512-HYBRID-SIG"
+
+// ed25519Size is the size of an Ed25519 public key
+const ed25519Size = int(params.Ed25519PublicKeySize)
+
+// The Ed25519 sizes in params must match crypto/ed25519
+var (
+	_ = [1]struct{}{}[ed25519.PublicKeySize-int(params.Ed25519PublicKeySize)]
+	_ = [1]struct{}{}[ed25519.SignatureSize-int(params.Ed25519SignatureSize)]
+)
+
+// HybridSignaturePublicKey is an Ed25519 public key followed by a key pair
+// public key
+type HybridSignaturePublicKey [HybridSignaturePublicKeySize]byte
+
+// HybridSignature is an Ed25519 signature followed by a signature made by Sign
+type HybridSignature [HybridSignatureSize]byte
+
+// HybridSigner holds an Ed25519 key and a key pair private key
+type HybridSigner struct {
+	classical   ed25519.PrivateKey
+	postQuantum PrivateKey
+	public      HybridSignaturePublicKey
+	erased      bool
+}
+
+// NewHybridSigner generates a hybrid signing key
+func NewHybridSigner() (*HybridSigner, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if err := readRandom(seed); err != nil {
+		return nil, err
+	}
+	defer SecureZero(seed)
+	privateKey, _, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	defer SecureErasePrivateKey(&privateKey)
+	return HybridSignerFromKeys(ed25519.NewKeyFromSeed(seed), privateKey)
+}
+
+// HybridSignerFromKeys combines an existing Ed25519 key with a key pair
+// private key, so a deployment can keep its classical identity while adding
+// the post-quantum one
+func HybridSignerFromKeys(classical ed25519.PrivateKey, postQuantum PrivateKey) (*HybridSigner, error) {
+	if len(classical) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidKeySize
+	}
+	if !IsValidPrivateKey(postQuantum) {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	h := &HybridSigner{
+		classical:   append(ed25519.PrivateKey(nil), classical...),
+		postQuantum: postQuantum,
+	}
+	copy(h.public[:], classical.Public().(ed25519.PublicKey))
+	pqPublic := DerivePublicKey(postQuantum)
+	copy(h.public[ed25519Size:], pqPublic[:])
+	return h, nil
+}
+
+// PublicKey returns the hybrid public key to publish
+func (h *HybridSigner) PublicKey() HybridSignaturePublicKey {
+	return h.public
+}
+
+// Sign signs message with both keys. It returns ErrKeyDestroyed after Wipe.
+func (h *HybridSigner) Sign(message []byte) (HybridSignature, error) {
+	if h.erased {
+		return HybridSignature{}, ErrKeyDestroyed
+	}
+	payload := hybridSignaturePayload(h.public, message)
+
+	var signature HybridSignature
+	copy(signature[:], ed25519.Sign(h.classical, payload))
+	pqSignature, err := Sign(h.postQuantum, payload)
+	if err != nil {
+		return HybridSignature{}, err
+	}
+	copy(signature[ed25519.SignatureSize:], pqSignature[:])
+	return signature, nil
+}
+
+// Wipe erases both private keys. It does nothing for a nil signer.
+func (h *HybridSigner) Wipe() {
+	if h == nil {
+		return
+	}
+	SecureZero(h.classical)
+	SecureErasePrivateKey(&h.postQuantum)
+	h.erased = true
+}
+
+// Erased reports whether Wipe has been called
+func (h *HybridSigner) Erased() bool {
+	return h.erased
+}
+
+// VerifyHybrid reports whether both component signatures of signature are
+// valid for message under publicKey
+func VerifyHybrid(publicKey HybridSignaturePublicKey, message []byte, signature HybridSignature) bool {
+	payload := hybridSignaturePayload(publicKey, message)
+	classicalValid := ed25519.Verify(publicKey.Ed25519PublicKey(), payload, signature[:ed25519.SignatureSize])
+
+	var pqSignature Signature
+	copy(pqSignature[:], signature[ed25519.SignatureSize:])
+	// Both are always checked, so timing doesn't reveal which one failed
+	pqValid := Verify(publicKey.PublicKey(), payload, pqSignature)
+	return classicalValid && pqValid
+}
+
+// hybridSignaturePayload returns the payload both component signatures cover
+func hybridSignaturePayload(publicKey HybridSignaturePublicKey, message []byte) []byte {
+	payload := make([]byte, 0, len(hybridSignatureDomain)+HybridSignaturePublicKeySize+len(message))
+	payload = append(payload, hybridSignatureDomain...)
+	payload = append(payload, publicKey[:]...)
+	return append(payload, message...)
+}
+
+// Bytes returns a newly allocated copy of a HybridSignaturePublicKey.
+//
+// Deprecated: use AppendBytes or CopyTo.
+func (hpk HybridSignaturePublicKey) Bytes() []byte {
+	return append([]byte(nil), hpk[:]...)
+}
+
+// AppendBytes appends the bytes of a HybridSignaturePublicKey to dst and returns the extended slice
+func (hpk HybridSignaturePublicKey) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, hpk[:])
+}
+
+// CopyTo copies a HybridSignaturePublicKey into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than HybridSignaturePublicKeySize
+func (hpk HybridSignaturePublicKey) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, hpk[:])
+}
+
+// Ed25519PublicKey returns the Ed25519 component of a hybrid public key
+func (hpk HybridSignaturePublicKey) Ed25519PublicKey() ed25519.PublicKey {
+	return append(ed25519.PublicKey(nil), hpk[:ed25519Size]...)
+}
+
+// PublicKey returns the post-quantum component of a hybrid public key
+func (hpk HybridSignaturePublicKey) PublicKey() PublicKey {
+	var publicKey PublicKey
+	copy(publicKey[:], hpk[ed25519Size:])
+	return publicKey
+}
+
+// Bytes returns a newly allocated copy of a HybridSignature.
+//
+// Deprecated: use AppendBytes or CopyTo.
+func (hs HybridSignature) Bytes() []byte {
+	return append([]byte(nil), hs[:]...)
+}
+
+// AppendBytes appends the bytes of a HybridSignature to dst and returns the extended slice
+func (hs HybridSignature) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, hs[:])
+}
+
+// CopyTo copies a HybridSignature into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than HybridSignatureSize
+func (hs HybridSignature) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, hs[:])
+}
+
+// HybridSignaturePublicKeyFromBytes parses a hybrid signature public key
+func HybridSignaturePublicKeyFromBytes(data []byte) (HybridSignaturePublicKey, error) {
+	if len(data) != HybridSignaturePublicKeySize {
+		return HybridSignaturePublicKey{}, ErrInvalidKeySize
+	}
+	var publicKey HybridSignaturePublicKey
+	copy(publicKey[:], data)
+	if !IsValidPublicKey(publicKey.PublicKey()) {
+		return HybridSignaturePublicKey{}, ErrInvalidKeySize
+	}
+	return publicKey, nil
+}
+
+// HybridSignatureFromBytes parses a hybrid signature
+func HybridSignatureFromBytes(data []byte) (HybridSignature, error) {
+	if len(data) != HybridSignatureSize {
+		return HybridSignature{}, ErrInvalidSignatureSize
+	}
+	var signature HybridSignature
+	copy(signature[:], data)
+	return signature, nil
+}
@@ -0,0 +1,224 @@
+package topayz512
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/params"
+)
+
+// Sortable, collision-resistant identifiers
+
+// ID constants
+const (
+	// IDSize is the size of an identifier in bytes
+	IDSize = int(params.IDSize)
+
+	// IDStringLength is the length of the Crockford base32 form of an identifier
+	IDStringLength = 26
+
+	// idTimeSize is the number of leading bytes holding the millisecond timestamp
+	idTimeSize = 6
+)
+
+// crockfordAlphabet is the base32 alphabet used for identifier strings
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ID is a 128-bit identifier laid out like a ULID: a 48-bit big-endian
+// millisecond timestamp followed by 80 random bits. IDs created by NewID sort
+// by creation time both as bytes and as strings.
+type ID [IDSize]byte
+
+// idGenerator keeps IDs from one process strictly increasing within a millisecond
+var idGenerator struct {
+	mutex    sync.Mutex
+	lastTime uint64
+	last     ID
+}
+
+// NewID generates a new time-ordered identifier using the library's secure RNG
+func NewID() (ID, error) {
+	return newIDAt(time.Now())
+}
+
+// newIDAt generates an identifier for the given creation time
+func newIDAt(t time.Time) (ID, error) {
+	ms := uint64(t.UnixMilli())
+
+	idGenerator.mutex.Lock()
+	defer idGenerator.mutex.Unlock()
+
+	var id ID
+	if ms <= idGenerator.lastTime {
+		// Same (or earlier) millisecond: increment the previous random part so
+		// IDs stay monotonic without waiting for the clock
+		id = idGenerator.last
+		for i := IDSize - 1; i >= idTimeSize; i-- {
+			id[i]++
+			if id[i] != 0 {
+				break
+			}
+			if i == idTimeSize {
+				return ID{}, ErrIDOverflow
+			}
+		}
+	} else {
+		random, err := SecureRandom(IDSize - idTimeSize)
+		if err != nil {
+			return ID{}, err
+		}
+		putIDTime(&id, ms)
+		copy(id[idTimeSize:], random)
+		idGenerator.lastTime = ms
+	}
+
+	idGenerator.last = id
+	return id, nil
+}
+
+// IDFromHash derives a content-addressed identifier from a hash. The same
+// content always maps to the same ID; such IDs carry no timestamp.
+func IDFromHash(h Hash) ID {
+	digest := HashConcat([]byte("TOPAY-Z512-ID"), h[:])
+
+	var id ID
+	copy(id[:], digest[:IDSize])
+	return id
+}
+
+// IDFromBytes creates an ID from bytes
+func IDFromBytes(data []byte) (ID, error) {
+	if len(data) != IDSize {
+		return ID{}, ErrInvalidIDEncoding
+	}
+
+	var id ID
+	copy(id[:], data)
+	return id, nil
+}
+
+// ParseID parses the Crockford base32 form of an identifier, case-insensitively
+func ParseID(s string) (ID, error) {
+	if len(s) != IDStringLength {
+		return ID{}, ErrInvalidIDEncoding
+	}
+
+	// The 26 characters carry 130 bits; the two leading bits must be zero
+	var id ID
+	var acc uint32
+	var bits uint
+	out := 0
+	for i := 0; i < len(s); i++ {
+		value := crockfordValue(s[i])
+		if value < 0 || (i == 0 && value > 7) {
+			return ID{}, ErrInvalidIDEncoding
+		}
+
+		acc = acc<<5 | uint32(value)
+		bits += 5
+		if i == 0 {
+			bits -= 2
+		}
+		for bits >= 8 {
+			bits -= 8
+			id[out] = byte(acc >> bits)
+			out++
+		}
+		acc &= 1<<bits - 1
+	}
+
+	return id, nil
+}
+
+// crockfordValue returns the value of a base32 character, or -1 if invalid
+func crockfordValue(c byte) int {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch c {
+	case 'O':
+		return 0
+	case 'I', 'L':
+		return 1
+	}
+	if i := bytes.IndexByte([]byte(crockfordAlphabet), c); i >= 0 {
+		return i
+	}
+	return -1
+}
+
+// String returns the 26-character Crockford base32 representation of an ID
+func (id ID) String() string {
+	out := make([]byte, IDStringLength)
+
+	// Emit 5 bits at a time from a 130-bit big-endian value with two leading zero bits
+	var acc uint32
+	bits := uint(2)
+	in := 0
+	for i := range out {
+		for bits < 5 {
+			acc = acc<<8 | uint32(id[in])
+			in++
+			bits += 8
+		}
+		bits -= 5
+		out[i] = crockfordAlphabet[(acc>>bits)&0x1F]
+		acc &= 1<<bits - 1
+	}
+
+	return string(out)
+}
+
+// Bytes returns a newly allocated copy of an ID.
+//
+// Deprecated: use AppendBytes or CopyTo.
+func (id ID) Bytes() []byte {
+	return id[:]
+}
+
+// AppendBytes appends the bytes of an ID to dst and returns the extended slice
+func (id ID) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, id[:])
+}
+
+// CopyTo copies an ID into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than IDSize
+func (id ID) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, id[:])
+}
+
+// Time returns the creation time encoded in an ID created by NewID
+func (id ID) Time() time.Time {
+	var buf [8]byte
+	copy(buf[8-idTimeSize:], id[:idTimeSize])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(buf[:])))
+}
+
+// Compare returns -1, 0 or +1 depending on whether id sorts before, with or after other
+func (id ID) Compare(other ID) int {
+	return bytes.Compare(id[:], other[:])
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (id *ID) UnmarshalText(text []byte) error {
+	parsed, err := ParseID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// putIDTime stores a 48-bit millisecond timestamp in the leading bytes of id
+func putIDTime(id *ID, ms uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], ms)
+	copy(id[:idTimeSize], buf[8-idTimeSize:])
+}
@@ -0,0 +1,220 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// Keccak sponge (FIPS 202) for the SHAKE and SHA-3 functions the lattice KEMs
+// are built on. The standard library only gained crypto/sha3 after the Go
+// release this module targets, so the permutation is implemented here.
+
+// Sponge rates in bytes
+const (
+	shake128Rate = 168
+	shake256Rate = 136
+	sha3_256Rate = 136
+	sha3_512Rate = 72
+)
+
+// FIPS 202 domain separation and padding bytes
+const (
+	shakeDomain = 0x1f
+	sha3Domain  = 0x06
+)
+
+// keccakRoundConstants are the iota constants of the 24 rounds
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// keccakRotations and keccakLanes drive the combined rho and pi steps: lane
+// keccakLanes[i] receives the previous lane rotated by keccakRotations[i]
+var (
+	keccakRotations = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	keccakLanes     = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+// keccakF1600 applies the Keccak-f[1600] permutation to a
+func keccakF1600(a *[25]uint64) {
+	var c [5]uint64
+	for round := 0; round < 24; round++ {
+		// theta
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d := c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+			for y := 0; y < 25; y += 5 {
+				a[y+x] ^= d
+			}
+		}
+
+		// rho and pi
+		current := a[1]
+		for i := 0; i < 24; i++ {
+			lane := keccakLanes[i]
+			current, a[lane] = a[lane], bits.RotateLeft64(current, keccakRotations[i])
+		}
+
+		// chi
+		for y := 0; y < 25; y += 5 {
+			copy(c[:], a[y:y+5])
+			for x := 0; x < 5; x++ {
+				a[y+x] = c[x] ^ (^c[(x+1)%5] & c[(x+2)%5])
+			}
+		}
+
+		// iota
+		a[0] ^= keccakRoundConstants[round]
+	}
+}
+
+// keccakState is a Keccak sponge. Writes absorb input until the first Read,
+// which pads the input and switches to squeezing.
+type keccakState struct {
+	a         [25]uint64
+	rate      int
+	domain    byte
+	offset    int
+	squeezing bool
+}
+
+// newShake128 returns a SHAKE128 sponge
+func newShake128() *keccakState {
+	return &keccakState{rate: shake128Rate, domain: shakeDomain}
+}
+
+// newShake256 returns a SHAKE256 sponge
+func newShake256() *keccakState {
+	return &keccakState{rate: shake256Rate, domain: shakeDomain}
+}
+
+// xorByte XORs b into the state at byte position pos
+func (s *keccakState) xorByte(pos int, b byte) {
+	s.a[pos/8] ^= uint64(b) << (8 * (pos % 8))
+}
+
+// Write absorbs p. It panics if called after Read.
+func (s *keccakState) Write(p []byte) (int, error) {
+	if s.squeezing {
+		panic("topayz512: write to keccak sponge after read")
+	}
+	written := len(p)
+	for len(p) > 0 {
+		if s.offset == 0 && len(p) >= s.rate {
+			for i := 0; i < s.rate/8; i++ {
+				s.a[i] ^= binary.LittleEndian.Uint64(p[8*i:])
+			}
+			keccakF1600(&s.a)
+			p = p[s.rate:]
+			continue
+		}
+		s.xorByte(s.offset, p[0])
+		s.offset++
+		p = p[1:]
+		if s.offset == s.rate {
+			keccakF1600(&s.a)
+			s.offset = 0
+		}
+	}
+	return written, nil
+}
+
+// Read squeezes len(p) bytes of output
+func (s *keccakState) Read(p []byte) (int, error) {
+	if !s.squeezing {
+		s.xorByte(s.offset, s.domain)
+		s.xorByte(s.rate-1, 0x80)
+		keccakF1600(&s.a)
+		s.offset = 0
+		s.squeezing = true
+	}
+	for i := range p {
+		if s.offset == s.rate {
+			keccakF1600(&s.a)
+			s.offset = 0
+		}
+		p[i] = byte(s.a[s.offset/8] >> (8 * (s.offset % 8)))
+		s.offset++
+	}
+	return len(p), nil
+}
+
+// Reset clears the sponge for reuse with the same function
+func (s *keccakState) Reset() {
+	s.a = [25]uint64{}
+	s.offset = 0
+	s.squeezing = false
+}
+
+// shake256 fills out with SHAKE256 of the concatenated inputs
+func shake256(out []byte, inputs ...[]byte) {
+	s := newShake256()
+	for _, input := range inputs {
+		s.Write(input)
+	}
+	s.Read(out)
+	s.Reset()
+}
+
+// sha3Sum256 returns SHA3-256 of the concatenated inputs
+func sha3Sum256(inputs ...[]byte) [32]byte {
+	s := &keccakState{rate: sha3_256Rate, domain: sha3Domain}
+	for _, input := range inputs {
+		s.Write(input)
+	}
+	var out [32]byte
+	s.Read(out[:])
+	s.Reset()
+	return out
+}
+
+// sha3Sum512 returns SHA3-512 of the concatenated inputs
+func sha3Sum512(inputs ...[]byte) [64]byte {
+	s := &keccakState{rate: sha3_512Rate, domain: sha3Domain}
+	for _, input := range inputs {
+		s.Write(input)
+	}
+	var out [64]byte
+	s.Read(out[:])
+	s.Reset()
+	return out
+}
+
+// sha3Hash adapts the SHA3-512 sponge to hash.Hash
+type sha3Hash struct {
+	keccakState
+}
+
+// NewLegacySHA3Hash returns a SHA3-512 hash.Hash. Releases before the current
+// hash construction published SHA3-512 digests from their pkg/hash package;
+// this lets tools recognize those digests and replace them. New code should
+// use ComputeHash.
+func NewLegacySHA3Hash() hash.Hash {
+	return &sha3Hash{keccakState{rate: sha3_512Rate, domain: sha3Domain}}
+}
+
+// Sum appends the digest to b without changing the state
+func (h *sha3Hash) Sum(b []byte) []byte {
+	snapshot := h.keccakState
+	var out [64]byte
+	snapshot.Read(out[:])
+	return append(b, out[:]...)
+}
+
+// Size returns the 64-byte digest size
+func (h *sha3Hash) Size() int {
+	return 64
+}
+
+// BlockSize returns the sponge rate
+func (h *sha3Hash) BlockSize() int {
+	return h.rate
+}
@@ -1,9 +1,9 @@
 package topayz512
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -27,8 +27,13 @@ type KEMDecryptResult struct {
 	KeySize      uint32    `json:"key_size"`
 }
 
-// Encapsulate performs key encapsulation with the public key using optimizations
+// Encapsulate performs key encapsulation with the public key using
+// optimizations. It is a placeholder guarded by checkPlaceholder; use
+// KEMEncapsulate with a KEM key pair instead
 func Encapsulate(publicKey *PublicKey) (*KEMResult, error) {
+	if err := checkPlaceholder(PlaceholderKEM); err != nil {
+		return nil, err
+	}
 	if publicKey == nil {
 		return nil, errors.New("public key cannot be nil")
 	}
@@ -40,7 +45,7 @@ func Encapsulate(publicKey *PublicKey) (*KEMResult, error) {
 
 	// Generate shared secret using pooled buffer
 	sharedSecret := GetBuffer(SharedSecretSize)
-	if _, err := rand.Read(sharedSecret); err != nil {
+	if err := readRandom(sharedSecret); err != nil {
 		PutBuffer(sharedSecret)
 		return nil, err
 	}
@@ -61,8 +66,13 @@ func Encapsulate(publicKey *PublicKey) (*KEMResult, error) {
 	}, nil
 }
 
-// Decapsulate performs key decapsulation with the private key using optimizations
+// Decapsulate performs key decapsulation with the private key using
+// optimizations. It is a placeholder guarded by checkPlaceholder; use
+// KEMDecapsulate with a KEM key pair instead
 func Decapsulate(ciphertext []byte, privateKey *PrivateKey) (*KEMDecryptResult, error) {
+	if err := checkPlaceholder(PlaceholderKEM); err != nil {
+		return nil, err
+	}
 	if privateKey == nil {
 		return nil, errors.New("private key cannot be nil")
 	}
@@ -101,10 +111,10 @@ func encryptSharedSecret(sharedSecret []byte, publicKey *PublicKey) ([]byte, err
 	ciphertext := GetBuffer(CiphertextSize)
 
 	// Combine shared secret with public key data using SIMD operations
-	keyData := publicKey.Bytes()
+	keyData := publicKey[:]
 
 	// Use optimized XOR operation with SIMD when available
-	if simdCaps.SSE2 && len(sharedSecret) >= 16 && len(keyData) >= len(sharedSecret) {
+	if simdCaps.vector() && len(sharedSecret) >= 16 && len(keyData) >= len(sharedSecret) {
 		VectorizedXOR(ciphertext[:len(sharedSecret)], sharedSecret, keyData[:len(sharedSecret)])
 	} else {
 		// Fallback to scalar XOR
@@ -120,7 +130,7 @@ func encryptSharedSecret(sharedSecret []byte, publicKey *PublicKey) ([]byte, err
 	// Pad to full ciphertext size with secure random data
 	if len(ciphertext) > len(sharedSecret)+HashSize {
 		padding := ciphertext[len(sharedSecret)+HashSize:]
-		if _, err := rand.Read(padding); err != nil {
+		if err := readRandom(padding); err != nil {
 			PutBuffer(ciphertext)
 			return nil, err
 		}
@@ -143,9 +153,9 @@ func decryptSharedSecret(ciphertext []byte, privateKey *PrivateKey) ([]byte, err
 	sharedSecret := GetBuffer(SharedSecretSize)
 
 	// Decrypt using private key with SIMD optimization
-	keyData := privateKey.Bytes()
+	keyData := privateKey[:]
 
-	if simdCaps.SSE2 && len(encryptedSecret) >= 16 && len(keyData) >= len(encryptedSecret) {
+	if simdCaps.vector() && len(encryptedSecret) >= 16 && len(keyData) >= len(encryptedSecret) {
 		VectorizedXOR(sharedSecret, encryptedSecret, keyData[:len(encryptedSecret)])
 	} else {
 		// Fallback to scalar XOR
@@ -164,146 +174,263 @@ func decryptSharedSecret(ciphertext []byte, privateKey *PrivateKey) ([]byte, err
 	return sharedSecret, nil
 }
 
+// TOPAY-Z512 KEM parameters
+//
+// The KEM is the Fujisaki-Okamoto transform with implicit rejection of the
+// Module-LWE encryption in mlwe.go, as in FIPS 203, at module rank 8: twice
+// the lattice dimension of ML-KEM-1024. Two secret columns carry a 512-bit
+// message, so the 64-byte shared secret has full entropy. The secrets use
+// CBD(2) noise, the encryption errors CBD(1), u is kept at 12 bits and v is
+// compressed to 6; the decryption failure probability is about 2^-149.
+//
+// A secret key is the pair of 64-byte seeds d || z. Key generation expands d
+// with SHAKE256 into the matrix seed rho and the noise seed sigma; z is the
+// implicit rejection key. Hashes G, H and J of FIPS 203 are SHAKE256 with the
+// kemDomain* prefixes. A 32-byte recipient tag bound to H(pk) follows the
+// encryption so decapsulation can report ErrWrongRecipient.
+const (
+	kemRank        = 8
+	kemColumns     = 2
+	kemEta1        = 2
+	kemEta2        = 1
+	kemDU          = 12
+	kemDV          = 6
+	kemSeedSize    = 64
+	kemTagSize     = 32
+	kemMessageSize = kemColumns * lweMessageBytes
+	kemBodySize    = lweN / 8 * (kemDU*kemRank + kemDV*kemColumns)
+)
+
+// KEM hash domains
+const (
+	kemDomainKeyGen    = "TOPAY-Z512-KEM-KEYGEN"
+	kemDomainH         = "TOPAY-Z512-KEM-H"
+	kemDomainG         = "TOPAY-Z512-KEM-G"
+	kemDomainJ         = "TOPAY-Z512-KEM-J"
+	kemDomainRecipient = "TOPAY-Z512-KEM-RECIPIENT"
+	kemDomainContext   = "TOPAY-Z512-KEM-CONTEXT"
+)
+
+// kemParams is the Module-LWE instance behind the KEM
+var kemParams = mlweParams{k: kemRank, columns: kemColumns, eta1: kemEta1, eta2: kemEta2, du: kemDU, dv: kemDV}
+
+// Compile-time checks that the KEM sizes match the parameters
+var (
+	_ = [1]struct{}{}[KEMPublicKeySize-(kemColumns*kemRank*lwePolyBytes+lweSeedSize)]
+	_ = [1]struct{}{}[KEMSecretKeySize-2*kemSeedSize]
+	_ = [1]struct{}{}[CiphertextSize-(kemBodySize+kemTagSize)]
+	_ = [1]struct{}{}[SharedSecretSize-kemMessageSize]
+)
+
 // KEMKeyGen generates a new KEM key pair
 func KEMKeyGen() (KEMPublicKey, KEMSecretKey, error) {
-	// Generate random secret key
-	secretBytes, err := SecureRandom(KEMSecretKeySize)
-	if err != nil {
+	var secretKey KEMSecretKey
+	if err := readRandom(secretKey[:]); err != nil {
 		return KEMPublicKey{}, KEMSecretKey{}, err
 	}
 
+	publicKey := deriveKEMPublicKey(secretKey)
+
+	auditKEM(KEMOpKeyGen, func() KEMPublicKey { return publicKey }, nil, nil)
+	return publicKey, secretKey, nil
+}
+
+// KEMKeyGenFromSeed returns the KEM key pair of a KEMSecretKeySize-byte seed.
+// The seed becomes the secret key, so it must be secret and uniformly random;
+// fixed seeds are for known-answer tests. It returns ErrInvalidKeySize for a
+// seed of another size and ErrInvalidKEMSecretKey for an all-zero one.
+func KEMKeyGenFromSeed(seed []byte) (KEMPublicKey, KEMSecretKey, error) {
+	if len(seed) != KEMSecretKeySize {
+		return KEMPublicKey{}, KEMSecretKey{}, fmt.Errorf("%w: seed is %d bytes, want %d", ErrInvalidKeySize, len(seed), KEMSecretKeySize)
+	}
 	var secretKey KEMSecretKey
-	copy(secretKey[:], secretBytes)
+	copy(secretKey[:], seed)
+	if !IsValidKEMSecretKey(secretKey) {
+		return KEMPublicKey{}, KEMSecretKey{}, ErrInvalidKEMSecretKey
+	}
 
-	// Derive public key from secret key
 	publicKey := deriveKEMPublicKey(secretKey)
-
+	auditKEM(KEMOpKeyGen, func() KEMPublicKey { return publicKey }, nil, nil)
 	return publicKey, secretKey, nil
 }
 
+// expandKEMSecretKey derives the lattice key pair of a secret key
+func expandKEMSecretKey(secretKey KEMSecretKey) (*mlwePublicKey, *mlweSecretKey) {
+	var seeds [lweSeedSize + kemSeedSize]byte
+	shake256(seeds[:], []byte(kemDomainKeyGen), secretKey[:kemSeedSize])
+	pk, sk := kemParams.keyGen(seeds[:lweSeedSize], seeds[lweSeedSize:])
+	SecureZero(seeds[:])
+	return pk, sk
+}
+
 // deriveKEMPublicKey derives a KEM public key from a secret key
 func deriveKEMPublicKey(secretKey KEMSecretKey) KEMPublicKey {
-	// Use SHA-256 based key derivation for KEM public key
-	hasher := sha256.New()
-	hasher.Write(secretKey[:])
-	hasher.Write([]byte("TOPAY-Z512-KEM-PUBLIC-KEY"))
+	pk, sk := expandKEMSecretKey(secretKey)
+	sk.wipe()
 
-	firstHash := hasher.Sum(nil)
+	var publicKey KEMPublicKey
+	copy(publicKey[:], kemParams.encodePublicKey(pk))
+	return publicKey
+}
 
-	// Second round for additional security
-	hasher.Reset()
-	hasher.Write(firstHash)
-	hasher.Write(secretKey[:])
-	hasher.Write([]byte("KEM-DERIVATION-ROUND-2"))
-	secondHash := hasher.Sum(nil)
+// kemPublicKeyHash returns H(pk)
+func kemPublicKeyHash(publicKey []byte) []byte {
+	h := make([]byte, kemSeedSize)
+	shake256(h, []byte(kemDomainH), publicKey)
+	return h
+}
 
-	var publicKey KEMPublicKey
-	copy(publicKey[:], secondHash)
+// kemDeriveKeyAndCoins returns G(m || H(pk)): the shared secret and the
+// encryption coins
+func kemDeriveKeyAndCoins(message, publicKeyHash []byte) (SharedSecret, []byte) {
+	out := make([]byte, SharedSecretSize+kemSeedSize)
+	shake256(out, []byte(kemDomainG), message, publicKeyHash)
 
-	return publicKey
+	var sharedSecret SharedSecret
+	copy(sharedSecret[:], out)
+	SecureZero(out[:SharedSecretSize])
+	return sharedSecret, out[SharedSecretSize:]
 }
 
-// KEMEncapsulate encapsulates a shared secret using the public key
+// KEMEncapsulate encapsulates a shared secret using the public key. It
+// returns ErrInvalidKEMPublicKey if the key isn't a canonical encoding.
 func KEMEncapsulate(publicKey KEMPublicKey) (Ciphertext, SharedSecret, error) {
-	// Generate random ephemeral key
-	ephemeralBytes, err := SecureRandom(32)
+	ciphertext, sharedSecret, err := kemEncapsulate(publicKey)
 	if err != nil {
 		return Ciphertext{}, SharedSecret{}, err
 	}
 
-	// Derive shared secret from ephemeral key and public key
-	hasher := sha256.New()
-	hasher.Write(ephemeralBytes)
-	hasher.Write(publicKey[:])
-	hasher.Write([]byte("TOPAY-Z512-KEM-SHARED-SECRET"))
-
-	sharedSecretHash := hasher.Sum(nil)
-
-	var sharedSecret SharedSecret
-	copy(sharedSecret[:], sharedSecretHash)
-
-	// Create ciphertext by encrypting ephemeral key with public key
-	ciphertext := createCiphertext(ephemeralBytes, publicKey)
-
+	auditKEM(KEMOpEncapsulate, func() KEMPublicKey { return publicKey }, &ciphertext, nil)
 	return ciphertext, sharedSecret, nil
 }
 
-// KEMDecapsulate decapsulates the shared secret using the secret key
-func KEMDecapsulate(secretKey KEMSecretKey, ciphertext Ciphertext) (SharedSecret, error) {
-	// Derive public key from secret key for verification
-	publicKey := deriveKEMPublicKey(secretKey)
-
-	// Decrypt ephemeral key from ciphertext
-	ephemeralBytes, err := decryptCiphertext(ciphertext, secretKey)
+// KEMEncapsulateDerandomized encapsulates to publicKey with a caller-chosen
+// SharedSecretSize-byte message instead of a random one. Encapsulation is
+// deterministic in the message, and anyone who knows the message can compute
+// the shared secret, so it is for known-answer tests and test fixtures only.
+// It returns ErrInvalidKeySize for a message of another size.
+func KEMEncapsulateDerandomized(publicKey KEMPublicKey, message []byte) (Ciphertext, SharedSecret, error) {
+	if len(message) != kemMessageSize {
+		return Ciphertext{}, SharedSecret{}, fmt.Errorf("%w: message is %d bytes, want %d", ErrInvalidKeySize, len(message), kemMessageSize)
+	}
+	ciphertext, sharedSecret, err := kemEncapsulateMessage(publicKey, message)
 	if err != nil {
-		return SharedSecret{}, ErrDecapsulationFailed
+		return Ciphertext{}, SharedSecret{}, err
 	}
 
-	// Derive shared secret from ephemeral key and public key
-	hasher := sha256.New()
-	hasher.Write(ephemeralBytes)
-	hasher.Write(publicKey[:])
-	hasher.Write([]byte("TOPAY-Z512-KEM-SHARED-SECRET"))
-
-	sharedSecretHash := hasher.Sum(nil)
-
-	var sharedSecret SharedSecret
-	copy(sharedSecret[:], sharedSecretHash)
+	auditKEM(KEMOpEncapsulate, func() KEMPublicKey { return publicKey }, &ciphertext, nil)
+	return ciphertext, sharedSecret, nil
+}
 
-	return sharedSecret, nil
+// kemEncapsulate implements KEMEncapsulate without auditing
+func kemEncapsulate(publicKey KEMPublicKey) (Ciphertext, SharedSecret, error) {
+	message := make([]byte, kemMessageSize)
+	if err := readRandom(message); err != nil {
+		return Ciphertext{}, SharedSecret{}, err
+	}
+	defer SecureZero(message)
+	return kemEncapsulateMessage(publicKey, message)
 }
 
-// createCiphertext creates a ciphertext by encrypting ephemeral key with public key
-func createCiphertext(ephemeralKey []byte, publicKey KEMPublicKey) Ciphertext {
-	// Simple XOR-based encryption for demonstration
-	// In production, use proper lattice-based encryption
-	hasher := sha256.New()
-	hasher.Write(publicKey[:])
-	hasher.Write([]byte("TOPAY-Z512-KEM-ENCRYPTION-KEY"))
+// kemEncapsulateMessage encapsulates to publicKey with a chosen message
+func kemEncapsulateMessage(publicKey KEMPublicKey, message []byte) (Ciphertext, SharedSecret, error) {
+	pk, ok := kemParams.decodePublicKey(publicKey[:])
+	if !ok {
+		return Ciphertext{}, SharedSecret{}, ErrInvalidKEMPublicKey
+	}
 
-	encryptionKey := hasher.Sum(nil)
+	publicKeyHash := kemPublicKeyHash(publicKey[:])
+	sharedSecret, coins := kemDeriveKeyAndCoins(message, publicKeyHash)
+	defer SecureZero(coins)
 
 	var ciphertext Ciphertext
+	copy(ciphertext[:], kemParams.encrypt(pk, message, coins))
+	copy(ciphertext[kemBodySize:], ciphertextRecipientTag(ciphertext[:kemBodySize], publicKeyHash))
+	return ciphertext, sharedSecret, nil
+}
+
+// KEMDecapsulate decapsulates the shared secret using the secret key. A
+// ciphertext tampered with after encapsulation yields an unrelated secret
+// rather than an error, so failures reveal nothing about the secret key. A
+// key erased with SecureEraseKEMSecretKey returns ErrKeyDestroyed.
+func KEMDecapsulate(secretKey KEMSecretKey, ciphertext Ciphertext) (SharedSecret, error) {
+	sharedSecret, err := kemDecapsulate(secretKey, ciphertext)
+	auditKEM(KEMOpDecapsulate, func() KEMPublicKey { return deriveKEMPublicKey(secretKey) }, &ciphertext, err)
+	return sharedSecret, err
+}
 
-	// XOR ephemeral key with derived encryption key
-	for i := 0; i < len(ephemeralKey) && i < CiphertextSize; i++ {
-		ciphertext[i] = ephemeralKey[i] ^ encryptionKey[i%len(encryptionKey)]
+// kemDecapsulate implements KEMDecapsulate without auditing
+func kemDecapsulate(secretKey KEMSecretKey, ciphertext Ciphertext) (SharedSecret, error) {
+	if err := injectFault(FaultDecapsulate); err != nil {
+		return SharedSecret{}, err
+	}
+	if isErased(secretKey[:]) {
+		return SharedSecret{}, ErrKeyDestroyed
 	}
 
-	// Fill remaining bytes with hash of the encrypted portion
-	if len(ephemeralKey) < CiphertextSize {
-		hasher.Reset()
-		hasher.Write(ciphertext[:len(ephemeralKey)])
-		hasher.Write(publicKey[:])
-		fillHash := hasher.Sum(nil)
+	pk, sk := expandKEMSecretKey(secretKey)
+	defer sk.wipe()
+	return kemDecapsulateExpanded(pk, sk, secretKey[kemSeedSize:], ciphertext)
+}
 
-		for i := len(ephemeralKey); i < CiphertextSize; i++ {
-			ciphertext[i] = fillHash[i%len(fillHash)]
-		}
+// kemDecryptMessage decrypts the message a ciphertext encapsulates, without
+// the re-encryption check or implicit rejection. The caller must treat the
+// message as unauthenticated until re-encapsulating it reproduces ciphertext.
+func kemDecryptMessage(secretKey KEMSecretKey, ciphertext Ciphertext) ([]byte, error) {
+	if isErased(secretKey[:]) {
+		return nil, ErrKeyDestroyed
 	}
 
-	return ciphertext
+	pk, sk := expandKEMSecretKey(secretKey)
+	defer sk.wipe()
+	body := ciphertext[:kemBodySize]
+	if !ConstantTimeEqual(ciphertext[kemBodySize:], ciphertextRecipientTag(body, kemPublicKeyHash(kemParams.encodePublicKey(pk)))) {
+		return nil, ErrWrongRecipient
+	}
+	return kemParams.decrypt(sk, body), nil
 }
 
-// decryptCiphertext decrypts the ciphertext to recover ephemeral key
-func decryptCiphertext(ciphertext Ciphertext, secretKey KEMSecretKey) ([]byte, error) {
-	// Derive public key from secret key
-	publicKey := deriveKEMPublicKey(secretKey)
+// kemDecapsulateExpanded decapsulates with an expanded key pair and the
+// implicit rejection key z
+func kemDecapsulateExpanded(pk *mlwePublicKey, sk *mlweSecretKey, rejectionKey []byte, ciphertext Ciphertext) (SharedSecret, error) {
+	// Decapsulating with another key would silently yield a different
+	// secret, so reject ciphertexts bound to another recipient explicitly.
+	// The tag depends only on public data, so the check leaks nothing.
+	publicKeyHash := kemPublicKeyHash(kemParams.encodePublicKey(pk))
+	body := ciphertext[:kemBodySize]
+	if !ConstantTimeEqual(ciphertext[kemBodySize:], ciphertextRecipientTag(body, publicKeyHash)) {
+		return SharedSecret{}, ErrWrongRecipient
+	}
 
-	// Derive encryption key
-	hasher := sha256.New()
-	hasher.Write(publicKey[:])
-	hasher.Write([]byte("TOPAY-Z512-KEM-ENCRYPTION-KEY"))
+	message := kemParams.decrypt(sk, body)
+	defer SecureZero(message)
+	sharedSecret, coins := kemDeriveKeyAndCoins(message, publicKeyHash)
+	defer SecureZero(coins)
 
-	encryptionKey := hasher.Sum(nil)
+	// Implicit rejection: re-encrypt and fall back to J(z || c) on mismatch
+	var rejection SharedSecret
+	shake256(rejection[:], []byte(kemDomainJ), rejectionKey, body)
+	reencrypted := kemParams.encrypt(pk, message, coins)
+	subtle.ConstantTimeCopy(1-subtle.ConstantTimeCompare(reencrypted, body), sharedSecret[:], rejection[:])
+	SecureZero(rejection[:])
 
-	// Decrypt ephemeral key (assuming 32 bytes)
-	ephemeralKey := make([]byte, 32)
-	for i := 0; i < len(ephemeralKey); i++ {
-		ephemeralKey[i] = ciphertext[i] ^ encryptionKey[i%len(encryptionKey)]
-	}
+	return sharedSecret, nil
+}
+
+// ciphertextRecipientTag returns the tag closing a ciphertext, binding its
+// encryption to the recipient's public key hash
+func ciphertextRecipientTag(body, publicKeyHash []byte) []byte {
+	tag := make([]byte, kemTagSize)
+	shake256(tag, []byte(kemDomainRecipient), publicKeyHash, body)
+	return tag
+}
 
-	return ephemeralKey, nil
+// CiphertextMatchesRecipient reports whether a ciphertext was encapsulated to
+// publicKey, letting multi-key deployments route ciphertexts without trying
+// every secret key
+func CiphertextMatchesRecipient(ciphertext Ciphertext, publicKey KEMPublicKey) bool {
+	tag := ciphertextRecipientTag(ciphertext[:kemBodySize], kemPublicKeyHash(publicKey[:]))
+	return ConstantTimeEqual(ciphertext[kemBodySize:], tag)
 }
 
 // Batch KEM operations
@@ -323,6 +450,9 @@ func BatchKEMKeyGen(count int) ([]KEMPublicKey, []KEMSecretKey, error) {
 	if count <= 0 {
 		return nil, nil, ErrInvalidFragmentCount
 	}
+	if err := checkBatchSize(count); err != nil {
+		return nil, nil, err
+	}
 
 	publicKeys := make([]KEMPublicKey, count)
 	secretKeys := make([]KEMSecretKey, count)
@@ -386,6 +516,9 @@ func BatchKEMEncapsulate(publicKeys []KEMPublicKey) ([]Ciphertext, []SharedSecre
 	if len(publicKeys) == 0 {
 		return nil, nil, ErrEmptyData
 	}
+	if err := checkBatchSize(len(publicKeys)); err != nil {
+		return nil, nil, err
+	}
 
 	ciphertexts := make([]Ciphertext, len(publicKeys))
 	sharedSecrets := make([]SharedSecret, len(publicKeys))
@@ -449,6 +582,9 @@ func BatchKEMDecapsulate(secretKeys []KEMSecretKey, ciphertexts []Ciphertext) ([
 	if len(secretKeys) != len(ciphertexts) {
 		return nil, ErrInvalidFragmentCount
 	}
+	if err := checkBatchSize(len(secretKeys)); err != nil {
+		return nil, err
+	}
 
 	if len(secretKeys) == 0 {
 		return nil, ErrEmptyData
@@ -516,10 +652,15 @@ func VerifyKEMKeyPair(publicKey KEMPublicKey, secretKey KEMSecretKey) bool {
 	return ConstantTimeEqual(publicKey[:], derivedPublic[:])
 }
 
-// IsValidKEMPublicKey checks if a KEM public key is valid
+// IsValidKEMPublicKey checks if a KEM public key is valid: non-zero, with
+// every coefficient reduced mod q
 func IsValidKEMPublicKey(publicKey KEMPublicKey) bool {
 	var zero KEMPublicKey
-	return !ConstantTimeEqual(publicKey[:], zero[:])
+	if ConstantTimeEqual(publicKey[:], zero[:]) {
+		return false
+	}
+	_, ok := kemParams.decodePublicKey(publicKey[:])
+	return ok
 }
 
 // IsValidKEMSecretKey checks if a KEM secret key is valid
@@ -564,22 +705,62 @@ func SharedSecretEqual(ss1, ss2 SharedSecret) bool {
 
 // Secure erasure functions
 
-// SecureEraseKEMSecretKey securely erases a KEM secret key from memory
+// SecureEraseKEMSecretKey securely erases a KEM secret key from memory. It
+// does nothing for a nil key.
 func SecureEraseKEMSecretKey(secretKey *KEMSecretKey) {
+	if secretKey == nil {
+		return
+	}
 	SecureZero(secretKey[:])
 }
 
-// SecureEraseSharedSecret securely erases a shared secret from memory
+// SecureEraseKEMPublicKey erases a KEM public key copy. It does nothing for a
+// nil key.
+func SecureEraseKEMPublicKey(publicKey *KEMPublicKey) {
+	if publicKey == nil {
+		return
+	}
+	SecureZero(publicKey[:])
+}
+
+// SecureEraseSharedSecret securely erases a shared secret from memory. It
+// does nothing for a nil secret.
 func SecureEraseSharedSecret(sharedSecret *SharedSecret) {
+	if sharedSecret == nil {
+		return
+	}
 	SecureZero(sharedSecret[:])
 }
 
-// SecureEraseKEMKeyPair securely erases a KEM key pair from memory
+// SecureEraseKEMKeyPair securely erases a KEM key pair from memory. It does
+// nothing for a nil pair.
 func SecureEraseKEMKeyPair(keyPair *KEMKeyPair) {
+	if keyPair == nil {
+		return
+	}
 	SecureZero(keyPair.Public[:])
 	SecureZero(keyPair.Secret[:])
 }
 
+// SecureEraseKEMResult erases the shared secret and ciphertext of an
+// encapsulation result. It does nothing for a nil result.
+func SecureEraseKEMResult(result *KEMResult) {
+	if result == nil {
+		return
+	}
+	SecureZero(result.SharedSecret)
+	SecureZero(result.Ciphertext)
+}
+
+// SecureEraseKEMDecryptResult erases the shared secret of a decapsulation
+// result. It does nothing for a nil result.
+func SecureEraseKEMDecryptResult(result *KEMDecryptResult) {
+	if result == nil {
+		return
+	}
+	SecureZero(result.SharedSecret)
+}
+
 // KEM performance benchmarking
 
 // KEMBenchmark represents KEM performance metrics
@@ -640,54 +821,34 @@ func BenchmarkKEM(iterations int) KEMBenchmark {
 
 // Advanced KEM operations
 
-// KEMWithContext performs KEM operations with additional context data
+// KEMWithContext performs KEM operations with additional context data. The
+// ciphertext is an ordinary encapsulation; the shared secret is additionally
+// bound to context, so both sides must supply the same context
 func KEMWithContext(publicKey KEMPublicKey, context []byte) (Ciphertext, SharedSecret, error) {
-	// Generate random ephemeral key
-	ephemeralBytes, err := SecureRandom(32)
+	ciphertext, sharedSecret, err := kemEncapsulate(publicKey)
 	if err != nil {
 		return Ciphertext{}, SharedSecret{}, err
 	}
+	defer SecureEraseSharedSecret(&sharedSecret)
 
-	// Derive shared secret with context
-	hasher := sha256.New()
-	hasher.Write(ephemeralBytes)
-	hasher.Write(publicKey[:])
-	hasher.Write(context)
-	hasher.Write([]byte("TOPAY-Z512-KEM-CONTEXT-SECRET"))
-
-	sharedSecretHash := hasher.Sum(nil)
-
-	var sharedSecret SharedSecret
-	copy(sharedSecret[:], sharedSecretHash)
-
-	// Create ciphertext
-	ciphertext := createCiphertext(ephemeralBytes, publicKey)
-
-	return ciphertext, sharedSecret, nil
+	auditKEM(KEMOpEncapsulate, func() KEMPublicKey { return publicKey }, &ciphertext, nil)
+	return ciphertext, kemContextSecret(sharedSecret, context), nil
 }
 
 // KEMDecapsulateWithContext decapsulates with additional context data
 func KEMDecapsulateWithContext(secretKey KEMSecretKey, ciphertext Ciphertext, context []byte) (SharedSecret, error) {
-	// Derive public key from secret key
-	publicKey := deriveKEMPublicKey(secretKey)
-
-	// Decrypt ephemeral key from ciphertext
-	ephemeralBytes, err := decryptCiphertext(ciphertext, secretKey)
+	sharedSecret, err := kemDecapsulate(secretKey, ciphertext)
+	auditKEM(KEMOpDecapsulate, func() KEMPublicKey { return deriveKEMPublicKey(secretKey) }, &ciphertext, err)
 	if err != nil {
-		return SharedSecret{}, ErrDecapsulationFailed
+		return SharedSecret{}, err
 	}
+	defer SecureEraseSharedSecret(&sharedSecret)
+	return kemContextSecret(sharedSecret, context), nil
+}
 
-	// Derive shared secret with context
-	hasher := sha256.New()
-	hasher.Write(ephemeralBytes)
-	hasher.Write(publicKey[:])
-	hasher.Write(context)
-	hasher.Write([]byte("TOPAY-Z512-KEM-CONTEXT-SECRET"))
-
-	sharedSecretHash := hasher.Sum(nil)
-
-	var sharedSecret SharedSecret
-	copy(sharedSecret[:], sharedSecretHash)
-
-	return sharedSecret, nil
+// kemContextSecret binds a shared secret to context data
+func kemContextSecret(sharedSecret SharedSecret, context []byte) SharedSecret {
+	var bound SharedSecret
+	shake256(bound[:], []byte(kemDomainContext), sharedSecret[:], context)
+	return bound
 }
@@ -0,0 +1,247 @@
+package topayz512
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Audit trail of KEM key usage
+
+// KEMOperation names an audited KEM operation
+type KEMOperation string
+
+// Audited KEM operations
+const (
+	KEMOpKeyGen      KEMOperation = "keygen"
+	KEMOpEncapsulate KEMOperation = "encapsulate"
+	KEMOpDecapsulate KEMOperation = "decapsulate"
+)
+
+// KEMAuditEvent describes one KEM operation. It holds key fingerprints and
+// ciphertext hashes only, never secret keys or shared secrets.
+type KEMAuditEvent struct {
+	Operation      KEMOperation `json:"operation"`
+	KeyFingerprint Hash         `json:"key_fingerprint"`
+	CiphertextHash Hash         `json:"ciphertext_hash,omitempty"`
+	Time           time.Time    `json:"time"`
+	Success        bool         `json:"success"`
+}
+
+// KEMAuditRecorder receives an event for every KEM operation while installed
+type KEMAuditRecorder interface {
+	RecordKEMOperation(event KEMAuditEvent)
+}
+
+// kemAuditState wraps the installed recorder for atomic storage
+type kemAuditState struct {
+	recorder KEMAuditRecorder
+}
+
+// activeKEMAudit is nil unless a recorder is installed, so auditing costs a
+// single atomic load in normal operation
+var activeKEMAudit atomic.Pointer[kemAuditState]
+
+// SetKEMAuditRecorder installs a recorder for KEM operations; nil removes
+// it. It returns a function restoring the previous recorder. Recorders are
+// called synchronously from the operation and must be safe for concurrent use.
+func SetKEMAuditRecorder(recorder KEMAuditRecorder) (restore func()) {
+	var state *kemAuditState
+	if recorder != nil {
+		state = &kemAuditState{recorder: recorder}
+	}
+	previous := activeKEMAudit.Swap(state)
+	return func() { activeKEMAudit.Store(previous) }
+}
+
+// auditKEM reports an operation to the installed recorder, if any. publicKey
+// is called only when a recorder is installed.
+func auditKEM(operation KEMOperation, publicKey func() KEMPublicKey, ciphertext *Ciphertext, err error) {
+	state := activeKEMAudit.Load()
+	if state == nil {
+		return
+	}
+
+	event := KEMAuditEvent{
+		Operation:      operation,
+		KeyFingerprint: KEMKeyID(publicKey()),
+		Time:           time.Now().UTC(),
+		Success:        err == nil,
+	}
+	if ciphertext != nil {
+		event.CiphertextHash = ComputeHash(ciphertext[:])
+	}
+	state.recorder.RecordKEMOperation(event)
+}
+
+// KEMAuditEntry is one hash-chained entry of a KEMAuditLog
+type KEMAuditEntry struct {
+	Sequence uint64        `json:"sequence"`
+	Event    KEMAuditEvent `json:"event"`
+	Hash     Hash          `json:"hash"`
+}
+
+// KEMAuditCheckpoint is a signature over the log head, letting an auditor
+// check that no entry up to Sequence was altered or removed
+type KEMAuditCheckpoint struct {
+	Sequence  uint64    `json:"sequence"`
+	Head      Hash      `json:"head"`
+	Time      time.Time `json:"time"`
+	Signer    Hash      `json:"signer"`
+	Signature []byte    `json:"signature"`
+}
+
+// kemAuditDomain separates audit log hashes and checkpoints from other uses
+const kemAuditDomain = "TOPAY-Z512-KEM-AUDIT"
+
+// KEMAuditLog is a KEMAuditRecorder keeping a hash-chained log in memory.
+// Signed checkpoints are taken with Checkpoint; since each consumes a
+// signature from a stateful key, take them periodically rather than per entry.
+type KEMAuditLog struct {
+	entries []KEMAuditEntry
+	head    Hash
+	mutex   sync.Mutex
+}
+
+// NewKEMAuditLog creates an empty audit log
+func NewKEMAuditLog() *KEMAuditLog {
+	return &KEMAuditLog{}
+}
+
+// RecordKEMOperation implements KEMAuditRecorder
+func (log *KEMAuditLog) RecordKEMOperation(event KEMAuditEvent) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	entry := KEMAuditEntry{Sequence: uint64(len(log.entries)) + 1, Event: event}
+	entry.Hash = kemAuditEntryHash(log.head, entry)
+	log.entries = append(log.entries, entry)
+	log.head = entry.Hash
+}
+
+// Entries returns a copy of the log
+func (log *KEMAuditLog) Entries() []KEMAuditEntry {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return append([]KEMAuditEntry(nil), log.entries...)
+}
+
+// Checkpoint signs the current head of the log with key
+func (log *KEMAuditLog) Checkpoint(key *XMSSPrivateKey) (*KEMAuditCheckpoint, error) {
+	log.mutex.Lock()
+	checkpoint := &KEMAuditCheckpoint{
+		Sequence: uint64(len(log.entries)),
+		Head:     log.head,
+		Time:     time.Now().UTC().Truncate(time.Second),
+		Signer:   key.Public().Fingerprint(),
+	}
+	log.mutex.Unlock()
+
+	signature, err := key.Sign(checkpoint.statement())
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.Signature = signature.Bytes()
+	return checkpoint, nil
+}
+
+// Export writes the log as one JSON entry per line, the transcript format
+// read by ReadKEMAuditLog
+func (log *KEMAuditLog) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	for _, entry := range log.Entries() {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadKEMAuditLog reads a transcript written by Export
+func ReadKEMAuditLog(r io.Reader) ([]KEMAuditEntry, error) {
+	var entries []KEMAuditEntry
+	decoder := json.NewDecoder(r)
+	for decoder.More() {
+		var entry KEMAuditEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// VerifyKEMAuditLog checks that entries form an unbroken hash chain from the
+// start of the log, and that checkpoint was signed by a trusted key over the
+// chain up to its sequence. Entries after the checkpoint are chain-checked only.
+func VerifyKEMAuditLog(entries []KEMAuditEntry, checkpoint *KEMAuditCheckpoint, trustedKeys []XMSSPublicKey) error {
+	if checkpoint.Sequence > uint64(len(entries)) {
+		return ErrInvalidAuditTrail
+	}
+
+	var head Hash
+	for i, entry := range entries {
+		if entry.Sequence != uint64(i)+1 || !HashEqual(kemAuditEntryHash(head, entry), entry.Hash) {
+			return ErrInvalidAuditTrail
+		}
+		head = entry.Hash
+		if entry.Sequence == checkpoint.Sequence && !HashEqual(head, checkpoint.Head) {
+			return ErrInvalidAuditTrail
+		}
+	}
+	if checkpoint.Sequence == 0 && checkpoint.Head != (Hash{}) {
+		return ErrInvalidAuditTrail
+	}
+
+	signer := findTrustedKey(trustedKeys, checkpoint.Signer)
+	if signer == nil {
+		return ErrUntrustedSigner
+	}
+	signature, err := XMSSSignatureFromBytes(signer.Params, checkpoint.Signature)
+	if err != nil {
+		return err
+	}
+	if !signer.Verify(checkpoint.statement(), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// statement returns the bytes covered by the checkpoint signature
+func (cp *KEMAuditCheckpoint) statement() []byte {
+	var header [16]byte
+	binary.BigEndian.PutUint64(header[0:8], cp.Sequence)
+	binary.BigEndian.PutUint64(header[8:16], uint64(cp.Time.UnixNano()))
+
+	statement := make([]byte, 0, len(kemAuditDomain)+len(header)+2*HashSize)
+	statement = append(statement, kemAuditDomain...)
+	statement = append(statement, header[:]...)
+	statement = append(statement, cp.Head[:]...)
+	return append(statement, cp.Signer[:]...)
+}
+
+// kemAuditEntryHash chains an entry to the hash of the entry before it
+func kemAuditEntryHash(previous Hash, entry KEMAuditEntry) Hash {
+	var header [17]byte
+	binary.BigEndian.PutUint64(header[0:8], entry.Sequence)
+	binary.BigEndian.PutUint64(header[8:16], uint64(entry.Event.Time.UnixNano()))
+	if entry.Event.Success {
+		header[16] = 1
+	}
+
+	hs := GetHashState()
+	defer PutHashState(hs)
+
+	hs.Update([]byte(kemAuditDomain))
+	hs.Update(previous[:])
+	hs.Update(header[:])
+	hs.Update([]byte(entry.Event.Operation))
+	hs.Update(entry.Event.KeyFingerprint[:])
+	hs.Update(entry.Event.CiphertextHash[:])
+	return hs.Finalize()
+}
@@ -0,0 +1,245 @@
+package topayz512
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Server-side streaming KEM decapsulation
+
+// KEMKeyID identifies a KEM key pair by the hash of its public key, as
+// backup recipients do
+func KEMKeyID(publicKey KEMPublicKey) Hash {
+	return ComputeHash(publicKey[:])
+}
+
+// KeyStore resolves KEM secret keys by key ID
+type KeyStore interface {
+	// SecretKey returns the secret key for keyID, or ErrUnknownKey
+	SecretKey(keyID Hash) (KEMSecretKey, error)
+}
+
+// MemoryKeyStore is a KeyStore holding key pairs in memory
+type MemoryKeyStore struct {
+	keys  map[Hash]*KEMSecretKey
+	mutex sync.RWMutex
+}
+
+// NewMemoryKeyStore creates an empty in-memory key store
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[Hash]*KEMSecretKey)}
+}
+
+// Add stores a key pair and returns its key ID
+func (mks *MemoryKeyStore) Add(keyPair KEMKeyPair) Hash {
+	keyID := KEMKeyID(keyPair.Public)
+
+	mks.mutex.Lock()
+	defer mks.mutex.Unlock()
+	secretKey := keyPair.Secret
+	mks.keys[keyID] = &secretKey
+	return keyID
+}
+
+// Remove erases and forgets the key with the given ID
+func (mks *MemoryKeyStore) Remove(keyID Hash) {
+	mks.mutex.Lock()
+	defer mks.mutex.Unlock()
+
+	if secretKey, ok := mks.keys[keyID]; ok {
+		SecureEraseKEMSecretKey(secretKey)
+		delete(mks.keys, keyID)
+	}
+}
+
+// SecretKey implements KeyStore
+func (mks *MemoryKeyStore) SecretKey(keyID Hash) (KEMSecretKey, error) {
+	mks.mutex.RLock()
+	defer mks.mutex.RUnlock()
+
+	secretKey, ok := mks.keys[keyID]
+	if !ok {
+		return KEMSecretKey{}, ErrUnknownKey
+	}
+	return *secretKey, nil
+}
+
+// DecapsulationRequest is one ciphertext to decapsulate. Tag is returned
+// unchanged with the result so callers can match results to requests.
+type DecapsulationRequest struct {
+	KeyID      Hash
+	Ciphertext Ciphertext
+	Tag        uint64
+}
+
+// DecapsulationResult is the outcome of one request; Err is set per item
+type DecapsulationResult struct {
+	Request      DecapsulationRequest
+	SharedSecret SharedSecret
+	Err          error
+}
+
+// DecapsulationOptions configures a DecapsulationService
+type DecapsulationOptions struct {
+	// Workers is the number of decapsulation goroutines; zero uses OptimalThreadCount
+	Workers int
+	// BatchSize is the most requests resolved and dispatched together; zero uses 64
+	BatchSize int
+	// QueueSize buffers pending requests and undelivered results; zero uses 4*BatchSize
+	QueueSize int
+}
+
+// DecapsulationService decapsulates a stream of requests against keys from a
+// KeyStore, batching them across a worker pool. Results arrive on Results in
+// completion order, not submission order.
+type DecapsulationService struct {
+	store     KeyStore
+	batchSize int
+	pool      *WorkerPool
+	requests  chan DecapsulationRequest
+	results   chan DecapsulationResult
+	closed    bool
+	mutex     sync.RWMutex
+}
+
+// NewDecapsulationService starts a service resolving keys from store; nil
+// options use the defaults
+func NewDecapsulationService(store KeyStore, opts *DecapsulationOptions) *DecapsulationService {
+	var options DecapsulationOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 64
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 4 * options.BatchSize
+	}
+
+	ds := &DecapsulationService{
+		store:     store,
+		batchSize: options.BatchSize,
+		pool:      NewWorkerPool(options.Workers),
+		requests:  make(chan DecapsulationRequest, options.QueueSize),
+		results:   make(chan DecapsulationResult, options.QueueSize),
+	}
+	go ds.dispatch()
+	return ds
+}
+
+// Submit queues a request, blocking while the queue is full. It returns
+// ErrServiceClosed after Close, or the context's error if ctx ends first.
+func (ds *DecapsulationService) Submit(ctx context.Context, request DecapsulationRequest) error {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	if ds.closed {
+		return ErrServiceClosed
+	}
+	select {
+	case ds.requests <- request:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Results returns the channel results are delivered on. It is closed once
+// the service is closed and every queued request has been answered. Results
+// must be drained, or the service stalls once the queue fills.
+func (ds *DecapsulationService) Results() <-chan DecapsulationResult {
+	return ds.results
+}
+
+// QueueDepth returns the number of requests waiting to be batched
+func (ds *DecapsulationService) QueueDepth() int {
+	return len(ds.requests)
+}
+
+// Close stops accepting requests. Queued requests are still processed.
+func (ds *DecapsulationService) Close() {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if !ds.closed {
+		ds.closed = true
+		close(ds.requests)
+	}
+}
+
+// dispatch collects queued requests into batches until the queue is closed
+func (ds *DecapsulationService) dispatch() {
+	defer close(ds.results)
+	defer ds.pool.Close()
+
+	batch := make([]DecapsulationRequest, 0, ds.batchSize)
+	for request := range ds.requests {
+		batch = append(batch[:0], request)
+	fill:
+		for len(batch) < ds.batchSize {
+			select {
+			case request, ok := <-ds.requests:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, request)
+			default:
+				break fill
+			}
+		}
+		ds.process(batch)
+	}
+}
+
+// process resolves each distinct key of a batch once, decapsulates the batch
+// on the worker pool and erases the resolved keys when it's done
+func (ds *DecapsulationService) process(batch []DecapsulationRequest) {
+	type resolvedKey struct {
+		secretKey KEMSecretKey
+		err       error
+	}
+	keys := make(map[Hash]*resolvedKey)
+
+	var wg sync.WaitGroup
+	for _, request := range batch {
+		key, ok := keys[request.KeyID]
+		if !ok {
+			key = &resolvedKey{}
+			key.secretKey, key.err = ds.store.SecretKey(request.KeyID)
+			keys[request.KeyID] = key
+		}
+
+		if key.err != nil {
+			ds.results <- DecapsulationResult{Request: request, Err: key.err}
+			continue
+		}
+
+		request := request
+		wg.Add(1)
+		ds.pool.Submit(func() {
+			defer wg.Done()
+			result := DecapsulationResult{Request: request}
+			defer func() {
+				// A panicking decapsulation still answers its request, then
+				// panics on so the pool accounts for it
+				recovered := recover()
+				if recovered != nil {
+					panicErr := &PanicError{Value: recovered, Stack: debug.Stack()}
+					result = DecapsulationResult{Request: request, Err: fmt.Errorf("decapsulating: %w", panicErr)}
+				}
+				ds.results <- result
+				if recovered != nil {
+					panic(recovered)
+				}
+			}()
+			result.SharedSecret, result.Err = KEMDecapsulate(key.secretKey, request.Ciphertext)
+		})
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		SecureEraseKEMSecretKey(&key.secretKey)
+	}
+}
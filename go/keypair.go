@@ -1,7 +1,6 @@
 package topayz512
 
 import (
-	"crypto/rand"
 	"crypto/sha256"
 	"errors"
 	"sync"
@@ -43,7 +42,7 @@ func GenerateKeyPairAdvanced() (*KeyPair, error) {
 	keyID := GetBuffer(16) // 128-bit key ID
 
 	// Generate secure random private key
-	if _, err := rand.Read(privateKeyData); err != nil {
+	if err := readRandom(privateKeyData); err != nil {
 		PutBuffer(privateKeyData)
 		PutBuffer(publicKeyData)
 		PutBuffer(keyID)
@@ -61,7 +60,7 @@ func GenerateKeyPairAdvanced() (*KeyPair, error) {
 	}
 
 	// Generate unique key ID
-	if _, err := rand.Read(keyID); err != nil {
+	if err := readRandom(keyID); err != nil {
 		SecureZero(privateKeyData)
 		PutBuffer(privateKeyData)
 		PutBuffer(publicKeyData)
@@ -92,93 +91,33 @@ func GenerateKeyPairAdvanced() (*KeyPair, error) {
 	}, nil
 }
 
-// derivePublicKeyAdvanced derives the public key from private key using optimized operations
+// derivePublicKeyAdvanced derives the public key from private key into a pooled buffer
 func derivePublicKeyAdvanced(publicKey, privateKey []byte) error {
 	if len(publicKey) != PublicKeySize || len(privateKey) != PrivateKeySize {
 		return errors.New("invalid key sizes")
 	}
 
-	// Use optimized hash-based key derivation
-	hash := ComputeHash(privateKey)
-
-	// Use SIMD operations for key derivation when available
-	if simdCaps.SSE2 && len(publicKey) >= 16 {
-		// Process in 16-byte chunks using vectorized operations
-		for i := 0; i < len(publicKey); i += 16 {
-			end := i + 16
-			if end > len(publicKey) {
-				end = len(publicKey)
-			}
-
-			// Use hash bytes cyclically for key derivation
-			hashOffset := (i / 16) % (HashSize / 16)
-			hashChunk := hash[hashOffset*16 : hashOffset*16+16]
-
-			if end-i == 16 {
-				VectorizedXOR(publicKey[i:end], privateKey[i:end], hashChunk)
-			} else {
-				// Fallback for partial chunks
-				for j := i; j < end; j++ {
-					publicKey[j] = privateKey[j] ^ hashChunk[j-i]
-				}
-			}
-		}
-	} else {
-		// Fallback to scalar operations
-		for i := 0; i < len(publicKey); i++ {
-			hashByte := hash[i%HashSize]
-			publicKey[i] = privateKey[i] ^ hashByte
-		}
-	}
-
+	var key PrivateKey
+	copy(key[:], privateKey)
+	derived := DerivePublicKey(key)
+	SecureZero(key[:])
+	copy(publicKey, derived[:])
 	return nil
 }
 
-// DerivePublicKey derives a public key from a private key
+// DerivePublicKey derives the public key that verifies signatures made by
+// Sign with privateKey: the public seed and root of its signing hypertree
 func DerivePublicKey(privateKey PrivateKey) PublicKey {
-	// Use SHA-256 based key derivation
-	// In production, use proper elliptic curve or lattice-based derivation
-	hasher := sha256.New()
-	hasher.Write(privateKey[:])
-	hasher.Write([]byte("TOPAY-Z512-PUBLIC-KEY-DERIVATION"))
-
-	firstHash := hasher.Sum(nil)
-
-	// Second round for additional security
-	hasher.Reset()
-	hasher.Write(firstHash)
-	hasher.Write(privateKey[:])
-	secondHash := hasher.Sum(nil)
-
-	var publicKey PublicKey
-	copy(publicKey[:], secondHash)
-
-	return publicKey
+	key := expandSigningKey(privateKey)
+	defer key.wipe()
+	return key.publicKey()
 }
 
 // GenerateKeyPairFromSeed generates a deterministic key pair from a seed
+// using CurrentSeedVersion. Seeds stored before versioning derive their
+// original keys with GenerateKeyPairFromSeedVersion(seed, SeedVersionLegacy)
 func GenerateKeyPairFromSeed(seed []byte) (PrivateKey, PublicKey, error) {
-	if len(seed) < 32 {
-		return PrivateKey{}, PublicKey{}, ErrInvalidKeySize
-	}
-
-	// Derive private key from seed
-	hasher := sha256.New()
-	hasher.Write(seed)
-	hasher.Write([]byte("TOPAY-Z512-PRIVATE-KEY-SEED"))
-
-	privateHash := hasher.Sum(nil)
-
-	// Extend to full private key size
-	var privateKey PrivateKey
-	for i := 0; i < PrivateKeySize; i++ {
-		privateKey[i] = privateHash[i%len(privateHash)]
-	}
-
-	// Derive public key
-	publicKey := DerivePublicKey(privateKey)
-
-	return privateKey, publicKey, nil
+	return GenerateKeyPairFromSeedVersion(seed, CurrentSeedVersion)
 }
 
 // VerifyKeyPair verifies that a private and public key form a valid pair
@@ -234,6 +173,9 @@ func BatchGenerateKeyPairs(count int) ([]PrivateKey, []PublicKey, error) {
 	if count <= 0 {
 		return nil, nil, ErrInvalidFragmentCount
 	}
+	if err := checkBatchSize(count); err != nil {
+		return nil, nil, err
+	}
 
 	privateKeys := make([]PrivateKey, count)
 	publicKeys := make([]PublicKey, count)
@@ -297,6 +239,9 @@ func BatchGenerateKeyPairsFromSeeds(seeds [][]byte) ([]PrivateKey, []PublicKey,
 	if len(seeds) == 0 {
 		return nil, nil, ErrEmptyData
 	}
+	if err := checkBatchSize(len(seeds)); err != nil {
+		return nil, nil, err
+	}
 
 	privateKeys := make([]PrivateKey, len(seeds))
 	publicKeys := make([]PublicKey, len(seeds))
@@ -373,20 +318,41 @@ func PublicKeyEqual(pk1, pk2 PublicKey) bool {
 	return ConstantTimeEqual(pk1[:], pk2[:])
 }
 
-// SecureErasePrivateKey securely erases a private key from memory
+// SecureErasePrivateKey securely erases a private key from memory. It does
+// nothing for a nil key.
 func SecureErasePrivateKey(privateKey *PrivateKey) {
+	if privateKey == nil {
+		return
+	}
 	SecureZero(privateKey[:])
 }
 
-// SecureEraseKeyPair securely erases a key pair from memory
+// SecureErasePublicKey erases a public key, for callers that treat key
+// possession as sensitive. It does nothing for a nil key.
+func SecureErasePublicKey(publicKey *PublicKey) {
+	if publicKey == nil {
+		return
+	}
+	SecureZero(publicKey[:])
+}
+
+// SecureEraseKeyPair securely erases a key pair from memory, including its
+// key ID. Nil pairs and nil keys are skipped.
 func SecureEraseKeyPair(keyPair *KeyPair) {
-	SecureZero((*keyPair.PrivateKey)[:])
-	SecureZero((*keyPair.PublicKey)[:])
+	if keyPair == nil {
+		return
+	}
+	SecureErasePrivateKey(keyPair.PrivateKey)
+	SecureErasePublicKey(keyPair.PublicKey)
+	SecureZero(keyPair.KeyID)
 }
 
 // Key derivation functions
 
-// DeriveKeyFromPassword derives a private key from a password using PBKDF2
+// DeriveKeyFromPassword derives a private key from a password with an
+// iterated hash. The loop isn't memory-hard; new derivations should use
+// DeriveKeyWithParams with Argon2id, which this remains available to as
+// PasswordHashLoop.
 func DeriveKeyFromPassword(password, salt []byte, iterations int) (PrivateKey, error) {
 	if len(password) == 0 {
 		return PrivateKey{}, ErrEmptyData
@@ -509,7 +475,9 @@ func ValidateKeyPairIntegrity(keyPair KeyPair) error {
 	return nil
 }
 
-// GenerateHDWallet generates a hierarchical deterministic wallet
+// GenerateHDWallet generates a linear chain of depth keys from a seed, each
+// the child of the one before. Wallets organizing accounts hierarchically
+// should use DeriveAtPath.
 func GenerateHDWallet(seed []byte, depth int) ([]KeyPair, error) {
 	if depth <= 0 || depth > 256 {
 		return nil, ErrInvalidFragmentCount
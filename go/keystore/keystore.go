@@ -0,0 +1,246 @@
+// Package keystore stores TOPAY-Z512 private keys in password-encrypted,
+// versioned JSON files.
+//
+// A keystore holds the key ID (the public key fingerprint) and creation time
+// in the clear, so keys can be listed without the password. The private key
+// is sealed with AES-256-GCM under a key derived from the password with
+// Argon2id, and an HMAC-SHA256 over every field detects a wrong password or
+// a modified file before anything is decrypted. The derivation parameters
+// are stored with the file, so files written with today's defaults still
+// open after the defaults are raised.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Version is the keystore format version Encrypt writes
+const Version = 1
+
+// CipherAES256GCM names the cipher sealing the private key
+const CipherAES256GCM = "aes-256-gcm"
+
+// Key derivation layout: the password derives one PrivateKeySize output
+// whose halves are the encryption and MAC keys
+const (
+	encryptionKeySize = 32
+	macKeySize        = 32
+	nonceSize         = 12
+)
+
+// macDomain starts the authenticated header
+const macDomain = "TOPAY-Z512-KEYSTORE"
+
+var (
+	// ErrInvalidPassword indicates a wrong password or a keystore modified after it was written
+	ErrInvalidPassword = errors.New("wrong password or corrupted keystore")
+
+	// ErrInvalidKeystore indicates a keystore that isn't well formed
+	ErrInvalidKeystore = errors.New("invalid keystore")
+)
+
+// File is the JSON form of a keystore
+type File struct {
+	Version int            `json:"version"`
+	ID      topayz512.Hash `json:"id"`
+	Created time.Time      `json:"created"`
+	// KDF is the password derivation as written by PasswordParams.String
+	KDF        string `json:"kdf"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+	MAC        []byte `json:"mac"`
+}
+
+// Options configures Encrypt and Save
+type Options struct {
+	// Params is the password derivation; nil uses NewPasswordParams
+	Params *topayz512.PasswordParams
+	// Clock returns the creation time; nil uses time.Now
+	Clock func() time.Time
+}
+
+// header returns the bytes the AEAD and the MAC authenticate besides the
+// sealed key: the domain, version, ID, creation time, KDF and cipher
+func (f *File) header() []byte {
+	var fixed [12]byte
+	binary.BigEndian.PutUint32(fixed[0:4], uint32(f.Version))
+	binary.BigEndian.PutUint64(fixed[4:12], uint64(f.Created.UnixNano()))
+
+	header := make([]byte, 0, len(macDomain)+len(fixed)+topayz512.HashSize+8+len(f.KDF)+len(f.Cipher))
+	header = append(header, macDomain...)
+	header = append(header, fixed[:]...)
+	header = append(header, f.ID[:]...)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(f.KDF)))
+	header = append(header, f.KDF...)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(f.Cipher)))
+	return append(header, f.Cipher...)
+}
+
+// mac returns HMAC-SHA256 of the header, nonce and ciphertext
+func (f *File) mac(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(f.header())
+	mac.Write(f.Nonce)
+	mac.Write(f.Ciphertext)
+	return mac.Sum(nil)
+}
+
+// newGCM returns AES-256-GCM keyed with the encryption half of derived
+func newGCM(derived *topayz512.PrivateKey) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(derived[:encryptionKeySize])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals privateKey under password and returns the keystore JSON
+func Encrypt(privateKey topayz512.PrivateKey, password []byte, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	var params topayz512.PasswordParams
+	if opts.Params != nil {
+		params = *opts.Params
+	} else {
+		var err error
+		if params, err = topayz512.NewPasswordParams(); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	if opts.Clock != nil {
+		now = opts.Clock()
+	}
+
+	derived, err := topayz512.DeriveKeyWithParams(password, params)
+	if err != nil {
+		return nil, err
+	}
+	defer topayz512.SecureErasePrivateKey(&derived)
+	nonce, err := topayz512.SecureRandom(nonceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{
+		Version: Version,
+		ID:      topayz512.PublicKeyFingerprint(topayz512.DerivePublicKey(privateKey)),
+		Created: now.UTC().Truncate(time.Second),
+		KDF:     params.String(),
+		Cipher:  CipherAES256GCM,
+		Nonce:   nonce,
+	}
+	gcm, err := newGCM(&derived)
+	if err != nil {
+		return nil, err
+	}
+	file.Ciphertext = gcm.Seal(nil, nonce, privateKey[:], file.header())
+	file.MAC = file.mac(derived[encryptionKeySize : encryptionKeySize+macKeySize])
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// Decrypt opens keystore JSON written by Encrypt. It returns
+// ErrUnsupportedVersion for an unknown version or cipher, ErrInvalidKeystore
+// for malformed JSON and ErrInvalidPassword for a wrong password or a
+// modified file.
+func Decrypt(data, password []byte) (topayz512.PrivateKey, error) {
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return topayz512.PrivateKey{}, ErrInvalidKeystore
+	}
+	if file.Version != Version || file.Cipher != CipherAES256GCM {
+		return topayz512.PrivateKey{}, topayz512.ErrUnsupportedVersion
+	}
+	if len(file.Nonce) != nonceSize || len(file.Ciphertext) != int(topayz512.PrivateKeySize)+16 || len(file.MAC) != sha256.Size {
+		return topayz512.PrivateKey{}, ErrInvalidKeystore
+	}
+	params, err := topayz512.ParsePasswordParams(file.KDF)
+	if err != nil {
+		return topayz512.PrivateKey{}, err
+	}
+
+	derived, err := topayz512.DeriveKeyWithParams(password, params)
+	if err != nil {
+		return topayz512.PrivateKey{}, err
+	}
+	defer topayz512.SecureErasePrivateKey(&derived)
+	if !hmac.Equal(file.mac(derived[encryptionKeySize:encryptionKeySize+macKeySize]), file.MAC) {
+		return topayz512.PrivateKey{}, ErrInvalidPassword
+	}
+
+	gcm, err := newGCM(&derived)
+	if err != nil {
+		return topayz512.PrivateKey{}, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, file.header())
+	if err != nil {
+		return topayz512.PrivateKey{}, ErrInvalidPassword
+	}
+	defer topayz512.SecureZero(plaintext)
+
+	var privateKey topayz512.PrivateKey
+	copy(privateKey[:], plaintext)
+	if topayz512.PublicKeyFingerprint(topayz512.DerivePublicKey(privateKey)) != file.ID {
+		topayz512.SecureErasePrivateKey(&privateKey)
+		return topayz512.PrivateKey{}, ErrInvalidKeystore
+	}
+	return privateKey, nil
+}
+
+// Save encrypts privateKey under password with the default parameters and
+// writes the keystore to path, readable only by its owner. The file is
+// written to a temporary name and renamed, so an interrupted save never
+// leaves a truncated keystore.
+func Save(privateKey topayz512.PrivateKey, password []byte, path string) error {
+	return SaveWithOptions(privateKey, password, path, nil)
+}
+
+// SaveWithOptions is Save with explicit options; nil uses the defaults
+func SaveWithOptions(privateKey topayz512.PrivateKey, password []byte, path string, opts *Options) error {
+	data, err := Encrypt(privateKey, password, opts)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	// CreateTemp already uses mode 0600
+	if _, err := temp.Write(append(data, '\n')); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Load reads the keystore at path and decrypts its private key with
+// password, as Decrypt does
+func Load(path string, password []byte) (topayz512.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return topayz512.PrivateKey{}, err
+	}
+	return Decrypt(data, password)
+}
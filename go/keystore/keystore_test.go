@@ -0,0 +1,113 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// testOptions uses cheap Argon2id parameters and a fixed clock
+func testOptions() *Options {
+	return &Options{
+		Params: &topayz512.PasswordParams{
+			Algorithm:   topayz512.PasswordArgon2id,
+			Iterations:  1,
+			Memory:      64,
+			Parallelism: 1,
+			Salt:        bytes.Repeat([]byte{0x5a}, topayz512.MinPasswordSaltSize),
+		},
+		Clock: func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) },
+	}
+}
+
+// Test saving and loading a key
+func TestSaveLoad(t *testing.T) {
+	privateKey, publicKey, err := topayz512.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	password := []byte("correct horse battery staple")
+	path := filepath.Join(t.TempDir(), "wallet.json")
+
+	if err := SaveWithOptions(privateKey, password, path, testOptions()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Keystore has mode %v", info.Mode().Perm())
+	}
+
+	loaded, err := Load(path, password)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded != privateKey {
+		t.Error("Loaded key differs")
+	}
+	if _, err := Load(path, []byte("wrong")); err != ErrInvalidPassword {
+		t.Errorf("Expected ErrInvalidPassword, got %v", err)
+	}
+
+	// The ID and creation time are readable without the password
+	data, _ := os.ReadFile(path)
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if file.ID != topayz512.PublicKeyFingerprint(publicKey) || !file.Created.Equal(testOptions().Clock()) {
+		t.Errorf("Unexpected metadata %v %v", file.ID, file.Created)
+	}
+	if file.KDF != testOptions().Params.String() {
+		t.Errorf("Unexpected KDF %q", file.KDF)
+	}
+}
+
+// Test that modified keystores are rejected
+func TestDecryptTampered(t *testing.T) {
+	privateKey, _, _ := topayz512.GenerateKeyPair()
+	password := []byte("password")
+	data, err := Encrypt(privateKey, password, testOptions())
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	tamper := func(modify func(*File)) []byte {
+		var file File
+		json.Unmarshal(data, &file)
+		modify(&file)
+		modified, _ := json.Marshal(&file)
+		return modified
+	}
+	for name, modified := range map[string][]byte{
+		"created":    tamper(func(f *File) { f.Created = f.Created.Add(time.Hour) }),
+		"id":         tamper(func(f *File) { f.ID[0] ^= 1 }),
+		"ciphertext": tamper(func(f *File) { f.Ciphertext[0] ^= 1 }),
+		"mac":        tamper(func(f *File) { f.MAC[0] ^= 1 }),
+	} {
+		if _, err := Decrypt(modified, password); err != ErrInvalidPassword {
+			t.Errorf("Modified %s: expected ErrInvalidPassword, got %v", name, err)
+		}
+	}
+
+	if _, err := Decrypt(tamper(func(f *File) { f.Version = 2 }), password); err != topayz512.ErrUnsupportedVersion {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if _, err := Decrypt(tamper(func(f *File) { f.Nonce = f.Nonce[:4] }), password); err != ErrInvalidKeystore {
+		t.Errorf("Expected ErrInvalidKeystore for a short nonce, got %v", err)
+	}
+	if _, err := Decrypt(tamper(func(f *File) { f.KDF = "$argon2id$v=19$m=1,t=1,p=1$AAAA" }), password); !errors.Is(err, topayz512.ErrInvalidPasswordParams) {
+		t.Errorf("Expected ErrInvalidPasswordParams, got %v", err)
+	}
+	if _, err := Decrypt([]byte("not json"), password); err != ErrInvalidKeystore {
+		t.Errorf("Expected ErrInvalidKeystore, got %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package topayz512
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Key transparency
+//
+// A key transparency log is an append-only MMR of (identity, public key)
+// entries. The log periodically signs a tree head committing to its size and
+// root. Clients check that every head they see extends the previous one, so
+// the log can't show different histories to different clients or quietly
+// rewrite an entry, and that the key they were given for an identity is in
+// the log. Monitors download every new entry and report keys published for
+// an identity that don't match the key its owner expects.
+
+// keyTransparencyDomain separates tree head statements from other signatures
+const keyTransparencyDomain = "TOPAY-Z512-KEY-TRANSPARENCY"
+
+// KeyLogEntry binds an identity to a public key
+type KeyLogEntry struct {
+	Identity string `json:"identity"`
+	Key      []byte `json:"key"`
+}
+
+// Bytes encodes the entry as the MMR leaf: identity length (4 bytes),
+// identity, key
+func (e KeyLogEntry) Bytes() []byte {
+	data := make([]byte, 4, 4+len(e.Identity)+len(e.Key))
+	binary.BigEndian.PutUint32(data, uint32(len(e.Identity)))
+	data = append(data, e.Identity...)
+	return append(data, e.Key...)
+}
+
+// SignedTreeHead is a log's signed commitment to its first TreeSize entries
+type SignedTreeHead struct {
+	TreeSize  uint64    `json:"tree_size"`
+	Root      Hash      `json:"root"`
+	Time      time.Time `json:"time"`
+	Signer    Hash      `json:"signer"`
+	Signature []byte    `json:"signature"`
+}
+
+// statement returns the bytes covered by the tree head signature
+func (sth *SignedTreeHead) statement() []byte {
+	var header [16]byte
+	binary.BigEndian.PutUint64(header[0:8], sth.TreeSize)
+	binary.BigEndian.PutUint64(header[8:16], uint64(sth.Time.UnixNano()))
+
+	statement := make([]byte, 0, len(keyTransparencyDomain)+len(header)+2*HashSize)
+	statement = append(statement, keyTransparencyDomain...)
+	statement = append(statement, header[:]...)
+	statement = append(statement, sth.Root[:]...)
+	return append(statement, sth.Signer[:]...)
+}
+
+// VerifySignedTreeHead checks that sth was signed by one of trustedKeys
+func VerifySignedTreeHead(sth *SignedTreeHead, trustedKeys []XMSSPublicKey) error {
+	signer := findTrustedKey(trustedKeys, sth.Signer)
+	if signer == nil {
+		return ErrUntrustedSigner
+	}
+	signature, err := XMSSSignatureFromBytes(signer.Params, sth.Signature)
+	if err != nil {
+		return err
+	}
+	if !signer.Verify(sth.statement(), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// KeyLog is a key transparency log keeping its entries in memory, for tests
+// and small deployments. Proofs are always against the current tree, so
+// take a tree head after the appends it should cover. It is safe for
+// concurrent use.
+type KeyLog struct {
+	mmr     *MMR
+	entries []KeyLogEntry
+	mutex   sync.RWMutex
+}
+
+// NewKeyLog creates an empty log
+func NewKeyLog() *KeyLog {
+	mmr, _ := NewMMR(nil)
+	return &KeyLog{mmr: mmr}
+}
+
+// Append adds an entry and returns its index
+func (kl *KeyLog) Append(entry KeyLogEntry) (uint64, error) {
+	kl.mutex.Lock()
+	defer kl.mutex.Unlock()
+
+	index, err := kl.mmr.Append(entry.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	kl.entries = append(kl.entries, KeyLogEntry{Identity: entry.Identity, Key: append([]byte(nil), entry.Key...)})
+	return index, nil
+}
+
+// TreeHead signs the current size and root with key. Each head consumes a
+// signature from the stateful key, so sign periodically rather than per entry.
+func (kl *KeyLog) TreeHead(key *XMSSPrivateKey) (*SignedTreeHead, error) {
+	kl.mutex.RLock()
+	sth := &SignedTreeHead{
+		TreeSize: kl.mmr.LeafCount(),
+		Root:     kl.mmr.Root(),
+		Time:     time.Now().UTC().Truncate(time.Second),
+		Signer:   key.Public().Fingerprint(),
+	}
+	kl.mutex.RUnlock()
+
+	signature, err := key.Sign(sth.statement())
+	if err != nil {
+		return nil, err
+	}
+	sth.Signature = signature.Bytes()
+	return sth, nil
+}
+
+// Prove returns an inclusion proof for the entry at index
+func (kl *KeyLog) Prove(index uint64) (MMRProof, error) {
+	return kl.mmr.Prove(index)
+}
+
+// ProveConsistency returns a proof that the tree of oldSize entries is a
+// prefix of the current one
+func (kl *KeyLog) ProveConsistency(oldSize uint64) (MMRConsistencyProof, error) {
+	return kl.mmr.ProveConsistency(oldSize)
+}
+
+// Entries returns the entries from index from up to, not including, index to
+func (kl *KeyLog) Entries(from, to uint64) ([]KeyLogEntry, error) {
+	kl.mutex.RLock()
+	defer kl.mutex.RUnlock()
+	if from > to || to > uint64(len(kl.entries)) {
+		return nil, ErrInvalidLeafIndex
+	}
+	return append([]KeyLogEntry(nil), kl.entries[from:to]...), nil
+}
+
+// Lookup returns the latest entry for identity and its index
+func (kl *KeyLog) Lookup(identity string) (KeyLogEntry, uint64, bool) {
+	kl.mutex.RLock()
+	defer kl.mutex.RUnlock()
+	for i := len(kl.entries) - 1; i >= 0; i-- {
+		if kl.entries[i].Identity == identity {
+			return kl.entries[i], uint64(i), true
+		}
+	}
+	return KeyLogEntry{}, 0, false
+}
+
+// KeyChange reports a key published for a watched identity that isn't the
+// key expected for it
+type KeyChange struct {
+	Identity string `json:"identity"`
+	Index    uint64 `json:"index"`
+	Expected []byte `json:"expected"`
+	Observed []byte `json:"observed"`
+}
+
+// KeyTransparencyClient tracks the latest verified tree head of one log. It
+// accepts a new head only with a proof that it extends the current one, and
+// keeps the peaks of the verified tree so it can also monitor new entries.
+// It is safe for concurrent use.
+type KeyTransparencyClient struct {
+	trustedKeys []XMSSPublicKey
+	head        SignedTreeHead
+	peaks       []Hash
+	watched     map[string][]byte
+	mutex       sync.RWMutex
+}
+
+// NewKeyTransparencyClient creates a client for a log signing its tree heads
+// with one of trustedKeys. It starts from the empty tree.
+func NewKeyTransparencyClient(trustedKeys []XMSSPublicKey) *KeyTransparencyClient {
+	return &KeyTransparencyClient{
+		trustedKeys: append([]XMSSPublicKey(nil), trustedKeys...),
+		head:        SignedTreeHead{Root: mmrRoot(0, nil)},
+		watched:     make(map[string][]byte),
+	}
+}
+
+// TreeHead returns the latest verified tree head
+func (kc *KeyTransparencyClient) TreeHead() SignedTreeHead {
+	kc.mutex.RLock()
+	defer kc.mutex.RUnlock()
+	return kc.head
+}
+
+// checkHead verifies a new head's signature and that it doesn't contradict
+// the current one. It reports whether the head is the current one again.
+func (kc *KeyTransparencyClient) checkHead(sth *SignedTreeHead) (bool, error) {
+	if err := VerifySignedTreeHead(sth, kc.trustedKeys); err != nil {
+		return false, err
+	}
+	if sth.TreeSize < kc.head.TreeSize {
+		return false, fmt.Errorf("%w: tree shrank from %d to %d entries", ErrInconsistentLog, kc.head.TreeSize, sth.TreeSize)
+	}
+	if sth.TreeSize == kc.head.TreeSize {
+		// Two roots for one size are proof the log forked its history
+		if !HashEqual(sth.Root, kc.head.Root) {
+			return false, fmt.Errorf("%w: two roots for %d entries", ErrInconsistentLog, sth.TreeSize)
+		}
+		return true, nil
+	}
+	if sth.Time.Before(kc.head.Time) {
+		return false, fmt.Errorf("%w: tree head older than the current one", ErrInconsistentLog)
+	}
+	return false, nil
+}
+
+// Update verifies sth and proof, that the tree sth commits to extends the
+// current one, and makes sth the current head. proof may be nil when sth is
+// for the current size. It returns ErrInconsistentLog if the log rewrote
+// its history.
+func (kc *KeyTransparencyClient) Update(sth *SignedTreeHead, proof *MMRConsistencyProof) error {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	same, err := kc.checkHead(sth)
+	if err != nil || same {
+		return err
+	}
+	if proof == nil || proof.OldLeafCount != kc.head.TreeSize || proof.NewLeafCount != sth.TreeSize ||
+		!VerifyMMRConsistency(kc.head.Root, sth.Root, proof) {
+		return fmt.Errorf("%w: consistency proof failed", ErrInconsistentLog)
+	}
+	kc.head = *sth
+	kc.peaks = append([]Hash(nil), proof.NewPeaks...)
+	return nil
+}
+
+// VerifyInclusion checks that entry is in the log at proof.LeafIndex under
+// the current tree head. Proofs must be for the current tree size; update
+// the head first when the log has grown.
+func (kc *KeyTransparencyClient) VerifyInclusion(entry KeyLogEntry, proof *MMRProof) error {
+	kc.mutex.RLock()
+	defer kc.mutex.RUnlock()
+	if proof == nil || proof.LeafCount != kc.head.TreeSize || !VerifyMMRProof(kc.head.Root, entry.Bytes(), proof) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// Watch sets the key an identity is expected to have, replacing any earlier
+// one; Monitor reports entries for the identity with another key
+func (kc *KeyTransparencyClient) Watch(identity string, key []byte) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+	kc.watched[identity] = append([]byte(nil), key...)
+}
+
+// Unwatch stops monitoring an identity
+func (kc *KeyTransparencyClient) Unwatch(identity string) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+	delete(kc.watched, identity)
+}
+
+// Monitor verifies sth against entries, which must be every entry after the
+// current tree head up to sth.TreeSize, and makes sth the current head. It
+// returns the entries that publish an unexpected key for a watched
+// identity; the expected keys are left unchanged, so a legitimate rotation
+// must be confirmed with Watch.
+func (kc *KeyTransparencyClient) Monitor(sth *SignedTreeHead, entries []KeyLogEntry) ([]KeyChange, error) {
+	kc.mutex.Lock()
+	defer kc.mutex.Unlock()
+
+	same, err := kc.checkHead(sth)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(entries)) != sth.TreeSize-kc.head.TreeSize {
+		return nil, fmt.Errorf("%w: expected %d entries, got %d", ErrInvalidProof, sth.TreeSize-kc.head.TreeSize, len(entries))
+	}
+	if same {
+		return nil, nil
+	}
+
+	// Rebuild the new peaks from the verified ones and the new entries
+	leafCount := kc.head.TreeSize
+	peaks := append([]Hash(nil), kc.peaks...)
+	var changes []KeyChange
+	for _, entry := range entries {
+		peaks, _ = mmrAppend(leafCount, peaks, mmrLeaf(entry.Bytes()))
+		if expected, ok := kc.watched[entry.Identity]; ok && !bytes.Equal(expected, entry.Key) {
+			changes = append(changes, KeyChange{
+				Identity: entry.Identity,
+				Index:    leafCount,
+				Expected: append([]byte(nil), expected...),
+				Observed: append([]byte(nil), entry.Key...),
+			})
+		}
+		leafCount++
+	}
+	root := mmrRoot(leafCount, peaks)
+	if !HashEqual(root, sth.Root) {
+		return nil, fmt.Errorf("%w: entries don't match the tree head", ErrInconsistentLog)
+	}
+
+	kc.head = *sth
+	kc.peaks = peaks
+	return changes, nil
+}
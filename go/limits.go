@@ -0,0 +1,96 @@
+package topayz512
+
+import (
+	"fmt"
+	"math"
+)
+
+// Documented input limits
+
+// Input limits enforced by the public API
+const (
+	// MaxHashInputSize is the most data one hash computation can absorb: the
+	// padding encodes the message length in bits in 64 bits
+	MaxHashInputSize = 1<<61 - 1
+
+	// MaxBatchSize is the largest number of items accepted by one batch call
+	MaxBatchSize = 1 << 20
+
+	// MaxFragmentedDataSize is the most data FragmentData accepts: MaxFragments
+	// fragments of at most DefaultMaxFragmentDataSize bytes, so every fragment
+	// it produces passes DeserializeFragment's default limits
+	MaxFragmentedDataSize = MaxFragments * DefaultMaxFragmentDataSize
+)
+
+// TooLargeError reports an input above a documented limit. It matches
+// ErrTooLarge with errors.Is.
+type TooLargeError struct {
+	Limit string
+	Size  uint64
+	Max   uint64
+}
+
+// Error implements error
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%v: %s is %d, limit %d", ErrTooLarge, e.Limit, e.Size, e.Max)
+}
+
+// Unwrap returns ErrTooLarge
+func (e *TooLargeError) Unwrap() error {
+	return ErrTooLarge
+}
+
+// InputLimits reports the effective limits of this build
+type InputLimits struct {
+	// MaxHashInputSize is the most data a StreamingHash accepts in total
+	MaxHashInputSize uint64 `json:"max_hash_input_size"`
+	// MaxBatchSize is the largest count or slice accepted by batch key
+	// generation, KEM and BatchHashWithSalts calls. BatchHash has no error
+	// return and is bounded only by the inputs the caller already holds.
+	MaxBatchSize int `json:"max_batch_size"`
+	// MaxFragments is the most fragments data is split into
+	MaxFragments int `json:"max_fragments"`
+	// MaxFragmentDataSize is the largest fragment payload deserialized by default
+	MaxFragmentDataSize uint32 `json:"max_fragment_data_size"`
+	// MaxFragmentedDataSize is the most data FragmentData accepts, capped by
+	// the platform's maximum slice length
+	MaxFragmentedDataSize uint64 `json:"max_fragmented_data_size"`
+	// MaxShares is the most shares a secret can be split into
+	MaxShares int `json:"max_shares"`
+	// MaxXMSSSignatures is the most signatures one XMSS key can produce
+	MaxXMSSSignatures uint64 `json:"max_xmss_signatures"`
+}
+
+// Limits returns the effective input limits for this platform
+func Limits() InputLimits {
+	maxFragmented := uint64(MaxFragmentedDataSize)
+	if uint64(math.MaxInt) < maxFragmented {
+		maxFragmented = uint64(math.MaxInt)
+	}
+
+	return InputLimits{
+		MaxHashInputSize:      MaxHashInputSize,
+		MaxBatchSize:          MaxBatchSize,
+		MaxFragments:          MaxFragments,
+		MaxFragmentDataSize:   DefaultMaxFragmentDataSize,
+		MaxFragmentedDataSize: maxFragmented,
+		MaxShares:             MaxShares,
+		MaxXMSSSignatures:     uint64(1) << MaxXMSSHeight,
+	}
+}
+
+// checkBatchSize rejects batches above MaxBatchSize
+func checkBatchSize(count int) error {
+	if count > MaxBatchSize {
+		return &TooLargeError{Limit: "batch size", Size: uint64(count), Max: MaxBatchSize}
+	}
+	return nil
+}
+
+// checkFragmentedDataSize rejects data above MaxFragmentedDataSize
+func checkFragmentedDataSize(size int) error {
+	if uint64(size) > MaxFragmentedDataSize {
+		return &TooLargeError{Limit: "fragmented data size", Size: uint64(size), Max: MaxFragmentedDataSize}
+	}
+	return nil
+}
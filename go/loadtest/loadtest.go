@@ -0,0 +1,386 @@
+// Package loadtest simulates many concurrent TOPAY-Z512 key exchanges to size
+// hardware before deployment.
+//
+// Each simulated session is one ephemeral handshake followed by traffic: the
+// responder generates a KEM key pair, the initiator encapsulates to it, the
+// responder decapsulates, and both derive AEADs from the shared secret and
+// exchange messages in both directions. Run executes the sessions on a
+// bounded number of goroutines and reports latency percentiles for every
+// phase, throughput, and heap usage sampled while the sessions run.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Defaults for zero Config fields
+const (
+	DefaultSessions       = 1000
+	DefaultMessages       = 10
+	DefaultMessageSize    = 1024
+	DefaultSampleInterval = 10 * time.Millisecond
+)
+
+// Phase names, in report order
+const (
+	PhaseKeyGen      = "kem/keygen"
+	PhaseEncapsulate = "kem/encapsulate"
+	PhaseDecapsulate = "kem/decapsulate"
+	PhaseHandshake   = "handshake"
+	PhaseSeal        = "aead/seal"
+	PhaseOpen        = "aead/open"
+	PhaseSession     = "session"
+)
+
+// phases lists the phases in report order
+var phases = []string{
+	PhaseKeyGen, PhaseEncapsulate, PhaseDecapsulate, PhaseHandshake,
+	PhaseSeal, PhaseOpen, PhaseSession,
+}
+
+// ErrInvalidConfig indicates a negative Config field
+var ErrInvalidConfig = errors.New("invalid load test configuration")
+
+// Config describes a load test. Zero fields use the defaults.
+type Config struct {
+	// Sessions is the number of handshakes to simulate
+	Sessions int `json:"sessions"`
+	// Concurrency is the number of sessions in flight at once; zero runs
+	// every session concurrently
+	Concurrency int `json:"concurrency"`
+	// Messages is the number of messages each side sends after the handshake
+	Messages int `json:"messages"`
+	// MessageSize is the plaintext size of each message in bytes
+	MessageSize int `json:"message_size"`
+	// SampleInterval is how often heap usage is sampled
+	SampleInterval time.Duration `json:"sample_interval_ns"`
+}
+
+// withDefaults returns c with zero fields replaced by defaults
+func (c Config) withDefaults() (Config, error) {
+	if c.Sessions < 0 || c.Concurrency < 0 || c.Messages < 0 || c.MessageSize < 0 || c.SampleInterval < 0 {
+		return c, ErrInvalidConfig
+	}
+	if c.Sessions == 0 {
+		c.Sessions = DefaultSessions
+	}
+	if c.Concurrency == 0 || c.Concurrency > c.Sessions {
+		c.Concurrency = c.Sessions
+	}
+	if c.Messages == 0 {
+		c.Messages = DefaultMessages
+	}
+	if c.MessageSize == 0 {
+		c.MessageSize = DefaultMessageSize
+	}
+	if c.SampleInterval == 0 {
+		c.SampleInterval = DefaultSampleInterval
+	}
+	return c, nil
+}
+
+// Latency summarizes the durations of one phase
+type Latency struct {
+	Phase string        `json:"phase"`
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P90   time.Duration `json:"p90_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	P999  time.Duration `json:"p999_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// Memory summarizes heap usage during a run
+type Memory struct {
+	// PeakHeapInuse is the largest in-use heap seen by the sampler
+	PeakHeapInuse uint64 `json:"peak_heap_inuse"`
+	// PeakSys is the largest memory obtained from the OS seen by the sampler
+	PeakSys uint64 `json:"peak_sys"`
+	// TotalAlloc is the number of bytes allocated during the run
+	TotalAlloc uint64 `json:"total_alloc"`
+	// BytesPerSession is TotalAlloc divided by the completed sessions
+	BytesPerSession uint64 `json:"bytes_per_session"`
+	// GCCycles is the number of garbage collections during the run
+	GCCycles uint32 `json:"gc_cycles"`
+	// Samples is the number of heap samples taken
+	Samples int `json:"samples"`
+}
+
+// Report is the result of a load test
+type Report struct {
+	Config    Config        `json:"config"`
+	Completed int           `json:"completed"`
+	Failed    int           `json:"failed"`
+	Elapsed   time.Duration `json:"elapsed_ns"`
+	// HandshakesPerSec is completed sessions per second of wall time
+	HandshakesPerSec float64 `json:"handshakes_per_sec"`
+	// TrafficMBPerSec is plaintext bytes sent in both directions per second
+	TrafficMBPerSec float64   `json:"traffic_mb_per_sec"`
+	Latencies       []Latency `json:"latencies"`
+	Memory          Memory    `json:"memory"`
+}
+
+// Latency returns the summary for phase, or false if the report has none
+func (r *Report) Latency(phase string) (Latency, bool) {
+	for _, l := range r.Latencies {
+		if l.Phase == phase {
+			return l, true
+		}
+	}
+	return Latency{}, false
+}
+
+// sessionTimes are the measurements of one session. Seal and open times are
+// per message.
+type sessionTimes struct {
+	keyGen, encapsulate, decapsulate, handshake, session time.Duration
+	seal, open                                           []time.Duration
+}
+
+// Run simulates cfg.Sessions handshakes and returns the report. Cancelling
+// ctx stops starting new sessions; Run then returns the report of the
+// sessions that finished together with ctx's error. Sessions that fail count
+// in Report.Failed and the first failure is returned with the report.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := startSampler(cfg.SampleInterval)
+	start := time.Now()
+
+	jobs := make(chan struct{})
+	results := make(chan sessionTimes, cfg.Concurrency)
+	var firstErr error
+	var failed int
+	var errMu sync.Mutex
+	var workers sync.WaitGroup
+	for w := 0; w < cfg.Concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			plaintext := bytes.Repeat([]byte{0x5a}, cfg.MessageSize)
+			for range jobs {
+				times, err := runSession(cfg.Messages, plaintext)
+				if err != nil {
+					errMu.Lock()
+					failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					continue
+				}
+				results <- times
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := 0; i < cfg.Sessions; i++ {
+			select {
+			case jobs <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	durations := make(map[string][]time.Duration, len(phases))
+	completed := 0
+	for times := range results {
+		completed++
+		durations[PhaseKeyGen] = append(durations[PhaseKeyGen], times.keyGen)
+		durations[PhaseEncapsulate] = append(durations[PhaseEncapsulate], times.encapsulate)
+		durations[PhaseDecapsulate] = append(durations[PhaseDecapsulate], times.decapsulate)
+		durations[PhaseHandshake] = append(durations[PhaseHandshake], times.handshake)
+		durations[PhaseSeal] = append(durations[PhaseSeal], times.seal...)
+		durations[PhaseOpen] = append(durations[PhaseOpen], times.open...)
+		durations[PhaseSession] = append(durations[PhaseSession], times.session)
+	}
+	elapsed := time.Since(start)
+
+	report := &Report{
+		Config:    cfg,
+		Completed: completed,
+		Failed:    failed,
+		Elapsed:   elapsed,
+		Latencies: make([]Latency, 0, len(phases)),
+		Memory:    sampler.stop(),
+	}
+	if completed > 0 {
+		report.Memory.BytesPerSession = report.Memory.TotalAlloc / uint64(completed)
+	}
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		report.HandshakesPerSec = float64(completed) / seconds
+		traffic := float64(completed) * float64(2*cfg.Messages*cfg.MessageSize)
+		report.TrafficMBPerSec = traffic / seconds / 1e6
+	}
+	for _, phase := range phases {
+		report.Latencies = append(report.Latencies, summarize(phase, durations[phase]))
+	}
+
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	return report, firstErr
+}
+
+// runSession performs one handshake and its traffic, timing each step
+func runSession(messages int, plaintext []byte) (sessionTimes, error) {
+	times := sessionTimes{
+		seal: make([]time.Duration, 0, 2*messages),
+		open: make([]time.Duration, 0, 2*messages),
+	}
+	start := time.Now()
+
+	publicKey, secretKey, err := topayz512.KEMKeyGen()
+	if err != nil {
+		return times, err
+	}
+	defer topayz512.SecureEraseKEMSecretKey(&secretKey)
+	keyGenDone := time.Now()
+	ciphertext, initiatorSecret, err := topayz512.KEMEncapsulate(publicKey)
+	if err != nil {
+		return times, err
+	}
+	defer topayz512.SecureEraseSharedSecret(&initiatorSecret)
+	encapsulateDone := time.Now()
+	responderSecret, err := topayz512.KEMDecapsulate(secretKey, ciphertext)
+	if err != nil {
+		return times, err
+	}
+	defer topayz512.SecureEraseSharedSecret(&responderSecret)
+	decapsulateDone := time.Now()
+
+	initiator, err := initiatorSecret.NewAEAD(topayz512.AEADInitiator, nil)
+	if err != nil {
+		return times, err
+	}
+	defer initiator.Wipe()
+	responder, err := responderSecret.NewAEAD(topayz512.AEADResponder, nil)
+	if err != nil {
+		return times, err
+	}
+	defer responder.Wipe()
+	handshakeDone := time.Now()
+
+	times.keyGen = keyGenDone.Sub(start)
+	times.encapsulate = encapsulateDone.Sub(keyGenDone)
+	times.decapsulate = decapsulateDone.Sub(encapsulateDone)
+	times.handshake = handshakeDone.Sub(start)
+
+	for i := 0; i < messages; i++ {
+		for _, pair := range [2][2]*topayz512.AEAD{{initiator, responder}, {responder, initiator}} {
+			sealStart := time.Now()
+			sealed, err := pair[0].Seal(plaintext, nil)
+			if err != nil {
+				return times, err
+			}
+			openStart := time.Now()
+			opened, err := pair[1].Open(sealed, nil)
+			if err != nil {
+				return times, err
+			}
+			openDone := time.Now()
+			if !bytes.Equal(opened, plaintext) {
+				return times, fmt.Errorf("%w: message %d differs after opening", topayz512.ErrAuthenticationFailed, i)
+			}
+			times.seal = append(times.seal, openStart.Sub(sealStart))
+			times.open = append(times.open, openDone.Sub(openStart))
+		}
+	}
+	times.session = time.Since(start)
+	return times, nil
+}
+
+// summarize computes the latency summary of durations, sorting them in place
+func summarize(phase string, durations []time.Duration) Latency {
+	latency := Latency{Phase: phase, Count: len(durations)}
+	if len(durations) == 0 {
+		return latency
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	latency.Mean = total / time.Duration(len(durations))
+	latency.P50 = percentile(durations, 50)
+	latency.P90 = percentile(durations, 90)
+	latency.P99 = percentile(durations, 99)
+	latency.P999 = percentile(durations, 99.9)
+	latency.Max = durations[len(durations)-1]
+	return latency
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p/100*float64(len(sorted)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[min(rank, len(sorted))-1]
+}
+
+// sampler tracks heap usage on a background goroutine
+type sampler struct {
+	before runtime.MemStats
+	done   chan struct{}
+	result chan Memory
+}
+
+// startSampler records the starting memory statistics and samples every interval
+func startSampler(interval time.Duration) *sampler {
+	s := &sampler{done: make(chan struct{}), result: make(chan Memory, 1)}
+	runtime.GC()
+	runtime.ReadMemStats(&s.before)
+
+	go func() {
+		var memory Memory
+		var stats runtime.MemStats
+		record := func() {
+			runtime.ReadMemStats(&stats)
+			memory.PeakHeapInuse = max(memory.PeakHeapInuse, stats.HeapInuse)
+			memory.PeakSys = max(memory.PeakSys, stats.Sys)
+			memory.Samples++
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				record()
+			case <-s.done:
+				record()
+				memory.TotalAlloc = stats.TotalAlloc - s.before.TotalAlloc
+				memory.GCCycles = stats.NumGC - s.before.NumGC
+				s.result <- memory
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// stop takes a final sample and returns the summary
+func (s *sampler) stop() Memory {
+	close(s.done)
+	return <-s.result
+}
@@ -0,0 +1,83 @@
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test a small load test run
+func TestRun(t *testing.T) {
+	cfg := Config{Sessions: 40, Concurrency: 8, Messages: 3, MessageSize: 256, SampleInterval: time.Millisecond}
+	report, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Completed != 40 || report.Failed != 0 {
+		t.Fatalf("Completed %d, failed %d", report.Completed, report.Failed)
+	}
+	if len(report.Latencies) != len(phases) {
+		t.Fatalf("Got %d latency summaries", len(report.Latencies))
+	}
+
+	for phase, count := range map[string]int{PhaseHandshake: 40, PhaseSeal: 40 * 2 * 3, PhaseOpen: 40 * 2 * 3} {
+		latency, ok := report.Latency(phase)
+		if !ok || latency.Count != count {
+			t.Errorf("%s: got %d samples, want %d", phase, latency.Count, count)
+		}
+		if latency.P50 <= 0 || latency.P50 > latency.P99 || latency.P99 > latency.Max {
+			t.Errorf("%s: percentiles out of order: %+v", phase, latency)
+		}
+	}
+	handshake, _ := report.Latency(PhaseHandshake)
+	session, _ := report.Latency(PhaseSession)
+	if session.Max < handshake.Max {
+		t.Error("Sessions are shorter than their handshakes")
+	}
+	if report.HandshakesPerSec <= 0 || report.TrafficMBPerSec <= 0 {
+		t.Errorf("Missing throughput: %+v", report)
+	}
+	if report.Memory.Samples == 0 || report.Memory.PeakHeapInuse == 0 || report.Memory.TotalAlloc == 0 {
+		t.Errorf("Missing memory statistics: %+v", report.Memory)
+	}
+}
+
+// Test configuration defaults and validation
+func TestConfig(t *testing.T) {
+	cfg, err := Config{Sessions: 5}.withDefaults()
+	if err != nil {
+		t.Fatalf("withDefaults failed: %v", err)
+	}
+	if cfg.Concurrency != 5 || cfg.Messages != DefaultMessages || cfg.MessageSize != DefaultMessageSize {
+		t.Errorf("Unexpected defaults %+v", cfg)
+	}
+	if _, err := Run(context.Background(), Config{Sessions: -1}); err != ErrInvalidConfig {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+// Test that cancellation stops a run and keeps finished sessions
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := Run(ctx, Config{Sessions: 1000, Concurrency: 2, Messages: 1})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if report == nil || report.Completed >= 1000 {
+		t.Errorf("Cancelled run completed every session")
+	}
+}
+
+// Test nearest-rank percentiles
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 1000)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+	for p, want := range map[float64]time.Duration{50: 500, 90: 900, 99: 990, 99.9: 999, 100: 1000, 0: 1} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%v = %d, want %d", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package topayz512
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Signed fragment manifests
+//
+// A manifest is a transfer plan: the payload's size, checksum and layout and
+// the size and checksum of every fragment. A sender publishes it, signed,
+// ahead of the fragments, so a receiver can check the plan and the sender
+// before downloading anything and then reject each fragment that doesn't
+// match the plan on arrival, before it is buffered.
+
+// FragmentManifestVersion is the current manifest format version
+const FragmentManifestVersion = 1
+
+// fragmentManifestDomain separates manifest statements from other signed messages
+const fragmentManifestDomain = "TOPAY-Z512-FRAGMENT-MANIFEST"
+
+// ManifestEntry is the plan for one fragment
+type ManifestEntry struct {
+	Size     uint32 `json:"size"`
+	Checksum Hash   `json:"checksum"`
+}
+
+// FragmentManifest lists the fragments of a payload under an optional
+// signature
+type FragmentManifest struct {
+	Version       uint32          `json:"version"`
+	ID            ID              `json:"id"`
+	OriginalSize  uint64          `json:"original_size"`
+	FragmentCount uint32          `json:"fragment_count"`
+	FragmentSize  uint32          `json:"fragment_size"`
+	Checksum      Hash            `json:"checksum"`
+	Fragments     []ManifestEntry `json:"fragments"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Signature     []byte          `json:"signature,omitempty"`
+}
+
+// NewFragmentManifest creates an unsigned manifest for the fragments of a
+// FragmentData call, in whichever form of checksum they carry. It returns
+// ErrInvalidFragmentCount for a result whose fragments are incomplete or
+// out of order.
+func NewFragmentManifest(result FragmentationResult) (*FragmentManifest, error) {
+	fragments := result.Fragments
+	if len(fragments) == 0 || len(fragments) != int(result.Metadata.FragmentCount) {
+		return nil, ErrInvalidFragmentCount
+	}
+	manifest := &FragmentManifest{
+		Version:       FragmentManifestVersion,
+		ID:            fragments[0].ID,
+		OriginalSize:  result.Metadata.OriginalSize,
+		FragmentCount: result.Metadata.FragmentCount,
+		FragmentSize:  uint32(len(fragments[0].Data)),
+		Checksum:      result.Metadata.Checksum,
+		Fragments:     make([]ManifestEntry, len(fragments)),
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+	for i, fragment := range fragments {
+		if fragment.ID != manifest.ID || fragment.Index != uint32(i) || fragment.Total != manifest.FragmentCount {
+			return nil, ErrInvalidFragmentCount
+		}
+		manifest.Fragments[i] = ManifestEntry{Size: uint32(len(fragment.Data)), Checksum: fragment.Checksum}
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ParseFragmentManifest decodes a JSON manifest and validates its layout.
+// It doesn't check the signature; call Verify.
+func ParseFragmentManifest(data []byte) (*FragmentManifest, error) {
+	var manifest FragmentManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Validate checks that the manifest describes a layout FragmentData
+// produces: the version is known, one entry per fragment, every fragment
+// but the last FragmentSize bytes and the sizes summing to OriginalSize. It
+// returns ErrUnsupportedVersion or a wrapped ErrInvalidManifest.
+func (fm *FragmentManifest) Validate() error {
+	if fm.Version != FragmentManifestVersion {
+		return ErrUnsupportedVersion
+	}
+	if fm.FragmentCount == 0 || fm.FragmentCount > MaxFragments || len(fm.Fragments) != int(fm.FragmentCount) {
+		return fmt.Errorf("%w: %d entries for %d fragments", ErrInvalidManifest, len(fm.Fragments), fm.FragmentCount)
+	}
+	if fm.OriginalSize > MaxFragmentedDataSize {
+		return fmt.Errorf("%w: original size %d", ErrInvalidManifest, fm.OriginalSize)
+	}
+	if size, ok := evenFragmentLayout(fm.OriginalSize, fm.FragmentCount); !ok || size != int(fm.FragmentSize) {
+		return fmt.Errorf("%w: %d fragments of %d bytes can't hold %d bytes", ErrInvalidManifest, fm.FragmentCount, fm.FragmentSize, fm.OriginalSize)
+	}
+	last := fm.OriginalSize - uint64(fm.FragmentSize)*uint64(fm.FragmentCount-1)
+	for i, entry := range fm.Fragments {
+		want := uint64(fm.FragmentSize)
+		if i == len(fm.Fragments)-1 {
+			want = last
+		}
+		if uint64(entry.Size) != want {
+			return fmt.Errorf("%w: fragment %d is %d bytes, want %d", ErrInvalidManifest, i, entry.Size, want)
+		}
+	}
+	return nil
+}
+
+// Metadata returns the FragmentMetadata the manifest describes, for
+// receivers such as NewFileReconstructor
+func (fm *FragmentManifest) Metadata() FragmentMetadata {
+	return FragmentMetadata{
+		OriginalSize:  fm.OriginalSize,
+		FragmentCount: fm.FragmentCount,
+		FragmentSize:  fm.FragmentSize,
+		Timestamp:     fm.CreatedAt,
+		Algorithm:     "TOPAY-Z512",
+		Checksum:      fm.Checksum,
+	}
+}
+
+// CheckFragment reports whether a fragment is the one the manifest plans at
+// its index, comparing its ID, count, size and checksum. It returns a
+// wrapped ErrManifestMismatch for anything else. The checksum is compared
+// as carried, so check it against the data as usual when reconstructing.
+func (fm *FragmentManifest) CheckFragment(fragment Fragment) error {
+	switch {
+	case fragment.ID != fm.ID:
+		return fmt.Errorf("%w: fragment ID %s", ErrManifestMismatch, fragment.ID)
+	case fragment.Total != fm.FragmentCount || fragment.Index >= fm.FragmentCount:
+		return fmt.Errorf("%w: fragment %d of %d", ErrManifestMismatch, fragment.Index, fragment.Total)
+	}
+	entry := fm.Fragments[fragment.Index]
+	if uint32(len(fragment.Data)) != entry.Size || !HashEqual(fragment.Checksum, entry.Checksum) {
+		return fmt.Errorf("%w: fragment %d content", ErrManifestMismatch, fragment.Index)
+	}
+	return nil
+}
+
+// CanonicalJSON returns the deterministic encoding covered by the
+// signature: the manifest without its signature, with the timestamp in UTC
+func (fm *FragmentManifest) CanonicalJSON() ([]byte, error) {
+	canonical := *fm
+	canonical.Signature = nil
+	canonical.CreatedAt = fm.CreatedAt.UTC()
+	return json.Marshal(canonical)
+}
+
+// statement returns the signed bytes of the manifest
+func (fm *FragmentManifest) statement() ([]byte, error) {
+	canonical, err := fm.CanonicalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fragmentManifestDomain), canonical...), nil
+}
+
+// Sign signs the canonical form with key
+func (fm *FragmentManifest) Sign(key PrivateKey) error {
+	statement, err := fm.statement()
+	if err != nil {
+		return err
+	}
+	signature, err := Sign(key, statement)
+	if err != nil {
+		return err
+	}
+	fm.Signature = signature.Bytes()
+	return nil
+}
+
+// Verify validates the manifest and checks its signature against
+// publicKey. It returns ErrInvalidSignature for an unsigned manifest or one
+// signed by another key or modified since.
+func (fm *FragmentManifest) Verify(publicKey PublicKey) error {
+	if err := fm.Validate(); err != nil {
+		return err
+	}
+	if len(fm.Signature) != SignatureSize {
+		return ErrInvalidSignature
+	}
+	statement, err := fm.statement()
+	if err != nil {
+		return err
+	}
+	var signature Signature
+	copy(signature[:], fm.Signature)
+	if !Verify(publicKey, statement, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
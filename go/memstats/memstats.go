@@ -0,0 +1,205 @@
+// Package memstats samples the memory behavior of the TOPAY-Z512 crypto
+// layer in long-running nodes: pool hit rates, bytes pooled, hash states in
+// use and queue depths, next to the garbage collector's own figures.
+//
+// A Sampler records a sample every interval and keeps a bounded history, so
+// an operator can watch a hit rate fall or a queue grow without attaching a
+// profiler. Publish exposes the latest sample through expvar, which serves
+// it at /debug/vars on http.DefaultServeMux.
+//
+// Samples use topayz512.ReadPoolMetrics and runtime/metrics, neither of
+// which stops the world, so short intervals are cheap.
+package memstats
+
+import (
+	"errors"
+	"expvar"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Sampler defaults
+const (
+	// DefaultInterval is the time between samples of a zero Options
+	DefaultInterval = 10 * time.Second
+
+	// DefaultHistory is the number of samples a zero Options keeps
+	DefaultHistory = 60
+)
+
+// ErrAlreadyPublished indicates an expvar name that is already in use
+var ErrAlreadyPublished = errors.New("memstats: expvar name already published")
+
+// Garbage collector metrics read with runtime/metrics
+const (
+	metricHeapObjectBytes = "/memory/classes/heap/objects:bytes"
+	metricHeapObjects     = "/gc/heap/objects:objects"
+	metricHeapGoal        = "/gc/heap/goal:bytes"
+	metricGCCycles        = "/gc/cycles/total:gc-cycles"
+)
+
+// Sample is one reading of the crypto layer's memory use
+type Sample struct {
+	Time time.Time `json:"time"`
+	topayz512.PoolMetrics
+	// Queues holds the depth of each queue named in Options.Queues
+	Queues map[string]int `json:"queues,omitempty"`
+
+	// HeapObjectBytes is the memory held by live and not yet swept objects
+	HeapObjectBytes uint64 `json:"heap_object_bytes"`
+	// HeapObjects is the number of objects on the heap
+	HeapObjects uint64 `json:"heap_objects"`
+	// HeapGoal is the heap size at which the next collection starts
+	HeapGoal uint64 `json:"heap_goal"`
+	// GCCycles counts completed garbage collections
+	GCCycles uint64 `json:"gc_cycles"`
+}
+
+// Options configures a Sampler
+type Options struct {
+	// Interval is the time between samples; zero uses DefaultInterval
+	Interval time.Duration
+	// History is the number of samples kept; zero uses DefaultHistory
+	History int
+	// Queues names functions reporting queue depths to sample, such as the
+	// QueueDepth methods of a WorkerPool or DecapsulationService
+	Queues map[string]func() int
+}
+
+// Read takes one sample, reading the depth of each queue
+func Read(queues map[string]func() int) Sample {
+	sample := Sample{Time: time.Now(), PoolMetrics: topayz512.ReadPoolMetrics()}
+	if len(queues) > 0 {
+		sample.Queues = make(map[string]int, len(queues))
+		for name, depth := range queues {
+			sample.Queues[name] = depth()
+		}
+	}
+
+	readings := []metrics.Sample{
+		{Name: metricHeapObjectBytes},
+		{Name: metricHeapObjects},
+		{Name: metricHeapGoal},
+		{Name: metricGCCycles},
+	}
+	metrics.Read(readings)
+	values := []*uint64{&sample.HeapObjectBytes, &sample.HeapObjects, &sample.HeapGoal, &sample.GCCycles}
+	for i, reading := range readings {
+		if reading.Value.Kind() == metrics.KindUint64 {
+			*values[i] = reading.Value.Uint64()
+		}
+	}
+	return sample
+}
+
+// Sampler records samples periodically. It is safe for concurrent use.
+type Sampler struct {
+	interval time.Duration
+	queues   map[string]func() int
+
+	mutex   sync.Mutex
+	history []Sample
+	next    int
+	full    bool
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Start takes a first sample and starts sampling in the background until
+// Stop; nil options use the defaults
+func Start(opts *Options) *Sampler {
+	var options Options
+	if opts != nil {
+		options = *opts
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.History <= 0 {
+		options.History = DefaultHistory
+	}
+
+	queues := make(map[string]func() int, len(options.Queues))
+	for name, depth := range options.Queues {
+		queues[name] = depth
+	}
+	s := &Sampler{
+		interval: options.Interval,
+		queues:   queues,
+		history:  make([]Sample, options.History),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	s.record()
+	go s.run()
+	return s
+}
+
+// run samples every interval until Stop
+func (s *Sampler) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.record()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// record takes a sample and adds it to the history
+func (s *Sampler) record() {
+	sample := Read(s.queues)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.history[s.next] = sample
+	s.next = (s.next + 1) % len(s.history)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Latest returns the most recent sample
+func (s *Sampler) Latest() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.history[(s.next+len(s.history)-1)%len(s.history)]
+}
+
+// History returns the recorded samples, oldest first
+func (s *Sampler) History() []Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.full {
+		return append([]Sample(nil), s.history[:s.next]...)
+	}
+	return append(append([]Sample(nil), s.history[s.next:]...), s.history[:s.next]...)
+}
+
+// Stop stops sampling; the history stays readable. Calling it again does
+// nothing.
+func (s *Sampler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// Publish exposes the latest sample as the expvar variable name. expvar
+// can't remove variables, so a name can be published once per process; it
+// returns ErrAlreadyPublished for a name in use.
+func (s *Sampler) Publish(name string) error {
+	if expvar.Get(name) != nil {
+		return ErrAlreadyPublished
+	}
+	expvar.Publish(name, expvar.Func(func() any { return s.Latest() }))
+	return nil
+}
@@ -0,0 +1,93 @@
+package memstats
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Test that samples reflect pool use
+func TestRead(t *testing.T) {
+	before := Read(nil)
+	for i := 0; i < 100; i++ {
+		topayz512.ComputeHash([]byte("sample"))
+		topayz512.PutBuffer(topayz512.GetBuffer(1024))
+	}
+	// The heap metrics are only filled in once a collection has run
+	runtime.GC()
+	after := Read(map[string]func() int{"fixed": func() int { return 7 }})
+
+	if after.HashStatePool.Gets < before.HashStatePool.Gets+100 || after.BytePool.Puts < before.BytePool.Puts+100 {
+		t.Errorf("Pool counters didn't advance: %+v -> %+v", before.PoolMetrics, after.PoolMetrics)
+	}
+	if after.HashStatePool.HitRate() <= 0 || after.HashStatePool.HitRate() > 1 {
+		t.Errorf("Hash state hit rate %f is out of range", after.HashStatePool.HitRate())
+	}
+	if after.Queues["fixed"] != 7 {
+		t.Errorf("Queue depth is %d, want 7", after.Queues["fixed"])
+	}
+	if after.HeapObjects == 0 || after.HeapGoal == 0 {
+		t.Errorf("Garbage collector metrics are missing: %+v", after)
+	}
+}
+
+// publishRuns numbers the expvar names TestSampler publishes
+var publishRuns atomic.Int64
+
+// Test periodic sampling, the bounded history and expvar publishing
+func TestSampler(t *testing.T) {
+	depth := 0
+	sampler := Start(&Options{
+		Interval: time.Millisecond,
+		History:  4,
+		Queues:   map[string]func() int{"requests": func() int { return depth }},
+	})
+	defer sampler.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sampler.History()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	history := sampler.History()
+	if len(history) != 4 {
+		t.Fatalf("History has %d samples, want 4", len(history))
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Time.Before(history[i-1].Time) {
+			t.Error("History isn't oldest first")
+		}
+	}
+	if latest := sampler.Latest(); latest.Time.Before(history[len(history)-1].Time) {
+		t.Error("Latest is older than the history")
+	}
+
+	// expvar names can't be unpublished, so each run needs its own
+	name := fmt.Sprintf("%s_%d", t.Name(), publishRuns.Add(1))
+	if err := sampler.Publish(name); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	var published Sample
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatalf("Published sample isn't JSON: %v", err)
+	}
+	if published.Time.IsZero() || published.Queues == nil {
+		t.Errorf("Published sample is incomplete: %+v", published)
+	}
+	if err := sampler.Publish(name); err != ErrAlreadyPublished {
+		t.Errorf("Expected ErrAlreadyPublished, got %v", err)
+	}
+
+	sampler.Stop()
+	sampler.Stop()
+	stopped := sampler.Latest()
+	time.Sleep(5 * time.Millisecond)
+	if sampler.Latest().Time != stopped.Time {
+		t.Error("Sampler kept sampling after Stop")
+	}
+}
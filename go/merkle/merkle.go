@@ -0,0 +1,249 @@
+// Package merkle builds binary Merkle trees with the TOPAY-Z512 hash, for
+// block transaction roots and fragment checksum commitments.
+//
+// Trees have the shape of RFC 6962: a leaf is H(0x00 || data), an inner node
+// H(0x01 || left || right), and the left subtree of n leaves holds the
+// largest power of two below n. The root over fixed-size chunks of a message
+// is therefore the commitment topayz512.MerkleCommitter produces. The root of
+// an empty tree is the hash of no data.
+//
+// A Tree keeps every leaf hash and the roots of its complete subtrees, so
+// Append and Root take logarithmic time.
+//
+// Inclusion proofs let a light client check that a fragment or transaction
+// is under a root without the rest of the data, and consistency proofs that
+// a later root extends an earlier one.
+package merkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Node tags separating leaves from inner nodes
+const (
+	leafTag = 0
+	nodeTag = 1
+)
+
+// encodingMagic starts a serialized tree, followed by the version byte
+const encodingMagic = "TZMT"
+
+// encodingVersion is the serialization version MarshalBinary writes; version
+// 1 lacked the hash algorithm ID
+const encodingVersion = 2
+
+// encodingHeaderSize is magic, version, hash algorithm ID and the uint64 leaf
+// count
+const encodingHeaderSize = len(encodingMagic) + 1 + topayz512.AlgorithmIDSize + 8
+
+var (
+	// ErrIndexOutOfRange indicates a leaf index or tree size beyond the tree
+	ErrIndexOutOfRange = errors.New("merkle: index out of range")
+
+	// ErrInvalidTree indicates a malformed or corrupted serialized tree
+	ErrInvalidTree = errors.New("merkle: invalid serialized tree")
+)
+
+// LeafHash returns the hash of a leaf holding data
+func LeafHash(data []byte) topayz512.Hash {
+	return topayz512.HashMultiple([]byte{leafTag}, data)
+}
+
+// NodeHash returns the hash of an inner node with the given children
+func NodeHash(left, right topayz512.Hash) topayz512.Hash {
+	return topayz512.HashMultiple([]byte{nodeTag}, left[:], right[:])
+}
+
+// Root returns the root of the tree over items, such as a block's
+// serialized transactions
+func Root(items [][]byte) topayz512.Hash {
+	return FromData(items).Root()
+}
+
+// Tree is an append-only Merkle tree. It is not safe for concurrent use.
+type Tree struct {
+	leaves []topayz512.Hash
+	// peaks are the roots of the complete subtrees covering the leaves,
+	// largest first, one per set bit of the leaf count
+	peaks []topayz512.Hash
+}
+
+// New returns an empty tree
+func New() *Tree {
+	return &Tree{}
+}
+
+// FromData returns a tree with one leaf per item
+func FromData(items [][]byte) *Tree {
+	t := &Tree{leaves: make([]topayz512.Hash, 0, len(items))}
+	for _, item := range items {
+		t.Append(item)
+	}
+	return t
+}
+
+// FromFragments returns a tree whose leaves are the fragments' checksums in
+// the order given, committing to a whole transfer with one root
+func FromFragments(fragments []topayz512.Fragment) *Tree {
+	t := &Tree{leaves: make([]topayz512.Hash, 0, len(fragments))}
+	for _, fragment := range fragments {
+		t.Append(fragment.Checksum[:])
+	}
+	return t
+}
+
+// Append adds a leaf holding data and returns its index
+func (t *Tree) Append(data []byte) int {
+	return t.AppendLeafHash(LeafHash(data))
+}
+
+// AppendLeafHash adds a leaf already hashed with LeafHash and returns its index
+func (t *Tree) AppendLeafHash(leaf topayz512.Hash) int {
+	index := len(t.leaves)
+	t.leaves = append(t.leaves, leaf)
+
+	// Merge equal-sized subtrees like a binary counter carrying
+	t.peaks = append(t.peaks, leaf)
+	for size := index + 1; size&1 == 0; size >>= 1 {
+		last := len(t.peaks) - 1
+		t.peaks[last-1] = NodeHash(t.peaks[last-1], t.peaks[last])
+		t.peaks = t.peaks[:last]
+	}
+	return index
+}
+
+// Len returns the number of leaves
+func (t *Tree) Len() int {
+	return len(t.leaves)
+}
+
+// Leaf returns the hash of the leaf at index
+func (t *Tree) Leaf(index int) (topayz512.Hash, error) {
+	if index < 0 || index >= len(t.leaves) {
+		return topayz512.Hash{}, ErrIndexOutOfRange
+	}
+	return t.leaves[index], nil
+}
+
+// Root returns the root of the tree
+func (t *Tree) Root() topayz512.Hash {
+	if len(t.peaks) == 0 {
+		return topayz512.ComputeHash(nil)
+	}
+	// The RFC 6962 root folds the complete subtrees from the right
+	root := t.peaks[len(t.peaks)-1]
+	for i := len(t.peaks) - 2; i >= 0; i-- {
+		root = NodeHash(t.peaks[i], root)
+	}
+	return root
+}
+
+// RootAt returns the root the tree had when it held its first size leaves
+func (t *Tree) RootAt(size int) (topayz512.Hash, error) {
+	if size < 0 || size > len(t.leaves) {
+		return topayz512.Hash{}, ErrIndexOutOfRange
+	}
+	if size == 0 {
+		return topayz512.ComputeHash(nil), nil
+	}
+	return subtreeRoot(t.leaves[:size]), nil
+}
+
+// checkHash accepts the only hash algorithm trees are built with
+func checkHash(algorithm topayz512.Algorithm) error {
+	if algorithm.ID != topayz512.AlgorithmIDHash {
+		return fmt.Errorf("%w: hashed with %s", ErrInvalidTree, algorithm.Name)
+	}
+	return nil
+}
+
+// subtreeRoot returns the root over one or more leaf hashes
+func subtreeRoot(leaves []topayz512.Hash) topayz512.Hash {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	split := splitPoint(len(leaves))
+	return NodeHash(subtreeRoot(leaves[:split]), subtreeRoot(leaves[split:]))
+}
+
+// splitPoint returns the size of the left subtree of n > 1 leaves, the
+// largest power of two below n
+func splitPoint(n int) int {
+	split := 1
+	for split*2 < n {
+		split *= 2
+	}
+	return split
+}
+
+// MarshalBinary serializes the tree as "TZMT", a version byte, the hash
+// algorithm ID, the uint64 big-endian leaf count, the leaf hashes and the
+// root, which UnmarshalBinary checks
+func (t *Tree) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, encodingHeaderSize+(len(t.leaves)+1)*topayz512.HashSize)
+	data = append(data, encodingMagic...)
+	data = append(data, encodingVersion)
+	data = topayz512.AppendAlgorithmID(data, topayz512.AlgorithmIDHash)
+	data = binary.BigEndian.AppendUint64(data, uint64(len(t.leaves)))
+	for _, leaf := range t.leaves {
+		data = append(data, leaf[:]...)
+	}
+	root := t.Root()
+	return append(data, root[:]...), nil
+}
+
+// UnmarshalBinary replaces the tree with one serialized by MarshalBinary,
+// or by version 1, which implied the TOPAY-Z512 hash. It returns
+// topayz512.ErrUnsupportedVersion for an unknown version,
+// topayz512.ErrUnknownAlgorithm for an unregistered hash algorithm and
+// ErrInvalidTree for anything malformed, including a root that doesn't match
+// the leaves or a hash algorithm other than TOPAY-Z512.
+func (t *Tree) UnmarshalBinary(data []byte) error {
+	if len(data) < len(encodingMagic)+1 || string(data[:len(encodingMagic)]) != encodingMagic {
+		return ErrInvalidTree
+	}
+	header := data[len(encodingMagic)+1:]
+	switch data[len(encodingMagic)] {
+	case 1:
+	case encodingVersion:
+		algorithm, rest, err := topayz512.ReadAlgorithmID(header)
+		if err != nil {
+			if errors.Is(err, topayz512.ErrUnknownAlgorithm) {
+				return err
+			}
+			return ErrInvalidTree
+		}
+		if err := checkHash(algorithm); err != nil {
+			return err
+		}
+		header = rest
+	default:
+		return topayz512.ErrUnsupportedVersion
+	}
+	if len(header) < 8+topayz512.HashSize {
+		return ErrInvalidTree
+	}
+	count := binary.BigEndian.Uint64(header)
+	body := header[8:]
+	if count > uint64(len(body)/topayz512.HashSize) || uint64(len(body)) != (count+1)*uint64(topayz512.HashSize) {
+		return ErrInvalidTree
+	}
+
+	decoded := &Tree{leaves: make([]topayz512.Hash, 0, count)}
+	for i := uint64(0); i < count; i++ {
+		var leaf topayz512.Hash
+		copy(leaf[:], body[i*uint64(topayz512.HashSize):])
+		decoded.AppendLeafHash(leaf)
+	}
+	var root topayz512.Hash
+	copy(root[:], body[count*uint64(topayz512.HashSize):])
+	if decoded.Root() != root {
+		return ErrInvalidTree
+	}
+	*t = *decoded
+	return nil
+}
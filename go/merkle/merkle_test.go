@@ -0,0 +1,282 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// items returns n distinct leaves
+func items(n int) [][]byte {
+	result := make([][]byte, n)
+	for i := range result {
+		result[i] = []byte(fmt.Sprintf("transaction %d", i))
+	}
+	return result
+}
+
+// Test that incremental roots match the recursive definition at every size
+func TestAppendRoot(t *testing.T) {
+	tree := New()
+	if tree.Root() != topayz512.ComputeHash(nil) {
+		t.Error("Empty root isn't the hash of no data")
+	}
+	data := items(33)
+	for n, item := range data {
+		if index := tree.Append(item); index != n {
+			t.Fatalf("Append returned %d, want %d", index, n)
+		}
+		leaves := make([]topayz512.Hash, n+1)
+		for i := range leaves {
+			leaves[i] = LeafHash(data[i])
+		}
+		if tree.Root() != subtreeRoot(leaves) {
+			t.Fatalf("Root of %d leaves differs", n+1)
+		}
+	}
+	if tree.Len() != 33 || Root(data) != tree.Root() {
+		t.Error("Root or Len differs")
+	}
+
+	for size := 0; size <= 33; size++ {
+		want := FromData(data[:size]).Root()
+		if got, err := tree.RootAt(size); err != nil || got != want {
+			t.Errorf("RootAt(%d) = %x, %v", size, got[:4], err)
+		}
+	}
+	if _, err := tree.RootAt(34); err != ErrIndexOutOfRange {
+		t.Errorf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+	if leaf, err := tree.Leaf(5); err != nil || leaf != LeafHash(data[5]) {
+		t.Errorf("Leaf(5) is wrong: %v", err)
+	}
+	if _, err := tree.Leaf(-1); err != ErrIndexOutOfRange {
+		t.Errorf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+}
+
+// Test agreement with MerkleCommitter and the RFC 6962 shape
+func TestMerkleCommitter(t *testing.T) {
+	message := bytes.Repeat([]byte("0123456789"), 1000)
+	chunkSize := 512
+	var chunks [][]byte
+	for start := 0; start < len(message); start += chunkSize {
+		chunks = append(chunks, message[start:min(start+chunkSize, len(message))])
+	}
+	root := Root(chunks)
+	if commitment := (topayz512.MerkleCommitter{ChunkSize: chunkSize}).Commit(message); !bytes.Equal(commitment, root[:]) {
+		t.Error("Root differs from MerkleCommitter")
+	}
+
+	a, b, c := LeafHash([]byte("a")), LeafHash([]byte("b")), LeafHash([]byte("c"))
+	if Root([][]byte{[]byte("a"), []byte("b"), []byte("c")}) != NodeHash(NodeHash(a, b), c) {
+		t.Error("Three-leaf tree has the wrong shape")
+	}
+}
+
+// Test trees over fragment checksums
+func TestFromFragments(t *testing.T) {
+	result, err := topayz512.FragmentData(bytes.Repeat([]byte("fragment"), 4096))
+	if err != nil {
+		t.Fatalf("FragmentData failed: %v", err)
+	}
+	tree := FromFragments(result.Fragments)
+	if tree.Len() != len(result.Fragments) {
+		t.Fatalf("Tree has %d leaves for %d fragments", tree.Len(), len(result.Fragments))
+	}
+	if leaf, _ := tree.Leaf(1); leaf != LeafHash(result.Fragments[1].Checksum[:]) {
+		t.Error("Leaf isn't the fragment checksum")
+	}
+	result.Fragments[0].Checksum[0] ^= 1
+	if FromFragments(result.Fragments).Root() == tree.Root() {
+		t.Error("Root ignores a changed checksum")
+	}
+}
+
+// Test serialization round trips and rejects corruption
+func TestMarshalBinary(t *testing.T) {
+	for _, n := range []int{0, 1, 6, 17} {
+		tree := FromData(items(n))
+		data, err := tree.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		var decoded Tree
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary of %d leaves failed: %v", n, err)
+		}
+		if decoded.Len() != n || decoded.Root() != tree.Root() {
+			t.Errorf("Decoded tree of %d leaves differs", n)
+		}
+		decoded.Append([]byte("more"))
+		tree.Append([]byte("more"))
+		if decoded.Root() != tree.Root() {
+			t.Error("Decoded tree doesn't keep appending")
+		}
+	}
+
+	data, _ := FromData(items(5)).MarshalBinary()
+	corrupt := append([]byte{}, data...)
+	corrupt[20] ^= 1
+	var tree Tree
+	if err := tree.UnmarshalBinary(corrupt); err != ErrInvalidTree {
+		t.Errorf("Corrupted leaf: expected ErrInvalidTree, got %v", err)
+	}
+	if err := tree.UnmarshalBinary(data[:len(data)-1]); err != ErrInvalidTree {
+		t.Errorf("Truncated tree: expected ErrInvalidTree, got %v", err)
+	}
+	versioned := append([]byte{}, data...)
+	versioned[4] = 3
+	if err := tree.UnmarshalBinary(versioned); err != topayz512.ErrUnsupportedVersion {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	huge := append([]byte{}, data...)
+	huge[7] = 0xff
+	if err := tree.UnmarshalBinary(huge); err != ErrInvalidTree {
+		t.Errorf("Huge count: expected ErrInvalidTree, got %v", err)
+	}
+
+	// Version 1 had no hash algorithm ID
+	legacy := append([]byte("TZMT\x01"), data[7:]...)
+	if err := tree.UnmarshalBinary(legacy); err != nil || tree.Root() != FromData(items(5)).Root() {
+		t.Errorf("Version 1 tree didn't decode: %v", err)
+	}
+	unknown := append([]byte{}, data...)
+	unknown[5] = 0x7f
+	if err := tree.UnmarshalBinary(unknown); !errors.Is(err, topayz512.ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+	otherHash := topayz512.AppendAlgorithmID(append([]byte{}, data[:5]...), topayz512.AlgorithmIDLegacySHA3)
+	otherHash = append(otherHash, data[7:]...)
+	if err := tree.UnmarshalBinary(otherHash); !errors.Is(err, ErrInvalidTree) {
+		t.Errorf("SHA3 tree: expected ErrInvalidTree, got %v", err)
+	}
+}
+
+// Test inclusion proofs for every leaf of trees of many sizes
+func TestInclusionProofs(t *testing.T) {
+	data := items(33)
+	tree := FromData(data)
+	for size := 1; size <= len(data); size++ {
+		root, _ := tree.RootAt(size)
+		for index := 0; index < size; index++ {
+			proof, err := tree.ProveAt(index, size)
+			if err != nil {
+				t.Fatalf("ProveAt(%d, %d) failed: %v", index, size, err)
+			}
+			if !VerifyProof(root, LeafHash(data[index]), proof) {
+				t.Fatalf("Proof of leaf %d in %d leaves doesn't verify", index, size)
+			}
+			if VerifyProof(root, LeafHash([]byte("other")), proof) {
+				t.Fatalf("Proof of leaf %d in %d leaves verifies another leaf", index, size)
+			}
+			if size > 1 {
+				moved := *proof
+				moved.Index = (index + 1) % size
+				if VerifyProof(root, LeafHash(data[index]), &moved) {
+					t.Fatalf("Proof of leaf %d in %d leaves verifies at another index", index, size)
+				}
+				tampered := *proof
+				tampered.Path = append([]topayz512.Hash{}, proof.Path...)
+				tampered.Path[0][0] ^= 1
+				if VerifyProof(root, LeafHash(data[index]), &tampered) {
+					t.Fatalf("Tampered proof of leaf %d in %d leaves verifies", index, size)
+				}
+			}
+		}
+	}
+
+	proof, err := tree.Prove(7)
+	if err != nil || proof.Size != tree.Len() {
+		t.Fatalf("Prove failed: %v", err)
+	}
+	if !VerifyProof(tree.Root(), LeafHash(data[7]), proof) {
+		t.Error("Proof against the current root doesn't verify")
+	}
+	if _, err := tree.Prove(33); err != ErrIndexOutOfRange {
+		t.Errorf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+	if VerifyProof(tree.Root(), LeafHash(data[7]), nil) {
+		t.Error("Nil proof verifies")
+	}
+}
+
+// Test consistency proofs between every pair of tree sizes
+func TestConsistencyProofs(t *testing.T) {
+	tree := FromData(items(20))
+	for newSize := 0; newSize <= tree.Len(); newSize++ {
+		newRoot, _ := tree.RootAt(newSize)
+		for oldSize := 0; oldSize <= newSize; oldSize++ {
+			oldRoot, _ := tree.RootAt(oldSize)
+			proof, err := tree.ProveConsistency(oldSize, newSize)
+			if err != nil {
+				t.Fatalf("ProveConsistency(%d, %d) failed: %v", oldSize, newSize, err)
+			}
+			if !VerifyConsistency(oldRoot, newRoot, proof) {
+				t.Fatalf("Consistency of %d and %d leaves doesn't verify", oldSize, newSize)
+			}
+			if oldSize > 0 && VerifyConsistency(LeafHash([]byte("forged")), newRoot, proof) {
+				t.Fatalf("Consistency of %d and %d leaves verifies a forged old root", oldSize, newSize)
+			}
+			if oldSize > 0 && oldSize < newSize && VerifyConsistency(oldRoot, LeafHash([]byte("forged")), proof) {
+				t.Fatalf("Consistency of %d and %d leaves verifies a forged new root", oldSize, newSize)
+			}
+		}
+	}
+
+	// A rewritten history isn't consistent with the original
+	rewritten := FromData(items(20))
+	forked := FromData(append(items(4), items(20)[5:]...))
+	proof, _ := forked.ProveConsistency(8, 19)
+	oldRoot, _ := rewritten.RootAt(8)
+	newRoot, _ := forked.RootAt(19)
+	if VerifyConsistency(oldRoot, newRoot, proof) {
+		t.Error("Rewritten history verifies as consistent")
+	}
+	if _, err := tree.ProveConsistency(5, 21); err != ErrIndexOutOfRange {
+		t.Errorf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+}
+
+// Test proof serialization
+func TestProofMarshalBinary(t *testing.T) {
+	data := items(13)
+	tree := FromData(data)
+	proof, _ := tree.Prove(9)
+	encoded, err := proof.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var decoded Proof
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if !VerifyProof(tree.Root(), LeafHash(data[9]), &decoded) {
+		t.Error("Decoded proof doesn't verify")
+	}
+	if err := decoded.UnmarshalBinary(encoded[:len(encoded)-1]); err != ErrInvalidProof {
+		t.Errorf("Truncated proof: expected ErrInvalidProof, got %v", err)
+	}
+	encoded[0] = 0x7f
+	if err := decoded.UnmarshalBinary(encoded); !errors.Is(err, topayz512.ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+
+	consistency, _ := tree.ProveConsistency(5, 13)
+	encoded, _ = consistency.MarshalBinary()
+	var decodedConsistency ConsistencyProof
+	if err := decodedConsistency.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	oldRoot, _ := tree.RootAt(5)
+	if !VerifyConsistency(oldRoot, tree.Root(), &decodedConsistency) {
+		t.Error("Decoded consistency proof doesn't verify")
+	}
+	encoded[9] = 14
+	if err := decodedConsistency.UnmarshalBinary(encoded); err != ErrInvalidProof {
+		t.Errorf("Old size beyond new size: expected ErrInvalidProof, got %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package merkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Inclusion and consistency proofs
+//
+// Proofs follow RFC 9162: an inclusion proof is the audit path from a leaf
+// to the root, and a consistency proof shows that a tree of OldSize leaves
+// is a prefix of one of NewSize leaves. Both are logarithmic in the tree
+// size, so a light client holding only a root can check fragment or
+// transaction membership, and that a root it trusted earlier was extended
+// rather than rewritten.
+
+// proofHeaderSize is the hash algorithm ID and two uint64 fields preceding a
+// serialized proof path
+const proofHeaderSize = topayz512.AlgorithmIDSize + 16
+
+// maxProofPath bounds the path of a serialized proof; trees of up to 2^63
+// leaves need at most 2*63 hashes for a consistency proof
+const maxProofPath = 2 * 63
+
+// ErrInvalidProof indicates a malformed serialized proof
+var ErrInvalidProof = errors.New("merkle: invalid serialized proof")
+
+// Proof proves that a leaf is in a tree of Size leaves at Index
+type Proof struct {
+	Index int
+	Size  int
+	// Path holds the sibling subtree roots from the leaf up to the root
+	Path []topayz512.Hash
+}
+
+// ConsistencyProof proves that the tree of OldSize leaves is a prefix of
+// the tree of NewSize leaves
+type ConsistencyProof struct {
+	OldSize int
+	NewSize int
+	// Path holds the subtree roots needed to rebuild both roots
+	Path []topayz512.Hash
+}
+
+// Prove returns the proof that the leaf at index is in the tree
+func (t *Tree) Prove(index int) (*Proof, error) {
+	return t.ProveAt(index, len(t.leaves))
+}
+
+// ProveAt returns the proof that the leaf at index is in the tree as it was
+// when it held its first size leaves, verifiable against RootAt(size)
+func (t *Tree) ProveAt(index, size int) (*Proof, error) {
+	if size < 0 || size > len(t.leaves) || index < 0 || index >= size {
+		return nil, ErrIndexOutOfRange
+	}
+	return &Proof{Index: index, Size: size, Path: inclusionPath(index, t.leaves[:size])}, nil
+}
+
+// inclusionPath returns the audit path of the leaf at index, deepest
+// sibling first
+func inclusionPath(index int, leaves []topayz512.Hash) []topayz512.Hash {
+	if len(leaves) == 1 {
+		return nil
+	}
+	split := splitPoint(len(leaves))
+	if index < split {
+		return append(inclusionPath(index, leaves[:split]), subtreeRoot(leaves[split:]))
+	}
+	return append(inclusionPath(index-split, leaves[split:]), subtreeRoot(leaves[:split]))
+}
+
+// VerifyProof reports whether proof shows that leaf, a hash from LeafHash,
+// is in the tree with the given root
+func VerifyProof(root, leaf topayz512.Hash, proof *Proof) bool {
+	if proof == nil || proof.Index < 0 || proof.Index >= proof.Size {
+		return false
+	}
+	index, last := uint64(proof.Index), uint64(proof.Size-1)
+	hash := leaf
+	for _, sibling := range proof.Path {
+		if last == 0 {
+			return false
+		}
+		if index&1 == 1 || index == last {
+			hash = NodeHash(sibling, hash)
+			// A left child with no right sibling is promoted unchanged
+			for index&1 == 0 && index != 0 {
+				index >>= 1
+				last >>= 1
+			}
+		} else {
+			hash = NodeHash(hash, sibling)
+		}
+		index >>= 1
+		last >>= 1
+	}
+	return last == 0 && topayz512.HashEqual(hash, root)
+}
+
+// ProveConsistency returns the proof that the tree of oldSize leaves is a
+// prefix of the tree of newSize leaves, verifiable against RootAt(oldSize)
+// and RootAt(newSize)
+func (t *Tree) ProveConsistency(oldSize, newSize int) (*ConsistencyProof, error) {
+	if oldSize < 0 || oldSize > newSize || newSize > len(t.leaves) {
+		return nil, ErrIndexOutOfRange
+	}
+	proof := &ConsistencyProof{OldSize: oldSize, NewSize: newSize}
+	if oldSize > 0 && oldSize < newSize {
+		proof.Path = consistencyPath(oldSize, t.leaves[:newSize], true)
+	}
+	return proof, nil
+}
+
+// consistencyPath implements SUBPROOF of RFC 6962: complete reports whether
+// the old tree's root is a subtree root the verifier already has
+func consistencyPath(oldSize int, leaves []topayz512.Hash, complete bool) []topayz512.Hash {
+	if oldSize == len(leaves) {
+		if complete {
+			return nil
+		}
+		return []topayz512.Hash{subtreeRoot(leaves)}
+	}
+	split := splitPoint(len(leaves))
+	if oldSize <= split {
+		return append(consistencyPath(oldSize, leaves[:split], complete), subtreeRoot(leaves[split:]))
+	}
+	return append(consistencyPath(oldSize-split, leaves[split:], false), subtreeRoot(leaves[:split]))
+}
+
+// VerifyConsistency reports whether proof shows that the tree with root
+// oldRoot is a prefix of the tree with root newRoot. Every tree extends the
+// empty one, and a tree is only consistent with itself at the same size.
+func VerifyConsistency(oldRoot, newRoot topayz512.Hash, proof *ConsistencyProof) bool {
+	if proof == nil || proof.OldSize < 0 || proof.OldSize > proof.NewSize {
+		return false
+	}
+	if proof.OldSize == proof.NewSize {
+		return len(proof.Path) == 0 && topayz512.HashEqual(oldRoot, newRoot)
+	}
+	if proof.OldSize == 0 {
+		return len(proof.Path) == 0 && topayz512.HashEqual(oldRoot, topayz512.ComputeHash(nil))
+	}
+	if len(proof.Path) == 0 {
+		return false
+	}
+
+	path := proof.Path
+	// An old tree whose size is a power of two is itself a subtree of the
+	// new one, and its root starts the path
+	if proof.OldSize&(proof.OldSize-1) == 0 {
+		path = append([]topayz512.Hash{oldRoot}, path...)
+	}
+	index, last := uint64(proof.OldSize-1), uint64(proof.NewSize-1)
+	for index&1 == 1 {
+		index >>= 1
+		last >>= 1
+	}
+
+	oldHash, newHash := path[0], path[0]
+	for _, sibling := range path[1:] {
+		if last == 0 {
+			return false
+		}
+		if index&1 == 1 || index == last {
+			oldHash = NodeHash(sibling, oldHash)
+			newHash = NodeHash(sibling, newHash)
+			for index&1 == 0 && index != 0 {
+				index >>= 1
+				last >>= 1
+			}
+		} else {
+			newHash = NodeHash(newHash, sibling)
+		}
+		index >>= 1
+		last >>= 1
+	}
+	return last == 0 && topayz512.HashEqual(oldHash, oldRoot) && topayz512.HashEqual(newHash, newRoot)
+}
+
+// MarshalBinary serializes the proof as the hash algorithm ID, the uint64
+// big-endian index and size, and the path
+func (p *Proof) MarshalBinary() ([]byte, error) {
+	return marshalProof(uint64(p.Index), uint64(p.Size), p.Path), nil
+}
+
+// UnmarshalBinary replaces the proof with one serialized by MarshalBinary. It
+// returns topayz512.ErrUnknownAlgorithm for an unregistered hash algorithm
+// and ErrInvalidProof for anything malformed.
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	index, size, path, err := unmarshalProof(data)
+	if err != nil {
+		return err
+	}
+	if index >= size {
+		return ErrInvalidProof
+	}
+	*p = Proof{Index: int(index), Size: int(size), Path: path}
+	return nil
+}
+
+// MarshalBinary serializes the proof as the hash algorithm ID, the uint64
+// big-endian old and new sizes, and the path
+func (p *ConsistencyProof) MarshalBinary() ([]byte, error) {
+	return marshalProof(uint64(p.OldSize), uint64(p.NewSize), p.Path), nil
+}
+
+// UnmarshalBinary replaces the proof with one serialized by MarshalBinary,
+// returning the same errors as Proof.UnmarshalBinary
+func (p *ConsistencyProof) UnmarshalBinary(data []byte) error {
+	oldSize, newSize, path, err := unmarshalProof(data)
+	if err != nil {
+		return err
+	}
+	if oldSize > newSize {
+		return ErrInvalidProof
+	}
+	*p = ConsistencyProof{OldSize: int(oldSize), NewSize: int(newSize), Path: path}
+	return nil
+}
+
+// marshalProof encodes two sizes and a path
+func marshalProof(first, second uint64, path []topayz512.Hash) []byte {
+	data := make([]byte, 0, proofHeaderSize+len(path)*topayz512.HashSize)
+	data = topayz512.AppendAlgorithmID(data, topayz512.AlgorithmIDHash)
+	data = binary.BigEndian.AppendUint64(data, first)
+	data = binary.BigEndian.AppendUint64(data, second)
+	for _, hash := range path {
+		data = append(data, hash[:]...)
+	}
+	return data
+}
+
+// unmarshalProof decodes the hash algorithm, two sizes, each fitting an int,
+// and a path
+func unmarshalProof(data []byte) (first, second uint64, path []topayz512.Hash, err error) {
+	if len(data) < proofHeaderSize || (len(data)-proofHeaderSize)%topayz512.HashSize != 0 {
+		return 0, 0, nil, ErrInvalidProof
+	}
+	algorithm, rest, err := topayz512.ReadAlgorithmID(data)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if algorithm.ID != topayz512.AlgorithmIDHash {
+		return 0, 0, nil, fmt.Errorf("%w: hashed with %s", ErrInvalidProof, algorithm.Name)
+	}
+	count := (len(data) - proofHeaderSize) / topayz512.HashSize
+	first = binary.BigEndian.Uint64(rest)
+	second = binary.BigEndian.Uint64(rest[8:])
+	if count > maxProofPath || first > math.MaxInt || second > math.MaxInt {
+		return 0, 0, nil, ErrInvalidProof
+	}
+	path = make([]topayz512.Hash, count)
+	for i := range path {
+		copy(path[i][:], data[proofHeaderSize+i*topayz512.HashSize:])
+	}
+	return first, second, path, nil
+}
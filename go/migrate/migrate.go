@@ -0,0 +1,329 @@
+// Package migrate detects artifacts written in legacy TOPAY-Z512 formats and
+// rewrites them in the current ones.
+//
+// It recognizes three kinds of file:
+//
+//   - Checksum files (Z512SUMS). Entries holding SHA3-512 digests, which the
+//     old pkg/hash package produced, are replaced with the current hash once
+//     the file they name is confirmed to match the old digest.
+//   - Serialized fragments. Fragments in the original layout with 32-bit IDs
+//     are rewritten in the current layout; the ID maps to the same 128-bit ID
+//     DeserializeFragment gives them, so fragments migrated separately still
+//     reassemble.
+//   - Keystores. Version 1 is the only keystore format so far, so keystores
+//     are checked rather than rewritten, and ones whose password derivation
+//     is weaker than the current defaults are reported, since upgrading them
+//     needs the password.
+//
+// Files are rewritten through a temporary file and a rename, so an
+// interrupted migration never leaves a half-written file. Options.DryRun
+// reports what would change without writing anything.
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/keystore"
+)
+
+// Kind is the type of an artifact
+type Kind string
+
+// Artifact kinds
+const (
+	KindChecksumFile Kind = "checksum-file"
+	KindFragment     Kind = "fragment"
+	KindKeystore     Kind = "keystore"
+	KindUnknown      Kind = "unknown"
+)
+
+// Status is the outcome of migrating one file
+type Status string
+
+// Migration statuses
+const (
+	// StatusCurrent means the file already uses the current formats
+	StatusCurrent Status = "current"
+	// StatusMigrated means the file was rewritten in the current formats
+	StatusMigrated Status = "migrated"
+	// StatusOutdated means the file uses a legacy format and was left alone
+	// because of DryRun, or because upgrading it needs a password
+	StatusOutdated Status = "outdated"
+	// StatusSkipped means the file isn't a recognized artifact
+	StatusSkipped Status = "skipped"
+	// StatusFailed means the file couldn't be read, checked or written
+	StatusFailed Status = "failed"
+)
+
+// ErrDigestMismatch indicates a checksum entry matching neither the current
+// nor the legacy digest of its file
+var ErrDigestMismatch = errors.New("digest matches neither the current nor the legacy hash")
+
+// legacyFragmentHeaderSize is the header of the original fragment layout:
+// ID(4) + Index + Total + DataLen
+const legacyFragmentHeaderSize = 16
+
+// Options configures Migrate
+type Options struct {
+	// DryRun reports what would change without writing anything
+	DryRun bool
+	// Backup keeps the original of each rewritten file with a ".bak" suffix
+	Backup bool
+}
+
+// Result reports the migration of one file
+type Result struct {
+	Path   string `json:"path"`
+	Kind   Kind   `json:"kind"`
+	Status Status `json:"status"`
+	// Changes counts the legacy items found: checksum entries, or 1 for a
+	// fragment or keystore
+	Changes int `json:"changes"`
+	// Detail explains the status in a sentence
+	Detail string `json:"detail,omitempty"`
+	// Err is the error behind StatusFailed
+	Err error `json:"-"`
+}
+
+// Detect returns the kind of artifact data holds
+func Detect(data []byte) Kind {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var file keystore.File
+		if json.Unmarshal(trimmed, &file) == nil && file.KDF != "" && file.Cipher != "" {
+			return KindKeystore
+		}
+		return KindUnknown
+	}
+	if _, _, ok := decodeFragment(data); ok {
+		return KindFragment
+	}
+	if entries, err := topayz512.ReadChecksumFile(bytes.NewReader(data)); err == nil && len(entries) > 0 {
+		return KindChecksumFile
+	}
+	return KindUnknown
+}
+
+// Migrate detects the artifact at path and rewrites it in the current
+// formats. Relative paths in a checksum file are resolved against the
+// checksum file's directory. A nil opts migrates in place without a backup.
+func Migrate(path string, opts *Options) Result {
+	if opts == nil {
+		opts = &Options{}
+	}
+	result := Result{Path: path, Kind: KindUnknown}
+	info, err := os.Stat(path)
+	if err != nil {
+		return result.failed(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return result.failed(err)
+	}
+
+	var migrated []byte
+	result.Kind = Detect(data)
+	switch result.Kind {
+	case KindChecksumFile:
+		migrated, err = migrateChecksumFile(data, filepath.Dir(path), &result)
+	case KindFragment:
+		migrated, err = migrateFragment(data, &result)
+	case KindKeystore:
+		err = checkKeystore(data, &result)
+	default:
+		result.Status = StatusSkipped
+		result.Detail = "not a recognized TOPAY-Z512 artifact"
+		return result
+	}
+	if err != nil {
+		return result.failed(err)
+	}
+	if migrated == nil {
+		return result
+	}
+
+	if opts.DryRun {
+		result.Status = StatusOutdated
+		return result
+	}
+	if opts.Backup {
+		if err := writeFile(path+".bak", data, info.Mode().Perm()); err != nil {
+			return result.failed(err)
+		}
+	}
+	if err := writeFile(path, migrated, info.Mode().Perm()); err != nil {
+		return result.failed(err)
+	}
+	result.Status = StatusMigrated
+	return result
+}
+
+// failed marks the result failed with err
+func (r Result) failed(err error) Result {
+	r.Status = StatusFailed
+	r.Err = err
+	r.Detail = err.Error()
+	return r
+}
+
+// migrateChecksumFile replaces legacy SHA3-512 digests line by line, keeping
+// comments, modes and path escaping. It returns nil if nothing changes.
+func migrateChecksumFile(data []byte, root string, result *Result) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		entries, err := topayz512.ReadChecksumFile(strings.NewReader(line))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d", topayz512.ErrInvalidChecksumFile, lineNumber)
+		}
+		if len(entries) == 0 {
+			out.WriteString(line + "\n")
+			continue
+		}
+
+		entry := entries[0]
+		current, legacy, err := hashFile(root, entry.Path)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		switch {
+		case topayz512.HashEqual(current, entry.Hash):
+			out.WriteString(line + "\n")
+		case topayz512.HashEqual(legacy, entry.Hash):
+			// The digest is the first field, after the escape marker if any
+			hexStart := 0
+			if line[0] == '\\' {
+				hexStart = 1
+			}
+			line = line[:hexStart] + current.String() + line[hexStart+2*topayz512.HashSize:]
+			out.WriteString(line + "\n")
+			result.Changes++
+		default:
+			return nil, fmt.Errorf("line %d: %s: %w", lineNumber, entry.Path, ErrDigestMismatch)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if result.Changes == 0 {
+		result.Status = StatusCurrent
+		return nil, nil
+	}
+	result.Detail = fmt.Sprintf("%d entries hold legacy SHA3-512 digests", result.Changes)
+	return out.Bytes(), nil
+}
+
+// hashFile computes the current and legacy digests of a file in one pass
+func hashFile(root, path string) (current, legacy topayz512.Hash, err error) {
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return current, legacy, err
+	}
+	defer file.Close()
+
+	state := topayz512.NewHashState()
+	sha3 := topayz512.NewLegacySHA3Hash()
+	if _, err := io.Copy(io.MultiWriter(state, sha3), file); err != nil {
+		return current, legacy, err
+	}
+	copy(legacy[:], sha3.Sum(nil))
+	return state.Finalize(), legacy, nil
+}
+
+// decodeFragment decodes a serialized fragment, reporting whether it uses
+// the legacy layout. Data only counts as a fragment if its length matches
+// the layout exactly.
+func decodeFragment(data []byte) (topayz512.Fragment, bool, bool) {
+	fragment, err := topayz512.DeserializeFragment(data)
+	if err != nil {
+		return topayz512.Fragment{}, false, false
+	}
+	if bytes.Equal(topayz512.SerializeFragment(fragment), data) {
+		return fragment, false, true
+	}
+	if len(data) == legacyFragmentHeaderSize+len(fragment.Data)+topayz512.HashSize {
+		return fragment, true, true
+	}
+	return topayz512.Fragment{}, false, false
+}
+
+// migrateFragment rewrites a legacy fragment in the current layout. It
+// returns nil if the fragment is already current.
+func migrateFragment(data []byte, result *Result) ([]byte, error) {
+	fragment, legacy, _ := decodeFragment(data)
+	if !legacy {
+		result.Status = StatusCurrent
+		return nil, nil
+	}
+	result.Changes = 1
+	result.Detail = "legacy layout with a 32-bit fragment ID"
+	return topayz512.SerializeFragment(fragment), nil
+}
+
+// checkKeystore checks a keystore's version and password derivation
+func checkKeystore(data []byte, result *Result) error {
+	var file keystore.File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return keystore.ErrInvalidKeystore
+	}
+	if file.Version != keystore.Version {
+		return fmt.Errorf("%w: keystore version %d", topayz512.ErrUnsupportedVersion, file.Version)
+	}
+	params, err := topayz512.ParsePasswordParams(file.KDF)
+	if err != nil {
+		return err
+	}
+	defaults, err := topayz512.NewPasswordParams()
+	if err != nil {
+		return err
+	}
+
+	result.Status = StatusCurrent
+	if params.NeedsUpgrade(defaults) {
+		result.Status = StatusOutdated
+		result.Changes = 1
+		result.Detail = "password derivation is weaker than the current defaults; save the key again with keystore.Save to upgrade it"
+	}
+	return nil
+}
+
+// writeFile replaces path with data through a temporary file and a rename
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
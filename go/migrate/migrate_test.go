@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/keystore"
+)
+
+// legacyFragment serializes a fragment in the original 32-bit ID layout
+func legacyFragment(id uint32, fragment topayz512.Fragment) []byte {
+	var header [legacyFragmentHeaderSize]byte
+	binary.BigEndian.PutUint32(header[0:], id)
+	binary.BigEndian.PutUint32(header[4:], fragment.Index)
+	binary.BigEndian.PutUint32(header[8:], fragment.Total)
+	binary.BigEndian.PutUint32(header[12:], uint32(len(fragment.Data)))
+	data := append(header[:], fragment.Data...)
+	return append(data, fragment.Checksum[:]...)
+}
+
+// writeTestFile writes data to name in dir and returns the path
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+// Test migrating checksum files with legacy digests
+func TestMigrateChecksumFile(t *testing.T) {
+	dir := t.TempDir()
+	artifact := []byte("release artifact")
+	writeTestFile(t, dir, "a.tar.gz", artifact)
+	writeTestFile(t, dir, "b.tar.gz", []byte("current artifact"))
+
+	sha3 := topayz512.NewLegacySHA3Hash()
+	sha3.Write(artifact)
+	var legacy topayz512.Hash
+	copy(legacy[:], sha3.Sum(nil))
+	current := topayz512.ComputeHash([]byte("current artifact"))
+	sums := "# release sums\n" + legacy.String() + " *a.tar.gz\n" + current.String() + "  b.tar.gz\n"
+	path := writeTestFile(t, dir, topayz512.ChecksumFileName, []byte(sums))
+
+	result := Migrate(path, &Options{DryRun: true})
+	if result.Kind != KindChecksumFile || result.Status != StatusOutdated || result.Changes != 1 {
+		t.Fatalf("Dry run: %+v", result)
+	}
+	if data, _ := os.ReadFile(path); string(data) != sums {
+		t.Error("Dry run changed the file")
+	}
+
+	result = Migrate(path, &Options{Backup: true})
+	if result.Status != StatusMigrated || result.Changes != 1 {
+		t.Fatalf("Migrate: %+v", result)
+	}
+	want := "# release sums\n" + topayz512.ComputeHash(artifact).String() + " *a.tar.gz\n" + current.String() + "  b.tar.gz\n"
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("Migrated file:\n%s", data)
+	}
+	if backup, _ := os.ReadFile(path + ".bak"); string(backup) != sums {
+		t.Error("Backup doesn't hold the original")
+	}
+	file, _ := os.Open(path)
+	defer file.Close()
+	if _, err := topayz512.VerifyChecksumFile(file, dir); err != nil {
+		t.Errorf("Migrated file doesn't verify: %v", err)
+	}
+	if result := Migrate(path, nil); result.Status != StatusCurrent {
+		t.Errorf("Second migration: %+v", result)
+	}
+
+	// An entry matching neither digest fails and leaves the file alone
+	bad := topayz512.ComputeHash([]byte("tampered")).String() + "  a.tar.gz\n"
+	badPath := writeTestFile(t, dir, "BADSUMS", []byte(bad))
+	if result := Migrate(badPath, nil); result.Status != StatusFailed || !errors.Is(result.Err, ErrDigestMismatch) {
+		t.Errorf("Mismatched entry: %+v", result)
+	}
+}
+
+// Test migrating fragments in the legacy layout
+func TestMigrateFragment(t *testing.T) {
+	dir := t.TempDir()
+	fragmented, err := topayz512.FragmentData(bytes.Repeat([]byte("fragment "), 2000))
+	if err != nil {
+		t.Fatalf("FragmentData failed: %v", err)
+	}
+	fragment := fragmented.Fragments[1]
+
+	path := writeTestFile(t, dir, "legacy.frag", legacyFragment(0xdeadbeef, fragment))
+	result := Migrate(path, nil)
+	if result.Kind != KindFragment || result.Status != StatusMigrated {
+		t.Fatalf("Migrate: %+v", result)
+	}
+	data, _ := os.ReadFile(path)
+	migrated, err := topayz512.DeserializeFragment(data)
+	if err != nil {
+		t.Fatalf("DeserializeFragment failed: %v", err)
+	}
+	if migrated.ID != topayz512.LegacyFragmentID(0xdeadbeef) || !bytes.Equal(migrated.Data, fragment.Data) {
+		t.Error("Migrated fragment differs")
+	}
+	if !bytes.Equal(data, topayz512.SerializeFragment(migrated)) {
+		t.Error("Migrated fragment isn't in the current layout")
+	}
+
+	currentPath := writeTestFile(t, dir, "current.frag", topayz512.SerializeFragment(fragment))
+	if result := Migrate(currentPath, nil); result.Kind != KindFragment || result.Status != StatusCurrent {
+		t.Errorf("Current fragment: %+v", result)
+	}
+}
+
+// Test checking keystores
+func TestMigrateKeystore(t *testing.T) {
+	privateKey, _, _ := topayz512.GenerateKeyPair()
+	weak := &keystore.Options{Params: &topayz512.PasswordParams{
+		Algorithm:   topayz512.PasswordArgon2id,
+		Iterations:  1,
+		Memory:      64,
+		Parallelism: 1,
+		Salt:        bytes.Repeat([]byte{1}, topayz512.MinPasswordSaltSize),
+	}}
+	data, err := keystore.Encrypt(privateKey, []byte("password"), weak)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	path := writeTestFile(t, t.TempDir(), "wallet.json", data)
+
+	result := Migrate(path, nil)
+	if result.Kind != KindKeystore || result.Status != StatusOutdated || !strings.Contains(result.Detail, "password") {
+		t.Errorf("Weak keystore: %+v", result)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+		t.Error("Keystore was rewritten")
+	}
+}
+
+// Test detecting artifact kinds
+func TestDetect(t *testing.T) {
+	for data, want := range map[string]Kind{
+		"":                         KindUnknown,
+		"hello":                    KindUnknown,
+		`{"name": "not a wallet"}`: KindUnknown,
+		strings.Repeat("00", topayz512.HashSize) + "  file\n": KindChecksumFile,
+	} {
+		if got := Detect([]byte(data)); got != want {
+			t.Errorf("Detect(%q) = %s, want %s", data, got, want)
+		}
+	}
+	if result := Migrate(filepath.Join(t.TempDir(), "missing"), nil); result.Status != StatusFailed {
+		t.Errorf("Missing file: %+v", result)
+	}
+}
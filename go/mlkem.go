@@ -0,0 +1,203 @@
+package topayz512
+
+import (
+	"crypto/subtle"
+)
+
+// ML-KEM-768 (FIPS 203) interoperability
+//
+// These functions produce standard ML-KEM-768 keys, ciphertexts and shared
+// secrets, for exchanging keys with peers that don't use TOPAY-Z512. They
+// share the Module-LWE arithmetic of the TOPAY-Z512 KEM but use the FIPS 203
+// parameters and hashes, so the two KEMs' keys and ciphertexts are not
+// interchangeable.
+
+// mlkem768Params is K-PKE at the ML-KEM-768 parameter set
+var mlkem768Params = mlweParams{k: 3, columns: 1, eta1: 2, eta2: 2, du: 10, dv: 4}
+
+// Offsets into an ML-KEM-768 decapsulation key dk_PKE || ek || H(ek) || z
+const (
+	mlkem768EKOffset = 3 * lwePolyBytes
+	mlkem768HOffset  = mlkem768EKOffset + 3*lwePolyBytes + lweSeedSize
+	mlkem768ZOffset  = mlkem768HOffset + 32
+)
+
+// MLKEM768PublicKey is an ML-KEM-768 encapsulation key
+type MLKEM768PublicKey [MLKEM768PublicKeySize]byte
+
+// MLKEM768SecretKey is an ML-KEM-768 decapsulation key in the FIPS 203
+// expanded encoding
+type MLKEM768SecretKey [MLKEM768SecretKeySize]byte
+
+// MLKEM768Ciphertext is an ML-KEM-768 ciphertext
+type MLKEM768Ciphertext [MLKEM768CiphertextSize]byte
+
+// MLKEMSharedSecret is an ML-KEM shared secret
+type MLKEMSharedSecret [MLKEMSharedSecretSize]byte
+
+// MLKEM768KeyGen generates an ML-KEM-768 key pair
+func MLKEM768KeyGen() (MLKEM768PublicKey, MLKEM768SecretKey, error) {
+	seed := make([]byte, MLKEMSeedSize)
+	if err := readRandom(seed); err != nil {
+		return MLKEM768PublicKey{}, MLKEM768SecretKey{}, err
+	}
+	defer SecureZero(seed)
+	return MLKEM768KeyFromSeed(seed)
+}
+
+// MLKEM768KeyFromSeed derives an ML-KEM-768 key pair from the 64-byte seed
+// d || z (FIPS 203 ML-KEM.KeyGen_internal), the compact private key form
+// other implementations accept
+func MLKEM768KeyFromSeed(seed []byte) (MLKEM768PublicKey, MLKEM768SecretKey, error) {
+	if len(seed) != MLKEMSeedSize {
+		return MLKEM768PublicKey{}, MLKEM768SecretKey{}, ErrInvalidKeySize
+	}
+
+	g := sha3Sum512(seed[:32], []byte{byte(mlkem768Params.k)})
+	defer SecureZero(g[:])
+	pk, sk := mlkem768Params.keyGen(g[:32], g[32:])
+	defer sk.wipe()
+
+	var publicKey MLKEM768PublicKey
+	copy(publicKey[:], mlkem768Params.encodePublicKey(pk))
+
+	var secretKey MLKEM768SecretKey
+	encodedSecret := mlkem768Params.encodeSecretKey(sk)
+	copy(secretKey[:], encodedSecret)
+	SecureZero(encodedSecret)
+	copy(secretKey[mlkem768EKOffset:], publicKey[:])
+	h := sha3Sum256(publicKey[:])
+	copy(secretKey[mlkem768HOffset:], h[:])
+	copy(secretKey[mlkem768ZOffset:], seed[32:])
+
+	return publicKey, secretKey, nil
+}
+
+// MLKEMEncapsulate encapsulates a shared secret to an ML-KEM-768
+// encapsulation key. It returns ErrInvalidKEMPublicKey if the key fails the
+// FIPS 203 modulus check.
+func MLKEMEncapsulate(publicKey MLKEM768PublicKey) (MLKEM768Ciphertext, MLKEMSharedSecret, error) {
+	message := make([]byte, 32)
+	if err := readRandom(message); err != nil {
+		return MLKEM768Ciphertext{}, MLKEMSharedSecret{}, err
+	}
+	defer SecureZero(message)
+	return mlkemEncapsulateMessage(publicKey, message)
+}
+
+// mlkemEncapsulateMessage implements ML-KEM.Encaps_internal
+func mlkemEncapsulateMessage(publicKey MLKEM768PublicKey, message []byte) (MLKEM768Ciphertext, MLKEMSharedSecret, error) {
+	pk, ok := mlkem768Params.decodePublicKey(publicKey[:])
+	if !ok {
+		return MLKEM768Ciphertext{}, MLKEMSharedSecret{}, ErrInvalidKEMPublicKey
+	}
+
+	h := sha3Sum256(publicKey[:])
+	g := sha3Sum512(message, h[:])
+	defer SecureZero(g[:])
+
+	var ciphertext MLKEM768Ciphertext
+	copy(ciphertext[:], mlkem768Params.encrypt(pk, message, g[32:]))
+	var sharedSecret MLKEMSharedSecret
+	copy(sharedSecret[:], g[:32])
+	return ciphertext, sharedSecret, nil
+}
+
+// MLKEMDecapsulate recovers the shared secret of an ML-KEM-768 ciphertext.
+// Like every FIPS 203 implementation it never reports a bad ciphertext: one
+// not produced for this key yields an unrelated secret. It returns
+// ErrInvalidKEMSecretKey if the key fails the FIPS 203 hash check.
+func MLKEMDecapsulate(secretKey MLKEM768SecretKey, ciphertext MLKEM768Ciphertext) (MLKEMSharedSecret, error) {
+	encapsulationKey := secretKey[mlkem768EKOffset:mlkem768HOffset]
+	h := sha3Sum256(encapsulationKey)
+	if !ConstantTimeEqual(h[:], secretKey[mlkem768HOffset:mlkem768ZOffset]) {
+		return MLKEMSharedSecret{}, ErrInvalidKEMSecretKey
+	}
+	pk, ok := mlkem768Params.decodePublicKey(encapsulationKey)
+	if !ok {
+		return MLKEMSharedSecret{}, ErrInvalidKEMSecretKey
+	}
+	sk, ok := mlkem768Params.decodeSecretKey(secretKey[:mlkem768EKOffset])
+	if !ok {
+		return MLKEMSharedSecret{}, ErrInvalidKEMSecretKey
+	}
+	defer sk.wipe()
+
+	message := mlkem768Params.decrypt(sk, ciphertext[:])
+	defer SecureZero(message)
+	g := sha3Sum512(message, h[:])
+	defer SecureZero(g[:])
+
+	var sharedSecret, rejection MLKEMSharedSecret
+	copy(sharedSecret[:], g[:32])
+	shake256(rejection[:], secretKey[mlkem768ZOffset:], ciphertext[:])
+	reencrypted := mlkem768Params.encrypt(pk, message, g[32:])
+	subtle.ConstantTimeCopy(1-subtle.ConstantTimeCompare(reencrypted, ciphertext[:]), sharedSecret[:], rejection[:])
+	SecureZero(rejection[:])
+
+	return sharedSecret, nil
+}
+
+// PublicKey returns the encapsulation key embedded in a decapsulation key
+func (sk MLKEM768SecretKey) PublicKey() MLKEM768PublicKey {
+	var publicKey MLKEM768PublicKey
+	copy(publicKey[:], sk[mlkem768EKOffset:mlkem768HOffset])
+	return publicKey
+}
+
+// MLKEM768PublicKeyFromBytes parses an ML-KEM-768 encapsulation key,
+// applying the FIPS 203 modulus check
+func MLKEM768PublicKeyFromBytes(data []byte) (MLKEM768PublicKey, error) {
+	if len(data) != MLKEM768PublicKeySize {
+		return MLKEM768PublicKey{}, ErrInvalidKeySize
+	}
+	if _, ok := mlkem768Params.decodePublicKey(data); !ok {
+		return MLKEM768PublicKey{}, ErrInvalidKEMPublicKey
+	}
+	var publicKey MLKEM768PublicKey
+	copy(publicKey[:], data)
+	return publicKey, nil
+}
+
+// MLKEM768SecretKeyFromBytes parses an ML-KEM-768 decapsulation key,
+// applying the FIPS 203 hash check
+func MLKEM768SecretKeyFromBytes(data []byte) (MLKEM768SecretKey, error) {
+	if len(data) != MLKEM768SecretKeySize {
+		return MLKEM768SecretKey{}, ErrInvalidKeySize
+	}
+	h := sha3Sum256(data[mlkem768EKOffset:mlkem768HOffset])
+	if !ConstantTimeEqual(h[:], data[mlkem768HOffset:mlkem768ZOffset]) {
+		return MLKEM768SecretKey{}, ErrInvalidKEMSecretKey
+	}
+	var secretKey MLKEM768SecretKey
+	copy(secretKey[:], data)
+	return secretKey, nil
+}
+
+// MLKEM768CiphertextFromBytes parses an ML-KEM-768 ciphertext
+func MLKEM768CiphertextFromBytes(data []byte) (MLKEM768Ciphertext, error) {
+	if len(data) != MLKEM768CiphertextSize {
+		return MLKEM768Ciphertext{}, ErrInvalidCiphertextSize
+	}
+	var ciphertext MLKEM768Ciphertext
+	copy(ciphertext[:], data)
+	return ciphertext, nil
+}
+
+// SecureEraseMLKEM768SecretKey erases an ML-KEM-768 decapsulation key. It does
+// nothing for a nil key.
+func SecureEraseMLKEM768SecretKey(secretKey *MLKEM768SecretKey) {
+	if secretKey == nil {
+		return
+	}
+	SecureZero(secretKey[:])
+}
+
+// SecureEraseMLKEMSharedSecret erases an ML-KEM shared secret. It does nothing
+// for a nil secret.
+func SecureEraseMLKEMSharedSecret(sharedSecret *MLKEMSharedSecret) {
+	if sharedSecret == nil {
+		return
+	}
+	SecureZero(sharedSecret[:])
+}
@@ -0,0 +1,504 @@
+package topayz512
+
+import "runtime"
+
+// Module-LWE public-key encryption over R_q = Z_q[X]/(X^256+1)
+//
+// This is the K-PKE construction of FIPS 203 (ML-KEM) with two generalizations
+// used by the TOPAY-Z512 KEM: the secret may have several columns, each
+// encrypting its own 256-bit message polynomial, and the noise PRF seed may be
+// longer than 32 bytes. With one column and a 32-byte seed it is exactly K-PKE.
+// Arithmetic is on coefficients in [0, q) with constant-time reductions; the
+// only secret-dependent operations are multiplications and divisions by the
+// constant q, which compile to multiply and shift sequences.
+
+// Ring parameters
+const (
+	// lweN is the degree of the ring polynomial
+	lweN = 256
+
+	// lweQ is the coefficient modulus
+	lweQ = 3329
+
+	// lweSeedSize is the size of the public matrix seed rho
+	lweSeedSize = 32
+
+	// lwePolyBytes is the size of a polynomial with 12-bit coefficients
+	lwePolyBytes = lweN * 12 / 8
+
+	// lweMessageBytes is the message carried by one column
+	lweMessageBytes = lweN / 8
+
+	// lweInvN is 128^-1 mod q, the scaling of the inverse NTT
+	lweInvN = 3303
+)
+
+// lwePoly is a ring element with coefficients in [0, q)
+type lwePoly [lweN]uint16
+
+// lweZetas holds 17^BitRev7(i) mod q and lweGammas 17^(2*BitRev7(i)+1) mod q,
+// the twiddle factors of the NTT and of base case multiplication
+var lweZetas, lweGammas = func() (zetas, gammas [128]uint16) {
+	power := func(exponent int) uint16 {
+		result := uint32(1)
+		for i := 0; i < exponent; i++ {
+			result = result * 17 % lweQ
+		}
+		return uint16(result)
+	}
+	for i := range zetas {
+		reversed := 0
+		for bit := 0; bit < 7; bit++ {
+			reversed |= (i >> bit & 1) << (6 - bit)
+		}
+		zetas[i] = power(reversed)
+		gammas[i] = power(2*reversed + 1)
+	}
+	return zetas, gammas
+}()
+
+// fieldReduceOnce maps x in [0, 2q) to [0, q) without branching
+func fieldReduceOnce(x uint32) uint16 {
+	x -= lweQ
+	x += lweQ & uint32(int32(x)>>31)
+	return uint16(x)
+}
+
+// fieldAdd returns a + b mod q
+func fieldAdd(a, b uint16) uint16 {
+	return fieldReduceOnce(uint32(a) + uint32(b))
+}
+
+// fieldSub returns a - b mod q
+func fieldSub(a, b uint16) uint16 {
+	return fieldReduceOnce(uint32(a) + lweQ - uint32(b))
+}
+
+// fieldMul returns a * b mod q
+func fieldMul(a, b uint16) uint16 {
+	return uint16(uint32(a) * uint32(b) % lweQ)
+}
+
+// wipe zeroes f
+func (f *lwePoly) wipe() {
+	for i := range f {
+		f[i] = 0
+	}
+	runtime.KeepAlive(f)
+}
+
+// add sets f to f + g
+func (f *lwePoly) add(g *lwePoly) {
+	for i := range f {
+		f[i] = fieldAdd(f[i], g[i])
+	}
+}
+
+// sub sets f to f - g
+func (f *lwePoly) sub(g *lwePoly) {
+	for i := range f {
+		f[i] = fieldSub(f[i], g[i])
+	}
+}
+
+// ntt transforms f in place to the NTT domain (FIPS 203 Algorithm 9)
+func (f *lwePoly) ntt() {
+	k := 1
+	for length := 128; length >= 2; length /= 2 {
+		for start := 0; start < lweN; start += 2 * length {
+			zeta := lweZetas[k]
+			k++
+			for j := start; j < start+length; j++ {
+				t := fieldMul(zeta, f[j+length])
+				f[j+length] = fieldSub(f[j], t)
+				f[j] = fieldAdd(f[j], t)
+			}
+		}
+	}
+}
+
+// invNTT transforms f in place back from the NTT domain (FIPS 203 Algorithm 10)
+func (f *lwePoly) invNTT() {
+	k := 127
+	for length := 2; length <= 128; length *= 2 {
+		for start := 0; start < lweN; start += 2 * length {
+			zeta := lweZetas[k]
+			k--
+			for j := start; j < start+length; j++ {
+				t := f[j]
+				f[j] = fieldAdd(t, f[j+length])
+				f[j+length] = fieldMul(zeta, fieldSub(f[j+length], t))
+			}
+		}
+	}
+	for i := range f {
+		f[i] = fieldMul(f[i], lweInvN)
+	}
+}
+
+// mulAddNTT adds the product of f and g, both in the NTT domain, to h
+// (FIPS 203 Algorithms 11 and 12)
+func (h *lwePoly) mulAddNTT(f, g *lwePoly) {
+	for i := 0; i < 128; i++ {
+		a0, a1 := f[2*i], f[2*i+1]
+		b0, b1 := g[2*i], g[2*i+1]
+		c0 := fieldAdd(fieldMul(a0, b0), fieldMul(fieldMul(a1, b1), lweGammas[i]))
+		c1 := fieldAdd(fieldMul(a0, b1), fieldMul(a1, b0))
+		h[2*i] = fieldAdd(h[2*i], c0)
+		h[2*i+1] = fieldAdd(h[2*i+1], c1)
+	}
+}
+
+// sampleNTT samples a uniform polynomial in the NTT domain from SHAKE128(rho
+// || j || i) by rejection (FIPS 203 Algorithm 7)
+func sampleNTT(rho []byte, j, i byte) lwePoly {
+	xof := newShake128()
+	xof.Write(rho)
+	xof.Write([]byte{j, i})
+
+	var f lwePoly
+	var block [shake128Rate]byte
+	count := 0
+	for count < lweN {
+		xof.Read(block[:])
+		for b := 0; b+3 <= len(block) && count < lweN; b += 3 {
+			d1 := uint16(block[b]) | uint16(block[b+1]&0x0f)<<8
+			d2 := uint16(block[b+1]>>4) | uint16(block[b+2])<<4
+			if d1 < lweQ {
+				f[count] = d1
+				count++
+			}
+			if d2 < lweQ && count < lweN {
+				f[count] = d2
+				count++
+			}
+		}
+	}
+	return f
+}
+
+// samplePolyCBD samples a polynomial from the centered binomial distribution
+// with parameter eta, using PRF(seed, nonce) = SHAKE256(seed || nonce) as the
+// source of its 64*eta input bytes (FIPS 203 Algorithm 8)
+func samplePolyCBD(eta int, seed []byte, nonce byte) lwePoly {
+	buf := make([]byte, 64*eta)
+	shake256(buf, seed, []byte{nonce})
+
+	bit := func(index int) uint16 {
+		return uint16(buf[index/8]>>(index%8)) & 1
+	}
+
+	var f lwePoly
+	for i := range f {
+		var x, y uint16
+		for j := 0; j < eta; j++ {
+			x += bit(2*i*eta + j)
+			y += bit(2*i*eta + eta + j)
+		}
+		f[i] = fieldSub(x, y)
+	}
+	SecureZero(buf)
+	return f
+}
+
+// compress maps a coefficient to d bits (FIPS 203 Compress_d)
+func compress(x uint16, d int) uint16 {
+	return uint16((uint32(x)<<d+lweQ/2)/lweQ) & (1<<d - 1)
+}
+
+// decompress maps d bits back to a coefficient (FIPS 203 Decompress_d)
+func decompress(y uint16, d int) uint16 {
+	return uint16((uint32(y)*lweQ + 1<<(d-1)) >> d)
+}
+
+// appendPoly appends the coefficients of f, each d bits wide and least
+// significant bit first (FIPS 203 Algorithm 5)
+func appendPoly(dst []byte, f *lwePoly, d int) []byte {
+	var acc uint32
+	accBits := 0
+	for _, c := range f {
+		acc |= uint32(c) << accBits
+		accBits += d
+		for accBits >= 8 {
+			dst = append(dst, byte(acc))
+			acc >>= 8
+			accBits -= 8
+		}
+	}
+	return dst
+}
+
+// decodePoly reads 32*d bytes of d-bit coefficients (FIPS 203 Algorithm 6).
+// For d = 12 it reports whether every coefficient is below q.
+func decodePoly(data []byte, d int) (lwePoly, bool) {
+	var f lwePoly
+	var acc uint32
+	accBits := 0
+	valid := true
+	mask := uint32(1)<<d - 1
+	for i := range f {
+		for accBits < d {
+			acc |= uint32(data[0]) << accBits
+			data = data[1:]
+			accBits += 8
+		}
+		f[i] = uint16(acc & mask)
+		acc >>= d
+		accBits -= d
+		if f[i] >= lweQ {
+			valid = false
+		}
+	}
+	return f, valid
+}
+
+// mlweParams describes a Module-LWE encryption scheme
+type mlweParams struct {
+	// k is the module rank
+	k int
+
+	// columns is the number of secret columns and 256-bit message polynomials
+	columns int
+
+	// eta1 and eta2 are the CBD parameters of the secrets and of the
+	// encryption errors
+	eta1, eta2 int
+
+	// du and dv are the compression widths of the ciphertext parts
+	du, dv int
+}
+
+// publicKeySize returns the encoded public key size
+func (p *mlweParams) publicKeySize() int {
+	return p.columns*p.k*lwePolyBytes + lweSeedSize
+}
+
+// ciphertextSize returns the encoded ciphertext size
+func (p *mlweParams) ciphertextSize() int {
+	return lweN / 8 * (p.du*p.k + p.dv*p.columns)
+}
+
+// messageSize returns the message size
+func (p *mlweParams) messageSize() int {
+	return lweMessageBytes * p.columns
+}
+
+// mlwePublicKey is an expanded public key
+type mlwePublicKey struct {
+	rho [lweSeedSize]byte
+
+	// t holds t̂ = Â ŝ + ê for each column, in the NTT domain
+	t [][]lwePoly
+
+	// a holds the matrix Â expanded from rho, in the NTT domain
+	a [][]lwePoly
+}
+
+// mlweSecretKey is an expanded secret key
+type mlweSecretKey struct {
+	// s holds ŝ for each column, in the NTT domain
+	s [][]lwePoly
+}
+
+// wipe erases the secret vectors
+func (sk *mlweSecretKey) wipe() {
+	for _, column := range sk.s {
+		for i := range column {
+			column[i].wipe()
+		}
+	}
+}
+
+// expandMatrix samples Â[i][j] from rho
+func (p *mlweParams) expandMatrix(rho []byte) [][]lwePoly {
+	a := make([][]lwePoly, p.k)
+	for i := range a {
+		a[i] = make([]lwePoly, p.k)
+		for j := range a[i] {
+			a[i][j] = sampleNTT(rho, byte(j), byte(i))
+		}
+	}
+	return a
+}
+
+// sampleVectorNTT samples a length-k vector with CBD parameter eta, drawing
+// PRF nonces from *nonce, and transforms it to the NTT domain
+func (p *mlweParams) sampleVectorNTT(eta int, seed []byte, nonce *byte) []lwePoly {
+	v := make([]lwePoly, p.k)
+	for i := range v {
+		v[i] = samplePolyCBD(eta, seed, *nonce)
+		v[i].ntt()
+		*nonce++
+	}
+	return v
+}
+
+// keyGen derives a key pair from the matrix seed rho and the noise seed
+// sigma (FIPS 203 Algorithm 13 after the seed expansion)
+func (p *mlweParams) keyGen(rho, sigma []byte) (*mlwePublicKey, *mlweSecretKey) {
+	pk := &mlwePublicKey{a: p.expandMatrix(rho), t: make([][]lwePoly, p.columns)}
+	copy(pk.rho[:], rho)
+	sk := &mlweSecretKey{s: make([][]lwePoly, p.columns)}
+
+	var nonce byte
+	for c := range sk.s {
+		sk.s[c] = p.sampleVectorNTT(p.eta1, sigma, &nonce)
+	}
+	for c := range pk.t {
+		e := p.sampleVectorNTT(p.eta1, sigma, &nonce)
+		pk.t[c] = e
+		for i := range e {
+			for j := 0; j < p.k; j++ {
+				pk.t[c][i].mulAddNTT(&pk.a[i][j], &sk.s[c][j])
+			}
+		}
+	}
+	return pk, sk
+}
+
+// encodePublicKey returns t̂ with 12-bit coefficients followed by rho
+func (p *mlweParams) encodePublicKey(pk *mlwePublicKey) []byte {
+	out := make([]byte, 0, p.publicKeySize())
+	for c := range pk.t {
+		for i := range pk.t[c] {
+			out = appendPoly(out, &pk.t[c][i], 12)
+		}
+	}
+	return append(out, pk.rho[:]...)
+}
+
+// decodePublicKey parses an encoded public key, rejecting coefficients that
+// aren't reduced mod q
+func (p *mlweParams) decodePublicKey(data []byte) (*mlwePublicKey, bool) {
+	if len(data) != p.publicKeySize() {
+		return nil, false
+	}
+	pk := &mlwePublicKey{t: make([][]lwePoly, p.columns)}
+	for c := range pk.t {
+		pk.t[c] = make([]lwePoly, p.k)
+		for i := range pk.t[c] {
+			var valid bool
+			pk.t[c][i], valid = decodePoly(data[:lwePolyBytes], 12)
+			if !valid {
+				return nil, false
+			}
+			data = data[lwePolyBytes:]
+		}
+	}
+	copy(pk.rho[:], data)
+	pk.a = p.expandMatrix(pk.rho[:])
+	return pk, true
+}
+
+// encodeSecretKey returns ŝ with 12-bit coefficients
+func (p *mlweParams) encodeSecretKey(sk *mlweSecretKey) []byte {
+	out := make([]byte, 0, p.columns*p.k*lwePolyBytes)
+	for c := range sk.s {
+		for i := range sk.s[c] {
+			out = appendPoly(out, &sk.s[c][i], 12)
+		}
+	}
+	return out
+}
+
+// decodeSecretKey parses a secret key written by encodeSecretKey
+func (p *mlweParams) decodeSecretKey(data []byte) (*mlweSecretKey, bool) {
+	if len(data) != p.columns*p.k*lwePolyBytes {
+		return nil, false
+	}
+	sk := &mlweSecretKey{s: make([][]lwePoly, p.columns)}
+	for c := range sk.s {
+		sk.s[c] = make([]lwePoly, p.k)
+		for i := range sk.s[c] {
+			var valid bool
+			sk.s[c][i], valid = decodePoly(data[:lwePolyBytes], 12)
+			if !valid {
+				sk.wipe()
+				return nil, false
+			}
+			data = data[lwePolyBytes:]
+		}
+	}
+	return sk, true
+}
+
+// encrypt encrypts a messageSize message with the given coins (FIPS 203
+// Algorithm 14)
+func (p *mlweParams) encrypt(pk *mlwePublicKey, message, coins []byte) []byte {
+	var nonce byte
+	r := p.sampleVectorNTT(p.eta1, coins, &nonce)
+
+	out := make([]byte, 0, p.ciphertextSize())
+	for i := 0; i < p.k; i++ {
+		var u lwePoly
+		for j := 0; j < p.k; j++ {
+			u.mulAddNTT(&pk.a[j][i], &r[j])
+		}
+		u.invNTT()
+		e1 := samplePolyCBD(p.eta2, coins, nonce)
+		nonce++
+		u.add(&e1)
+		for n := range u {
+			u[n] = compress(u[n], p.du)
+		}
+		out = appendPoly(out, &u, p.du)
+	}
+
+	for c := 0; c < p.columns; c++ {
+		var v lwePoly
+		for i := 0; i < p.k; i++ {
+			v.mulAddNTT(&pk.t[c][i], &r[i])
+		}
+		v.invNTT()
+		e2 := samplePolyCBD(p.eta2, coins, nonce)
+		nonce++
+		v.add(&e2)
+		mu, _ := decodePoly(message[c*lweMessageBytes:(c+1)*lweMessageBytes], 1)
+		for n := range v {
+			v[n] = compress(fieldAdd(v[n], decompress(mu[n], 1)), p.dv)
+		}
+		out = appendPoly(out, &v, p.dv)
+		mu.wipe()
+	}
+
+	for i := range r {
+		r[i].wipe()
+	}
+	return out
+}
+
+// decrypt recovers the message of a ciphertext (FIPS 203 Algorithm 15)
+func (p *mlweParams) decrypt(sk *mlweSecretKey, ciphertext []byte) []byte {
+	u := make([]lwePoly, p.k)
+	uBytes := lweN / 8 * p.du
+	for i := range u {
+		u[i], _ = decodePoly(ciphertext[i*uBytes:(i+1)*uBytes], p.du)
+		for n := range u[i] {
+			u[i][n] = decompress(u[i][n], p.du)
+		}
+		u[i].ntt()
+	}
+
+	vBytes := lweN / 8 * p.dv
+	ciphertext = ciphertext[p.k*uBytes:]
+	message := make([]byte, 0, p.messageSize())
+	for c := 0; c < p.columns; c++ {
+		w, _ := decodePoly(ciphertext[c*vBytes:(c+1)*vBytes], p.dv)
+		for n := range w {
+			w[n] = decompress(w[n], p.dv)
+		}
+		var su lwePoly
+		for i := range u {
+			su.mulAddNTT(&sk.s[c][i], &u[i])
+		}
+		su.invNTT()
+		w.sub(&su)
+		for n := range w {
+			w[n] = compress(w[n], 1)
+		}
+		message = appendPoly(message, &w, 1)
+		w.wipe()
+		su.wipe()
+	}
+	return message
+}
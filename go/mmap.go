@@ -0,0 +1,73 @@
+package topayz512
+
+import (
+	"math"
+	"os"
+	"sync"
+)
+
+// Memory-mapped file fragmentation
+//
+// FragmentFile maps a file into memory and fragments it in place, so a
+// multi-gigabyte file is split without first being read into a []byte. The
+// fragments' Data slices point into the mapping until they are serialized
+// or copied, and stay valid until the MappedFragments is closed. Platforms
+// without mmap read the file instead, with the same API.
+
+// MappedFragments is the result of FragmentFile. Its fragments reference
+// the mapped file and must be treated as read-only.
+type MappedFragments struct {
+	FragmentationResult
+	mapping []byte
+	once    sync.Once
+	err     error
+}
+
+// FragmentFile fragments the file at path as FragmentData would, taking the
+// same options, without copying it into memory. Fragment Data is backed by
+// a read-only mapping of the file: writing to it faults, and truncating the
+// file while it is mapped makes reading it fault. Serialize or copy the
+// fragments needed beyond Close, which releases the mapping.
+func FragmentFile(path string, opts ...FragmentOption) (*MappedFragments, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, ErrEmptyData
+	}
+	if uint64(size) > MaxFragmentedDataSize || uint64(size) > math.MaxInt {
+		return nil, &TooLargeError{Limit: "fragmented data size", Size: uint64(size), Max: MaxFragmentedDataSize}
+	}
+
+	mapping, err := mapFile(file, int(size))
+	if err != nil {
+		return nil, err
+	}
+	result, err := fragmentData(mapping, keyedCommitment{}, append(opts[:len(opts):len(opts)], withSharedData()))
+	if err != nil {
+		unmapFile(mapping)
+		return nil, err
+	}
+	return &MappedFragments{FragmentationResult: result, mapping: mapping}, nil
+}
+
+// Close releases the mapping, after which the fragments' Data must not be
+// used. Closing again does nothing.
+func (m *MappedFragments) Close() error {
+	m.once.Do(func() {
+		m.err = unmapFile(m.mapping)
+		m.mapping = nil
+		for i := range m.Fragments {
+			m.Fragments[i].Data = nil
+		}
+	})
+	return m.err
+}
@@ -0,0 +1,24 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package topayz512
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the first size bytes of file: mmap is unsupported on this
+// platform, so the file is held in memory instead
+func mapFile(file *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unmapFile releases a mapping from mapFile, which is left to the garbage
+// collector
+func unmapFile(mapping []byte) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package topayz512
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the first size bytes of file read-only
+func mapFile(file *os.File, size int) ([]byte, error) {
+	mapping, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: file.Name(), Err: err}
+	}
+	return mapping, nil
+}
+
+// unmapFile releases a mapping from mapFile
+func unmapFile(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
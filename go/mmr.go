@@ -0,0 +1,430 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+)
+
+// Merkle mountain range
+//
+// An MMR is an append-only list of perfect binary trees ("peaks") whose sizes
+// follow the binary representation of the leaf count. Nodes are stored in
+// post-order, so appending only ever adds nodes at the end of the store,
+// which is what makes the structure cheap to persist. The root hashes the
+// leaf count and all peaks from left to right; a proof carries the siblings
+// from a leaf to its peak plus every peak.
+
+// mmrRootDomain tags MMR roots; leaves and inner nodes are tagged 0 and 1
+const mmrRootDomain = 2
+
+// MMRStore persists MMR nodes by position. Nodes are only ever appended.
+type MMRStore interface {
+	// Append stores nodes after the existing ones
+	Append(nodes []Hash) error
+	// Node returns the node at position
+	Node(position uint64) (Hash, error)
+	// Size returns the number of stored nodes
+	Size() (uint64, error)
+}
+
+// MemoryMMRStore is an MMRStore keeping nodes in memory
+type MemoryMMRStore struct {
+	nodes []Hash
+	mutex sync.RWMutex
+}
+
+// Append stores nodes after the existing ones
+func (ms *MemoryMMRStore) Append(nodes []Hash) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.nodes = append(ms.nodes, nodes...)
+	return nil
+}
+
+// Node returns the node at position
+func (ms *MemoryMMRStore) Node(position uint64) (Hash, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	if position >= uint64(len(ms.nodes)) {
+		return Hash{}, ErrInvalidLeafIndex
+	}
+	return ms.nodes[position], nil
+}
+
+// Size returns the number of stored nodes
+func (ms *MemoryMMRStore) Size() (uint64, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	return uint64(len(ms.nodes)), nil
+}
+
+// mmrLeaf hashes leaf data
+func mmrLeaf(data []byte) Hash {
+	return HashMultiple([]byte{0}, data)
+}
+
+// mmrNode hashes two children into their parent
+func mmrNode(left, right Hash) Hash {
+	return HashMultiple([]byte{1}, left[:], right[:])
+}
+
+// mmrRoot bags the peaks of an MMR with leafCount leaves
+func mmrRoot(leafCount uint64, peaks []Hash) Hash {
+	hs := GetHashState()
+	defer PutHashState(hs)
+
+	var count [8]byte
+	binary.BigEndian.PutUint64(count[:], leafCount)
+	hs.Update([]byte{mmrRootDomain})
+	hs.Update(count[:])
+	for _, peak := range peaks {
+		hs.Update(peak[:])
+	}
+	return hs.Finalize()
+}
+
+// mmrPeak describes one peak: its height and the range of leaves and node
+// positions it covers
+type mmrPeak struct {
+	height    int
+	firstLeaf uint64
+	position  uint64
+}
+
+// mmrPeaks returns the peaks of an MMR with leafCount leaves, left to right
+func mmrPeaks(leafCount uint64) []mmrPeak {
+	var peaks []mmrPeak
+	var leaves, size uint64
+	for height := 63; height >= 0; height-- {
+		if leafCount&(1<<uint(height)) == 0 {
+			continue
+		}
+		size += 1<<uint(height+1) - 1
+		peaks = append(peaks, mmrPeak{height: height, firstLeaf: leaves, position: size - 1})
+		leaves += 1 << uint(height)
+	}
+	return peaks
+}
+
+// mmrLeafCount inverts the node count 2n - popcount(n) of an MMR with n
+// leaves, reporting false for a count no MMR has
+func mmrLeafCount(size uint64) (uint64, bool) {
+	var leaves uint64
+	for height := 63; height >= 0; height-- {
+		peakSize := uint64(1)<<uint(height+1) - 1
+		if peakSize != 0 && size >= peakSize {
+			size -= peakSize
+			leaves += 1 << uint(height)
+		}
+	}
+	return leaves, size == 0
+}
+
+// MMRProof proves that a leaf is in an MMR with a given root
+type MMRProof struct {
+	LeafIndex uint64 `json:"leaf_index"`
+	LeafCount uint64 `json:"leaf_count"`
+	Siblings  []Hash `json:"siblings"`
+	Peaks     []Hash `json:"peaks"`
+}
+
+// locate returns the peak holding the proof's leaf and its index among the peaks
+func (mp *MMRProof) locate() (mmrPeak, int, bool) {
+	if mp.LeafIndex >= mp.LeafCount {
+		return mmrPeak{}, 0, false
+	}
+	peaks := mmrPeaks(mp.LeafCount)
+	for i, peak := range peaks {
+		if mp.LeafIndex < peak.firstLeaf+1<<uint(peak.height) {
+			return peak, i, len(mp.Siblings) == peak.height && len(mp.Peaks) == len(peaks)
+		}
+	}
+	return mmrPeak{}, 0, false
+}
+
+// Bytes serializes the proof as LeafIndex + LeafCount + Siblings + Peaks. The
+// number of siblings and peaks follows from the index and count.
+func (mp *MMRProof) Bytes() []byte {
+	data := make([]byte, 16, 16+(len(mp.Siblings)+len(mp.Peaks))*HashSize)
+	binary.BigEndian.PutUint64(data, mp.LeafIndex)
+	binary.BigEndian.PutUint64(data[8:], mp.LeafCount)
+	for _, sibling := range mp.Siblings {
+		data = append(data, sibling[:]...)
+	}
+	for _, peak := range mp.Peaks {
+		data = append(data, peak[:]...)
+	}
+	return data
+}
+
+// MMRProofFromBytes deserializes a proof
+func MMRProofFromBytes(data []byte) (MMRProof, error) {
+	if len(data) < 16 {
+		return MMRProof{}, ErrInvalidProof
+	}
+	proof := MMRProof{
+		LeafIndex: binary.BigEndian.Uint64(data),
+		LeafCount: binary.BigEndian.Uint64(data[8:]),
+	}
+	if proof.LeafIndex >= proof.LeafCount {
+		return MMRProof{}, ErrInvalidProof
+	}
+
+	peaks := mmrPeaks(proof.LeafCount)
+	var height int
+	for _, peak := range peaks {
+		if proof.LeafIndex < peak.firstLeaf+1<<uint(peak.height) {
+			height = peak.height
+			break
+		}
+	}
+	if uint64(len(data)-16) != uint64(height+len(peaks))*uint64(HashSize) {
+		return MMRProof{}, ErrInvalidProof
+	}
+
+	hashes := make([]Hash, height+len(peaks))
+	for i := range hashes {
+		copy(hashes[i][:], data[16+i*HashSize:])
+	}
+	proof.Siblings, proof.Peaks = hashes[:height], hashes[height:]
+	return proof, nil
+}
+
+// VerifyMMRProof reports whether proof shows that data is the leaf at
+// proof.LeafIndex of the MMR with the given root
+func VerifyMMRProof(root Hash, data []byte, proof *MMRProof) bool {
+	if proof == nil {
+		return false
+	}
+	peak, peakIndex, ok := proof.locate()
+	if !ok {
+		return false
+	}
+
+	node := mmrLeaf(data)
+	local := proof.LeafIndex - peak.firstLeaf
+	for level, sibling := range proof.Siblings {
+		if local>>uint(level)&1 == 0 {
+			node = mmrNode(node, sibling)
+		} else {
+			node = mmrNode(sibling, node)
+		}
+	}
+	if !ConstantTimeEqual(node[:], proof.Peaks[peakIndex][:]) {
+		return false
+	}
+	expected := mmrRoot(proof.LeafCount, proof.Peaks)
+	return ConstantTimeEqual(expected[:], root[:])
+}
+
+// MMR is a Merkle mountain range over an MMRStore. It keeps the current
+// peaks in memory and reads other nodes from the store only to build proofs.
+// It is safe for concurrent use.
+type MMR struct {
+	store     MMRStore
+	leafCount uint64
+	peaks     []Hash
+	mutex     sync.RWMutex
+}
+
+// NewMMR opens an MMR over store, resuming from the nodes it already holds;
+// a nil store keeps nodes in memory. It returns ErrInvalidMMR if the store's
+// size isn't the size of any MMR.
+func NewMMR(store MMRStore) (*MMR, error) {
+	if store == nil {
+		store = &MemoryMMRStore{}
+	}
+	size, err := store.Size()
+	if err != nil {
+		return nil, err
+	}
+	leafCount, ok := mmrLeafCount(size)
+	if !ok {
+		return nil, ErrInvalidMMR
+	}
+
+	mmr := &MMR{store: store, leafCount: leafCount}
+	for _, peak := range mmrPeaks(leafCount) {
+		node, err := store.Node(peak.position)
+		if err != nil {
+			return nil, err
+		}
+		mmr.peaks = append(mmr.peaks, node)
+	}
+	return mmr, nil
+}
+
+// Append adds a leaf and returns its index
+func (mmr *MMR) Append(data []byte) (uint64, error) {
+	mmr.mutex.Lock()
+	defer mmr.mutex.Unlock()
+
+	peaks, nodes := mmrAppend(mmr.leafCount, mmr.peaks, mmrLeaf(data))
+	if err := mmr.store.Append(nodes); err != nil {
+		return 0, err
+	}
+	mmr.peaks = peaks
+	mmr.leafCount++
+	return mmr.leafCount - 1, nil
+}
+
+// mmrAppend adds a leaf hash to an MMR with leafCount leaves and the given
+// peaks, returning the new peaks and the nodes to store. peaks may be reused.
+func mmrAppend(leafCount uint64, peaks []Hash, leaf Hash) ([]Hash, []Hash) {
+	node := leaf
+	nodes := []Hash{node}
+
+	// Each trailing one bit of the old leaf count is a peak of the same
+	// height as the new subtree, which merges with it
+	for merges := bits.TrailingZeros64(leafCount + 1); merges > 0; merges-- {
+		node = mmrNode(peaks[len(peaks)-1], node)
+		peaks = peaks[:len(peaks)-1]
+		nodes = append(nodes, node)
+	}
+	return append(peaks, node), nodes
+}
+
+// LeafCount returns the number of leaves
+func (mmr *MMR) LeafCount() uint64 {
+	mmr.mutex.RLock()
+	defer mmr.mutex.RUnlock()
+	return mmr.leafCount
+}
+
+// Root returns the root committing to every leaf in order
+func (mmr *MMR) Root() Hash {
+	mmr.mutex.RLock()
+	defer mmr.mutex.RUnlock()
+	return mmrRoot(mmr.leafCount, mmr.peaks)
+}
+
+// Prove returns a proof for the leaf at index against the current root
+func (mmr *MMR) Prove(index uint64) (MMRProof, error) {
+	mmr.mutex.RLock()
+	defer mmr.mutex.RUnlock()
+
+	if index >= mmr.leafCount {
+		return MMRProof{}, ErrInvalidLeafIndex
+	}
+	proof := MMRProof{LeafIndex: index, LeafCount: mmr.leafCount, Peaks: append([]Hash(nil), mmr.peaks...)}
+	peak, _, _ := proof.locate()
+	siblings, err := mmr.path(peak, index-peak.firstLeaf, 0)
+	if err != nil {
+		return MMRProof{}, err
+	}
+	proof.Siblings = siblings
+	return proof, nil
+}
+
+// path returns the siblings from a node up to the peak holding it, bottom
+// up. The node is the local-th subtree of the given height within the peak.
+func (mmr *MMR) path(peak mmrPeak, local uint64, height int) ([]Hash, error) {
+	// Walk down from the peak: a node at height h has its right child just
+	// before it and its left child 2^h positions before it
+	position := peak.position
+	siblings := make([]Hash, peak.height-height)
+	for h := peak.height; h > height; h-- {
+		left, right := position-1<<uint(h), position-1
+		child, sibling := left, right
+		if local>>uint(h-1-height)&1 == 1 {
+			child, sibling = right, left
+		}
+		node, err := mmr.store.Node(sibling)
+		if err != nil {
+			return nil, err
+		}
+		siblings[h-1-height] = node
+		position = child
+	}
+	return siblings, nil
+}
+
+// MMRConsistencyProof proves that an MMR with OldLeafCount leaves is a prefix
+// of one with NewLeafCount leaves: every old peak is a node of a new peak
+type MMRConsistencyProof struct {
+	OldLeafCount uint64 `json:"old_leaf_count"`
+	NewLeafCount uint64 `json:"new_leaf_count"`
+	OldPeaks     []Hash `json:"old_peaks"`
+	// Paths holds, for each old peak, the siblings up to its new peak
+	Paths    [][]Hash `json:"paths"`
+	NewPeaks []Hash   `json:"new_peaks"`
+}
+
+// ProveConsistency returns a proof that the MMR as it was with oldLeafCount
+// leaves is a prefix of the current one
+func (mmr *MMR) ProveConsistency(oldLeafCount uint64) (MMRConsistencyProof, error) {
+	mmr.mutex.RLock()
+	defer mmr.mutex.RUnlock()
+
+	if oldLeafCount > mmr.leafCount {
+		return MMRConsistencyProof{}, ErrInvalidLeafIndex
+	}
+	proof := MMRConsistencyProof{
+		OldLeafCount: oldLeafCount,
+		NewLeafCount: mmr.leafCount,
+		NewPeaks:     append([]Hash(nil), mmr.peaks...),
+	}
+	newPeaks := mmrPeaks(mmr.leafCount)
+	for _, old := range mmrPeaks(oldLeafCount) {
+		// Nodes are stored in post-order, so an old peak keeps its position
+		node, err := mmr.store.Node(old.position)
+		if err != nil {
+			return MMRConsistencyProof{}, err
+		}
+		peak := newPeaks[mmrPeakIndex(newPeaks, old.firstLeaf)]
+		path, err := mmr.path(peak, (old.firstLeaf-peak.firstLeaf)>>uint(old.height), old.height)
+		if err != nil {
+			return MMRConsistencyProof{}, err
+		}
+		proof.OldPeaks = append(proof.OldPeaks, node)
+		proof.Paths = append(proof.Paths, path)
+	}
+	return proof, nil
+}
+
+// mmrPeakIndex returns the index of the peak holding a leaf
+func mmrPeakIndex(peaks []mmrPeak, leaf uint64) int {
+	for i, peak := range peaks {
+		if leaf < peak.firstLeaf+1<<uint(peak.height) {
+			return i
+		}
+	}
+	return len(peaks)
+}
+
+// VerifyMMRConsistency reports whether proof shows that the MMR with oldRoot
+// is a prefix of the MMR with newRoot
+func VerifyMMRConsistency(oldRoot, newRoot Hash, proof *MMRConsistencyProof) bool {
+	if proof == nil || proof.OldLeafCount > proof.NewLeafCount {
+		return false
+	}
+	oldPeaks, newPeaks := mmrPeaks(proof.OldLeafCount), mmrPeaks(proof.NewLeafCount)
+	if len(proof.OldPeaks) != len(oldPeaks) || len(proof.Paths) != len(oldPeaks) || len(proof.NewPeaks) != len(newPeaks) {
+		return false
+	}
+
+	for i, old := range oldPeaks {
+		j := mmrPeakIndex(newPeaks, old.firstLeaf)
+		peak := newPeaks[j]
+		if len(proof.Paths[i]) != peak.height-old.height {
+			return false
+		}
+		node := proof.OldPeaks[i]
+		local := (old.firstLeaf - peak.firstLeaf) >> uint(old.height)
+		for level, sibling := range proof.Paths[i] {
+			if local>>uint(level)&1 == 0 {
+				node = mmrNode(node, sibling)
+			} else {
+				node = mmrNode(sibling, node)
+			}
+		}
+		if !ConstantTimeEqual(node[:], proof.NewPeaks[j][:]) {
+			return false
+		}
+	}
+
+	expectedOld := mmrRoot(proof.OldLeafCount, proof.OldPeaks)
+	expectedNew := mmrRoot(proof.NewLeafCount, proof.NewPeaks)
+	return ConstantTimeEqual(expectedOld[:], oldRoot[:]) && ConstantTimeEqual(expectedNew[:], newRoot[:])
+}
@@ -0,0 +1,240 @@
+// Package mnemonic implements BIP-39 mnemonic phrases: human-readable
+// backups of the seed a wallet derives its TOPAY-Z512 keys from.
+//
+// A phrase of 12 to 24 words encodes 128 to 256 bits of entropy plus a
+// checksum, and Seed stretches it with an optional passphrase into the
+// 64-byte BIP-39 seed, which topayz512.GenerateKeyPairFromSeed accepts. The
+// English, Czech and Italian word lists are the ones published with BIP-39,
+// so phrases are interchangeable with other BIP-39 wallets.
+//
+// BIP-39 normalizes phrases and passphrases to Unicode NFKD before hashing.
+// The bundled word lists are ASCII, which NFKD leaves unchanged; a caller
+// using non-ASCII passphrases or word lists must normalize them first.
+package mnemonic
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Phrase lengths
+const (
+	// MinWords is the shortest phrase, encoding 128 bits of entropy
+	MinWords = 12
+
+	// MaxWords is the longest phrase, encoding 256 bits of entropy
+	MaxWords = 24
+
+	// SeedSize is the size of the seed a phrase derives
+	SeedSize = 64
+)
+
+// Seed derivation constants from BIP-39
+const (
+	// seedIterations is the PBKDF2 iteration count
+	seedIterations = 2048
+
+	// seedSaltPrefix starts the PBKDF2 salt, followed by the passphrase
+	seedSaltPrefix = "mnemonic"
+)
+
+var (
+	// ErrInvalidWordCount indicates a phrase that isn't 12, 15, 18, 21 or 24 words
+	ErrInvalidWordCount = errors.New("invalid mnemonic word count")
+
+	// ErrInvalidEntropySize indicates entropy that isn't 16 to 32 bytes in steps of 4
+	ErrInvalidEntropySize = errors.New("invalid entropy size")
+
+	// ErrUnknownWord indicates a word missing from the word list
+	ErrUnknownWord = errors.New("word not in word list")
+
+	// ErrInvalidChecksum indicates a phrase whose checksum bits don't match its entropy
+	ErrInvalidChecksum = errors.New("invalid mnemonic checksum")
+
+	// ErrUnknownWordlist indicates a phrase that no known word list decodes
+	ErrUnknownWordlist = errors.New("no word list matches mnemonic")
+
+	// ErrInvalidWordlist indicates a word list without exactly WordlistSize distinct words
+	ErrInvalidWordlist = errors.New("invalid word list")
+)
+
+// Generate returns a new phrase of wordCount words, 12 to 24 in steps of
+// three, drawn from wordlist; a nil wordlist uses English
+func Generate(wordCount int, wordlist *Wordlist) (string, error) {
+	if wordCount < MinWords || wordCount > MaxWords || wordCount%3 != 0 {
+		return "", ErrInvalidWordCount
+	}
+	entropy, err := topayz512.SecureRandom(wordCount / 3 * 4)
+	if err != nil {
+		return "", err
+	}
+	defer topayz512.SecureZero(entropy)
+	return FromEntropy(entropy, wordlist)
+}
+
+// FromEntropy encodes entropy, 16 to 32 bytes in steps of four, as a phrase
+// from wordlist; a nil wordlist uses English
+func FromEntropy(entropy []byte, wordlist *Wordlist) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", ErrInvalidEntropySize
+	}
+	if wordlist == nil {
+		wordlist = English
+	}
+
+	// The checksum is the first len(entropy)/4 bits of SHA-256(entropy),
+	// appended to the entropy before splitting it into 11-bit word indices
+	checksum := sha256.Sum256(entropy)
+	data := append(append(make([]byte, 0, len(entropy)+1), entropy...), checksum[0])
+	defer topayz512.SecureZero(data)
+
+	wordCount := len(entropy) * 8 / 32 * 3
+	words := make([]string, wordCount)
+	for i := range words {
+		words[i] = wordlist.words[readBits(data, i*11)]
+	}
+	return strings.Join(words, wordlist.separator), nil
+}
+
+// ToEntropy decodes a phrase from wordlist back to its entropy, verifying
+// the checksum; a nil wordlist uses English. Words may be separated by any
+// whitespace.
+func ToEntropy(mnemonic string, wordlist *Wordlist) ([]byte, error) {
+	if wordlist == nil {
+		wordlist = English
+	}
+	words := strings.Fields(mnemonic)
+	if len(words) < MinWords || len(words) > MaxWords || len(words)%3 != 0 {
+		return nil, ErrInvalidWordCount
+	}
+
+	entropySize := len(words) / 3 * 4
+	data := make([]byte, entropySize+1)
+	for i, word := range words {
+		index, ok := wordlist.index[word]
+		if !ok {
+			topayz512.SecureZero(data)
+			return nil, fmt.Errorf("%w: word %d", ErrUnknownWord, i+1)
+		}
+		writeBits(data, i*11, index)
+	}
+
+	checksum := sha256.Sum256(data[:entropySize])
+	checksumBits := uint(entropySize / 4)
+	mask := byte(0xff) << (8 - checksumBits)
+	if data[entropySize]&mask != checksum[0]&mask {
+		topayz512.SecureZero(data)
+		return nil, ErrInvalidChecksum
+	}
+	return data[:entropySize:entropySize], nil
+}
+
+// Validate checks that a phrase decodes with wordlist and its checksum
+// matches; a nil wordlist uses English
+func Validate(mnemonic string, wordlist *Wordlist) error {
+	entropy, err := ToEntropy(mnemonic, wordlist)
+	topayz512.SecureZero(entropy)
+	return err
+}
+
+// DetectWordlist returns the first of Wordlists that decodes the phrase with
+// a valid checksum, for recovering a phrase whose language isn't recorded
+func DetectWordlist(mnemonic string) (*Wordlist, error) {
+	for _, wordlist := range Wordlists() {
+		if Validate(mnemonic, wordlist) == nil {
+			return wordlist, nil
+		}
+	}
+	return nil, ErrUnknownWordlist
+}
+
+// Seed validates a phrase from wordlist and derives its BIP-39 seed with
+// passphrase, which may be empty. A nil wordlist uses English. The phrase is
+// hashed with single separators between words, so extra whitespace from
+// user input derives the same seed.
+func Seed(mnemonic, passphrase string, wordlist *Wordlist) ([]byte, error) {
+	if wordlist == nil {
+		wordlist = English
+	}
+	if err := Validate(mnemonic, wordlist); err != nil {
+		return nil, err
+	}
+
+	sentence := []byte(strings.Join(strings.Fields(mnemonic), wordlist.separator))
+	salt := []byte(seedSaltPrefix + passphrase)
+	defer topayz512.SecureZero(sentence)
+	defer topayz512.SecureZero(salt)
+
+	seed := make([]byte, SeedSize)
+	pbkdf2SHA512(seed, sentence, salt, seedIterations)
+	return seed, nil
+}
+
+// KeyPair derives the key pair of a phrase: its seed passed to
+// topayz512.GenerateKeyPairFromSeed
+func KeyPair(mnemonic, passphrase string, wordlist *Wordlist) (topayz512.PrivateKey, topayz512.PublicKey, error) {
+	seed, err := Seed(mnemonic, passphrase, wordlist)
+	if err != nil {
+		return topayz512.PrivateKey{}, topayz512.PublicKey{}, err
+	}
+	defer topayz512.SecureZero(seed)
+	return topayz512.GenerateKeyPairFromSeed(seed)
+}
+
+// readBits returns the 11-bit big-endian value starting at bit offset
+func readBits(data []byte, offset int) int {
+	var window [4]byte
+	copy(window[:], data[offset/8:])
+	value := binary.BigEndian.Uint32(window[:])
+	topayz512.SecureZero(window[:])
+	return int(value >> (32 - 11 - uint(offset%8)) & 0x7ff)
+}
+
+// writeBits stores an 11-bit value at bit offset
+func writeBits(data []byte, offset, value int) {
+	for bit := 0; bit < 11; bit++ {
+		if value&(1<<(10-bit)) != 0 {
+			position := offset + bit
+			data[position/8] |= 0x80 >> (position % 8)
+		}
+	}
+}
+
+// pbkdf2SHA512 fills out with PBKDF2-HMAC-SHA512 of password and salt
+func pbkdf2SHA512(out, password, salt []byte, iterations int) {
+	prf := hmac.New(sha512.New, password)
+	block := make([]byte, 0, sha512.Size)
+	u := make([]byte, sha512.Size)
+	var counter [4]byte
+
+	for blockIndex := uint32(1); len(out) > 0; blockIndex++ {
+		binary.BigEndian.PutUint32(counter[:], blockIndex)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		block = prf.Sum(block[:0])
+		copy(u, block)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range block {
+				block[j] ^= u[j]
+			}
+		}
+
+		n := copy(out, block)
+		out = out[n:]
+	}
+
+	topayz512.SecureZero(block)
+	topayz512.SecureZero(u)
+}
@@ -0,0 +1,163 @@
+package mnemonic
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Test the BIP-39 reference vectors, passphrase "TREZOR"
+func TestVectors(t *testing.T) {
+	vectors := []struct {
+		entropy, mnemonic, seed string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"808080808080808080808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter always",
+			"107d7c02a5aa6f38c58083ff74f04c607c2d2c0ecc55501dadd72d025b751bc27fe913ffb796f841c49b1d33b610cf0e91d3aa239027f5e99fe4ce9e5088cd65",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	}
+
+	for _, v := range vectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+		mnemonic, err := FromEntropy(entropy, nil)
+		if err != nil || mnemonic != v.mnemonic {
+			t.Errorf("FromEntropy(%s) = %q, %v", v.entropy, mnemonic, err)
+		}
+		decoded, err := ToEntropy(v.mnemonic, English)
+		if err != nil || hex.EncodeToString(decoded) != v.entropy {
+			t.Errorf("ToEntropy(%q) = %x, %v", v.mnemonic, decoded, err)
+		}
+		seed, err := Seed(v.mnemonic, "TREZOR", nil)
+		if err != nil || hex.EncodeToString(seed) != v.seed {
+			t.Errorf("Seed(%q) = %x, %v", v.mnemonic, seed, err)
+		}
+	}
+}
+
+// Test generating, validating and recovering phrases
+func TestGenerate(t *testing.T) {
+	for _, count := range []int{12, 15, 18, 21, 24} {
+		for _, wordlist := range Wordlists() {
+			mnemonic, err := Generate(count, wordlist)
+			if err != nil {
+				t.Fatalf("Generate(%d, %s) failed: %v", count, wordlist.Name(), err)
+			}
+			if len(strings.Fields(mnemonic)) != count {
+				t.Errorf("Expected %d words, got %q", count, mnemonic)
+			}
+			if err := Validate(mnemonic, wordlist); err != nil {
+				t.Errorf("Validate(%q) failed: %v", mnemonic, err)
+			}
+		}
+	}
+	for _, count := range []int{0, 11, 13, 27} {
+		if _, err := Generate(count, nil); err != ErrInvalidWordCount {
+			t.Errorf("Generate(%d) = %v", count, err)
+		}
+	}
+
+	mnemonic, _ := Generate(24, Italian)
+	detected, err := DetectWordlist(mnemonic)
+	if err != nil || detected.Name() != "italian" {
+		t.Errorf("DetectWordlist = %v, %v", detected, err)
+	}
+
+	// Extra whitespace in user input derives the same keys
+	private1, public1, err := KeyPair(mnemonic, "passphrase", Italian)
+	if err != nil {
+		t.Fatalf("KeyPair failed: %v", err)
+	}
+	private2, public2, _ := KeyPair("  "+strings.ReplaceAll(mnemonic, " ", "\n\t")+" ", "passphrase", Italian)
+	if private1 != private2 || public1 != public2 {
+		t.Error("Whitespace changed the derived keys")
+	}
+	seed, _ := Seed(mnemonic, "passphrase", Italian)
+	private3, _, _ := topayz512.GenerateKeyPairFromSeed(seed)
+	if private3 != private1 {
+		t.Error("KeyPair differs from GenerateKeyPairFromSeed")
+	}
+	_, public4, _ := KeyPair(mnemonic, "other", Italian)
+	if public4 == public1 {
+		t.Error("Passphrase didn't change the keys")
+	}
+}
+
+// Test rejecting invalid phrases
+func TestInvalidMnemonics(t *testing.T) {
+	valid := "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	if err := Validate(strings.Replace(valid, "yellow", "year", 1), nil); err != ErrInvalidChecksum {
+		t.Errorf("Expected ErrInvalidChecksum, got %v", err)
+	}
+	if err := Validate(strings.Replace(valid, "legal", "legall", 1), nil); !errors.Is(err, ErrUnknownWord) {
+		t.Errorf("Expected ErrUnknownWord, got %v", err)
+	}
+	if err := Validate(valid+" zoo", nil); err != ErrInvalidWordCount {
+		t.Errorf("Expected ErrInvalidWordCount, got %v", err)
+	}
+	if _, err := Seed(strings.Replace(valid, "yellow", "year", 1), "", nil); err != ErrInvalidChecksum {
+		t.Errorf("Seed accepted a bad checksum: %v", err)
+	}
+	if _, err := DetectWordlist("not a real mnemonic phrase"); err != ErrUnknownWordlist {
+		t.Errorf("Expected ErrUnknownWordlist, got %v", err)
+	}
+	if _, err := FromEntropy(make([]byte, 20+1), nil); err != ErrInvalidEntropySize {
+		t.Errorf("Expected ErrInvalidEntropySize, got %v", err)
+	}
+}
+
+// Test word list construction and lookups
+func TestWordlist(t *testing.T) {
+	for _, wordlist := range Wordlists() {
+		for i := 0; i < WordlistSize; i++ {
+			word, ok := wordlist.Word(i)
+			if index, found := wordlist.Index(word); !ok || !found || index != i {
+				t.Fatalf("%s: word %d round trip failed", wordlist.Name(), i)
+			}
+		}
+	}
+	if words := English.Complete("aban"); len(words) != 1 || words[0] != "abandon" {
+		t.Errorf("Complete(aban) = %v", words)
+	}
+	if _, ok := English.Word(WordlistSize); ok {
+		t.Error("Word accepted an out-of-range index")
+	}
+
+	words := make([]string, WordlistSize)
+	for i := range words {
+		words[i], _ = English.Word(i)
+	}
+	custom, err := NewWordlist("custom", words, "　")
+	if err != nil {
+		t.Fatalf("NewWordlist failed: %v", err)
+	}
+	mnemonic, _ := FromEntropy(make([]byte, 16), custom)
+	if !strings.Contains(mnemonic, "　") || Validate(mnemonic, custom) != nil {
+		t.Errorf("Custom separator not used: %q", mnemonic)
+	}
+	words[1] = words[0]
+	if _, err := NewWordlist("duplicate", words, ""); err != ErrInvalidWordlist {
+		t.Errorf("Expected ErrInvalidWordlist, got %v", err)
+	}
+	if _, err := NewWordlist("short", words[:100], ""); err != ErrInvalidWordlist {
+		t.Errorf("Expected ErrInvalidWordlist, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package mnemonic
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// WordlistSize is the number of words in every BIP-39 word list
+const WordlistSize = 2048
+
+// The BIP-39 word lists, byte for byte as published
+var (
+	//go:embed wordlists/english.txt
+	englishWords string
+
+	//go:embed wordlists/czech.txt
+	czechWords string
+
+	//go:embed wordlists/italian.txt
+	italianWords string
+)
+
+// Bundled word lists
+var (
+	// English is the BIP-39 English word list, the default
+	English = mustWordlist("english", englishWords)
+
+	// Czech is the BIP-39 Czech word list
+	Czech = mustWordlist("czech", czechWords)
+
+	// Italian is the BIP-39 Italian word list
+	Italian = mustWordlist("italian", italianWords)
+)
+
+// Wordlist maps 11-bit values to words and back
+type Wordlist struct {
+	name      string
+	words     []string
+	index     map[string]int
+	separator string
+}
+
+// NewWordlist creates a word list from WordlistSize distinct words in BIP-39
+// order. separator joins the words of a phrase; empty means a space.
+func NewWordlist(name string, words []string, separator string) (*Wordlist, error) {
+	if len(words) != WordlistSize {
+		return nil, ErrInvalidWordlist
+	}
+	if separator == "" {
+		separator = " "
+	}
+	wordlist := &Wordlist{
+		name:      name,
+		words:     append([]string(nil), words...),
+		index:     make(map[string]int, WordlistSize),
+		separator: separator,
+	}
+	for i, word := range wordlist.words {
+		if word == "" || strings.ContainsAny(word, " \t\r\n") {
+			return nil, ErrInvalidWordlist
+		}
+		if _, duplicate := wordlist.index[word]; duplicate {
+			return nil, ErrInvalidWordlist
+		}
+		wordlist.index[word] = i
+	}
+	return wordlist, nil
+}
+
+// mustWordlist parses a bundled newline-separated word list
+func mustWordlist(name, text string) *Wordlist {
+	wordlist, err := NewWordlist(name, strings.Split(strings.TrimSpace(text), "\n"), "")
+	if err != nil {
+		panic("mnemonic: bundled word list " + name + " is invalid")
+	}
+	return wordlist
+}
+
+// Wordlists returns the bundled word lists, English first
+func Wordlists() []*Wordlist {
+	return []*Wordlist{English, Czech, Italian}
+}
+
+// Name returns the name of the word list
+func (w *Wordlist) Name() string {
+	return w.name
+}
+
+// Word returns the word for an 11-bit value
+func (w *Wordlist) Word(index int) (string, bool) {
+	if index < 0 || index >= len(w.words) {
+		return "", false
+	}
+	return w.words[index], true
+}
+
+// Index returns the 11-bit value of a word
+func (w *Wordlist) Index(word string) (int, bool) {
+	index, ok := w.index[word]
+	return index, ok
+}
+
+// Complete returns the words starting with prefix, for input completion.
+// BIP-39 lists are designed so four letters identify a word.
+func (w *Wordlist) Complete(prefix string) []string {
+	var matches []string
+	for _, word := range w.words {
+		if strings.HasPrefix(word, prefix) {
+			matches = append(matches, word)
+		}
+	}
+	return matches
+}
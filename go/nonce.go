@@ -0,0 +1,266 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/params"
+)
+
+// Deterministic nonce derivation with misuse detection
+
+// NonceSize is the size of a derived AEAD nonce in bytes
+const NonceSize = int(params.NonceSize)
+
+// nonceCounterSize is the number of nonce bytes holding the counter
+const nonceCounterSize = 8
+
+// DefaultNonceReservation is how many counters a NonceSequence persists ahead
+const DefaultNonceReservation = 1024
+
+// Nonce represents a 96-bit AEAD nonce
+type Nonce [NonceSize]byte
+
+// String returns the hex representation of a Nonce
+func (n Nonce) String() string {
+	return FastHexEncode(n[:])
+}
+
+// Bytes returns a newly allocated copy of a Nonce.
+//
+// Deprecated: use AppendBytes or CopyTo.
+func (n Nonce) Bytes() []byte {
+	return n[:]
+}
+
+// AppendBytes appends the bytes of a Nonce to dst and returns the extended slice
+func (n Nonce) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, n[:])
+}
+
+// CopyTo copies a Nonce into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than NonceSize
+func (n Nonce) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, n[:])
+}
+
+// DeriveNonce derives the nonce for counter under key and context. The nonce is a
+// key- and context-bound prefix followed by the big-endian counter, so distinct
+// counters always yield distinct nonces for the same key and context.
+func DeriveNonce(key []byte, counter uint64, context []byte) Nonce {
+	var lengths [16]byte
+	binary.BigEndian.PutUint64(lengths[:8], uint64(len(key)))
+	binary.BigEndian.PutUint64(lengths[8:], uint64(len(context)))
+
+	prefix := HashMultiple([]byte("TOPAY-Z512-NONCE"), lengths[:], key, context)
+
+	var nonce Nonce
+	copy(nonce[:NonceSize-nonceCounterSize], prefix[:])
+	binary.BigEndian.PutUint64(nonce[NonceSize-nonceCounterSize:], counter)
+	return nonce
+}
+
+// CounterStore persists the nonce counter high-water mark across restarts
+type CounterStore interface {
+	// Load returns the persisted counter, or ErrStateNotFound if none was
+	// ever stored, so a lost store can be told from a new one
+	Load() (uint64, error)
+	// Store durably records the counter before any nonce below it is used
+	Store(counter uint64) error
+}
+
+// MemoryCounterStore is a CounterStore that keeps the counter in memory
+type MemoryCounterStore struct {
+	counter uint64
+	stored  bool
+	mutex   sync.Mutex
+}
+
+// Load returns the stored counter, or ErrStateNotFound before the first Store
+func (mcs *MemoryCounterStore) Load() (uint64, error) {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+	if !mcs.stored {
+		return 0, ErrStateNotFound
+	}
+	return mcs.counter, nil
+}
+
+// Store records the counter
+func (mcs *MemoryCounterStore) Store(counter uint64) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+	mcs.counter, mcs.stored = counter, true
+	return nil
+}
+
+// FileCounterStore is a CounterStore backed by a file that is replaced atomically
+type FileCounterStore struct {
+	path string
+}
+
+// NewFileCounterStore creates a counter store persisting to path
+func NewFileCounterStore(path string) *FileCounterStore {
+	return &FileCounterStore{path: path}
+}
+
+// Load reads the counter from the file, returning ErrStateNotFound if it
+// does not exist
+func (fcs *FileCounterStore) Load() (uint64, error) {
+	data, err := os.ReadFile(fcs.path)
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("%w: %s", ErrStateNotFound, fcs.path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// Store writes the counter to a temporary file and renames it into place
+func (fcs *FileCounterStore) Store(counter uint64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fcs.path), filepath.Base(fcs.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatUint(counter, 10) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fcs.path)
+}
+
+// NonceSequenceOptions configures a NonceSequence
+type NonceSequenceOptions struct {
+	// Store persists the counter; nil keeps it in memory only
+	Store CounterStore
+	// Reservation is how many counters are persisted ahead of use, trading
+	// skipped counters after a crash for fewer writes
+	Reservation uint64
+}
+
+// NonceSequence hands out unique nonces for one key and context. It refuses to
+// reuse a counter and errors instead of wrapping around when exhausted.
+type NonceSequence struct {
+	key      []byte
+	context  []byte
+	next     uint64
+	reserved uint64
+	opts     NonceSequenceOptions
+	mutex    sync.Mutex
+}
+
+// NewNonceSequence creates a nonce sequence resuming from the persisted counter
+func NewNonceSequence(key, context []byte, opts *NonceSequenceOptions) (*NonceSequence, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyData
+	}
+
+	var options NonceSequenceOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.Store == nil {
+		options.Store = &MemoryCounterStore{}
+	}
+	if options.Reservation == 0 {
+		options.Reservation = DefaultNonceReservation
+	}
+
+	// Counters at or above the persisted mark were never handed out; a
+	// sequence with no persisted mark starts at zero
+	next, err := options.Store.Load()
+	if errors.Is(err, ErrStateNotFound) {
+		next, err = 0, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ns := &NonceSequence{
+		key:      append([]byte(nil), key...),
+		context:  append([]byte(nil), context...),
+		next:     next,
+		reserved: next,
+		opts:     options,
+	}
+	return ns, nil
+}
+
+// Next returns the nonce for the next unused counter
+func (ns *NonceSequence) Next() (Nonce, uint64, error) {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	counter := ns.next
+	if err := ns.claim(counter); err != nil {
+		return Nonce{}, 0, err
+	}
+	return DeriveNonce(ns.key, counter, ns.context), counter, nil
+}
+
+// Use returns the nonce for an explicit counter, which must be greater than
+// every counter used before. Lower or repeated counters return ErrNonceReuse.
+func (ns *NonceSequence) Use(counter uint64) (Nonce, error) {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	if counter < ns.next {
+		return Nonce{}, ErrNonceReuse
+	}
+	if err := ns.claim(counter); err != nil {
+		return Nonce{}, err
+	}
+	return DeriveNonce(ns.key, counter, ns.context), nil
+}
+
+// Remaining returns how many nonces can still be issued
+func (ns *NonceSequence) Remaining() uint64 {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	if ns.next == math.MaxUint64 {
+		return 0
+	}
+	return math.MaxUint64 - ns.next
+}
+
+// claim marks counter as used, persisting a new reservation first if needed
+func (ns *NonceSequence) claim(counter uint64) error {
+	// The maximum counter is never issued so that next never wraps
+	if counter == math.MaxUint64 {
+		return ErrNonceExhausted
+	}
+
+	if counter+1 > ns.reserved {
+		reserved := counter + 1
+		if math.MaxUint64-reserved >= ns.opts.Reservation {
+			reserved += ns.opts.Reservation
+		} else {
+			reserved = math.MaxUint64
+		}
+		if err := ns.opts.Store.Store(reserved); err != nil {
+			return err
+		}
+		ns.reserved = reserved
+	}
+
+	ns.next = counter + 1
+	return nil
+}
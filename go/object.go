@@ -0,0 +1,183 @@
+package topayz512
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Git-style content-addressed object hashing
+
+// Object types using git's names
+const (
+	ObjectBlob   = "blob"
+	ObjectTree   = "tree"
+	ObjectCommit = "commit"
+	ObjectTag    = "tag"
+)
+
+// Tree entry modes using git's values
+const (
+	ModeFile       uint32 = 0o100644
+	ModeExecutable uint32 = 0o100755
+	ModeSymlink    uint32 = 0o120000
+	ModeDirectory  uint32 = 0o40000
+	ModeSubmodule  uint32 = 0o160000
+)
+
+// ObjectHeaderFunc builds the header hashed in front of an object's content
+type ObjectHeaderFunc func(objType string, size int64) []byte
+
+// GitObjectHeader returns git's object header "<type> <size>\x00"
+func GitObjectHeader(objType string, size int64) []byte {
+	header := make([]byte, 0, len(objType)+22)
+	header = append(header, objType...)
+	header = append(header, ' ')
+	header = strconv.AppendInt(header, size, 10)
+	return append(header, 0)
+}
+
+// HashObject hashes data as an object of the given type with git's header
+func HashObject(objType string, data []byte) Hash {
+	return HashObjectWithHeader(GitObjectHeader, objType, data)
+}
+
+// HashObjectWithHeader hashes data as an object using a custom header format
+func HashObjectWithHeader(header ObjectHeaderFunc, objType string, data []byte) Hash {
+	if header == nil {
+		header = GitObjectHeader
+	}
+	return HashMultiple(header(objType, int64(len(data))), data)
+}
+
+// CommitObject commits to data as an object of the given type with
+// committer, over the same header and content HashObjectWithHeader hashes.
+// With Z512Committer the commitment is the object's hash; other committers
+// give keyed or Merkle object addresses. A nil header uses git's.
+func CommitObject(committer Committer, header ObjectHeaderFunc, objType string, data []byte) []byte {
+	if header == nil {
+		header = GitObjectHeader
+	}
+	return committer.Commit(append(header(objType, int64(len(data))), data...))
+}
+
+// HashObjectReader hashes size bytes read from r as an object. The header is
+// written first, so the size must be known up front; nil header uses git's.
+func HashObjectReader(header ObjectHeaderFunc, objType string, r io.Reader, size int64) (Hash, error) {
+	if header == nil {
+		header = GitObjectHeader
+	}
+
+	sh := NewStreamingHash()
+	defer sh.Close()
+
+	sh.Write(header(objType, size))
+	n, err := io.Copy(sh, io.LimitReader(r, size+1))
+	if err != nil {
+		return Hash{}, err
+	}
+	if n != size {
+		return Hash{}, ErrObjectSizeMismatch
+	}
+	return sh.Sum(), nil
+}
+
+// TreeEntry is one entry of a tree object
+type TreeEntry struct {
+	Mode uint32
+	Name string
+	Hash Hash
+}
+
+// treeSortKey returns the name git sorts an entry by: directories compare as
+// if their name ended in '/'
+func (te TreeEntry) treeSortKey() string {
+	if te.Mode == ModeDirectory {
+		return te.Name + "/"
+	}
+	return te.Name
+}
+
+// EncodeTree serializes entries in git's tree format, "<mode> <name>\x00<hash>"
+// per entry, sorted in git's order. Hashes are the full 64-byte Z512 digests.
+func EncodeTree(entries []TreeEntry) []byte {
+	sorted := make([]TreeEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].treeSortKey() < sorted[j].treeSortKey() })
+
+	var buf bytes.Buffer
+	for _, entry := range sorted {
+		buf.WriteString(strconv.FormatUint(uint64(entry.Mode), 8))
+		buf.WriteByte(' ')
+		buf.WriteString(entry.Name)
+		buf.WriteByte(0)
+		buf.Write(entry.Hash[:])
+	}
+	return buf.Bytes()
+}
+
+// HashTree hashes entries as a tree object
+func HashTree(entries []TreeEntry) Hash {
+	return HashObject(ObjectTree, EncodeTree(entries))
+}
+
+// HashDirectory hashes a directory recursively as a tree object, the way git
+// hashes a checked-out source tree. Regular files become blobs, symlinks
+// blobs of their target, and subdirectories nested trees.
+func HashDirectory(dir string) (Hash, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	tree := make([]TreeEntry, 0, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			return Hash{}, err
+		}
+
+		var treeEntry TreeEntry
+		switch {
+		case info.IsDir():
+			treeEntry.Mode = ModeDirectory
+			treeEntry.Hash, err = HashDirectory(path)
+		case info.Mode()&os.ModeSymlink != 0:
+			var target string
+			target, err = os.Readlink(path)
+			treeEntry.Mode = ModeSymlink
+			treeEntry.Hash = HashObject(ObjectBlob, []byte(target))
+		case info.Mode().IsRegular():
+			treeEntry.Mode = ModeFile
+			if info.Mode()&0o111 != 0 {
+				treeEntry.Mode = ModeExecutable
+			}
+			treeEntry.Hash, err = hashFileObject(path, info.Size())
+		default:
+			continue
+		}
+		if err != nil {
+			return Hash{}, err
+		}
+
+		treeEntry.Name = entry.Name()
+		tree = append(tree, treeEntry)
+	}
+
+	return HashTree(tree), nil
+}
+
+// hashFileObject hashes a file as a blob object
+func hashFileObject(path string, size int64) (Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Hash{}, err
+	}
+	defer file.Close()
+
+	return HashObjectReader(nil, ObjectBlob, file, size)
+}
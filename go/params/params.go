@@ -0,0 +1,121 @@
+// Package params defines the sizes of TOPAY-Z512 keys, hashes, ciphertexts and
+// identifiers in one place. The topayz512 package derives its size constants
+// and fixed-size array types from these values and checks them at compile time,
+// so a size can only be changed here.
+package params
+
+// Size is a length in bytes
+type Size int
+
+// Bits returns the size in bits
+func (s Size) Bits() int {
+	return int(s) * 8
+}
+
+// Security levels in bits
+const (
+	// SecurityLevel is the classical security level
+	SecurityLevel = 512
+
+	// QuantumSecurityLevel is the quantum security level
+	QuantumSecurityLevel = 256
+)
+
+// Key and hash sizes
+const (
+	// PrivateKeySize is the size of a private key
+	PrivateKeySize Size = 64
+
+	// PublicKeySize is the size of a public key
+	PublicKeySize Size = 64
+
+	// HashSize is the size of a hash digest
+	HashSize Size = 64
+)
+
+// KEM sizes
+const (
+	// KEMPublicKeySize is the size of a KEM public key: two rank-8 vectors of
+	// 256 12-bit coefficients and the 32-byte matrix seed
+	KEMPublicKeySize Size = 6176
+
+	// KEMSecretKeySize is the size of a KEM secret key: the 64-byte key
+	// generation seed and the 64-byte implicit rejection key
+	KEMSecretKeySize Size = 128
+
+	// CiphertextSize is the size of a KEM ciphertext: the rank-8 vector u at
+	// 12 bits, two polynomials v at 6 bits and a 32-byte recipient tag
+	CiphertextSize Size = 3488
+
+	// SharedSecretSize is the size of a KEM shared secret
+	SharedSecretSize Size = 64
+)
+
+// Hybrid KEM sizes
+const (
+	// X25519KeySize is the size of an X25519 public key or shared secret
+	X25519KeySize Size = 32
+
+	// HybridPublicKeySize is the size of a hybrid public key: an X25519 key
+	// and a KEM public key
+	HybridPublicKeySize = X25519KeySize + KEMPublicKeySize
+
+	// HybridCiphertextSize is the size of a hybrid ciphertext: an ephemeral
+	// X25519 key and a KEM ciphertext
+	HybridCiphertextSize = X25519KeySize + CiphertextSize
+)
+
+// ML-KEM-768 (FIPS 203) sizes
+const (
+	// MLKEM768PublicKeySize is the size of an ML-KEM-768 encapsulation key
+	MLKEM768PublicKeySize Size = 1184
+
+	// MLKEM768SecretKeySize is the size of an ML-KEM-768 decapsulation key
+	MLKEM768SecretKeySize Size = 2400
+
+	// MLKEM768CiphertextSize is the size of an ML-KEM-768 ciphertext
+	MLKEM768CiphertextSize Size = 1088
+
+	// MLKEMSharedSecretSize is the size of an ML-KEM shared secret
+	MLKEMSharedSecretSize Size = 32
+
+	// MLKEMSeedSize is the size of the d || z seed an ML-KEM key is derived from
+	MLKEMSeedSize Size = 64
+)
+
+// Hash-based signature sizes
+const (
+	// WOTSHashSize is the chain value and seed size n of WOTS+ and XMSS
+	WOTSHashSize Size = 32
+
+	// SignatureSize is the size of a stateless key pair signature: the
+	// randomness, 35 FORS trees of height 9 and 17 hypertree layers of height
+	// 4, all over WOTSHashSize-byte values
+	SignatureSize Size = 49856
+)
+
+// Hybrid signature sizes
+const (
+	// Ed25519PublicKeySize is the size of an Ed25519 public key
+	Ed25519PublicKeySize Size = 32
+
+	// Ed25519SignatureSize is the size of an Ed25519 signature
+	Ed25519SignatureSize Size = 64
+
+	// HybridSignaturePublicKeySize is the size of a hybrid signature public
+	// key: an Ed25519 key and a key pair public key
+	HybridSignaturePublicKeySize = Ed25519PublicKeySize + PublicKeySize
+
+	// HybridSignatureSize is the size of a hybrid signature: an Ed25519
+	// signature and a stateless hash-based signature
+	HybridSignatureSize = Ed25519SignatureSize + SignatureSize
+)
+
+// Auxiliary sizes
+const (
+	// NonceSize is the size of a derived AEAD nonce
+	NonceSize Size = 12
+
+	// IDSize is the size of an identifier
+	IDSize Size = 16
+)
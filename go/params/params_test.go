@@ -0,0 +1,18 @@
+package params
+
+import "testing"
+
+// Test size conversions and the relationships the library relies on
+func TestSizes(t *testing.T) {
+	if HashSize.Bits() != SecurityLevel {
+		t.Errorf("Hash size %d bits doesn't match the security level %d", HashSize.Bits(), SecurityLevel)
+	}
+
+	if WOTSHashSize.Bits() != QuantumSecurityLevel {
+		t.Errorf("WOTS hash size %d bits doesn't match the quantum security level %d", WOTSHashSize.Bits(), QuantumSecurityLevel)
+	}
+
+	if WOTSHashSize > HashSize {
+		t.Error("WOTS values are truncated hashes and can't exceed the hash size")
+	}
+}
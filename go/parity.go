@@ -0,0 +1,401 @@
+package topayz512
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Reed-Solomon parity shards for fragment repair
+
+// ParityShard carries Reed-Solomon parity computed over a set of fragments.
+// Any combination of up to ParityShards missing or corrupted fragments can be
+// rebuilt from the surviving fragments and parity without the original data.
+type ParityShard struct {
+	ID           ID     `json:"id"`
+	Index        uint32 `json:"index"`
+	DataShards   uint32 `json:"data_shards"`
+	ParityShards uint32 `json:"parity_shards"`
+	FragmentSize uint32 `json:"fragment_size"`
+	OriginalSize uint64 `json:"original_size"`
+	Data         []byte `json:"data"`
+	Checksum     Hash   `json:"checksum"`
+}
+
+// GF(2^16) arithmetic used by the parity code. Working over 16-bit symbols
+// allows up to 65536 data and parity shards, well beyond MaxFragments.
+const (
+	gf16Order      = 1 << 16
+	gf16Polynomial = 0x1100B // x^16 + x^12 + x^3 + x + 1
+)
+
+var (
+	gf16Once sync.Once
+	gf16Exp  []uint16
+	gf16Log  []uint16
+)
+
+// initGF16 builds the exponent and logarithm tables on first use
+func initGF16() {
+	gf16Once.Do(func() {
+		gf16Exp = make([]uint16, 2*gf16Order)
+		gf16Log = make([]uint16, gf16Order)
+
+		x := 1
+		for i := 0; i < gf16Order-1; i++ {
+			gf16Exp[i] = uint16(x)
+			gf16Log[x] = uint16(i)
+			x <<= 1
+			if x&gf16Order != 0 {
+				x ^= gf16Polynomial
+			}
+		}
+		for i := gf16Order - 1; i < len(gf16Exp); i++ {
+			gf16Exp[i] = gf16Exp[i-(gf16Order-1)]
+		}
+	})
+}
+
+// gf16Mul multiplies two field elements
+func gf16Mul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf16Exp[int(gf16Log[a])+int(gf16Log[b])]
+}
+
+// gf16Inv returns the multiplicative inverse of a non-zero field element
+func gf16Inv(a uint16) uint16 {
+	return gf16Exp[(gf16Order-1)-int(gf16Log[a])]
+}
+
+// cauchyCoefficient returns the encoding coefficient of data shard i in parity shard j
+func cauchyCoefficient(dataShards, j, i int) uint16 {
+	return gf16Inv(uint16(dataShards+j) ^ uint16(i))
+}
+
+// gf16MulAdd computes dst ^= c * src over big-endian 16-bit symbols
+func gf16MulAdd(dst, src []byte, c uint16) {
+	if c == 0 {
+		return
+	}
+	logC := int(gf16Log[c])
+	for k := 0; k+1 < len(src); k += 2 {
+		s := uint16(src[k])<<8 | uint16(src[k+1])
+		if s == 0 {
+			continue
+		}
+		p := gf16Exp[logC+int(gf16Log[s])]
+		dst[k] ^= byte(p >> 8)
+		dst[k+1] ^= byte(p)
+	}
+}
+
+// paddedShard copies fragment data into a zero-padded buffer of shardSize bytes
+func paddedShard(data []byte, shardSize int) []byte {
+	shard := make([]byte, shardSize)
+	copy(shard, data)
+	return shard
+}
+
+// expectedFragmentSize returns the length of fragment index for a regular layout
+func expectedFragmentSize(index int, fragmentSize int, originalSize uint64) int {
+	start := uint64(index) * uint64(fragmentSize)
+	if start >= originalSize {
+		return 0
+	}
+	remaining := originalSize - start
+	if remaining < uint64(fragmentSize) {
+		return int(remaining)
+	}
+	return fragmentSize
+}
+
+// GenerateParity computes parityCount Reed-Solomon parity shards over a complete fragment set
+func GenerateParity(fragments []Fragment, parityCount int) ([]ParityShard, error) {
+	if len(fragments) == 0 {
+		return nil, ErrEmptyData
+	}
+
+	dataShards := len(fragments)
+	if parityCount <= 0 || dataShards+parityCount > gf16Order {
+		return nil, ErrInvalidFragmentCount
+	}
+
+	sorted := make([]Fragment, dataShards)
+	copy(sorted, fragments)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	// Parity requires the regular layout produced by FragmentData: every
+	// fragment except the last carries exactly fragmentSize bytes
+	fragmentID := sorted[0].ID
+	fragmentSize := len(sorted[0].Data)
+	var originalSize uint64
+	for i, fragment := range sorted {
+		if fragment.ID != fragmentID || fragment.Index != uint32(i) || fragment.Total != uint32(dataShards) {
+			return nil, ErrInvalidFragmentCount
+		}
+		if err := ValidateFragmentIntegrity(fragment); err != nil {
+			return nil, err
+		}
+		if len(fragment.Data) > fragmentSize || (i < dataShards-1 && len(fragment.Data) != fragmentSize) {
+			return nil, ErrFragmentationFailed
+		}
+		originalSize += uint64(len(fragment.Data))
+	}
+
+	// Symbols are 16 bits wide, so shards are padded to an even length
+	shardSize := fragmentSize + fragmentSize%2
+
+	initGF16()
+
+	shards := make([][]byte, dataShards)
+	for i, fragment := range sorted {
+		shards[i] = paddedShard(fragment.Data, shardSize)
+	}
+
+	parity := make([]ParityShard, parityCount)
+
+	var wg sync.WaitGroup
+	for j := 0; j < parityCount; j++ {
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+
+			data := make([]byte, shardSize)
+			for i, shard := range shards {
+				gf16MulAdd(data, shard, cauchyCoefficient(dataShards, j, i))
+			}
+
+			parity[j] = ParityShard{
+				ID:           fragmentID,
+				Index:        uint32(j),
+				DataShards:   uint32(dataShards),
+				ParityShards: uint32(parityCount),
+				FragmentSize: uint32(fragmentSize),
+				OriginalSize: originalSize,
+				Data:         data,
+				Checksum:     ComputeHash(data),
+			}
+		}(j)
+	}
+	wg.Wait()
+
+	return parity, nil
+}
+
+// RepairFromParity rebuilds missing or corrupted fragments using parity shards.
+// The fragments slice may be incomplete or contain fragments whose checksum no
+// longer matches; the complete, index-ordered fragment set is returned. A
+// complete set of intact fragments is returned without consulting parity, so
+// ErrInsufficientParity means a repair was needed and parity couldn't make it.
+func RepairFromParity(fragments []Fragment, parity []ParityShard) ([]Fragment, error) {
+	// Parity is only needed for an actual repair
+	if intact, ok := intactFragmentSet(fragments); ok {
+		return intact, nil
+	}
+	if len(parity) == 0 {
+		return nil, ErrInsufficientParity
+	}
+
+	// Shard checksums cover only the data, so the layout is taken from the
+	// first intact shard and every other intact shard must repeat it
+	var layout *ParityShard
+	var validParity []ParityShard
+	for i := range parity {
+		shard := &parity[i]
+		if !HashEqual(ComputeHash(shard.Data), shard.Checksum) {
+			continue
+		}
+		if layout == nil {
+			layout = shard
+		} else if !sameParityLayout(*layout, *shard) {
+			return nil, fmt.Errorf("%w: parity shards disagree on their layout", ErrInvalidFragmentCount)
+		}
+		validParity = append(validParity, *shard)
+	}
+	if layout == nil {
+		return nil, ErrInsufficientParity
+	}
+
+	dataShards := int(layout.DataShards)
+	fragmentSize := int(layout.FragmentSize)
+	shardSize := fragmentSize + fragmentSize%2
+	if dataShards == 0 || fragmentSize == 0 || dataShards+int(layout.ParityShards) > gf16Order ||
+		layout.OriginalSize == 0 || (layout.OriginalSize-1)/uint64(fragmentSize)+1 != uint64(dataShards) {
+		return nil, ErrInvalidFragmentCount
+	}
+	for _, shard := range validParity {
+		if shard.Index >= shard.ParityShards || len(shard.Data) != shardSize {
+			return nil, fmt.Errorf("%w: parity shard %d doesn't fit its layout", ErrInvalidFragmentCount, shard.Index)
+		}
+	}
+
+	// Keep only fragments that belong to this set and pass their checksum
+	present := make([]*Fragment, dataShards)
+	for i := range fragments {
+		fragment := fragments[i]
+		if fragment.ID != layout.ID || fragment.Index >= uint32(dataShards) {
+			continue
+		}
+		if len(fragment.Data) != expectedFragmentSize(int(fragment.Index), fragmentSize, layout.OriginalSize) {
+			continue
+		}
+		if !HashEqual(ComputeHash(fragment.Data), fragment.Checksum) {
+			continue
+		}
+		if present[fragment.Index] == nil {
+			present[fragment.Index] = &fragment
+		}
+	}
+
+	var missing []int
+	for i, fragment := range present {
+		if fragment == nil {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) > len(validParity) {
+		return nil, ErrInsufficientParity
+	}
+
+	if len(missing) > 0 {
+		initGF16()
+
+		// For each selected parity shard, subtract the contribution of the
+		// surviving fragments to leave a system in the missing fragments only
+		used := validParity[:len(missing)]
+		rhs := make([][]byte, len(used))
+		matrix := make([][]uint16, len(used))
+		for r, shard := range used {
+			rhs[r] = make([]byte, shardSize)
+			copy(rhs[r], shard.Data)
+			for i, fragment := range present {
+				if fragment != nil {
+					gf16MulAdd(rhs[r], paddedShard(fragment.Data, shardSize), cauchyCoefficient(dataShards, int(shard.Index), i))
+				}
+			}
+
+			matrix[r] = make([]uint16, len(missing))
+			for c, index := range missing {
+				matrix[r][c] = cauchyCoefficient(dataShards, int(shard.Index), index)
+			}
+		}
+
+		inverse, err := gf16InvertMatrix(matrix)
+		if err != nil {
+			return nil, err
+		}
+
+		for c, index := range missing {
+			recovered := make([]byte, shardSize)
+			for r := range used {
+				gf16MulAdd(recovered, rhs[r], inverse[c][r])
+			}
+
+			data := recovered[:expectedFragmentSize(index, fragmentSize, layout.OriginalSize)]
+			present[index] = &Fragment{
+				ID:       layout.ID,
+				Index:    uint32(index),
+				Total:    uint32(dataShards),
+				Data:     data,
+				Checksum: ComputeHash(data),
+			}
+		}
+	}
+
+	repaired := make([]Fragment, dataShards)
+	for i, fragment := range present {
+		repaired[i] = *fragment
+		repaired[i].Total = uint32(dataShards)
+	}
+
+	return repaired, nil
+}
+
+// sameParityLayout reports whether two parity shards describe the same set
+func sameParityLayout(a, b ParityShard) bool {
+	return a.ID == b.ID && a.DataShards == b.DataShards && a.ParityShards == b.ParityShards &&
+		a.FragmentSize == b.FragmentSize && a.OriginalSize == b.OriginalSize
+}
+
+// intactFragmentSet returns fragments in index order if they hold every
+// fragment of one payload with a valid checksum, ignoring corrupted copies
+func intactFragmentSet(fragments []Fragment) ([]Fragment, bool) {
+	if len(fragments) == 0 {
+		return nil, false
+	}
+	id, total := fragments[0].ID, fragments[0].Total
+	if total == 0 || int(total) > len(fragments) {
+		return nil, false
+	}
+
+	present := make([]*Fragment, total)
+	for i := range fragments {
+		fragment := &fragments[i]
+		if fragment.ID != id || fragment.Total != total || fragment.Index >= total {
+			return nil, false
+		}
+		if present[fragment.Index] == nil && HashEqual(ComputeHash(fragment.Data), fragment.Checksum) {
+			present[fragment.Index] = fragment
+		}
+	}
+
+	intact := make([]Fragment, total)
+	for i, fragment := range present {
+		if fragment == nil {
+			return nil, false
+		}
+		intact[i] = *fragment
+	}
+	return intact, true
+}
+
+// gf16InvertMatrix inverts a square matrix over GF(2^16) by Gauss-Jordan elimination
+func gf16InvertMatrix(matrix [][]uint16) ([][]uint16, error) {
+	n := len(matrix)
+
+	work := make([][]uint16, n)
+	inverse := make([][]uint16, n)
+	for i := range matrix {
+		work[i] = make([]uint16, n)
+		copy(work[i], matrix[i])
+		inverse[i] = make([]uint16, n)
+		inverse[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for row := col; row < n; row++ {
+			if work[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, ErrReconstructionFailed
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		scale := gf16Inv(work[col][col])
+		for k := 0; k < n; k++ {
+			work[col][k] = gf16Mul(work[col][k], scale)
+			inverse[col][k] = gf16Mul(inverse[col][k], scale)
+		}
+
+		for row := 0; row < n; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+			factor := work[row][col]
+			for k := 0; k < n; k++ {
+				work[row][k] ^= gf16Mul(factor, work[col][k])
+				inverse[row][k] ^= gf16Mul(factor, inverse[col][k])
+			}
+		}
+	}
+
+	return inverse, nil
+}
@@ -0,0 +1,147 @@
+package topayz512
+
+import "time"
+
+// Partial reconstruction
+//
+// ReconstructPartial is the tolerant counterpart of ReconstructData: rather
+// than failing when fragments are missing or corrupt, it assembles the
+// fragments that verify, fills the gaps and reports which indices are
+// missing, so a receiver can show what it has and ask the sender to
+// retransmit just those fragments.
+
+// PartialOptions configures ReconstructPartial
+type PartialOptions struct {
+	// Key keys the fragment checksums; nil checks plain hashes
+	Key *FragmentKey
+	// Committer checks fragments instead of Key when set
+	Committer Committer
+	// OriginalSize is the sender's FragmentMetadata.OriginalSize. It fixes
+	// the layout even when the last fragment is missing; zero infers the
+	// layout from the fragments received.
+	OriginalSize uint64
+	// Fill is the byte gaps are filled with
+	Fill byte
+}
+
+// ReconstructPartial reassembles as much of a payload as the fragments
+// allow; nil opts checks plain checksums and fills gaps with zeros. Fragments
+// failing their checksum count as missing. The result lists the missing
+// indices in MissingIndices and is complete, with the payload checksum in
+// its metadata, only when there are none.
+//
+// Each gap is filled with fragment-sized runs of the Fill byte, so received
+// fragments keep their offsets. Without OriginalSize, a missing last
+// fragment is left out of Data since its size is unknown, and when only the
+// last fragment verified its offset is unknown too and Data is nil.
+//
+// It returns ErrEmptyData for no fragments, ErrReconstructionFailed for
+// fragments of different payloads and ErrInvalidFragmentCount for a
+// fragment count or OriginalSize that doesn't describe a payload.
+func ReconstructPartial(fragments []Fragment, opts *PartialOptions) (ReconstructionResult, error) {
+	var options PartialOptions
+	if opts != nil {
+		options = *opts
+	}
+	if len(fragments) == 0 {
+		return ReconstructionResult{}, ErrEmptyData
+	}
+	var commitment fragmentCommitment = keyedCommitment{key: options.Key}
+	if options.Committer != nil {
+		commitment = committerCommitment{committer: options.Committer}
+	}
+
+	id, total := fragments[0].ID, fragments[0].Total
+	if total == 0 || total > MaxFragments {
+		return ReconstructionResult{}, ErrInvalidFragmentCount
+	}
+	fragmentSize := 0
+	if options.OriginalSize != 0 {
+		var ok bool
+		if options.OriginalSize > MaxFragmentedDataSize {
+			return ReconstructionResult{}, ErrInvalidFragmentCount
+		}
+		if fragmentSize, ok = evenFragmentLayout(options.OriginalSize, total); !ok {
+			return ReconstructionResult{}, ErrInvalidFragmentCount
+		}
+	}
+
+	// Keep the first fragment that verifies at each index
+	received := make([]*Fragment, total)
+	for i := range fragments {
+		fragment := &fragments[i]
+		if fragment.ID != id || fragment.Total != total {
+			return ReconstructionResult{}, ErrReconstructionFailed
+		}
+		if fragment.Index >= total || received[fragment.Index] != nil || !commitment.verify(*fragment) {
+			continue
+		}
+		if fragmentSize != 0 && len(fragment.Data) != fragmentSizeAt(options.OriginalSize, fragmentSize, fragment.Index) {
+			continue
+		}
+		received[fragment.Index] = fragment
+	}
+
+	var missing []uint32
+	for index, fragment := range received {
+		if fragment == nil {
+			missing = append(missing, uint32(index))
+		} else if fragmentSize == 0 && uint32(index) != total-1 {
+			fragmentSize = len(fragment.Data)
+		}
+	}
+
+	metadata := FragmentMetadata{
+		FragmentCount: total,
+		Timestamp:     time.Now(),
+		Algorithm:     "TOPAY-Z512",
+	}
+	result := ReconstructionResult{
+		IsComplete:     len(missing) == 0,
+		MissingCount:   uint32(len(missing)),
+		MissingIndices: missing,
+	}
+	if fragmentSize == 0 && total > 1 {
+		// Only the last fragment verified, so nothing can be placed
+		result.Metadata = metadata
+		return result, nil
+	}
+
+	var data []byte
+	if options.OriginalSize != 0 {
+		data = make([]byte, 0, options.OriginalSize)
+	}
+	for index, fragment := range received {
+		switch {
+		case fragment != nil:
+			data = append(data, fragment.Data...)
+		case options.OriginalSize != 0:
+			data = appendFill(data, options.Fill, fragmentSizeAt(options.OriginalSize, fragmentSize, uint32(index)))
+		case uint32(index) != total-1:
+			data = appendFill(data, options.Fill, fragmentSize)
+		}
+	}
+
+	metadata.OriginalSize = uint64(len(data))
+	if result.IsComplete {
+		metadata.Checksum = ComputeHash(data)
+	}
+	result.Data = data
+	result.Metadata = metadata
+	return result, nil
+}
+
+// fragmentSizeAt returns the size of the fragment at index in a payload of
+// originalSize bytes split into fragmentSize pieces
+func fragmentSizeAt(originalSize uint64, fragmentSize int, index uint32) int {
+	start := uint64(index) * uint64(fragmentSize)
+	return int(min(originalSize-start, uint64(fragmentSize)))
+}
+
+// appendFill appends n copies of b
+func appendFill(data []byte, b byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		data = append(data, b)
+	}
+	return data
+}
@@ -0,0 +1,236 @@
+package topayz512
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Password-based key derivation with stored parameters
+//
+// A derivation is stored as a PHC-style string naming its algorithm, cost
+// and salt, so a key derived today can still be derived after the defaults
+// are raised:
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<base64 salt>
+//	$tz512-hashloop$v=1$i=100000$<base64 salt>
+//
+// The Argon2id form is the one other Argon2 libraries use, with the RFC 9106
+// version 0x13 and unpadded standard base64. The private key is the first
+// PrivateKeySize bytes of Argon2id(password, salt) with the associated data
+// "TOPAY-Z512-PASSWORD". The hash loop is DeriveKeyFromPassword, kept so
+// existing derivations can be verified and upgraded.
+
+// PasswordAlgorithm identifies a password-to-key derivation
+type PasswordAlgorithm uint8
+
+// Password algorithms
+const (
+	// PasswordHashLoop is the iterated hash of DeriveKeyFromPassword
+	PasswordHashLoop PasswordAlgorithm = 1
+
+	// PasswordArgon2id is memory-hard Argon2id (RFC 9106)
+	PasswordArgon2id PasswordAlgorithm = 2
+)
+
+// Default Argon2id cost, following the RFC 9106 second recommended option
+const (
+	// DefaultArgon2Time is the default number of passes over memory
+	DefaultArgon2Time = 3
+
+	// DefaultArgon2Memory is the default memory in KiB (64 MiB)
+	DefaultArgon2Memory = 64 * 1024
+
+	// DefaultArgon2Parallelism is the default number of lanes
+	DefaultArgon2Parallelism = 4
+)
+
+// Password derivation limits
+const (
+	// MinPasswordSaltSize is the smallest accepted salt in bytes
+	MinPasswordSaltSize = 16
+
+	// MaxArgon2Memory is the most memory in KiB a stored derivation may ask
+	// for (4 GiB), so a tampered string can't exhaust memory
+	MaxArgon2Memory = 4 * 1024 * 1024
+
+	// maxPasswordSaltSize bounds salts read from stored strings
+	maxPasswordSaltSize = 1024
+
+	// passwordArgon2Data is the Argon2id associated data of key derivations
+	passwordArgon2Data = "TOPAY-Z512-PASSWORD"
+
+	// passwordHashLoopName is the algorithm name of PasswordHashLoop strings
+	passwordHashLoopName = "tz512-hashloop"
+)
+
+// String returns the algorithm name used in stored strings
+func (a PasswordAlgorithm) String() string {
+	switch a {
+	case PasswordHashLoop:
+		return passwordHashLoopName
+	case PasswordArgon2id:
+		return "argon2id"
+	default:
+		return fmt.Sprintf("PasswordAlgorithm(%d)", uint8(a))
+	}
+}
+
+// PasswordParams describes one password derivation: the algorithm, its cost
+// and the salt
+type PasswordParams struct {
+	Algorithm PasswordAlgorithm
+	// Iterations is the number of Argon2id passes or hash loop rounds
+	Iterations uint32
+	// Memory is the Argon2id memory in KiB
+	Memory uint32
+	// Parallelism is the number of Argon2id lanes
+	Parallelism uint8
+	Salt        []byte
+}
+
+// NewPasswordParams returns the default Argon2id parameters with a fresh
+// random salt
+func NewPasswordParams() (PasswordParams, error) {
+	salt, err := SecureRandom(MinPasswordSaltSize)
+	if err != nil {
+		return PasswordParams{}, err
+	}
+	return PasswordParams{
+		Algorithm:   PasswordArgon2id,
+		Iterations:  DefaultArgon2Time,
+		Memory:      DefaultArgon2Memory,
+		Parallelism: DefaultArgon2Parallelism,
+		Salt:        salt,
+	}, nil
+}
+
+// Validate returns ErrInvalidPasswordParams unless the parameters can be
+// derived: a salt of MinPasswordSaltSize bytes, at least one iteration and,
+// for Argon2id, at least one lane and 8 KiB per lane up to MaxArgon2Memory
+func (p PasswordParams) Validate() error {
+	if len(p.Salt) < MinPasswordSaltSize || len(p.Salt) > maxPasswordSaltSize || p.Iterations == 0 {
+		return ErrInvalidPasswordParams
+	}
+	switch p.Algorithm {
+	case PasswordHashLoop:
+		if p.Memory != 0 || p.Parallelism != 0 {
+			return ErrInvalidPasswordParams
+		}
+	case PasswordArgon2id:
+		if p.Parallelism == 0 || p.Memory < 8*uint32(p.Parallelism) || p.Memory > MaxArgon2Memory {
+			return ErrInvalidPasswordParams
+		}
+	default:
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
+
+// String returns the stored form of the parameters
+func (p PasswordParams) String() string {
+	salt := base64.RawStdEncoding.EncodeToString(p.Salt)
+	if p.Algorithm == PasswordHashLoop {
+		return fmt.Sprintf("$%s$v=1$i=%d$%s", passwordHashLoopName, p.Iterations, salt)
+	}
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s", p.Algorithm, argon2Version, p.Memory, p.Iterations, p.Parallelism, salt)
+}
+
+// ParsePasswordParams parses a string written by PasswordParams.String. It
+// returns ErrUnsupportedVersion for an unknown algorithm or version and
+// ErrInvalidPasswordParams for malformed or out-of-range parameters.
+func ParsePasswordParams(encoded string) (PasswordParams, error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 5 || fields[0] != "" {
+		return PasswordParams{}, ErrInvalidPasswordParams
+	}
+
+	var params PasswordParams
+	var version int
+	var err error
+	switch fields[1] {
+	case passwordHashLoopName:
+		params.Algorithm = PasswordHashLoop
+		_, err = fmt.Sscanf(fields[2], "v=%d", &version)
+		if err == nil && version != 1 {
+			return PasswordParams{}, ErrUnsupportedVersion
+		}
+		if err == nil {
+			_, err = fmt.Sscanf(fields[3], "i=%d", &params.Iterations)
+		}
+	case PasswordArgon2id.String():
+		params.Algorithm = PasswordArgon2id
+		_, err = fmt.Sscanf(fields[2], "v=%d", &version)
+		if err == nil && version != argon2Version {
+			return PasswordParams{}, ErrUnsupportedVersion
+		}
+		if err == nil {
+			_, err = fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+		}
+	default:
+		return PasswordParams{}, ErrUnsupportedVersion
+	}
+	if err != nil {
+		return PasswordParams{}, ErrInvalidPasswordParams
+	}
+	if params.Salt, err = base64.RawStdEncoding.Strict().DecodeString(fields[4]); err != nil {
+		return PasswordParams{}, ErrInvalidPasswordParams
+	}
+
+	// Only the canonical form is accepted, so one derivation has one string
+	if params.String() != encoded {
+		return PasswordParams{}, ErrInvalidPasswordParams
+	}
+	if err := params.Validate(); err != nil {
+		return PasswordParams{}, err
+	}
+	return params, nil
+}
+
+// NeedsUpgrade reports whether p is weaker than target: another algorithm,
+// or fewer iterations, less memory or fewer lanes. A stored derivation that
+// needs an upgrade should be re-derived with target at the next successful
+// login.
+func (p PasswordParams) NeedsUpgrade(target PasswordParams) bool {
+	return p.Algorithm != target.Algorithm ||
+		p.Iterations < target.Iterations ||
+		p.Memory < target.Memory ||
+		p.Parallelism < target.Parallelism
+}
+
+// DeriveKeyWithParams derives a private key from a password with the given
+// parameters
+func DeriveKeyWithParams(password []byte, params PasswordParams) (PrivateKey, error) {
+	if len(password) == 0 {
+		return PrivateKey{}, ErrEmptyData
+	}
+	if err := params.Validate(); err != nil {
+		return PrivateKey{}, err
+	}
+
+	if params.Algorithm == PasswordHashLoop {
+		return DeriveKeyFromPassword(password, params.Salt, int(params.Iterations))
+	}
+	derived := argon2idKey(password, params.Salt, nil, []byte(passwordArgon2Data),
+		params.Iterations, params.Memory, params.Parallelism, uint32(PrivateKeySize))
+	defer SecureZero(derived)
+
+	var privateKey PrivateKey
+	copy(privateKey[:], derived)
+	return privateKey, nil
+}
+
+// VerifyPasswordKey re-derives the key of a stored derivation and reports
+// whether its public key is publicKey
+func VerifyPasswordKey(password []byte, encoded string, publicKey PublicKey) (bool, error) {
+	params, err := ParsePasswordParams(encoded)
+	if err != nil {
+		return false, err
+	}
+	privateKey, err := DeriveKeyWithParams(password, params)
+	if err != nil {
+		return false, err
+	}
+	defer SecureErasePrivateKey(&privateKey)
+	return VerifyKeyPair(privateKey, publicKey), nil
+}
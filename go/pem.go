@@ -0,0 +1,224 @@
+package topayz512
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/pem"
+)
+
+// PEM and DER key encodings
+//
+// Public keys are DER SubjectPublicKeyInfo structures and private keys
+// PKCS #8 OneAsymmetricKey structures holding the raw key in an inner OCTET
+// STRING, the layout RFC 8410 uses for Ed25519, so generic ASN.1 and PKI
+// tooling can carry them. The algorithm identifiers have no parameters and
+// are OIDs under a UUID arc (ITU-T X.667), which needs no registration:
+//
+//	2.25.204137026632617517533622656149190760471.1   TOPAY-Z512 signatures
+//	2.25.204137026632617517533622656149190760471.2   TOPAY-Z512 KEM
+//
+// Each key type has its own PEM block type; ParsePEM also accepts the
+// generic "PUBLIC KEY" and "PRIVATE KEY" blocks and tells keys apart by OID.
+
+// PEM block types
+const (
+	PEMPrivateKey   = "TOPAY-Z512 PRIVATE KEY"
+	PEMPublicKey    = "TOPAY-Z512 PUBLIC KEY"
+	PEMKEMSecretKey = "TOPAY-Z512 KEM SECRET KEY"
+	PEMKEMPublicKey = "TOPAY-Z512 KEM PUBLIC KEY"
+)
+
+// oidArc is the content of the DER OID 2.25.204137026632617517533622656149190760471
+var oidArc = []byte{
+	0x69, 0x82, 0xb3, 0x93, 0xae, 0x9e, 0xbc, 0xd8, 0x92, 0xa1,
+	0xa5, 0x85, 0xc8, 0xe5, 0xa3, 0x86, 0x98, 0xb9, 0xb0, 0x17,
+}
+
+// Algorithm OIDs, DER encoded
+var (
+	oidSignature = derOID(1)
+	oidKEM       = derOID(2)
+)
+
+// derOID returns the DER encoding of arc under oidArc
+func derOID(arc byte) []byte {
+	oid := []byte{asn1.TagOID, byte(len(oidArc) + 1)}
+	oid = append(oid, oidArc...)
+	return append(oid, arc)
+}
+
+// pkixAlgorithm is an AlgorithmIdentifier without parameters. The OID is
+// raw because its UUID arc overflows asn1.ObjectIdentifier.
+type pkixAlgorithm struct {
+	Algorithm asn1.RawValue
+}
+
+// pkixPublicKey is a SubjectPublicKeyInfo
+type pkixPublicKey struct {
+	Algorithm pkixAlgorithm
+	PublicKey asn1.BitString
+}
+
+// pkcs8PrivateKey is a version 0 OneAsymmetricKey without attributes
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkixAlgorithm
+	PrivateKey []byte
+}
+
+// keyEncoding describes how one key type is encoded
+type keyEncoding struct {
+	oid       []byte
+	private   bool
+	blockType string
+}
+
+// encodingOf returns the encoding and raw bytes of a supported key, given
+// by value or pointer
+func encodingOf(key any) (keyEncoding, []byte, error) {
+	switch k := key.(type) {
+	case PrivateKey:
+		return keyEncoding{oidSignature, true, PEMPrivateKey}, k[:], nil
+	case *PrivateKey:
+		return keyEncoding{oidSignature, true, PEMPrivateKey}, k[:], nil
+	case PublicKey:
+		return keyEncoding{oidSignature, false, PEMPublicKey}, k[:], nil
+	case *PublicKey:
+		return keyEncoding{oidSignature, false, PEMPublicKey}, k[:], nil
+	case KEMSecretKey:
+		return keyEncoding{oidKEM, true, PEMKEMSecretKey}, k[:], nil
+	case *KEMSecretKey:
+		return keyEncoding{oidKEM, true, PEMKEMSecretKey}, k[:], nil
+	case KEMPublicKey:
+		return keyEncoding{oidKEM, false, PEMKEMPublicKey}, k[:], nil
+	case *KEMPublicKey:
+		return keyEncoding{oidKEM, false, PEMKEMPublicKey}, k[:], nil
+	default:
+		return keyEncoding{}, nil, ErrUnsupportedKeyType
+	}
+}
+
+// MarshalDER encodes a PrivateKey, PublicKey, KEMSecretKey or KEMPublicKey,
+// or a pointer to one, as PKCS #8 or SubjectPublicKeyInfo DER
+func MarshalDER(key any) ([]byte, error) {
+	encoding, raw, err := encodingOf(key)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := pkixAlgorithm{Algorithm: asn1.RawValue{FullBytes: encoding.oid}}
+	if !encoding.private {
+		return asn1.Marshal(pkixPublicKey{
+			Algorithm: algorithm,
+			PublicKey: asn1.BitString{Bytes: raw, BitLength: 8 * len(raw)},
+		})
+	}
+
+	inner, err := asn1.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(inner)
+	return asn1.Marshal(pkcs8PrivateKey{Algorithm: algorithm, PrivateKey: inner})
+}
+
+// ParseDER decodes DER written by MarshalDER, returning a PrivateKey,
+// PublicKey, KEMSecretKey or KEMPublicKey. It returns ErrInvalidKeyEncoding
+// for malformed DER or an unknown algorithm and ErrInvalidKEMPublicKey for a
+// non-canonical KEM public key.
+func ParseDER(der []byte) (any, error) {
+	var public pkixPublicKey
+	if rest, err := asn1.Unmarshal(der, &public); err == nil {
+		if len(rest) != 0 || public.PublicKey.BitLength != 8*len(public.PublicKey.Bytes) {
+			return nil, ErrInvalidKeyEncoding
+		}
+		switch oid := public.Algorithm.Algorithm.FullBytes; {
+		case bytes.Equal(oid, oidSignature):
+			publicKey, err := PublicKeyFromBytes(public.PublicKey.Bytes)
+			if err != nil {
+				return nil, ErrInvalidKeyEncoding
+			}
+			return publicKey, nil
+		case bytes.Equal(oid, oidKEM):
+			publicKey, err := KEMPublicKeyFromBytes(public.PublicKey.Bytes)
+			if err != nil {
+				return nil, ErrInvalidKeyEncoding
+			}
+			if !IsValidKEMPublicKey(publicKey) {
+				return nil, ErrInvalidKEMPublicKey
+			}
+			return publicKey, nil
+		default:
+			return nil, ErrInvalidKeyEncoding
+		}
+	}
+
+	var private pkcs8PrivateKey
+	rest, err := asn1.Unmarshal(der, &private)
+	if err != nil || len(rest) != 0 || private.Version != 0 {
+		return nil, ErrInvalidKeyEncoding
+	}
+	var raw []byte
+	rest, err = asn1.Unmarshal(private.PrivateKey, &raw)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidKeyEncoding
+	}
+	defer SecureZero(raw)
+	defer SecureZero(private.PrivateKey)
+
+	switch oid := private.Algorithm.Algorithm.FullBytes; {
+	case bytes.Equal(oid, oidSignature):
+		privateKey, err := PrivateKeyFromBytes(raw)
+		if err != nil {
+			return nil, ErrInvalidKeyEncoding
+		}
+		return privateKey, nil
+	case bytes.Equal(oid, oidKEM):
+		secretKey, err := KEMSecretKeyFromBytes(raw)
+		if err != nil {
+			return nil, ErrInvalidKeyEncoding
+		}
+		return secretKey, nil
+	default:
+		return nil, ErrInvalidKeyEncoding
+	}
+}
+
+// MarshalPEM encodes a key as MarshalDER does, in a PEM block of the key's
+// own type
+func MarshalPEM(key any) ([]byte, error) {
+	encoding, _, err := encodingOf(key)
+	if err != nil {
+		return nil, err
+	}
+	der, err := MarshalDER(key)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(der)
+	return pem.EncodeToMemory(&pem.Block{Type: encoding.blockType, Bytes: der}), nil
+}
+
+// ParsePEM decodes the first PEM block in data, returning the key and the
+// data after the block. The block type must match the key it holds, or be
+// the generic "PUBLIC KEY" or "PRIVATE KEY".
+func ParsePEM(data []byte) (any, []byte, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, data, ErrInvalidKeyEncoding
+	}
+	defer SecureZero(block.Bytes)
+	key, err := ParseDER(block.Bytes)
+	if err != nil {
+		return nil, rest, err
+	}
+
+	encoding, _, _ := encodingOf(key)
+	generic := "PUBLIC KEY"
+	if encoding.private {
+		generic = "PRIVATE KEY"
+	}
+	if block.Type != encoding.blockType && block.Type != generic {
+		return nil, rest, ErrInvalidKeyEncoding
+	}
+	return key, rest, nil
+}
@@ -0,0 +1,337 @@
+package topayz512
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Processing pipelines
+//
+// A Pipeline chains the usual steps for shipping a payload, such as
+// compress → fragment → hash → encrypt, and runs them without hand-written
+// goroutine plumbing. Fragment stages run over the fragments with their own
+// parallelism, set by Parallel. Compressed payloads are fragmented in
+// place rather than copied, so a payload is held at most twice: once
+// compressed and once in its final form. Open undoes the stages in reverse
+// order and returns the original payload.
+//
+//	pipeline := NewPipeline().
+//		Compress(flate.BestSpeed).
+//		Fragment(WithFragmentSize(64 << 10)).
+//		Encrypt(sharedSecret).Parallel(8)
+//	result, err := pipeline.Run(ctx, payload)
+//	...
+//	payload, err = pipeline.Open(ctx, result.Fragments)
+
+// pipelineStage is a per-fragment step of a Pipeline
+type pipelineStage struct {
+	name    string
+	workers int
+	// forward transforms a fragment in Run, reverse undoes it in Open
+	forward, reverse func(Fragment) (Fragment, error)
+	// replacesData is set when forward never returns its input's Data, so
+	// the payload the fragments were cut from can be released after it
+	replacesData bool
+}
+
+// Pipeline chains payload and fragment processing steps. Build one with
+// NewPipeline and its chained methods; a misordered or misconfigured step
+// is reported by Run and Open as a wrapped ErrInvalidPipeline. A built
+// Pipeline can run many payloads concurrently.
+type Pipeline struct {
+	compress      bool
+	compressLevel int
+	fragmented    bool
+	fragmentOpts  []FragmentOption
+	stages        []*pipelineStage
+	err           error
+}
+
+// Pooled compression state
+var (
+	// flateWriters pools compressors, which each hold several hundred KiB
+	// of state, by level
+	flateWriters [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+
+	// compressBuffers pools the buffers payloads are compressed into
+	compressBuffers sync.Pool
+)
+
+// NewPipeline creates an empty pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// fail records the first building error
+func (p *Pipeline) fail(format string, args ...any) *Pipeline {
+	if p.err == nil {
+		p.err = fmt.Errorf("%w: "+format, append([]any{ErrInvalidPipeline}, args...)...)
+	}
+	return p
+}
+
+// Compress deflates the payload at level, one of the compress/flate levels,
+// before it is fragmented
+func (p *Pipeline) Compress(level int) *Pipeline {
+	switch {
+	case p.fragmented:
+		return p.fail("compression after fragmentation")
+	case p.compress:
+		return p.fail("payload compressed twice")
+	case level < flate.HuffmanOnly || level > flate.BestCompression:
+		return p.fail("compression level %d", level)
+	}
+	p.compress, p.compressLevel = true, level
+	return p
+}
+
+// Fragment splits the payload with opts, as FragmentData does. Fragment
+// stages added without it fragment with the defaults.
+func (p *Pipeline) Fragment(opts ...FragmentOption) *Pipeline {
+	if p.fragmented {
+		return p.fail("payload fragmented twice")
+	}
+	p.fragmented = true
+	p.fragmentOpts = opts
+	return p
+}
+
+// Hash replaces each fragment's checksum with committer's commitment to its
+// data, as FragmentDataWithCommitter does. Open checks the commitments.
+func (p *Pipeline) Hash(committer Committer) *Pipeline {
+	commitment := committerCommitment{committer}
+	return p.addStage(&pipelineStage{
+		name: "hash",
+		forward: func(fragment Fragment) (Fragment, error) {
+			checksum, err := commitment.commit(fragment)
+			fragment.Checksum = checksum
+			return fragment, err
+		},
+		reverse: func(fragment Fragment) (Fragment, error) {
+			if !commitment.verify(fragment) {
+				return Fragment{}, ErrReconstructionFailed
+			}
+			fragment.Checksum = fragmentChecksum(nil, fragment)
+			return fragment, nil
+		},
+	})
+}
+
+// Encrypt seals each fragment under a key derived from sharedSecret, as
+// EncryptFragments does. The pipeline keeps the derived key, not the
+// secret, which may be erased once Encrypt returns.
+func (p *Pipeline) Encrypt(sharedSecret SharedSecret) *Pipeline {
+	gcm, key, err := newFragmentCipher(sharedSecret)
+	if err != nil {
+		return p.fail("%w", err)
+	}
+	return p.addStage(&pipelineStage{
+		name: "encrypt",
+		forward: func(fragment Fragment) (Fragment, error) {
+			return sealFragment(gcm, key, fragment), nil
+		},
+		reverse: func(fragment Fragment) (Fragment, error) {
+			return openFragment(gcm, key, fragment)
+		},
+		replacesData: true,
+	})
+}
+
+// Stage adds a custom fragment step named name. forward runs in Run and
+// reverse, which may be nil for a step that needs no undoing, in Open. Both
+// may run concurrently on different fragments and must not keep Data.
+func (p *Pipeline) Stage(name string, forward, reverse func(Fragment) (Fragment, error)) *Pipeline {
+	if forward == nil {
+		return p.fail("stage %q has no forward step", name)
+	}
+	if reverse == nil {
+		reverse = func(fragment Fragment) (Fragment, error) { return fragment, nil }
+	}
+	return p.addStage(&pipelineStage{name: name, forward: forward, reverse: reverse})
+}
+
+// Parallel sets the number of goroutines the last fragment stage runs on;
+// it defaults to OptimalThreadCount
+func (p *Pipeline) Parallel(workers int) *Pipeline {
+	if len(p.stages) == 0 {
+		return p.fail("Parallel before a fragment stage")
+	}
+	if workers <= 0 {
+		return p.fail("parallelism %d", workers)
+	}
+	p.stages[len(p.stages)-1].workers = workers
+	return p
+}
+
+// addStage appends a fragment stage, fragmenting with the defaults first if
+// Fragment wasn't called
+func (p *Pipeline) addStage(stage *pipelineStage) *Pipeline {
+	p.fragmented = true
+	if stage.workers == 0 {
+		stage.workers = OptimalThreadCount()
+	}
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// Run passes data through the pipeline and returns the resulting fragments.
+// The metadata describes the payload as fragmented, compressed if the
+// pipeline compresses. ctx is checked between fragments; the first stage
+// error, or ctx's, stops the run.
+func (p *Pipeline) Run(ctx context.Context, data []byte) (FragmentationResult, error) {
+	if p.err != nil {
+		return FragmentationResult{}, p.err
+	}
+	if len(data) == 0 {
+		return FragmentationResult{}, ErrEmptyData
+	}
+
+	opts := append(p.fragmentOpts[:len(p.fragmentOpts):len(p.fragmentOpts)], WithContext(ctx))
+	payload := data
+	var compressed *bytes.Buffer
+	if p.compress {
+		var err error
+		if compressed, err = p.deflate(data); err != nil {
+			return FragmentationResult{}, err
+		}
+		// The compressed copy belongs to the pipeline, so fragments can
+		// share it rather than copy it again
+		payload = compressed.Bytes()
+		opts = append(opts, withSharedData())
+	}
+
+	result, err := fragmentData(payload, keyedCommitment{}, opts)
+	if err != nil {
+		releaseCompressBuffer(compressed)
+		return FragmentationResult{}, err
+	}
+
+	for _, stage := range p.stages {
+		if err := runPipelineStage(ctx, result.Fragments, stage.workers, stage.forward); err != nil {
+			return FragmentationResult{}, fmt.Errorf("%s: %w", stage.name, err)
+		}
+		if stage.replacesData {
+			// No fragment refers to the compressed payload any more
+			releaseCompressBuffer(compressed)
+			compressed = nil
+		}
+	}
+	return result, nil
+}
+
+// Open undoes Run: it reverses the fragment stages of fragments, in any
+// order, reconstructs the payload and decompresses it
+func (p *Pipeline) Open(ctx context.Context, fragments []Fragment) ([]byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(fragments) == 0 {
+		return nil, ErrEmptyData
+	}
+
+	opened := make([]Fragment, len(fragments))
+	copy(opened, fragments)
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		stage := p.stages[i]
+		if err := runPipelineStage(ctx, opened, stage.workers, stage.reverse); err != nil {
+			return nil, fmt.Errorf("%s: %w", stage.name, err)
+		}
+	}
+
+	result, err := ReconstructData(opened, WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if !p.compress {
+		return result.Data, nil
+	}
+	return inflate(result.Data)
+}
+
+// deflate compresses data into a pooled buffer
+func (p *Pipeline) deflate(data []byte) (*bytes.Buffer, error) {
+	buf, _ := compressBuffers.Get().(*bytes.Buffer)
+	if buf == nil {
+		buf = new(bytes.Buffer)
+	}
+	writers := &flateWriters[p.compressLevel-flate.HuffmanOnly]
+	writer, _ := writers.Get().(*flate.Writer)
+	if writer == nil {
+		var err error
+		if writer, err = flate.NewWriter(buf, p.compressLevel); err != nil {
+			return nil, err
+		}
+	} else {
+		writer.Reset(buf)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	writers.Put(writer)
+	return buf, nil
+}
+
+// releaseCompressBuffer returns a buffer from deflate to the pool
+func releaseCompressBuffer(buf *bytes.Buffer) {
+	if buf != nil {
+		buf.Reset()
+		compressBuffers.Put(buf)
+	}
+}
+
+// inflate decompresses a payload, refusing to expand it beyond
+// MaxFragmentedDataSize
+func inflate(compressed []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, int64(MaxFragmentedDataSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReconstructionFailed, err)
+	}
+	if uint64(len(data)) > MaxFragmentedDataSize {
+		return nil, &TooLargeError{Limit: "decompressed size", Size: uint64(len(data)), Max: MaxFragmentedDataSize}
+	}
+	return data, nil
+}
+
+// runPipelineStage replaces each fragment with step's result on up to
+// workers goroutines, stopping at the first error or when ctx ends
+func runPipelineStage(ctx context.Context, fragments []Fragment, workers int, step func(Fragment) (Fragment, error)) error {
+	workers = min(workers, len(fragments))
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	indices := make(chan int, len(fragments))
+	for i := range fragments {
+		indices <- i
+	}
+	close(indices)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if ctx.Err() != nil {
+					return
+				}
+				fragment, err := step(fragments[i])
+				if err != nil {
+					cancel(err)
+					return
+				}
+				fragments[i] = fragment
+			}
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
@@ -0,0 +1,72 @@
+package topayz512
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Guards around placeholder primitives
+//
+// Encapsulate and Decapsulate in kem.go, which take signing keys, are
+// placeholders: the shared secret is XORed with the public key bytes, so
+// anyone holding the public key can recover it. Every use reports a warning
+// through the hook below, and strict mode refuses it. KEMEncapsulate and
+// KEMDecapsulate are the real Module-LWE KEM and aren't guarded.
+
+// Placeholder primitive names passed to the warning hook
+const (
+	PlaceholderKEM = "kem"
+)
+
+var (
+	// strictMode makes placeholder primitives fail with ErrInsecurePlaceholder
+	strictMode atomic.Bool
+
+	// placeholderWarning holds the installed warning hook
+	placeholderWarning atomic.Pointer[func(primitive string)]
+
+	// placeholderWarned records the primitives already warned about
+	placeholderWarned sync.Map
+)
+
+// SetStrictMode makes placeholder primitives return ErrInsecurePlaceholder
+// instead of running. It returns a function restoring the previous mode.
+func SetStrictMode(strict bool) (restore func()) {
+	previous := strictMode.Swap(strict)
+	return func() { strictMode.Store(previous) }
+}
+
+// StrictMode reports whether placeholder primitives are refused
+func StrictMode() bool {
+	return strictMode.Load()
+}
+
+// SetPlaceholderWarning installs a hook called the first time each
+// placeholder primitive is used; nil removes it. It returns a function
+// restoring the previous hook.
+func SetPlaceholderWarning(warn func(primitive string)) (restore func()) {
+	var hook *func(primitive string)
+	if warn != nil {
+		hook = &warn
+	}
+	previous := placeholderWarning.Swap(hook)
+	placeholderWarned.Range(func(key, _ any) bool {
+		placeholderWarned.Delete(key)
+		return true
+	})
+	return func() { placeholderWarning.Store(previous) }
+}
+
+// checkPlaceholder refuses a placeholder primitive in strict mode and warns
+// about its first use otherwise
+func checkPlaceholder(primitive string) error {
+	if strictMode.Load() {
+		return ErrInsecurePlaceholder
+	}
+	if hook := placeholderWarning.Load(); hook != nil {
+		if _, warned := placeholderWarned.LoadOrStore(primitive, struct{}{}); !warned {
+			(*hook)(primitive)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Consistent and rendezvous hashing for shard placement
+
+// Placement constants
+const (
+	// DefaultVirtualNodes is the number of ring points per unit of node weight
+	DefaultVirtualNodes = 64
+
+	// placementRingDomain separates ring point hashes from other uses of the hash
+	placementRingDomain = "TOPAY-Z512-PLACEMENT-RING"
+
+	// placementRendezvousDomain separates rendezvous scores from other uses of the hash
+	placementRendezvousDomain = "TOPAY-Z512-PLACEMENT-HRW"
+)
+
+// PlacementNode is a storage node taking part in placement
+type PlacementNode struct {
+	ID     string `json:"id"`
+	Weight uint32 `json:"weight"`
+}
+
+// placementPoint derives a 64-bit position from a domain-separated hash.
+// Fields are length-prefixed so ("ab","c") and ("a","bc") never collide.
+func placementPoint(domain string, fields ...[]byte) uint64 {
+	hs := GetHashState()
+	defer PutHashState(hs)
+
+	var length [8]byte
+	hs.Update([]byte(domain))
+	for _, field := range fields {
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		hs.Update(length[:])
+		hs.Update(field)
+	}
+
+	digest := hs.Finalize()
+	return binary.BigEndian.Uint64(digest[:8])
+}
+
+// ringPoint is one virtual node position on the ring
+type ringPoint struct {
+	position uint64
+	node     string
+}
+
+// ConsistentHashRing places keys on weighted nodes so that adding or removing a
+// node only moves the keys that node gains or loses
+type ConsistentHashRing struct {
+	virtualNodes int
+	nodes        map[string]uint32
+	points       []ringPoint
+	mutex        sync.RWMutex
+}
+
+// NewConsistentHashRing creates an empty ring with virtualNodes points per unit weight
+func NewConsistentHashRing(virtualNodes int) *ConsistentHashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	return &ConsistentHashRing{
+		virtualNodes: virtualNodes,
+		nodes:        make(map[string]uint32),
+	}
+}
+
+// Add inserts or reweights a node; weight zero is treated as one
+func (chr *ConsistentHashRing) Add(id string, weight uint32) {
+	if weight == 0 {
+		weight = 1
+	}
+
+	chr.mutex.Lock()
+	defer chr.mutex.Unlock()
+
+	chr.nodes[id] = weight
+	chr.rebuild()
+}
+
+// Remove deletes a node from the ring
+func (chr *ConsistentHashRing) Remove(id string) {
+	chr.mutex.Lock()
+	defer chr.mutex.Unlock()
+
+	delete(chr.nodes, id)
+	chr.rebuild()
+}
+
+// Nodes returns the ring members sorted by ID
+func (chr *ConsistentHashRing) Nodes() []PlacementNode {
+	chr.mutex.RLock()
+	defer chr.mutex.RUnlock()
+
+	nodes := make([]PlacementNode, 0, len(chr.nodes))
+	for id, weight := range chr.nodes {
+		nodes = append(nodes, PlacementNode{ID: id, Weight: weight})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Locate returns the node owning key
+func (chr *ConsistentHashRing) Locate(key []byte) (string, error) {
+	nodes, err := chr.LocateN(key, 1)
+	if err != nil {
+		return "", err
+	}
+	return nodes[0], nil
+}
+
+// LocateN returns up to n distinct nodes for key in ring order, for replication
+func (chr *ConsistentHashRing) LocateN(key []byte, n int) ([]string, error) {
+	chr.mutex.RLock()
+	defer chr.mutex.RUnlock()
+
+	if len(chr.points) == 0 {
+		return nil, ErrNoNodes
+	}
+	if n > len(chr.nodes) {
+		n = len(chr.nodes)
+	}
+
+	position := placementPoint(placementRingDomain, []byte("key"), key)
+	start := sort.Search(len(chr.points), func(i int) bool { return chr.points[i].position >= position })
+
+	result := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; len(result) < n && i < len(chr.points); i++ {
+		point := chr.points[(start+i)%len(chr.points)]
+		if !seen[point.node] {
+			seen[point.node] = true
+			result = append(result, point.node)
+		}
+	}
+	return result, nil
+}
+
+// rebuild recomputes the sorted ring points; the caller holds the mutex
+func (chr *ConsistentHashRing) rebuild() {
+	chr.points = chr.points[:0]
+
+	var replica [4]byte
+	for id, weight := range chr.nodes {
+		count := int(weight) * chr.virtualNodes
+		for i := 0; i < count; i++ {
+			binary.BigEndian.PutUint32(replica[:], uint32(i))
+			chr.points = append(chr.points, ringPoint{
+				position: placementPoint(placementRingDomain, []byte("node"), []byte(id), replica[:]),
+				node:     id,
+			})
+		}
+	}
+
+	// Ties are broken by node ID so every implementation builds the same ring
+	sort.Slice(chr.points, func(i, j int) bool {
+		if chr.points[i].position != chr.points[j].position {
+			return chr.points[i].position < chr.points[j].position
+		}
+		return chr.points[i].node < chr.points[j].node
+	})
+}
+
+// consistentHashRingJSON is the serialized form of a ring
+type consistentHashRingJSON struct {
+	VirtualNodes int             `json:"virtual_nodes"`
+	Nodes        []PlacementNode `json:"nodes"`
+}
+
+// MarshalJSON serializes the ring configuration
+func (chr *ConsistentHashRing) MarshalJSON() ([]byte, error) {
+	chr.mutex.RLock()
+	virtualNodes := chr.virtualNodes
+	chr.mutex.RUnlock()
+
+	return json.Marshal(consistentHashRingJSON{
+		VirtualNodes: virtualNodes,
+		Nodes:        chr.Nodes(),
+	})
+}
+
+// UnmarshalJSON restores a ring configuration and rebuilds its points
+func (chr *ConsistentHashRing) UnmarshalJSON(data []byte) error {
+	var decoded consistentHashRingJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.VirtualNodes <= 0 {
+		decoded.VirtualNodes = DefaultVirtualNodes
+	}
+
+	chr.mutex.Lock()
+	defer chr.mutex.Unlock()
+
+	chr.virtualNodes = decoded.VirtualNodes
+	chr.nodes = make(map[string]uint32, len(decoded.Nodes))
+	for _, node := range decoded.Nodes {
+		weight := node.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		chr.nodes[node.ID] = weight
+	}
+	chr.rebuild()
+	return nil
+}
+
+// RendezvousScore returns the weighted highest-random-weight score of node for key
+func RendezvousScore(key []byte, node PlacementNode) float64 {
+	weight := node.Weight
+	if weight == 0 {
+		weight = 1
+	}
+
+	// Map the hash to (0, 1) and apply the logarithmic weighting method so a
+	// node's share of keys is proportional to its weight
+	point := placementPoint(placementRendezvousDomain, []byte(node.ID), key)
+	unit := (float64(point>>11) + 0.5) / float64(uint64(1)<<53)
+	return -float64(weight) / math.Log(unit)
+}
+
+// RendezvousRank returns the nodes ordered by descending score for key; the
+// first entry owns the key and the following ones are its replicas
+func RendezvousRank(key []byte, nodes []PlacementNode) []PlacementNode {
+	type scored struct {
+		node  PlacementNode
+		score float64
+	}
+
+	scores := make([]scored, len(nodes))
+	for i, node := range nodes {
+		scores[i] = scored{node: node, score: RendezvousScore(key, node)}
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score > scores[j].score
+		}
+		return scores[i].node.ID < scores[j].node.ID
+	})
+
+	ranked := make([]PlacementNode, len(nodes))
+	for i, entry := range scores {
+		ranked[i] = entry.node
+	}
+	return ranked
+}
+
+// RendezvousLocate returns the node with the highest score for key
+func RendezvousLocate(key []byte, nodes []PlacementNode) (PlacementNode, error) {
+	if len(nodes) == 0 {
+		return PlacementNode{}, ErrNoNodes
+	}
+	return RendezvousRank(key, nodes)[0], nil
+}
@@ -0,0 +1,349 @@
+package topayz512
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Declarative crypto policies
+//
+// A policy file lets fleet operators standardize settings without code
+// changes: which algorithms and parameter sets may be used, the weakest
+// password derivation accepted, the global worker pool size and where
+// placeholder warnings and KEM audit events are logged. Policies are JSON,
+// which YAML 1.2 parsers also read:
+//
+//	{
+//	  "version": 1,
+//	  "algorithms": ["topayz512-kem", "hybrid-kem", "xmss"],
+//	  "password": {"min_iterations": 3, "min_memory": 65536, "min_parallelism": 4},
+//	  "worker_pool_size": 8,
+//	  "logging": {"placeholder_warnings": "stderr", "kem_audit": "file:/var/log/kem.jsonl"}
+//	}
+//
+// LoadPolicy validates the whole file up front, reporting the line and
+// column of syntax errors and the field at fault otherwise. Apply installs
+// the package-wide parts; Allows, CheckAlgorithm and CheckPasswordParams let
+// applications consult the rest before using an algorithm or a stored
+// password derivation.
+
+// PolicyVersion is the current policy file format version
+const PolicyVersion = 1
+
+// maxPolicySize bounds the policy files LoadPolicy reads
+const maxPolicySize = 1 << 20
+
+// Algorithm names used in policies
+const (
+	AlgorithmKEM             = "topayz512-kem"
+	AlgorithmHybridKEM       = "hybrid-kem"
+	AlgorithmMLKEM768        = "ml-kem-768"
+	AlgorithmSignature       = "signature"
+	AlgorithmXMSS            = "xmss"
+	AlgorithmHybridSignature = "hybrid-signature"
+	// AlgorithmPlaceholder is the insecure Encapsulate/Decapsulate pair;
+	// policies not listing it turn on strict mode
+	AlgorithmPlaceholder = "placeholder"
+)
+
+// policyAlgorithms lists the algorithm names a policy may use
+var policyAlgorithms = []string{
+	AlgorithmKEM, AlgorithmHybridKEM, AlgorithmMLKEM768, AlgorithmSignature,
+	AlgorithmXMSS, AlgorithmHybridSignature, AlgorithmPlaceholder,
+}
+
+// Log sinks
+const (
+	// LogSinkNone discards the log; an empty sink means the same
+	LogSinkNone = "none"
+	// LogSinkStderr writes to standard error
+	LogSinkStderr = "stderr"
+	// LogSinkStdout writes to standard output
+	LogSinkStdout = "stdout"
+	// LogSinkFilePrefix starts a sink appending to a file, like file:/var/log/kem.jsonl
+	LogSinkFilePrefix = "file:"
+)
+
+// Policy is a parsed policy file
+type Policy struct {
+	Version int `json:"version"`
+	// Algorithms lists the algorithms that may be used; empty allows all
+	Algorithms []string `json:"algorithms,omitempty"`
+	// ParameterSets lists the parameter sets, as reported by ParameterSet,
+	// the policy may be loaded into; empty allows any
+	ParameterSets []string       `json:"parameter_sets,omitempty"`
+	Password      PasswordPolicy `json:"password"`
+	// WorkerPoolSize is the global worker pool's worker count; zero means
+	// OptimalThreadCount
+	WorkerPoolSize int           `json:"worker_pool_size,omitempty"`
+	Logging        LoggingPolicy `json:"logging"`
+}
+
+// PasswordPolicy is the weakest password derivation a policy accepts
+type PasswordPolicy struct {
+	// MinIterations, MinMemory (KiB) and MinParallelism bound Argon2id costs
+	MinIterations  uint32 `json:"min_iterations,omitempty"`
+	MinMemory      uint32 `json:"min_memory,omitempty"`
+	MinParallelism uint8  `json:"min_parallelism,omitempty"`
+	// AllowHashLoop accepts the legacy DeriveKeyFromPassword hash loop
+	AllowHashLoop bool `json:"allow_hash_loop,omitempty"`
+}
+
+// LoggingPolicy sets where logs go: LogSinkNone, LogSinkStderr,
+// LogSinkStdout or LogSinkFilePrefix followed by a path
+type LoggingPolicy struct {
+	// PlaceholderWarnings receives a line the first time each placeholder
+	// primitive is used
+	PlaceholderWarnings string `json:"placeholder_warnings,omitempty"`
+	// KEMAudit receives every KEMAuditEvent as a line of JSON
+	KEMAudit string `json:"kem_audit,omitempty"`
+}
+
+// LoadPolicy reads and validates a policy file. Errors match ErrInvalidPolicy
+// and name the line and column or the field at fault.
+func LoadPolicy(r io.Reader) (*Policy, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPolicySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPolicySize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidPolicy, maxPolicySize)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, policyDecodeError(data, decoder.InputOffset(), err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: %s: data after the policy object", ErrInvalidPolicy, policyPosition(data, decoder.InputOffset()))
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// policyDecodeError adds the position of a decoding error
+func policyDecodeError(data []byte, offset int64, err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		offset = syntaxError.Offset
+	case errors.As(err, &typeError):
+		return fmt.Errorf("%w: %s: %s must be %s, not %s", ErrInvalidPolicy,
+			policyPosition(data, typeError.Offset), typeError.Field, typeError.Type, typeError.Value)
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: empty policy", ErrInvalidPolicy)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrInvalidPolicy, policyPosition(data, offset), strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// policyPosition formats a byte offset as a line and column
+func policyPosition(data []byte, offset int64) string {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d, column %d", line, column)
+}
+
+// Validate checks every field, returning an error matching ErrInvalidPolicy
+// that names the first field at fault
+func (p *Policy) Validate() error {
+	if p.Version != PolicyVersion {
+		return fmt.Errorf("%w: version: unsupported version %d, expected %d", ErrInvalidPolicy, p.Version, PolicyVersion)
+	}
+	for i, name := range p.Algorithms {
+		if !containsString(policyAlgorithms, name) {
+			return fmt.Errorf("%w: algorithms[%d]: unknown algorithm %q, expected one of %s",
+				ErrInvalidPolicy, i, name, strings.Join(policyAlgorithms, ", "))
+		}
+	}
+	if len(p.ParameterSets) > 0 && !containsString(p.ParameterSets, ParameterSet()) {
+		return fmt.Errorf("%w: parameter_sets: this build's parameter set %s isn't allowed", ErrInvalidPolicy, ParameterSet())
+	}
+	if p.Password.MinMemory > MaxArgon2Memory {
+		return fmt.Errorf("%w: password.min_memory: %d KiB is above the maximum %d KiB", ErrInvalidPolicy, p.Password.MinMemory, MaxArgon2Memory)
+	}
+	if p.WorkerPoolSize < 0 {
+		return fmt.Errorf("%w: worker_pool_size: must not be negative", ErrInvalidPolicy)
+	}
+	if err := checkLogSink(p.Logging.PlaceholderWarnings); err != nil {
+		return fmt.Errorf("%w: logging.placeholder_warnings: %v", ErrInvalidPolicy, err)
+	}
+	if err := checkLogSink(p.Logging.KEMAudit); err != nil {
+		return fmt.Errorf("%w: logging.kem_audit: %v", ErrInvalidPolicy, err)
+	}
+	return nil
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLogSink validates a sink name
+func checkLogSink(sink string) error {
+	switch {
+	case sink == "" || sink == LogSinkNone || sink == LogSinkStderr || sink == LogSinkStdout:
+		return nil
+	case strings.HasPrefix(sink, LogSinkFilePrefix) && len(sink) > len(LogSinkFilePrefix):
+		return nil
+	}
+	return fmt.Errorf("unknown sink %q, expected none, stderr, stdout or file:<path>", sink)
+}
+
+// Allows reports whether the policy allows an algorithm
+func (p *Policy) Allows(algorithm string) bool {
+	return len(p.Algorithms) == 0 || containsString(p.Algorithms, algorithm)
+}
+
+// CheckAlgorithm returns an error matching ErrPolicyViolation unless the
+// policy allows an algorithm
+func (p *Policy) CheckAlgorithm(algorithm string) error {
+	if !p.Allows(algorithm) {
+		return fmt.Errorf("%w: algorithm %q isn't allowed", ErrPolicyViolation, algorithm)
+	}
+	return nil
+}
+
+// CheckPasswordParams returns an error matching ErrPolicyViolation if a
+// password derivation is weaker than the policy accepts, for instance to
+// refuse or upgrade a stored derivation
+func (p *Policy) CheckPasswordParams(params PasswordParams) error {
+	switch params.Algorithm {
+	case PasswordHashLoop:
+		if !p.Password.AllowHashLoop {
+			return fmt.Errorf("%w: the hash loop password derivation isn't allowed", ErrPolicyViolation)
+		}
+		return nil
+	case PasswordArgon2id:
+	default:
+		return fmt.Errorf("%w: unknown password algorithm %s", ErrPolicyViolation, params.Algorithm)
+	}
+	if params.Iterations < p.Password.MinIterations || params.Memory < p.Password.MinMemory || params.Parallelism < p.Password.MinParallelism {
+		return fmt.Errorf("%w: password derivation %s is weaker than t=%d, m=%d, p=%d", ErrPolicyViolation,
+			params, p.Password.MinIterations, p.Password.MinMemory, p.Password.MinParallelism)
+	}
+	return nil
+}
+
+// NewPasswordParams returns NewPasswordParams with each cost raised to the
+// policy's minimum
+func (p *Policy) NewPasswordParams() (PasswordParams, error) {
+	params, err := NewPasswordParams()
+	if err != nil {
+		return PasswordParams{}, err
+	}
+	if params.Iterations < p.Password.MinIterations {
+		params.Iterations = p.Password.MinIterations
+	}
+	if params.Memory < p.Password.MinMemory {
+		params.Memory = p.Password.MinMemory
+	}
+	if params.Parallelism < p.Password.MinParallelism {
+		params.Parallelism = p.Password.MinParallelism
+	}
+	return params, nil
+}
+
+// Apply installs the package-wide parts of the policy: strict mode unless
+// the placeholder primitives are allowed, the worker pool size and the log
+// sinks. It returns a function restoring the previous settings and closing
+// the sinks' files. Like ApplyRuntimeState it must not run concurrently with
+// other calls into the package, so apply at startup.
+func (p *Policy) Apply() (restore func(), err error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	placeholderSink, closePlaceholder, err := openLogSink(p.Logging.PlaceholderWarnings)
+	if err != nil {
+		return nil, err
+	}
+	auditSink, closeAudit, err := openLogSink(p.Logging.KEMAudit)
+	if err != nil {
+		closePlaceholder()
+		return nil, err
+	}
+
+	restoreStrict := SetStrictMode(!p.Allows(AlgorithmPlaceholder))
+	var warn func(primitive string)
+	if placeholderSink != nil {
+		var mutex sync.Mutex
+		warn = func(primitive string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			fmt.Fprintf(placeholderSink, "topayz512: insecure placeholder %s used\n", primitive)
+		}
+	}
+	restoreWarning := SetPlaceholderWarning(warn)
+	var recorder KEMAuditRecorder
+	if auditSink != nil {
+		recorder = &jsonAuditRecorder{encoder: json.NewEncoder(auditSink)}
+	}
+	restoreAudit := SetKEMAuditRecorder(recorder)
+
+	previousPoolSize := globalWorkerPoolSize
+	if p.WorkerPoolSize != globalWorkerPoolSize {
+		globalWorkerPoolSize = p.WorkerPoolSize
+		CleanupGlobalPools()
+	}
+
+	return func() {
+		restoreAudit()
+		restoreWarning()
+		restoreStrict()
+		closeAudit()
+		closePlaceholder()
+		if globalWorkerPoolSize != previousPoolSize {
+			globalWorkerPoolSize = previousPoolSize
+			CleanupGlobalPools()
+		}
+	}, nil
+}
+
+// openLogSink opens a validated sink, returning a nil writer for none
+func openLogSink(sink string) (io.Writer, func(), error) {
+	switch sink {
+	case "", LogSinkNone:
+		return nil, func() {}, nil
+	case LogSinkStderr:
+		return os.Stderr, func() {}, nil
+	case LogSinkStdout:
+		return os.Stdout, func() {}, nil
+	}
+	file, err := os.OpenFile(strings.TrimPrefix(sink, LogSinkFilePrefix), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() { file.Close() }, nil
+}
+
+// jsonAuditRecorder writes KEM audit events as lines of JSON
+type jsonAuditRecorder struct {
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// RecordKEMOperation implements KEMAuditRecorder
+func (r *jsonAuditRecorder) RecordKEMOperation(event KEMAuditEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.encoder.Encode(event)
+}
@@ -1,51 +1,94 @@
 package topayz512
 
 import (
+	"context"
+	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 )
 
 // Memory pool management for high-performance operations
 
-// BytePool manages reusable byte slices to reduce GC pressure
+// PoolStats reports a pool's use since it was created
+type PoolStats struct {
+	// Gets counts objects taken from the pool
+	Gets uint64 `json:"gets"`
+	// Hits counts the Gets served with a pooled object rather than a new one
+	Hits uint64 `json:"hits"`
+	// Puts counts objects returned to the pool
+	Puts uint64 `json:"puts"`
+	// BytesPooled is the size of the buffers a BytePool holds. The runtime
+	// drops pooled objects during garbage collection without telling the
+	// pool, so it is an upper bound.
+	BytesPooled int64 `json:"bytes_pooled,omitempty"`
+}
+
+// HitRate returns the fraction of Gets that were hits, or zero before the
+// first Get
+func (ps PoolStats) HitRate() float64 {
+	if ps.Gets == 0 {
+		return 0
+	}
+	return float64(ps.Hits) / float64(ps.Gets)
+}
+
+// poolCounters are the atomic counters behind PoolStats
+type poolCounters struct {
+	gets        atomic.Uint64
+	hits        atomic.Uint64
+	puts        atomic.Uint64
+	bytesPooled atomic.Int64
+}
+
+// stats returns a snapshot of the counters
+func (pc *poolCounters) stats() PoolStats {
+	return PoolStats{
+		Gets:        pc.gets.Load(),
+		Hits:        pc.hits.Load(),
+		Puts:        pc.puts.Load(),
+		BytesPooled: pc.bytesPooled.Load(),
+	}
+}
+
+// BytePool manages reusable byte slices to reduce GC pressure. Each pool owns
+// all of its buffers, so separate pools never hand out each other's memory.
 type BytePool struct {
-	pools map[int]*sync.Pool
-	mutex sync.RWMutex
+	small    [len(bytePoolClasses)]*sync.Pool
+	pools    map[int]*sync.Pool
+	mutex    sync.RWMutex
+	counters poolCounters
 }
 
-// Global byte pools for common sizes
-var (
-	globalBytePool = NewBytePool()
+// bytePoolClasses are the common sizes served from pre-defined pools
+var bytePoolClasses = [...]int{64, 256, 1024, 4096}
 
-	// Pre-defined pools for common sizes
-	pool64   = &sync.Pool{New: func() interface{} { return make([]byte, 64) }}
-	pool256  = &sync.Pool{New: func() interface{} { return make([]byte, 256) }}
-	pool1024 = &sync.Pool{New: func() interface{} { return make([]byte, 1024) }}
-	pool4096 = &sync.Pool{New: func() interface{} { return make([]byte, 4096) }}
-)
+// Global byte pool
+var globalBytePool = NewBytePool()
 
 // NewBytePool creates a new byte pool manager
 func NewBytePool() *BytePool {
-	return &BytePool{
+	bp := &BytePool{
 		pools: make(map[int]*sync.Pool),
 	}
+	for i := range bytePoolClasses {
+		bp.small[i] = &sync.Pool{}
+	}
+	return bp
 }
 
 // Get retrieves a byte slice from the pool
 func (bp *BytePool) Get(size int) []byte {
+	bp.counters.gets.Add(1)
+	if injectFault(FaultPool) != nil {
+		return make([]byte, size)
+	}
+
 	// Use pre-defined pools for common sizes
-	switch {
-	case size <= 64:
-		buf := pool64.Get().([]byte)
-		return buf[:size]
-	case size <= 256:
-		buf := pool256.Get().([]byte)
-		return buf[:size]
-	case size <= 1024:
-		buf := pool1024.Get().([]byte)
-		return buf[:size]
-	case size <= 4096:
-		buf := pool4096.Get().([]byte)
-		return buf[:size]
+	for i, class := range bytePoolClasses {
+		if size <= class {
+			return bp.take(bp.small[i], class)[:size]
+		}
 	}
 
 	// For larger or uncommon sizes, use dynamic pools
@@ -57,17 +100,24 @@ func (bp *BytePool) Get(size int) []byte {
 		bp.mutex.Lock()
 		// Double-check after acquiring write lock
 		if pool, exists = bp.pools[size]; !exists {
-			pool = &sync.Pool{
-				New: func() interface{} {
-					return make([]byte, size)
-				},
-			}
+			pool = &sync.Pool{}
 			bp.pools[size] = pool
 		}
 		bp.mutex.Unlock()
 	}
 
-	return pool.Get().([]byte)
+	return bp.take(pool, size)
+}
+
+// take returns a pooled buffer of size bytes, or a new one if pool is empty
+func (bp *BytePool) take(pool *sync.Pool, size int) []byte {
+	if pooled := pool.Get(); pooled != nil {
+		buf := pooled.([]byte)
+		bp.counters.hits.Add(1)
+		bp.counters.bytesPooled.Add(-int64(cap(buf)))
+		return buf
+	}
+	return make([]byte, size)
 }
 
 // Put returns a byte slice to the pool
@@ -79,24 +129,17 @@ func (bp *BytePool) Put(buf []byte) {
 	size := cap(buf)
 
 	// Clear the buffer for security
+	buf = buf[:size]
 	for i := range buf {
 		buf[i] = 0
 	}
 
 	// Use pre-defined pools for common sizes
-	switch {
-	case size == 64:
-		pool64.Put(buf[:64])
-		return
-	case size == 256:
-		pool256.Put(buf[:256])
-		return
-	case size == 1024:
-		pool1024.Put(buf[:1024])
-		return
-	case size == 4096:
-		pool4096.Put(buf[:4096])
-		return
+	for i, class := range bytePoolClasses {
+		if size == class {
+			bp.give(bp.small[i], buf)
+			return
+		}
 	}
 
 	// For larger or uncommon sizes, use dynamic pools
@@ -105,11 +148,23 @@ func (bp *BytePool) Put(buf []byte) {
 	bp.mutex.RUnlock()
 
 	if exists {
-		pool.Put(buf)
+		bp.give(pool, buf)
 	}
 	// If pool doesn't exist, just let GC handle it
 }
 
+// give returns a cleared buffer to pool
+func (bp *BytePool) give(pool *sync.Pool, buf []byte) {
+	bp.counters.puts.Add(1)
+	bp.counters.bytesPooled.Add(int64(cap(buf)))
+	pool.Put(buf)
+}
+
+// Stats returns the pool's usage counters
+func (bp *BytePool) Stats() PoolStats {
+	return bp.counters.stats()
+}
+
 // GetBuffer is a convenience function using the global pool
 func GetBuffer(size int) []byte {
 	return globalBytePool.Get(size)
@@ -122,23 +177,29 @@ func PutBuffer(buf []byte) {
 
 // HashStatePool manages reusable hash states
 type HashStatePool struct {
-	pool sync.Pool
+	pool     sync.Pool
+	counters poolCounters
 }
 
 // NewHashStatePool creates a new hash state pool
 func NewHashStatePool() *HashStatePool {
-	return &HashStatePool{
-		pool: sync.Pool{
-			New: func() interface{} {
-				return NewHashState()
-			},
-		},
-	}
+	return &HashStatePool{}
 }
 
 // Get retrieves a hash state from the pool
 func (hsp *HashStatePool) Get() *HashState {
-	hs := hsp.pool.Get().(*HashState)
+	hsp.counters.gets.Add(1)
+	if injectFault(FaultPool) != nil {
+		return NewHashState()
+	}
+
+	pooled := hsp.pool.Get()
+	if pooled == nil {
+		return NewHashState()
+	}
+	hsp.counters.hits.Add(1)
+	hs := pooled.(*HashState)
+	hs.personal = nil
 	hs.Reset()
 	return hs
 }
@@ -146,11 +207,18 @@ func (hsp *HashStatePool) Get() *HashState {
 // Put returns a hash state to the pool
 func (hsp *HashStatePool) Put(hs *HashState) {
 	if hs != nil {
+		hs.personal = nil
 		hs.Reset() // Clear state for security
+		hsp.counters.puts.Add(1)
 		hsp.pool.Put(hs)
 	}
 }
 
+// Stats returns the pool's usage counters
+func (hsp *HashStatePool) Stats() PoolStats {
+	return hsp.counters.stats()
+}
+
 // Global hash state pool
 var globalHashStatePool = NewHashStatePool()
 
@@ -164,28 +232,104 @@ func PutHashState(hs *HashState) {
 	globalHashStatePool.Put(hs)
 }
 
-// WorkerPool manages a pool of worker goroutines
+// WorkerPoolOptions configures a WorkerPool
+type WorkerPoolOptions struct {
+	// Workers is the number of worker goroutines; zero uses OptimalThreadCount
+	Workers int
+	// QueueSize bounds the tasks waiting for a worker, beyond which Submit
+	// blocks; zero uses twice Workers
+	QueueSize int
+	// OnPanic is called with each recovered task panic, on the goroutine
+	// that ran the task; nil only counts them in WorkerPoolStats.Panics
+	OnPanic func(err *PanicError)
+}
+
+// PanicError is a panic recovered from a worker pool task
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the panicking goroutine's stack trace
+	Stack []byte
+}
+
+// Error implements error
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrWorkerPanic, e.Value)
+}
+
+// Unwrap returns ErrWorkerPanic
+func (e *PanicError) Unwrap() error {
+	return ErrWorkerPanic
+}
+
+// WorkerPoolStats reports a worker pool's load
+type WorkerPoolStats struct {
+	Workers int `json:"workers"`
+	// QueueDepth is the number of tasks waiting for a worker
+	QueueDepth int `json:"queue_depth"`
+	// QueueCapacity is the queue bound
+	QueueCapacity int `json:"queue_capacity"`
+	// Busy is the number of tasks running
+	Busy int `json:"busy"`
+	// Completed counts finished tasks, including those that panicked
+	Completed uint64 `json:"completed"`
+	// Panics counts tasks that panicked
+	Panics uint64 `json:"panics"`
+}
+
+// WorkerPool manages a pool of worker goroutines. A task that panics is
+// recovered and reported to WorkerPoolOptions.OnPanic, and its worker
+// carries on.
 type WorkerPool struct {
-	workers   int
-	workChan  chan func()
-	closeChan chan struct{}
-	wg        sync.WaitGroup
+	workers  int
+	workChan chan func()
+	onPanic  func(err *PanicError)
+	wg       sync.WaitGroup
+
+	// closed is set by Close under mutex; submitting counts the Submits
+	// that saw it unset and may still send to workChan
+	closed     bool
+	submitting sync.WaitGroup
+	mutex      sync.RWMutex
+
+	// pending counts tasks queued or running; idle is closed when it
+	// falls to zero
+	pending      int
+	idle         chan struct{}
+	pendingMutex sync.Mutex
+
+	busy      atomic.Int64
+	completed atomic.Uint64
+	panics    atomic.Uint64
 }
 
 // NewWorkerPool creates a new worker pool
 func NewWorkerPool(workers int) *WorkerPool {
-	if workers <= 0 {
-		workers = OptimalThreadCount()
+	return NewWorkerPoolWithOptions(&WorkerPoolOptions{Workers: workers})
+}
+
+// NewWorkerPoolWithOptions creates a worker pool; nil options use the
+// defaults
+func NewWorkerPoolWithOptions(opts *WorkerPoolOptions) *WorkerPool {
+	var options WorkerPoolOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.Workers <= 0 {
+		options.Workers = OptimalThreadCount()
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = options.Workers * 2
 	}
 
 	wp := &WorkerPool{
-		workers:   workers,
-		workChan:  make(chan func(), workers*2), // Buffered channel
-		closeChan: make(chan struct{}),
+		workers:  options.Workers,
+		workChan: make(chan func(), options.QueueSize),
+		onPanic:  options.OnPanic,
 	}
 
 	// Start workers
-	for i := 0; i < workers; i++ {
+	for i := 0; i < options.Workers; i++ {
 		wp.wg.Add(1)
 		go wp.worker()
 	}
@@ -193,58 +337,248 @@ func NewWorkerPool(workers int) *WorkerPool {
 	return wp
 }
 
-// worker is the main worker goroutine
+// worker is the main worker goroutine, running tasks until Close closes
+// the queue and it is empty
 func (wp *WorkerPool) worker() {
 	defer wp.wg.Done()
 
-	for {
-		select {
-		case work := <-wp.workChan:
-			work()
-		case <-wp.closeChan:
-			return
+	for work := range wp.workChan {
+		wp.run(work)
+	}
+}
+
+// run runs a task taken by begin, recovering and reporting a panic
+func (wp *WorkerPool) run(work func()) {
+	wp.busy.Add(1)
+	defer func() {
+		wp.busy.Add(-1)
+		wp.completed.Add(1)
+		wp.end()
+	}()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			wp.panics.Add(1)
+			if wp.onPanic != nil {
+				wp.onPanic(&PanicError{Value: recovered, Stack: debug.Stack()})
+			}
 		}
+	}()
+	work()
+}
+
+// begin counts a task as pending
+func (wp *WorkerPool) begin() {
+	wp.pendingMutex.Lock()
+	if wp.pending == 0 {
+		wp.idle = make(chan struct{})
+	}
+	wp.pending++
+	wp.pendingMutex.Unlock()
+}
+
+// end counts a pending task as done
+func (wp *WorkerPool) end() {
+	wp.pendingMutex.Lock()
+	wp.pending--
+	if wp.pending == 0 {
+		close(wp.idle)
+	}
+	wp.pendingMutex.Unlock()
+}
+
+// enter registers a submission, reporting false once the pool is closed
+func (wp *WorkerPool) enter() bool {
+	wp.mutex.RLock()
+	defer wp.mutex.RUnlock()
+	if wp.closed {
+		return false
 	}
+	wp.submitting.Add(1)
+	wp.begin()
+	return true
 }
 
-// Submit submits work to the pool
+// Submit submits work to the pool, blocking while the queue is full. Once
+// the pool is closed, work runs on the calling goroutine instead.
 func (wp *WorkerPool) Submit(work func()) {
+	if injectFault(FaultPool) != nil || !wp.enter() {
+		wp.begin()
+		wp.run(work)
+		return
+	}
+	defer wp.submitting.Done()
+	wp.workChan <- work
+}
+
+// SubmitContext submits work like Submit, but gives up with ctx's error if
+// ctx ends while the queue is full
+func (wp *WorkerPool) SubmitContext(ctx context.Context, work func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if injectFault(FaultPool) != nil || !wp.enter() {
+		wp.begin()
+		wp.run(work)
+		return nil
+	}
+	defer wp.submitting.Done()
+	select {
+	case wp.workChan <- work:
+		return nil
+	case <-ctx.Done():
+		wp.end()
+		return ctx.Err()
+	}
+}
+
+// TrySubmit queues work if there is room, reporting false without running
+// it if the queue is full or the pool is closed
+func (wp *WorkerPool) TrySubmit(work func()) bool {
+	if !wp.enter() {
+		return false
+	}
+	defer wp.submitting.Done()
 	select {
 	case wp.workChan <- work:
-	case <-wp.closeChan:
-		// Pool is closed, execute work directly
-		work()
+		return true
+	default:
+		wp.end()
+		return false
 	}
 }
 
-// Close closes the worker pool
+// Drain waits until no tasks are queued or running, or returns ctx's error
+// if ctx ends first. The pool stays open, so tasks submitted meanwhile are
+// waited for too.
+func (wp *WorkerPool) Drain(ctx context.Context) error {
+	wp.pendingMutex.Lock()
+	if wp.pending == 0 {
+		wp.pendingMutex.Unlock()
+		return nil
+	}
+	idle := wp.idle
+	wp.pendingMutex.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// QueueDepth returns the number of submitted tasks waiting for a worker
+func (wp *WorkerPool) QueueDepth() int {
+	return len(wp.workChan)
+}
+
+// Stats returns the pool's current load and counters
+func (wp *WorkerPool) Stats() WorkerPoolStats {
+	return WorkerPoolStats{
+		Workers:       wp.workers,
+		QueueDepth:    len(wp.workChan),
+		QueueCapacity: cap(wp.workChan),
+		Busy:          int(wp.busy.Load()),
+		Completed:     wp.completed.Load(),
+		Panics:        wp.panics.Load(),
+	}
+}
+
+// Close stops accepting work, runs the tasks already queued and waits for
+// the workers to exit. Submits racing with Close either queue their task
+// before the queue closes or run it themselves. Closing again just waits.
 func (wp *WorkerPool) Close() {
-	close(wp.closeChan)
+	wp.mutex.Lock()
+	closed := wp.closed
+	wp.closed = true
+	wp.mutex.Unlock()
+
+	if !closed {
+		wp.submitting.Wait()
+		close(wp.workChan)
+	}
 	wp.wg.Wait()
 }
 
-// Global worker pool
-var globalWorkerPool *WorkerPool
+// Global worker pool; atomic so metrics can read it while work is submitted
+var globalWorkerPool atomic.Pointer[WorkerPool]
+
+// hashStatesAllocated counts NewHashState calls for PoolMetrics
+var hashStatesAllocated atomic.Uint64
+
+// globalWorkerPoolSize is the global worker pool's worker count; zero means
+// OptimalThreadCount
+var globalWorkerPoolSize int
 
 // InitializeGlobalPools initializes global pools
 func InitializeGlobalPools() {
-	if globalWorkerPool == nil {
-		globalWorkerPool = NewWorkerPool(OptimalThreadCount())
+	if globalWorkerPool.Load() == nil {
+		pool := NewWorkerPool(globalWorkerPoolSize)
+		if !globalWorkerPool.CompareAndSwap(nil, pool) {
+			pool.Close()
+		}
 	}
 }
 
 // SubmitWork submits work to the global worker pool
 func SubmitWork(work func()) {
-	if globalWorkerPool == nil {
+	for {
+		if pool := globalWorkerPool.Load(); pool != nil {
+			pool.Submit(work)
+			return
+		}
 		InitializeGlobalPools()
 	}
-	globalWorkerPool.Submit(work)
+}
+
+// PoolMetrics reports the use of the package-wide pools, for spotting
+// memory pathologies in long-running processes: a falling hit rate means
+// pooled objects aren't returned or are dropped by the garbage collector,
+// and a growing count of hash states in use means states taken with
+// GetHashState aren't released with PutHashState.
+type PoolMetrics struct {
+	// BytePool covers GetBuffer and PutBuffer
+	BytePool PoolStats `json:"byte_pool"`
+	// HashStatePool covers GetHashState and PutHashState, which every
+	// one-shot hash function uses
+	HashStatePool PoolStats `json:"hash_state_pool"`
+	// HashStatesAllocated counts the hash states NewHashState has created,
+	// including those filling pool misses
+	HashStatesAllocated uint64 `json:"hash_states_allocated"`
+	// HashStatesInUse is the number of hash states taken from the global
+	// pool and not yet returned
+	HashStatesInUse int64 `json:"hash_states_in_use"`
+	// WorkerQueueDepth is the number of tasks waiting for the global worker
+	// pool
+	WorkerQueueDepth int `json:"worker_queue_depth"`
+	// WorkersBusy is the number of global worker pool tasks running
+	WorkersBusy int `json:"workers_busy"`
+	// WorkerPanics counts global worker pool tasks that panicked
+	WorkerPanics uint64 `json:"worker_panics,omitempty"`
+}
+
+// ReadPoolMetrics returns the current metrics of the package-wide pools.
+// It doesn't stop the world and is cheap enough to call on every scrape.
+func ReadPoolMetrics() PoolMetrics {
+	hashStates := globalHashStatePool.Stats()
+	metrics := PoolMetrics{
+		BytePool:            globalBytePool.Stats(),
+		HashStatePool:       hashStates,
+		HashStatesAllocated: hashStatesAllocated.Load(),
+		HashStatesInUse:     int64(hashStates.Gets) - int64(hashStates.Puts),
+	}
+	if pool := globalWorkerPool.Load(); pool != nil {
+		stats := pool.Stats()
+		metrics.WorkerQueueDepth = stats.QueueDepth
+		metrics.WorkersBusy = stats.Busy
+		metrics.WorkerPanics = stats.Panics
+	}
+	return metrics
 }
 
 // CleanupGlobalPools cleans up global pools
 func CleanupGlobalPools() {
-	if globalWorkerPool != nil {
-		globalWorkerPool.Close()
-		globalWorkerPool = nil
+	if pool := globalWorkerPool.Swap(nil); pool != nil {
+		pool.Close()
 	}
 }
@@ -0,0 +1,7 @@
+//go:build race
+
+package topayz512
+
+func init() {
+	raceEnabled = true
+}
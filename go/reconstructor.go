@@ -0,0 +1,543 @@
+package topayz512
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Incremental reconstruction and multiplexed fragment streams
+
+// fragmentStore holds the verified fragments of a Reconstructor
+type fragmentStore interface {
+	// put stores a verified fragment not received before
+	put(fragment Fragment) error
+	// result assembles the complete payload
+	result(total uint32) (ReconstructionResult, error)
+	// close releases the store's resources
+	close() error
+}
+
+// Reconstructor collects the fragments of one payload as they arrive, in any
+// order, verifying each on receipt
+type Reconstructor struct {
+	id       ID
+	total    uint32
+	started  bool
+	key      *FragmentKey
+	store    fragmentStore
+	received []uint64
+	count    uint32
+	mutex    sync.Mutex
+}
+
+// NewMemoryReconstructor creates a reconstructor buffering fragments in
+// memory. Checksums are keyed with key; nil key checks plain checksums.
+func NewMemoryReconstructor(key *FragmentKey) *Reconstructor {
+	return &Reconstructor{key: key, store: &memoryFragmentStore{}}
+}
+
+// NewFileReconstructor creates a reconstructor writing each verified fragment
+// straight to its offset in the file at path, so payloads larger than memory
+// can be received. metadata is the sender's FragmentMetadata: its
+// OriginalSize fixes the layout and its Checksum is verified when the payload
+// completes. The file is created sparse at full size and left in place.
+func NewFileReconstructor(path string, metadata FragmentMetadata, key *FragmentKey) (*Reconstructor, error) {
+	if metadata.OriginalSize == 0 {
+		return nil, ErrEmptyData
+	}
+	if metadata.OriginalSize > MaxFragmentedDataSize {
+		return nil, &TooLargeError{Limit: "fragmented data size", Size: metadata.OriginalSize, Max: MaxFragmentedDataSize}
+	}
+	fragmentSize, ok := fragmentLayout(metadata.OriginalSize, metadata.FragmentCount, metadata.FragmentSize)
+	if !ok {
+		return nil, ErrInvalidFragmentCount
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(int64(metadata.OriginalSize)); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Reconstructor{
+		total: metadata.FragmentCount,
+		key:   key,
+		store: &fileFragmentStore{file: file, metadata: metadata, fragmentSize: fragmentSize},
+	}, nil
+}
+
+// NewReconstructor creates a reconstructor writing the payload to w in order
+// as it becomes contiguous: each verified fragment extending the written
+// prefix is written at once, and fragments arriving ahead of a gap are held
+// in memory until it fills. Result returns the payload's metadata and
+// checksum rather than its Data. A write error fails the Add that caused it
+// and every later one. Checksums are keyed with key; nil key checks plain
+// checksums.
+func NewReconstructor(w io.Writer, key *FragmentKey) *Reconstructor {
+	return &Reconstructor{key: key, store: &writerFragmentStore{w: w, hash: NewHashState()}}
+}
+
+// fragmentLayout returns the fragment size of a payload of originalSize bytes
+// in total fragments, and whether FragmentData produces that layout. A
+// fragmentSize from the sender's metadata allows layouts chosen with
+// FragmentOptions; zero expects the default layout.
+func fragmentLayout(originalSize uint64, total, fragmentSize uint32) (int, bool) {
+	if fragmentSize == 0 {
+		count := uint64(CalculateFragmentCount(int(originalSize)))
+		size := (originalSize + count - 1) / count
+		return int(size), (originalSize+size-1)/size == uint64(total)
+	}
+	size, ok := evenFragmentLayout(originalSize, total)
+	return size, ok && size == int(fragmentSize)
+}
+
+// evenFragmentLayout returns the fragment size of a payload of originalSize
+// bytes in total fragments under any FragmentOptions: evening fragments out
+// always gives the size originalSize / total rounded up. It reports whether
+// that size splits the payload into exactly total fragments.
+func evenFragmentLayout(originalSize uint64, total uint32) (int, bool) {
+	if total == 0 || uint64(total) > originalSize {
+		return 0, false
+	}
+	size := (originalSize + uint64(total) - 1) / uint64(total)
+	return int(size), (originalSize+size-1)/size == uint64(total)
+}
+
+// Add verifies a fragment and stores it, reporting whether the payload is now
+// complete. Fragments already received are ignored.
+func (r *Reconstructor) Add(fragment Fragment) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// The first fragment fixes the payload only once it verifies, so a
+	// forged one can't take the payload over
+	if !r.started {
+		if fragment.Total == 0 || fragment.Total > MaxFragments || (r.total != 0 && fragment.Total != r.total) {
+			return false, ErrInvalidFragmentCount
+		}
+	} else if fragment.ID != r.id || fragment.Total != r.total {
+		return false, ErrReconstructionFailed
+	}
+	if fragment.Index >= fragment.Total {
+		return false, ErrInvalidFragmentIndex
+	}
+	if !HashEqual(fragmentChecksum(r.key, fragment), fragment.Checksum) {
+		return false, ErrReconstructionFailed
+	}
+	if !r.started {
+		r.id = fragment.ID
+		r.total = fragment.Total
+		r.received = make([]uint64, (fragment.Total+63)/64)
+		r.started = true
+	}
+
+	word, bit := fragment.Index/64, uint64(1)<<(fragment.Index%64)
+	if r.received[word]&bit == 0 {
+		if err := r.store.put(fragment); err != nil {
+			return false, err
+		}
+		r.received[word] |= bit
+		r.count++
+	}
+	return r.count == r.total, nil
+}
+
+// ID returns the fragment ID of the payload, zero before the first fragment
+func (r *Reconstructor) ID() ID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.id
+}
+
+// Complete reports whether every fragment has been received
+func (r *Reconstructor) Complete() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.started && r.count == r.total
+}
+
+// Missing returns the indices not yet received
+func (r *Reconstructor) Missing() []uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.missing()
+}
+
+// missing returns the indices not yet received; the mutex must be held
+func (r *Reconstructor) missing() []uint32 {
+	var missing []uint32
+	for index := uint32(0); index < r.total; index++ {
+		if !r.started || r.received[index/64]&(1<<(index%64)) == 0 {
+			missing = append(missing, index)
+		}
+	}
+	return missing
+}
+
+// Result assembles the payload once every fragment has been received. A file
+// reconstructor instead verifies the file against the metadata checksum and
+// returns no Data. Before then it returns ErrReconstructionIncomplete with
+// the missing indices.
+func (r *Reconstructor) Result() (ReconstructionResult, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.started || r.count != r.total {
+		return ReconstructionResult{MissingCount: r.total - r.count, MissingIndices: r.missing()}, ErrReconstructionIncomplete
+	}
+	return r.store.result(r.total)
+}
+
+// Close releases the reconstructor's resources, such as its open file
+func (r *Reconstructor) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.store.close()
+}
+
+// memoryFragmentStore buffers fragments in memory
+type memoryFragmentStore struct {
+	fragments map[uint32]Fragment
+}
+
+func (ms *memoryFragmentStore) put(fragment Fragment) error {
+	if ms.fragments == nil {
+		ms.fragments = make(map[uint32]Fragment)
+	}
+	ms.fragments[fragment.Index] = fragment
+	return nil
+}
+
+func (ms *memoryFragmentStore) result(total uint32) (ReconstructionResult, error) {
+	var totalSize int
+	for _, fragment := range ms.fragments {
+		totalSize += len(fragment.Data)
+	}
+
+	data := make([]byte, 0, totalSize)
+	for index := uint32(0); index < total; index++ {
+		data = append(data, ms.fragments[index].Data...)
+	}
+
+	return ReconstructionResult{
+		Data:       data,
+		IsComplete: true,
+		Metadata: FragmentMetadata{
+			OriginalSize:  uint64(len(data)),
+			FragmentCount: total,
+			Timestamp:     time.Now(),
+			Algorithm:     "TOPAY-Z512",
+			Checksum:      ComputeHash(data),
+		},
+	}, nil
+}
+
+func (ms *memoryFragmentStore) close() error {
+	ms.fragments = nil
+	return nil
+}
+
+// fileFragmentStore writes fragments at their offsets in a file
+type fileFragmentStore struct {
+	file         *os.File
+	metadata     FragmentMetadata
+	fragmentSize int
+}
+
+func (fs *fileFragmentStore) put(fragment Fragment) error {
+	if fs.file == nil {
+		return os.ErrClosed
+	}
+	if len(fragment.Data) != expectedFragmentSize(int(fragment.Index), fs.fragmentSize, fs.metadata.OriginalSize) {
+		return ErrReconstructionFailed
+	}
+	_, err := fs.file.WriteAt(fragment.Data, int64(fragment.Index)*int64(fs.fragmentSize))
+	return err
+}
+
+func (fs *fileFragmentStore) result(total uint32) (ReconstructionResult, error) {
+	if fs.file == nil {
+		return ReconstructionResult{}, os.ErrClosed
+	}
+	if err := fs.file.Sync(); err != nil {
+		return ReconstructionResult{}, err
+	}
+
+	sh := NewStreamingHash()
+	defer sh.Close()
+
+	if _, err := io.Copy(sh, io.NewSectionReader(fs.file, 0, int64(fs.metadata.OriginalSize))); err != nil {
+		return ReconstructionResult{}, err
+	}
+	checksum := sh.Sum()
+	if !HashEqual(checksum, fs.metadata.Checksum) {
+		return ReconstructionResult{}, ErrReconstructionFailed
+	}
+
+	return ReconstructionResult{
+		IsComplete: true,
+		Metadata: FragmentMetadata{
+			OriginalSize:  fs.metadata.OriginalSize,
+			FragmentCount: total,
+			Timestamp:     time.Now(),
+			Algorithm:     "TOPAY-Z512",
+			Checksum:      checksum,
+		},
+	}, nil
+}
+
+func (fs *fileFragmentStore) close() error {
+	if fs.file == nil {
+		return nil
+	}
+	err := fs.file.Close()
+	fs.file = nil
+	return err
+}
+
+// writerFragmentStore writes fragments to a writer in index order
+type writerFragmentStore struct {
+	w       io.Writer
+	hash    *HashState
+	pending map[uint32][]byte
+	next    uint32
+	written uint64
+	err     error
+}
+
+func (ws *writerFragmentStore) put(fragment Fragment) error {
+	if ws.err != nil {
+		return ws.err
+	}
+	if fragment.Index != ws.next {
+		if ws.pending == nil {
+			ws.pending = make(map[uint32][]byte)
+		}
+		ws.pending[fragment.Index] = fragment.Data
+		return nil
+	}
+
+	data := fragment.Data
+	for {
+		if _, err := ws.w.Write(data); err != nil {
+			ws.err = err
+			return err
+		}
+		ws.hash.Update(data)
+		ws.written += uint64(len(data))
+		ws.next++
+
+		var ok bool
+		if data, ok = ws.pending[ws.next]; !ok {
+			return nil
+		}
+		delete(ws.pending, ws.next)
+	}
+}
+
+func (ws *writerFragmentStore) result(total uint32) (ReconstructionResult, error) {
+	if ws.err != nil {
+		return ReconstructionResult{}, ws.err
+	}
+	// Finalize a copy, so Result can be called again
+	hash := *ws.hash
+	return ReconstructionResult{
+		IsComplete: true,
+		Metadata: FragmentMetadata{
+			OriginalSize:  ws.written,
+			FragmentCount: total,
+			Timestamp:     time.Now(),
+			Algorithm:     "TOPAY-Z512",
+			Checksum:      hash.Finalize(),
+		},
+	}, nil
+}
+
+// close drops the buffered fragments; the writer belongs to the caller and
+// stays open
+func (ws *writerFragmentStore) close() error {
+	ws.pending = nil
+	return nil
+}
+
+// DefaultMaxPayloads is the number of payloads a Demultiplexer reconstructs
+// concurrently unless the caller sets a different limit
+const DefaultMaxPayloads = 64
+
+// CompletionFunc is called once when a multiplexed payload is complete
+type CompletionFunc func(id ID, result ReconstructionResult, err error)
+
+// DemultiplexerOptions configures a Demultiplexer
+type DemultiplexerOptions struct {
+	// NewReconstructor creates the reconstructor for a newly seen payload;
+	// nil uses NewMemoryReconstructor without a key
+	NewReconstructor func(id ID) (*Reconstructor, error)
+	// OnComplete is called for completed payloads without their own callback
+	OnComplete CompletionFunc
+	// MaxPayloads bounds the payloads in progress; zero uses DefaultMaxPayloads
+	MaxPayloads int
+}
+
+// Demultiplexer separates the fragments of several payloads sharing one
+// transport stream, keeping a Reconstructor per fragment ID
+type Demultiplexer struct {
+	options        DemultiplexerOptions
+	reconstructors map[ID]*Reconstructor
+	callbacks      map[ID]CompletionFunc
+	mutex          sync.Mutex
+}
+
+// NewDemultiplexer creates a demultiplexer; nil options use the defaults
+func NewDemultiplexer(opts *DemultiplexerOptions) *Demultiplexer {
+	var options DemultiplexerOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.NewReconstructor == nil {
+		options.NewReconstructor = func(ID) (*Reconstructor, error) { return NewMemoryReconstructor(nil), nil }
+	}
+	if options.MaxPayloads <= 0 {
+		options.MaxPayloads = DefaultMaxPayloads
+	}
+
+	return &Demultiplexer{
+		options:        options,
+		reconstructors: make(map[ID]*Reconstructor),
+		callbacks:      make(map[ID]CompletionFunc),
+	}
+}
+
+// Expect registers a completion callback for one payload, overriding
+// OnComplete. It may be called before or after the payload's first fragment.
+func (d *Demultiplexer) Expect(id ID, onComplete CompletionFunc) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.callbacks[id] = onComplete
+}
+
+// Add routes a fragment to its payload's reconstructor. When the payload
+// completes, it is removed, its completion callback runs on the caller's
+// goroutine, and the reconstructor is closed.
+func (d *Demultiplexer) Add(fragment Fragment) error {
+	d.mutex.Lock()
+	reconstructor, ok := d.reconstructors[fragment.ID]
+	d.mutex.Unlock()
+	if !ok {
+		return d.start(fragment)
+	}
+
+	complete, err := reconstructor.Add(fragment)
+	if err != nil || !complete {
+		return err
+	}
+
+	d.mutex.Lock()
+	if d.reconstructors[fragment.ID] != reconstructor {
+		// Another goroutine delivered the final fragment first
+		d.mutex.Unlock()
+		return nil
+	}
+	delete(d.reconstructors, fragment.ID)
+	return d.complete(fragment.ID, reconstructor)
+}
+
+// start creates the reconstructor for a payload's first fragment. It is
+// tracked only once that fragment verifies, so fragments that don't can't
+// use up MaxPayloads.
+func (d *Demultiplexer) start(fragment Fragment) error {
+	d.mutex.Lock()
+	full := len(d.reconstructors) >= d.options.MaxPayloads
+	d.mutex.Unlock()
+	if full {
+		return ErrTooManyPayloads
+	}
+
+	reconstructor, err := d.options.NewReconstructor(fragment.ID)
+	if err != nil {
+		return err
+	}
+	complete, err := reconstructor.Add(fragment)
+	if err != nil {
+		reconstructor.Close()
+		return err
+	}
+
+	d.mutex.Lock()
+	if _, ok := d.reconstructors[fragment.ID]; ok {
+		// Another goroutine started the payload first; add to its
+		// reconstructor instead
+		d.mutex.Unlock()
+		reconstructor.Close()
+		return d.Add(fragment)
+	}
+	if complete {
+		return d.complete(fragment.ID, reconstructor)
+	}
+	if len(d.reconstructors) >= d.options.MaxPayloads {
+		d.mutex.Unlock()
+		reconstructor.Close()
+		return ErrTooManyPayloads
+	}
+	d.reconstructors[fragment.ID] = reconstructor
+	d.mutex.Unlock()
+	return nil
+}
+
+// complete finishes a payload that is no longer tracked: it runs the
+// completion callback and closes the reconstructor. The mutex must be
+// held; complete releases it.
+func (d *Demultiplexer) complete(id ID, reconstructor *Reconstructor) error {
+	onComplete, ok := d.callbacks[id]
+	delete(d.callbacks, id)
+	if !ok {
+		onComplete = d.options.OnComplete
+	}
+	d.mutex.Unlock()
+
+	defer reconstructor.Close()
+	if onComplete != nil {
+		result, err := reconstructor.Result()
+		onComplete(id, result, err)
+	}
+	return nil
+}
+
+// AddSerialized deserializes a fragment from the stream and routes it
+func (d *Demultiplexer) AddSerialized(data []byte) error {
+	fragment, err := DeserializeFragment(data)
+	if err != nil {
+		return err
+	}
+	return d.Add(fragment)
+}
+
+// Pending returns the IDs of payloads still in progress
+func (d *Demultiplexer) Pending() []ID {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ids := make([]ID, 0, len(d.reconstructors))
+	for id := range d.reconstructors {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Drop abandons a payload in progress, returning whether it was pending
+func (d *Demultiplexer) Drop(id ID) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	reconstructor, ok := d.reconstructors[id]
+	delete(d.reconstructors, id)
+	delete(d.callbacks, id)
+	if ok {
+		reconstructor.Close()
+	}
+	return ok
+}
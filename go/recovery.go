@@ -0,0 +1,240 @@
+package topayz512
+
+import (
+	"sync"
+	"time"
+)
+
+// Social recovery with guardian-held Shamir shares
+
+// RecoveryVersion is the current recovery kit format version
+const RecoveryVersion = 1
+
+// GuardianShare is a secret share encrypted to one guardian's KEM public key
+type GuardianShare struct {
+	GuardianID Hash       `json:"guardian_id"`
+	Index      uint8      `json:"index"`
+	Ciphertext Ciphertext `json:"ciphertext"`
+	Sealed     []byte     `json:"sealed"`
+	Commitment Hash       `json:"commitment"`
+}
+
+// RecoveryKit holds the encrypted guardian shares and the public data needed
+// to verify a recovery. It contains no secret material in the clear.
+type RecoveryKit struct {
+	Version    uint32          `json:"version"`
+	KitID      Hash            `json:"kit_id"`
+	Threshold  uint8           `json:"threshold"`
+	Commitment Hash            `json:"commitment"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Shares     []GuardianShare `json:"shares"`
+}
+
+// CreateRecoveryKit splits secret into one share per guardian, any threshold of
+// which can recover it, and encrypts each share to its guardian
+func CreateRecoveryKit(secret []byte, guardians []KEMPublicKey, threshold int) (*RecoveryKit, error) {
+	if len(guardians) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	shares, err := SplitSecret(secret, len(guardians), threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, share := range shares {
+			SecureZero(share.Value)
+		}
+	}()
+
+	idBytes, err := SecureRandom(HashSize)
+	if err != nil {
+		return nil, err
+	}
+	kitID := ComputeHash(idBytes)
+
+	kit := &RecoveryKit{
+		Version:    RecoveryVersion,
+		KitID:      kitID,
+		Threshold:  uint8(threshold),
+		Commitment: recoveryCommitment(kitID, secret),
+		CreatedAt:  time.Now().UTC(),
+		Shares:     make([]GuardianShare, len(guardians)),
+	}
+
+	for i, guardian := range guardians {
+		ciphertext, sharedSecret, err := KEMEncapsulate(guardian)
+		if err != nil {
+			return nil, err
+		}
+
+		key := kemWrapKey("TOPAY-Z512-RECOVERY-SHARE", sharedSecret, kitID)
+		sealed, err := sealAESGCM(key, recoveryNonce(shares[i].Index), shares[i].Value, kitID[:])
+		SecureZero(key)
+		SecureEraseSharedSecret(&sharedSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		kit.Shares[i] = GuardianShare{
+			GuardianID: ComputeHash(guardian[:]),
+			Index:      shares[i].Index,
+			Ciphertext: ciphertext,
+			Sealed:     sealed,
+			Commitment: shareCommitment(kitID, shares[i]),
+		}
+	}
+
+	return kit, nil
+}
+
+// DecryptShare is run by a guardian to recover their share from the kit
+func (kit *RecoveryKit) DecryptShare(guardianSecret KEMSecretKey) (SecretShare, error) {
+	publicKey := deriveKEMPublicKey(guardianSecret)
+	guardianID := ComputeHash(publicKey[:])
+
+	for _, share := range kit.Shares {
+		if !HashEqual(share.GuardianID, guardianID) {
+			continue
+		}
+
+		sharedSecret, err := KEMDecapsulate(guardianSecret, share.Ciphertext)
+		if err != nil {
+			return SecretShare{}, err
+		}
+
+		key := kemWrapKey("TOPAY-Z512-RECOVERY-SHARE", sharedSecret, kit.KitID)
+		value, err := openAESGCM(key, recoveryNonce(share.Index), share.Sealed, kit.KitID[:])
+		SecureZero(key)
+		SecureEraseSharedSecret(&sharedSecret)
+		if err != nil {
+			return SecretShare{}, ErrDecapsulationFailed
+		}
+
+		return SecretShare{Index: share.Index, Value: value}, nil
+	}
+
+	return SecretShare{}, ErrNoMatchingRecipient
+}
+
+// RecoveryCeremony collects decrypted guardian shares until the secret can be recovered
+type RecoveryCeremony struct {
+	kit    *RecoveryKit
+	shares map[uint8]SecretShare
+	mutex  sync.Mutex
+}
+
+// NewRecoveryCeremony starts collecting shares for a recovery kit
+func NewRecoveryCeremony(kit *RecoveryKit) *RecoveryCeremony {
+	return &RecoveryCeremony{
+		kit:    kit,
+		shares: make(map[uint8]SecretShare),
+	}
+}
+
+// AddShare verifies a guardian's share against the kit and records it
+func (rc *RecoveryCeremony) AddShare(share SecretShare) error {
+	for _, guardianShare := range rc.kit.Shares {
+		if guardianShare.Index != share.Index {
+			continue
+		}
+
+		if !HashEqual(guardianShare.Commitment, shareCommitment(rc.kit.KitID, share)) {
+			return ErrInvalidShare
+		}
+
+		rc.mutex.Lock()
+		rc.shares[share.Index] = share
+		rc.mutex.Unlock()
+		return nil
+	}
+
+	return ErrInvalidShare
+}
+
+// Collected returns the number of verified shares collected so far
+func (rc *RecoveryCeremony) Collected() int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return len(rc.shares)
+}
+
+// Ready reports whether enough shares have been collected to recover the secret
+func (rc *RecoveryCeremony) Ready() bool {
+	return rc.Collected() >= int(rc.kit.Threshold)
+}
+
+// Recover reconstructs the secret and verifies it against the kit commitment
+func (rc *RecoveryCeremony) Recover() ([]byte, error) {
+	rc.mutex.Lock()
+	shares := make([]SecretShare, 0, len(rc.shares))
+	for _, share := range rc.shares {
+		shares = append(shares, share)
+	}
+	rc.mutex.Unlock()
+
+	if len(shares) < int(rc.kit.Threshold) {
+		return nil, ErrInvalidThreshold
+	}
+
+	secret, err := CombineShares(shares[:rc.kit.Threshold])
+	if err != nil {
+		return nil, err
+	}
+
+	if !HashEqual(recoveryCommitment(rc.kit.KitID, secret), rc.kit.Commitment) {
+		SecureZero(secret)
+		return nil, ErrReconstructionFailed
+	}
+
+	return secret, nil
+}
+
+// Rotate recovers the secret and issues a fresh kit for a new guardian set, so
+// shares held by the previous guardians no longer combine with the new ones
+func (rc *RecoveryCeremony) Rotate(guardians []KEMPublicKey, threshold int) ([]byte, *RecoveryKit, error) {
+	secret, err := rc.Recover()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kit, err := CreateRecoveryKit(secret, guardians, threshold)
+	if err != nil {
+		SecureZero(secret)
+		return nil, nil, err
+	}
+
+	return secret, kit, nil
+}
+
+// Wipe erases all collected shares from memory. It does nothing for a nil
+// ceremony.
+func (rc *RecoveryCeremony) Wipe() {
+	if rc == nil {
+		return
+	}
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	for index, share := range rc.shares {
+		SecureZero(share.Value)
+		delete(rc.shares, index)
+	}
+}
+
+// recoveryCommitment binds the secret to a kit without revealing it
+func recoveryCommitment(kitID Hash, secret []byte) Hash {
+	return HashMultiple([]byte("TOPAY-Z512-RECOVERY-SECRET"), kitID[:], secret)
+}
+
+// shareCommitment lets the ceremony reject altered shares before combining
+func shareCommitment(kitID Hash, share SecretShare) Hash {
+	return HashMultiple([]byte("TOPAY-Z512-RECOVERY-SHARE"), kitID[:], []byte{share.Index}, share.Value)
+}
+
+// recoveryNonce returns the GCM nonce for the share at index
+func recoveryNonce(index uint8) []byte {
+	nonce := make([]byte, 12)
+	nonce[11] = index
+	return nonce
+}
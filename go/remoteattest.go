@@ -0,0 +1,205 @@
+package topayz512
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Remote attestation of a node's binary by challenge and response
+//
+// Responses are signed with the node's stateless signing key, so answering
+// challenges costs nothing but CPU time. A stateful XMSS key would spend a
+// leaf per response and let anyone who can send challenges exhaust it.
+
+// Remote attestation constants
+const (
+	// AttestationNonceSize is the size of a challenge nonce
+	AttestationNonceSize = 32
+
+	// DefaultChallengeTTL is how long a challenge can be answered unless the
+	// verifier sets a different lifetime
+	DefaultChallengeTTL = time.Minute
+
+	// remoteAttestationDomain separates attestation responses from other signed messages
+	remoteAttestationDomain = "TOPAY-Z512-REMOTE-ATTESTATION"
+)
+
+// AttestationChallenge is the verifier's fresh nonce
+type AttestationChallenge struct {
+	Nonce    [AttestationNonceSize]byte `json:"nonce"`
+	IssuedAt time.Time                  `json:"issued_at"`
+}
+
+// AttestationResponse is the prover's signed measurement of its binary
+type AttestationResponse struct {
+	Nonce       [AttestationNonceSize]byte `json:"nonce"`
+	Measurement Hash                       `json:"measurement"`
+	Signer      Hash                       `json:"signer"`
+	Signature   []byte                     `json:"signature"`
+}
+
+// AttestationMeasurement computes Hash(nonce || binary), which only a holder
+// of the whole binary can produce for a fresh nonce. The nonce comes first
+// so the hash state after the binary can't be precomputed and kept in its
+// place.
+func AttestationMeasurement(binary io.Reader, nonce [AttestationNonceSize]byte) (Hash, error) {
+	sh := NewStreamingHash()
+	defer sh.Close()
+
+	sh.Write(nonce[:])
+	if _, err := io.Copy(sh, binary); err != nil {
+		return Hash{}, err
+	}
+	return sh.Sum(), nil
+}
+
+// statement returns the bytes covered by the response signature
+func (ar *AttestationResponse) statement() []byte {
+	statement := make([]byte, 0, len(remoteAttestationDomain)+AttestationNonceSize+2*HashSize)
+	statement = append(statement, remoteAttestationDomain...)
+	statement = append(statement, ar.Nonce[:]...)
+	statement = append(statement, ar.Measurement[:]...)
+	return append(statement, ar.Signer[:]...)
+}
+
+// RespondToChallenge measures the binary at path, or the running executable
+// when path is empty, and signs the measurement with the node's identity key
+func RespondToChallenge(challenge AttestationChallenge, path string, key PrivateKey) (*AttestationResponse, error) {
+	if path == "" {
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		path = executable
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	measurement, err := AttestationMeasurement(file, challenge.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AttestationResponse{
+		Nonce:       challenge.Nonce,
+		Measurement: measurement,
+		Signer:      PublicKeyFingerprint(DerivePublicKey(key)),
+	}
+	signature, err := Sign(key, response.statement())
+	if err != nil {
+		return nil, err
+	}
+	response.Signature = signature.AppendBytes(nil)
+	return response, nil
+}
+
+// AttestationVerifier issues challenges and checks responses against trusted
+// node keys. Each challenge can be answered once, before it expires.
+type AttestationVerifier struct {
+	trustedKeys []PublicKey
+	ttl         time.Duration
+	outstanding map[[AttestationNonceSize]byte]time.Time
+	mutex       sync.Mutex
+}
+
+// NewAttestationVerifier creates a verifier trusting the given node keys;
+// ttl bounds how long a challenge stays valid, zero using DefaultChallengeTTL
+func NewAttestationVerifier(trustedKeys []PublicKey, ttl time.Duration) *AttestationVerifier {
+	if ttl <= 0 {
+		ttl = DefaultChallengeTTL
+	}
+	return &AttestationVerifier{
+		trustedKeys: append([]PublicKey(nil), trustedKeys...),
+		ttl:         ttl,
+		outstanding: make(map[[AttestationNonceSize]byte]time.Time),
+	}
+}
+
+// Challenge issues a fresh challenge
+func (av *AttestationVerifier) Challenge() (AttestationChallenge, error) {
+	var challenge AttestationChallenge
+	if err := readRandom(challenge.Nonce[:]); err != nil {
+		return AttestationChallenge{}, err
+	}
+	challenge.IssuedAt = time.Now().UTC()
+
+	av.mutex.Lock()
+	defer av.mutex.Unlock()
+
+	av.expire(challenge.IssuedAt)
+	av.outstanding[challenge.Nonce] = challenge.IssuedAt.Add(av.ttl)
+	return challenge, nil
+}
+
+// Verify checks a response against the reference binary the node should be
+// running and returns the node's key. The challenge is consumed whether or
+// not verification succeeds, so a response can't be replayed.
+func (av *AttestationVerifier) Verify(response *AttestationResponse, reference io.Reader) (PublicKey, error) {
+	av.mutex.Lock()
+	expires, ok := av.outstanding[response.Nonce]
+	delete(av.outstanding, response.Nonce)
+	av.mutex.Unlock()
+
+	if !ok {
+		return PublicKey{}, ErrUnknownChallenge
+	}
+	if time.Now().After(expires) {
+		return PublicKey{}, ErrChallengeExpired
+	}
+
+	signer, ok := av.trustedKey(response.Signer)
+	if !ok {
+		return PublicKey{}, ErrUntrustedSigner
+	}
+
+	signature, err := SignatureFromBytes(response.Signature)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	if !Verify(signer, response.statement(), signature) {
+		return PublicKey{}, ErrInvalidSignature
+	}
+
+	expected, err := AttestationMeasurement(reference, response.Nonce)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	if !HashEqual(expected, response.Measurement) {
+		return PublicKey{}, ErrFileModified
+	}
+	return signer, nil
+}
+
+// trustedKey returns the trusted key with the given fingerprint
+func (av *AttestationVerifier) trustedKey(fingerprint Hash) (PublicKey, bool) {
+	for _, key := range av.trustedKeys {
+		if HashEqual(PublicKeyFingerprint(key), fingerprint) {
+			return key, true
+		}
+	}
+	return PublicKey{}, false
+}
+
+// Outstanding returns the number of unanswered, unexpired challenges
+func (av *AttestationVerifier) Outstanding() int {
+	av.mutex.Lock()
+	defer av.mutex.Unlock()
+
+	av.expire(time.Now())
+	return len(av.outstanding)
+}
+
+// expire forgets challenges that expired before now
+func (av *AttestationVerifier) expire(now time.Time) {
+	for nonce, expires := range av.outstanding {
+		if now.After(expires) {
+			delete(av.outstanding, nonce)
+		}
+	}
+}
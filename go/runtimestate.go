@@ -0,0 +1,127 @@
+package topayz512
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/params"
+)
+
+// Runtime configuration snapshots
+//
+// ExportRuntimeState captures the package-wide settings that tune behavior
+// without being secret: the parameter set compiled in, strict mode, the
+// global worker pool size and the SIMD capability profile. A device fleet can
+// be provisioned by importing one known-good blob at startup. Keys, audit
+// recorders and other hooks are never part of the state.
+
+// RuntimeStateVersion is the current runtime state format version
+const RuntimeStateVersion = 1
+
+// RuntimeState is a snapshot of the package's runtime configuration
+type RuntimeState struct {
+	Version uint32 `json:"version"`
+	// ParameterSet identifies the key, hash and ciphertext sizes compiled in;
+	// a state only imports into a build with the same parameter set
+	ParameterSet string `json:"parameter_set"`
+	// StrictMode refuses placeholder primitives; see SetStrictMode
+	StrictMode bool `json:"strict_mode"`
+	// WorkerPoolSize is the global worker pool's worker count; zero means
+	// OptimalThreadCount on each device
+	WorkerPoolSize int `json:"worker_pool_size"`
+	// SIMD lists the instruction sets vectorized code may use. Importing can
+	// only disable sets the device has, never enable missing ones.
+	SIMD []string `json:"simd"`
+}
+
+// ParameterSet returns the identifier of the compiled-in parameter set: the
+// library name and a fingerprint of every size in params
+func ParameterSet() string {
+	sizes := []params.Size{
+		params.PrivateKeySize, params.PublicKeySize, params.HashSize,
+		params.KEMPublicKeySize, params.KEMSecretKeySize, params.CiphertextSize,
+		params.SharedSecretSize, params.SignatureSize, params.NonceSize, params.IDSize,
+	}
+	encoded := make([]byte, 0, 8*len(sizes))
+	for _, size := range sizes {
+		encoded = binary.BigEndian.AppendUint64(encoded, uint64(size))
+	}
+	fingerprint := HashMultiple([]byte("TOPAY-Z512-PARAMETER-SET"), encoded)
+	return "TOPAY-Z512-" + FastHexEncode(fingerprint[:8])
+}
+
+// CurrentRuntimeState returns the runtime configuration in effect
+func CurrentRuntimeState() RuntimeState {
+	return RuntimeState{
+		Version:        RuntimeStateVersion,
+		ParameterSet:   ParameterSet(),
+		StrictMode:     StrictMode(),
+		WorkerPoolSize: globalWorkerPoolSize,
+		SIMD:           simdCaps.Features(),
+	}
+}
+
+// ExportRuntimeState serializes the runtime configuration in effect as JSON
+func ExportRuntimeState() ([]byte, error) {
+	return json.Marshal(CurrentRuntimeState())
+}
+
+// ImportRuntimeState parses a blob from ExportRuntimeState and applies it.
+// It rejects unknown fields, unknown instruction sets and a parameter set
+// other than this build's, leaving the configuration unchanged. Like
+// CleanupGlobalPools it must not run concurrently with other calls into the
+// package, so import at startup.
+func ImportRuntimeState(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var state RuntimeState
+	if err := decoder.Decode(&state); err != nil {
+		return err
+	}
+	return ApplyRuntimeState(&state)
+}
+
+// ApplyRuntimeState validates and applies a runtime configuration. A running
+// global worker pool of a different size is closed and restarted lazily.
+func ApplyRuntimeState(state *RuntimeState) error {
+	if state == nil {
+		return ErrInvalidRuntimeState
+	}
+	if state.Version != RuntimeStateVersion {
+		return ErrUnsupportedVersion
+	}
+	if state.ParameterSet != ParameterSet() {
+		return fmt.Errorf("%w: parameter set %q, this build has %q", ErrInvalidRuntimeState, state.ParameterSet, ParameterSet())
+	}
+	if state.WorkerPoolSize < 0 {
+		return fmt.Errorf("%w: negative worker pool size", ErrInvalidRuntimeState)
+	}
+
+	var enabled SIMDCapabilities
+	for _, name := range state.SIMD {
+		found := false
+		for _, feature := range simdFeatures {
+			if feature.name == name {
+				*feature.field(&enabled) = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: unknown instruction set %q", ErrInvalidRuntimeState, name)
+		}
+	}
+	detected := DetectSIMDCapabilities()
+	for _, feature := range simdFeatures {
+		*feature.field(&enabled) = *feature.field(&enabled) && *feature.field(&detected)
+	}
+
+	strictMode.Store(state.StrictMode)
+	simdCaps = enabled
+	if state.WorkerPoolSize != globalWorkerPoolSize {
+		globalWorkerPoolSize = state.WorkerPoolSize
+		CleanupGlobalPools()
+	}
+	return nil
+}
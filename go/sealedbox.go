@@ -0,0 +1,124 @@
+package topayz512
+
+import (
+	"context"
+	"time"
+)
+
+// Sealed boxes: anonymous public-key encryption
+//
+// Encrypt encapsulates a fresh shared secret to the recipient and seals the
+// plaintext under the AEAD derived from it, like a NaCl sealed box. The
+// result is the KEM ciphertext followed by the sealed message. Each box has
+// its own shared secret, so the AEAD's first nonce is never reused; the
+// sender can't decrypt the box afterwards and isn't authenticated.
+
+// SealedBoxOverhead is the number of bytes Encrypt adds to a plaintext
+const SealedBoxOverhead = CiphertextSize + AEADOverhead
+
+// Encrypt seals plaintext so only the holder of the secret key matching
+// publicKey can open it
+func Encrypt(publicKey KEMPublicKey, plaintext []byte) ([]byte, error) {
+	ciphertext, sharedSecret, err := KEMEncapsulate(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureEraseSharedSecret(&sharedSecret)
+
+	aead, err := sharedSecret.NewAEAD(AEADInitiator, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer aead.Wipe()
+	sealed, err := aead.Seal(plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	box := make([]byte, 0, CiphertextSize+len(sealed))
+	box = append(box, ciphertext[:]...)
+	return append(box, sealed...), nil
+}
+
+// RevocationChecker reports whether the KEM key with the given KEMKeyID has
+// been revoked. An error refuses encryption rather than skipping the check.
+type RevocationChecker func(ctx context.Context, keyID Hash) (bool, error)
+
+// EncryptPolicy decides which recipient keys EncryptWithPolicy encrypts to,
+// so applications share one place enforcing revocation and key rotation
+type EncryptPolicy struct {
+	// CheckRevocation is consulted before every encryption; nil skips it
+	CheckRevocation RevocationChecker
+	// MaxKeyAge refuses keys issued longer ago than this, and keys of unknown
+	// age; zero accepts any age
+	MaxKeyAge time.Duration
+	// Clock returns the current time; nil uses time.Now
+	Clock func() time.Time
+}
+
+// RecipientKey is a recipient's KEM public key and when it was issued
+type RecipientKey struct {
+	PublicKey KEMPublicKey `json:"public_key"`
+	// IssuedAt is zero when the issue time is unknown
+	IssuedAt time.Time `json:"issued_at,omitempty"`
+}
+
+// Check returns ErrKeyTooOld if the key is older than MaxKeyAge and
+// ErrKeyRevoked if the revocation checker reports it revoked. A nil policy
+// accepts every key.
+func (p *EncryptPolicy) Check(ctx context.Context, recipient RecipientKey) error {
+	if p == nil {
+		return nil
+	}
+	if p.MaxKeyAge > 0 {
+		now := time.Now()
+		if p.Clock != nil {
+			now = p.Clock()
+		}
+		if recipient.IssuedAt.IsZero() || now.Sub(recipient.IssuedAt) > p.MaxKeyAge {
+			return ErrKeyTooOld
+		}
+	}
+	if p.CheckRevocation != nil {
+		revoked, err := p.CheckRevocation(ctx, KEMKeyID(recipient.PublicKey))
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrKeyRevoked
+		}
+	}
+	return nil
+}
+
+// EncryptWithPolicy is Encrypt after checking the recipient key against
+// policy; a nil policy accepts every key
+func EncryptWithPolicy(ctx context.Context, recipient RecipientKey, plaintext []byte, policy *EncryptPolicy) ([]byte, error) {
+	if err := policy.Check(ctx, recipient); err != nil {
+		return nil, err
+	}
+	return Encrypt(recipient.PublicKey, plaintext)
+}
+
+// Decrypt opens a box made by Encrypt. It returns ErrWrongRecipient for a
+// box encrypted to another key and ErrAuthenticationFailed for a truncated
+// or modified one.
+func Decrypt(secretKey KEMSecretKey, box []byte) ([]byte, error) {
+	if len(box) < SealedBoxOverhead {
+		return nil, ErrAuthenticationFailed
+	}
+	var ciphertext Ciphertext
+	copy(ciphertext[:], box)
+	sharedSecret, err := KEMDecapsulate(secretKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureEraseSharedSecret(&sharedSecret)
+
+	aead, err := sharedSecret.NewAEAD(AEADResponder, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer aead.Wipe()
+	return aead.Open(box[CiphertextSize:], nil)
+}
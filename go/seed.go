@@ -0,0 +1,202 @@
+package topayz512
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+)
+
+// Versioned seed-to-key derivation
+//
+// Version 2 derives the 64-byte private key as
+//
+//	PBKDF2-HMAC-SHA512(password = seed, salt = "TOPAY-Z512-SEED-V2" || len(seed), iterations = 2048, length = 64)
+//
+// where len(seed) is a big-endian uint32. Any implementation with PBKDF2 and
+// SHA-512 can reproduce it. Version 1 is the original derivation, which
+// repeats one SHA-256 output across the key; it is kept so existing seeds can
+// be migrated.
+
+// SeedVersion identifies a seed-to-key derivation
+type SeedVersion uint8
+
+// Seed versions
+const (
+	// SeedVersionLegacy is the original SHA-256 repeat-fill derivation
+	SeedVersionLegacy SeedVersion = 1
+
+	// SeedVersion2 is the salted, iterated PBKDF2-HMAC-SHA512 derivation
+	SeedVersion2 SeedVersion = 2
+
+	// CurrentSeedVersion is the derivation used by GenerateKeyPairFromSeed
+	CurrentSeedVersion = SeedVersion2
+)
+
+// Seed derivation constants
+const (
+	// MinSeedSize is the smallest accepted seed in bytes
+	MinSeedSize = 32
+
+	// seedV2Iterations is the PBKDF2 iteration count of version 2
+	seedV2Iterations = 2048
+
+	// seedV2Salt is the domain-separating PBKDF2 salt prefix of version 2
+	seedV2Salt = "TOPAY-Z512-SEED-V2"
+
+	// seedLegacyDomain is the suffix hashed by the legacy derivation
+	seedLegacyDomain = "TOPAY-Z512-PRIVATE-KEY-SEED"
+)
+
+// DerivePrivateKeyFromSeed derives a private key from seed with the given
+// derivation version
+func DerivePrivateKeyFromSeed(seed []byte, version SeedVersion) (PrivateKey, error) {
+	if len(seed) < MinSeedSize {
+		return PrivateKey{}, ErrInvalidKeySize
+	}
+
+	var privateKey PrivateKey
+	switch version {
+	case SeedVersionLegacy:
+		hasher := sha256.New()
+		hasher.Write(seed)
+		hasher.Write([]byte(seedLegacyDomain))
+		digest := hasher.Sum(nil)
+		for i := range privateKey {
+			privateKey[i] = digest[i%len(digest)]
+		}
+		SecureZero(digest)
+	case SeedVersion2:
+		salt := make([]byte, len(seedV2Salt)+4)
+		copy(salt, seedV2Salt)
+		binary.BigEndian.PutUint32(salt[len(seedV2Salt):], uint32(len(seed)))
+		pbkdf2SHA512(privateKey[:], seed, salt, seedV2Iterations)
+	default:
+		return PrivateKey{}, ErrUnsupportedVersion
+	}
+	return privateKey, nil
+}
+
+// GenerateKeyPairFromSeedVersion generates a deterministic key pair from a
+// seed with the given derivation version
+func GenerateKeyPairFromSeedVersion(seed []byte, version SeedVersion) (PrivateKey, PublicKey, error) {
+	privateKey, err := DerivePrivateKeyFromSeed(seed, version)
+	if err != nil {
+		return PrivateKey{}, PublicKey{}, err
+	}
+	return privateKey, DerivePublicKey(privateKey), nil
+}
+
+// pbkdf2SHA512 fills out with PBKDF2-HMAC-SHA512 of password and salt
+func pbkdf2SHA512(out, password, salt []byte, iterations int) {
+	prf := hmac.New(sha512.New, password)
+	block := make([]byte, 0, sha512.Size)
+	u := make([]byte, sha512.Size)
+	var counter [4]byte
+
+	for blockIndex := uint32(1); len(out) > 0; blockIndex++ {
+		binary.BigEndian.PutUint32(counter[:], blockIndex)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		block = prf.Sum(block[:0])
+		copy(u, block)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range block {
+				block[j] ^= u[j]
+			}
+		}
+
+		n := copy(out, block)
+		out = out[n:]
+	}
+
+	SecureZero(block)
+	SecureZero(u)
+}
+
+// VersionedSeed is a seed tagged with the derivation it is used with, so a
+// stored seed keeps producing the same keys across library upgrades
+type VersionedSeed struct {
+	Version SeedVersion
+	Seed    []byte
+}
+
+// NewVersionedSeed tags seed with CurrentSeedVersion
+func NewVersionedSeed(seed []byte) (VersionedSeed, error) {
+	if len(seed) < MinSeedSize {
+		return VersionedSeed{}, ErrInvalidKeySize
+	}
+	return VersionedSeed{Version: CurrentSeedVersion, Seed: append([]byte(nil), seed...)}, nil
+}
+
+// KeyPair derives the key pair of the seed under its version
+func (s VersionedSeed) KeyPair() (PrivateKey, PublicKey, error) {
+	return GenerateKeyPairFromSeedVersion(s.Seed, s.Version)
+}
+
+// MarshalBinary encodes the seed as version(1) | seed
+func (s VersionedSeed) MarshalBinary() ([]byte, error) {
+	return append([]byte{byte(s.Version)}, s.Seed...), nil
+}
+
+// UnmarshalBinary decodes a seed written by MarshalBinary
+func (s *VersionedSeed) UnmarshalBinary(data []byte) error {
+	if len(data) < 1+MinSeedSize {
+		return ErrInvalidKeySize
+	}
+	version := SeedVersion(data[0])
+	if version != SeedVersionLegacy && version != SeedVersion2 {
+		return ErrUnsupportedVersion
+	}
+	s.Version = version
+	s.Seed = append([]byte(nil), data[1:]...)
+	return nil
+}
+
+// Wipe erases the seed. It does nothing for a nil seed.
+func (s *VersionedSeed) Wipe() {
+	if s == nil {
+		return
+	}
+	SecureZero(s.Seed)
+}
+
+// SeedMigration describes moving a seed to CurrentSeedVersion: the keys it
+// produced before, the keys it produces now, and the re-tagged seed to store
+type SeedMigration struct {
+	Seed          VersionedSeed
+	OldPrivateKey PrivateKey
+	OldPublicKey  PublicKey
+	NewPrivateKey PrivateKey
+	NewPublicKey  PublicKey
+}
+
+// MigrateSeed re-tags a seed with CurrentSeedVersion and returns both key
+// pairs, so funds or registrations held by the old public key can be moved
+// to the new one. A seed already at the current version migrates to itself
+func MigrateSeed(seed VersionedSeed) (SeedMigration, error) {
+	oldPrivate, oldPublic, err := seed.KeyPair()
+	if err != nil {
+		return SeedMigration{}, err
+	}
+
+	migrated := VersionedSeed{Version: CurrentSeedVersion, Seed: append([]byte(nil), seed.Seed...)}
+	newPrivate, newPublic, err := migrated.KeyPair()
+	if err != nil {
+		SecureZero(oldPrivate[:])
+		return SeedMigration{}, err
+	}
+
+	return SeedMigration{
+		Seed:          migrated,
+		OldPrivateKey: oldPrivate,
+		OldPublicKey:  oldPublic,
+		NewPrivateKey: newPrivate,
+		NewPublicKey:  newPublic,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package topayz512
+
+import (
+	"sync"
+)
+
+// Shamir secret sharing over GF(2^8)
+
+// MaxShares is the maximum number of shares a secret can be split into
+const MaxShares = 255
+
+// SecretShare is one Shamir share of a secret. Index is the non-zero
+// evaluation point and Value holds one polynomial evaluation per secret byte.
+type SecretShare struct {
+	Index uint8  `json:"index"`
+	Value []byte `json:"value"`
+}
+
+var (
+	gf256Once sync.Once
+	gf256Exp  [510]byte
+	gf256Log  [256]byte
+)
+
+// initGF256 builds the exponent and logarithm tables for the AES field
+func initGF256() {
+	gf256Once.Do(func() {
+		x := 1
+		for i := 0; i < 255; i++ {
+			gf256Exp[i] = byte(x)
+			gf256Log[x] = byte(i)
+			// Multiply by the generator 3 modulo x^8 + x^4 + x^3 + x + 1
+			x ^= x << 1
+			if x&0x100 != 0 {
+				x ^= 0x11B
+			}
+		}
+		for i := 255; i < len(gf256Exp); i++ {
+			gf256Exp[i] = gf256Exp[i-255]
+		}
+	})
+}
+
+// gf256Mul multiplies two field elements
+func gf256Mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+int(gf256Log[b])]
+}
+
+// gf256Div divides a by the non-zero element b
+func gf256Div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+255-int(gf256Log[b])]
+}
+
+// SplitSecret splits secret into n shares such that any threshold of them recover it
+func SplitSecret(secret []byte, n, threshold int) ([]SecretShare, error) {
+	if len(secret) == 0 {
+		return nil, ErrEmptyData
+	}
+	if threshold < 1 || n < threshold || n > MaxShares {
+		return nil, ErrInvalidThreshold
+	}
+
+	initGF256()
+
+	// One random polynomial of degree threshold-1 per secret byte, with the
+	// secret byte as constant term
+	coefficients, err := SecureRandom(len(secret) * (threshold - 1))
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(coefficients)
+
+	shares := make([]SecretShare, n)
+	for i := range shares {
+		x := byte(i + 1)
+		value := make([]byte, len(secret))
+		for b := range secret {
+			// Horner evaluation from the highest coefficient down
+			var y byte
+			for c := threshold - 2; c >= 0; c-- {
+				y = gf256Mul(y, x) ^ coefficients[b*(threshold-1)+c]
+			}
+			value[b] = gf256Mul(y, x) ^ secret[b]
+		}
+		shares[i] = SecretShare{Index: x, Value: value}
+	}
+
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from at least threshold distinct shares
+// using Lagrange interpolation at zero
+func CombineShares(shares []SecretShare) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrEmptyData
+	}
+
+	initGF256()
+
+	size := len(shares[0].Value)
+	seen := make(map[uint8]bool, len(shares))
+	for _, share := range shares {
+		if share.Index == 0 || len(share.Value) != size || size == 0 || seen[share.Index] {
+			return nil, ErrInvalidShare
+		}
+		seen[share.Index] = true
+	}
+
+	secret := make([]byte, size)
+	for i, share := range shares {
+		// Lagrange basis polynomial for share i evaluated at zero
+		basis := byte(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			basis = gf256Mul(basis, gf256Div(other.Index, other.Index^share.Index))
+		}
+
+		for b := range secret {
+			secret[b] ^= gf256Mul(basis, share.Value[b])
+		}
+	}
+
+	return secret, nil
+}
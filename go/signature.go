@@ -0,0 +1,447 @@
+package topayz512
+
+import (
+	"crypto"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Stateless hash-based signatures (SPHINCS+-style) for key pairs. The message
+// is signed with a FORS few-time key chosen by the message digest, and the
+// FORS public key is certified by a hypertree of WOTS+ trees whose top root is
+// half of the public key. Nothing is stored between signatures, so unlike
+// XMSS a private key can sign any number of messages.
+
+// Signature parameters
+const (
+	// sigLayers is the number of hypertree layers d
+	sigLayers = 17
+
+	// sigLayerHeight is the height h' of the tree in each hypertree layer
+	sigLayerHeight = 4
+
+	// sigFORSTrees is the number of FORS trees k
+	sigFORSTrees = 35
+
+	// sigFORSHeight is the height a of each FORS tree
+	sigFORSHeight = 9
+
+	// sigWOTSLen is the number of WOTS+ chains with w = 16
+	sigWOTSLen = 67
+
+	// sigFORSSize is the size of the FORS part of a signature
+	sigFORSSize = sigFORSTrees * (sigFORSHeight + 1) * WOTSHashSize
+
+	// sigLayerSize is the size of one hypertree layer of a signature
+	sigLayerSize = (sigWOTSLen + sigLayerHeight) * WOTSHashSize
+
+	// signatureLength is the signature size these parameters produce; it is
+	// checked against params.SignatureSize at compile time
+	signatureLength = WOTSHashSize + sigFORSSize + sigLayers*sigLayerSize
+
+	// signatureSecretDomain separates the secret signing seeds from other uses of the hash
+	signatureSecretDomain = "TOPAY-Z512-SIG-SECRET"
+
+	// signaturePublicDomain separates the public seed from other uses of the hash
+	signaturePublicDomain = "TOPAY-Z512-SIG-PUBLIC"
+
+	// signatureRandomnessDomain separates signature randomness from other uses of the hash
+	signatureRandomnessDomain = "TOPAY-Z512-SIG-RAND"
+
+	// signatureMessageDomain separates signature message digests from other uses of the hash
+	signatureMessageDomain = "TOPAY-Z512-SIG-MSG"
+)
+
+// sigWOTSParams are the WOTS+ parameters of the hypertree
+var sigWOTSParams = WOTSParams{W: 16}
+
+// signingKey holds the seeds a private key expands to and the hypertree root
+type signingKey struct {
+	skSeed  [WOTSHashSize]byte
+	skPRF   [WOTSHashSize]byte
+	pubSeed [WOTSHashSize]byte
+	root    [WOTSHashSize]byte
+}
+
+// expandSigningKey derives the signing seeds of a private key and computes
+// the root of the top hypertree layer
+func expandSigningKey(privateKey PrivateKey) *signingKey {
+	secret := HashMultiple([]byte(signatureSecretDomain), privateKey[:])
+	public := HashMultiple([]byte(signaturePublicDomain), privateKey[:])
+
+	key := &signingKey{}
+	copy(key.skSeed[:], secret[:WOTSHashSize])
+	copy(key.skPRF[:], secret[WOTSHashSize:])
+	copy(key.pubSeed[:], public[:WOTSHashSize])
+	SecureZero(secret[:])
+
+	var adrs hashAddress
+	adrs.setLayer(sigLayers - 1)
+	nodes := sigTree(key.skSeed[:], key.pubSeed[:], adrs)
+	key.root = nodes[sigLayerHeight][0]
+	return key
+}
+
+// publicKey returns the public seed followed by the hypertree root
+func (k *signingKey) publicKey() PublicKey {
+	var publicKey PublicKey
+	copy(publicKey[:WOTSHashSize], k.pubSeed[:])
+	copy(publicKey[WOTSHashSize:], k.root[:])
+	return publicKey
+}
+
+// wipe erases the secret seeds
+func (k *signingKey) wipe() {
+	SecureZero(k.skSeed[:])
+	SecureZero(k.skPRF[:])
+}
+
+// sigTree computes every node of the hypertree tree at adrs, whose layer and
+// tree are set; nodes[0] holds the WOTS+ leaves and nodes[sigLayerHeight] the root
+func sigTree(skSeed, pubSeed []byte, adrs hashAddress) [][][WOTSHashSize]byte {
+	nodes := make([][][WOTSHashSize]byte, sigLayerHeight+1)
+	leaves := make([][WOTSHashSize]byte, 1<<sigLayerHeight)
+	for i := range leaves {
+		leafAdrs := adrs
+		leafAdrs.setType(addrTypeWOTSHash)
+		leafAdrs.setKeyPair(uint32(i))
+		leaves[i] = wotsPublicKeyGen(sigWOTSParams, skSeed, pubSeed, leafAdrs)
+	}
+	nodes[0] = leaves
+
+	adrs.setType(addrTypeTree)
+	for height := 1; height <= sigLayerHeight; height++ {
+		below := nodes[height-1]
+		level := make([][WOTSHashSize]byte, len(below)/2)
+		for i := range level {
+			level[i] = treeNode(pubSeed, adrs, uint8(height), uint32(i), below[2*i][:], below[2*i+1][:])
+		}
+		nodes[height] = level
+	}
+	return nodes
+}
+
+// sigRandomness derives the per-message randomness. Signatures are
+// deterministic: the same key and message always give the same signature
+func sigRandomness(skPRF []byte, publicKey PublicKey, message []byte) []byte {
+	digest := HashMultiple([]byte(signatureRandomnessDomain), skPRF, publicKey[:], message)
+	return digest[:WOTSHashSize]
+}
+
+// sigMessageDigest hashes a message to the FORS leaf indices and the
+// hypertree tree and leaf that sign it
+func sigMessageDigest(randomness []byte, publicKey PublicKey, message []byte) (indices [sigFORSTrees]uint32, tree uint64, leaf uint32) {
+	digest := HashMultiple([]byte(signatureMessageDomain), randomness, publicKey[:], message)
+
+	// The first k*a bits select one leaf in each FORS tree
+	for i := range indices {
+		for bit := i * sigFORSHeight; bit < (i+1)*sigFORSHeight; bit++ {
+			indices[i] = indices[i]<<1 | uint32(digest[bit/8]>>(7-bit%8))&1
+		}
+	}
+
+	offset := (sigFORSTrees*sigFORSHeight + 7) / 8
+	tree = binary.BigEndian.Uint64(digest[offset:])
+	leaf = uint32(digest[offset+8]) & (1<<sigLayerHeight - 1)
+	return indices, tree, leaf
+}
+
+// forsAddress returns the FORS address of the given type for the hypertree
+// leaf keyPair under adrs
+func forsAddress(adrs hashAddress, addrType uint8, keyPair uint32) hashAddress {
+	adrs.setType(addrType)
+	adrs.setFORSKeyPair(uint8(keyPair))
+	return adrs
+}
+
+// forsLeaf computes the leaf at global index from its secret value
+func forsLeaf(secret []byte, index uint32, pubSeed []byte, treeAdrs hashAddress) [WOTSHashSize]byte {
+	treeAdrs.setTreeHeight(0)
+	treeAdrs.setTreeIndex(index)
+	return thash(pubSeed, &treeAdrs, secret)
+}
+
+// forsSign signs the leaf indices with the FORS key of hypertree leaf keyPair
+// and returns the signature and the FORS public key
+func forsSign(indices [sigFORSTrees]uint32, skSeed, pubSeed []byte, adrs hashAddress, keyPair uint32) ([]byte, [WOTSHashSize]byte) {
+	treeAdrs := forsAddress(adrs, addrTypeFORSTree, keyPair)
+	prfAdrs := forsAddress(adrs, addrTypeFORSPRF, keyPair)
+
+	signature := make([]byte, 0, sigFORSSize)
+	roots := make([]byte, 0, sigFORSTrees*WOTSHashSize)
+	for i, selected := range indices {
+		base := uint32(i) << sigFORSHeight
+		level := make([][WOTSHashSize]byte, 1<<sigFORSHeight)
+		for j := range level {
+			prfAdrs.setTreeIndex(base + uint32(j))
+			secret := prfSecret(skSeed, pubSeed, &prfAdrs)
+			level[j] = forsLeaf(secret[:], base+uint32(j), pubSeed, treeAdrs)
+			if uint32(j) == selected {
+				signature = append(signature, secret[:]...)
+			}
+			SecureZero(secret[:])
+		}
+
+		// Climb to the root, recording the sibling on the selected path
+		index := selected
+		for height := 1; height <= sigFORSHeight; height++ {
+			sibling := level[index^1]
+			signature = append(signature, sibling[:]...)
+
+			parent := make([][WOTSHashSize]byte, len(level)/2)
+			for j := range parent {
+				nodeIndex := (base >> uint(height)) + uint32(j)
+				parent[j] = treeNode(pubSeed, treeAdrs, uint8(height), nodeIndex, level[2*j][:], level[2*j+1][:])
+			}
+			level = parent
+			index >>= 1
+		}
+		roots = append(roots, level[0][:]...)
+	}
+
+	rootsAdrs := forsAddress(adrs, addrTypeFORSRoots, keyPair)
+	return signature, thash(pubSeed, &rootsAdrs, roots)
+}
+
+// forsPublicKeyFromSignature recomputes the FORS public key a signature implies
+func forsPublicKeyFromSignature(signature []byte, indices [sigFORSTrees]uint32, pubSeed []byte, adrs hashAddress, keyPair uint32) [WOTSHashSize]byte {
+	treeAdrs := forsAddress(adrs, addrTypeFORSTree, keyPair)
+
+	roots := make([]byte, 0, sigFORSTrees*WOTSHashSize)
+	for i, selected := range indices {
+		part := signature[i*(sigFORSHeight+1)*WOTSHashSize : (i+1)*(sigFORSHeight+1)*WOTSHashSize]
+		index := uint32(i)<<sigFORSHeight + selected
+		leaf := forsLeaf(part[:WOTSHashSize], index, pubSeed, treeAdrs)
+		root := rootFromAuthPath(leaf, index, part[WOTSHashSize:], pubSeed, treeAdrs)
+		roots = append(roots, root[:]...)
+	}
+
+	rootsAdrs := forsAddress(adrs, addrTypeFORSRoots, keyPair)
+	return thash(pubSeed, &rootsAdrs, roots)
+}
+
+// sign produces the signature on message
+func (k *signingKey) sign(message []byte) Signature {
+	publicKey := k.publicKey()
+	randomness := sigRandomness(k.skPRF[:], publicKey, message)
+	indices, tree, leaf := sigMessageDigest(randomness, publicKey, message)
+
+	// The tree and leaf used on every layer follow from the digest, so the
+	// layer trees are independent and can be built in parallel
+	var trees [sigLayers]uint64
+	var leaves [sigLayers]uint32
+	for layer := 0; layer < sigLayers; layer++ {
+		trees[layer], leaves[layer] = tree, leaf
+		leaf = uint32(tree) & (1<<sigLayerHeight - 1)
+		tree >>= sigLayerHeight
+	}
+
+	var layerNodes [sigLayers][][][WOTSHashSize]byte
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for layer := offset; layer < sigLayers; layer += workers {
+				var adrs hashAddress
+				adrs.setLayer(uint8(layer))
+				adrs.setTree(trees[layer])
+				layerNodes[layer] = sigTree(k.skSeed[:], k.pubSeed[:], adrs)
+			}
+		}(w)
+	}
+
+	var adrs hashAddress
+	adrs.setTree(trees[0])
+	forsSignature, node := forsSign(indices, k.skSeed[:], k.pubSeed[:], adrs, leaves[0])
+	wg.Wait()
+
+	var signature Signature
+	copy(signature[:], randomness)
+	offset := WOTSHashSize
+	offset += copy(signature[offset:], forsSignature)
+
+	for layer := 0; layer < sigLayers; layer++ {
+		adrs.setLayer(uint8(layer))
+		adrs.setTree(trees[layer])
+		adrs.setType(addrTypeWOTSHash)
+		adrs.setKeyPair(leaves[layer])
+		offset += copy(signature[offset:], wotsSign(sigWOTSParams, node[:], k.skSeed[:], k.pubSeed[:], adrs))
+
+		nodes := layerNodes[layer]
+		for height := 0; height < sigLayerHeight; height++ {
+			sibling := nodes[height][(leaves[layer]>>uint(height))^1]
+			offset += copy(signature[offset:], sibling[:])
+		}
+		node = nodes[sigLayerHeight][0]
+	}
+
+	return signature
+}
+
+// Sign signs message with a private key. The signature is deterministic and
+// verifies against DerivePublicKey(privateKey); no state is kept between
+// signatures. A key erased with SecureErasePrivateKey returns ErrKeyDestroyed.
+func Sign(privateKey PrivateKey, message []byte) (Signature, error) {
+	if isErased(privateKey[:]) {
+		return Signature{}, ErrKeyDestroyed
+	}
+	if !IsValidPrivateKey(privateKey) {
+		return Signature{}, ErrInvalidPrivateKey
+	}
+
+	key := expandSigningKey(privateKey)
+	defer key.wipe()
+	return key.sign(message), nil
+}
+
+// Verify checks a signature on message against a public key
+func Verify(publicKey PublicKey, message []byte, signature Signature) bool {
+	pubSeed := publicKey[:WOTSHashSize]
+	randomness := signature[:WOTSHashSize]
+	indices, tree, leaf := sigMessageDigest(randomness, publicKey, message)
+
+	var adrs hashAddress
+	adrs.setTree(tree)
+	offset := WOTSHashSize
+	node := forsPublicKeyFromSignature(signature[offset:offset+sigFORSSize], indices, pubSeed, adrs, leaf)
+	offset += sigFORSSize
+
+	for layer := 0; layer < sigLayers; layer++ {
+		adrs.setLayer(uint8(layer))
+		adrs.setTree(tree)
+		adrs.setType(addrTypeWOTSHash)
+		adrs.setKeyPair(leaf)
+		wotsSignature := signature[offset : offset+sigWOTSLen*WOTSHashSize]
+		wotsPublicKey := wotsPublicKeyFromSignature(sigWOTSParams, wotsSignature, node[:], pubSeed, adrs)
+		offset += sigWOTSLen * WOTSHashSize
+
+		treeAdrs := adrs
+		treeAdrs.setType(addrTypeTree)
+		authPath := signature[offset : offset+sigLayerHeight*WOTSHashSize]
+		node = rootFromAuthPath(wotsPublicKey, leaf, authPath, pubSeed, treeAdrs)
+		offset += sigLayerHeight * WOTSHashSize
+
+		leaf = uint32(tree) & (1<<sigLayerHeight - 1)
+		tree >>= sigLayerHeight
+	}
+
+	return ConstantTimeEqual(node[:], publicKey[WOTSHashSize:])
+}
+
+// Compile-time checks that the key types follow the crypto package conventions
+var (
+	_ crypto.Signer = PrivateKey{}
+	_ interface {
+		Equal(crypto.PrivateKey) bool
+	} = PrivateKey{}
+	_ interface {
+		Equal(crypto.PublicKey) bool
+	} = PublicKey{}
+)
+
+// Public returns the public key, implementing crypto.Signer. Deriving it
+// rebuilds the top hypertree layer, so cache the result rather than calling
+// Public per signature.
+func (pk PrivateKey) Public() crypto.PublicKey {
+	return DerivePublicKey(pk)
+}
+
+// Sign signs message, implementing crypto.Signer. As with Ed25519 the
+// message is signed whole rather than pre-hashed, so opts must be nil or
+// have a zero HashFunc. rand is unused since signatures are deterministic.
+// The result is a Signature's bytes.
+func (pk PrivateKey) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts != nil && opts.HashFunc() != 0 {
+		return nil, ErrUnsupportedHash
+	}
+	signature, err := Sign(pk, message)
+	if err != nil {
+		return nil, err
+	}
+	return signature[:], nil
+}
+
+// Equal reports whether x is the same private key, in constant time
+func (pk PrivateKey) Equal(x crypto.PrivateKey) bool {
+	other, ok := x.(PrivateKey)
+	return ok && ConstantTimeEqual(pk[:], other[:])
+}
+
+// Equal reports whether x is the same public key
+func (pk PublicKey) Equal(x crypto.PublicKey) bool {
+	other, ok := x.(PublicKey)
+	return ok && pk == other
+}
+
+// BatchSign signs several messages with one private key in parallel
+func BatchSign(privateKey PrivateKey, messages [][]byte) ([]Signature, error) {
+	if len(messages) == 0 {
+		return nil, ErrEmptyData
+	}
+	if err := checkBatchSize(len(messages)); err != nil {
+		return nil, err
+	}
+	if !IsValidPrivateKey(privateKey) {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	key := expandSigningKey(privateKey)
+	defer key.wipe()
+
+	signatures := make([]Signature, len(messages))
+	parallelBatch(len(messages), func(index int) {
+		signatures[index] = key.sign(messages[index])
+	})
+	return signatures, nil
+}
+
+// BatchVerify checks several signatures in parallel and reports which are
+// valid. The slices must have equal lengths
+func BatchVerify(publicKeys []PublicKey, messages [][]byte, signatures []Signature) ([]bool, error) {
+	if len(publicKeys) != len(messages) || len(messages) != len(signatures) {
+		return nil, ErrInvalidFragmentCount
+	}
+	if len(messages) == 0 {
+		return nil, ErrEmptyData
+	}
+	if err := checkBatchSize(len(messages)); err != nil {
+		return nil, err
+	}
+
+	valid := make([]bool, len(messages))
+	parallelBatch(len(messages), func(index int) {
+		valid[index] = Verify(publicKeys[index], messages[index], signatures[index])
+	})
+	return valid, nil
+}
+
+// parallelBatch calls work for every index in [0, count) on
+// OptimalThreadCount workers; work must only write its own result slot
+func parallelBatch(count int, work func(index int)) {
+	numWorkers := OptimalThreadCount()
+	if numWorkers > count {
+		numWorkers = count
+	}
+
+	workChan := make(chan int, count)
+	for i := 0; i < count; i++ {
+		workChan <- i
+	}
+	close(workChan)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range workChan {
+				work(index)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,13 +1,21 @@
 package topayz512
 
-import (
-	"sync"
-	"unsafe"
-)
+import "sync"
 
 // SIMD and vectorized operations for high-performance computing
-
-// SIMDCapabilities represents available SIMD instruction sets
+//
+// On arm64, VectorizedXOR, VectorizedAND and VectorizedOR hand whole 64-byte
+// blocks to NEON kernels in simd_arm64.s when NEON is enabled, and finish
+// with the portable loops. Hash block processing needs no kernel of its
+// own: crypto/sha512 already uses the ARMv8.2 SHA-512 instructions.
+//
+// The word-at-a-time loops load and store through loadWord and storeWord.
+// By default they reinterpret the slice memory with package unsafe; the
+// purego build tag replaces them with encoding/binary, so the package builds
+// without unsafe for platforms and reviews that forbid it.
+
+// SIMDCapabilities represents available SIMD instruction sets. AVX512 is
+// AVX-512 Foundation and NEON the arm64 Advanced SIMD extension.
 type SIMDCapabilities struct {
 	SSE2   bool
 	SSE3   bool
@@ -17,26 +25,60 @@ type SIMDCapabilities struct {
 	AVX    bool
 	AVX2   bool
 	AVX512 bool
+	NEON   bool
 }
 
-// DetectSIMDCapabilities detects available SIMD instruction sets
+// DetectSIMDCapabilities detects the instruction sets the CPU and OS
+// support: with CPUID on amd64, and NEON on arm64. Builds with the purego
+// tag can't execute CPUID and report only the amd64 baseline, SSE2.
 func DetectSIMDCapabilities() SIMDCapabilities {
-	// Simplified detection - in production, use proper CPUID detection
-	return SIMDCapabilities{
-		SSE2:   true, // Assume SSE2 is available (required by Go)
-		SSE3:   true,
-		SSSE3:  true,
-		SSE41:  true,
-		SSE42:  true,
-		AVX:    true, // Most modern CPUs support AVX
-		AVX2:   true,
-		AVX512: false, // Conservative assumption
-	}
+	return detectSIMD()
+}
+
+// Capabilities returns the instruction sets the package uses: those
+// detected, less any ImportRuntimeState disabled
+func Capabilities() SIMDCapabilities {
+	return simdCaps
+}
+
+// vector reports whether the word-at-a-time loops are enabled
+func (c SIMDCapabilities) vector() bool {
+	return c.SSE2 || c.NEON
 }
 
 // Global SIMD capabilities
 var simdCaps = DetectSIMDCapabilities()
 
+// simdFeature names one SIMDCapabilities field
+type simdFeature struct {
+	name  string
+	field func(*SIMDCapabilities) *bool
+}
+
+// simdFeatures lists the instruction sets in SIMDCapabilities
+var simdFeatures = []simdFeature{
+	{"sse2", func(c *SIMDCapabilities) *bool { return &c.SSE2 }},
+	{"sse3", func(c *SIMDCapabilities) *bool { return &c.SSE3 }},
+	{"ssse3", func(c *SIMDCapabilities) *bool { return &c.SSSE3 }},
+	{"sse4.1", func(c *SIMDCapabilities) *bool { return &c.SSE41 }},
+	{"sse4.2", func(c *SIMDCapabilities) *bool { return &c.SSE42 }},
+	{"avx", func(c *SIMDCapabilities) *bool { return &c.AVX }},
+	{"avx2", func(c *SIMDCapabilities) *bool { return &c.AVX2 }},
+	{"avx512", func(c *SIMDCapabilities) *bool { return &c.AVX512 }},
+	{"neon", func(c *SIMDCapabilities) *bool { return &c.NEON }},
+}
+
+// Features returns the lowercase names of the available instruction sets
+func (c SIMDCapabilities) Features() []string {
+	features := []string{}
+	for _, feature := range simdFeatures {
+		if *feature.field(&c) {
+			features = append(features, feature.name)
+		}
+	}
+	return features
+}
+
 // VectorizedXOR performs XOR operation on aligned byte slices
 func VectorizedXOR(dst, src1, src2 []byte) {
 	if len(dst) != len(src1) || len(src1) != len(src2) {
@@ -45,13 +87,14 @@ func VectorizedXOR(dst, src1, src2 []byte) {
 
 	n := len(dst)
 
+	// NEON handles the whole 64-byte blocks on arm64
+	start := xorBlocks(dst, src1, src2)
+
 	// Process 8 bytes at a time using uint64
-	if n >= 8 && simdCaps.SSE2 {
+	if n >= 8 && simdCaps.vector() {
 		// Ensure alignment for better performance
-		for i := 0; i < n-7; i += 8 {
-			*(*uint64)(unsafe.Pointer(&dst[i])) =
-				*(*uint64)(unsafe.Pointer(&src1[i])) ^
-					*(*uint64)(unsafe.Pointer(&src2[i]))
+		for i := start; i < n-7; i += 8 {
+			storeWord(dst, i, loadWord(src1, i)^loadWord(src2, i))
 		}
 
 		// Handle remaining bytes
@@ -60,7 +103,7 @@ func VectorizedXOR(dst, src1, src2 []byte) {
 		}
 	} else {
 		// Fallback to byte-by-byte operation
-		for i := 0; i < n; i++ {
+		for i := start; i < n; i++ {
 			dst[i] = src1[i] ^ src2[i]
 		}
 	}
@@ -74,12 +117,13 @@ func VectorizedAND(dst, src1, src2 []byte) {
 
 	n := len(dst)
 
+	// NEON handles the whole 64-byte blocks on arm64
+	start := andBlocks(dst, src1, src2)
+
 	// Process 8 bytes at a time using uint64
-	if n >= 8 && simdCaps.SSE2 {
-		for i := 0; i < n-7; i += 8 {
-			*(*uint64)(unsafe.Pointer(&dst[i])) =
-				*(*uint64)(unsafe.Pointer(&src1[i])) &
-					*(*uint64)(unsafe.Pointer(&src2[i]))
+	if n >= 8 && simdCaps.vector() {
+		for i := start; i < n-7; i += 8 {
+			storeWord(dst, i, loadWord(src1, i)&loadWord(src2, i))
 		}
 
 		// Handle remaining bytes
@@ -88,7 +132,7 @@ func VectorizedAND(dst, src1, src2 []byte) {
 		}
 	} else {
 		// Fallback to byte-by-byte operation
-		for i := 0; i < n; i++ {
+		for i := start; i < n; i++ {
 			dst[i] = src1[i] & src2[i]
 		}
 	}
@@ -102,12 +146,13 @@ func VectorizedOR(dst, src1, src2 []byte) {
 
 	n := len(dst)
 
+	// NEON handles the whole 64-byte blocks on arm64
+	start := orBlocks(dst, src1, src2)
+
 	// Process 8 bytes at a time using uint64
-	if n >= 8 && simdCaps.SSE2 {
-		for i := 0; i < n-7; i += 8 {
-			*(*uint64)(unsafe.Pointer(&dst[i])) =
-				*(*uint64)(unsafe.Pointer(&src1[i])) |
-					*(*uint64)(unsafe.Pointer(&src2[i]))
+	if n >= 8 && simdCaps.vector() {
+		for i := start; i < n-7; i += 8 {
+			storeWord(dst, i, loadWord(src1, i)|loadWord(src2, i))
 		}
 
 		// Handle remaining bytes
@@ -116,7 +161,7 @@ func VectorizedOR(dst, src1, src2 []byte) {
 		}
 	} else {
 		// Fallback to byte-by-byte operation
-		for i := 0; i < n; i++ {
+		for i := start; i < n; i++ {
 			dst[i] = src1[i] | src2[i]
 		}
 	}
@@ -137,11 +182,10 @@ func FastMemCopy(dst, src []byte) {
 	}
 
 	// For larger sizes, use word-aligned copying
-	if n >= 8 && simdCaps.SSE2 {
+	if n >= 8 && simdCaps.vector() {
 		// Copy 8 bytes at a time
 		for i := 0; i < n-7; i += 8 {
-			*(*uint64)(unsafe.Pointer(&dst[i])) =
-				*(*uint64)(unsafe.Pointer(&src[i]))
+			storeWord(dst, i, loadWord(src, i))
 		}
 
 		// Handle remaining bytes
@@ -176,9 +220,9 @@ func FastMemSet(dst []byte, value byte) {
 	pattern |= pattern << 32
 
 	// Set 8 bytes at a time
-	if n >= 8 && simdCaps.SSE2 {
+	if n >= 8 && simdCaps.vector() {
 		for i := 0; i < n-7; i += 8 {
-			*(*uint64)(unsafe.Pointer(&dst[i])) = pattern
+			storeWord(dst, i, pattern)
 		}
 
 		// Handle remaining bytes
@@ -217,10 +261,9 @@ func VectorizedConstantTimeEqual(a, b []byte) bool {
 	var result uint64
 
 	// Process 8 bytes at a time
-	if n >= 8 && simdCaps.SSE2 {
+	if n >= 8 && simdCaps.vector() {
 		for i := 0; i < n-7; i += 8 {
-			diff := *(*uint64)(unsafe.Pointer(&a[i])) ^
-				*(*uint64)(unsafe.Pointer(&b[i]))
+			diff := loadWord(a, i) ^ loadWord(b, i)
 			result |= diff
 		}
 
@@ -0,0 +1,49 @@
+//go:build !purego
+
+package topayz512
+
+// NEON kernels in simd_arm64.s; each handles the whole 64-byte blocks of
+// equal-length slices
+func xorNEON(dst, a, b []byte)
+func andNEON(dst, a, b []byte)
+func orNEON(dst, a, b []byte)
+
+// neonBlock is the stride of the NEON kernels
+const neonBlock = 64
+
+// neonBytes returns how many leading bytes of an n-byte operation the NEON
+// kernels should handle: its whole blocks, if NEON is enabled
+func neonBytes(n int) int {
+	if !simdCaps.NEON {
+		return 0
+	}
+	return n &^ (neonBlock - 1)
+}
+
+// xorBlocks XORs the leading blocks of src1 and src2 into dst with NEON and
+// returns the number of bytes done
+func xorBlocks(dst, src1, src2 []byte) int {
+	done := neonBytes(len(dst))
+	if done > 0 {
+		xorNEON(dst[:done], src1[:done], src2[:done])
+	}
+	return done
+}
+
+// andBlocks is xorBlocks for AND
+func andBlocks(dst, src1, src2 []byte) int {
+	done := neonBytes(len(dst))
+	if done > 0 {
+		andNEON(dst[:done], src1[:done], src2[:done])
+	}
+	return done
+}
+
+// orBlocks is xorBlocks for OR
+func orBlocks(dst, src1, src2 []byte) int {
+	done := neonBytes(len(dst))
+	if done > 0 {
+		orNEON(dst[:done], src1[:done], src2[:done])
+	}
+	return done
+}
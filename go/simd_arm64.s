@@ -0,0 +1,76 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// Each kernel processes the whole 64-byte blocks of len(dst), four NEON
+// registers at a time, and leaves the rest to the caller. Blocks are loaded
+// before they are stored, so dst may alias a or b.
+
+// func xorNEON(dst, a, b []byte)
+TEXT ·xorNEON(SB), NOSPLIT, $0-72
+	MOVD dst_base+0(FP), R0
+	MOVD dst_len+8(FP), R3
+	MOVD a_base+24(FP), R1
+	MOVD b_base+48(FP), R2
+	LSR  $6, R3, R3
+	CBZ  R3, xorDone
+
+xorLoop:
+	VLD1.P 64(R1), [V0.B16, V1.B16, V2.B16, V3.B16]
+	VLD1.P 64(R2), [V4.B16, V5.B16, V6.B16, V7.B16]
+	VEOR   V0.B16, V4.B16, V4.B16
+	VEOR   V1.B16, V5.B16, V5.B16
+	VEOR   V2.B16, V6.B16, V6.B16
+	VEOR   V3.B16, V7.B16, V7.B16
+	VST1.P [V4.B16, V5.B16, V6.B16, V7.B16], 64(R0)
+	SUBS   $1, R3, R3
+	BNE    xorLoop
+
+xorDone:
+	RET
+
+// func andNEON(dst, a, b []byte)
+TEXT ·andNEON(SB), NOSPLIT, $0-72
+	MOVD dst_base+0(FP), R0
+	MOVD dst_len+8(FP), R3
+	MOVD a_base+24(FP), R1
+	MOVD b_base+48(FP), R2
+	LSR  $6, R3, R3
+	CBZ  R3, andDone
+
+andLoop:
+	VLD1.P 64(R1), [V0.B16, V1.B16, V2.B16, V3.B16]
+	VLD1.P 64(R2), [V4.B16, V5.B16, V6.B16, V7.B16]
+	VAND   V0.B16, V4.B16, V4.B16
+	VAND   V1.B16, V5.B16, V5.B16
+	VAND   V2.B16, V6.B16, V6.B16
+	VAND   V3.B16, V7.B16, V7.B16
+	VST1.P [V4.B16, V5.B16, V6.B16, V7.B16], 64(R0)
+	SUBS   $1, R3, R3
+	BNE    andLoop
+
+andDone:
+	RET
+
+// func orNEON(dst, a, b []byte)
+TEXT ·orNEON(SB), NOSPLIT, $0-72
+	MOVD dst_base+0(FP), R0
+	MOVD dst_len+8(FP), R3
+	MOVD a_base+24(FP), R1
+	MOVD b_base+48(FP), R2
+	LSR  $6, R3, R3
+	CBZ  R3, orDone
+
+orLoop:
+	VLD1.P 64(R1), [V0.B16, V1.B16, V2.B16, V3.B16]
+	VLD1.P 64(R2), [V4.B16, V5.B16, V6.B16, V7.B16]
+	VORR   V0.B16, V4.B16, V4.B16
+	VORR   V1.B16, V5.B16, V5.B16
+	VORR   V2.B16, V6.B16, V6.B16
+	VORR   V3.B16, V7.B16, V7.B16
+	VST1.P [V4.B16, V5.B16, V6.B16, V7.B16], 64(R0)
+	SUBS   $1, R3, R3
+	BNE    orLoop
+
+orDone:
+	RET
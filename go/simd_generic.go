@@ -0,0 +1,19 @@
+//go:build !arm64 || purego
+
+package topayz512
+
+// xorBlocks has no assembly kernel on this platform and does nothing; the
+// word-at-a-time loop handles every byte
+func xorBlocks(dst, src1, src2 []byte) int {
+	return 0
+}
+
+// andBlocks is xorBlocks for AND
+func andBlocks(dst, src1, src2 []byte) int {
+	return 0
+}
+
+// orBlocks is xorBlocks for OR
+func orBlocks(dst, src1, src2 []byte) int {
+	return 0
+}
@@ -0,0 +1,20 @@
+//go:build purego
+
+package topayz512
+
+import "encoding/binary"
+
+// PureGo reports whether the package was built with the purego tag
+const PureGo = true
+
+// loadWord reads the 8 bytes of b at i as one little-endian word. The word
+// loops only combine words bytewise, so the byte order doesn't matter as long
+// as storeWord uses the same one.
+func loadWord(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i:])
+}
+
+// storeWord writes w to the 8 bytes of b at i in little-endian order
+func storeWord(b []byte, i int, w uint64) {
+	binary.LittleEndian.PutUint64(b[i:], w)
+}
@@ -0,0 +1,20 @@
+//go:build !purego
+
+package topayz512
+
+import "unsafe"
+
+// PureGo reports whether the package was built with the purego tag
+const PureGo = false
+
+// loadWord reads the 8 bytes of b at i as one native-endian word
+func loadWord(b []byte, i int) uint64 {
+	_ = b[i+7]
+	return *(*uint64)(unsafe.Pointer(&b[i]))
+}
+
+// storeWord writes w to the 8 bytes of b at i in native byte order
+func storeWord(b []byte, i int, w uint64) {
+	_ = b[i+7]
+	*(*uint64)(unsafe.Pointer(&b[i])) = w
+}
@@ -0,0 +1,232 @@
+package topayz512
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Per-tenant isolation
+//
+// A process serving many tenants can give each one a Suite. A Suite owns its
+// buffer pool, hash state pool and worker pool, so no tenant can observe or
+// exhaust another's pooled memory or workers, and it rate limits and
+// accounts the operations run through it.
+
+// SuiteOptions configures a Suite
+type SuiteOptions struct {
+	// Workers is the size of the suite's worker pool; zero uses OptimalThreadCount
+	Workers int
+	// OperationsPerSecond limits the suite's operations; zero is unlimited
+	OperationsPerSecond float64
+	// Burst is how many operations may run at once above the steady rate;
+	// zero uses one second's worth, at least one
+	Burst int
+}
+
+// SuiteUsage reports the resources one tenant has consumed
+type SuiteUsage struct {
+	Tenant string `json:"tenant"`
+	// Operations counts the operations that ran
+	Operations uint64 `json:"operations"`
+	// Throttled counts the operations refused by the rate limit
+	Throttled uint64 `json:"throttled"`
+	// BytesIn and BytesOut count the data passed in and returned
+	BytesIn  uint64 `json:"bytes_in"`
+	BytesOut uint64 `json:"bytes_out"`
+	// CPUTime is the time spent running the suite's operations and
+	// submitted work. The operations are CPU-bound, so this tracks their
+	// processor time closely.
+	CPUTime time.Duration `json:"cpu_time"`
+}
+
+// Suite runs TOPAY-Z512 operations for one tenant with isolated pools, a
+// rate limit and usage accounting. It is safe for concurrent use.
+type Suite struct {
+	tenant  string
+	buffers *BytePool
+	hashes  *HashStatePool
+	workers *WorkerPool
+	limiter *tokenBucket
+
+	operations atomic.Uint64
+	throttled  atomic.Uint64
+	bytesIn    atomic.Uint64
+	bytesOut   atomic.Uint64
+	cpuTime    atomic.Int64
+
+	closed atomic.Bool
+}
+
+// NewSuite creates a suite for tenant; nil options use the defaults
+func NewSuite(tenant string, opts *SuiteOptions) *Suite {
+	var options SuiteOptions
+	if opts != nil {
+		options = *opts
+	}
+
+	s := &Suite{
+		tenant:  tenant,
+		buffers: NewBytePool(),
+		hashes:  NewHashStatePool(),
+		workers: NewWorkerPool(options.Workers),
+	}
+	if options.OperationsPerSecond > 0 {
+		s.limiter = newTokenBucket(options.OperationsPerSecond, options.Burst)
+	}
+	return s
+}
+
+// Tenant returns the tenant the suite was created for
+func (s *Suite) Tenant() string {
+	return s.tenant
+}
+
+// begin admits one operation, returning ErrServiceClosed after Close and
+// ErrRateLimited when the tenant is over its rate
+func (s *Suite) begin() (time.Time, error) {
+	if s.closed.Load() {
+		return time.Time{}, ErrServiceClosed
+	}
+	if s.limiter != nil && !s.limiter.take(time.Now()) {
+		s.throttled.Add(1)
+		return time.Time{}, ErrRateLimited
+	}
+	return time.Now(), nil
+}
+
+// end accounts one finished operation
+func (s *Suite) end(start time.Time, bytesIn, bytesOut int) {
+	s.operations.Add(1)
+	s.bytesIn.Add(uint64(bytesIn))
+	s.bytesOut.Add(uint64(bytesOut))
+	s.cpuTime.Add(int64(time.Since(start)))
+}
+
+// Hash computes the hash of data with the suite's hash state pool
+func (s *Suite) Hash(data []byte) (Hash, error) {
+	start, err := s.begin()
+	if err != nil {
+		return Hash{}, err
+	}
+	hs := s.hashes.Get()
+	hs.Update(data)
+	hash := hs.Finalize()
+	s.hashes.Put(hs)
+	s.end(start, len(data), HashSize)
+	return hash, nil
+}
+
+// KEMKeyGen generates a KEM key pair
+func (s *Suite) KEMKeyGen() (KEMPublicKey, KEMSecretKey, error) {
+	start, err := s.begin()
+	if err != nil {
+		return KEMPublicKey{}, KEMSecretKey{}, err
+	}
+	publicKey, secretKey, err := KEMKeyGen()
+	s.end(start, 0, KEMPublicKeySize+KEMSecretKeySize)
+	return publicKey, secretKey, err
+}
+
+// KEMEncapsulate encapsulates a shared secret to publicKey
+func (s *Suite) KEMEncapsulate(publicKey KEMPublicKey) (Ciphertext, SharedSecret, error) {
+	start, err := s.begin()
+	if err != nil {
+		return Ciphertext{}, SharedSecret{}, err
+	}
+	ciphertext, sharedSecret, err := KEMEncapsulate(publicKey)
+	s.end(start, KEMPublicKeySize, CiphertextSize+SharedSecretSize)
+	return ciphertext, sharedSecret, err
+}
+
+// KEMDecapsulate recovers the shared secret of a ciphertext
+func (s *Suite) KEMDecapsulate(secretKey KEMSecretKey, ciphertext Ciphertext) (SharedSecret, error) {
+	start, err := s.begin()
+	if err != nil {
+		return SharedSecret{}, err
+	}
+	sharedSecret, err := KEMDecapsulate(secretKey, ciphertext)
+	s.end(start, KEMSecretKeySize+CiphertextSize, SharedSecretSize)
+	return sharedSecret, err
+}
+
+// GetBuffer retrieves a buffer from the suite's pool
+func (s *Suite) GetBuffer(size int) []byte {
+	return s.buffers.Get(size)
+}
+
+// PutBuffer returns a buffer to the suite's pool, clearing it
+func (s *Suite) PutBuffer(buf []byte) {
+	s.buffers.Put(buf)
+}
+
+// Submit runs work on the suite's worker pool, counting it as one operation
+// and its running time as CPU time
+func (s *Suite) Submit(work func()) error {
+	if _, err := s.begin(); err != nil {
+		return err
+	}
+	s.workers.Submit(func() {
+		// Work that panics is still accounted; the pool recovers the panic
+		start := time.Now()
+		defer s.end(start, 0, 0)
+		work()
+	})
+	return nil
+}
+
+// Usage returns the resources consumed so far
+func (s *Suite) Usage() SuiteUsage {
+	return SuiteUsage{
+		Tenant:     s.tenant,
+		Operations: s.operations.Load(),
+		Throttled:  s.throttled.Load(),
+		BytesIn:    s.bytesIn.Load(),
+		BytesOut:   s.bytesOut.Load(),
+		CPUTime:    time.Duration(s.cpuTime.Load()),
+	}
+}
+
+// Close stops the suite's workers after queued work finishes. Later
+// operations return ErrServiceClosed.
+func (s *Suite) Close() {
+	if s.closed.Swap(true) {
+		return
+	}
+	s.workers.Close()
+}
+
+// tokenBucket is a rate limiter refilling rate tokens per second up to burst
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// newTokenBucket creates a full bucket
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	capacity := float64(burst)
+	if burst <= 0 {
+		capacity = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: capacity, tokens: capacity, last: time.Now()}
+}
+
+// take removes one token if available
+func (tb *tokenBucket) take(now time.Time) bool {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens = math.Min(tb.burst, tb.tokens+elapsed.Seconds()*tb.rate)
+		tb.last = now
+	}
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package termio
+
+import "errors"
+
+// isTerminal reports false: echo control is unsupported on this platform, so
+// input is read as a plain line
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+// disableEcho is unsupported on this platform
+func disableEcho(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("termio: echo control unsupported on this platform")
+}
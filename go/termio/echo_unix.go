@@ -0,0 +1,48 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package termio
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal reports whether fd refers to a terminal
+func isTerminal(fd uintptr) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// disableEcho turns off echo on fd and returns a function restoring the
+// previous attributes
+func disableEcho(fd uintptr) (restore func(), err error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := *old
+	hidden.Lflag &^= syscall.ECHO
+	hidden.Lflag |= syscall.ICANON | syscall.ISIG
+	if err := setTermios(fd, &hidden); err != nil {
+		return nil, err
+	}
+	return func() { setTermios(fd, old) }, nil
+}
+
+// getTermios reads the terminal attributes of fd
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	var termios syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return nil, errno
+	}
+	return &termios, nil
+}
+
+// setTermios sets the terminal attributes of fd
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package termio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// pinentryRequest describes one GETPIN exchange
+type pinentryRequest struct {
+	prompt      string
+	description string
+	errorText   string
+
+	// repeat asks pinentry to confirm the passphrase with this prompt
+	repeat string
+}
+
+// runPinentry starts the pinentry program at path and asks it for a passphrase
+func runPinentry(path string, request pinentryRequest) ([]byte, error) {
+	cmd := exec.Command(path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("termio: starting pinentry: %w", err)
+	}
+
+	passphrase, err := pinentrySession(stdout, stdin, request)
+	stdin.Close()
+	cmd.Wait()
+	return passphrase, err
+}
+
+// pinentrySession speaks the Assuan protocol to a pinentry reading from r
+// and writing to w
+func pinentrySession(r io.Reader, w io.Writer, request pinentryRequest) ([]byte, error) {
+	reader := bufio.NewReaderSize(r, 4*maxPassphraseLength)
+	if _, err := pinentryResponse(reader); err != nil {
+		return nil, err
+	}
+
+	commands := []string{"SETPROMPT " + request.prompt}
+	if request.description != "" {
+		commands = append(commands, "SETDESC "+request.description)
+	}
+	if request.errorText != "" {
+		commands = append(commands, "SETERROR "+request.errorText)
+	}
+	if request.repeat != "" {
+		commands = append(commands, "SETREPEAT "+request.repeat, "SETREPEATERROR "+ErrMismatch.Error())
+	}
+	for _, command := range commands {
+		if _, err := fmt.Fprintf(w, "%s\n", assuanEscape(command)); err != nil {
+			return nil, err
+		}
+		if _, err := pinentryResponse(reader); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := io.WriteString(w, "GETPIN\n"); err != nil {
+		return nil, err
+	}
+	passphrase, err := pinentryResponse(reader)
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(w, "BYE\n")
+
+	if passphrase == nil {
+		passphrase = []byte{}
+	}
+	return passphrase, nil
+}
+
+// pinentryResponse reads lines up to OK or ERR and returns the decoded data
+// lines. Raw lines are erased in the reader's buffer once decoded
+func pinentryResponse(reader *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			wipe(line)
+			wipe(data)
+			if err == bufio.ErrBufferFull {
+				return nil, ErrPassphraseTooLong
+			}
+			return nil, fmt.Errorf("termio: pinentry: %w", err)
+		}
+		content := bytes.TrimRight(line, "\r\n")
+
+		switch {
+		case bytes.Equal(content, []byte("OK")) || bytes.HasPrefix(content, []byte("OK ")):
+			return data, nil
+		case bytes.HasPrefix(content, []byte("ERR ")):
+			message := string(content[4:])
+			wipe(data)
+			if strings.Contains(strings.ToLower(message), "cancel") {
+				return nil, ErrCancelled
+			}
+			return nil, errors.New("termio: pinentry: " + message)
+		case bytes.HasPrefix(content, []byte("D ")):
+			decoded, err := assuanUnescape(data, content[2:])
+			wipe(line)
+			if err != nil {
+				wipe(data)
+				return nil, err
+			}
+			data = decoded
+		}
+	}
+}
+
+// assuanEscape percent-escapes the characters Assuan lines cannot carry
+func assuanEscape(command string) string {
+	replacer := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	return replacer.Replace(command)
+}
+
+// assuanUnescape appends the percent-decoded data to dst, erasing dst if it
+// has to grow
+func assuanUnescape(dst, data []byte) ([]byte, error) {
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c == '%' {
+			if i+2 >= len(data) {
+				return dst, errors.New("termio: pinentry: invalid escape")
+			}
+			hi, okHi := unhex(data[i+1])
+			lo, okLo := unhex(data[i+2])
+			if !okHi || !okLo {
+				return dst, errors.New("termio: pinentry: invalid escape")
+			}
+			c = hi<<4 | lo
+			i += 2
+		}
+
+		if len(dst) == cap(dst) {
+			grown := make([]byte, len(dst), 2*cap(dst)+maxPassphraseLength)
+			copy(grown, dst)
+			wipe(dst)
+			dst = grown
+		}
+		dst = append(dst, c)
+	}
+	return dst, nil
+}
+
+// unhex decodes a hex digit
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
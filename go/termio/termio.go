@@ -0,0 +1,284 @@
+// Package termio reads passphrases for command-line tools. It hides terminal
+// input, confirms new passphrases, limits retries and can delegate entry to a
+// pinentry program, so tools unlocking TOPAY-Z512 keys share one
+// implementation of the passphrase UX.
+//
+// Passphrases are returned as byte slices that the caller should erase with
+// topayz512.SecureZero once they are no longer needed; termio erases every
+// intermediate buffer it allocates itself.
+package termio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultMaxAttempts is the number of tries a Prompter allows by default
+const DefaultMaxAttempts = 3
+
+// maxPassphraseLength bounds a single passphrase read
+const maxPassphraseLength = 1024
+
+var (
+	// ErrMismatch indicates the confirmation did not match the passphrase
+	ErrMismatch = errors.New("passphrases do not match")
+
+	// ErrEmptyPassphrase indicates an empty passphrase was entered where one is required
+	ErrEmptyPassphrase = errors.New("empty passphrase")
+
+	// ErrTooManyAttempts indicates the retry limit was reached
+	ErrTooManyAttempts = errors.New("too many attempts")
+
+	// ErrCancelled indicates the user cancelled passphrase entry
+	ErrCancelled = errors.New("passphrase entry cancelled")
+
+	// ErrPassphraseTooLong indicates the input exceeded the length limit
+	ErrPassphraseTooLong = errors.New("passphrase too long")
+)
+
+// Options configures a Prompter
+type Options struct {
+	// Input is read for passphrases; nil means os.Stdin. Echo is disabled
+	// while reading when Input is a terminal
+	Input io.Reader
+
+	// Output receives prompts; nil means os.Stderr
+	Output io.Writer
+
+	// MaxAttempts limits retries in ReadNewPassphrase and Unlock; zero means
+	// DefaultMaxAttempts
+	MaxAttempts int
+
+	// AllowEmpty accepts empty passphrases
+	AllowEmpty bool
+
+	// Pinentry is the path of a pinentry program to use instead of Input and
+	// Output; empty reads from the terminal
+	Pinentry string
+
+	// Description is shown by pinentry above the prompt
+	Description string
+}
+
+// Prompter reads passphrases interactively
+type Prompter struct {
+	input       io.Reader
+	output      io.Writer
+	maxAttempts int
+	allowEmpty  bool
+	pinentry    string
+	description string
+}
+
+// NewPrompter creates a Prompter. A nil opts uses the defaults
+func NewPrompter(opts *Options) *Prompter {
+	p := &Prompter{
+		input:       os.Stdin,
+		output:      os.Stderr,
+		maxAttempts: DefaultMaxAttempts,
+	}
+	if opts == nil {
+		return p
+	}
+
+	if opts.Input != nil {
+		p.input = opts.Input
+	}
+	if opts.Output != nil {
+		p.output = opts.Output
+	}
+	if opts.MaxAttempts > 0 {
+		p.maxAttempts = opts.MaxAttempts
+	}
+	p.allowEmpty = opts.AllowEmpty
+	p.pinentry = opts.Pinentry
+	p.description = opts.Description
+	return p
+}
+
+// ReadPassphrase prompts once and returns the passphrase
+func (p *Prompter) ReadPassphrase(prompt string) ([]byte, error) {
+	return p.read(prompt, nil)
+}
+
+// read prompts once, showing the previous attempt's error through pinentry
+func (p *Prompter) read(prompt string, previous error) ([]byte, error) {
+	if p.pinentry != "" {
+		request := pinentryRequest{
+			prompt:      prompt,
+			description: p.description,
+		}
+		if previous != nil {
+			request.errorText = previous.Error()
+		}
+		passphrase, err := runPinentry(p.pinentry, request)
+		if err == nil && len(passphrase) == 0 && !p.allowEmpty {
+			return nil, ErrEmptyPassphrase
+		}
+		return passphrase, err
+	}
+
+	passphrase, err := p.readHidden(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 && !p.allowEmpty {
+		return nil, ErrEmptyPassphrase
+	}
+	return passphrase, nil
+}
+
+// ReadNewPassphrase prompts for a new passphrase and its confirmation,
+// retrying on a mismatch or empty entry until MaxAttempts is reached
+func (p *Prompter) ReadNewPassphrase(prompt, confirmPrompt string) ([]byte, error) {
+	var last error
+	for attempt := 0; attempt < p.maxAttempts; attempt++ {
+		if p.pinentry != "" {
+			request := pinentryRequest{
+				prompt:      prompt,
+				description: p.description,
+				repeat:      confirmPrompt,
+			}
+			if last != nil {
+				request.errorText = last.Error()
+			}
+			passphrase, err := runPinentry(p.pinentry, request)
+			if err == nil && len(passphrase) == 0 && !p.allowEmpty {
+				err = ErrEmptyPassphrase
+			}
+			if err == ErrEmptyPassphrase || err == ErrMismatch {
+				last = err
+				continue
+			}
+			return passphrase, err
+		}
+
+		passphrase, err := p.ReadPassphrase(prompt)
+		if err == ErrEmptyPassphrase {
+			last = err
+			fmt.Fprintln(p.output, "Passphrase must not be empty.")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		confirmation, err := p.readHidden(confirmPrompt)
+		if err != nil {
+			wipe(passphrase)
+			return nil, err
+		}
+		match := equal(passphrase, confirmation)
+		wipe(confirmation)
+		if match {
+			return passphrase, nil
+		}
+
+		wipe(passphrase)
+		last = ErrMismatch
+		fmt.Fprintln(p.output, "Passphrases do not match.")
+	}
+	return nil, fmt.Errorf("%w: %v", ErrTooManyAttempts, last)
+}
+
+// Unlock prompts for a passphrase and passes it to unlock, retrying while
+// unlock fails until MaxAttempts is reached. The passphrase is erased after
+// every attempt, so unlock must not retain it
+func (p *Prompter) Unlock(prompt string, unlock func(passphrase []byte) error) error {
+	var last error
+	for attempt := 0; attempt < p.maxAttempts; attempt++ {
+		passphrase, err := p.read(prompt, last)
+		if err == ErrEmptyPassphrase {
+			last = err
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		last = unlock(passphrase)
+		wipe(passphrase)
+		if last == nil {
+			return nil
+		}
+		if p.pinentry == "" {
+			fmt.Fprintf(p.output, "Unlock failed: %v\n", last)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrTooManyAttempts, last)
+}
+
+// readHidden writes prompt and reads one line with echo disabled when the
+// input is a terminal
+func (p *Prompter) readHidden(prompt string) ([]byte, error) {
+	fmt.Fprint(p.output, prompt)
+
+	if f, ok := p.input.(interface{ Fd() uintptr }); ok && isTerminal(f.Fd()) {
+		restore, err := disableEcho(f.Fd())
+		if err != nil {
+			return nil, err
+		}
+		defer fmt.Fprintln(p.output)
+		defer restore()
+	}
+	return readLine(p.input)
+}
+
+// readLine reads up to a newline one byte at a time, so nothing beyond the
+// line is consumed and no copies of the passphrase are left in a buffer
+func readLine(r io.Reader) ([]byte, error) {
+	line := make([]byte, 0, maxPassphraseLength)
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			if len(line) == maxPassphraseLength {
+				wipe(line)
+				return nil, ErrPassphraseTooLong
+			}
+			line = append(line, b[0])
+			continue
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			break
+		}
+		if err != nil {
+			wipe(line)
+			return nil, err
+		}
+	}
+	b[0] = 0
+
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line[len(line)-1] = 0
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// wipe zeroes data
+func wipe(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// equal compares two passphrases in constant time for equal lengths
+func equal(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	var diff byte
+	for i := range a {
+		diff |= a[i] ^ b[i]
+	}
+	return diff == 0
+}
@@ -0,0 +1,141 @@
+package termio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Test reading passphrases from non-terminal input
+func TestReadPassphrase(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrompter(&Options{Input: strings.NewReader("secret\r\nnext\n"), Output: &out})
+
+	passphrase, err := p.ReadPassphrase("Passphrase: ")
+	if err != nil || string(passphrase) != "secret" {
+		t.Fatalf("ReadPassphrase returned %q, %v", passphrase, err)
+	}
+	if out.String() != "Passphrase: " {
+		t.Errorf("Unexpected prompt output %q", out.String())
+	}
+
+	// Only the first line may be consumed
+	passphrase, err = p.ReadPassphrase("Again: ")
+	if err != nil || string(passphrase) != "next" {
+		t.Errorf("Second ReadPassphrase returned %q, %v", passphrase, err)
+	}
+
+	p = NewPrompter(&Options{Input: strings.NewReader("\n"), Output: io.Discard})
+	if _, err := p.ReadPassphrase("Passphrase: "); err != ErrEmptyPassphrase {
+		t.Errorf("Expected ErrEmptyPassphrase, got %v", err)
+	}
+
+	p = NewPrompter(&Options{Input: strings.NewReader(strings.Repeat("a", maxPassphraseLength+1)), Output: io.Discard})
+	if _, err := p.ReadPassphrase("Passphrase: "); err != ErrPassphraseTooLong {
+		t.Errorf("Expected ErrPassphraseTooLong, got %v", err)
+	}
+}
+
+// Test confirmation and retry limits for new passphrases
+func TestReadNewPassphrase(t *testing.T) {
+	p := NewPrompter(&Options{Input: strings.NewReader("one\ntwo\n\nthree\nthree\n"), Output: io.Discard})
+	passphrase, err := p.ReadNewPassphrase("New: ", "Confirm: ")
+	if err != nil || string(passphrase) != "three" {
+		t.Fatalf("ReadNewPassphrase returned %q, %v", passphrase, err)
+	}
+
+	p = NewPrompter(&Options{Input: strings.NewReader("a\nb\nc\nd\n"), Output: io.Discard, MaxAttempts: 2})
+	if _, err := p.ReadNewPassphrase("New: ", "Confirm: "); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected ErrTooManyAttempts, got %v", err)
+	}
+}
+
+// Test retrying unlock callbacks and wiping attempted passphrases
+func TestUnlock(t *testing.T) {
+	var seen [][]byte
+	p := NewPrompter(&Options{Input: strings.NewReader("wrong\nright\n"), Output: io.Discard})
+	err := p.Unlock("Passphrase: ", func(passphrase []byte) error {
+		seen = append(seen, passphrase)
+		if string(passphrase) != "right" {
+			return errors.New("bad passphrase")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(seen))
+	}
+	for _, passphrase := range seen {
+		if !bytes.Equal(passphrase, make([]byte, len(passphrase))) {
+			t.Error("Passphrase not wiped after attempt")
+		}
+	}
+
+	p = NewPrompter(&Options{Input: strings.NewReader("x\nx\nx\n"), Output: io.Discard})
+	err = p.Unlock("Passphrase: ", func([]byte) error { return errors.New("bad passphrase") })
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected ErrTooManyAttempts, got %v", err)
+	}
+}
+
+// fakePinentry answers Assuan commands on r/w, replying to GETPIN with reply
+func fakePinentry(r io.Reader, w io.Writer, reply string, commands *[]string) {
+	io.WriteString(w, "OK Pleased to meet you\n")
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		*commands = append(*commands, line)
+		switch line {
+		case "GETPIN":
+			io.WriteString(w, reply)
+		case "BYE":
+			io.WriteString(w, "OK closing connection\n")
+			return
+		default:
+			io.WriteString(w, "OK\n")
+		}
+	}
+}
+
+// Test the pinentry protocol exchange
+func TestPinentrySession(t *testing.T) {
+	run := func(reply string, request pinentryRequest) ([]byte, []string, error) {
+		toPinentry, fromClient := io.Pipe()
+		fromPinentry, toClient := io.Pipe()
+		var commands []string
+		done := make(chan struct{})
+		go func() {
+			fakePinentry(toPinentry, toClient, reply, &commands)
+			toClient.Close()
+			close(done)
+		}()
+		passphrase, err := pinentrySession(fromPinentry, fromClient, request)
+		fromClient.Close()
+		fromPinentry.Close()
+		<-done
+		return passphrase, commands, err
+	}
+
+	passphrase, commands, err := run("D pa%25ss%0Aword\nOK\n", pinentryRequest{prompt: "PIN:", description: "Unlock key", repeat: "Again:"})
+	if err != nil || string(passphrase) != "pa%ss\nword" {
+		t.Fatalf("pinentry returned %q, %v", passphrase, err)
+	}
+	want := []string{"SETPROMPT PIN:", "SETDESC Unlock key", "SETREPEAT Again:", "SETREPEATERROR " + ErrMismatch.Error(), "GETPIN", "BYE"}
+	if strings.Join(commands, "|") != strings.Join(want, "|") {
+		t.Errorf("Unexpected commands %q", commands)
+	}
+
+	if _, _, err := run("ERR 83886179 Operation cancelled <Pinentry>\n", pinentryRequest{prompt: "PIN:"}); err != ErrCancelled {
+		t.Errorf("Expected ErrCancelled, got %v", err)
+	}
+
+	passphrase, _, err = run("OK\n", pinentryRequest{prompt: "PIN:"})
+	if err != nil || passphrase == nil || len(passphrase) != 0 {
+		t.Errorf("Expected empty passphrase, got %q, %v", passphrase, err)
+	}
+}
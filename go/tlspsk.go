@@ -0,0 +1,249 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Post-quantum keys for TLS-PSK
+//
+// Constrained MQTT clients often only support TLS with pre-shared keys. A
+// client encapsulates to the broker's KEM public key once, out of band, and
+// both sides then derive the same rotating PSKs from the shared secret, so
+// the TLS stack stays standard while the key material comes from the KEM.
+//
+// Each PSK belongs to an epoch of RotationInterval. Its identity is
+// "<prefix>-<session>-<epoch>", where the session is derived from the KEM
+// ciphertext and names the exchange without revealing anything secret. All
+// epochs come from one shared secret: rotation bounds how long one key is
+// used, and a new exchange is needed to replace the secret itself.
+
+// DefaultPSKRotation is the default lifetime of one TLS-PSK
+const DefaultPSKRotation = 24 * time.Hour
+
+// DefaultPSKSize is the default PSK length, matching TLS 1.3 SHA-256 suites
+const DefaultPSKSize = 32
+
+// DefaultPSKIdentityPrefix starts every PSK identity unless configured otherwise
+const DefaultPSKIdentityPrefix = "tz512"
+
+// Domain separation strings for TLS-PSK sessions and keys
+const (
+	pskSessionDomain = "TOPAY-Z512-TLS-PSK-SESSION"
+	pskKeyDomain     = "TOPAY-Z512-TLS-PSK"
+)
+
+// pskSessionSize is the number of session hash bytes in an identity
+const pskSessionSize = 16
+
+// PSKExporterOptions configures a PSKExporter
+type PSKExporterOptions struct {
+	// RotationInterval is the lifetime of one PSK
+	RotationInterval time.Duration
+	// Overlap is how many previous epochs ForIdentity still accepts, so a
+	// client that hasn't rotated yet can still connect
+	Overlap int
+	// KeySize is the PSK length in bytes, at most MaxHKDFLength
+	KeySize int
+	// IdentityPrefix starts each identity; it must not contain '-'
+	IdentityPrefix string
+	// Clock returns the current time; nil uses time.Now
+	Clock func() time.Time
+}
+
+// TLSPSK is a TLS pre-shared key and the identity a client presents for it
+type TLSPSK struct {
+	Identity  string    `json:"identity"`
+	Key       []byte    `json:"key"`
+	Epoch     uint64    `json:"epoch"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// Wipe erases the key. It does nothing for a nil PSK.
+func (psk *TLSPSK) Wipe() {
+	if psk == nil {
+		return
+	}
+	SecureZero(psk.Key)
+}
+
+// PSKExporter derives the rotating TLS-PSKs of one KEM exchange. Client and
+// broker each hold one and derive identical keys. It is safe for concurrent
+// use.
+type PSKExporter struct {
+	secret  SharedSecret
+	session string
+	opts    PSKExporterOptions
+	mutex   sync.RWMutex
+}
+
+// EstablishPSK encapsulates to the broker's public key and returns the
+// ciphertext to deliver to the broker out of band, along with the client's
+// exporter. nil options use the defaults.
+func EstablishPSK(brokerKey KEMPublicKey, opts *PSKExporterOptions) (Ciphertext, *PSKExporter, error) {
+	options, err := pskOptions(opts)
+	if err != nil {
+		return Ciphertext{}, nil, err
+	}
+	ciphertext, sharedSecret, err := KEMEncapsulate(brokerKey)
+	if err != nil {
+		return Ciphertext{}, nil, err
+	}
+	return ciphertext, newPSKExporter(sharedSecret, ciphertext, options), nil
+}
+
+// AcceptPSK decapsulates a client's ciphertext and returns the broker's
+// exporter for it. The options must match the client's.
+func AcceptPSK(brokerSecret KEMSecretKey, ciphertext Ciphertext, opts *PSKExporterOptions) (*PSKExporter, error) {
+	options, err := pskOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := KEMDecapsulate(brokerSecret, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return newPSKExporter(sharedSecret, ciphertext, options), nil
+}
+
+// pskOptions applies the defaults and validates options
+func pskOptions(opts *PSKExporterOptions) (PSKExporterOptions, error) {
+	var options PSKExporterOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.RotationInterval <= 0 {
+		options.RotationInterval = DefaultPSKRotation
+	}
+	if options.Overlap < 0 {
+		options.Overlap = 0
+	}
+	if options.KeySize == 0 {
+		options.KeySize = DefaultPSKSize
+	}
+	if options.KeySize < 0 || options.KeySize > MaxHKDFLength {
+		return PSKExporterOptions{}, ErrInvalidKeySize
+	}
+	if options.IdentityPrefix == "" {
+		options.IdentityPrefix = DefaultPSKIdentityPrefix
+	}
+	if strings.Contains(options.IdentityPrefix, "-") {
+		return PSKExporterOptions{}, ErrInvalidPSKIdentity
+	}
+	if options.Clock == nil {
+		options.Clock = time.Now
+	}
+	return options, nil
+}
+
+// newPSKExporter names the session after the ciphertext
+func newPSKExporter(secret SharedSecret, ciphertext Ciphertext, opts PSKExporterOptions) *PSKExporter {
+	session := HashMultiple([]byte(pskSessionDomain), ciphertext[:])
+	return &PSKExporter{
+		secret:  secret,
+		session: FastHexEncode(session[:pskSessionSize]),
+		opts:    opts,
+	}
+}
+
+// Session returns the session name embedded in every identity
+func (pe *PSKExporter) Session() string {
+	return pe.session
+}
+
+// CurrentEpoch returns the epoch for the current time
+func (pe *PSKExporter) CurrentEpoch() uint64 {
+	now := pe.opts.Clock()
+	if now.UnixNano() < 0 {
+		return 0
+	}
+	return uint64(now.UnixNano()) / uint64(pe.opts.RotationInterval)
+}
+
+// Current returns the PSK to use now
+func (pe *PSKExporter) Current() (TLSPSK, error) {
+	return pe.ForEpoch(pe.CurrentEpoch())
+}
+
+// ForEpoch returns the PSK of an epoch
+func (pe *PSKExporter) ForEpoch(epoch uint64) (TLSPSK, error) {
+	pe.mutex.RLock()
+	defer pe.mutex.RUnlock()
+
+	var info [len(pskKeyDomain) + pskSessionSize*2 + 8]byte
+	copy(info[:], pskKeyDomain)
+	copy(info[len(pskKeyDomain):], pe.session)
+	binary.BigEndian.PutUint64(info[len(info)-8:], epoch)
+	key, err := pe.secret.Derive(info[:], pe.opts.KeySize)
+	if err != nil {
+		return TLSPSK{}, err
+	}
+
+	interval := pe.opts.RotationInterval
+	notBefore := time.Unix(0, int64(epoch)*int64(interval)).UTC()
+	return TLSPSK{
+		Identity:  pe.opts.IdentityPrefix + "-" + pe.session + "-" + strconv.FormatUint(epoch, 10),
+		Key:       key,
+		Epoch:     epoch,
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(interval),
+	}, nil
+}
+
+// ForIdentity returns the PSK for an identity a client presented, as a
+// broker's PSK callback needs. It returns ErrInvalidPSKIdentity for an
+// identity of another session and ErrEpochExpired for an epoch older than
+// Overlap allows or more than one epoch ahead of the broker's clock.
+func (pe *PSKExporter) ForIdentity(identity string) (TLSPSK, error) {
+	prefix, session, epoch, err := ParsePSKIdentity(identity)
+	if err != nil {
+		return TLSPSK{}, err
+	}
+	if prefix != pe.opts.IdentityPrefix || session != pe.session {
+		return TLSPSK{}, ErrInvalidPSKIdentity
+	}
+	current := pe.CurrentEpoch()
+	if epoch > current+1 || (epoch < current && current-epoch > uint64(pe.opts.Overlap)) {
+		return TLSPSK{}, ErrEpochExpired
+	}
+	return pe.ForEpoch(epoch)
+}
+
+// Wipe erases the shared secret; the exporter can't derive keys afterwards
+// and returns ErrKeyDestroyed. It does nothing for a nil exporter.
+func (pe *PSKExporter) Wipe() {
+	if pe == nil {
+		return
+	}
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+	SecureEraseSharedSecret(&pe.secret)
+}
+
+// Erased reports whether Wipe has been called
+func (pe *PSKExporter) Erased() bool {
+	pe.mutex.RLock()
+	defer pe.mutex.RUnlock()
+	return isErased(pe.secret[:])
+}
+
+// ParsePSKIdentity splits an identity into its prefix, session and epoch, so
+// a broker serving many clients can route it to the right exporter
+func ParsePSKIdentity(identity string) (prefix, session string, epoch uint64, err error) {
+	parts := strings.Split(identity, "-")
+	if len(parts) != 3 || parts[0] == "" || len(parts[1]) != pskSessionSize*2 {
+		return "", "", 0, ErrInvalidPSKIdentity
+	}
+	if _, err := FastHexDecode(parts[1]); err != nil || strings.ToLower(parts[1]) != parts[1] {
+		return "", "", 0, ErrInvalidPSKIdentity
+	}
+	epoch, err = strconv.ParseUint(parts[2], 10, 64)
+	if err != nil || strconv.FormatUint(epoch, 10) != parts[2] {
+		return "", "", 0, ErrInvalidPSKIdentity
+	}
+	return parts[0], parts[1], epoch, nil
+}
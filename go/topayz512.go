@@ -41,12 +41,14 @@
 package topayz512
 
 import (
-	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"runtime"
 	"time"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/params"
 )
 
 // Version information
@@ -55,34 +57,64 @@ const (
 	Version = "0.1.0"
 
 	// SecurityLevel represents the classical security level in bits
-	SecurityLevel = 512
+	SecurityLevel = params.SecurityLevel
 
 	// QuantumSecurityLevel represents the quantum security level in bits
-	QuantumSecurityLevel = 256
+	QuantumSecurityLevel = params.QuantumSecurityLevel
 )
 
-// Cryptographic constants
+// Cryptographic constants, defined in the params package
 const (
 	// PrivateKeySize is the size of a private key in bytes
-	PrivateKeySize = 64
+	PrivateKeySize = int(params.PrivateKeySize)
 
 	// PublicKeySize is the size of a public key in bytes
-	PublicKeySize = 64
+	PublicKeySize = int(params.PublicKeySize)
 
 	// HashSize is the size of a hash in bytes
-	HashSize = 64
+	HashSize = int(params.HashSize)
 
 	// KEMPublicKeySize is the size of a KEM public key in bytes
-	KEMPublicKeySize = 64
+	KEMPublicKeySize = int(params.KEMPublicKeySize)
 
 	// KEMSecretKeySize is the size of a KEM secret key in bytes
-	KEMSecretKeySize = 64
+	KEMSecretKeySize = int(params.KEMSecretKeySize)
 
 	// CiphertextSize is the size of a KEM ciphertext in bytes
-	CiphertextSize = 64
+	CiphertextSize = int(params.CiphertextSize)
 
 	// SharedSecretSize is the size of a shared secret in bytes
-	SharedSecretSize = 64
+	SharedSecretSize = int(params.SharedSecretSize)
+
+	// SignatureSize is the size of a signature made by Sign in bytes
+	SignatureSize = int(params.SignatureSize)
+
+	// HybridPublicKeySize is the size of a hybrid KEM public key in bytes
+	HybridPublicKeySize = int(params.HybridPublicKeySize)
+
+	// HybridCiphertextSize is the size of a hybrid KEM ciphertext in bytes
+	HybridCiphertextSize = int(params.HybridCiphertextSize)
+
+	// HybridSignaturePublicKeySize is the size of a hybrid signature public key in bytes
+	HybridSignaturePublicKeySize = int(params.HybridSignaturePublicKeySize)
+
+	// HybridSignatureSize is the size of a hybrid signature in bytes
+	HybridSignatureSize = int(params.HybridSignatureSize)
+
+	// MLKEM768PublicKeySize is the size of an ML-KEM-768 encapsulation key in bytes
+	MLKEM768PublicKeySize = int(params.MLKEM768PublicKeySize)
+
+	// MLKEM768SecretKeySize is the size of an ML-KEM-768 decapsulation key in bytes
+	MLKEM768SecretKeySize = int(params.MLKEM768SecretKeySize)
+
+	// MLKEM768CiphertextSize is the size of an ML-KEM-768 ciphertext in bytes
+	MLKEM768CiphertextSize = int(params.MLKEM768CiphertextSize)
+
+	// MLKEMSharedSecretSize is the size of an ML-KEM shared secret in bytes
+	MLKEMSharedSecretSize = int(params.MLKEMSharedSecretSize)
+
+	// MLKEMSeedSize is the size of an ML-KEM key generation seed in bytes
+	MLKEMSeedSize = int(params.MLKEMSeedSize)
 )
 
 // Performance constants
@@ -135,6 +167,33 @@ type Ciphertext [CiphertextSize]byte
 // SharedSecret represents a shared secret from KEM
 type SharedSecret [SharedSecretSize]byte
 
+// Signature represents a stateless hash-based signature made by Sign
+type Signature [SignatureSize]byte
+
+// Compile-time checks that every fixed-size type matches its parameter size:
+// the index is out of range, and the build fails, unless the lengths agree
+var (
+	_ = [1]struct{}{}[len(PrivateKey{})-int(params.PrivateKeySize)]
+	_ = [1]struct{}{}[len(PublicKey{})-int(params.PublicKeySize)]
+	_ = [1]struct{}{}[len(Hash{})-int(params.HashSize)]
+	_ = [1]struct{}{}[len(KEMPublicKey{})-int(params.KEMPublicKeySize)]
+	_ = [1]struct{}{}[len(KEMSecretKey{})-int(params.KEMSecretKeySize)]
+	_ = [1]struct{}{}[len(Ciphertext{})-int(params.CiphertextSize)]
+	_ = [1]struct{}{}[len(SharedSecret{})-int(params.SharedSecretSize)]
+	_ = [1]struct{}{}[len(Signature{})-int(params.SignatureSize)]
+	_ = [1]struct{}{}[signatureLength-int(params.SignatureSize)]
+	_ = [1]struct{}{}[len(HybridPublicKey{})-int(params.HybridPublicKeySize)]
+	_ = [1]struct{}{}[len(HybridCiphertext{})-int(params.HybridCiphertextSize)]
+	_ = [1]struct{}{}[len(HybridSignaturePublicKey{})-int(params.HybridSignaturePublicKeySize)]
+	_ = [1]struct{}{}[len(HybridSignature{})-int(params.HybridSignatureSize)]
+	_ = [1]struct{}{}[len(MLKEM768PublicKey{})-int(params.MLKEM768PublicKeySize)]
+	_ = [1]struct{}{}[len(MLKEM768SecretKey{})-int(params.MLKEM768SecretKeySize)]
+	_ = [1]struct{}{}[len(MLKEM768Ciphertext{})-int(params.MLKEM768CiphertextSize)]
+	_ = [1]struct{}{}[len(MLKEMSharedSecret{})-int(params.MLKEMSharedSecretSize)]
+	_ = [1]struct{}{}[len(Nonce{})-int(params.NonceSize)]
+	_ = [1]struct{}{}[len(ID{})-int(params.IDSize)]
+)
+
 // KEMKeyPair represents a complete KEM key pair
 type KEMKeyPair struct {
 	Public KEMPublicKey
@@ -169,6 +228,234 @@ var (
 
 	// ErrInvalidFragmentCount indicates invalid fragment count
 	ErrInvalidFragmentCount = errors.New("invalid fragment count")
+
+	// ErrInsufficientParity indicates too few parity shards to repair the missing fragments
+	ErrInsufficientParity = errors.New("insufficient parity for repair")
+
+	// ErrNoRecipients indicates no recipient public keys were provided
+	ErrNoRecipients = errors.New("no recipients provided")
+
+	// ErrNoMatchingRecipient indicates the key is not among the recipients
+	ErrNoMatchingRecipient = errors.New("no matching recipient")
+
+	// ErrUnsupportedVersion indicates an unknown serialization format version
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+
+	// ErrInvalidThreshold indicates an invalid share threshold
+	ErrInvalidThreshold = errors.New("invalid threshold")
+
+	// ErrInvalidShare indicates a malformed or unverifiable secret share
+	ErrInvalidShare = errors.New("invalid share")
+
+	// ErrNonceReuse indicates a nonce counter that was already used
+	ErrNonceReuse = errors.New("nonce reuse detected")
+
+	// ErrNonceExhausted indicates the nonce counter space is exhausted
+	ErrNonceExhausted = errors.New("nonce counter exhausted")
+
+	// ErrEpochExpired indicates an ephemeral key epoch that is no longer accepted
+	ErrEpochExpired = errors.New("ephemeral key epoch expired")
+
+	// ErrNoNodes indicates placement was requested with no nodes available
+	ErrNoNodes = errors.New("no nodes available")
+
+	// ErrInvalidIDEncoding indicates a malformed identifier
+	ErrInvalidIDEncoding = errors.New("invalid identifier encoding")
+
+	// ErrIDOverflow indicates too many identifiers were generated within one millisecond
+	ErrIDOverflow = errors.New("identifier space exhausted for this millisecond")
+
+	// ErrInvalidChainLength indicates an invalid hash chain length or position
+	ErrInvalidChainLength = errors.New("invalid hash chain length")
+
+	// ErrInvalidWinternitz indicates an unsupported Winternitz parameter
+	ErrInvalidWinternitz = errors.New("invalid Winternitz parameter")
+
+	// ErrInvalidSignatureSize indicates a signature of the wrong size
+	ErrInvalidSignatureSize = errors.New("invalid signature size")
+
+	// ErrKeyAlreadyUsed indicates a one-time signing key that has already signed
+	ErrKeyAlreadyUsed = errors.New("one-time key already used")
+
+	// ErrInvalidTreeHeight indicates an unsupported hash tree height
+	ErrInvalidTreeHeight = errors.New("invalid tree height")
+
+	// ErrKeyExhausted indicates a stateful signing key with no signatures left
+	ErrKeyExhausted = errors.New("signing key exhausted")
+
+	// ErrStateNotFound indicates a counter store that has never recorded a value
+	ErrStateNotFound = errors.New("state not found")
+
+	// ErrInvalidSignature indicates a signature that does not verify
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrUntrustedSigner indicates a signature made by a key that is not trusted
+	ErrUntrustedSigner = errors.New("signer is not trusted")
+
+	// ErrFileModified indicates a file whose contents don't match its signature
+	ErrFileModified = errors.New("file does not match signature")
+
+	// ErrObjectSizeMismatch indicates object content that doesn't match its declared size
+	ErrObjectSizeMismatch = errors.New("object size mismatch")
+
+	// ErrUnknownArtifact indicates an artifact that an attestation doesn't list
+	ErrUnknownArtifact = errors.New("artifact not found in attestation")
+
+	// ErrFragmentTruncated indicates a serialized fragment shorter than its header declares
+	ErrFragmentTruncated = errors.New("truncated fragment")
+
+	// ErrFragmentTooLarge indicates a fragment payload above the accepted limit
+	ErrFragmentTooLarge = errors.New("fragment exceeds size limit")
+
+	// ErrInvalidFragmentIndex indicates a fragment index or count out of range
+	ErrInvalidFragmentIndex = errors.New("fragment index out of range")
+
+	// ErrTooLarge indicates an input above a documented limit; see Limits
+	ErrTooLarge = errors.New("input exceeds limit")
+
+	// ErrHashClosed indicates a write to a streaming hash after Close
+	ErrHashClosed = errors.New("streaming hash closed")
+
+	// ErrInvalidFragmentOrder indicates an unknown fragment ordering strategy
+	ErrInvalidFragmentOrder = errors.New("invalid fragment order")
+
+	// ErrReconstructionIncomplete indicates a payload is missing fragments
+	ErrReconstructionIncomplete = errors.New("reconstruction incomplete")
+
+	// ErrTooManyPayloads indicates a demultiplexer has no room for another payload
+	ErrTooManyPayloads = errors.New("too many payloads in progress")
+
+	// ErrInvalidChecksumFile indicates a malformed checksum file line
+	ErrInvalidChecksumFile = errors.New("invalid checksum file")
+
+	// ErrChecksumMismatch indicates a file not matching its checksum file entry
+	ErrChecksumMismatch = errors.New("checksum verification failed")
+
+	// ErrUnknownKey indicates a key ID not present in a key store
+	ErrUnknownKey = errors.New("unknown key")
+
+	// ErrServiceClosed indicates a request submitted to a closed service
+	ErrServiceClosed = errors.New("service closed")
+
+	// ErrInvalidAuditTrail indicates an escrow audit trail that was altered
+	ErrInvalidAuditTrail = errors.New("invalid audit trail")
+
+	// ErrUnknownChallenge indicates a response to a challenge that was never
+	// issued or was already answered
+	ErrUnknownChallenge = errors.New("unknown or replayed challenge")
+
+	// ErrChallengeExpired indicates a response to an expired challenge
+	ErrChallengeExpired = errors.New("challenge expired")
+
+	// ErrNonCanonicalEncoding indicates an encoding with duplicate or unsorted entries
+	ErrNonCanonicalEncoding = errors.New("non-canonical encoding")
+
+	// ErrInvalidProof indicates a malformed membership proof
+	ErrInvalidProof = errors.New("invalid proof")
+
+	// ErrInsecurePlaceholder indicates a placeholder primitive refused in strict mode
+	ErrInsecurePlaceholder = errors.New("insecure placeholder primitive refused in strict mode")
+
+	// ErrWrongRecipient indicates a ciphertext encapsulated to a different public key
+	ErrWrongRecipient = errors.New("ciphertext encapsulated to a different key")
+
+	// ErrInvalidPrivateKey indicates a private key that fails IsValidPrivateKey
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+
+	// ErrInvalidKEMPublicKey indicates a KEM public key that isn't a canonical encoding
+	ErrInvalidKEMPublicKey = errors.New("invalid KEM public key")
+
+	// ErrInvalidKEMSecretKey indicates a KEM secret key that fails its consistency check
+	ErrInvalidKEMSecretKey = errors.New("invalid KEM secret key")
+
+	// ErrInvalidLeafIndex indicates a leaf or node index past the end of a tree
+	ErrInvalidLeafIndex = errors.New("invalid leaf index")
+
+	// ErrInvalidMMR indicates an MMR store whose size no Merkle mountain range has
+	ErrInvalidMMR = errors.New("invalid MMR store size")
+
+	// ErrInvalidAEADRole indicates an AEADRole other than initiator or responder
+	ErrInvalidAEADRole = errors.New("invalid AEAD role")
+
+	// ErrAuthenticationFailed indicates a sealed message that fails authentication
+	ErrAuthenticationFailed = errors.New("message authentication failed")
+
+	// ErrInvalidRuntimeState indicates a runtime state that can't be applied to this build
+	ErrInvalidRuntimeState = errors.New("invalid runtime state")
+
+	// ErrRateLimited indicates an operation refused because its tenant is over its rate limit
+	ErrRateLimited = errors.New("rate limit exceeded")
+
+	// ErrInvalidPSKIdentity indicates a malformed TLS-PSK identity or one of another session
+	ErrInvalidPSKIdentity = errors.New("invalid PSK identity")
+
+	// ErrInvalidKeyRecord indicates a malformed DNS key record or one whose key doesn't match its fingerprint
+	ErrInvalidKeyRecord = errors.New("invalid key record")
+
+	// ErrNoKeyRecords indicates a domain publishing no valid key records
+	ErrNoKeyRecords = errors.New("no key records found")
+
+	// ErrInvalidPasswordParams indicates malformed or out-of-range password derivation parameters
+	ErrInvalidPasswordParams = errors.New("invalid password parameters")
+
+	// ErrInconsistentLog indicates a transparency log whose tree heads contradict each other
+	ErrInconsistentLog = errors.New("inconsistent transparency log")
+
+	// ErrInvalidDerivationPath indicates a malformed HD derivation path or one deeper than MaxHDDepth
+	ErrInvalidDerivationPath = errors.New("invalid derivation path")
+
+	// ErrKeyRevoked indicates a recipient key reported revoked by an EncryptPolicy
+	ErrKeyRevoked = errors.New("recipient key revoked")
+
+	// ErrKeyTooOld indicates a recipient key older than an EncryptPolicy allows, or of unknown age
+	ErrKeyTooOld = errors.New("recipient key too old")
+
+	// ErrHardenedDerivation indicates a hardened child requested from an extended public key
+	ErrHardenedDerivation = errors.New("hardened derivation requires the private key")
+
+	// ErrUnsupportedKeyType indicates a value that isn't one of the key types being encoded
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+
+	// ErrInvalidKeyEncoding indicates malformed PEM or DER, or a key of an unknown algorithm
+	ErrInvalidKeyEncoding = errors.New("invalid key encoding")
+
+	// ErrInvalidPolicy indicates a policy file that can't be parsed or has invalid settings
+	ErrInvalidPolicy = errors.New("invalid policy")
+
+	// ErrPolicyViolation indicates an algorithm or parameter a policy doesn't allow
+	ErrPolicyViolation = errors.New("policy violation")
+
+	// ErrUnsupportedHash indicates signer options asking to sign a pre-hashed digest
+	ErrUnsupportedHash = errors.New("pre-hashed messages are not supported")
+
+	// ErrKeyDestroyed indicates a secret used after it was wiped or securely erased
+	ErrKeyDestroyed = errors.New("key has been destroyed")
+
+	// ErrUnknownAlgorithm indicates an algorithm ID or name missing from the registry
+	ErrUnknownAlgorithm = errors.New("unknown algorithm")
+
+	// ErrUnknownSize indicates a reader whose length can't be determined
+	ErrUnknownSize = errors.New("data size unknown")
+
+	// ErrInvalidFragmentOption indicates a FragmentOption out of range
+	ErrInvalidFragmentOption = errors.New("invalid fragment option")
+
+	// ErrNotLegacyFragmentID indicates a fragment ID the original 32-bit
+	// wire format can't carry
+	ErrNotLegacyFragmentID = errors.New("fragment ID doesn't fit the legacy format")
+
+	// ErrInvalidManifest indicates a fragment manifest describing no valid layout
+	ErrInvalidManifest = errors.New("invalid fragment manifest")
+
+	// ErrManifestMismatch indicates a fragment its manifest doesn't plan
+	ErrManifestMismatch = errors.New("fragment doesn't match manifest")
+
+	// ErrWorkerPanic indicates a worker pool task that panicked; see PanicError
+	ErrWorkerPanic = errors.New("worker task panicked")
+
+	// ErrInvalidPipeline indicates a Pipeline built with misordered or
+	// invalid steps
+	ErrInvalidPipeline = errors.New("invalid pipeline")
 )
 
 // Utility functions
@@ -176,8 +463,10 @@ var (
 // SecureRandom generates cryptographically secure random bytes
 func SecureRandom(size int) ([]byte, error) {
 	data := make([]byte, size)
-	_, err := rand.Read(data)
-	return data, err
+	if err := readRandom(data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 // ConstantTimeEqual performs constant-time comparison of two byte slices
@@ -204,6 +493,17 @@ func SecureZero(data []byte) {
 	runtime.KeepAlive(data)
 }
 
+// isErased reports in constant time whether data is all zeros, the state
+// SecureZero leaves a secret in. A live secret is all zeros with negligible
+// probability, so functions taking raw secrets treat it as erased.
+func isErased(data []byte) bool {
+	var acc byte
+	for _, b := range data {
+		acc |= b
+	}
+	return acc == 0
+}
+
 // FastHexEncode encodes bytes to hex string with optimized performance
 func FastHexEncode(data []byte) string {
 	return hex.EncodeToString(data)
@@ -214,12 +514,52 @@ func FastHexDecode(hexStr string) ([]byte, error) {
 	return hex.DecodeString(hexStr)
 }
 
+// SecretFromHex decodes hex-encoded secret material in time that depends only
+// on the input length, never on the digits. On error nothing is returned and
+// the partially decoded buffer is wiped; on success the caller owns the result
+// and should SecureZero it when done. The input string itself cannot be wiped
+func SecretFromHex(hexStr string) ([]byte, error) {
+	if len(hexStr)%2 != 0 {
+		return nil, ErrInvalidHexEncoding
+	}
+
+	out := make([]byte, len(hexStr)/2)
+	var invalid uint32
+	for i := range out {
+		hi, hiInvalid := hexNibble(hexStr[2*i])
+		lo, loInvalid := hexNibble(hexStr[2*i+1])
+		out[i] = hi<<4 | lo
+		invalid |= hiInvalid | loInvalid
+	}
+
+	if invalid != 0 {
+		SecureZero(out)
+		return nil, ErrInvalidHexEncoding
+	}
+	return out, nil
+}
+
+// hexNibble decodes one hex digit without branching on its value. invalid is
+// non-zero if c is not a hex digit
+func hexNibble(c byte) (value byte, invalid uint32) {
+	v := uint32(c)
+
+	// digitMask is all ones for '0'-'9', letterMask for 'a'-'f' and 'A'-'F'
+	digit := v ^ '0'
+	digitMask := (digit - 10) >> 8
+	letter := (v &^ 0x20) - 55
+	letterMask := ((letter - 10) ^ (letter - 16)) >> 8
+
+	value = byte((digitMask & digit) | (letterMask & letter))
+	invalid = (^(digitMask | letterMask)) & 1
+	return value, invalid
+}
+
 // System capability detection
 
 // HasSIMDSupport detects if SIMD instructions are available
 func HasSIMDSupport() bool {
-	// Simplified detection - in production, use proper CPU feature detection
-	return runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64"
+	return DetectSIMDCapabilities().vector()
 }
 
 // HasHardwareRNG detects if hardware random number generation is available
@@ -306,43 +646,196 @@ func (ss SharedSecret) String() string {
 	return FastHexEncode(ss[:])
 }
 
+// String returns the hex representation of a Signature
+func (sig Signature) String() string {
+	return FastHexEncode(sig[:])
+}
+
 // Bytes methods for types
+//
+// Bytes on the fixed-size array types (keys, hashes, ciphertexts, secrets,
+// signatures, IDs, nonces and the hybrid types) returns a copy, but its name
+// doesn't say whether the result aliases the value. It is deprecated in
+// favour of AppendBytes, where AppendBytes(nil) is an explicit copy, and
+// CopyTo, which fills a caller-owned buffer.
 
-// Bytes returns the byte representation of a PrivateKey
+// Bytes returns a newly allocated copy of a PrivateKey.
+//
+// Deprecated: use AppendBytes or CopyTo.
 func (pk PrivateKey) Bytes() []byte {
 	return pk[:]
 }
 
-// Bytes returns the byte representation of a PublicKey
+// Bytes returns a newly allocated copy of a PublicKey.
+//
+// Deprecated: use AppendBytes or CopyTo.
 func (pk PublicKey) Bytes() []byte {
 	return pk[:]
 }
 
-// Bytes returns the byte representation of a Hash
+// Bytes returns a newly allocated copy of a Hash.
+//
+// Deprecated: use AppendBytes or CopyTo.
 func (h Hash) Bytes() []byte {
 	return h[:]
 }
 
-// Bytes returns the byte representation of a KEMPublicKey
+// MarshalText implements encoding.TextMarshaler, so hashes appear as hex in JSON
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (h *Hash) UnmarshalText(text []byte) error {
+	parsed, err := HashFromHex(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// Bytes returns a newly allocated copy of a KEMPublicKey.
+//
+// Deprecated: use AppendBytes or CopyTo.
 func (kpk KEMPublicKey) Bytes() []byte {
 	return kpk[:]
 }
 
-// Bytes returns the byte representation of a KEMSecretKey
+// Bytes returns a newly allocated copy of a KEMSecretKey.
+//
+// Deprecated: use AppendBytes or CopyTo.
 func (ksk KEMSecretKey) Bytes() []byte {
 	return ksk[:]
 }
 
-// Bytes returns the byte representation of a Ciphertext
+// Bytes returns a newly allocated copy of a Ciphertext.
+//
+// Deprecated: use AppendBytes or CopyTo.
 func (ct Ciphertext) Bytes() []byte {
 	return ct[:]
 }
 
-// Bytes returns the byte representation of a SharedSecret
+// Bytes returns a newly allocated copy of a SharedSecret.
+//
+// Deprecated: use AppendBytes or CopyTo.
 func (ss SharedSecret) Bytes() []byte {
 	return ss[:]
 }
 
+// Bytes returns a newly allocated copy of a Signature.
+//
+// Deprecated: use AppendBytes or CopyTo.
+func (sig Signature) Bytes() []byte {
+	return sig[:]
+}
+
+// Copy-free byte access
+
+// AppendBytes and CopyTo write into caller-owned buffers; neither result ever
+// aliases the original.
+
+// appendFixed appends src to dst; the result never aliases src
+func appendFixed(dst, src []byte) []byte {
+	return append(dst, src...)
+}
+
+// copyFixed copies all of src into dst, or nothing if dst is too short
+func copyFixed(dst, src []byte) (int, error) {
+	if len(dst) < len(src) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(dst, src), nil
+}
+
+// AppendBytes appends the bytes of a PrivateKey to dst and returns the extended slice
+func (pk PrivateKey) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, pk[:])
+}
+
+// CopyTo copies a PrivateKey into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than PrivateKeySize
+func (pk PrivateKey) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, pk[:])
+}
+
+// AppendBytes appends the bytes of a PublicKey to dst and returns the extended slice
+func (pk PublicKey) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, pk[:])
+}
+
+// CopyTo copies a PublicKey into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than PublicKeySize
+func (pk PublicKey) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, pk[:])
+}
+
+// AppendBytes appends the bytes of a Hash to dst and returns the extended slice
+func (h Hash) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, h[:])
+}
+
+// CopyTo copies a Hash into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than HashSize
+func (h Hash) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, h[:])
+}
+
+// AppendBytes appends the bytes of a KEMPublicKey to dst and returns the extended slice
+func (kpk KEMPublicKey) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, kpk[:])
+}
+
+// CopyTo copies a KEMPublicKey into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than KEMPublicKeySize
+func (kpk KEMPublicKey) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, kpk[:])
+}
+
+// AppendBytes appends the bytes of a KEMSecretKey to dst and returns the extended slice
+func (ksk KEMSecretKey) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, ksk[:])
+}
+
+// CopyTo copies a KEMSecretKey into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than KEMSecretKeySize
+func (ksk KEMSecretKey) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, ksk[:])
+}
+
+// AppendBytes appends the bytes of a Ciphertext to dst and returns the extended slice
+func (ct Ciphertext) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, ct[:])
+}
+
+// CopyTo copies a Ciphertext into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than CiphertextSize
+func (ct Ciphertext) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, ct[:])
+}
+
+// AppendBytes appends the bytes of a SharedSecret to dst and returns the extended slice
+func (ss SharedSecret) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, ss[:])
+}
+
+// CopyTo copies a SharedSecret into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than SharedSecretSize
+func (ss SharedSecret) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, ss[:])
+}
+
+// AppendBytes appends the bytes of a Signature to dst and returns the extended slice
+func (sig Signature) AppendBytes(dst []byte) []byte {
+	return appendFixed(dst, sig[:])
+}
+
+// CopyTo copies a Signature into dst, returning io.ErrShortBuffer without writing
+// anything if dst is shorter than SignatureSize
+func (sig Signature) CopyTo(dst []byte) (int, error) {
+	return copyFixed(dst, sig[:])
+}
+
 // FromBytes methods for types
 
 // PrivateKeyFromBytes creates a PrivateKey from bytes
@@ -411,6 +904,17 @@ func CiphertextFromBytes(data []byte) (Ciphertext, error) {
 	return ct, nil
 }
 
+// SignatureFromBytes creates a Signature from bytes
+func SignatureFromBytes(data []byte) (Signature, error) {
+	if len(data) != SignatureSize {
+		return Signature{}, ErrInvalidSignatureSize
+	}
+
+	var sig Signature
+	copy(sig[:], data)
+	return sig, nil
+}
+
 // SharedSecretFromBytes creates a SharedSecret from bytes
 func SharedSecretFromBytes(data []byte) (SharedSecret, error) {
 	if len(data) != SharedSecretSize {
@@ -424,12 +928,13 @@ func SharedSecretFromBytes(data []byte) (SharedSecret, error) {
 
 // FromHex methods for types
 
-// PrivateKeyFromHex creates a PrivateKey from hex string
+// PrivateKeyFromHex creates a PrivateKey from hex string using SecretFromHex
 func PrivateKeyFromHex(hexStr string) (PrivateKey, error) {
-	data, err := FastHexDecode(hexStr)
+	data, err := SecretFromHex(hexStr)
 	if err != nil {
-		return PrivateKey{}, ErrInvalidHexEncoding
+		return PrivateKey{}, err
 	}
+	defer SecureZero(data)
 	return PrivateKeyFromBytes(data)
 }
 
@@ -460,12 +965,13 @@ func KEMPublicKeyFromHex(hexStr string) (KEMPublicKey, error) {
 	return KEMPublicKeyFromBytes(data)
 }
 
-// KEMSecretKeyFromHex creates a KEMSecretKey from hex string
+// KEMSecretKeyFromHex creates a KEMSecretKey from hex string using SecretFromHex
 func KEMSecretKeyFromHex(hexStr string) (KEMSecretKey, error) {
-	data, err := FastHexDecode(hexStr)
+	data, err := SecretFromHex(hexStr)
 	if err != nil {
-		return KEMSecretKey{}, ErrInvalidHexEncoding
+		return KEMSecretKey{}, err
 	}
+	defer SecureZero(data)
 	return KEMSecretKeyFromBytes(data)
 }
 
@@ -478,11 +984,21 @@ func CiphertextFromHex(hexStr string) (Ciphertext, error) {
 	return CiphertextFromBytes(data)
 }
 
-// SharedSecretFromHex creates a SharedSecret from hex string
-func SharedSecretFromHex(hexStr string) (SharedSecret, error) {
+// SignatureFromHex creates a Signature from hex string
+func SignatureFromHex(hexStr string) (Signature, error) {
 	data, err := FastHexDecode(hexStr)
 	if err != nil {
-		return SharedSecret{}, ErrInvalidHexEncoding
+		return Signature{}, ErrInvalidHexEncoding
+	}
+	return SignatureFromBytes(data)
+}
+
+// SharedSecretFromHex creates a SharedSecret from hex string using SecretFromHex
+func SharedSecretFromHex(hexStr string) (SharedSecret, error) {
+	data, err := SecretFromHex(hexStr)
+	if err != nil {
+		return SharedSecret{}, err
 	}
+	defer SecureZero(data)
 	return SharedSecretFromBytes(data)
 }
@@ -2,6 +2,30 @@ package topayz512
 
 import (
 	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go/build"
+	"hash"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -344,7 +368,7 @@ func TestParallelFragmentation(t *testing.T) {
 func TestFragmentSerialization(t *testing.T) {
 	data := []byte("test fragment data")
 	fragment := Fragment{
-		ID:       12345,
+		ID:       LegacyFragmentID(12345),
 		Index:    0,
 		Total:    1,
 		Data:     data,
@@ -495,13 +519,16 @@ func TestTypeConversions(t *testing.T) {
 	}
 }
 
-// Benchmark tests
+// Benchmark tests. Each reports allocations, and TestAllocationBudgets
+// fails when a hot path allocates more than its recorded baseline.
 func BenchmarkHashTest(b *testing.B) {
 	data := make([]byte, 1024)
 	for i := range data {
 		data[i] = byte(i)
 	}
 
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_ = ComputeHash(data)
@@ -509,6 +536,7 @@ func BenchmarkHashTest(b *testing.B) {
 }
 
 func BenchmarkGenerateKeyPair(b *testing.B) {
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _, _ = GenerateKeyPair()
@@ -518,6 +546,7 @@ func BenchmarkGenerateKeyPair(b *testing.B) {
 func BenchmarkKEMEncapsulate(b *testing.B) {
 	publicKey, _, _ := KEMKeyGen()
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _, _ = KEMEncapsulate(publicKey)
@@ -530,12 +559,67 @@ func BenchmarkFragmentData(b *testing.B) {
 		data[i] = byte(i)
 	}
 
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = FragmentData(data)
 	}
 }
 
+func BenchmarkKEMKeyGen(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, _ = KEMKeyGen()
+	}
+}
+
+func BenchmarkKEMDecapsulate(b *testing.B) {
+	publicKey, secretKey, _ := KEMKeyGen()
+	ciphertext, _, _ := KEMEncapsulate(publicKey)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = KEMDecapsulate(secretKey, ciphertext)
+	}
+}
+
+func BenchmarkSerializeFragment(b *testing.B) {
+	result, _ := FragmentData(make([]byte, 4096))
+	fragment := result.Fragments[0]
+
+	b.SetBytes(int64(len(fragment.Data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = SerializeFragment(fragment)
+	}
+}
+
+func BenchmarkDeserializeFragment(b *testing.B) {
+	result, _ := FragmentData(make([]byte, 4096))
+	serialized := SerializeFragment(result.Fragments[0])
+
+	b.SetBytes(int64(len(serialized)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = DeserializeFragment(serialized)
+	}
+}
+
+func BenchmarkReconstructData(b *testing.B) {
+	result, _ := FragmentData(make([]byte, 4096))
+
+	b.SetBytes(4096)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = ReconstructData(result.Fragments)
+	}
+}
+
 // Integration tests
 func TestCompleteWorkflow(t *testing.T) {
 	// Generate key pairs
@@ -624,7 +708,7 @@ func TestErrorHandling(t *testing.T) {
 
 	// Test invalid fragment reconstruction
 	fragments := []Fragment{
-		{ID: 1, Index: 0, Total: 2, Data: []byte("test"), Checksum: ComputeHash([]byte("test"))},
+		{ID: LegacyFragmentID(1), Index: 0, Total: 2, Data: []byte("test"), Checksum: ComputeHash([]byte("test"))},
 		// Missing fragment 1
 	}
 	_, err = ReconstructData(fragments)
@@ -646,3 +730,5775 @@ func TestMemoryProfiler(t *testing.T) {
 		t.Error("Memory profiler should return a report")
 	}
 }
+
+// Test parity-based fragment repair
+func TestRepairFromParity(t *testing.T) {
+	data := make([]byte, 3001)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+
+	fragResult, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("Failed to fragment data: %v", err)
+	}
+
+	parity, err := GenerateParity(fragResult.Fragments, 3)
+	if err != nil {
+		t.Fatalf("Failed to generate parity: %v", err)
+	}
+
+	// Drop two fragments and corrupt a third
+	var received []Fragment
+	for i, fragment := range fragResult.Fragments {
+		switch i {
+		case 0, 5:
+			continue
+		case 11:
+			corrupted := make([]byte, len(fragment.Data))
+			copy(corrupted, fragment.Data)
+			corrupted[3] ^= 0x55
+			fragment.Data = corrupted
+		}
+		received = append(received, fragment)
+	}
+
+	repaired, err := RepairFromParity(received, parity)
+	if err != nil {
+		t.Fatalf("Failed to repair from parity: %v", err)
+	}
+
+	reconResult, err := ReconstructData(repaired)
+	if err != nil {
+		t.Fatalf("Failed to reconstruct repaired data: %v", err)
+	}
+
+	if !bytes.Equal(data, reconResult.Data) {
+		t.Error("Repaired data doesn't match original")
+	}
+
+	// More losses than parity shards cannot be repaired
+	if _, err := RepairFromParity(received[3:], parity); err != ErrInsufficientParity {
+		t.Errorf("Expected ErrInsufficientParity, got %v", err)
+	}
+
+	// Intact fragments need no parity, in any order
+	shuffled := append([]Fragment(nil), fragResult.Fragments...)
+	slices.Reverse(shuffled)
+	if intact, err := RepairFromParity(shuffled, nil); err != nil || len(intact) != len(fragResult.Fragments) || intact[0].Index != 0 {
+		t.Errorf("Intact fragments without parity: %v", err)
+	}
+	if _, err := RepairFromParity(received, nil); err != ErrInsufficientParity {
+		t.Errorf("Damaged fragments without parity: got %v, want ErrInsufficientParity", err)
+	}
+
+	// A damaged first shard doesn't decide the layout
+	damaged := append([]ParityShard(nil), parity...)
+	damaged[0].OriginalSize, damaged[0].Checksum = 7, Hash{}
+	if _, err := RepairFromParity(fragResult.Fragments[1:], damaged); err != nil {
+		t.Errorf("Repair with a damaged first shard failed: %v", err)
+	}
+
+	// Intact shards that disagree on the layout are rejected
+	tampered := append([]ParityShard(nil), parity...)
+	tampered[1].OriginalSize = uint64(len(data)) - 1
+	if _, err := RepairFromParity(received, tampered); !errors.Is(err, ErrInvalidFragmentCount) {
+		t.Errorf("Tampered layout: got %v, want ErrInvalidFragmentCount", err)
+	}
+	tampered = append(tampered[:0:0], parity[0])
+	tampered[0].DataShards++
+	if _, err := RepairFromParity(received, tampered); !errors.Is(err, ErrInvalidFragmentCount) {
+		t.Errorf("Inconsistent layout: got %v, want ErrInvalidFragmentCount", err)
+	}
+}
+
+// Test encrypted backup workflow
+func TestBackupRestore(t *testing.T) {
+	alicePublic, aliceSecret, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Failed to generate KEM key pair: %v", err)
+	}
+	bobPublic, bobSecret, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Failed to generate KEM key pair: %v", err)
+	}
+	_, mallorySecret, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Failed to generate KEM key pair: %v", err)
+	}
+
+	data := bytes.Repeat([]byte("wallet seed backup "), 200)
+
+	archive, err := CreateBackup(bytes.NewReader(data), []KEMPublicKey{alicePublic, bobPublic}, &BackupOptions{ParityShards: 2})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	restored, err := RestoreBackup(archive, aliceSecret)
+	if err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	if !bytes.Equal(data, restored) {
+		t.Error("Restored data doesn't match original")
+	}
+
+	// Lose one shard and damage another; parity covers both
+	archive.Shards = archive.Shards[1:]
+	archive.Shards[2].Sealed[0] ^= 0x01
+
+	restored, err = RestoreBackup(archive, bobSecret)
+	if err != nil {
+		t.Fatalf("Failed to restore damaged backup: %v", err)
+	}
+	if !bytes.Equal(data, restored) {
+		t.Error("Restored damaged data doesn't match original")
+	}
+
+	if _, err := RestoreBackup(archive, mallorySecret); err != ErrNoMatchingRecipient {
+		t.Errorf("Expected ErrNoMatchingRecipient, got %v", err)
+	}
+
+	// Intact data shards restore without their parity
+	archive, err = CreateBackup(bytes.NewReader(data), []KEMPublicKey{alicePublic}, &BackupOptions{ParityShards: 2})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	archive.Shards = slices.DeleteFunc(archive.Shards, func(shard BackupShard) bool { return shard.Kind == backupShardParity })
+	if restored, err := RestoreBackup(archive, aliceSecret); err != nil || !bytes.Equal(data, restored) {
+		t.Errorf("Restoring without parity failed: %v", err)
+	}
+}
+
+// Test Shamir secret sharing
+func TestSplitCombineShares(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+
+	recovered, err := CombineShares([]SecretShare{shares[4], shares[0], shares[2]})
+	if err != nil {
+		t.Fatalf("Failed to combine shares: %v", err)
+	}
+	if !bytes.Equal(secret, recovered) {
+		t.Error("Recovered secret doesn't match original")
+	}
+
+	recovered, _ = CombineShares(shares[:2])
+	if bytes.Equal(secret, recovered) {
+		t.Error("Fewer than threshold shares should not recover the secret")
+	}
+
+	if _, err := SplitSecret(secret, 2, 3); err != ErrInvalidThreshold {
+		t.Errorf("Expected ErrInvalidThreshold, got %v", err)
+	}
+}
+
+// Test guardian-based social recovery
+func TestSocialRecovery(t *testing.T) {
+	const guardianCount = 4
+	publicKeys, secretKeys, err := BatchKEMKeyGen(guardianCount)
+	if err != nil {
+		t.Fatalf("Failed to generate guardian keys: %v", err)
+	}
+
+	privateKey, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	kit, err := CreateRecoveryKit(privateKey[:], publicKeys, 3)
+	if err != nil {
+		t.Fatalf("Failed to create recovery kit: %v", err)
+	}
+
+	ceremony := NewRecoveryCeremony(kit)
+	for _, secretKey := range secretKeys[1:] {
+		share, err := kit.DecryptShare(secretKey)
+		if err != nil {
+			t.Fatalf("Guardian failed to decrypt share: %v", err)
+		}
+		if err := ceremony.AddShare(share); err != nil {
+			t.Fatalf("Failed to add share: %v", err)
+		}
+	}
+
+	// A tampered share is rejected
+	bad, _ := kit.DecryptShare(secretKeys[0])
+	bad.Value[0] ^= 0xFF
+	if err := ceremony.AddShare(bad); err != ErrInvalidShare {
+		t.Errorf("Expected ErrInvalidShare, got %v", err)
+	}
+
+	if !ceremony.Ready() {
+		t.Fatal("Ceremony should be ready with 3 shares")
+	}
+
+	newGuardians, _, err := BatchKEMKeyGen(3)
+	if err != nil {
+		t.Fatalf("Failed to generate new guardian keys: %v", err)
+	}
+
+	secret, newKit, err := ceremony.Rotate(newGuardians, 2)
+	if err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if !bytes.Equal(secret, privateKey[:]) {
+		t.Error("Recovered secret doesn't match original key")
+	}
+	if HashEqual(newKit.KitID, kit.KitID) || len(newKit.Shares) != 3 {
+		t.Error("Rotation should produce a fresh kit for the new guardians")
+	}
+}
+
+// Test nonce derivation and misuse detection
+func TestNonceSequence(t *testing.T) {
+	key := []byte("nonce sequence key")
+	store := NewFileCounterStore(t.TempDir() + "/counter")
+
+	seq, err := NewNonceSequence(key, []byte("ctx"), &NonceSequenceOptions{Store: store, Reservation: 4})
+	if err != nil {
+		t.Fatalf("Failed to create nonce sequence: %v", err)
+	}
+
+	seen := make(map[Nonce]bool)
+	for i := 0; i < 10; i++ {
+		nonce, counter, err := seq.Next()
+		if err != nil {
+			t.Fatalf("Failed to get nonce: %v", err)
+		}
+		if counter != uint64(i) || nonce != DeriveNonce(key, counter, []byte("ctx")) {
+			t.Errorf("Unexpected nonce for counter %d", counter)
+		}
+		if seen[nonce] {
+			t.Error("Nonce sequence repeated a nonce")
+		}
+		seen[nonce] = true
+	}
+
+	if _, err := seq.Use(5); err != ErrNonceReuse {
+		t.Errorf("Expected ErrNonceReuse, got %v", err)
+	}
+
+	// A restarted sequence never hands out a counter that may have been used
+	resumed, err := NewNonceSequence(key, []byte("ctx"), &NonceSequenceOptions{Store: store, Reservation: 4})
+	if err != nil {
+		t.Fatalf("Failed to resume nonce sequence: %v", err)
+	}
+	nonce, counter, err := resumed.Next()
+	if err != nil {
+		t.Fatalf("Failed to get resumed nonce: %v", err)
+	}
+	if counter < 10 || seen[nonce] {
+		t.Errorf("Resumed sequence reused counter %d", counter)
+	}
+
+	if _, err := resumed.Use(^uint64(0)); err != ErrNonceExhausted {
+		t.Errorf("Expected ErrNonceExhausted, got %v", err)
+	}
+
+	if DeriveNonce(key, 1, []byte("a")) == DeriveNonce(key, 1, []byte("b")) {
+		t.Error("Different contexts should derive different nonces")
+	}
+}
+
+// Test rotating ephemeral keys
+func TestEphemeralKeyer(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	keyer, err := NewEphemeralKeyer(&EphemeralKeyerOptions{
+		RotationInterval: time.Minute,
+		Overlap:          1,
+		Clock:            func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create ephemeral keyer: %v", err)
+	}
+	defer keyer.Close()
+
+	first, err := keyer.Current()
+	if err != nil {
+		t.Fatalf("Failed to get current key: %v", err)
+	}
+
+	ciphertext, sharedSecret, err := KEMEncapsulate(first.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encapsulate: %v", err)
+	}
+
+	// One rotation later the previous epoch is still accepted
+	now = now.Add(time.Minute)
+	second, _ := keyer.Current()
+	if second.Epoch != first.Epoch+1 || KEMPublicKeyEqual(second.PublicKey, first.PublicKey) {
+		t.Error("Keyer should rotate to a fresh key each epoch")
+	}
+
+	keys, _ := keyer.PublicKeys()
+	if len(keys) != 2 || keys[0].Epoch != second.Epoch {
+		t.Errorf("Expected 2 published keys newest first, got %d", len(keys))
+	}
+
+	recovered, err := keyer.Decapsulate(first.Epoch, ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decapsulate with previous epoch: %v", err)
+	}
+	if !SharedSecretEqual(sharedSecret, recovered) {
+		t.Error("Shared secrets don't match")
+	}
+
+	// Beyond the overlap window the old key is gone
+	now = now.Add(time.Minute)
+	if _, err := keyer.Decapsulate(first.Epoch, ciphertext); err != ErrEpochExpired {
+		t.Errorf("Expected ErrEpochExpired, got %v", err)
+	}
+
+	// An epoch boundary passing during Current returns the key it rotated to
+	ticking := time.Unix(1700000000, 0)
+	racing, err := NewEphemeralKeyer(&EphemeralKeyerOptions{
+		RotationInterval: time.Minute,
+		Clock: func() time.Time {
+			ticking = ticking.Add(time.Minute)
+			return ticking
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create ephemeral keyer: %v", err)
+	}
+	defer racing.Close()
+	if key, err := racing.Current(); err != nil || key.PublicKey == (KEMPublicKey{}) {
+		t.Errorf("Current across an epoch boundary: %v", err)
+	}
+}
+
+// Test consistent and rendezvous placement
+func TestConsistentHashRing(t *testing.T) {
+	ring := NewConsistentHashRing(32)
+	if _, err := ring.Locate([]byte("key")); err != ErrNoNodes {
+		t.Errorf("Expected ErrNoNodes, got %v", err)
+	}
+
+	ring.Add("node-a", 1)
+	ring.Add("node-b", 1)
+	ring.Add("node-c", 2)
+
+	before := make(map[string]string)
+	for i := 0; i < 500; i++ {
+		key := []byte{byte(i), byte(i >> 8)}
+		node, err := ring.Locate(key)
+		if err != nil {
+			t.Fatalf("Failed to locate key: %v", err)
+		}
+		before[string(key)] = node
+	}
+
+	// Serialization round trip yields identical placement
+	encoded, err := ring.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal ring: %v", err)
+	}
+	restored := NewConsistentHashRing(0)
+	if err := restored.UnmarshalJSON(encoded); err != nil {
+		t.Fatalf("Failed to unmarshal ring: %v", err)
+	}
+
+	// Removing a node only moves the keys it owned
+	restored.Remove("node-b")
+	for key, node := range before {
+		moved, _ := restored.Locate([]byte(key))
+		if node != "node-b" && moved != node {
+			t.Errorf("Key owned by %s moved to %s", node, moved)
+		}
+	}
+
+	replicas, _ := ring.LocateN([]byte("key"), 5)
+	if len(replicas) != 3 {
+		t.Errorf("Expected 3 distinct replicas, got %d", len(replicas))
+	}
+}
+
+func TestRendezvousHashing(t *testing.T) {
+	nodes := []PlacementNode{{ID: "a", Weight: 1}, {ID: "b", Weight: 1}, {ID: "c", Weight: 4}}
+
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		node, err := RendezvousLocate([]byte{byte(i), byte(i >> 8)}, nodes)
+		if err != nil {
+			t.Fatalf("Failed to locate key: %v", err)
+		}
+		counts[node.ID]++
+	}
+
+	// The weight-4 node should own roughly two thirds of the keys
+	if counts["c"] < 1600 || counts["c"] > 2400 {
+		t.Errorf("Weighted node owns %d of 3000 keys", counts["c"])
+	}
+
+	ranked := RendezvousRank([]byte("key"), nodes)
+	if len(ranked) != len(nodes) || ranked[0] != RendezvousRank([]byte("key"), nodes[:])[0] {
+		t.Error("Rendezvous ranking should be deterministic")
+	}
+}
+
+// Test identifier generation
+func TestNewID(t *testing.T) {
+	previous, err := NewID()
+	if err != nil {
+		t.Fatalf("Failed to generate ID: %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		id, err := NewID()
+		if err != nil {
+			t.Fatalf("Failed to generate ID: %v", err)
+		}
+		if id.Compare(previous) <= 0 || id.String() <= previous.String() {
+			t.Fatal("IDs should be strictly increasing")
+		}
+		previous = id
+	}
+
+	parsed, err := ParseID(strings.ToLower(previous.String()))
+	if err != nil {
+		t.Fatalf("Failed to parse ID: %v", err)
+	}
+	if parsed != previous {
+		t.Error("ID string round trip failed")
+	}
+
+	if d := time.Since(previous.Time()); d < 0 || d > time.Minute {
+		t.Errorf("ID timestamp is off by %v", d)
+	}
+
+	if _, err := ParseID("8ZZZZZZZZZZZZZZZZZZZZZZZZZ"); err != ErrInvalidIDEncoding {
+		t.Errorf("Expected ErrInvalidIDEncoding, got %v", err)
+	}
+
+	h := ComputeHash([]byte("content"))
+	if IDFromHash(h) != IDFromHash(h) || IDFromHash(h) == IDFromHash(ComputeHash([]byte("other"))) {
+		t.Error("Content IDs should be deterministic and distinct")
+	}
+}
+
+// Test 128-bit fragment IDs and legacy wire format
+func TestFragmentIDCollisions(t *testing.T) {
+	data := []byte("fragment id collision test payload")
+
+	seen := make(map[ID]bool)
+	for i := 0; i < 5000; i++ {
+		result, err := FragmentData(data)
+		if err != nil {
+			t.Fatalf("Failed to fragment data: %v", err)
+		}
+		id := result.Fragments[0].ID
+		if seen[id] {
+			t.Fatalf("Fragment ID collision after %d fragmentations", i)
+		}
+		seen[id] = true
+	}
+}
+
+func TestDeserializeLegacyFragment(t *testing.T) {
+	payload := []byte("legacy payload")
+	checksum := ComputeHash(payload)
+
+	// ID(4) + Index + Total + DataLen + Data + Checksum
+	legacy := []byte{0xDE, 0xAD, 0xBE, 0xEF, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, byte(len(payload))}
+	legacy = append(legacy, payload...)
+	legacy = append(legacy, checksum[:]...)
+
+	fragment, err := DeserializeFragment(legacy)
+	if err != nil {
+		t.Fatalf("Failed to deserialize legacy fragment: %v", err)
+	}
+
+	if fragment.ID != LegacyFragmentID(0xDEADBEEF) || fragment.Index != 2 || fragment.Total != 3 {
+		t.Error("Legacy fragment header decoded incorrectly")
+	}
+	if !bytes.Equal(fragment.Data, payload) || !HashEqual(fragment.Checksum, checksum) {
+		t.Error("Legacy fragment body decoded incorrectly")
+	}
+
+	// Re-serializing upgrades to the 128-bit format
+	upgraded, err := DeserializeFragment(SerializeFragment(fragment))
+	if err != nil || upgraded.ID != fragment.ID {
+		t.Error("Upgraded fragment should keep its ID")
+	}
+}
+
+// Test hash chains
+func TestHashChain(t *testing.T) {
+	chain, err := HashChain([]byte("one-time password seed"), 100)
+	if err != nil {
+		t.Fatalf("Failed to create hash chain: %v", err)
+	}
+
+	tip := chain.Tip()
+	last := tip
+	for i := 0; i < 5; i++ {
+		link, index, ok := chain.Next()
+		if !ok || index != 99-i {
+			t.Fatalf("Unexpected chain position %d", index)
+		}
+		if !VerifyChainLink(last, link, 1) {
+			t.Errorf("Link %d doesn't hash to the previous link", index)
+		}
+		if !VerifyChainLink(tip, link, 100-index) {
+			t.Errorf("Link %d doesn't verify against the tip", index)
+		}
+		last = link
+	}
+
+	if VerifyChainLink(tip, last, 1) {
+		t.Error("Wrong distance should not verify")
+	}
+
+	if chain.Remaining() != 95 || len(chain.Checkpoints()) != 11 {
+		t.Error("Unexpected chain bookkeeping")
+	}
+
+	if _, err := HashChain([]byte("seed"), 0); err != ErrInvalidChainLength {
+		t.Errorf("Expected ErrInvalidChainLength, got %v", err)
+	}
+}
+
+// Test WOTS+ one-time signatures
+func TestWOTSSignVerify(t *testing.T) {
+	for _, w := range []int{4, 16, 256} {
+		params := WOTSParams{W: w}
+		sk, err := GenerateWOTSKey(params)
+		if err != nil {
+			t.Fatalf("Failed to generate WOTS key (w=%d): %v", w, err)
+		}
+
+		message := []byte("one-time message")
+		signature, err := sk.Sign(message)
+		if err != nil {
+			t.Fatalf("Failed to sign (w=%d): %v", w, err)
+		}
+		if len(signature.Chains) != params.SignatureSize() {
+			t.Errorf("Unexpected signature size %d (w=%d)", len(signature.Chains), w)
+		}
+
+		pk := sk.Public()
+		if !pk.Verify(message, signature) {
+			t.Errorf("Valid signature rejected (w=%d)", w)
+		}
+		if pk.Verify([]byte("other message"), signature) {
+			t.Errorf("Signature verified for wrong message (w=%d)", w)
+		}
+
+		// The key must refuse to sign again
+		if _, err := sk.Sign([]byte("second message")); err != ErrKeyAlreadyUsed {
+			t.Errorf("Expected ErrKeyAlreadyUsed, got %v", err)
+		}
+
+		// Serialization round-trips
+		parsedPK, err := WOTSPublicKeyFromBytes(pk.Bytes())
+		if err != nil || parsedPK != pk {
+			t.Errorf("Public key round-trip failed (w=%d): %v", w, err)
+		}
+		parsedSig, err := WOTSSignatureFromBytes(signature.Bytes())
+		if err != nil || !parsedPK.Verify(message, parsedSig) {
+			t.Errorf("Signature round-trip failed (w=%d): %v", w, err)
+		}
+		restored, err := WOTSPrivateKeyFromBytes(sk.Bytes())
+		if err != nil || !restored.Used() || restored.Public() != pk {
+			t.Errorf("Private key round-trip failed (w=%d): %v", w, err)
+		}
+	}
+
+	if _, err := GenerateWOTSKey(WOTSParams{W: 8}); err != ErrInvalidWinternitz {
+		t.Errorf("Expected ErrInvalidWinternitz, got %v", err)
+	}
+}
+
+// Test WOTS+ chain lengths and checksum
+func TestWOTSParams(t *testing.T) {
+	expected := map[int][2]int{4: {128, 5}, 16: {64, 3}, 256: {32, 2}}
+	for w, lens := range expected {
+		params := WOTSParams{W: w}
+		if params.Len1() != lens[0] || params.Len2() != lens[1] {
+			t.Errorf("w=%d: expected len1=%d len2=%d, got %d %d", w, lens[0], lens[1], params.Len1(), params.Len2())
+		}
+	}
+
+	// An all-zero digest has the maximum checksum, so every checksum digit is nonzero
+	params := DefaultWOTSParams()
+	lengths := params.chainLengths(make([]byte, WOTSHashSize))
+	checksum := 0
+	for _, digit := range lengths[params.Len1():] {
+		checksum = checksum*params.W + digit
+	}
+	if checksum != params.Len1()*(params.W-1) {
+		t.Errorf("Unexpected checksum %d", checksum)
+	}
+}
+
+// Test XMSS stateful signatures and state persistence
+func TestXMSSSignVerify(t *testing.T) {
+	params := XMSSParams{Height: 3, WOTS: DefaultWOTSParams()}
+	store := NewFileCounterStore(t.TempDir() + "/xmss.state")
+
+	sk, err := GenerateXMSSKey(params, &XMSSOptions{Store: store})
+	if err != nil {
+		t.Fatalf("Failed to generate XMSS key: %v", err)
+	}
+	pk := sk.Public()
+
+	message := []byte("firmware image v1.2.3")
+	signature, err := sk.Sign(message)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if !pk.Verify(message, signature) {
+		t.Error("Valid signature rejected")
+	}
+	if pk.Verify([]byte("firmware image v1.2.4"), signature) {
+		t.Error("Signature verified for wrong message")
+	}
+
+	parsed, err := XMSSSignatureFromBytes(params, signature.Bytes())
+	if err != nil || !pk.Verify(message, parsed) {
+		t.Errorf("Signature round-trip failed: %v", err)
+	}
+	parsed.Index = 1
+	if pk.Verify(message, parsed) {
+		t.Error("Signature with altered index should not verify")
+	}
+
+	parsedPK, err := XMSSPublicKeyFromBytes(pk.Bytes())
+	if err != nil || parsedPK != pk {
+		t.Errorf("Public key round-trip failed: %v", err)
+	}
+
+	// A restarted signer resumes after the persisted index
+	restored, err := LoadXMSSKey(sk.Bytes(), &XMSSOptions{Store: store})
+	if err != nil {
+		t.Fatalf("Failed to load XMSS key: %v", err)
+	}
+	if restored.Public() != pk || restored.Index() != 1 {
+		t.Fatalf("Restored key at index %d", restored.Index())
+	}
+
+	for restored.Remaining() > 0 {
+		signature, err := restored.Sign(message)
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		if signature.Index == 0 || !pk.Verify(message, signature) {
+			t.Errorf("Bad signature at index %d", signature.Index)
+		}
+	}
+	if _, err := restored.Sign(message); err != ErrKeyExhausted {
+		t.Errorf("Expected ErrKeyExhausted, got %v", err)
+	}
+
+	if _, err := GenerateXMSSKey(XMSSParams{Height: 0, WOTS: DefaultWOTSParams()}, nil); err != ErrInvalidTreeHeight {
+		t.Errorf("Expected ErrInvalidTreeHeight, got %v", err)
+	}
+
+	// A lost state file isn't mistaken for a new key
+	statePath := t.TempDir() + "/lost.state"
+	lost, err := GenerateXMSSKey(params, &XMSSOptions{Store: NewFileCounterStore(statePath)})
+	if err != nil {
+		t.Fatalf("Failed to generate XMSS key: %v", err)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("Key generation didn't initialise the state: %v", err)
+	}
+	if err := os.Remove(statePath); err != nil {
+		t.Fatalf("Removing the state failed: %v", err)
+	}
+	if _, err := LoadXMSSKey(lost.Bytes(), &XMSSOptions{Store: NewFileCounterStore(statePath)}); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("Expected ErrStateNotFound without state, got %v", err)
+	}
+	if _, err := LoadXMSSKey(lost.Bytes(), nil); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("Expected ErrStateNotFound with an empty memory store, got %v", err)
+	}
+}
+
+// Test detached file signatures
+func TestSignVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/release.tar.gz"
+	if err := os.WriteFile(path, []byte("release artifact contents"), 0o644); err != nil {
+		t.Fatalf("Failed to write artifact: %v", err)
+	}
+
+	key, err := GenerateXMSSKey(XMSSParams{Height: 2, WOTS: DefaultWOTSParams()}, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	other, err := GenerateXMSSKey(XMSSParams{Height: 2, WOTS: DefaultWOTSParams()}, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	sig, err := SignFile(path, key)
+	if err != nil {
+		t.Fatalf("Failed to sign file: %v", err)
+	}
+	sigPath := path + FileSignatureExtension
+	if err := WriteFileSignature(sigPath, sig); err != nil {
+		t.Fatalf("Failed to write signature: %v", err)
+	}
+	sig, err = ReadFileSignature(sigPath)
+	if err != nil {
+		t.Fatalf("Failed to read signature: %v", err)
+	}
+
+	signer, err := VerifyFile(path, sig, []XMSSPublicKey{other.Public(), key.Public()})
+	if err != nil || signer != key.Public() {
+		t.Errorf("Valid file signature rejected: %v", err)
+	}
+
+	if _, err := VerifyFile(path, sig, []XMSSPublicKey{other.Public()}); err != ErrUntrustedSigner {
+		t.Errorf("Expected ErrUntrustedSigner, got %v", err)
+	}
+
+	tampered := *sig
+	tampered.Timestamp = tampered.Timestamp.Add(time.Hour)
+	if _, err := VerifyFile(path, &tampered, []XMSSPublicKey{key.Public()}); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("modified contents"), 0o644); err != nil {
+		t.Fatalf("Failed to modify artifact: %v", err)
+	}
+	if _, err := VerifyFile(path, sig, []XMSSPublicKey{key.Public()}); err != ErrFileModified {
+		t.Errorf("Expected ErrFileModified, got %v", err)
+	}
+}
+
+// Test git-style object hashing
+func TestHashObject(t *testing.T) {
+	content := []byte("hello world\n")
+
+	if string(GitObjectHeader(ObjectBlob, 12)) != "blob 12\x00" {
+		t.Errorf("Unexpected header %q", GitObjectHeader(ObjectBlob, 12))
+	}
+
+	blob := HashObject(ObjectBlob, content)
+	if !HashEqual(blob, ComputeHash(append([]byte("blob 12\x00"), content...))) {
+		t.Error("Blob hash should cover the git header and content")
+	}
+
+	streamed, err := HashObjectReader(nil, ObjectBlob, bytes.NewReader(content), int64(len(content)))
+	if err != nil || !HashEqual(streamed, blob) {
+		t.Errorf("Streaming object hash mismatch: %v", err)
+	}
+	if _, err := HashObjectReader(nil, ObjectBlob, bytes.NewReader(content), 5); err != ErrObjectSizeMismatch {
+		t.Errorf("Expected ErrObjectSizeMismatch, got %v", err)
+	}
+
+	custom := func(objType string, size int64) []byte { return []byte("z512:" + objType + "\x00") }
+	if HashEqual(HashObjectWithHeader(custom, ObjectBlob, content), blob) {
+		t.Error("Custom header should change the object hash")
+	}
+
+	// Entry order must not matter, and directories sort as if suffixed with '/'
+	entries := []TreeEntry{
+		{Mode: ModeFile, Name: "foo.txt", Hash: blob},
+		{Mode: ModeDirectory, Name: "foo", Hash: blob},
+		{Mode: ModeExecutable, Name: "foo-bar", Hash: blob},
+	}
+	reversed := []TreeEntry{entries[2], entries[1], entries[0]}
+	if !HashEqual(HashTree(entries), HashTree(reversed)) {
+		t.Error("Tree hash should not depend on entry order")
+	}
+
+	encoded := EncodeTree(entries)
+	if !bytes.HasPrefix(encoded, []byte("100755 foo-bar\x00")) {
+		t.Errorf("Unexpected tree order: %q", encoded[:16])
+	}
+	if !bytes.Contains(encoded, []byte("40000 foo\x00")) {
+		t.Error("Directory mode should be encoded without a leading zero")
+	}
+}
+
+// Test build attestations
+func TestBuildAttestation(t *testing.T) {
+	source := t.TempDir()
+	os.WriteFile(source+"/main.go", []byte("package main\n"), 0o644)
+	os.Mkdir(source+"/internal", 0o755)
+	os.WriteFile(source+"/internal/build.sh", []byte("#!/bin/sh\n"), 0o755)
+
+	sourceHash, err := HashDirectory(source)
+	if err != nil {
+		t.Fatalf("Failed to hash source tree: %v", err)
+	}
+	again, _ := HashDirectory(source)
+	if !HashEqual(sourceHash, again) {
+		t.Error("Source tree hash should be deterministic")
+	}
+
+	output := t.TempDir() + "/topay-node"
+	os.WriteFile(output, []byte("node binary"), 0o755)
+
+	env := EnvironmentDigest(map[string]string{"GOOS": "linux", "GOARCH": "amd64", "GOVERSION": "go1.21.0"})
+	if HashEqual(env, EnvironmentDigest(map[string]string{"GOOS": "linux", "GOARCH": "arm64", "GOVERSION": "go1.21.0"})) {
+		t.Error("Different environments should have different digests")
+	}
+
+	attestation := NewBuildAttestation(sourceHash, env, nil)
+	if err := attestation.AddArtifactFile("topay-node", output); err != nil {
+		t.Fatalf("Failed to add artifact: %v", err)
+	}
+
+	key, err := GenerateXMSSKey(XMSSParams{Height: 2, WOTS: DefaultWOTSParams()}, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if err := attestation.Sign(key); err != nil {
+		t.Fatalf("Failed to sign attestation: %v", err)
+	}
+
+	// Round-trip through JSON as an attestation would ship
+	encoded, err := json.Marshal(attestation)
+	if err != nil {
+		t.Fatalf("Failed to encode attestation: %v", err)
+	}
+	var decoded BuildAttestation
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode attestation: %v", err)
+	}
+
+	if _, err := decoded.Verify([]XMSSPublicKey{key.Public()}); err != nil {
+		t.Errorf("Valid attestation rejected: %v", err)
+	}
+	if err := decoded.VerifyArtifactFile("topay-node", output); err != nil {
+		t.Errorf("Artifact should match: %v", err)
+	}
+	if err := decoded.VerifyArtifactFile("topay-wallet", output); err != ErrUnknownArtifact {
+		t.Errorf("Expected ErrUnknownArtifact, got %v", err)
+	}
+
+	decoded.Artifacts[0].Size++
+	if _, err := decoded.Verify([]XMSSPublicKey{key.Public()}); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+// Test fragmentation just above the MaxFragments cap
+func TestFragmentDataAboveCap(t *testing.T) {
+	data := bytes.Repeat([]byte{0xA5}, FragmentSize*MaxFragments+1)
+
+	result, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("Failed to fragment: %v", err)
+	}
+	if len(result.Fragments) > MaxFragments {
+		t.Errorf("Got %d fragments, more than MaxFragments", len(result.Fragments))
+	}
+
+	reconstructed, err := ReconstructData(result.Fragments)
+	if err != nil || !bytes.Equal(reconstructed.Data, data) {
+		t.Errorf("Reconstruction failed: %v", err)
+	}
+}
+
+// Test DeserializeFragment limits against oversized and inconsistent headers
+func TestDeserializeFragmentLimits(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1000)
+	result, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("Failed to fragment: %v", err)
+	}
+	serialized := SerializeFragment(result.Fragments[0])
+
+	limits := &FragmentLimits{OriginalSize: uint64(len(data))}
+	if _, err := DeserializeFragmentWithLimits(serialized, limits); err != nil {
+		t.Errorf("Valid fragment rejected: %v", err)
+	}
+
+	// A header claiming a 4GB payload is rejected before allocating
+	huge := append([]byte(nil), serialized[:fragmentHeaderSize]...)
+	binary.BigEndian.PutUint32(huge[fragmentHeaderSize-4:], 0xFFFFFFFF)
+	huge = append(huge, make([]byte, HashSize)...)
+	_, err = DeserializeFragment(huge)
+	var decodeErr *FragmentDecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, ErrFragmentTooLarge) {
+		t.Errorf("Expected ErrFragmentTooLarge, got %v", err)
+	}
+
+	if _, err := DeserializeFragmentWithLimits(serialized, &FragmentLimits{MaxDataSize: 16}); !errors.Is(err, ErrFragmentTooLarge) {
+		t.Errorf("Expected ErrFragmentTooLarge for small MaxDataSize, got %v", err)
+	}
+	if _, err := DeserializeFragmentWithLimits(serialized, &FragmentLimits{OriginalSize: 100}); !errors.Is(err, ErrFragmentTooLarge) {
+		t.Errorf("Expected ErrFragmentTooLarge against OriginalSize, got %v", err)
+	}
+
+	badIndex := result.Fragments[0]
+	badIndex.Index = badIndex.Total
+	if _, err := DeserializeFragment(SerializeFragment(badIndex)); !errors.Is(err, ErrInvalidFragmentIndex) {
+		t.Errorf("Expected ErrInvalidFragmentIndex, got %v", err)
+	}
+
+	if _, err := DeserializeFragment(serialized[:10]); !errors.Is(err, ErrFragmentTruncated) {
+		t.Errorf("Expected ErrFragmentTruncated, got %v", err)
+	}
+}
+
+// Test documented input limits
+func TestInputLimits(t *testing.T) {
+	limits := Limits()
+	if limits.MaxBatchSize != MaxBatchSize || limits.MaxFragments != MaxFragments {
+		t.Error("Limits should report the documented constants")
+	}
+	if limits.MaxFragmentedDataSize == 0 || limits.MaxFragmentedDataSize > MaxFragmentedDataSize {
+		t.Errorf("Unexpected fragmented data limit %d", limits.MaxFragmentedDataSize)
+	}
+
+	_, _, err := BatchKEMKeyGen(MaxBatchSize + 1)
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, ErrTooLarge) || tooLarge.Max != MaxBatchSize {
+		t.Errorf("Expected TooLargeError for batch size, got %v", err)
+	}
+	if _, _, err := BatchGenerateKeyPairs(MaxBatchSize + 1); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge for key pair batch, got %v", err)
+	}
+
+	sh := NewStreamingHash()
+	defer sh.Close()
+	sh.state.totalLen = MaxHashInputSize - 4
+	if _, err := sh.Write(make([]byte, 4)); err != nil {
+		t.Errorf("Write up to the limit should succeed: %v", err)
+	}
+	if _, err := sh.Write(make([]byte, 1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge past the hash input limit, got %v", err)
+	}
+}
+
+// Test streaming hash Close and the concurrency-safe variant
+func TestStreamingHashClose(t *testing.T) {
+	sh := NewStreamingHash()
+	sh.Write([]byte("data"))
+	sh.Close()
+	sh.Close()
+	if _, err := sh.Write([]byte("more")); err != ErrHashClosed {
+		t.Errorf("Expected ErrHashClosed, got %v", err)
+	}
+	if sh.Sum() != (Hash{}) {
+		t.Error("Sum after Close should return the zero hash")
+	}
+
+	// Concurrent writes of identical chunks hash the same regardless of order
+	ssh := NewSyncStreamingHash()
+	chunk := bytes.Repeat([]byte{0x5A}, 100)
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func() {
+			for j := 0; j < 50; j++ {
+				ssh.Write(chunk)
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+
+	expected := ComputeHash(bytes.Repeat(chunk, 400))
+	if !HashEqual(ssh.Sum(), expected) {
+		t.Error("Concurrent writes lost or interleaved data")
+	}
+
+	closed := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			ssh.Close()
+			closed <- struct{}{}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-closed
+	}
+}
+
+// Test intermediate digests with Peek and non-resetting Sum
+func TestStreamingHashPeek(t *testing.T) {
+	sh := NewStreamingHash()
+	defer sh.Close()
+
+	sh.Write([]byte("hello "))
+	if !HashEqual(sh.Peek(), ComputeHash([]byte("hello "))) {
+		t.Error("Peek should hash the data written so far")
+	}
+
+	sh.Write([]byte("world"))
+	first := sh.Sum()
+	if !HashEqual(first, ComputeHash([]byte("hello world"))) {
+		t.Error("Writing after Peek should continue the stream")
+	}
+	if !HashEqual(sh.Sum(), first) {
+		t.Error("Sum should not reset the state")
+	}
+
+	sh.Reset()
+	sh.Write([]byte("fresh"))
+	if !HashEqual(sh.Sum(), ComputeHash([]byte("fresh"))) {
+		t.Error("Reset should discard earlier data")
+	}
+}
+
+// Test batch hashing with per-input salts
+func TestBatchHashWithSalts(t *testing.T) {
+	inputs := [][]byte{[]byte("alice"), []byte("bob"), []byte("carol"), []byte("bob")}
+	salts := [][]byte{[]byte("s1"), []byte("s2"), []byte("s3"), []byte("s4")}
+
+	hashes, err := BatchHashWithSalts(inputs, salts)
+	if err != nil {
+		t.Fatalf("Batch hash failed: %v", err)
+	}
+	for i := range inputs {
+		if !HashEqual(hashes[i], HashWithSalt(inputs[i], salts[i])) {
+			t.Errorf("Hash %d doesn't match HashWithSalt", i)
+		}
+	}
+	if HashEqual(hashes[1], hashes[3]) {
+		t.Error("Different salts should give different hashes for the same input")
+	}
+
+	if _, err := BatchHashWithSalts(inputs, salts[:2]); err != ErrInvalidFragmentCount {
+		t.Errorf("Expected ErrInvalidFragmentCount for mismatched lengths, got %v", err)
+	}
+}
+
+// Test keyed fragment checksums
+func TestKeyedFragmentChecksums(t *testing.T) {
+	var secret SharedSecret
+	copy(secret[:], "transfer shared secret")
+	key := DeriveFragmentKey(secret)
+
+	data := make([]byte, 3*FragmentSize+17)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	result, err := FragmentDataWithKey(data, &key)
+	if err != nil {
+		t.Fatalf("Keyed fragmentation failed: %v", err)
+	}
+	reconstructed, err := ReconstructDataWithKey(result.Fragments, &key)
+	if err != nil {
+		t.Fatalf("Keyed reconstruction failed: %v", err)
+	}
+	if !bytes.Equal(reconstructed.Data, data) {
+		t.Error("Reconstructed data doesn't match original")
+	}
+
+	// A relay modifying data and recomputing the unkeyed checksum is detected
+	forged := make([]Fragment, len(result.Fragments))
+	copy(forged, result.Fragments)
+	forged[1].Data = append([]byte(nil), forged[1].Data...)
+	forged[1].Data[0] ^= 0xFF
+	forged[1].Checksum = ComputeHash(forged[1].Data)
+	if _, err := ReconstructDataWithKey(forged, &key); err != ErrReconstructionFailed {
+		t.Errorf("Expected ErrReconstructionFailed for forged fragment, got %v", err)
+	}
+	if err := ValidateFragmentIntegrityWithKey(forged[1], &key); err != ErrReconstructionFailed {
+		t.Errorf("Expected forged fragment to fail validation, got %v", err)
+	}
+
+	// Swapping fragment contents between positions is detected
+	swapped := make([]Fragment, len(result.Fragments))
+	copy(swapped, result.Fragments)
+	swapped[0].Data, swapped[1].Data = swapped[1].Data, swapped[0].Data
+	swapped[0].Checksum, swapped[1].Checksum = swapped[1].Checksum, swapped[0].Checksum
+	if _, err := ReconstructDataWithKey(swapped, &key); err == nil {
+		t.Error("Expected swapped fragments to fail keyed reconstruction")
+	}
+
+	// A different key rejects the fragments
+	var otherSecret SharedSecret
+	otherKey := DeriveFragmentKey(otherSecret)
+	if _, err := ReconstructDataWithKey(result.Fragments, &otherKey); err != ErrReconstructionFailed {
+		t.Errorf("Expected wrong key to fail, got %v", err)
+	}
+
+	// Unkeyed reconstruction still works for unkeyed fragments
+	plain, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("Fragmentation failed: %v", err)
+	}
+	if _, err := ReconstructDataWithKey(plain.Fragments, nil); err != nil {
+		t.Errorf("Unkeyed reconstruction failed: %v", err)
+	}
+}
+
+// Test fragment ordering strategies and progressive decoding
+func TestFragmentOrdering(t *testing.T) {
+	data := make([]byte, 8*FragmentSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	result, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("Fragmentation failed: %v", err)
+	}
+	if len(result.Fragments) != 8 {
+		t.Fatalf("Expected 8 fragments, got %d", len(result.Fragments))
+	}
+
+	interleaved, err := OrderFragments(result.Fragments, OrderInterleaved)
+	if err != nil {
+		t.Fatalf("Interleaved ordering failed: %v", err)
+	}
+	expected := []uint32{0, 4, 2, 6, 1, 5, 3, 7}
+	for i, fragment := range interleaved {
+		if fragment.Index != expected[i] {
+			t.Errorf("Interleaved position %d: expected index %d, got %d", i, expected[i], fragment.Index)
+		}
+	}
+
+	// Reversed input comes back sequential
+	reversed := make([]Fragment, len(result.Fragments))
+	for i, fragment := range result.Fragments {
+		reversed[len(reversed)-1-i] = fragment
+	}
+	sequential, _ := OrderFragments(reversed, OrderSequential)
+	for i, fragment := range sequential {
+		if fragment.Index != uint32(i) {
+			t.Errorf("Sequential position %d has index %d", i, fragment.Index)
+		}
+	}
+
+	// Header-first sends the prioritized fragments before the rest
+	SetHeaderPriority(reversed, FragmentSize+1, 1)
+	headerFirst, _ := OrderFragments(reversed, OrderHeaderFirst)
+	for i, want := range []uint32{0, 1, 2, 3} {
+		if headerFirst[i].Index != want {
+			t.Errorf("Header-first position %d: expected index %d, got %d", i, want, headerFirst[i].Index)
+		}
+	}
+	if headerFirst[1].Priority != 1 || headerFirst[2].Priority != 0 {
+		t.Error("Expected only the first two fragments to be prioritized")
+	}
+
+	if _, err := OrderFragments(result.Fragments, FragmentOrder(99)); err != ErrInvalidFragmentOrder {
+		t.Errorf("Expected ErrInvalidFragmentOrder, got %v", err)
+	}
+
+	// The contiguous prefix grows as fragments arrive
+	received := []Fragment{result.Fragments[1], result.Fragments[3]}
+	if prefix := AvailablePrefix(received, nil); len(prefix) != 0 {
+		t.Errorf("Expected empty prefix without fragment 0, got %d bytes", len(prefix))
+	}
+	received = append(received, result.Fragments[0])
+	if prefix := AvailablePrefix(received, nil); !bytes.Equal(prefix, data[:2*FragmentSize]) {
+		t.Errorf("Expected prefix of two fragments, got %d bytes", len(prefix))
+	}
+}
+
+// Test demultiplexing interleaved fragment streams
+func TestDemultiplexer(t *testing.T) {
+	payloads := [][]byte{
+		bytes.Repeat([]byte("first payload "), 1000),
+		bytes.Repeat([]byte("second payload "), 700),
+		[]byte("tiny"),
+	}
+
+	results := make([]FragmentationResult, len(payloads))
+	for i, payload := range payloads {
+		var err error
+		results[i], err = FragmentData(payload)
+		if err != nil {
+			t.Fatalf("Fragmentation %d failed: %v", i, err)
+		}
+	}
+
+	completed := make(map[ID][]byte)
+	demux := NewDemultiplexer(&DemultiplexerOptions{
+		OnComplete: func(id ID, result ReconstructionResult, err error) {
+			if err != nil {
+				t.Errorf("Payload failed: %v", err)
+			}
+			completed[id] = result.Data
+		},
+	})
+
+	var tinyDone bool
+	demux.Expect(results[2].Fragments[0].ID, func(id ID, result ReconstructionResult, err error) {
+		tinyDone = err == nil && bytes.Equal(result.Data, payloads[2])
+	})
+
+	// Interleave the streams, newest fragment first, through the wire format
+	for position := 0; ; position++ {
+		sent := false
+		for _, result := range results {
+			if position < len(result.Fragments) {
+				fragment := result.Fragments[len(result.Fragments)-1-position]
+				if err := demux.AddSerialized(SerializeFragment(fragment)); err != nil {
+					t.Fatalf("Adding fragment failed: %v", err)
+				}
+				sent = true
+			}
+		}
+		if !sent {
+			break
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if !bytes.Equal(completed[results[i].Fragments[0].ID], payloads[i]) {
+			t.Errorf("Payload %d not reconstructed", i)
+		}
+	}
+	if !tinyDone {
+		t.Error("Per-payload callback not called")
+	}
+	if _, ok := completed[results[2].Fragments[0].ID]; ok {
+		t.Error("Default callback called for payload with its own callback")
+	}
+	if len(demux.Pending()) != 0 {
+		t.Errorf("Expected no pending payloads, got %d", len(demux.Pending()))
+	}
+
+	// Payload limit and incomplete payloads
+	limited := NewDemultiplexer(&DemultiplexerOptions{MaxPayloads: 1})
+	if err := limited.Add(results[0].Fragments[0]); err != nil {
+		t.Fatalf("Adding fragment failed: %v", err)
+	}
+	if err := limited.Add(results[1].Fragments[0]); err != ErrTooManyPayloads {
+		t.Errorf("Expected ErrTooManyPayloads, got %v", err)
+	}
+	if !limited.Drop(results[0].Fragments[0].ID) {
+		t.Error("Expected pending payload to be dropped")
+	}
+	if err := limited.Add(results[1].Fragments[0]); err != nil {
+		t.Errorf("Adding fragment after drop failed: %v", err)
+	}
+
+	reconstructor := NewMemoryReconstructor(nil)
+	if _, err := reconstructor.Add(results[0].Fragments[1]); err != nil {
+		t.Fatalf("Adding fragment failed: %v", err)
+	}
+	if _, err := reconstructor.Result(); err != ErrReconstructionIncomplete {
+		t.Errorf("Expected ErrReconstructionIncomplete, got %v", err)
+	}
+	if missing := reconstructor.Missing(); len(missing) != len(results[0].Fragments)-1 || missing[0] != 0 {
+		t.Errorf("Unexpected missing indices %v", missing)
+	}
+	corrupted := results[0].Fragments[0]
+	corrupted.Data = append([]byte{0xFF}, corrupted.Data[1:]...)
+	if _, err := reconstructor.Add(corrupted); err != ErrReconstructionFailed {
+		t.Errorf("Expected ErrReconstructionFailed for corrupted fragment, got %v", err)
+	}
+
+	// A forged first fragment doesn't claim the payload
+	forged := results[0].Fragments[0]
+	forged.ID, forged.Total, forged.Checksum = ID{1}, 2, Hash{}
+	fresh := NewMemoryReconstructor(nil)
+	if _, err := fresh.Add(forged); err != ErrReconstructionFailed {
+		t.Errorf("Forged first fragment: got %v, want ErrReconstructionFailed", err)
+	}
+	if _, err := fresh.Add(results[0].Fragments[0]); err != nil || fresh.ID() != results[0].Fragments[0].ID {
+		t.Errorf("Genuine fragment after a forged one: %v", err)
+	}
+
+	// Nor do junk fragments use up the payload limit
+	guarded := NewDemultiplexer(&DemultiplexerOptions{MaxPayloads: 2})
+	for i := byte(0); i < 4; i++ {
+		junk := results[0].Fragments[0]
+		junk.ID, junk.Checksum = ID{i + 1}, Hash{i}
+		if err := guarded.Add(junk); err != ErrReconstructionFailed {
+			t.Errorf("Junk fragment: got %v, want ErrReconstructionFailed", err)
+		}
+	}
+	if err := guarded.Add(results[1].Fragments[0]); err != nil || len(guarded.Pending()) != 1 {
+		t.Errorf("Genuine payload after junk: %v with %d pending", err, len(guarded.Pending()))
+	}
+}
+
+// Test disk-backed reconstruction
+func TestFileReconstructor(t *testing.T) {
+	data := make([]byte, 5*FragmentSize+123)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	result, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("Fragmentation failed: %v", err)
+	}
+
+	path := t.TempDir() + "/payload.bin"
+	reconstructor, err := NewFileReconstructor(path, result.Metadata, nil)
+	if err != nil {
+		t.Fatalf("Creating file reconstructor failed: %v", err)
+	}
+	defer reconstructor.Close()
+
+	for i := len(result.Fragments) - 1; i >= 0; i-- {
+		complete, err := reconstructor.Add(result.Fragments[i])
+		if err != nil {
+			t.Fatalf("Adding fragment %d failed: %v", i, err)
+		}
+		if complete != (i == 0) {
+			t.Errorf("Fragment %d: unexpected completion %v", i, complete)
+		}
+	}
+
+	reconstructed, err := reconstructor.Result()
+	if err != nil {
+		t.Fatalf("Finalizing failed: %v", err)
+	}
+	if !reconstructed.IsComplete || reconstructed.Data != nil {
+		t.Error("Expected complete result without in-memory data")
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading reconstructed file failed: %v", err)
+	}
+	if !bytes.Equal(written, data) {
+		t.Error("Reconstructed file doesn't match original")
+	}
+
+	// A metadata checksum mismatch is caught when finalizing
+	tampered := result.Metadata
+	tampered.Checksum[0] ^= 0xFF
+	bad, err := NewFileReconstructor(t.TempDir()+"/tampered.bin", tampered, nil)
+	if err != nil {
+		t.Fatalf("Creating file reconstructor failed: %v", err)
+	}
+	defer bad.Close()
+	for _, fragment := range result.Fragments {
+		if _, err := bad.Add(fragment); err != nil {
+			t.Fatalf("Adding fragment failed: %v", err)
+		}
+	}
+	if _, err := bad.Result(); err != ErrReconstructionFailed {
+		t.Errorf("Expected ErrReconstructionFailed, got %v", err)
+	}
+
+	// Fragments not matching the metadata layout are rejected
+	wrongCount := result.Metadata
+	wrongCount.FragmentCount++
+	if _, err := NewFileReconstructor(t.TempDir()+"/wrong.bin", wrongCount, nil); err != ErrInvalidFragmentCount {
+		t.Errorf("Expected ErrInvalidFragmentCount, got %v", err)
+	}
+}
+
+// Test writing and verifying Z512SUMS checksum files
+func TestChecksumFile(t *testing.T) {
+	root := t.TempDir()
+	names := []string{"release.tar.gz", "odd\\name\nwith newline"}
+	entries := make([]ChecksumEntry, len(names))
+	for i, name := range names {
+		if err := os.WriteFile(root+"/"+name, []byte("contents of "+name), 0o644); err != nil {
+			t.Fatalf("Writing file failed: %v", err)
+		}
+		entry, err := ChecksumFileEntry(root, name)
+		if err != nil {
+			t.Fatalf("Hashing %q failed: %v", name, err)
+		}
+		entries[i] = entry
+	}
+	entries[1].Binary = true
+
+	var sums bytes.Buffer
+	if err := WriteChecksumFile(&sums, entries); err != nil {
+		t.Fatalf("Writing checksum file failed: %v", err)
+	}
+	if !strings.HasPrefix(sums.String(), entries[0].Hash.String()+"  release.tar.gz\n\\") {
+		t.Errorf("Unexpected checksum file layout:\n%s", sums.String())
+	}
+
+	parsed, err := ReadChecksumFile(bytes.NewReader(sums.Bytes()))
+	if err != nil {
+		t.Fatalf("Reading checksum file failed: %v", err)
+	}
+	if len(parsed) != 2 || parsed[1].Path != names[1] || !parsed[1].Binary || parsed[0].Hash != entries[0].Hash {
+		t.Errorf("Parsed entries don't round-trip: %+v", parsed)
+	}
+
+	results, err := VerifyChecksumFile(bytes.NewReader(sums.Bytes()), root)
+	if err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("%q failed: %v", result.Path, result.Err)
+		}
+	}
+
+	if err := os.WriteFile(root+"/release.tar.gz", []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("Writing file failed: %v", err)
+	}
+	results, err = VerifyChecksumFile(bytes.NewReader(sums.Bytes()), root)
+	if err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if len(results) != 2 || results[0].Err != ErrChecksumMismatch || results[1].Err != nil {
+		t.Errorf("Unexpected results %+v", results)
+	}
+
+	if _, err := ReadChecksumFile(strings.NewReader("nothex  file\n")); !errors.Is(err, ErrInvalidChecksumFile) {
+		t.Errorf("Expected ErrInvalidChecksumFile, got %v", err)
+	}
+}
+
+// Test streaming decapsulation against a key store
+func TestDecapsulationService(t *testing.T) {
+	store := NewMemoryKeyStore()
+	keyPairs := make([]KEMKeyPair, 3)
+	keyIDs := make([]Hash, len(keyPairs))
+	for i := range keyPairs {
+		publicKey, secretKey, err := KEMKeyGen()
+		if err != nil {
+			t.Fatalf("Key generation failed: %v", err)
+		}
+		keyPairs[i] = KEMKeyPair{Public: publicKey, Secret: secretKey}
+		keyIDs[i] = store.Add(keyPairs[i])
+	}
+
+	service := NewDecapsulationService(store, &DecapsulationOptions{Workers: 4, BatchSize: 8})
+
+	const requests = 50
+	expected := make(map[uint64]SharedSecret)
+	go func() {
+		defer service.Close()
+		for tag := uint64(0); tag < requests; tag++ {
+			keyIndex := int(tag) % len(keyPairs)
+			ciphertext, sharedSecret, err := KEMEncapsulate(keyPairs[keyIndex].Public)
+			if err != nil {
+				t.Errorf("Encapsulation failed: %v", err)
+				return
+			}
+			request := DecapsulationRequest{KeyID: keyIDs[keyIndex], Ciphertext: ciphertext, Tag: tag}
+			if tag == requests-1 {
+				request.KeyID = Hash{}
+			} else {
+				expected[tag] = sharedSecret
+			}
+			if err := service.Submit(context.Background(), request); err != nil {
+				t.Errorf("Submit failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	received := make(map[uint64]DecapsulationResult)
+	for result := range service.Results() {
+		received[result.Request.Tag] = result
+	}
+
+	if len(received) != requests {
+		t.Fatalf("Expected %d results, got %d", requests, len(received))
+	}
+	for tag, sharedSecret := range expected {
+		if received[tag].Err != nil || received[tag].SharedSecret != sharedSecret {
+			t.Errorf("Request %d: wrong shared secret or error %v", tag, received[tag].Err)
+		}
+	}
+	if err := received[requests-1].Err; err != ErrUnknownKey {
+		t.Errorf("Expected ErrUnknownKey for unknown key ID, got %v", err)
+	}
+
+	if err := service.Submit(context.Background(), DecapsulationRequest{}); err != ErrServiceClosed {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+}
+
+// Test threshold key escrow with an audit trail
+func TestEscrow(t *testing.T) {
+	trusteeKeys := make([]KEMKeyPair, 5)
+	trustees := make([]KEMPublicKey, len(trusteeKeys))
+	for i := range trusteeKeys {
+		publicKey, secretKey, err := KEMKeyGen()
+		if err != nil {
+			t.Fatalf("Key generation failed: %v", err)
+		}
+		trusteeKeys[i] = KEMKeyPair{Public: publicKey, Secret: secretKey}
+		trustees[i] = publicKey
+	}
+
+	secret := []byte("master wallet seed material")
+	escrow, err := CreateEscrow(secret, trustees, 3)
+	if err != nil {
+		t.Fatalf("Creating escrow failed: %v", err)
+	}
+	if escrow.Threshold() != 3 || len(escrow.Trustees()) != 5 {
+		t.Errorf("Unexpected threshold %d or trustee count %d", escrow.Threshold(), len(escrow.Trustees()))
+	}
+
+	// The escrow is stored and later loaded for recovery
+	data, err := json.Marshal(escrow)
+	if err != nil {
+		t.Fatalf("Marshaling escrow failed: %v", err)
+	}
+	var loaded Escrow
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("Unmarshaling escrow failed: %v", err)
+	}
+
+	var shares []SecretShare
+	for _, i := range []int{4, 1, 2} {
+		share, err := loaded.ReleaseShare(trusteeKeys[i].Secret)
+		if err != nil {
+			t.Fatalf("Trustee %d failed to release share: %v", i, err)
+		}
+		shares = append(shares, share)
+	}
+
+	if _, err := loaded.Recover(shares[:2]); err != ErrInvalidThreshold {
+		t.Errorf("Expected ErrInvalidThreshold below threshold, got %v", err)
+	}
+	recovered, err := loaded.Recover(shares)
+	if err != nil {
+		t.Fatalf("Recovery failed: %v", err)
+	}
+	if !bytes.Equal(recovered, secret) {
+		t.Error("Recovered secret doesn't match")
+	}
+
+	// created, three releases and one recovery
+	if len(loaded.Events) != 5 || loaded.Events[4].Type != EscrowEventRecovered || len(loaded.Events[4].Trustees) != 3 {
+		t.Errorf("Unexpected audit trail %+v", loaded.Events)
+	}
+	if err := loaded.VerifyAuditTrail(); err != nil {
+		t.Errorf("Audit trail verification failed: %v", err)
+	}
+
+	// Dropping a release from the trail is detected
+	loaded.Events = append(loaded.Events[:2], loaded.Events[3:]...)
+	if err := loaded.VerifyAuditTrail(); err != ErrInvalidAuditTrail {
+		t.Errorf("Expected ErrInvalidAuditTrail, got %v", err)
+	}
+	if _, err := loaded.Recover(shares); err != ErrInvalidAuditTrail {
+		t.Errorf("Expected recovery to refuse a tampered trail, got %v", err)
+	}
+
+	// Altered shares are rejected
+	forged := shares[0]
+	forged.Value = append([]byte(nil), forged.Value...)
+	forged.Value[0] ^= 1
+	if _, err := escrow.Recover([]SecretShare{forged, shares[1], shares[2]}); err != ErrInvalidShare {
+		t.Errorf("Expected ErrInvalidShare, got %v", err)
+	}
+}
+
+// Test remote attestation challenge and response
+func TestRemoteAttestation(t *testing.T) {
+	key, public, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	defer SecureErasePrivateKey(&key)
+
+	binaryPath := t.TempDir() + "/node"
+	nodeBinary := bytes.Repeat([]byte("\x7fELF node binary "), 500)
+	if err := os.WriteFile(binaryPath, nodeBinary, 0o755); err != nil {
+		t.Fatalf("Writing binary failed: %v", err)
+	}
+
+	verifier := NewAttestationVerifier([]PublicKey{public}, 0)
+	challenge, err := verifier.Challenge()
+	if err != nil {
+		t.Fatalf("Issuing challenge failed: %v", err)
+	}
+	response, err := RespondToChallenge(challenge, binaryPath, key)
+	if err != nil {
+		t.Fatalf("Responding failed: %v", err)
+	}
+
+	signer, err := verifier.Verify(response, bytes.NewReader(nodeBinary))
+	if err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	if signer != public {
+		t.Error("Wrong signer returned")
+	}
+
+	// Replaying the response fails
+	if _, err := verifier.Verify(response, bytes.NewReader(nodeBinary)); err != ErrUnknownChallenge {
+		t.Errorf("Expected ErrUnknownChallenge on replay, got %v", err)
+	}
+
+	// A node running a different binary fails
+	challenge, _ = verifier.Challenge()
+	response, err = RespondToChallenge(challenge, binaryPath, key)
+	if err != nil {
+		t.Fatalf("Responding failed: %v", err)
+	}
+	if _, err := verifier.Verify(response, bytes.NewReader(append(nodeBinary, 0))); err != ErrFileModified {
+		t.Errorf("Expected ErrFileModified for a different binary, got %v", err)
+	}
+
+	// Expired challenges are rejected
+	expiring := NewAttestationVerifier([]PublicKey{public}, time.Nanosecond)
+	challenge, _ = expiring.Challenge()
+	response, err = RespondToChallenge(challenge, binaryPath, key)
+	if err != nil {
+		t.Fatalf("Responding failed: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := expiring.Verify(response, bytes.NewReader(nodeBinary)); err != ErrChallengeExpired && err != ErrUnknownChallenge {
+		t.Errorf("Expected expired challenge to fail, got %v", err)
+	}
+	if expiring.Outstanding() != 0 {
+		t.Error("Expected no outstanding challenges")
+	}
+
+	// The nonce is hashed before the binary
+	measurement, err := AttestationMeasurement(bytes.NewReader(nodeBinary), challenge.Nonce)
+	if err != nil {
+		t.Fatalf("Measuring failed: %v", err)
+	}
+	if measurement != ComputeHash(append(challenge.Nonce[:], nodeBinary...)) {
+		t.Error("Measurement doesn't hash the nonce first")
+	}
+}
+
+// Test hash sets and maps with canonical ordering
+func TestHashSetAndMap(t *testing.T) {
+	a, b, c := ComputeHash([]byte("a")), ComputeHash([]byte("b")), ComputeHash([]byte("c"))
+
+	var left HashSet
+	left.Add(c)
+	left.Add(a)
+	if left.Add(a) {
+		t.Error("Adding a duplicate should report false")
+	}
+	right := NewHashSet(b, c)
+
+	sorted := left.Union(right).Sorted()
+	if len(sorted) != 3 {
+		t.Fatalf("Expected union of 3, got %d", len(sorted))
+	}
+	for i := 1; i < len(sorted); i++ {
+		if CompareHash(sorted[i-1], sorted[i]) >= 0 {
+			t.Error("Union not in canonical order")
+		}
+	}
+	if inter := left.Intersection(right); inter.Len() != 1 || !inter.Contains(c) {
+		t.Error("Intersection should hold only c")
+	}
+	if diff := left.Difference(right); diff.Len() != 1 || !diff.Contains(a) {
+		t.Error("Difference should hold only a")
+	}
+	if left.Digest() != NewHashSet(a, c).Digest() {
+		t.Error("Digest depends on insertion order")
+	}
+
+	encoded, err := left.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Binary encoding failed: %v", err)
+	}
+	var decoded HashSet
+	if err := decoded.UnmarshalBinary(encoded); err != nil || !decoded.Equal(&left) {
+		t.Errorf("Binary round trip failed: %v", err)
+	}
+	swapped := append(append([]byte(nil), encoded[HashSize:]...), encoded[:HashSize]...)
+	if err := decoded.UnmarshalBinary(swapped); err != ErrNonCanonicalEncoding {
+		t.Errorf("Expected ErrNonCanonicalEncoding for unsorted input, got %v", err)
+	}
+
+	jsonData, err := json.Marshal(right)
+	if err != nil {
+		t.Fatalf("JSON encoding failed: %v", err)
+	}
+	var fromJSON HashSet
+	if err := json.Unmarshal(jsonData, &fromJSON); err != nil || !fromJSON.Equal(right) {
+		t.Errorf("JSON round trip failed: %v", err)
+	}
+
+	balances := NewHashMap[uint64]()
+	balances.Set(c, 3)
+	balances.Set(a, 1)
+	balances.Set(b, 2)
+	balances.Delete(b)
+
+	var keys []Hash
+	balances.Range(func(key Hash, value uint64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 2 || CompareHash(keys[0], keys[1]) >= 0 {
+		t.Error("Map not iterated in canonical order")
+	}
+	if value, ok := balances.Get(c); !ok || value != 3 {
+		t.Errorf("Expected 3 under c, got %d", value)
+	}
+
+	first, _ := json.Marshal(balances)
+	var restored HashMap[uint64]
+	if err := json.Unmarshal(first, &restored); err != nil {
+		t.Fatalf("Map JSON decoding failed: %v", err)
+	}
+	second, _ := json.Marshal(&restored)
+	if !bytes.Equal(first, second) {
+		t.Error("Map JSON encoding isn't canonical")
+	}
+	if !restored.KeySet().Equal(NewHashSet(a, c)) {
+		t.Error("Restored map has wrong keys")
+	}
+}
+
+// Test the Merkle accumulator with witness updates
+func TestAccumulator(t *testing.T) {
+	acc := NewAccumulator()
+	emptyRoot := acc.Root()
+
+	for i := 0; i < 20; i++ {
+		if _, added := acc.Add([]byte{byte(i)}); !added {
+			t.Fatalf("Element %d not added", i)
+		}
+	}
+	if _, added := acc.Add([]byte{3}); added {
+		t.Error("Duplicate element added")
+	}
+	if acc.Len() != 20 {
+		t.Errorf("Expected 20 members, got %d", acc.Len())
+	}
+
+	root := acc.Root()
+	witness := acc.Prove([]byte{7})
+	if !VerifyMembership(root, []byte{7}, &witness) {
+		t.Fatal("Membership witness doesn't verify")
+	}
+	if VerifyMembership(root, []byte{8}, &witness) {
+		t.Error("Witness verified for a different element")
+	}
+	if len(witness.Proof.Siblings) > 16 {
+		t.Errorf("Expected a compact proof, got %d siblings", len(witness.Proof.Siblings))
+	}
+
+	absent := acc.Prove([]byte("absent"))
+	if absent.Member || !absent.Verify(root) {
+		t.Error("Non-membership witness doesn't verify")
+	}
+
+	// The witness follows additions and removals without the full set
+	for _, change := range []struct {
+		element []byte
+		add     bool
+	}{{[]byte("new"), true}, {[]byte{2}, false}, {[]byte{7}, false}, {[]byte{7}, true}} {
+		var update AccumulatorUpdate
+		if change.add {
+			update, _ = acc.Add(change.element)
+		} else {
+			update, _ = acc.Remove(change.element)
+		}
+		newRoot, err := witness.Update(update)
+		if err != nil {
+			t.Fatalf("Witness update failed: %v", err)
+		}
+		if newRoot != acc.Root() {
+			t.Fatal("Updated witness computes a different root")
+		}
+		if !witness.Verify(acc.Root()) {
+			t.Fatal("Updated witness doesn't verify")
+		}
+	}
+	if !VerifyMembership(acc.Root(), []byte{7}, &witness) {
+		t.Error("Re-added element not proven a member")
+	}
+	if witness.Verify(root) {
+		t.Error("Updated witness still verifies against the old root")
+	}
+
+	proof, err := AccumulatorProofFromBytes(witness.Proof.Bytes())
+	if err != nil {
+		t.Fatalf("Proof round trip failed: %v", err)
+	}
+	if len(proof.Siblings) != len(witness.Proof.Siblings) {
+		t.Error("Proof round trip changed sibling count")
+	}
+	if _, err := AccumulatorProofFromBytes(witness.Proof.Bytes()[:40]); err != ErrInvalidProof {
+		t.Errorf("Expected ErrInvalidProof, got %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		acc.Remove([]byte{byte(i)})
+	}
+	acc.Remove([]byte("new"))
+	if acc.Root() != emptyRoot || acc.Len() != 0 {
+		t.Error("Removing every element should restore the empty root")
+	}
+}
+
+// Test verifiable encryption of shares to auditors
+func TestVerifiableShares(t *testing.T) {
+	auditorKeys := make([]KEMKeyPair, 4)
+	auditors := make([]KEMPublicKey, len(auditorKeys))
+	for i := range auditorKeys {
+		publicKey, secretKey, err := KEMKeyGen()
+		if err != nil {
+			t.Fatalf("Key generation failed: %v", err)
+		}
+		auditorKeys[i] = KEMKeyPair{Public: publicKey, Secret: secretKey}
+		auditors[i] = publicKey
+	}
+
+	secret := []byte("custody signing key")
+	commitments, shares, err := VerifiableSplit(secret, auditors, 3)
+	if err != nil {
+		t.Fatalf("Verifiable split failed: %v", err)
+	}
+
+	var opened []SecretShare
+	for i := range shares {
+		if err := commitments.VerifyShare(&shares[i]); err != nil {
+			t.Fatalf("Public check of share %d failed: %v", i, err)
+		}
+		share, err := shares[i].Open(auditorKeys[i].Secret, commitments)
+		if err != nil {
+			t.Fatalf("Auditor %d failed to open share: %v", i, err)
+		}
+		opened = append(opened, share)
+	}
+
+	recovered, err := CombineVerifiedShares(commitments, opened[1:])
+	if err != nil {
+		t.Fatalf("Combining shares failed: %v", err)
+	}
+	if !bytes.Equal(recovered, secret) {
+		t.Error("Recovered secret doesn't match")
+	}
+
+	// Another auditor can't open the share
+	if _, err := shares[0].Open(auditorKeys[1].Secret, commitments); err == nil {
+		t.Error("Expected wrong auditor to fail")
+	}
+
+	// Altered commitments are detected publicly
+	altered := *commitments
+	altered.Commitments = append([]Hash(nil), commitments.Commitments...)
+	altered.Commitments[2][0] ^= 1
+	if err := altered.VerifyShare(&shares[2]); err != ErrInvalidProof {
+		t.Errorf("Expected ErrInvalidProof for altered chain, got %v", err)
+	}
+
+	// Encrypted shares are checked against their transcripts
+	tampered := shares[2]
+	tampered.Sealed = append([]byte(nil), tampered.Sealed...)
+	tampered.Sealed[0] ^= 1
+	if err := commitments.VerifyShare(&tampered); err != ErrInvalidShare {
+		t.Errorf("Expected ErrInvalidShare for a share off its transcript, got %v", err)
+	}
+
+	// A cheating dealer publishes transcripts for its bad shares
+	cheating := *commitments
+	cheating.Transcripts = append([]Hash(nil), commitments.Transcripts...)
+	publish := func(share *VerifiableShare) {
+		cheating.Transcripts[share.Index-1] = verifiableTranscript(share)
+		cheating.Head = cheating.chainHead()
+	}
+
+	// A share that doesn't match its commitment is caught
+	cheat := shares[1]
+	sharedSecret, err := KEMDecapsulate(auditorKeys[1].Secret, cheat.Ciphertext)
+	if err != nil {
+		t.Fatalf("Decapsulation failed: %v", err)
+	}
+	key := kemWrapKey(verifiableShareDomain, sharedSecret, cheat.SetID)
+	bogus := make([]byte, verifiableBlindingSize+len(secret))
+	cheat.Sealed, err = sealAESGCM(key, recoveryNonce(cheat.Index), bogus, commitments.shareAAD(cheat.Index))
+	if err != nil {
+		t.Fatalf("Sealing failed: %v", err)
+	}
+	publish(&cheat)
+
+	// So are a wrong key commitment and a ciphertext to another auditor
+	wrongKey := shares[2]
+	wrongKey.KeyCommitment[0] ^= 1
+	publish(&wrongKey)
+	misdirected := shares[3]
+	misdirected.Ciphertext = shares[0].Ciphertext
+	publish(&misdirected)
+
+	for i, bad := range []*VerifiableShare{&cheat, &wrongKey, &misdirected} {
+		auditorSecret := auditorKeys[bad.Index-1].Secret
+		if _, err := bad.Open(auditorSecret, &cheating); err == nil {
+			t.Errorf("Bad share %d opened", i)
+		}
+		complaint, err := bad.Complain(auditorSecret, &cheating)
+		if err != nil {
+			t.Fatalf("Complaint %d failed: %v", i, err)
+		}
+		if !VerifyComplaint(&cheating, complaint) {
+			t.Errorf("Valid complaint %d not accepted", i)
+		}
+		if VerifyComplaint(commitments, complaint) {
+			t.Errorf("Complaint %d accepted against the honest transcript", i)
+		}
+	}
+
+	// Complaints against honest shares are rejected
+	honest, err := shares[0].Complain(auditorKeys[0].Secret, commitments)
+	if err != nil {
+		t.Fatalf("Complaint failed: %v", err)
+	}
+	if VerifyComplaint(commitments, honest) {
+		t.Error("Complaint against an honest share accepted")
+	}
+	honest.Message[0] ^= 1
+	if VerifyComplaint(commitments, honest) {
+		t.Error("Complaint with a substituted message accepted")
+	}
+	honest.Message[0] ^= 1
+	honest.Auditor = auditors[1]
+	if VerifyComplaint(commitments, honest) {
+		t.Error("Complaint naming another auditor accepted")
+	}
+	if _, err := shares[0].Complain(auditorKeys[1].Secret, commitments); err != ErrWrongRecipient {
+		t.Errorf("Expected ErrWrongRecipient for another auditor's complaint, got %v", err)
+	}
+
+	// The secret commitment is blinded
+	if HashEqual(commitments.SecretCommitment, verifiableSecretCommitment(commitments.SetID, secret)) {
+		t.Error("Secret commitment isn't blinded")
+	}
+}
+
+// Test the signed, hash-chained KEM audit log
+func TestKEMAuditLog(t *testing.T) {
+	auditLog := NewKEMAuditLog()
+	restore := SetKEMAuditRecorder(auditLog)
+
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	ciphertext, _, err := KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	if _, err := KEMDecapsulate(secretKey, ciphertext); err != nil {
+		t.Fatalf("Decapsulation failed: %v", err)
+	}
+	restore()
+
+	// Operations after removing the recorder aren't logged
+	if _, _, err := KEMKeyGen(); err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+
+	entries := auditLog.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	fingerprint := KEMKeyID(publicKey)
+	for i, op := range []KEMOperation{KEMOpKeyGen, KEMOpEncapsulate, KEMOpDecapsulate} {
+		if entries[i].Event.Operation != op || entries[i].Event.KeyFingerprint != fingerprint || !entries[i].Event.Success {
+			t.Errorf("Entry %d: unexpected event %+v", i, entries[i].Event)
+		}
+	}
+	if entries[2].Event.CiphertextHash != ComputeHash(ciphertext[:]) {
+		t.Error("Decapsulation entry has wrong ciphertext hash")
+	}
+
+	key, err := GenerateXMSSKey(XMSSParams{Height: 2, WOTS: DefaultWOTSParams()}, nil)
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	defer key.Wipe()
+	checkpoint, err := auditLog.Checkpoint(key)
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+
+	var transcript bytes.Buffer
+	if err := auditLog.Export(&transcript); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if bytes.Contains(transcript.Bytes(), []byte(FastHexEncode(secretKey[:8]))) {
+		t.Error("Transcript contains secret key material")
+	}
+	exported, err := ReadKEMAuditLog(&transcript)
+	if err != nil {
+		t.Fatalf("Reading transcript failed: %v", err)
+	}
+
+	trusted := []XMSSPublicKey{key.Public()}
+	if err := VerifyKEMAuditLog(exported, checkpoint, trusted); err != nil {
+		t.Fatalf("Audit log verification failed: %v", err)
+	}
+
+	// Removing an entry breaks the chain
+	if err := VerifyKEMAuditLog(append(exported[:1:1], exported[2:]...), checkpoint, trusted); err != ErrInvalidAuditTrail {
+		t.Errorf("Expected ErrInvalidAuditTrail for removed entry, got %v", err)
+	}
+	// Rewriting the whole chain doesn't match the signed head
+	exported[1].Event.Success = false
+	exported[1].Hash = kemAuditEntryHash(exported[0].Hash, exported[1])
+	exported[2].Hash = kemAuditEntryHash(exported[1].Hash, exported[2])
+	if err := VerifyKEMAuditLog(exported, checkpoint, trusted); err != ErrInvalidAuditTrail {
+		t.Errorf("Expected ErrInvalidAuditTrail for rewritten chain, got %v", err)
+	}
+}
+
+// Test the placeholder KEM guard
+func TestPlaceholderGuard(t *testing.T) {
+	var warnings []string
+	restoreWarning := SetPlaceholderWarning(func(primitive string) { warnings = append(warnings, primitive) })
+	defer restoreWarning()
+
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	result, err := Encapsulate(&publicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	if _, err := Decapsulate(result.Ciphertext, &privateKey); err != nil {
+		t.Fatalf("Decapsulation failed: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != PlaceholderKEM {
+		t.Errorf("Expected one warning for the placeholder KEM, got %v", warnings)
+	}
+
+	kemPublic, kemSecret, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEM key generation failed: %v", err)
+	}
+
+	restoreStrict := SetStrictMode(true)
+	if !StrictMode() {
+		t.Error("Strict mode not enabled")
+	}
+	if _, err := Encapsulate(&publicKey); err != ErrInsecurePlaceholder {
+		t.Errorf("Expected ErrInsecurePlaceholder from encapsulation, got %v", err)
+	}
+	if _, err := Decapsulate(result.Ciphertext, &privateKey); err != ErrInsecurePlaceholder {
+		t.Errorf("Expected ErrInsecurePlaceholder from decapsulation, got %v", err)
+	}
+
+	// The lattice KEM isn't a placeholder and runs in strict mode
+	ciphertext, sharedSecret, err := KEMEncapsulate(kemPublic)
+	if err != nil {
+		t.Fatalf("KEM encapsulation failed in strict mode: %v", err)
+	}
+	if decapsulated, err := KEMDecapsulate(kemSecret, ciphertext); err != nil || decapsulated != sharedSecret {
+		t.Errorf("KEM decapsulation failed in strict mode: %v", err)
+	}
+	restoreStrict()
+
+	if _, err := Encapsulate(&publicKey); err != nil {
+		t.Errorf("Encapsulation failed after leaving strict mode: %v", err)
+	}
+}
+
+// Test that ciphertexts are bound to their recipient's public key
+func TestCiphertextRecipientBinding(t *testing.T) {
+	alicePublic, aliceSecret, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	bobPublic, bobSecret, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+
+	ciphertext, sharedSecret, err := KEMEncapsulate(alicePublic)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	if !CiphertextMatchesRecipient(ciphertext, alicePublic) || CiphertextMatchesRecipient(ciphertext, bobPublic) {
+		t.Error("Ciphertext not matched to its recipient only")
+	}
+
+	if _, err := KEMDecapsulate(bobSecret, ciphertext); err != ErrWrongRecipient {
+		t.Errorf("Expected ErrWrongRecipient, got %v", err)
+	}
+	decapsulated, err := KEMDecapsulate(aliceSecret, ciphertext)
+	if err != nil || decapsulated != sharedSecret {
+		t.Errorf("Decapsulation by the recipient failed: %v", err)
+	}
+
+	contextCiphertext, _, err := KEMWithContext(alicePublic, []byte("ctx"))
+	if err != nil {
+		t.Fatalf("Context encapsulation failed: %v", err)
+	}
+	if _, err := KEMDecapsulateWithContext(bobSecret, contextCiphertext, []byte("ctx")); err != ErrWrongRecipient {
+		t.Errorf("Expected ErrWrongRecipient with context, got %v", err)
+	}
+}
+
+// Test that the secure erase functions are nil-safe and cover every field
+func TestSecureEraseNilSafe(t *testing.T) {
+	SecureErasePrivateKey(nil)
+	SecureErasePublicKey(nil)
+	SecureEraseKeyPair(nil)
+	SecureEraseKeyPair(&KeyPair{})
+	SecureEraseKEMSecretKey(nil)
+	SecureEraseKEMPublicKey(nil)
+	SecureEraseSharedSecret(nil)
+	SecureEraseKEMKeyPair(nil)
+	SecureEraseKEMResult(nil)
+	SecureEraseKEMDecryptResult(nil)
+	(*FragmentKey)(nil).Wipe()
+	(*LazyHashChain)(nil).Wipe()
+	(*RecoveryCeremony)(nil).Wipe()
+	(*WOTSPrivateKey)(nil).Wipe()
+	(*XMSSPrivateKey)(nil).Wipe()
+
+	privateKey := PrivateKey{1, 2, 3}
+	publicKey := PublicKey{4, 5, 6}
+	keyPair := KeyPair{PrivateKey: &privateKey, PublicKey: &publicKey, KeyID: []byte{7, 8}}
+	SecureEraseKeyPair(&keyPair)
+	if privateKey != (PrivateKey{}) || publicKey != (PublicKey{}) {
+		t.Error("Key pair keys not erased")
+	}
+	if !bytes.Equal(keyPair.KeyID, []byte{0, 0}) {
+		t.Error("Key pair ID not erased")
+	}
+
+	kemPublicKey := KEMPublicKey{9}
+	SecureEraseKEMPublicKey(&kemPublicKey)
+	if kemPublicKey != (KEMPublicKey{}) {
+		t.Error("KEM public key not erased")
+	}
+
+	result := KEMResult{Ciphertext: []byte{1, 2}, SharedSecret: []byte{3, 4}}
+	SecureEraseKEMResult(&result)
+	if !bytes.Equal(result.Ciphertext, []byte{0, 0}) || !bytes.Equal(result.SharedSecret, []byte{0, 0}) {
+		t.Error("KEM result not erased")
+	}
+}
+
+// Test byte accessors and their ownership semantics
+func TestByteAccessors(t *testing.T) {
+	hash := ComputeHash([]byte("ownership"))
+
+	view := hash.Bytes()
+	view[0] ^= 0xff
+	if view[0] == hash[0] {
+		t.Error("Bytes aliased the receiver")
+	}
+
+	prefix := []byte("prefix")
+	appended := hash.AppendBytes(prefix)
+	if !bytes.Equal(appended[:len(prefix)], prefix) || !bytes.Equal(appended[len(prefix):], hash[:]) {
+		t.Error("AppendBytes produced wrong output")
+	}
+	appended[len(prefix)] ^= 0xff
+	if appended[len(prefix)] == hash[0] {
+		t.Error("AppendBytes aliased the receiver")
+	}
+
+	buffer := make([]byte, HashSize+1)
+	n, err := hash.CopyTo(buffer)
+	if err != nil || n != HashSize || !bytes.Equal(buffer[:n], hash[:]) {
+		t.Errorf("CopyTo failed: n=%d err=%v", n, err)
+	}
+
+	short := make([]byte, HashSize-1)
+	if n, err := hash.CopyTo(short); err != io.ErrShortBuffer || n != 0 {
+		t.Errorf("Expected io.ErrShortBuffer, got n=%d err=%v", n, err)
+	}
+	if !bytes.Equal(short, make([]byte, HashSize-1)) {
+		t.Error("CopyTo wrote into a short buffer")
+	}
+
+	var secret SharedSecret
+	secret[0] = 1
+	out := make([]byte, SharedSecretSize)
+	if _, err := secret.CopyTo(out); err != nil || out[0] != 1 {
+		t.Errorf("SharedSecret CopyTo failed: %v", err)
+	}
+	var id ID
+	if got := id.AppendBytes(nil); len(got) != IDSize {
+		t.Errorf("ID AppendBytes length %d", len(got))
+	}
+	var nonce Nonce
+	if _, err := nonce.CopyTo(make([]byte, NonceSize)); err != nil {
+		t.Errorf("Nonce CopyTo failed: %v", err)
+	}
+	var hybridPublic HybridPublicKey
+	if got := hybridPublic.AppendBytes([]byte{9}); len(got) != 1+HybridPublicKeySize || got[0] != 9 {
+		t.Errorf("HybridPublicKey AppendBytes length %d", len(got))
+	}
+	var hybridCiphertext HybridCiphertext
+	if _, err := hybridCiphertext.CopyTo(make([]byte, HybridCiphertextSize-1)); err != io.ErrShortBuffer {
+		t.Errorf("HybridCiphertext CopyTo into a short buffer: %v", err)
+	}
+	var hybridSignaturePublic HybridSignaturePublicKey
+	if n, err := hybridSignaturePublic.CopyTo(make([]byte, HybridSignaturePublicKeySize)); err != nil || n != HybridSignaturePublicKeySize {
+		t.Errorf("HybridSignaturePublicKey CopyTo failed: %v", err)
+	}
+	var hybridSignature HybridSignature
+	if got := hybridSignature.AppendBytes(nil); len(got) != HybridSignatureSize {
+		t.Errorf("HybridSignature AppendBytes length %d", len(got))
+	}
+}
+
+// Test constant-time hex decoding of secrets
+func TestSecretFromHex(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, encoded := range []string{FastHexEncode(all), strings.ToUpper(FastHexEncode(all))} {
+		decoded, err := SecretFromHex(encoded)
+		if err != nil || !bytes.Equal(decoded, all) {
+			t.Fatalf("SecretFromHex round trip failed: %v", err)
+		}
+	}
+
+	for c := 0; c < 256; c++ {
+		_, want := FastHexDecode(string([]byte{byte(c), '0'}))
+		_, got := SecretFromHex(string([]byte{byte(c), '0'}))
+		if (want == nil) != (got == nil) {
+			t.Errorf("Digit %q: got error %v, want %v", c, got, want)
+		}
+	}
+
+	for _, bad := range []string{"0", "0g", "zz00"} {
+		if _, err := SecretFromHex(bad); err != ErrInvalidHexEncoding {
+			t.Errorf("SecretFromHex(%q): expected ErrInvalidHexEncoding, got %v", bad, err)
+		}
+	}
+
+	privateKey, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	parsed, err := PrivateKeyFromHex(privateKey.String())
+	if err != nil || parsed != privateKey {
+		t.Errorf("PrivateKeyFromHex round trip failed: %v", err)
+	}
+	if _, err := KEMSecretKeyFromHex("00"); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize, got %v", err)
+	}
+}
+
+// Test stateless signatures made with key pairs
+func TestSignVerify(t *testing.T) {
+	if sigWOTSParams.Len() != sigWOTSLen {
+		t.Fatalf("WOTS chain count %d doesn't match sigWOTSLen %d", sigWOTSParams.Len(), sigWOTSLen)
+	}
+
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	message := []byte("transfer 10 TPY to alice")
+
+	signature, err := Sign(privateKey, message)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !Verify(publicKey, message, signature) {
+		t.Fatal("Valid signature rejected")
+	}
+	if Verify(publicKey, []byte("transfer 99 TPY to alice"), signature) {
+		t.Error("Signature verified for a different message")
+	}
+
+	tampered := signature
+	tampered[SignatureSize/2] ^= 1
+	if Verify(publicKey, message, tampered) {
+		t.Error("Tampered signature verified")
+	}
+
+	_, otherPublic, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	if Verify(otherPublic, message, signature) {
+		t.Error("Signature verified under another key")
+	}
+
+	parsed, err := SignatureFromHex(signature.String())
+	if err != nil || parsed != signature {
+		t.Errorf("Signature hex round trip failed: %v", err)
+	}
+	if _, err := SignatureFromBytes(signature[:10]); err != ErrInvalidSignatureSize {
+		t.Errorf("Expected ErrInvalidSignatureSize, got %v", err)
+	}
+	if _, err := Sign(PrivateKey{}, message); err != ErrKeyDestroyed {
+		t.Errorf("Expected ErrKeyDestroyed, got %v", err)
+	}
+
+	// Key pairs from GenerateKeyPairAdvanced sign too
+	keyPair, err := GenerateKeyPairAdvanced()
+	if err != nil {
+		t.Fatalf("Advanced key generation failed: %v", err)
+	}
+	if !VerifyKeyPair(*keyPair.PrivateKey, *keyPair.PublicKey) {
+		t.Error("Advanced key pair doesn't match DerivePublicKey")
+	}
+
+	messages := [][]byte{message, []byte("second")}
+	signatures, err := BatchSign(privateKey, messages)
+	if err != nil {
+		t.Fatalf("BatchSign failed: %v", err)
+	}
+	if signatures[0] != signature {
+		t.Error("Signatures are not deterministic")
+	}
+	signatures[1][0] ^= 1
+	valid, err := BatchVerify([]PublicKey{publicKey, publicKey}, messages, signatures)
+	if err != nil {
+		t.Fatalf("BatchVerify failed: %v", err)
+	}
+	if !valid[0] || valid[1] {
+		t.Errorf("Unexpected batch verification result %v", valid)
+	}
+	if _, err := BatchVerify([]PublicKey{publicKey}, messages, signatures); err != ErrInvalidFragmentCount {
+		t.Errorf("Expected ErrInvalidFragmentCount, got %v", err)
+	}
+}
+
+// Test versioned seed derivation and migration
+func TestSeedVersions(t *testing.T) {
+	seed := []byte("this is a test seed that is long enough")
+
+	// Legacy derivation repeats SHA-256(seed || domain) across the key
+	legacy, err := DerivePrivateKeyFromSeed(seed, SeedVersionLegacy)
+	if err != nil {
+		t.Fatalf("legacy derivation failed: %v", err)
+	}
+	digest := sha256.Sum256(append(append([]byte(nil), seed...), "TOPAY-Z512-PRIVATE-KEY-SEED"...))
+	if !bytes.Equal(legacy[:32], digest[:]) || !bytes.Equal(legacy[32:], digest[:]) {
+		t.Error("legacy derivation changed")
+	}
+
+	// Version 2 is PBKDF2-HMAC-SHA512; check against an independent single-block computation
+	v2, err := DerivePrivateKeyFromSeed(seed, SeedVersion2)
+	if err != nil {
+		t.Fatalf("v2 derivation failed: %v", err)
+	}
+	salt := append([]byte("TOPAY-Z512-SEED-V2"), 0, 0, 0, byte(len(seed)))
+	mac := hmac.New(sha512.New, seed)
+	mac.Write(append(salt, 0, 0, 0, 1))
+	u := mac.Sum(nil)
+	expected := append([]byte(nil), u...)
+	for i := 1; i < 2048; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(nil)
+		for j := range expected {
+			expected[j] ^= u[j]
+		}
+	}
+	if !bytes.Equal(v2[:], expected) {
+		t.Error("v2 derivation does not match PBKDF2-HMAC-SHA512")
+	}
+
+	current, _, err := GenerateKeyPairFromSeed(seed)
+	if err != nil {
+		t.Fatalf("GenerateKeyPairFromSeed failed: %v", err)
+	}
+	if current != v2 {
+		t.Error("GenerateKeyPairFromSeed should use the current seed version")
+	}
+
+	if _, err := DerivePrivateKeyFromSeed(seed, SeedVersion(9)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	if _, err := DerivePrivateKeyFromSeed(seed[:MinSeedSize-1], SeedVersion2); !errors.Is(err, ErrInvalidKeySize) {
+		t.Errorf("expected ErrInvalidKeySize, got %v", err)
+	}
+
+	// Binary round trip
+	stored := VersionedSeed{Version: SeedVersionLegacy, Seed: seed}
+	encoded, _ := stored.MarshalBinary()
+	var decoded VersionedSeed
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.Version != SeedVersionLegacy || !bytes.Equal(decoded.Seed, seed) {
+		t.Error("versioned seed round trip mismatch")
+	}
+	encoded[0] = 0
+	if err := decoded.UnmarshalBinary(encoded); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	// Migration reports both key pairs
+	migration, err := MigrateSeed(stored)
+	if err != nil {
+		t.Fatalf("MigrateSeed failed: %v", err)
+	}
+	if migration.Seed.Version != CurrentSeedVersion || migration.OldPrivateKey != legacy || migration.NewPrivateKey != v2 {
+		t.Error("migration produced unexpected keys")
+	}
+	if !VerifyKeyPair(migration.NewPrivateKey, migration.NewPublicKey) {
+		t.Error("migrated key pair does not verify")
+	}
+}
+
+// Test SHAKE against FIPS 202 known answers
+func TestSHAKE(t *testing.T) {
+	out := make([]byte, 32)
+	shake256(out)
+	if hex.EncodeToString(out) != "46b9dd2b0ba88d13233b3feb743eeb243fcd52ea62b81b82b50c27646ed5762f" {
+		t.Errorf("SHAKE256 of the empty string is %x", out)
+	}
+
+	xof := newShake128()
+	xof.Write([]byte("abc"))
+	xof.Read(out[:5])
+	xof.Read(out[5:])
+	if hex.EncodeToString(out) != "5881092dd818bf5cf8a3ddb793fbcba74097d5c526a6d35f97b83351940f2cc8" {
+		t.Errorf("SHAKE128 of \"abc\" is %x", out)
+	}
+
+	// Inputs spanning several blocks, written in pieces
+	data := bytes.Repeat([]byte{0xa3}, 200)
+	whole, pieces := make([]byte, 64), make([]byte, 64)
+	shake256(whole, data)
+	shake256(pieces, data[:1], data[1:137], data[137:])
+	if !bytes.Equal(whole, pieces) {
+		t.Error("SHAKE256 depends on how the input is split")
+	}
+}
+
+// Test the Module-LWE KEM: round trips, implicit rejection and key checks
+func TestModuleLWEKEM(t *testing.T) {
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	if !IsValidKEMPublicKey(publicKey) || !VerifyKEMKeyPair(publicKey, secretKey) {
+		t.Fatal("Generated key pair doesn't validate")
+	}
+
+	for i := 0; i < 8; i++ {
+		ciphertext, sharedSecret, err := KEMEncapsulate(publicKey)
+		if err != nil {
+			t.Fatalf("Encapsulation failed: %v", err)
+		}
+		decapsulated, err := KEMDecapsulate(secretKey, ciphertext)
+		if err != nil || decapsulated != sharedSecret {
+			t.Fatalf("Round trip %d failed: %v", i, err)
+		}
+	}
+
+	// Encapsulation is deterministic in the message, and the lattice part of
+	// the ciphertext hides it
+	message := bytes.Repeat([]byte{0x5a}, kemMessageSize)
+	ciphertext1, sharedSecret1, err := kemEncapsulateMessage(publicKey, message)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	ciphertext2, sharedSecret2, _ := kemEncapsulateMessage(publicKey, message)
+	if ciphertext1 != ciphertext2 || sharedSecret1 != sharedSecret2 {
+		t.Error("Encapsulation of a fixed message isn't deterministic")
+	}
+	if bytes.Contains(ciphertext1[:], message[:16]) {
+		t.Error("Ciphertext contains the message")
+	}
+
+	// A modified lattice part with a recomputed tag decapsulates to an
+	// unrelated secret instead of failing
+	tampered := ciphertext1
+	tampered[100] ^= 1
+	copy(tampered[kemBodySize:], ciphertextRecipientTag(tampered[:kemBodySize], kemPublicKeyHash(publicKey[:])))
+	rejected, err := KEMDecapsulate(secretKey, tampered)
+	if err != nil {
+		t.Fatalf("Tampered ciphertext returned an error: %v", err)
+	}
+	if rejected == sharedSecret1 || !IsValidSharedSecret(rejected) {
+		t.Error("Tampered ciphertext wasn't implicitly rejected")
+	}
+	again, _ := KEMDecapsulate(secretKey, tampered)
+	if again != rejected {
+		t.Error("Implicit rejection isn't deterministic")
+	}
+
+	// Context secrets differ from plain ones and agree on both sides
+	contextCiphertext, contextSecret, err := KEMWithContext(publicKey, []byte("ctx"))
+	if err != nil {
+		t.Fatalf("Context encapsulation failed: %v", err)
+	}
+	if opened, err := KEMDecapsulateWithContext(secretKey, contextCiphertext, []byte("ctx")); err != nil || opened != contextSecret {
+		t.Errorf("Context round trip failed: %v", err)
+	}
+	if plain, _ := KEMDecapsulate(secretKey, contextCiphertext); plain == contextSecret {
+		t.Error("Context secret equals the plain shared secret")
+	}
+
+	// Public keys with unreduced coefficients are rejected
+	malformed := publicKey
+	malformed[0], malformed[1] = 0xff, 0xff
+	if IsValidKEMPublicKey(malformed) {
+		t.Error("Unreduced public key accepted")
+	}
+	if _, _, err := KEMEncapsulate(malformed); err != ErrInvalidKEMPublicKey {
+		t.Errorf("Expected ErrInvalidKEMPublicKey, got %v", err)
+	}
+}
+
+// Test personalized hashing
+func TestPersonalizedHash(t *testing.T) {
+	data := []byte("payload")
+
+	walletHash := ComputePersonalizedHash([]byte("wallet"), data)
+	if walletHash == ComputeHash(data) {
+		t.Error("Personalized hash equals the standard hash")
+	}
+	if walletHash == ComputePersonalizedHash([]byte("ledger"), data) {
+		t.Error("Different personalizations produced the same hash")
+	}
+	if ComputePersonalizedHash(nil, data) != ComputeHash(data) {
+		t.Error("Empty personalization should give the standard hash")
+	}
+
+	// Personalization is not the same as prefixing the input
+	if walletHash == ComputeHash(append([]byte("wallet"), data...)) {
+		t.Error("Personalization equals prefixing the input")
+	}
+
+	stream := NewPersonalizedHash([]byte("wallet"))
+	stream.Write(data[:3])
+	stream.Write(data[3:])
+	if stream.Sum() != walletHash {
+		t.Error("Streaming personalized hash differs from one-shot")
+	}
+	stream.Reset()
+	stream.Write(data)
+	if stream.Sum() != walletHash {
+		t.Error("Reset dropped the personalization")
+	}
+	stream.Close()
+
+	// Pooled states are returned unpersonalized
+	for i := 0; i < 4; i++ {
+		if ComputeHash(data) != HashMultiple(data) {
+			t.Fatal("Pooled hash state kept a personalization")
+		}
+	}
+}
+
+// Test ML-KEM-768 against the accumulated FIPS 203 vectors of C2SP CCTV: key
+// pairs from a SHAKE128 seed stream, encapsulations of chosen messages and
+// decapsulations of random ciphertexts, all absorbed into one SHAKE128 digest
+func TestMLKEM768Vectors(t *testing.T) {
+	source, digest := newShake128(), newShake128()
+	seed := make([]byte, MLKEMSeedSize)
+	message := make([]byte, 32)
+
+	for i := 0; i < 100; i++ {
+		source.Read(seed)
+		publicKey, secretKey, err := MLKEM768KeyFromSeed(seed)
+		if err != nil {
+			t.Fatalf("Key generation failed: %v", err)
+		}
+		digest.Write(publicKey[:])
+
+		source.Read(message)
+		ciphertext, sharedSecret, err := mlkemEncapsulateMessage(publicKey, message)
+		if err != nil {
+			t.Fatalf("Encapsulation failed: %v", err)
+		}
+		digest.Write(ciphertext[:])
+		digest.Write(sharedSecret[:])
+
+		decapsulated, err := MLKEMDecapsulate(secretKey, ciphertext)
+		if err != nil || decapsulated != sharedSecret {
+			t.Fatalf("Vector %d: decapsulation mismatch: %v", i, err)
+		}
+
+		var random MLKEM768Ciphertext
+		source.Read(random[:])
+		rejected, err := MLKEMDecapsulate(secretKey, random)
+		if err != nil {
+			t.Fatalf("Decapsulation of a random ciphertext failed: %v", err)
+		}
+		digest.Write(rejected[:])
+	}
+
+	sum := make([]byte, 32)
+	digest.Read(sum)
+	if got := hex.EncodeToString(sum); got != "1114b1b6699ed191734fa339376afa7e285c9e6acf6ff0177d346696ce564415" {
+		t.Errorf("Accumulated digest %s doesn't match the reference", got)
+	}
+}
+
+// Test the ML-KEM-768 API and its input checks
+func TestMLKEM768(t *testing.T) {
+	publicKey, secretKey, err := MLKEM768KeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	if secretKey.PublicKey() != publicKey {
+		t.Error("Decapsulation key doesn't embed its encapsulation key")
+	}
+
+	ciphertext, sharedSecret, err := MLKEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	if decapsulated, err := MLKEMDecapsulate(secretKey, ciphertext); err != nil || decapsulated != sharedSecret {
+		t.Errorf("Round trip failed: %v", err)
+	}
+
+	parsedPublic, err := MLKEM768PublicKeyFromBytes(publicKey[:])
+	if err != nil || parsedPublic != publicKey {
+		t.Errorf("Public key parsing failed: %v", err)
+	}
+	malformed := publicKey
+	malformed[0], malformed[1] = 0xff, 0xff
+	if _, err := MLKEM768PublicKeyFromBytes(malformed[:]); err != ErrInvalidKEMPublicKey {
+		t.Errorf("Expected ErrInvalidKEMPublicKey, got %v", err)
+	}
+	if _, _, err := MLKEMEncapsulate(malformed); err != ErrInvalidKEMPublicKey {
+		t.Errorf("Expected ErrInvalidKEMPublicKey from encapsulation, got %v", err)
+	}
+
+	if _, err := MLKEM768SecretKeyFromBytes(secretKey[:]); err != nil {
+		t.Errorf("Secret key parsing failed: %v", err)
+	}
+	corrupted := secretKey
+	corrupted[mlkem768EKOffset] ^= 1
+	if _, err := MLKEM768SecretKeyFromBytes(corrupted[:]); err != ErrInvalidKEMSecretKey {
+		t.Errorf("Expected ErrInvalidKEMSecretKey, got %v", err)
+	}
+	if _, err := MLKEMDecapsulate(corrupted, ciphertext); err != ErrInvalidKEMSecretKey {
+		t.Errorf("Expected ErrInvalidKEMSecretKey from decapsulation, got %v", err)
+	}
+
+	if _, err := MLKEM768CiphertextFromBytes(ciphertext[:10]); err != ErrInvalidCiphertextSize {
+		t.Errorf("Expected ErrInvalidCiphertextSize, got %v", err)
+	}
+	if _, _, err := MLKEM768KeyFromSeed(make([]byte, 32)); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize for a short seed, got %v", err)
+	}
+}
+
+// Test the hybrid X25519 + KEM construction
+func TestHybridKEM(t *testing.T) {
+	recipient, err := NewHybridKEM()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	publicKey, err := HybridPublicKeyFromBytes(recipient.PublicKey().Bytes())
+	if err != nil {
+		t.Fatalf("Public key round trip failed: %v", err)
+	}
+
+	ciphertext, sharedSecret, err := HybridEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	parsed, err := HybridCiphertextFromBytes(ciphertext.Bytes())
+	if err != nil {
+		t.Fatalf("Ciphertext round trip failed: %v", err)
+	}
+	decapsulated, err := recipient.Decapsulate(parsed)
+	if err != nil || decapsulated != sharedSecret {
+		t.Fatalf("Decapsulation failed: %v", err)
+	}
+
+	// The combined secret differs from the KEM component alone
+	var kemCiphertext Ciphertext
+	copy(kemCiphertext[:], ciphertext[HybridCiphertextSize-CiphertextSize:])
+	if kemSecret, _ := KEMDecapsulate(recipient.kemSecret, kemCiphertext); kemSecret == sharedSecret {
+		t.Error("Hybrid secret equals the KEM secret")
+	}
+
+	// Replacing the X25519 part changes the secret
+	other, err := NewHybridKEM()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	otherPublic := other.PublicKey()
+	swapped := ciphertext
+	copy(swapped[:32], otherPublic[:32])
+	if secret, err := recipient.Decapsulate(swapped); err == nil && secret == sharedSecret {
+		t.Error("Hybrid secret doesn't depend on the X25519 exchange")
+	}
+
+	// A ciphertext for another recipient is rejected by the KEM tag
+	if _, err := other.Decapsulate(ciphertext); err != ErrWrongRecipient {
+		t.Errorf("Expected ErrWrongRecipient, got %v", err)
+	}
+
+	if _, err := HybridPublicKeyFromBytes(publicKey[:10]); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize, got %v", err)
+	}
+	if _, err := HybridCiphertextFromBytes(ciphertext[:10]); err != ErrInvalidCiphertextSize {
+		t.Errorf("Expected ErrInvalidCiphertextSize, got %v", err)
+	}
+	recipient.Wipe()
+	(*HybridKEM)(nil).Wipe()
+}
+
+// Test the Merkle mountain range: roots, proofs for every leaf, and resuming
+// from a store
+func TestMMR(t *testing.T) {
+	store := &MemoryMMRStore{}
+	mmr, err := NewMMR(store)
+	if err != nil {
+		t.Fatalf("NewMMR failed: %v", err)
+	}
+	if _, err := mmr.Prove(0); err != ErrInvalidLeafIndex {
+		t.Errorf("Expected ErrInvalidLeafIndex, got %v", err)
+	}
+
+	leaf := func(i int) []byte { return []byte(fmt.Sprintf("header %d", i)) }
+	roots := make(map[Hash]bool)
+	for n := 1; n <= 33; n++ {
+		index, err := mmr.Append(leaf(n - 1))
+		if err != nil || index != uint64(n-1) {
+			t.Fatalf("Append %d returned %d, %v", n-1, index, err)
+		}
+		root := mmr.Root()
+		if roots[root] {
+			t.Fatalf("Root repeated after %d leaves", n)
+		}
+		roots[root] = true
+		if size, _ := store.Size(); size != uint64(2*n-bits.OnesCount(uint(n))) {
+			t.Fatalf("Store holds %d nodes for %d leaves", size, n)
+		}
+
+		for i := 0; i < n; i++ {
+			proof, err := mmr.Prove(uint64(i))
+			if err != nil {
+				t.Fatalf("Prove %d of %d failed: %v", i, n, err)
+			}
+			if !VerifyMMRProof(root, leaf(i), &proof) {
+				t.Fatalf("Proof for leaf %d of %d rejected", i, n)
+			}
+			if VerifyMMRProof(root, leaf(i+1), &proof) {
+				t.Fatalf("Proof for leaf %d of %d accepted wrong data", i, n)
+			}
+			parsed, err := MMRProofFromBytes(proof.Bytes())
+			if err != nil || !VerifyMMRProof(root, leaf(i), &parsed) {
+				t.Fatalf("Proof round trip for leaf %d of %d failed: %v", i, n, err)
+			}
+		}
+	}
+
+	// Tampering with any part of a proof is rejected
+	root := mmr.Root()
+	proof, _ := mmr.Prove(13)
+	tampered := proof
+	tampered.Siblings = append([]Hash(nil), proof.Siblings...)
+	tampered.Siblings[0][0] ^= 1
+	if VerifyMMRProof(root, leaf(13), &tampered) {
+		t.Error("Proof with a tampered sibling accepted")
+	}
+	tampered = proof
+	tampered.Peaks = append([]Hash(nil), proof.Peaks...)
+	tampered.Peaks[len(tampered.Peaks)-1][0] ^= 1
+	if VerifyMMRProof(root, leaf(13), &tampered) {
+		t.Error("Proof with a tampered peak accepted")
+	}
+	tampered = proof
+	tampered.LeafIndex = 12
+	if VerifyMMRProof(root, leaf(13), &tampered) {
+		t.Error("Proof moved to another index accepted")
+	}
+	tampered = proof
+	tampered.LeafCount = 34
+	if VerifyMMRProof(root, leaf(13), &tampered) {
+		t.Error("Proof with a wrong leaf count accepted")
+	}
+	if VerifyMMRProof(root, leaf(13), nil) {
+		t.Error("Nil proof accepted")
+	}
+
+	// JSON round trip
+	encoded, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded MMRProof
+	if err := json.Unmarshal(encoded, &decoded); err != nil || !VerifyMMRProof(root, leaf(13), &decoded) {
+		t.Errorf("JSON round trip failed: %v", err)
+	}
+
+	if _, err := MMRProofFromBytes(proof.Bytes()[:40]); err != ErrInvalidProof {
+		t.Errorf("Expected ErrInvalidProof, got %v", err)
+	}
+	if _, err := mmr.Prove(33); err != ErrInvalidLeafIndex {
+		t.Errorf("Expected ErrInvalidLeafIndex, got %v", err)
+	}
+
+	// Reopening the store resumes with the same root and keeps appending
+	reopened, err := NewMMR(store)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if reopened.LeafCount() != 33 || reopened.Root() != root {
+		t.Fatal("Reopened MMR differs")
+	}
+	if _, err := reopened.Append(leaf(33)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	fresh, _ := NewMMR(nil)
+	for i := 0; i < 34; i++ {
+		fresh.Append(leaf(i))
+	}
+	if fresh.Root() != reopened.Root() {
+		t.Error("Resumed MMR root differs from one built in memory")
+	}
+
+	// A store truncated mid-append is rejected
+	broken := &MemoryMMRStore{}
+	broken.Append(make([]Hash, 2))
+	if _, err := NewMMR(broken); err != ErrInvalidMMR {
+		t.Errorf("Expected ErrInvalidMMR, got %v", err)
+	}
+}
+
+// Test AEAD encryption between the two holders of a shared secret
+func TestSharedSecretAEAD(t *testing.T) {
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	ciphertext, senderSecret, err := KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	receiverSecret, err := KEMDecapsulate(secretKey, ciphertext)
+	if err != nil {
+		t.Fatalf("Decapsulation failed: %v", err)
+	}
+
+	store := &MemoryCounterStore{}
+	sender, err := senderSecret.NewAEAD(AEADInitiator, &AEADOptions{Nonces: &NonceSequenceOptions{Store: store}})
+	if err != nil {
+		t.Fatalf("NewAEAD failed: %v", err)
+	}
+	receiver, err := receiverSecret.NewAEAD(AEADResponder, nil)
+	if err != nil {
+		t.Fatalf("NewAEAD failed: %v", err)
+	}
+	if sender.Role() != AEADInitiator || receiver.Role().String() != "responder" {
+		t.Error("Unexpected roles")
+	}
+
+	plaintext := []byte("payload protected end to end")
+	aad := []byte("header")
+	first, err := sender.Seal(plaintext, aad)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if len(first) != len(plaintext)+AEADOverhead {
+		t.Errorf("Sealed length %d, want %d", len(first), len(plaintext)+AEADOverhead)
+	}
+	opened, err := receiver.Open(first, aad)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// Sealing again uses a fresh nonce
+	second, _ := sender.Seal(plaintext, aad)
+	if bytes.Equal(first, second) || binary.BigEndian.Uint64(second) != 1 {
+		t.Error("Second message reused the nonce counter")
+	}
+
+	// Each direction has its own key: the responder can reply, but nobody
+	// opens their own messages
+	reply, err := receiver.Seal([]byte("reply"), nil)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if opened, err := sender.Open(reply, nil); err != nil || string(opened) != "reply" {
+		t.Errorf("Reply failed: %v", err)
+	}
+	if _, err := sender.Open(first, aad); err != ErrAuthenticationFailed {
+		t.Errorf("Expected ErrAuthenticationFailed for own message, got %v", err)
+	}
+
+	// Tampering with the counter, ciphertext or associated data fails
+	for _, tamper := range []func([]byte) []byte{
+		func(b []byte) []byte { b[7] ^= 1; return b },
+		func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+		func(b []byte) []byte { return b[:AEADOverhead-1] },
+	} {
+		if _, err := receiver.Open(tamper(append([]byte(nil), first...)), aad); err != ErrAuthenticationFailed {
+			t.Errorf("Expected ErrAuthenticationFailed, got %v", err)
+		}
+	}
+	if _, err := receiver.Open(first, []byte("other header")); err != ErrAuthenticationFailed {
+		t.Errorf("Expected ErrAuthenticationFailed for wrong AAD, got %v", err)
+	}
+
+	// A restarted sender resumes past the persisted counter
+	restarted, err := senderSecret.NewAEAD(AEADInitiator, &AEADOptions{Nonces: &NonceSequenceOptions{Store: store}})
+	if err != nil {
+		t.Fatalf("NewAEAD failed: %v", err)
+	}
+	third, _ := restarted.Seal(plaintext, aad)
+	if binary.BigEndian.Uint64(third) < 2 {
+		t.Error("Restarted sender reused a nonce counter")
+	}
+	if _, err := receiver.Open(third, aad); err != nil {
+		t.Errorf("Open after restart failed: %v", err)
+	}
+
+	if _, err := senderSecret.NewAEAD(AEADRole(7), nil); err != ErrInvalidAEADRole {
+		t.Errorf("Expected ErrInvalidAEADRole, got %v", err)
+	}
+	sender.Wipe()
+	(*AEAD)(nil).Wipe()
+}
+
+// Test exporting and importing the runtime configuration
+func TestRuntimeState(t *testing.T) {
+	original, err := ExportRuntimeState()
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	defer func() {
+		if err := ImportRuntimeState(original); err != nil {
+			t.Errorf("Restoring runtime state failed: %v", err)
+		}
+	}()
+
+	state := CurrentRuntimeState()
+	if state.ParameterSet != ParameterSet() || !strings.HasPrefix(state.ParameterSet, "TOPAY-Z512-") {
+		t.Errorf("Unexpected parameter set %q", state.ParameterSet)
+	}
+
+	state.StrictMode = true
+	state.WorkerPoolSize = 3
+	state.SIMD = []string{"sse2", "avx512"}
+	blob, _ := json.Marshal(state)
+	if err := ImportRuntimeState(blob); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if !StrictMode() || globalWorkerPoolSize != 3 {
+		t.Error("Import didn't apply the settings")
+	}
+	// Sets the device lacks stay disabled
+	imported := CurrentRuntimeState()
+	want := []string{}
+	if DetectSIMDCapabilities().SSE2 {
+		want = append(want, "sse2")
+	}
+	if DetectSIMDCapabilities().AVX512 {
+		want = append(want, "avx512")
+	}
+	if Capabilities().AVX2 || Capabilities().NEON {
+		t.Errorf("Capabilities %+v include sets the import left out", Capabilities())
+	}
+	if strings.Join(imported.SIMD, ",") != strings.Join(want, ",") {
+		t.Errorf("SIMD profile %v, want %v", imported.SIMD, want)
+	}
+	exported, _ := ExportRuntimeState()
+	reimported := CurrentRuntimeState()
+	if err := ImportRuntimeState(exported); err != nil || CurrentRuntimeState().WorkerPoolSize != reimported.WorkerPoolSize {
+		t.Errorf("Round trip failed: %v", err)
+	}
+	SubmitWork(func() {})
+
+	// Rejected states leave the configuration unchanged
+	for name, mutate := range map[string]func(*RuntimeState){
+		"parameter set": func(s *RuntimeState) { s.ParameterSet = "TOPAY-Z512-0000000000000000" },
+		"worker pool":   func(s *RuntimeState) { s.WorkerPoolSize = -1 },
+		"instruction":   func(s *RuntimeState) { s.SIMD = []string{"mmx"} },
+	} {
+		bad := CurrentRuntimeState()
+		bad.StrictMode = false
+		mutate(&bad)
+		if err := ApplyRuntimeState(&bad); !errors.Is(err, ErrInvalidRuntimeState) {
+			t.Errorf("%s: expected ErrInvalidRuntimeState, got %v", name, err)
+		}
+		if !StrictMode() {
+			t.Errorf("%s: rejected state was partly applied", name)
+		}
+	}
+	bad := CurrentRuntimeState()
+	bad.Version = 9
+	if err := ApplyRuntimeState(&bad); err != ErrUnsupportedVersion {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if err := ImportRuntimeState([]byte(`{"version":1,"secret_key":"00"}`)); err == nil {
+		t.Error("Unknown field accepted")
+	}
+	CleanupGlobalPools()
+}
+
+// Test per-tenant suites: isolated pools, rate limits and accounting
+func TestSuite(t *testing.T) {
+	alice := NewSuite("alice", &SuiteOptions{Workers: 2})
+	defer alice.Close()
+	bob := NewSuite("bob", &SuiteOptions{OperationsPerSecond: 0.001, Burst: 2})
+	defer bob.Close()
+	if alice.Tenant() != "alice" {
+		t.Errorf("Unexpected tenant %q", alice.Tenant())
+	}
+
+	// Buffers returned to one tenant's pool are cleared and never reach another's
+	buf := alice.GetBuffer(64)
+	copy(buf, "alice's data")
+	alice.PutBuffer(buf)
+	for i := 0; i < 10; i++ {
+		if other := bob.GetBuffer(64); bytes.Contains(other, []byte("alice")) {
+			t.Fatal("Tenant buffer leaked across suites")
+		}
+	}
+	if alice.hashes == bob.hashes || alice.buffers == bob.buffers || alice.buffers == globalBytePool {
+		t.Error("Suites share pools")
+	}
+
+	data := []byte("tenant payload")
+	hash, err := alice.Hash(data)
+	if err != nil || hash != ComputeHash(data) {
+		t.Fatalf("Suite hash differs: %v", err)
+	}
+	publicKey, secretKey, err := alice.KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen failed: %v", err)
+	}
+	ciphertext, sharedSecret, err := alice.KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("KEMEncapsulate failed: %v", err)
+	}
+	if decapsulated, err := alice.KEMDecapsulate(secretKey, ciphertext); err != nil || decapsulated != sharedSecret {
+		t.Fatalf("KEMDecapsulate failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	if err := alice.Submit(func() { close(done) }); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	<-done
+	deadline := time.Now().Add(time.Second)
+	for alice.Usage().Operations < 5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	usage := alice.Usage()
+	if usage.Tenant != "alice" || usage.Operations != 5 || usage.Throttled != 0 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	wantIn := uint64(len(data) + KEMPublicKeySize + KEMSecretKeySize + CiphertextSize)
+	if usage.BytesIn != wantIn || usage.CPUTime <= 0 {
+		t.Errorf("Usage counted %d bytes in, want %d; CPU time %v", usage.BytesIn, wantIn, usage.CPUTime)
+	}
+
+	// Work that panics is still counted
+	if err := alice.Submit(func() { panic("work failed") }); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	for alice.Usage().Operations < 6 && time.Now().Before(deadline.Add(time.Second)) {
+		time.Sleep(time.Millisecond)
+	}
+	if operations := alice.Usage().Operations; operations != 6 {
+		t.Errorf("Panicking work counted as %d operations, want 6", operations-5)
+	}
+
+	// Bob's burst of two is spent and refills far too slowly to recover
+	for i := 0; i < 2; i++ {
+		if _, err := bob.Hash(data); err != nil {
+			t.Fatalf("Hash within burst failed: %v", err)
+		}
+	}
+	if _, err := bob.Hash(data); err != ErrRateLimited {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if usage := bob.Usage(); usage.Operations != 2 || usage.Throttled != 1 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	// Bob's limit doesn't affect Alice
+	if _, err := alice.Hash(data); err != nil {
+		t.Errorf("Other tenant throttled: %v", err)
+	}
+
+	alice.Close()
+	if _, err := alice.Hash(data); err != ErrServiceClosed {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+}
+
+// Test sealed-box public-key encryption
+func TestSealedBox(t *testing.T) {
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+
+	for _, plaintext := range [][]byte{nil, []byte("sealed for one recipient")} {
+		box, err := Encrypt(publicKey, plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		if len(box) != len(plaintext)+SealedBoxOverhead {
+			t.Errorf("Box is %d bytes, want %d", len(box), len(plaintext)+SealedBoxOverhead)
+		}
+		opened, err := Decrypt(secretKey, box)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Fatalf("Decrypt failed: %v", err)
+		}
+	}
+
+	// Boxes for the same plaintext differ
+	first, _ := Encrypt(publicKey, []byte("message"))
+	second, _ := Encrypt(publicKey, []byte("message"))
+	if bytes.Equal(first, second) {
+		t.Error("Encrypt is deterministic")
+	}
+
+	tampered := append([]byte(nil), first...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Decrypt(secretKey, tampered); err != ErrAuthenticationFailed {
+		t.Errorf("Expected ErrAuthenticationFailed, got %v", err)
+	}
+	if _, err := Decrypt(secretKey, first[:SealedBoxOverhead-1]); err != ErrAuthenticationFailed {
+		t.Errorf("Expected ErrAuthenticationFailed for a truncated box, got %v", err)
+	}
+
+	_, otherSecret, _ := KEMKeyGen()
+	if _, err := Decrypt(otherSecret, first); err != ErrWrongRecipient {
+		t.Errorf("Expected ErrWrongRecipient, got %v", err)
+	}
+}
+
+// z512Digest adapts StreamingHash to hash.Hash so results can be checked
+// against crypto/hmac
+type z512Digest struct{ *StreamingHash }
+
+func (d z512Digest) Sum(b []byte) []byte { sum := d.Peek(); return append(b, sum[:]...) }
+func (d z512Digest) Size() int           { return HashSize }
+func (d z512Digest) BlockSize() int      { return 128 }
+
+// Test HMAC and HKDF over the TOPAY-Z512 hash
+func TestHKDF(t *testing.T) {
+	newDigest := func() hash.Hash { return z512Digest{NewStreamingHash()} }
+
+	// hmacHash agrees with crypto/hmac for short and long keys
+	for _, key := range [][]byte{[]byte("key"), bytes.Repeat([]byte{0xaa}, 200)} {
+		mac := hmac.New(newDigest, key)
+		mac.Write([]byte("message"))
+		got := hmacHash(key, []byte("mess"), []byte("age"))
+		if !bytes.Equal(mac.Sum(nil), got[:]) {
+			t.Errorf("HMAC with %d-byte key differs from crypto/hmac", len(key))
+		}
+	}
+
+	// HKDFExpand follows RFC 5869
+	prk := HKDFExtract(nil, []byte("input keying material"))
+	mac := hmac.New(newDigest, make([]byte, HashSize))
+	mac.Write([]byte("input keying material"))
+	if !bytes.Equal(mac.Sum(nil), prk[:]) {
+		t.Error("HKDFExtract differs from HMAC with a zero salt")
+	}
+	okm, err := HKDFExpand(prk, []byte("info"), 100)
+	if err != nil {
+		t.Fatalf("HKDFExpand failed: %v", err)
+	}
+	var expected, previous []byte
+	for counter := byte(1); len(expected) < 100; counter++ {
+		mac := hmac.New(newDigest, prk[:])
+		mac.Write(previous)
+		mac.Write([]byte("info"))
+		mac.Write([]byte{counter})
+		previous = mac.Sum(nil)
+		expected = append(expected, previous...)
+	}
+	if !bytes.Equal(okm, expected[:100]) {
+		t.Error("HKDFExpand differs from RFC 5869")
+	}
+
+	var secret SharedSecret
+	copy(secret[:], "shared secret from one KEM exchange")
+	encryptionKey, err := secret.Derive([]byte("encryption"), 32)
+	if err != nil || len(encryptionKey) != 32 {
+		t.Fatalf("Derive failed: %v", err)
+	}
+	macKey, _ := secret.Derive([]byte("mac"), 32)
+	if bytes.Equal(encryptionKey, macKey) {
+		t.Error("Different info produced the same key")
+	}
+	longer, _ := secret.Derive([]byte("encryption"), 80)
+	if !bytes.Equal(longer[:32], encryptionKey) {
+		t.Error("Shorter output isn't a prefix of a longer one")
+	}
+	if bytes.Equal(encryptionKey, secret[:32]) {
+		t.Error("Derive returned the raw secret")
+	}
+
+	if empty, err := secret.Derive(nil, 0); err != nil || len(empty) != 0 {
+		t.Errorf("Zero-length derive failed: %v", err)
+	}
+	if _, err := secret.Derive(nil, MaxHKDFLength); err != nil {
+		t.Errorf("Maximum length failed: %v", err)
+	}
+	if _, err := secret.Derive(nil, MaxHKDFLength+1); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := secret.Derive(nil, -1); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize, got %v", err)
+	}
+}
+
+// Test TLS-PSK export from a KEM exchange
+func TestTLSPSK(t *testing.T) {
+	brokerPublic, brokerSecret, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	opts := &PSKExporterOptions{RotationInterval: time.Hour, Overlap: 1, Clock: func() time.Time { return now }}
+
+	ciphertext, client, err := EstablishPSK(brokerPublic, opts)
+	if err != nil {
+		t.Fatalf("EstablishPSK failed: %v", err)
+	}
+	broker, err := AcceptPSK(brokerSecret, ciphertext, opts)
+	if err != nil {
+		t.Fatalf("AcceptPSK failed: %v", err)
+	}
+	if client.Session() != broker.Session() {
+		t.Fatal("Sessions differ")
+	}
+
+	psk, err := client.Current()
+	if err != nil {
+		t.Fatalf("Current failed: %v", err)
+	}
+	if len(psk.Key) != DefaultPSKSize || !strings.HasPrefix(psk.Identity, DefaultPSKIdentityPrefix+"-"+client.Session()+"-") {
+		t.Errorf("Unexpected PSK %q with %d-byte key", psk.Identity, len(psk.Key))
+	}
+	if now.Before(psk.NotBefore) || !now.Before(psk.NotAfter) {
+		t.Error("Current PSK isn't valid now")
+	}
+	served, err := broker.ForIdentity(psk.Identity)
+	if err != nil || !bytes.Equal(served.Key, psk.Key) {
+		t.Fatalf("Broker derived a different key: %v", err)
+	}
+
+	// Rotation gives a new key; the previous epoch stays accepted for Overlap
+	now = now.Add(time.Hour)
+	rotated, _ := client.Current()
+	if rotated.Identity == psk.Identity || bytes.Equal(rotated.Key, psk.Key) {
+		t.Error("PSK didn't rotate")
+	}
+	if _, err := broker.ForIdentity(psk.Identity); err != nil {
+		t.Errorf("Previous epoch rejected within overlap: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := broker.ForIdentity(psk.Identity); err != ErrEpochExpired {
+		t.Errorf("Expected ErrEpochExpired, got %v", err)
+	}
+	future, _ := client.ForEpoch(client.CurrentEpoch() + 2)
+	if _, err := broker.ForIdentity(future.Identity); err != ErrEpochExpired {
+		t.Errorf("Expected ErrEpochExpired for a future epoch, got %v", err)
+	}
+
+	// Another client's session isn't served by this exporter
+	otherCiphertext, other, _ := EstablishPSK(brokerPublic, opts)
+	if otherCiphertext == ciphertext {
+		t.Fatal("Ciphertexts repeat")
+	}
+	otherPSK, _ := other.Current()
+	if _, err := broker.ForIdentity(otherPSK.Identity); err != ErrInvalidPSKIdentity {
+		t.Errorf("Expected ErrInvalidPSKIdentity, got %v", err)
+	}
+
+	prefix, session, epoch, err := ParsePSKIdentity(rotated.Identity)
+	if err != nil || prefix != DefaultPSKIdentityPrefix || session != client.Session() || epoch != rotated.Epoch {
+		t.Errorf("ParsePSKIdentity returned %q %q %d, %v", prefix, session, epoch, err)
+	}
+	for _, identity := range []string{"", "tz512", "tz512-zz-1", "tz512-" + client.Session() + "-01", "tz512-" + strings.ToUpper(client.Session()) + "-1"} {
+		if _, _, _, err := ParsePSKIdentity(identity); err != ErrInvalidPSKIdentity {
+			t.Errorf("Identity %q: expected ErrInvalidPSKIdentity, got %v", identity, err)
+		}
+	}
+	if _, _, err := EstablishPSK(brokerPublic, &PSKExporterOptions{IdentityPrefix: "a-b"}); err != ErrInvalidPSKIdentity {
+		t.Errorf("Expected ErrInvalidPSKIdentity for prefix, got %v", err)
+	}
+
+	psk.Wipe()
+	client.Wipe()
+	(*PSKExporter)(nil).Wipe()
+}
+
+// fakeTXTResolver serves TXT records from a map and counts lookups
+type fakeTXTResolver struct {
+	records map[string][]string
+	lookups int
+}
+
+func (f *fakeTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	f.lookups++
+	if records, ok := f.records[name]; ok {
+		return records, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+// Test publishing and discovering keys through DNS TXT records
+func TestDNSKeyDiscovery(t *testing.T) {
+	kemPublic, _, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	_, signingPublic, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+
+	full := NewKEMKeyRecord(kemPublic, true)
+	pinned := NewSigningKeyRecord(signingPublic, false)
+	for _, record := range []DNSKeyRecord{full, pinned, NewSigningKeyRecord(signingPublic, true)} {
+		parsed, err := ParseDNSKeyRecord(record.String())
+		if err != nil || parsed.Kind != record.Kind || parsed.Fingerprint != record.Fingerprint || !bytes.Equal(parsed.Key, record.Key) {
+			t.Fatalf("Record %q didn't round trip: %v", record.Kind, err)
+		}
+		chunks := record.TXTChunks()
+		for _, chunk := range chunks {
+			if len(chunk) > 255 {
+				t.Fatal("TXT chunk exceeds 255 bytes")
+			}
+		}
+		if strings.Join(chunks, "") != record.String() {
+			t.Fatal("TXT chunks don't join to the record")
+		}
+	}
+	if _, err := pinned.PublicKey(); err != ErrUnknownKey {
+		t.Errorf("Expected ErrUnknownKey for a fingerprint-only record, got %v", err)
+	}
+
+	// Records that are malformed, of another kind or mismatched are rejected
+	mismatched := full
+	mismatched.Fingerprint = pinned.Fingerprint
+	for _, text := range []string{
+		"v=spf1 -all",
+		"k=kem; v=tz512; fp=" + full.Fingerprint.String(),
+		"v=tz512; k=rsa; fp=" + full.Fingerprint.String(),
+		"v=tz512; k=kem; fp=00",
+		"v=tz512; k=kem; k=kem; fp=" + full.Fingerprint.String(),
+		"v=tz512; k=sig; fp=" + pinned.Fingerprint.String() + "; p=!!",
+		mismatched.String(),
+	} {
+		if _, err := ParseDNSKeyRecord(text); err != ErrInvalidKeyRecord {
+			t.Errorf("Record %.40q: expected ErrInvalidKeyRecord, got %v", text, err)
+		}
+	}
+
+	now := time.Unix(1700000000, 0)
+	resolver := &fakeTXTResolver{records: map[string][]string{
+		"_topayz512.example.com": {"v=spf1 -all", "v=tz512; k=kem; fp=00", pinned.String(), full.String()},
+		"_topayz512.empty.com":   {"v=spf1 -all"},
+	}}
+	dr := NewDNSKeyResolver(&DNSKeyResolverOptions{Resolver: resolver, CacheTTL: time.Minute, Clock: func() time.Time { return now }})
+	ctx := context.Background()
+
+	records, err := dr.Lookup(ctx, "Example.com.")
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Lookup returned %d records, %v", len(records), err)
+	}
+	found, err := dr.LookupKEMPublicKey(ctx, "example.com")
+	if err != nil || found != kemPublic {
+		t.Fatalf("LookupKEMPublicKey failed: %v", err)
+	}
+	if ok, err := dr.VerifyKEMPublicKey(ctx, "example.com", kemPublic); !ok || err != nil {
+		t.Errorf("VerifyKEMPublicKey failed: %v", err)
+	}
+	otherPublic, _, _ := KEMKeyGen()
+	if ok, _ := dr.VerifyKEMPublicKey(ctx, "example.com", otherPublic); ok {
+		t.Error("Unpublished key verified")
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("Cached lookups hit DNS %d times", resolver.lookups)
+	}
+
+	now = now.Add(2 * time.Minute)
+	dr.Lookup(ctx, "example.com")
+	dr.Flush()
+	dr.Lookup(ctx, "example.com")
+	if resolver.lookups != 3 {
+		t.Errorf("Expired or flushed cache not refreshed: %d lookups", resolver.lookups)
+	}
+
+	if _, err := dr.Lookup(ctx, "empty.com"); err != ErrNoKeyRecords {
+		t.Errorf("Expected ErrNoKeyRecords, got %v", err)
+	}
+	if _, err := dr.Lookup(ctx, "missing.com"); err == nil {
+		t.Error("Expected resolver error")
+	}
+}
+
+// Test Argon2id against RFC 9106 and x/crypto outputs
+func TestArgon2id(t *testing.T) {
+	var digest [64]byte
+	blake2bSum(digest[:], []byte("abc"))
+	if hex.EncodeToString(digest[:8]) != "ba80a53f981c4d0d" {
+		t.Errorf("BLAKE2b-512(abc) = %x", digest[:8])
+	}
+
+	// RFC 9106 section 5.3
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+	tag := argon2idKey(password, salt, secret, data, 3, 32, 4, 32)
+	if hex.EncodeToString(tag) != "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659" {
+		t.Errorf("RFC 9106 tag = %x", tag)
+	}
+
+	vectors := []struct {
+		time, memory uint32
+		threads      uint8
+		keyLen       uint32
+		want         string
+	}{
+		{2, 256, 1, 100, "0891a1ec210192db5c4e73e66d13af2337ebb5d598d572896f5d965a86963a3a477aaeb8ba11af39a913350addf3368ae0c7140cd066e8767b0ad025249a7acf805986cd76ab96bad0297d81d60ae2718d52ddc08f5dfdc8a18b9e1c65013acdaf2eb7b4"},
+		{1, 1000, 3, 64, "547b32b140cb9d45529e8678a29365671bfd03b45062e5eae60be2913eb74bbaa4480dc3b8ff9bee2bcdc917d29dca8e6a04602e1624592716fceac48ee903ab"},
+	}
+	for _, v := range vectors {
+		key := argon2idKey([]byte("password"), []byte("somesalt"), nil, nil, v.time, v.memory, v.threads, v.keyLen)
+		if hex.EncodeToString(key) != v.want {
+			t.Errorf("Argon2id(t=%d, m=%d, p=%d) = %x", v.time, v.memory, v.threads, key)
+		}
+	}
+}
+
+// Test password derivation parameters
+func TestPasswordParams(t *testing.T) {
+	params, err := NewPasswordParams()
+	if err != nil {
+		t.Fatalf("NewPasswordParams failed: %v", err)
+	}
+	if params.Algorithm != PasswordArgon2id || len(params.Salt) != MinPasswordSaltSize {
+		t.Errorf("Unexpected defaults %+v", params)
+	}
+
+	// Cheap parameters keep the test fast
+	params.Memory = 64
+	params.Iterations = 1
+	params.Parallelism = 2
+	password := []byte("correct horse battery staple")
+	privateKey, err := DeriveKeyWithParams(password, params)
+	if err != nil {
+		t.Fatalf("DeriveKeyWithParams failed: %v", err)
+	}
+	again, _ := DeriveKeyWithParams(password, params)
+	if privateKey != again {
+		t.Error("Derivation isn't deterministic")
+	}
+	publicKey := DerivePublicKey(privateKey)
+
+	encoded := params.String()
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=2$") {
+		t.Errorf("Unexpected encoding %q", encoded)
+	}
+	parsed, err := ParsePasswordParams(encoded)
+	if err != nil || parsed.String() != encoded {
+		t.Fatalf("ParsePasswordParams failed: %v", err)
+	}
+	if ok, err := VerifyPasswordKey(password, encoded, publicKey); err != nil || !ok {
+		t.Errorf("VerifyPasswordKey = %v, %v", ok, err)
+	}
+	if ok, _ := VerifyPasswordKey([]byte("wrong"), encoded, publicKey); ok {
+		t.Error("Wrong password verified")
+	}
+
+	// The legacy loop stays reachable and verifiable
+	legacy := PasswordParams{Algorithm: PasswordHashLoop, Iterations: 10, Salt: params.Salt}
+	legacyKey, err := DeriveKeyWithParams(password, legacy)
+	if err != nil {
+		t.Fatalf("Legacy derivation failed: %v", err)
+	}
+	direct, _ := DeriveKeyFromPassword(password, params.Salt, 10)
+	if legacyKey != direct {
+		t.Error("PasswordHashLoop differs from DeriveKeyFromPassword")
+	}
+	if ok, err := VerifyPasswordKey(password, legacy.String(), DerivePublicKey(legacyKey)); err != nil || !ok {
+		t.Errorf("Legacy VerifyPasswordKey = %v, %v", ok, err)
+	}
+	if !legacy.NeedsUpgrade(params) || params.NeedsUpgrade(params) {
+		t.Error("NeedsUpgrade mismatch")
+	}
+	stronger := params
+	stronger.Memory *= 2
+	if !params.NeedsUpgrade(stronger) {
+		t.Error("Expected upgrade to more memory")
+	}
+
+	for _, bad := range []string{
+		"",
+		"$argon2id$v=19$m=64,t=1,p=2",
+		"$argon2id$v=19$m=64,t=0,p=2$" + encoded[len(encoded)-22:],
+		"$argon2id$v=19$m=8589934592,t=1,p=2$" + encoded[len(encoded)-22:],
+		"$argon2id$v=19$m=064,t=1,p=2$" + encoded[len(encoded)-22:],
+		"$argon2id$v=19$m=64,t=1,p=2$c2FsdA",
+	} {
+		if _, err := ParsePasswordParams(bad); !errors.Is(err, ErrInvalidPasswordParams) {
+			t.Errorf("ParsePasswordParams(%q) = %v", bad, err)
+		}
+	}
+	for _, bad := range []string{"$argon2id$v=16$m=64,t=1,p=2$" + encoded[len(encoded)-22:], "$scrypt$v=1$n=1$abc"} {
+		if _, err := ParsePasswordParams(bad); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("ParsePasswordParams(%q) = %v", bad, err)
+		}
+	}
+}
+
+// Test MMR consistency proofs between every pair of sizes
+func TestMMRConsistency(t *testing.T) {
+	mmr, _ := NewMMR(nil)
+	roots := []Hash{mmr.Root()}
+	for n := 1; n <= 20; n++ {
+		mmr.Append([]byte(fmt.Sprintf("entry %d", n)))
+		roots = append(roots, mmr.Root())
+
+		for old := 0; old <= n; old++ {
+			proof, err := mmr.ProveConsistency(uint64(old))
+			if err != nil {
+				t.Fatalf("ProveConsistency(%d) at %d failed: %v", old, n, err)
+			}
+			if !VerifyMMRConsistency(roots[old], roots[n], &proof) {
+				t.Fatalf("Consistency %d -> %d failed", old, n)
+			}
+			if old > 0 && old < n && VerifyMMRConsistency(roots[old-1], roots[n], &proof) {
+				t.Fatalf("Consistency %d -> %d accepted the wrong old root", old, n)
+			}
+			if len(proof.Paths) > 0 && len(proof.Paths[0]) > 0 {
+				proof.Paths[0][0][0] ^= 1
+				if VerifyMMRConsistency(roots[old], roots[n], &proof) {
+					t.Fatalf("Tampered consistency proof %d -> %d verified", old, n)
+				}
+			}
+		}
+	}
+	if _, err := mmr.ProveConsistency(21); err != ErrInvalidLeafIndex {
+		t.Errorf("Expected ErrInvalidLeafIndex, got %v", err)
+	}
+	if VerifyMMRConsistency(roots[0], roots[1], nil) {
+		t.Error("Nil consistency proof verified")
+	}
+}
+
+// Test the key transparency log client
+func TestKeyTransparency(t *testing.T) {
+	logKey, err := GenerateXMSSKey(XMSSParams{Height: 3, WOTS: DefaultWOTSParams()}, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate log key: %v", err)
+	}
+	trusted := []XMSSPublicKey{logKey.Public()}
+	log := NewKeyLog()
+	entry := func(identity string, key byte) KeyLogEntry {
+		return KeyLogEntry{Identity: identity, Key: bytes.Repeat([]byte{key}, 32)}
+	}
+	for i := 0; i < 5; i++ {
+		log.Append(entry(fmt.Sprintf("user%d@example.com", i), byte(i)))
+	}
+
+	client := NewKeyTransparencyClient(trusted)
+	monitor := NewKeyTransparencyClient(trusted)
+	monitor.Watch("alice@example.com", entry("", 0xaa).Key)
+
+	head1, err := log.TreeHead(logKey)
+	if err != nil {
+		t.Fatalf("TreeHead failed: %v", err)
+	}
+	proof, _ := log.ProveConsistency(0)
+	if err := client.Update(head1, &proof); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	inclusion, _ := log.Prove(3)
+	if err := client.VerifyInclusion(entry("user3@example.com", 3), &inclusion); err != nil {
+		t.Errorf("VerifyInclusion failed: %v", err)
+	}
+	if err := client.VerifyInclusion(entry("user3@example.com", 4), &inclusion); err != ErrInvalidProof {
+		t.Errorf("Wrong key included: %v", err)
+	}
+	entries, _ := log.Entries(0, head1.TreeSize)
+	if changes, err := monitor.Monitor(head1, entries); err != nil || len(changes) != 0 {
+		t.Errorf("Monitor = %v, %v", changes, err)
+	}
+
+	// The log grows; the client needs a consistency proof from its head
+	log.Append(entry("alice@example.com", 0xaa))
+	log.Append(entry("bob@example.com", 0xbb))
+	log.Append(entry("alice@example.com", 0xee))
+	head2, _ := log.TreeHead(logKey)
+	if err := client.Update(head2, nil); !errors.Is(err, ErrInconsistentLog) {
+		t.Errorf("Update without proof = %v", err)
+	}
+	proof, _ = log.ProveConsistency(head1.TreeSize)
+	if err := client.Update(head2, &proof); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if client.TreeHead().TreeSize != 8 {
+		t.Errorf("Client head has %d entries", client.TreeHead().TreeSize)
+	}
+	latest, index, ok := log.Lookup("alice@example.com")
+	inclusion, _ = log.Prove(index)
+	if !ok || client.VerifyInclusion(latest, &inclusion) != nil {
+		t.Error("Latest alice entry not verified")
+	}
+
+	// The monitor sees every new entry and flags the unexpected alice key
+	entries, _ = log.Entries(head1.TreeSize, head2.TreeSize)
+	if _, err := monitor.Monitor(head2, entries[1:]); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Monitor with missing entries = %v", err)
+	}
+	tampered := append([]KeyLogEntry(nil), entries...)
+	tampered[2] = entry("alice@example.com", 0xaa)
+	if _, err := monitor.Monitor(head2, tampered); !errors.Is(err, ErrInconsistentLog) {
+		t.Errorf("Monitor with tampered entries = %v", err)
+	}
+	changes, err := monitor.Monitor(head2, entries)
+	if err != nil || len(changes) != 1 || changes[0].Index != 7 || changes[0].Observed[0] != 0xee {
+		t.Errorf("Monitor = %+v, %v", changes, err)
+	}
+
+	// A fork presenting another history for the same size is detected
+	fork := NewKeyLog()
+	forkEntries, _ := log.Entries(0, 7)
+	for _, e := range forkEntries {
+		fork.Append(e)
+	}
+	fork.Append(entry("alice@example.com", 0xaa))
+	forkHead, _ := fork.TreeHead(logKey)
+	forkProof, _ := fork.ProveConsistency(head1.TreeSize)
+	if err := client.Update(forkHead, &forkProof); !errors.Is(err, ErrInconsistentLog) {
+		t.Errorf("Fork accepted: %v", err)
+	}
+
+	other, _ := GenerateXMSSKey(XMSSParams{Height: 2, WOTS: DefaultWOTSParams()}, nil)
+	untrusted, _ := log.TreeHead(other)
+	if err := client.Update(untrusted, nil); err != ErrUntrustedSigner {
+		t.Errorf("Expected ErrUntrustedSigner, got %v", err)
+	}
+	head2.Root[0] ^= 1
+	if err := client.Update(head2, nil); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+// Test BIP-32 style path derivation
+func TestDeriveAtPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"m":                   "m",
+		"m/44'/0'/0'/0/5":     "m/44'/0'/0'/0/5",
+		"m/44h/1H/2147483647": "m/44'/1'/2147483647",
+	} {
+		parsed, err := ParseDerivationPath(path)
+		if err != nil || parsed.String() != want {
+			t.Errorf("ParseDerivationPath(%q) = %v, %v", path, parsed, err)
+		}
+	}
+	for _, path := range []string{"", "M/0", "m/", "m/01", "m/-1", "m/+1", "m/2147483648", "m/1''", "/0", "m/x"} {
+		if _, err := ParseDerivationPath(path); err != ErrInvalidDerivationPath {
+			t.Errorf("ParseDerivationPath(%q) = %v", path, err)
+		}
+	}
+	if _, err := ParseDerivationPath("m" + strings.Repeat("/0", MaxHDDepth+1)); err != ErrInvalidDerivationPath {
+		t.Errorf("Expected ErrInvalidDerivationPath for a deep path, got %v", err)
+	}
+
+	seed := bytes.Repeat([]byte{0x42}, MinSeedSize)
+	masterPrivate, masterPublic, err := DeriveAtPath(seed, "m")
+	if err != nil {
+		t.Fatalf("DeriveAtPath(m) failed: %v", err)
+	}
+	seedPrivate, seedPublic, _ := GenerateKeyPairFromSeed(seed)
+	if masterPrivate != seedPrivate || masterPublic != seedPublic {
+		t.Error("Master key differs from GenerateKeyPairFromSeed")
+	}
+
+	privateKey, publicKey, err := DeriveAtPath(seed, "m/44'/7'/0'/0/1")
+	if err != nil {
+		t.Fatalf("DeriveAtPath failed: %v", err)
+	}
+	if !VerifyKeyPair(privateKey, publicKey) {
+		t.Error("Derived pair doesn't match")
+	}
+
+	// Step-by-step derivation matches, and hardened and normal indices differ
+	master, _ := NewMasterKey(seed)
+	account, _ := master.Derive(DerivationPath{44 + HardenedKeyStart, 7 + HardenedKeyStart, HardenedKeyStart})
+	change, _ := account.Child(0)
+	leaf, _ := change.Child(1)
+	if leaf.PrivateKey != privateKey || leaf.Depth != 5 || leaf.Index != 1 {
+		t.Errorf("Step-by-step derivation differs: depth %d index %d", leaf.Depth, leaf.Index)
+	}
+	hardened, _ := change.Child(1 + HardenedKeyStart)
+	if hardened.PrivateKey == leaf.PrivateKey {
+		t.Error("Hardened and normal children are equal")
+	}
+	if master.Depth != 0 || master.PrivateKey != seedPrivate {
+		t.Error("Derive modified the parent key")
+	}
+	if _, _, err := DeriveAtPath(seed[:MinSeedSize-1], "m/0"); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize for a short seed, got %v", err)
+	}
+}
+
+// Test the revocation and key age policy of EncryptWithPolicy
+func TestEncryptWithPolicy(t *testing.T) {
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEMKeyGen failed: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	revoked := map[Hash]bool{}
+	var checkErr error
+	policy := &EncryptPolicy{
+		CheckRevocation: func(ctx context.Context, keyID Hash) (bool, error) {
+			return revoked[keyID], checkErr
+		},
+		MaxKeyAge: 30 * 24 * time.Hour,
+		Clock:     func() time.Time { return now },
+	}
+	ctx := context.Background()
+	recipient := RecipientKey{PublicKey: publicKey, IssuedAt: now.Add(-24 * time.Hour)}
+
+	box, err := EncryptWithPolicy(ctx, recipient, []byte("policy checked"), policy)
+	if err != nil {
+		t.Fatalf("EncryptWithPolicy failed: %v", err)
+	}
+	if plaintext, err := Decrypt(secretKey, box); err != nil || string(plaintext) != "policy checked" {
+		t.Errorf("Decrypt = %q, %v", plaintext, err)
+	}
+	if _, err := EncryptWithPolicy(ctx, recipient, nil, nil); err != nil {
+		t.Errorf("Nil policy refused: %v", err)
+	}
+
+	stale := RecipientKey{PublicKey: publicKey, IssuedAt: now.Add(-31 * 24 * time.Hour)}
+	if _, err := EncryptWithPolicy(ctx, stale, nil, policy); err != ErrKeyTooOld {
+		t.Errorf("Expected ErrKeyTooOld, got %v", err)
+	}
+	if _, err := EncryptWithPolicy(ctx, RecipientKey{PublicKey: publicKey}, nil, policy); err != ErrKeyTooOld {
+		t.Errorf("Expected ErrKeyTooOld for unknown age, got %v", err)
+	}
+
+	revoked[KEMKeyID(publicKey)] = true
+	if _, err := EncryptWithPolicy(ctx, recipient, nil, policy); err != ErrKeyRevoked {
+		t.Errorf("Expected ErrKeyRevoked, got %v", err)
+	}
+	revoked = map[Hash]bool{}
+	checkErr = errors.New("revocation service unavailable")
+	if _, err := EncryptWithPolicy(ctx, recipient, nil, policy); err != checkErr {
+		t.Errorf("Checker error not returned: %v", err)
+	}
+}
+
+// Test hybrid Ed25519 + hash-based signatures
+func TestHybridSignature(t *testing.T) {
+	signer, err := NewHybridSigner()
+	if err != nil {
+		t.Fatalf("NewHybridSigner failed: %v", err)
+	}
+	defer signer.Wipe()
+	publicKey := signer.PublicKey()
+	message := []byte("transition period transfer")
+
+	signature, err := signer.Sign(message)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !VerifyHybrid(publicKey, message, signature) {
+		t.Fatal("Valid hybrid signature rejected")
+	}
+	if VerifyHybrid(publicKey, []byte("other message"), signature) {
+		t.Error("Signature verified for another message")
+	}
+
+	// Each half is required
+	for _, offset := range []int{0, ed25519.SignatureSize + 100} {
+		tampered := signature
+		tampered[offset] ^= 1
+		if VerifyHybrid(publicKey, message, tampered) {
+			t.Errorf("Signature tampered at %d verified", offset)
+		}
+	}
+
+	// The payload binds the hybrid key, so a plain Ed25519 signature of the
+	// message can't stand in for the classical half
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	classical := ed25519.NewKeyFromSeed(seed)
+	pqPrivate, _, _ := GenerateKeyPair()
+	combined, err := HybridSignerFromKeys(classical, pqPrivate)
+	if err != nil {
+		t.Fatalf("HybridSignerFromKeys failed: %v", err)
+	}
+	combinedSignature, _ := combined.Sign(message)
+	if !bytes.Equal(combined.PublicKey().Ed25519PublicKey(), classical.Public().(ed25519.PublicKey)) ||
+		combined.PublicKey().PublicKey() != DerivePublicKey(pqPrivate) {
+		t.Error("Hybrid public key doesn't hold the component keys")
+	}
+	forged := combinedSignature
+	copy(forged[:], ed25519.Sign(classical, message))
+	if VerifyHybrid(combined.PublicKey(), message, forged) {
+		t.Error("Signature over the bare message verified")
+	}
+	if _, err := HybridSignerFromKeys(classical[:10], pqPrivate); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize, got %v", err)
+	}
+
+	parsedKey, err := HybridSignaturePublicKeyFromBytes(publicKey.Bytes())
+	if err != nil || parsedKey != publicKey {
+		t.Errorf("Public key round trip failed: %v", err)
+	}
+	parsedSignature, err := HybridSignatureFromBytes(signature.Bytes())
+	if err != nil || parsedSignature != signature {
+		t.Errorf("Signature round trip failed: %v", err)
+	}
+	if _, err := HybridSignatureFromBytes(signature[:10]); err != ErrInvalidSignatureSize {
+		t.Errorf("Expected ErrInvalidSignatureSize, got %v", err)
+	}
+}
+
+// Test watch-only KEM key derivation
+func TestWatchOnlyKEMDerivation(t *testing.T) {
+	if _, err := NewMasterKEMKey(make([]byte, MinSeedSize-1)); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize for a short seed, got %v", err)
+	}
+
+	seed := bytes.Repeat([]byte{0x42}, MinSeedSize)
+	master, err := NewMasterKEMKey(seed)
+	if err != nil {
+		t.Fatalf("NewMasterKEMKey failed: %v", err)
+	}
+	defer master.Wipe()
+	account, err := master.Derive(DerivationPath{44 + HardenedKeyStart, HardenedKeyStart})
+	if err != nil {
+		t.Fatalf("Hardened derivation failed: %v", err)
+	}
+	if account.Offsets != 0 || account.Depth != 2 {
+		t.Errorf("Hardened child has depth %d offsets %d", account.Depth, account.Offsets)
+	}
+
+	// The extended public key survives encoding and derives the same
+	// children as the private key
+	xpub, err := ExtendedKEMPublicKeyFromBytes(account.Extended().Bytes())
+	if err != nil {
+		t.Fatalf("ExtendedKEMPublicKeyFromBytes failed: %v", err)
+	}
+	if *xpub != *account.Extended() {
+		t.Error("Extended public key changed in encoding")
+	}
+	seen := make(map[KEMPublicKey]bool)
+	for index := uint32(0); index < 4; index++ {
+		path := DerivationPath{index % 2, index}
+		watchOnly, err := xpub.Derive(path)
+		if err != nil {
+			t.Fatalf("Watch-only derivation of %v failed: %v", path, err)
+		}
+		private, err := account.Derive(path)
+		if err != nil {
+			t.Fatalf("Private derivation of %v failed: %v", path, err)
+		}
+		if watchOnly.PublicKey != private.PublicKey() || *watchOnly != *private.Extended() {
+			t.Fatalf("Watch-only and private derivation of %v differ", path)
+		}
+		if seen[watchOnly.PublicKey] || watchOnly.PublicKey == xpub.PublicKey {
+			t.Fatalf("Derivation of %v repeated a key", path)
+		}
+		seen[watchOnly.PublicKey] = true
+
+		// Secrets with the maximum offsets still decapsulate reliably
+		for i := 0; i < 8; i++ {
+			ciphertext, sharedSecret, err := KEMEncapsulate(watchOnly.PublicKey)
+			if err != nil {
+				t.Fatalf("KEMEncapsulate failed: %v", err)
+			}
+			decapsulated, err := private.Decapsulate(ciphertext)
+			if err != nil || decapsulated != sharedSecret {
+				t.Fatalf("Decapsulation with the key at %v failed: %v", path, err)
+			}
+		}
+		if _, err := master.Decapsulate(mustEncapsulate(t, watchOnly.PublicKey)); err != ErrWrongRecipient {
+			t.Errorf("Expected ErrWrongRecipient, got %v", err)
+		}
+		private.Wipe()
+	}
+
+	if _, err := xpub.Child(HardenedKeyStart); err != ErrHardenedDerivation {
+		t.Errorf("Expected ErrHardenedDerivation, got %v", err)
+	}
+	if _, err := xpub.Derive(DerivationPath{0, 0, 0}); !errors.Is(err, ErrInvalidDerivationPath) {
+		t.Errorf("Expected ErrInvalidDerivationPath past MaxWatchOnlyDerivations, got %v", err)
+	}
+
+	// A hardened child resets the offsets
+	deep, err := account.Derive(DerivationPath{0, 0, HardenedKeyStart, 0})
+	if err != nil || deep.Offsets != 1 {
+		t.Fatalf("Derivation after a hardened child failed: %v", err)
+	}
+	deep.Wipe()
+
+	encoded := xpub.Bytes()
+	encoded[1] = MaxWatchOnlyDerivations + 1
+	if _, err := ExtendedKEMPublicKeyFromBytes(encoded); err != ErrInvalidDerivationPath {
+		t.Errorf("Expected ErrInvalidDerivationPath for excess offsets, got %v", err)
+	}
+	if _, err := ExtendedKEMPublicKeyFromBytes(encoded[:10]); err != ErrInvalidKeySize {
+		t.Errorf("Expected ErrInvalidKeySize, got %v", err)
+	}
+}
+
+// mustEncapsulate returns a ciphertext encapsulated to publicKey
+func mustEncapsulate(t *testing.T, publicKey KEMPublicKey) Ciphertext {
+	t.Helper()
+	ciphertext, _, err := KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("KEMEncapsulate failed: %v", err)
+	}
+	return ciphertext
+}
+
+// Test PEM and DER key encodings
+func TestPEMEncoding(t *testing.T) {
+	privateKey, publicKey, _ := GenerateKeyPair()
+	kemPublic, kemSecret, _ := KEMKeyGen()
+	blockTypes := map[string]string{}
+
+	var bundle []byte
+	for _, key := range []any{privateKey, publicKey, kemSecret, kemPublic} {
+		encoded, err := MarshalPEM(key)
+		if err != nil {
+			t.Fatalf("MarshalPEM(%T) failed: %v", key, err)
+		}
+		blockTypes[fmt.Sprintf("%T", key)] = strings.SplitN(string(encoded), "\n", 2)[0]
+		bundle = append(bundle, encoded...)
+
+		der, _ := MarshalDER(key)
+		parsed, err := ParseDER(der)
+		if err != nil || parsed != key {
+			t.Errorf("DER round trip of %T failed: %v", key, err)
+		}
+	}
+	if len(blockTypes) != 4 || blockTypes["topayz512.KEMSecretKey"] != "-----BEGIN "+PEMKEMSecretKey+"-----" {
+		t.Errorf("Unexpected block types %v", blockTypes)
+	}
+
+	// A bundle parses block by block, in order
+	rest := bundle
+	for _, want := range []any{privateKey, publicKey, kemSecret, kemPublic} {
+		var key any
+		var err error
+		key, rest, err = ParsePEM(rest)
+		if err != nil || key != want {
+			t.Fatalf("ParsePEM for %T failed: %v", want, err)
+		}
+	}
+	if _, _, err := ParsePEM(rest); err != ErrInvalidKeyEncoding {
+		t.Errorf("Expected ErrInvalidKeyEncoding after the last block, got %v", err)
+	}
+
+	// Pointers encode like values, and generic block types are accepted
+	der, _ := MarshalDER(&publicKey)
+	generic := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if key, _, err := ParsePEM(generic); err != nil || key != publicKey {
+		t.Errorf("Generic PUBLIC KEY block failed: %v", err)
+	}
+	wrongType := pem.EncodeToMemory(&pem.Block{Type: PEMKEMPublicKey, Bytes: der})
+	if _, _, err := ParsePEM(wrongType); err != ErrInvalidKeyEncoding {
+		t.Errorf("Expected ErrInvalidKeyEncoding for a mismatched block type, got %v", err)
+	}
+
+	if _, err := MarshalDER("key"); err != ErrUnsupportedKeyType {
+		t.Errorf("Expected ErrUnsupportedKeyType, got %v", err)
+	}
+	for _, bad := range [][]byte{nil, {0x30, 0x00}, der[:len(der)-1], append(append([]byte(nil), der...), 0)} {
+		if _, err := ParseDER(bad); err != ErrInvalidKeyEncoding {
+			t.Errorf("ParseDER(%x...) = %v", bad[:min(len(bad), 8)], err)
+		}
+	}
+	// Another algorithm's OID is rejected
+	der, _ = MarshalDER(kemPublic)
+	der[bytes.Index(der, oidKEM)+len(oidKEM)-1] = 3
+	if _, err := ParseDER(der); err != ErrInvalidKeyEncoding {
+		t.Errorf("Expected ErrInvalidKeyEncoding for an unknown OID, got %v", err)
+	}
+	var invalid KEMPublicKey
+	for i := range invalid {
+		invalid[i] = 0xff
+	}
+	der, _ = MarshalDER(invalid)
+	if _, err := ParseDER(der); err != ErrInvalidKEMPublicKey {
+		t.Errorf("Expected ErrInvalidKEMPublicKey, got %v", err)
+	}
+}
+
+// Test loading and applying policy files
+func TestLoadPolicy(t *testing.T) {
+	auditPath := t.TempDir() + "/kem.jsonl"
+	policy, err := LoadPolicy(strings.NewReader(`{
+  "version": 1,
+  "algorithms": ["topayz512-kem", "xmss"],
+  "parameter_sets": ["` + ParameterSet() + `"],
+  "password": {"min_iterations": 3, "min_memory": 65536, "min_parallelism": 4},
+  "worker_pool_size": 2,
+  "logging": {"kem_audit": "file:` + auditPath + `"}
+}`))
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+	if !policy.Allows(AlgorithmKEM) || policy.Allows(AlgorithmMLKEM768) {
+		t.Error("Allows doesn't follow the algorithm list")
+	}
+	if err := policy.CheckAlgorithm(AlgorithmPlaceholder); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Expected ErrPolicyViolation, got %v", err)
+	}
+
+	weak := PasswordParams{Algorithm: PasswordArgon2id, Iterations: 1, Memory: 65536, Parallelism: 4, Salt: make([]byte, MinPasswordSaltSize)}
+	if err := policy.CheckPasswordParams(weak); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Expected ErrPolicyViolation for a weak derivation, got %v", err)
+	}
+	if err := policy.CheckPasswordParams(PasswordParams{Algorithm: PasswordHashLoop, Iterations: 100000}); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Expected ErrPolicyViolation for the hash loop, got %v", err)
+	}
+	params, err := policy.NewPasswordParams()
+	if err != nil || policy.CheckPasswordParams(params) != nil {
+		t.Errorf("Policy password parameters don't satisfy the policy: %v", err)
+	}
+
+	// Apply turns on strict mode, resizes the pool and logs KEM operations
+	restore, err := policy.Apply()
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !StrictMode() || CurrentRuntimeState().WorkerPoolSize != 2 {
+		t.Error("Apply didn't install strict mode and the pool size")
+	}
+	KEMKeyGen()
+	restore()
+	if StrictMode() || CurrentRuntimeState().WorkerPoolSize == 2 {
+		t.Error("restore didn't undo the policy")
+	}
+	logged, _ := os.ReadFile(auditPath)
+	var event KEMAuditEvent
+	if err := json.Unmarshal(logged, &event); err != nil || event.Operation != KEMOpKeyGen {
+		t.Errorf("Audit sink holds %q: %v", logged, err)
+	}
+
+	// Errors name the position or the field at fault
+	for input, want := range map[string]string{
+		"": "empty policy",
+		"{\n  \"version\": 1,\n  \"algorithms\": [\"xmss\",]\n}": "line 3, column 26",
+		`{"version": 1, "colour": "blue"}`:                       `unknown field "colour"`,
+		`{"version": "1"}`:                                       "version must be int",
+		`{"version": 2}`:                                         "version: unsupported version 2",
+		`{"version": 1, "algorithms": ["rsa"]}`:                  `algorithms[0]: unknown algorithm "rsa"`,
+		`{"version": 1, "parameter_sets": ["other"]}`:            "parameter_sets:",
+		`{"version": 1, "worker_pool_size": -1}`:                 "worker_pool_size:",
+		`{"version": 1, "logging": {"kem_audit": "syslog"}}`:     `logging.kem_audit: unknown sink "syslog"`,
+		`{"version": 1} {}`:                                      "data after the policy object",
+	} {
+		_, err := LoadPolicy(strings.NewReader(input))
+		if !errors.Is(err, ErrInvalidPolicy) || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadPolicy(%q) = %v, want %q", input, err, want)
+		}
+	}
+}
+
+// Test PrivateKey as a crypto.Signer
+func TestCryptoSigner(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	var signer crypto.Signer = privateKey
+	if !publicKey.Equal(signer.Public()) {
+		t.Error("Public doesn't return the key pair's public key")
+	}
+
+	message := []byte("signed through crypto.Signer")
+	signed, err := signer.Sign(nil, message, crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	signature, err := SignatureFromBytes(signed)
+	if err != nil || !Verify(publicKey, message, signature) {
+		t.Errorf("crypto.Signer signature doesn't verify: %v", err)
+	}
+	if direct, _ := Sign(privateKey, message); !bytes.Equal(direct[:], signed) {
+		t.Error("crypto.Signer signature differs from Sign")
+	}
+	if _, err := signer.Sign(nil, message, nil); err != nil {
+		t.Errorf("Sign with nil options failed: %v", err)
+	}
+	digest := sha256.Sum256(message)
+	if _, err := signer.Sign(nil, digest[:], crypto.SHA256); err != ErrUnsupportedHash {
+		t.Errorf("Expected ErrUnsupportedHash, got %v", err)
+	}
+
+	other, otherPublic, _ := GenerateKeyPair()
+	if !privateKey.Equal(privateKey) || privateKey.Equal(other) || privateKey.Equal(&privateKey) {
+		t.Error("PrivateKey.Equal is wrong")
+	}
+	if publicKey.Equal(otherPublic) || publicKey.Equal(publicKey[:]) {
+		t.Error("PublicKey.Equal is wrong")
+	}
+}
+
+// Test HashState as a hash.Hash
+func TestHashStateHashInterface(t *testing.T) {
+	data := bytes.Repeat([]byte("TOPAY-Z512 hash.Hash "), 50)
+	want := ComputeHash(data)
+
+	var h hash.Hash = NewHashState()
+	if h.Size() != HashSize || h.BlockSize() != 128 {
+		t.Errorf("Size %d, BlockSize %d", h.Size(), h.BlockSize())
+	}
+	if n, err := io.Copy(h, bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatalf("io.Copy wrote %d bytes: %v", n, err)
+	}
+	prefix := []byte("prefix")
+	sum := h.Sum(prefix)
+	if !bytes.Equal(sum[:len(prefix)], prefix) || !bytes.Equal(sum[len(prefix):], want[:]) {
+		t.Error("Sum doesn't append the hash")
+	}
+
+	// Sum leaves the state open for more writes
+	h.Write([]byte("more"))
+	if more := ComputeHash(append(append([]byte{}, data...), "more"...)); !bytes.Equal(h.Sum(nil), more[:]) {
+		t.Error("Sum changed the state")
+	}
+	h.Reset()
+	if empty := ComputeHash(nil); !bytes.Equal(h.Sum(nil), empty[:]) {
+		t.Error("Reset didn't restart the hash")
+	}
+
+	// Two states fed through io.MultiWriter agree
+	a, b := NewHashState(), NewHashState()
+	io.Copy(io.MultiWriter(a, b), bytes.NewReader(data))
+	if a.Finalize() != want || b.Finalize() != want {
+		t.Error("io.MultiWriter hashes differ")
+	}
+}
+
+// raceEnabled is set by race_test.go; the race detector adds allocations
+var raceEnabled bool
+
+// allocationBudgets are the baseline allocations per call of the hot paths.
+// Lower a budget when an optimization removes allocations; raising one needs
+// a reason in the commit that does it.
+var allocationBudgets = []struct {
+	name   string
+	allocs float64
+	setup  func() func()
+}{
+	{"ComputeHash/1KiB", 0, func() func() {
+		data := make([]byte, 1024)
+		return func() { ComputeHash(data) }
+	}},
+	{"KEMKeyGen", 50, func() func() {
+		return func() { KEMKeyGen() }
+	}},
+	{"KEMEncapsulate", 34, func() func() {
+		publicKey, _, _ := KEMKeyGen()
+		return func() { KEMEncapsulate(publicKey) }
+	}},
+	{"KEMDecapsulate", 73, func() func() {
+		publicKey, secretKey, _ := KEMKeyGen()
+		ciphertext, _, _ := KEMEncapsulate(publicKey)
+		return func() { KEMDecapsulate(secretKey, ciphertext) }
+	}},
+	{"FragmentData/4KiB", 17, func() func() {
+		data := make([]byte, 4096)
+		return func() { FragmentData(data) }
+	}},
+	{"SerializeFragment", 1, func() func() {
+		result, _ := FragmentData(make([]byte, 4096))
+		return func() { SerializeFragment(result.Fragments[0]) }
+	}},
+	{"DeserializeFragment", 1, func() func() {
+		result, _ := FragmentData(make([]byte, 4096))
+		serialized := SerializeFragment(result.Fragments[0])
+		return func() { DeserializeFragment(serialized) }
+	}},
+	{"ReconstructData/4KiB", 2, func() func() {
+		result, _ := FragmentData(make([]byte, 4096))
+		return func() { ReconstructData(result.Fragments) }
+	}},
+}
+
+// Test that hot paths don't allocate more than their baselines
+func TestAllocationBudgets(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector changes allocation counts")
+	}
+	for _, budget := range allocationBudgets {
+		t.Run(budget.name, func(t *testing.T) {
+			allocs := testing.AllocsPerRun(20, budget.setup())
+			if allocs > budget.allocs {
+				t.Errorf("%v allocations per call, budget %v", allocs, budget.allocs)
+			}
+		})
+	}
+}
+
+// Test the legacy SHA3-512 hash against the FIPS 202 "abc" vector
+func TestLegacySHA3Hash(t *testing.T) {
+	h := NewLegacySHA3Hash()
+	h.Write([]byte("ab"))
+	h.Sum(nil)
+	h.Write([]byte("c"))
+	want := "b751850b1a57168a5693cd924b6b096e08f621827444f70d884f5d0240d2712e10e116e9192af3c91a7ec57647e3934057340b4cf408d5a56592f8274eec53f0"
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Errorf("SHA3-512(abc) = %s", got)
+	}
+	if h.Size() != 64 || h.BlockSize() != 72 {
+		t.Errorf("Size %d, BlockSize %d", h.Size(), h.BlockSize())
+	}
+}
+
+// Test HMAC-Z512 against crypto/hmac over HashState
+func TestMAC(t *testing.T) {
+	data := bytes.Repeat([]byte("authenticated message "), 20)
+	for _, key := range [][]byte{nil, []byte("short key"), bytes.Repeat([]byte{0x0b}, 200)} {
+		reference := hmac.New(func() hash.Hash { return NewHashState() }, key)
+		reference.Write(data)
+		want := reference.Sum(nil)
+
+		tag := MAC(key, data)
+		if !bytes.Equal(tag[:], want) {
+			t.Errorf("MAC with a %d-byte key differs from crypto/hmac", len(key))
+		}
+
+		m := NewMAC(key)
+		m.Write(data[:7])
+		m.Sum(nil)
+		m.Write(data[7:])
+		if !bytes.Equal(m.Sum(nil), want) {
+			t.Errorf("NewMAC with a %d-byte key differs from crypto/hmac", len(key))
+		}
+		m.Reset()
+		m.Write(data)
+		if !bytes.Equal(m.Sum(nil), want) || m.Size() != HashSize || m.BlockSize() != 128 {
+			t.Error("NewMAC Reset or sizes are wrong")
+		}
+
+		if !VerifyMAC(key, data, tag[:]) {
+			t.Error("VerifyMAC rejected a valid tag")
+		}
+		tag[0] ^= 1
+		if VerifyMAC(key, data, tag[:]) || VerifyMAC(key, data, want[:HashSize-1]) {
+			t.Error("VerifyMAC accepted a wrong tag")
+		}
+	}
+	if MAC([]byte("key"), data) == HashWithSalt(data, []byte("key")) {
+		t.Error("MAC is the salted hash")
+	}
+}
+
+// Test domain-separated hashing
+func TestHashWithDomain(t *testing.T) {
+	data := []byte("object bytes")
+	header := HashWithDomain("example/v1/header", data)
+	if header == HashWithDomain("example/v1/body", data) || header == ComputeHash(data) {
+		t.Error("Domains don't separate hashes")
+	}
+	if header != ComputePersonalizedHash([]byte("example/v1/header"), data) {
+		t.Error("HashWithDomain differs from the personalized hash")
+	}
+	if HashWithDomain("", data) != ComputeHash(data) {
+		t.Error("Empty domain isn't the standard hash")
+	}
+
+	hasher := NewHasher("example/v1/header")
+	if hasher.Domain() != "example/v1/header" || hasher.Hash(data) != header {
+		t.Error("Hasher differs from HashWithDomain")
+	}
+	stream := hasher.New()
+	defer stream.Close()
+	stream.Write(data[:6])
+	stream.Write(data[6:])
+	if stream.Sum() != header {
+		t.Error("Streaming Hasher differs")
+	}
+	stream.Reset()
+	stream.Write(data)
+	if stream.Sum() != header {
+		t.Error("Reset dropped the domain")
+	}
+
+	// Pooled states don't keep the domain after use
+	if ComputeHash(data) != HashWithDomain("", data) {
+		t.Error("Domain leaked into the pool")
+	}
+
+	if hasher.HashFields([]byte("ab"), []byte("c")) == hasher.HashFields([]byte("a"), []byte("bc")) {
+		t.Error("HashFields is ambiguous")
+	}
+	if hasher.HashFields([]byte("ab")) == NewHasher("other").HashFields([]byte("ab")) {
+		t.Error("HashFields ignores the domain")
+	}
+}
+
+// Test the Committer implementations and fragmentation with them
+func TestCommitters(t *testing.T) {
+	data := bytes.Repeat([]byte("committed data "), 1000)
+	key := []byte("commitment key")
+	macCommitter := NewMACCommitter(key)
+	defer macCommitter.Wipe()
+
+	committers := map[string]Committer{
+		"z512":   Z512Committer{},
+		"mac":    macCommitter,
+		"merkle": MerkleCommitter{ChunkSize: 1024},
+	}
+	for name, committer := range committers {
+		commitment := committer.Commit(data)
+		if len(commitment) != HashSize || !committer.Verify(data, commitment) {
+			t.Errorf("%s: commitment doesn't verify", name)
+		}
+		modified := append([]byte{}, data...)
+		modified[len(modified)-1] ^= 1
+		if committer.Verify(modified, commitment) || committer.Verify(data, commitment[:HashSize-1]) {
+			t.Errorf("%s: verified modified data or a short commitment", name)
+		}
+
+		result, err := FragmentDataWithCommitter(data, committer)
+		if err != nil {
+			t.Fatalf("%s: FragmentDataWithCommitter failed: %v", name, err)
+		}
+		for _, fragment := range result.Fragments {
+			if err := ValidateFragmentIntegrityWithCommitter(fragment, committer); err != nil {
+				t.Errorf("%s: fragment %d: %v", name, fragment.Index, err)
+			}
+		}
+		reconstructed, err := ReconstructDataWithCommitter(result.Fragments, committer)
+		if err != nil || !bytes.Equal(reconstructed.Data, data) {
+			t.Errorf("%s: ReconstructDataWithCommitter failed: %v", name, err)
+		}
+		result.Fragments[0].Data[0] ^= 1
+		if _, err := ReconstructDataWithCommitter(result.Fragments, committer); err != ErrReconstructionFailed {
+			t.Errorf("%s: expected ErrReconstructionFailed, got %v", name, err)
+		}
+	}
+
+	// Z512Committer gives the same checksums as plain fragmentation
+	plain, _ := FragmentData(data)
+	if err := ValidateFragmentIntegrityWithCommitter(plain.Fragments[0], Z512Committer{}); err != nil {
+		t.Errorf("Plain fragment doesn't verify with Z512Committer: %v", err)
+	}
+	if _, err := ReconstructDataWithCommitter(plain.Fragments, NewMACCommitter([]byte("other"))); err != ErrReconstructionFailed {
+		t.Errorf("Wrong MAC key: expected ErrReconstructionFailed, got %v", err)
+	}
+
+	// The Merkle root follows RFC 6962's tree shape
+	chunks := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	leaf := func(chunk []byte) Hash { return HashMultiple([]byte{0}, chunk) }
+	node := func(left, right Hash) Hash { return HashMultiple([]byte{1}, left[:], right[:]) }
+	want := node(node(leaf(chunks[0]), leaf(chunks[1])), leaf(chunks[2]))
+	if got := (MerkleCommitter{ChunkSize: 1}).Commit([]byte("abc")); !bytes.Equal(got, want[:]) {
+		t.Error("Merkle root has the wrong shape")
+	}
+
+	object := []byte("object content")
+	objectHash := HashObject(ObjectBlob, object)
+	if got := CommitObject(Z512Committer{}, nil, ObjectBlob, object); !bytes.Equal(got, objectHash[:]) {
+		t.Error("CommitObject with Z512Committer isn't the object hash")
+	}
+}
+
+// shortCommitter produces commitments fragments can't store
+type shortCommitter struct{}
+
+func (shortCommitter) Commit(data []byte) []byte           { return []byte{1} }
+func (shortCommitter) Verify(data, commitment []byte) bool { return true }
+
+// Test that fragments reject commitments of the wrong size
+func TestCommitterSize(t *testing.T) {
+	if _, err := FragmentDataWithCommitter([]byte("data"), shortCommitter{}); err != ErrInvalidHashSize {
+		t.Errorf("Expected ErrInvalidHashSize, got %v", err)
+	}
+}
+
+// Test use of secrets after erasure
+func TestErasedSecrets(t *testing.T) {
+	message := []byte("after erasure")
+
+	privateKey, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Key generation failed: %v", err)
+	}
+	SecureErasePrivateKey(&privateKey)
+	if _, err := Sign(privateKey, message); err != ErrKeyDestroyed {
+		t.Errorf("Sign with an erased key: expected ErrKeyDestroyed, got %v", err)
+	}
+
+	publicKey, secretKey, err := KEMKeyGen()
+	if err != nil {
+		t.Fatalf("KEM key generation failed: %v", err)
+	}
+	ciphertext, sharedSecret, err := KEMEncapsulate(publicKey)
+	if err != nil {
+		t.Fatalf("Encapsulation failed: %v", err)
+	}
+	SecureEraseKEMSecretKey(&secretKey)
+	if _, err := KEMDecapsulate(secretKey, ciphertext); err != ErrKeyDestroyed {
+		t.Errorf("KEMDecapsulate with an erased key: expected ErrKeyDestroyed, got %v", err)
+	}
+	if _, err := KEMDecapsulateWithContext(secretKey, ciphertext, message); err != ErrKeyDestroyed {
+		t.Errorf("KEMDecapsulateWithContext with an erased key: expected ErrKeyDestroyed, got %v", err)
+	}
+
+	aead, err := sharedSecret.NewAEAD(AEADInitiator, nil)
+	if err != nil {
+		t.Fatalf("NewAEAD failed: %v", err)
+	}
+	sealed, err := aead.Seal(message, nil)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	SecureEraseSharedSecret(&sharedSecret)
+	if _, err := sharedSecret.Derive(message, 32); err != ErrKeyDestroyed {
+		t.Errorf("Derive from an erased secret: expected ErrKeyDestroyed, got %v", err)
+	}
+	if _, err := sharedSecret.NewAEAD(AEADInitiator, nil); err != ErrKeyDestroyed {
+		t.Errorf("NewAEAD from an erased secret: expected ErrKeyDestroyed, got %v", err)
+	}
+	if aead.Erased() {
+		t.Error("AEAD reports erased before Wipe")
+	}
+	aead.Wipe()
+	if !aead.Erased() {
+		t.Error("AEAD doesn't report erased after Wipe")
+	}
+	if _, err := aead.Seal(message, nil); err != ErrKeyDestroyed {
+		t.Errorf("Seal after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+	if _, err := aead.Open(sealed, nil); err != ErrKeyDestroyed {
+		t.Errorf("Open after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+
+	hdKey, err := NewMasterKey(bytes.Repeat([]byte{7}, MinSeedSize))
+	if err != nil {
+		t.Fatalf("NewMasterKey failed: %v", err)
+	}
+	hdKey.Wipe()
+	if !hdKey.Erased() {
+		t.Error("HDKey doesn't report erased after Wipe")
+	}
+	if _, err := hdKey.Child(HardenedKeyStart); err != ErrKeyDestroyed {
+		t.Errorf("HDKey.Child after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+	if _, err := hdKey.Derive(DerivationPath{1}); err != ErrKeyDestroyed {
+		t.Errorf("HDKey.Derive after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+
+	hybridKEM, err := NewHybridKEM()
+	if err != nil {
+		t.Fatalf("NewHybridKEM failed: %v", err)
+	}
+	hybridCiphertext, _, err := HybridEncapsulate(hybridKEM.PublicKey())
+	if err != nil {
+		t.Fatalf("HybridEncapsulate failed: %v", err)
+	}
+	hybridKEM.Wipe()
+	if _, err := hybridKEM.Decapsulate(hybridCiphertext); err != ErrKeyDestroyed {
+		t.Errorf("HybridKEM.Decapsulate after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+
+	hybridSigner, err := NewHybridSigner()
+	if err != nil {
+		t.Fatalf("NewHybridSigner failed: %v", err)
+	}
+	hybridSigner.Wipe()
+	if _, err := hybridSigner.Sign(message); err != ErrKeyDestroyed {
+		t.Errorf("HybridSigner.Sign after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+
+	wotsKey, err := GenerateWOTSKey(DefaultWOTSParams())
+	if err != nil {
+		t.Fatalf("GenerateWOTSKey failed: %v", err)
+	}
+	wotsKey.Wipe()
+	if _, err := wotsKey.Sign(message); err != ErrKeyDestroyed {
+		t.Errorf("WOTSPrivateKey.Sign after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+
+	xmssKey, err := GenerateXMSSKey(XMSSParams{Height: 2, WOTS: DefaultWOTSParams()}, nil)
+	if err != nil {
+		t.Fatalf("GenerateXMSSKey failed: %v", err)
+	}
+	xmssKey.Wipe()
+	if !xmssKey.Erased() {
+		t.Error("XMSSPrivateKey doesn't report erased after Wipe")
+	}
+	if _, err := xmssKey.Sign(message); err != ErrKeyDestroyed {
+		t.Errorf("XMSSPrivateKey.Sign after Wipe: expected ErrKeyDestroyed, got %v", err)
+	}
+}
+
+// Test the algorithm registry
+func TestAlgorithmRegistry(t *testing.T) {
+	registered := Algorithms()
+	names := make(map[string]bool)
+	for i, algorithm := range registered {
+		if i > 0 && algorithm.ID <= registered[i-1].ID {
+			t.Errorf("%s isn't in ID order", algorithm.Name)
+		}
+		if names[algorithm.Name] {
+			t.Errorf("Name %q is registered twice", algorithm.Name)
+		}
+		names[algorithm.Name] = true
+
+		kinds := map[AlgorithmID][]AlgorithmKind{
+			0x01: {AlgorithmKindHash, AlgorithmKindMAC},
+			0x02: {AlgorithmKindSignature},
+			0x03: {AlgorithmKindKEM},
+			0x04: {AlgorithmKindEnvelope},
+		}
+		matches := false
+		for _, kind := range kinds[algorithm.ID>>8] {
+			matches = matches || kind == algorithm.Kind
+		}
+		if !matches {
+			t.Errorf("%s of kind %s has ID %s", algorithm.Name, algorithm.Kind, algorithm.ID)
+		}
+
+		byID, err := LookupAlgorithm(algorithm.ID)
+		if err != nil || byID != algorithm {
+			t.Errorf("LookupAlgorithm(%s) = %v, %v", algorithm.ID, byID.Name, err)
+		}
+		byName, err := LookupAlgorithmName(algorithm.Name)
+		if err != nil || byName != algorithm {
+			t.Errorf("LookupAlgorithmName(%q) = %v, %v", algorithm.Name, byName.Name, err)
+		}
+	}
+	for _, name := range policyAlgorithms {
+		if !names[name] {
+			t.Errorf("Policy algorithm %q isn't registered", name)
+		}
+	}
+
+	// The registry can't be modified through Algorithms
+	registered[0].Name = "changed"
+	if algorithm, _ := LookupAlgorithm(AlgorithmIDHash); algorithm.Name == "changed" {
+		t.Error("Algorithms returned the registry itself")
+	}
+
+	kem, _ := LookupAlgorithm(AlgorithmIDKEM)
+	if kem.Name != AlgorithmKEM || kem.PublicKeySize != KEMPublicKeySize || kem.CiphertextSize != CiphertextSize {
+		t.Errorf("KEM entry is wrong: %+v", kem)
+	}
+	if _, err := LookupAlgorithm(0x7fff); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+	if _, err := LookupAlgorithmName("rsa"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+
+	encoded := AppendAlgorithmID([]byte{}, AlgorithmIDXMSS)
+	encoded = append(encoded, "payload"...)
+	algorithm, rest, err := ReadAlgorithmID(encoded)
+	if err != nil || algorithm.ID != AlgorithmIDXMSS || string(rest) != "payload" {
+		t.Errorf("ReadAlgorithmID = %v, %q, %v", algorithm.Name, rest, err)
+	}
+	if _, _, err := ReadAlgorithmID([]byte{0x7f, 0xff}); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+	if _, _, err := ReadAlgorithmID([]byte{0x01}); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	text, err := json.Marshal(kem)
+	if err != nil || !strings.Contains(string(text), `"id":"topayz512-kem"`) {
+		t.Errorf("Algorithm JSON is %s, %v", text, err)
+	}
+	var ids []AlgorithmID
+	if err := json.Unmarshal([]byte(`["xmss", "65535"]`), &ids); err != nil || ids[0] != AlgorithmIDXMSS || ids[1] != 0xffff {
+		t.Errorf("Decoded IDs %v, %v", ids, err)
+	}
+	if err := json.Unmarshal([]byte(`["rsa"]`), &ids); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+	}
+}
+
+// Test pool statistics and queue depths
+func TestPoolStats(t *testing.T) {
+	bp := NewBytePool()
+	bp.Put(bp.Get(1000))
+	bp.Put(bp.Get(1000))
+	// sync.Pool may drop objects at any time, so the second Get can miss
+	stats := bp.Stats()
+	if stats.Gets != 2 || stats.Hits > 1 || stats.Puts != 2 || stats.HitRate() != float64(stats.Hits)/2 {
+		t.Errorf("Byte pool stats are %+v", stats)
+	}
+	if stats.BytesPooled != int64(2-stats.Hits)*1024 {
+		t.Errorf("Byte pool holds %d bytes after %d hits", stats.BytesPooled, stats.Hits)
+	}
+	if (PoolStats{}).HitRate() != 0 {
+		t.Error("Unused pool has a hit rate")
+	}
+
+	hsp := NewHashStatePool()
+	allocated := ReadPoolMetrics().HashStatesAllocated
+	hs := hsp.Get()
+	if ReadPoolMetrics().HashStatesAllocated != allocated+1 {
+		t.Error("Hash state allocation wasn't counted")
+	}
+	hsp.Put(hs)
+	if stats := hsp.Stats(); stats.Gets != 1 || stats.Puts != 1 {
+		t.Errorf("Hash state pool stats are %+v", stats)
+	}
+
+	wp := NewWorkerPool(1)
+	defer wp.Close()
+	started, release := make(chan struct{}), make(chan struct{})
+	wp.Submit(func() { close(started); <-release })
+	<-started
+	wp.Submit(func() {})
+	wp.Submit(func() {})
+	if depth := wp.QueueDepth(); depth != 2 {
+		t.Errorf("Queue depth is %d, want 2", depth)
+	}
+	close(release)
+}
+
+// Test the derandomized KEM entry points
+func TestDerandomizedKEM(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x3c}, KEMSecretKeySize)
+	publicKey, secretKey, err := KEMKeyGenFromSeed(seed)
+	if err != nil || !VerifyKEMKeyPair(publicKey, secretKey) || !bytes.Equal(secretKey[:], seed) {
+		t.Fatalf("KEMKeyGenFromSeed failed: %v", err)
+	}
+	if _, _, err := KEMKeyGenFromSeed(seed[:10]); !errors.Is(err, ErrInvalidKeySize) {
+		t.Errorf("Short seed: expected ErrInvalidKeySize, got %v", err)
+	}
+	if _, _, err := KEMKeyGenFromSeed(make([]byte, KEMSecretKeySize)); err != ErrInvalidKEMSecretKey {
+		t.Errorf("Zero seed: expected ErrInvalidKEMSecretKey, got %v", err)
+	}
+
+	message := bytes.Repeat([]byte{0xa5}, SharedSecretSize)
+	ciphertext1, sharedSecret1, err := KEMEncapsulateDerandomized(publicKey, message)
+	if err != nil {
+		t.Fatalf("KEMEncapsulateDerandomized failed: %v", err)
+	}
+	ciphertext2, sharedSecret2, _ := KEMEncapsulateDerandomized(publicKey, message)
+	if ciphertext1 != ciphertext2 || sharedSecret1 != sharedSecret2 {
+		t.Error("Derandomized encapsulation isn't deterministic")
+	}
+	if decapsulated, err := KEMDecapsulate(secretKey, ciphertext1); err != nil || decapsulated != sharedSecret1 {
+		t.Errorf("Derandomized ciphertext doesn't decapsulate: %v", err)
+	}
+	if _, _, err := KEMEncapsulateDerandomized(publicKey, message[:1]); !errors.Is(err, ErrInvalidKeySize) {
+		t.Errorf("Short message: expected ErrInvalidKeySize, got %v", err)
+	}
+}
+
+// Test streaming fragmentation
+func TestFragmenter(t *testing.T) {
+	// collect returns every fragment and the error ending the stream
+	collect := func(f *Fragmenter) ([]Fragment, error) {
+		var fragments []Fragment
+		for {
+			fragment, err := f.Next()
+			if err != nil {
+				return fragments, err
+			}
+			fragments = append(fragments, fragment)
+		}
+	}
+
+	for _, size := range []int{1, 100, 1000, 5000, FragmentSize*MaxFragments + 7} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		expected, err := FragmentData(data)
+		if err != nil {
+			t.Fatalf("FragmentData failed: %v", err)
+		}
+
+		f, err := NewFragmenter(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("NewFragmenter(%d bytes) failed: %v", size, err)
+		}
+		fragments, err := collect(f)
+		if err != io.EOF {
+			t.Fatalf("Stream of %d bytes ended with %v", size, err)
+		}
+		if len(fragments) != len(expected.Fragments) || f.Total() != uint32(len(fragments)) {
+			t.Fatalf("%d bytes gave %d fragments, want %d", size, len(fragments), len(expected.Fragments))
+		}
+		for i, fragment := range fragments {
+			want := expected.Fragments[i]
+			if fragment.ID != f.ID() || fragment.Index != want.Index || fragment.Total != want.Total ||
+				!bytes.Equal(fragment.Data, want.Data) || fragment.Checksum != want.Checksum {
+				t.Fatalf("Fragment %d of %d bytes differs from FragmentData", i, size)
+			}
+		}
+		metadata := f.Metadata()
+		if metadata.Checksum != expected.Metadata.Checksum || metadata.OriginalSize != uint64(size) {
+			t.Errorf("Metadata of %d bytes is wrong", size)
+		}
+		if _, err := f.Next(); err != io.EOF {
+			t.Errorf("Next after the end returned %v", err)
+		}
+	}
+
+	data := bytes.Repeat([]byte("stream"), 500)
+	path := filepath.Join(t.TempDir(), "payload")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.Seek(1000, io.SeekStart)
+	key := FragmentKey{1, 2, 3}
+	f, err := NewFragmenter(file, &FragmenterOptions{Key: &key})
+	if err != nil {
+		t.Fatalf("NewFragmenter(file) failed: %v", err)
+	}
+	fragments, err := collect(f)
+	if err != io.EOF {
+		t.Fatalf("File stream ended with %v", err)
+	}
+	result, err := ReconstructDataWithKey(fragments, &key)
+	if err != nil || !bytes.Equal(result.Data, data[1000:]) {
+		t.Errorf("Keyed stream doesn't reconstruct: %v", err)
+	}
+
+	f, _ = NewFragmenter(bytes.NewReader(data), &FragmenterOptions{Committer: MerkleCommitter{}})
+	fragments, _ = collect(f)
+	if result, err := ReconstructDataWithCommitter(fragments, MerkleCommitter{}); err != nil || !bytes.Equal(result.Data, data) {
+		t.Errorf("Committed stream doesn't reconstruct: %v", err)
+	}
+
+	// Readers that can't report their size need one
+	unsized := func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) }
+	if _, err := NewFragmenter(unsized(data), nil); err != ErrUnknownSize {
+		t.Errorf("Expected ErrUnknownSize, got %v", err)
+	}
+	if _, err := NewFragmenter(bytes.NewReader(nil), nil); err != ErrEmptyData {
+		t.Errorf("Expected ErrEmptyData, got %v", err)
+	}
+	var tooLarge *TooLargeError
+	if _, err := NewFragmenter(unsized(data), &FragmenterOptions{Size: MaxFragmentedDataSize + 1}); !errors.As(err, &tooLarge) {
+		t.Errorf("Expected TooLargeError, got %v", err)
+	}
+
+	f, _ = NewFragmenter(unsized(data), &FragmenterOptions{Size: int64(len(data)) + 1})
+	if _, err := collect(f); err != io.ErrUnexpectedEOF {
+		t.Errorf("Short reader: expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	f, _ = NewFragmenter(unsized(data), &FragmenterOptions{Size: int64(len(data)) - 1})
+	if _, err := collect(f); !errors.Is(err, ErrFragmentationFailed) {
+		t.Errorf("Long reader: expected ErrFragmentationFailed, got %v", err)
+	}
+}
+
+// Test the word-at-a-time operations, at unaligned offsets and with tails
+// shorter than a word, under whichever build tags the tests run with
+func TestWordOperations(t *testing.T) {
+	for _, n := range []int{0, 7, 8, 31, 32, 33, 100} {
+		buffer := make([]byte, 3*(n+1))
+		for i := range buffer {
+			buffer[i] = byte(i*37 + 11)
+		}
+		a, b := buffer[1:1+n], buffer[n+2:n+2+n]
+		dst := make([]byte, n+1)[1:]
+
+		VectorizedXOR(dst, a, b)
+		for i := range dst {
+			if dst[i] != a[i]^b[i] {
+				t.Fatalf("VectorizedXOR of %d bytes is wrong at %d", n, i)
+			}
+		}
+		VectorizedAND(dst, a, b)
+		for i := range dst {
+			if dst[i] != a[i]&b[i] {
+				t.Fatalf("VectorizedAND of %d bytes is wrong at %d", n, i)
+			}
+		}
+		VectorizedOR(dst, a, b)
+		for i := range dst {
+			if dst[i] != a[i]|b[i] {
+				t.Fatalf("VectorizedOR of %d bytes is wrong at %d", n, i)
+			}
+		}
+		FastMemCopy(dst, a)
+		if !bytes.Equal(dst, a) || !VectorizedConstantTimeEqual(dst, a) {
+			t.Fatalf("FastMemCopy of %d bytes is wrong", n)
+		}
+		if n > 0 {
+			dst[n-1] ^= 1
+			if VectorizedConstantTimeEqual(dst, a) {
+				t.Fatalf("VectorizedConstantTimeEqual missed a difference in the last of %d bytes", n)
+			}
+		}
+		FastMemSet(dst, 0xa7)
+		if !bytes.Equal(dst, bytes.Repeat([]byte{0xa7}, n)) {
+			t.Fatalf("FastMemSet of %d bytes is wrong", n)
+		}
+	}
+}
+
+// Test that the purego build tag leaves no library package importing unsafe.
+// termio needs unsafe to pass ioctl arguments for echo control and isn't
+// covered; commands and examples aren't part of the library.
+func TestPureGoBuild(t *testing.T) {
+	buildContext := build.Default
+	buildContext.BuildTags = append(buildContext.BuildTags, "purego")
+
+	err := filepath.WalkDir(".", func(path string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		switch path {
+		case "cmd", "examples", "termio", "testdata":
+			return filepath.SkipDir
+		}
+		pkg, err := buildContext.ImportDir(path, 0)
+		if _, ok := err.(*build.NoGoError); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, imported := range pkg.Imports {
+			if imported == "unsafe" {
+				t.Errorf("Package %s imports unsafe under the purego tag", path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingWriter fails every write after the first limit bytes
+type failingWriter struct {
+	limit int
+	bytes.Buffer
+}
+
+func (fw *failingWriter) Write(data []byte) (int, error) {
+	if fw.Len()+len(data) > fw.limit {
+		return 0, io.ErrShortWrite
+	}
+	return fw.Buffer.Write(data)
+}
+
+// Test streaming reconstruction to a writer
+func TestWriterReconstructor(t *testing.T) {
+	data := make([]byte, 6*FragmentSize+45)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+	key := FragmentKey{7}
+	result, err := FragmentDataWithKey(data, &key)
+	if err != nil {
+		t.Fatalf("Fragmentation failed: %v", err)
+	}
+	fragments := result.Fragments
+
+	var out bytes.Buffer
+	reconstructor := NewReconstructor(&out, &key)
+	defer reconstructor.Close()
+
+	// Fragments ahead of a gap wait until it fills
+	for _, step := range []struct {
+		index   int
+		written int
+	}{
+		{2, 0},
+		{1, 0},
+		{0, 3},
+		{0, 3},
+		{4, 3},
+		{3, 5},
+		{6, 5},
+		{5, 7},
+	} {
+		if _, err := reconstructor.Add(fragments[step.index]); err != nil {
+			t.Fatalf("Adding fragment %d failed: %v", step.index, err)
+		}
+		var expected int
+		for _, fragment := range fragments[:step.written] {
+			expected += len(fragment.Data)
+		}
+		if !bytes.Equal(out.Bytes(), data[:expected]) {
+			t.Fatalf("After fragment %d, %d bytes were written, want %d", step.index, out.Len(), expected)
+		}
+	}
+
+	reconstructed, err := reconstructor.Result()
+	if err != nil || !reconstructed.IsComplete || reconstructed.Data != nil {
+		t.Fatalf("Result failed: %v", err)
+	}
+	if reconstructed.Metadata.Checksum != result.Metadata.Checksum || reconstructed.Metadata.OriginalSize != uint64(len(data)) {
+		t.Error("Result metadata doesn't match the payload")
+	}
+	if again, _ := reconstructor.Result(); again.Metadata.Checksum != reconstructed.Metadata.Checksum {
+		t.Error("A second Result gave a different checksum")
+	}
+
+	// Corrupted fragments are refused before anything is written
+	out.Reset()
+	reconstructor = NewReconstructor(&out, &key)
+	corrupted := fragments[0]
+	corrupted.Data = append([]byte{corrupted.Data[0] ^ 1}, corrupted.Data[1:]...)
+	if _, err := reconstructor.Add(corrupted); err != ErrReconstructionFailed {
+		t.Errorf("Expected ErrReconstructionFailed, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Error("A corrupted fragment was written")
+	}
+
+	// Write errors are sticky
+	writer := &failingWriter{limit: len(fragments[0].Data)}
+	reconstructor = NewReconstructor(writer, &key)
+	if _, err := reconstructor.Add(fragments[0]); err != nil {
+		t.Fatalf("Adding fragment 0 failed: %v", err)
+	}
+	if _, err := reconstructor.Add(fragments[1]); err != io.ErrShortWrite {
+		t.Errorf("Expected io.ErrShortWrite, got %v", err)
+	}
+	writer.limit = len(data)
+	if _, err := reconstructor.Add(fragments[2]); err != io.ErrShortWrite {
+		t.Errorf("Write error wasn't sticky: %v", err)
+	}
+}
+
+// Test tolerant reconstruction with missing and corrupt fragments
+func TestPartialReconstruction(t *testing.T) {
+	data := make([]byte, 5*FragmentSize+100)
+	for i := range data {
+		data[i] = byte(i%251) + 1
+	}
+	result, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("FragmentData failed: %v", err)
+	}
+	fragments := result.Fragments
+	total := len(fragments)
+	size := len(fragments[0].Data)
+
+	complete, err := ReconstructPartial(fragments, nil)
+	if err != nil || !complete.IsComplete || !bytes.Equal(complete.Data, data) || complete.MissingIndices != nil {
+		t.Fatalf("Complete set: %v, %v", complete.MissingIndices, err)
+	}
+	if complete.Metadata.Checksum != ComputeHash(data) {
+		t.Error("Complete result lacks the payload checksum")
+	}
+
+	// Drop fragment 1, corrupt fragment 3 and duplicate fragment 2
+	corrupt := fragments[3]
+	corrupt.Data = append([]byte{0}, corrupt.Data[1:]...)
+	partialSet := []Fragment{fragments[4], fragments[0], corrupt, fragments[2], fragments[2]}
+	partialSet = append(partialSet, fragments[5:]...)
+	partial, err := ReconstructPartial(partialSet, &PartialOptions{Fill: 0xEE})
+	if err != nil {
+		t.Fatalf("ReconstructPartial failed: %v", err)
+	}
+	if partial.IsComplete || partial.MissingCount != 2 || fmt.Sprint(partial.MissingIndices) != "[1 3]" {
+		t.Fatalf("Missing %d %v, want [1 3]", partial.MissingCount, partial.MissingIndices)
+	}
+	if len(partial.Data) != len(data) || partial.Metadata.Checksum != (Hash{}) {
+		t.Errorf("Partial data is %d bytes, want %d without a checksum", len(partial.Data), len(data))
+	}
+	for index := 0; index < total; index++ {
+		chunk := partial.Data[index*size : min((index+1)*size, len(data))]
+		if index == 1 || index == 3 {
+			if !bytes.Equal(chunk, bytes.Repeat([]byte{0xEE}, len(chunk))) {
+				t.Errorf("Gap %d isn't filled", index)
+			}
+		} else if !bytes.Equal(chunk, fragments[index].Data) {
+			t.Errorf("Fragment %d isn't at its offset", index)
+		}
+	}
+
+	// A missing last fragment is left out unless the size is known
+	withoutLast := fragments[:total-1]
+	truncated, err := ReconstructPartial(withoutLast, nil)
+	if err != nil || fmt.Sprint(truncated.MissingIndices) != fmt.Sprint([]int{total - 1}) || !bytes.Equal(truncated.Data, data[:(total-1)*size]) {
+		t.Errorf("Without the last fragment: %v, %v", truncated.MissingIndices, err)
+	}
+	sized, err := ReconstructPartial(withoutLast, &PartialOptions{OriginalSize: uint64(len(data))})
+	if err != nil || len(sized.Data) != len(data) || !bytes.Equal(sized.Data[:(total-1)*size], data[:(total-1)*size]) {
+		t.Errorf("With OriginalSize: %d bytes, %v", len(sized.Data), err)
+	}
+	if _, err := ReconstructPartial(withoutLast, &PartialOptions{OriginalSize: 10}); err != ErrInvalidFragmentCount {
+		t.Errorf("Wrong OriginalSize: got %v, want ErrInvalidFragmentCount", err)
+	}
+
+	onlyLast, err := ReconstructPartial(fragments[total-1:], nil)
+	if err != nil || onlyLast.Data != nil || onlyLast.MissingCount != uint32(total-1) {
+		t.Errorf("Only the last fragment: %d bytes, %d missing, %v", len(onlyLast.Data), onlyLast.MissingCount, err)
+	}
+
+	other, _ := FragmentData(data)
+	if _, err := ReconstructPartial([]Fragment{fragments[0], other.Fragments[1]}, nil); err != ErrReconstructionFailed {
+		t.Errorf("Mixed payloads: got %v, want ErrReconstructionFailed", err)
+	}
+	if _, err := ReconstructPartial(nil, nil); err != ErrEmptyData {
+		t.Errorf("No fragments: got %v, want ErrEmptyData", err)
+	}
+
+	key := DeriveFragmentKey(SharedSecret{1})
+	keyed, _ := FragmentDataWithKey(data, &key)
+	if result, _ := ReconstructPartial(keyed.Fragments, nil); result.MissingCount != uint32(total) {
+		t.Error("Keyed fragments verified without the key")
+	}
+	if result, _ := ReconstructPartial(keyed.Fragments, &PartialOptions{Key: &key}); !result.IsComplete {
+		t.Error("Keyed fragments don't verify with the key")
+	}
+
+	reconstructor := NewMemoryReconstructor(nil)
+	reconstructor.Add(fragments[1])
+	if incomplete, err := reconstructor.Result(); err != ErrReconstructionIncomplete || len(incomplete.MissingIndices) != total-1 {
+		t.Errorf("Reconstructor result: %v, %v", incomplete.MissingIndices, err)
+	}
+}
+
+// Test per-fragment encryption for untrusted relays
+func TestFragmentEncryption(t *testing.T) {
+	data := bytes.Repeat([]byte("relay me "), FragmentSize/2)
+	var sharedSecret SharedSecret
+	copy(sharedSecret[:], bytes.Repeat([]byte{7}, SharedSecretSize))
+	key := DeriveFragmentKey(sharedSecret)
+	result, err := FragmentDataWithKey(data, &key)
+	if err != nil {
+		t.Fatalf("FragmentDataWithKey failed: %v", err)
+	}
+
+	encrypted, err := EncryptFragments(result.Fragments, sharedSecret)
+	if err != nil {
+		t.Fatalf("EncryptFragments failed: %v", err)
+	}
+	for i, fragment := range encrypted {
+		original := result.Fragments[i]
+		if len(fragment.Data) != len(original.Data)+EncryptedFragmentOverhead || bytes.Contains(fragment.Data, original.Data[:16]) {
+			t.Errorf("Fragment %d isn't encrypted", i)
+		}
+		if fragment.ID != original.ID || fragment.Index != original.Index || fragment.Total != original.Total {
+			t.Errorf("Fragment %d header changed", i)
+		}
+		if err := ValidateFragmentIntegrity(fragment); err != nil {
+			t.Errorf("Relay can't check encrypted fragment %d: %v", i, err)
+		}
+	}
+	if bytes.Equal(result.Fragments[0].Data, encrypted[0].Data[:len(result.Fragments[0].Data)]) {
+		t.Error("EncryptFragments modified its input")
+	}
+
+	// Encrypted fragments serialize and decrypt in any order
+	shuffled := []Fragment{encrypted[len(encrypted)-1]}
+	for _, fragment := range encrypted[:len(encrypted)-1] {
+		received, err := DeserializeFragment(SerializeFragment(fragment))
+		if err != nil {
+			t.Fatalf("DeserializeFragment failed: %v", err)
+		}
+		shuffled = append(shuffled, received)
+	}
+	decrypted, err := DecryptFragments(shuffled, sharedSecret)
+	if err != nil {
+		t.Fatalf("DecryptFragments failed: %v", err)
+	}
+	reconstructed, err := ReconstructDataWithKey(decrypted, &key)
+	if err != nil || !bytes.Equal(reconstructed.Data, data) {
+		t.Fatalf("Decrypted fragments don't reconstruct: %v", err)
+	}
+
+	for name, change := range map[string]func(*Fragment){
+		"data":  func(f *Fragment) { f.Data[0] ^= 1 },
+		"index": func(f *Fragment) { f.Index++ },
+		"total": func(f *Fragment) { f.Total++ },
+		"id":    func(f *Fragment) { f.ID[0] ^= 1 },
+		"short": func(f *Fragment) { f.Data = f.Data[:EncryptedFragmentOverhead-1] },
+	} {
+		tampered := encrypted[0]
+		tampered.Data = append([]byte(nil), tampered.Data...)
+		change(&tampered)
+		if _, err := DecryptFragments([]Fragment{tampered}, sharedSecret); err != ErrAuthenticationFailed {
+			t.Errorf("Modified %s: got %v, want ErrAuthenticationFailed", name, err)
+		}
+	}
+
+	other := sharedSecret
+	other[0] ^= 1
+	if _, err := DecryptFragments(encrypted, other); err != ErrAuthenticationFailed {
+		t.Errorf("Wrong secret: got %v, want ErrAuthenticationFailed", err)
+	}
+	SecureEraseSharedSecret(&other)
+	if _, err := EncryptFragments(result.Fragments, other); err != ErrKeyDestroyed {
+		t.Errorf("Erased secret: got %v, want ErrKeyDestroyed", err)
+	}
+}
+
+// Test fragmentation options
+func TestFragmentOptions(t *testing.T) {
+	data := bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7}, 1000)
+
+	for _, test := range []struct {
+		name  string
+		opts  []FragmentOption
+		count int
+		size  int
+	}{
+		{"defaults", nil, CalculateFragmentCount(len(data)), 250},
+		{"size", []FragmentOption{WithFragmentSize(1000)}, 7, 1000},
+		{"uneven size", []FragmentOption{WithFragmentSize(3000)}, 3, 2334},
+		{"max", []FragmentOption{WithMaxFragments(4)}, 4, 1750},
+		{"target", []FragmentOption{WithTargetCount(10)}, 10, 700},
+		{"target capped", []FragmentOption{WithTargetCount(10), WithMaxFragments(5)}, 5, 1400},
+		{"threshold", []FragmentOption{WithFragmentThreshold(len(data) + 1)}, 1, len(data)},
+	} {
+		result, err := FragmentData(data, test.opts...)
+		if err != nil {
+			t.Fatalf("%s: FragmentData failed: %v", test.name, err)
+		}
+		if len(result.Fragments) != test.count || len(result.Fragments[0].Data) != test.size {
+			t.Errorf("%s: %d fragments of %d bytes, want %d of %d", test.name, len(result.Fragments), len(result.Fragments[0].Data), test.count, test.size)
+		}
+		if result.FragmentSize != uint32(test.size) || result.Metadata.FragmentSize != uint32(test.size) {
+			t.Errorf("%s: result reports fragment size %d", test.name, result.FragmentSize)
+		}
+		reconstructed, err := ReconstructData(result.Fragments)
+		if err != nil || !bytes.Equal(reconstructed.Data, data) {
+			t.Errorf("%s: reconstruction failed: %v", test.name, err)
+		}
+
+		// Receivers size custom layouts from the metadata
+		path := filepath.Join(t.TempDir(), "payload")
+		reconstructor, err := NewFileReconstructor(path, result.Metadata, nil)
+		if err != nil {
+			t.Fatalf("%s: NewFileReconstructor failed: %v", test.name, err)
+		}
+		for _, fragment := range result.Fragments {
+			reconstructor.Add(fragment)
+		}
+		if _, err := reconstructor.Result(); err != nil {
+			t.Errorf("%s: file reconstruction failed: %v", test.name, err)
+		}
+		reconstructor.Close()
+		if test.count > 1 {
+			partial, err := ReconstructPartial(result.Fragments[1:], &PartialOptions{OriginalSize: uint64(len(data))})
+			if err != nil || len(partial.Data) != len(data) {
+				t.Errorf("%s: partial reconstruction gave %d bytes: %v", test.name, len(partial.Data), err)
+			}
+		}
+	}
+
+	parallel, err := ParallelFragmentData(data, WithTargetCount(3))
+	if err != nil || len(parallel.Fragments) != 3 {
+		t.Errorf("ParallelFragmentData with options: %d fragments, %v", len(parallel.Fragments), err)
+	}
+
+	for _, opt := range []FragmentOption{
+		WithFragmentSize(0),
+		WithFragmentSize(DefaultMaxFragmentDataSize + 1),
+		WithMaxFragments(0),
+		WithMaxFragments(MaxFragments + 1),
+		WithTargetCount(0),
+		WithTargetCount(-2),
+		WithFragmentThreshold(-1),
+	} {
+		if _, err := FragmentData(data, opt); !errors.Is(err, ErrInvalidFragmentOption) {
+			t.Errorf("Got %v, want ErrInvalidFragmentOption", err)
+		}
+	}
+
+	if _, err := FragmentData(make([]byte, DefaultMaxFragmentDataSize+1), WithMaxFragments(1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Oversized fragment: got %v, want ErrTooLarge", err)
+	}
+}
+
+// Test the legacy 32-bit fragment ID compatibility mode
+func TestLegacyFragmentIDs(t *testing.T) {
+	data := bytes.Repeat([]byte("legacy peer "), 100)
+
+	modern, err := FragmentData(data)
+	if err != nil {
+		t.Fatalf("FragmentData failed: %v", err)
+	}
+	if IsLegacyFragmentID(modern.Fragments[0].ID) {
+		t.Error("A new fragment ID lies in the legacy range")
+	}
+	if _, err := SerializeFragmentLegacy(modern.Fragments[0]); err != ErrNotLegacyFragmentID {
+		t.Errorf("Got %v, want ErrNotLegacyFragmentID", err)
+	}
+
+	legacy, err := FragmentData(data, WithLegacyID())
+	if err != nil {
+		t.Fatalf("FragmentData with WithLegacyID failed: %v", err)
+	}
+	id := legacy.Fragments[0].ID
+	if !IsLegacyFragmentID(id) || id != LegacyFragmentID(binary.BigEndian.Uint32(id[IDSize-4:])) {
+		t.Fatalf("ID %x isn't a legacy ID", id)
+	}
+
+	var received []Fragment
+	for _, fragment := range legacy.Fragments {
+		encoded, err := SerializeFragmentLegacy(fragment)
+		if err != nil {
+			t.Fatalf("SerializeFragmentLegacy failed: %v", err)
+		}
+		if len(encoded) != len(SerializeFragment(fragment))-len(fragmentMagic)-(IDSize-4) {
+			t.Errorf("Legacy encoding is %d bytes", len(encoded))
+		}
+		decoded, err := DeserializeFragment(encoded)
+		if err != nil {
+			t.Fatalf("DeserializeFragment failed: %v", err)
+		}
+		received = append(received, decoded)
+	}
+	reconstructed, err := ReconstructData(received)
+	if err != nil || !bytes.Equal(reconstructed.Data, data) {
+		t.Errorf("Legacy fragments don't reconstruct: %v", err)
+	}
+}
+
+// Test reassembly of interleaved transfers
+func TestFragmentAssembler(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	assembler := NewFragmentAssembler(&AssemblerOptions{
+		MaxTransfers:    2,
+		MaxTransferSize: 4096,
+		Timeout:         time.Minute,
+		Clock:           func() time.Time { return now },
+	})
+
+	first, _ := FragmentData(bytes.Repeat([]byte("first "), 300))
+	second, _ := FragmentData(bytes.Repeat([]byte("second "), 200))
+
+	// Interleave the transfers in reverse order with a duplicate
+	var stream []Fragment
+	for i := 0; i < max(len(first.Fragments), len(second.Fragments)); i++ {
+		if i < len(first.Fragments) {
+			stream = append(stream, first.Fragments[len(first.Fragments)-1-i])
+		}
+		if i < len(second.Fragments) {
+			stream = append(stream, second.Fragments[len(second.Fragments)-1-i])
+		}
+	}
+	stream = append(stream[:1], stream...)
+
+	completed := map[ID][]byte{}
+	for _, fragment := range stream {
+		payload, err := assembler.AddSerialized(SerializeFragment(fragment))
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		if payload != nil {
+			if payload.Metadata.Checksum != ComputeHash(payload.Data) {
+				t.Error("Payload checksum doesn't match its data")
+			}
+			completed[payload.ID] = payload.Data
+		}
+		if len(completed) == 0 {
+			status, ok := assembler.Status(first.Fragments[0].ID)
+			if ok && status.Total != uint32(len(first.Fragments)) {
+				t.Errorf("Status total is %d", status.Total)
+			}
+		}
+	}
+	reconstructedFirst, _ := ReconstructData(first.Fragments)
+	reconstructedSecond, _ := ReconstructData(second.Fragments)
+	if !bytes.Equal(completed[first.Fragments[0].ID], reconstructedFirst.Data) || !bytes.Equal(completed[second.Fragments[0].ID], reconstructedSecond.Data) {
+		t.Fatal("Completed payloads don't match")
+	}
+	if len(assembler.Transfers()) != 0 || assembler.Buffered() != 0 {
+		t.Errorf("Completed transfers still held: %v, %d bytes", assembler.Transfers(), assembler.Buffered())
+	}
+
+	// Progress, missing indices and the transfer count limit
+	third, _ := FragmentData(bytes.Repeat([]byte("third "), 300))
+	assembler.Add(third.Fragments[1])
+	assembler.Add(first.Fragments[0])
+	if missing := assembler.Missing(third.Fragments[0].ID); len(missing) != len(third.Fragments)-1 || missing[0] != 0 {
+		t.Errorf("Missing = %v", missing)
+	}
+	if status, ok := assembler.Status(third.Fragments[0].ID); !ok || status.Received != 1 || status.Buffered != int64(len(third.Fragments[1].Data)) {
+		t.Errorf("Status = %+v, %v", status, ok)
+	}
+	if _, err := assembler.Add(second.Fragments[0]); err != ErrTooManyPayloads {
+		t.Errorf("Third transfer: got %v, want ErrTooManyPayloads", err)
+	}
+
+	// Bad fragments leave the transfer alone
+	corrupt := third.Fragments[2]
+	corrupt.Data = append([]byte{0}, corrupt.Data[1:]...)
+	if _, err := assembler.Add(corrupt); err != ErrReconstructionFailed {
+		t.Errorf("Corrupt fragment: got %v, want ErrReconstructionFailed", err)
+	}
+	if status, _ := assembler.Status(third.Fragments[0].ID); status.Received != 1 {
+		t.Error("Corrupt fragment was counted")
+	}
+
+	// Idle transfers expire, making room again
+	now = now.Add(2 * time.Minute)
+	if expired := assembler.Expire(); len(expired) != 2 || assembler.Buffered() != 0 {
+		t.Errorf("Expired %d transfers, %d bytes left", len(expired), assembler.Buffered())
+	}
+
+	// Per-transfer memory limit, enforced early and while buffering
+	large, _ := FragmentData(make([]byte, 8192))
+	if _, err := assembler.Add(large.Fragments[0]); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Oversized transfer: got %v, want ErrTooLarge", err)
+	}
+	lastOnly, _ := FragmentData(make([]byte, 10000), WithTargetCount(2))
+	if _, err := assembler.Add(lastOnly.Fragments[1]); !errors.Is(err, ErrTooLarge) || len(assembler.Transfers()) != 0 {
+		t.Errorf("Oversized last fragment: got %v with %d transfers", err, len(assembler.Transfers()))
+	}
+
+	shared := NewFragmentAssembler(&AssemblerOptions{MaxBufferedSize: 600})
+	shared.Add(first.Fragments[0])
+	shared.Add(first.Fragments[1])
+	if _, err := shared.Add(second.Fragments[0]); !errors.Is(err, ErrTooLarge) || len(shared.Transfers()) != 1 {
+		t.Errorf("Buffer limit: got %v with %d transfers", err, len(shared.Transfers()))
+	}
+	if !shared.Drop(first.Fragments[0].ID) || shared.Buffered() != 0 {
+		t.Error("Drop didn't release the buffer")
+	}
+}
+
+// Test signed fragment manifests
+func TestFragmentManifest(t *testing.T) {
+	data := bytes.Repeat([]byte("manifest "), 250)
+	result, err := FragmentData(data, WithFragmentSize(300))
+	if err != nil {
+		t.Fatalf("FragmentData failed: %v", err)
+	}
+	manifest, err := NewFragmentManifest(result)
+	if err != nil {
+		t.Fatalf("NewFragmentManifest failed: %v", err)
+	}
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	if err := manifest.Verify(publicKey); err != ErrInvalidSignature {
+		t.Errorf("Unsigned manifest: got %v, want ErrInvalidSignature", err)
+	}
+	if err := manifest.Sign(privateKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	received, err := ParseFragmentManifest(encoded)
+	if err != nil {
+		t.Fatalf("ParseFragmentManifest failed: %v", err)
+	}
+	if err := received.Verify(publicKey); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	_, otherKey, _ := GenerateKeyPair()
+	if err := received.Verify(otherKey); err != ErrInvalidSignature {
+		t.Errorf("Other key: got %v, want ErrInvalidSignature", err)
+	}
+	modified := *received
+	modified.Checksum[0] ^= 1
+	if err := modified.Verify(publicKey); err != ErrInvalidSignature {
+		t.Errorf("Modified manifest: got %v, want ErrInvalidSignature", err)
+	}
+
+	for _, fragment := range result.Fragments {
+		if err := received.CheckFragment(fragment); err != nil {
+			t.Errorf("Fragment %d doesn't match: %v", fragment.Index, err)
+		}
+	}
+	forged := result.Fragments[1]
+	forged.Data = append([]byte{'X'}, forged.Data[1:]...)
+	forged.Checksum = ComputeHash(forged.Data)
+	other, _ := FragmentData(data, WithFragmentSize(300))
+	for _, fragment := range []Fragment{forged, other.Fragments[0]} {
+		if err := received.CheckFragment(fragment); !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("Got %v, want ErrManifestMismatch", err)
+		}
+	}
+
+	// The manifest's metadata lays out a file reconstruction
+	reconstructor, err := NewFileReconstructor(filepath.Join(t.TempDir(), "payload"), received.Metadata(), nil)
+	if err != nil {
+		t.Fatalf("NewFileReconstructor failed: %v", err)
+	}
+	defer reconstructor.Close()
+	for _, fragment := range result.Fragments {
+		reconstructor.Add(fragment)
+	}
+	if _, err := reconstructor.Result(); err != nil {
+		t.Errorf("Reconstruction from the manifest failed: %v", err)
+	}
+
+	for name, change := range map[string]func(*FragmentManifest){
+		"version": func(m *FragmentManifest) { m.Version = 2 },
+		"entries": func(m *FragmentManifest) { m.Fragments = m.Fragments[1:] },
+		"size":    func(m *FragmentManifest) { m.OriginalSize++ },
+		"entry":   func(m *FragmentManifest) { m.Fragments[0].Size-- },
+	} {
+		broken := *received
+		broken.Fragments = append([]ManifestEntry(nil), received.Fragments...)
+		change(&broken)
+		data, _ := json.Marshal(&broken)
+		if _, err := ParseFragmentManifest(data); err == nil {
+			t.Errorf("Manifest with a bad %s parsed", name)
+		}
+	}
+}
+
+// Test progress reporting and cancellation
+func TestFragmentProgress(t *testing.T) {
+	data := bytes.Repeat([]byte("progress "), 1000)
+
+	var calls []int
+	progress := func(done, total int) {
+		if total != 9 {
+			t.Errorf("Progress total %d, want 9", total)
+		}
+		calls = append(calls, done)
+	}
+	result, err := FragmentData(data, WithTargetCount(9), WithProgress(progress))
+	if err != nil {
+		t.Fatalf("FragmentData failed: %v", err)
+	}
+	if len(calls) != 9 || calls[0] != 1 || calls[8] != 9 {
+		t.Errorf("Fragmentation progress %v", calls)
+	}
+
+	calls = nil
+	if _, err := ReconstructData(result.Fragments, WithProgress(progress)); err != nil {
+		t.Fatalf("ReconstructData failed: %v", err)
+	}
+	if len(calls) != 9 || calls[8] != 9 {
+		t.Errorf("Reconstruction progress %v", calls)
+	}
+
+	calls = nil
+	if _, err := ParallelFragmentData(data, WithTargetCount(9), WithProgress(progress)); err != nil {
+		t.Fatalf("ParallelFragmentData failed: %v", err)
+	}
+	for i, done := range calls {
+		if done != i+1 {
+			t.Errorf("Parallel progress %v", calls)
+			break
+		}
+	}
+
+	calls = nil
+	if _, err := ParallelReconstructData(result.Fragments, WithProgress(progress)); err != nil || len(calls) != 9 {
+		t.Errorf("Parallel reconstruction progress %v: %v", calls, err)
+	}
+
+	// Cancellation stops work between fragments
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelAt := func(done, total int) {
+		if done == 3 {
+			cancel()
+		}
+	}
+	if _, err := FragmentData(data, WithTargetCount(9), WithContext(ctx), WithProgress(cancelAt)); err != context.Canceled {
+		t.Errorf("Cancelled fragmentation: got %v, want context.Canceled", err)
+	}
+	for name, run := range map[string]func() error{
+		"ParallelFragmentData": func() error {
+			_, err := ParallelFragmentData(data, WithContext(ctx))
+			return err
+		},
+		"ReconstructData": func() error {
+			_, err := ReconstructData(result.Fragments, WithContext(ctx))
+			return err
+		},
+		"ParallelReconstructData": func() error {
+			_, err := ParallelReconstructData(result.Fragments, WithContext(ctx))
+			return err
+		},
+	} {
+		if err := run(); err != context.Canceled {
+			t.Errorf("%s: got %v, want context.Canceled", name, err)
+		}
+	}
+}
+
+// Test memory-mapped file fragmentation
+func TestFragmentFile(t *testing.T) {
+	data := bytes.Repeat([]byte("mapped file "), 2000)
+	path := filepath.Join(t.TempDir(), "payload")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped, err := FragmentFile(path, WithTargetCount(6))
+	if err != nil {
+		t.Fatalf("FragmentFile failed: %v", err)
+	}
+	if len(mapped.Fragments) != 6 || mapped.Metadata.Checksum != ComputeHash(data) {
+		t.Errorf("FragmentFile gave %d fragments", len(mapped.Fragments))
+	}
+	expected, err := FragmentData(data, WithTargetCount(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serialized [][]byte
+	for i, fragment := range mapped.Fragments {
+		if !bytes.Equal(fragment.Data, expected.Fragments[i].Data) || fragment.Checksum != expected.Fragments[i].Checksum {
+			t.Errorf("Fragment %d differs from FragmentData", i)
+		}
+		serialized = append(serialized, SerializeFragment(fragment))
+	}
+
+	// Serialized fragments outlive the mapping
+	if err := mapped.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := mapped.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+	var fragments []Fragment
+	for _, encoded := range serialized {
+		fragment, err := DeserializeFragment(encoded)
+		if err != nil {
+			t.Fatalf("DeserializeFragment failed: %v", err)
+		}
+		fragments = append(fragments, fragment)
+	}
+	reconstructed, err := ReconstructData(fragments)
+	if err != nil || !bytes.Equal(reconstructed.Data, data) {
+		t.Errorf("Reconstruction failed: %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FragmentFile(empty); err != ErrEmptyData {
+		t.Errorf("Empty file: got %v, want ErrEmptyData", err)
+	}
+	if _, err := FragmentFile(path, WithMaxFragments(0)); !errors.Is(err, ErrInvalidFragmentOption) {
+		t.Errorf("Bad option: got %v, want ErrInvalidFragmentOption", err)
+	}
+	if _, err := FragmentFile(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Missing file: got %v, want os.ErrNotExist", err)
+	}
+}
+
+// Test worker pool panic recovery, backpressure and draining
+func TestWorkerPoolHardening(t *testing.T) {
+	reported := make(chan *PanicError, 1)
+	wp := NewWorkerPoolWithOptions(&WorkerPoolOptions{
+		Workers:   1,
+		QueueSize: 1,
+		OnPanic:   func(err *PanicError) { reported <- err },
+	})
+
+	// A panicking task is reported and the worker carries on
+	wp.Submit(func() { panic("boom") })
+	err := <-reported
+	if !errors.Is(err, ErrWorkerPanic) || err.Value != "boom" || len(err.Stack) == 0 {
+		t.Errorf("Reported %v", err)
+	}
+	ran := make(chan struct{})
+	wp.Submit(func() { close(ran) })
+	<-ran
+
+	// A full queue pushes back
+	started, release := make(chan struct{}), make(chan struct{})
+	wp.Submit(func() { close(started); <-release })
+	<-started
+	if !wp.TrySubmit(func() {}) {
+		t.Error("TrySubmit refused a task with room in the queue")
+	}
+	if wp.TrySubmit(func() {}) {
+		t.Error("TrySubmit accepted a task beyond the queue bound")
+	}
+	if stats := wp.Stats(); stats.Busy != 1 || stats.QueueDepth != 1 || stats.QueueCapacity != 1 || stats.Panics != 1 {
+		t.Errorf("Stats are %+v", stats)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := wp.SubmitContext(ctx, func() {}); err != context.DeadlineExceeded {
+		t.Errorf("SubmitContext on a full queue: got %v, want context.DeadlineExceeded", err)
+	}
+	if err := wp.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain of a busy pool: got %v, want context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := wp.Drain(context.Background()); err != nil {
+		t.Errorf("Drain failed: %v", err)
+	}
+	if stats := wp.Stats(); stats.Busy != 0 || stats.QueueDepth != 0 || stats.Completed != 4 {
+		t.Errorf("Stats after draining are %+v", stats)
+	}
+
+	// Close runs queued work, and submissions racing with it are never lost
+	var count atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				wp.Submit(func() { count.Add(1) })
+			}
+		}()
+	}
+	wp.Close()
+	wg.Wait()
+	wp.Close()
+	if count.Load() != 400 {
+		t.Errorf("Ran %d of 400 tasks", count.Load())
+	}
+	if wp.TrySubmit(func() {}) {
+		t.Error("TrySubmit accepted a task after Close")
+	}
+}
+
+// Test processing pipelines
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("pipeline payload "), 5000)
+	var secret SharedSecret
+	copy(secret[:], bytes.Repeat([]byte{0x5a}, SharedSecretSize))
+
+	pipeline := NewPipeline().
+		Compress(flate.BestSpeed).
+		Fragment(WithTargetCount(8)).
+		Hash(NewMACCommitter([]byte("pipeline"))).Parallel(2).
+		Encrypt(secret).Parallel(4)
+	result, err := pipeline.Run(ctx, data)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if int(result.Metadata.OriginalSize) >= len(data) || len(result.Fragments) > 8 {
+		t.Errorf("Run gave %d fragments of a %d byte payload", len(result.Fragments), result.Metadata.OriginalSize)
+	}
+	for _, fragment := range result.Fragments {
+		if err := ValidateFragmentIntegrity(fragment); err != nil {
+			t.Errorf("Encrypted fragment %d fails its plain checksum", fragment.Index)
+		}
+	}
+	reversed := append([]Fragment(nil), result.Fragments...)
+	slices.Reverse(reversed)
+	opened, err := pipeline.Open(ctx, reversed)
+	if err != nil || !bytes.Equal(opened, data) {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// The stages match the one-shot functions
+	decrypted, err := DecryptFragments(result.Fragments, secret)
+	if err != nil {
+		t.Fatalf("DecryptFragments failed: %v", err)
+	}
+	if _, err := ReconstructDataWithCommitter(decrypted, NewMACCommitter([]byte("pipeline"))); err != nil {
+		t.Errorf("Pipeline commitments don't match FragmentDataWithCommitter's: %v", err)
+	}
+
+	other := secret
+	other[0] ^= 1
+	if _, err := NewPipeline().Compress(flate.BestSpeed).Fragment(WithTargetCount(8)).Encrypt(other).Open(ctx, result.Fragments); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("Wrong secret: got %v, want ErrAuthenticationFailed", err)
+	}
+	if _, err := NewPipeline().Compress(flate.BestSpeed).Encrypt(secret).Open(ctx, result.Fragments); !errors.Is(err, ErrReconstructionFailed) {
+		t.Errorf("Missing hash stage: got %v, want ErrReconstructionFailed", err)
+	}
+
+	// Custom stages, without compression
+	var calls atomic.Int64
+	custom := NewPipeline().Stage("count", func(fragment Fragment) (Fragment, error) {
+		calls.Add(1)
+		return fragment, nil
+	}, nil)
+	plain, err := custom.Run(ctx, data)
+	if err != nil || int(calls.Load()) != len(plain.Fragments) {
+		t.Fatalf("Custom stage ran %d times: %v", calls.Load(), err)
+	}
+	if opened, err := custom.Open(ctx, plain.Fragments); err != nil || !bytes.Equal(opened, data) {
+		t.Errorf("Open without compression failed: %v", err)
+	}
+	failing := NewPipeline().Stage("fail", func(Fragment) (Fragment, error) { return Fragment{}, ErrFragmentationFailed }, nil)
+	if _, err := failing.Run(ctx, data); !errors.Is(err, ErrFragmentationFailed) {
+		t.Errorf("Failing stage: got %v, want ErrFragmentationFailed", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := pipeline.Run(cancelled, data); !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled run: got %v, want context.Canceled", err)
+	}
+
+	erased := secret
+	SecureEraseSharedSecret(&erased)
+	for name, invalid := range map[string]*Pipeline{
+		"compress after fragment": NewPipeline().Fragment().Compress(flate.BestSpeed),
+		"fragment twice":          NewPipeline().Fragment().Fragment(),
+		"bad level":               NewPipeline().Compress(42),
+		"parallel first":          NewPipeline().Parallel(2),
+		"zero parallelism":        NewPipeline().Hash(Z512Committer{}).Parallel(0),
+		"erased secret":           NewPipeline().Encrypt(erased),
+	} {
+		if _, err := invalid.Run(ctx, data); !errors.Is(err, ErrInvalidPipeline) {
+			t.Errorf("%s: got %v, want ErrInvalidPipeline", name, err)
+		}
+	}
+	if _, err := NewPipeline().Encrypt(erased).Run(ctx, data); !errors.Is(err, ErrKeyDestroyed) {
+		t.Errorf("Erased secret: got %v, want ErrKeyDestroyed", err)
+	}
+}
+
+// Test CPU feature detection
+func TestSIMDCapabilities(t *testing.T) {
+	caps := DetectSIMDCapabilities()
+	switch {
+	case runtime.GOARCH == "amd64" && !caps.SSE2:
+		t.Error("SSE2 missing on amd64")
+	case runtime.GOARCH == "arm64" && !caps.NEON:
+		t.Error("NEON missing on arm64")
+	case caps.AVX2 && !caps.AVX, caps.AVX512 && !caps.AVX2, caps.SSE42 && !caps.SSE41:
+		t.Errorf("Inconsistent capabilities %+v", caps)
+	case caps.NEON && caps.SSE2:
+		t.Errorf("Capabilities %+v mix architectures", caps)
+	}
+	if HasSIMDSupport() != (caps.SSE2 || caps.NEON) {
+		t.Error("HasSIMDSupport disagrees with DetectSIMDCapabilities")
+	}
+	if Capabilities() != caps {
+		t.Errorf("Capabilities %+v, detected %+v", Capabilities(), caps)
+	}
+}
+
+// Test the vector kernels against byte-at-a-time results, with each
+// instruction set profile
+func TestVectorizedKernels(t *testing.T) {
+	defer func(saved SIMDCapabilities) { simdCaps = saved }(simdCaps)
+
+	src1, src2 := make([]byte, 300), make([]byte, 300)
+	for i := range src1 {
+		src1[i], src2[i] = byte(i*7+3), byte(i*13+5)
+	}
+	ops := []struct {
+		name   string
+		apply  func(dst, src1, src2 []byte)
+		scalar func(a, b byte) byte
+	}{
+		{"XOR", VectorizedXOR, func(a, b byte) byte { return a ^ b }},
+		{"AND", VectorizedAND, func(a, b byte) byte { return a & b }},
+		{"OR", VectorizedOR, func(a, b byte) byte { return a | b }},
+	}
+	for _, caps := range []SIMDCapabilities{DetectSIMDCapabilities(), {SSE2: true}, {}} {
+		simdCaps = caps
+		for _, op := range ops {
+			for n := 0; n <= len(src1); n += 1 + n/16 {
+				dst := make([]byte, n)
+				op.apply(dst, src1[:n], src2[:n])
+				aliased := append([]byte(nil), src1[:n]...)
+				op.apply(aliased, aliased, src2[:n])
+				for i := 0; i < n; i++ {
+					if want := op.scalar(src1[i], src2[i]); dst[i] != want || aliased[i] != want {
+						t.Fatalf("%s of %d bytes with %v: byte %d is %#x, want %#x", op.name, n, caps.Features(), i, dst[i], want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkVectorizedXOR compares the detected instruction sets with the
+// byte-at-a-time fallback
+func BenchmarkVectorizedXOR(b *testing.B) {
+	defer func(saved SIMDCapabilities) { simdCaps = saved }(simdCaps)
+
+	src1, src2, dst := make([]byte, 4096), make([]byte, 4096), make([]byte, 4096)
+	for _, profile := range []struct {
+		name string
+		caps SIMDCapabilities
+	}{{"detected", DetectSIMDCapabilities()}, {"scalar", SIMDCapabilities{}}} {
+		b.Run(profile.name, func(b *testing.B) {
+			simdCaps = profile.caps
+			b.SetBytes(int64(len(dst)))
+			for i := 0; i < b.N; i++ {
+				VectorizedXOR(dst, src1, src2)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package transport moves fragmented payloads over UDP for the mobile and
+// IoT links fragmentation is built for: lossy, reordering and slow.
+//
+// Send transmits a payload's fragments, one serialized fragment per
+// datagram, in rounds. Each round sends the fragments the receiver hasn't
+// acknowledged, paced across the estimated round-trip time, and ends with a
+// poll that the Receiver answers with a bitmap of the fragments it holds:
+// acknowledging those and asking for the rest again. The number of
+// fragments per round is an AIMD congestion window, doubling while rounds
+// arrive intact and halving when they lose fragments, so a sender backs off
+// on a congested link instead of flooding it. A Receiver assembles payloads
+// with a topayz512.FragmentAssembler, so fragments of concurrent transfers
+// may share its socket.
+//
+// Every datagram starts with the protocol version and a packet type:
+//
+//	data    version 0x01 fragment
+//	poll    version 0x02 id(16) total(4)
+//	status  version 0x03 id(16) total(4) bitmap(ceil(total/8))
+//	done    version 0x04 id(16)
+//
+// Fragments travel in topayz512.SerializeFragment form. The bitmap's bit
+// i%8 of byte i/8 is set when fragment i has been received.
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Version is the protocol version
+const Version = 1
+
+// MaxDatagramSize is the largest UDP payload over IPv4
+const MaxDatagramSize = 65507
+
+// Packet types
+const (
+	packetData   byte = 0x01
+	packetPoll   byte = 0x02
+	packetStatus byte = 0x03
+	packetDone   byte = 0x04
+)
+
+var (
+	// ErrInvalidPacket indicates a datagram that isn't a transport packet
+	ErrInvalidPacket = errors.New("transport: invalid packet")
+
+	// ErrPacketTooLarge indicates a fragment too large for one datagram
+	ErrPacketTooLarge = errors.New("transport: fragment exceeds datagram size")
+
+	// ErrTimeout indicates a transfer that stopped making progress
+	ErrTimeout = errors.New("transport: transfer timed out")
+)
+
+// packet is a decoded datagram
+type packet struct {
+	kind     byte
+	id       topayz512.ID
+	total    uint32
+	received []byte
+	fragment []byte
+}
+
+// appendHeader appends a packet's version and type
+func appendHeader(dst []byte, kind byte) []byte {
+	return append(dst, Version, kind)
+}
+
+// encodeData returns a data packet carrying a serialized fragment
+func encodeData(fragment topayz512.Fragment) []byte {
+	return append(appendHeader(nil, packetData), topayz512.SerializeFragment(fragment)...)
+}
+
+// encodePoll returns a poll for a transfer's status
+func encodePoll(id topayz512.ID, total uint32) []byte {
+	buf := append(appendHeader(nil, packetPoll), id[:]...)
+	return binary.BigEndian.AppendUint32(buf, total)
+}
+
+// encodeStatus returns a status listing the received fragments
+func encodeStatus(id topayz512.ID, total uint32, received []byte) []byte {
+	buf := append(appendHeader(nil, packetStatus), id[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, total)
+	return append(buf, received...)
+}
+
+// encodeDone returns the notice that a transfer completed
+func encodeDone(id topayz512.ID) []byte {
+	return append(appendHeader(nil, packetDone), id[:]...)
+}
+
+// decodePacket parses a datagram
+func decodePacket(data []byte) (packet, error) {
+	if len(data) < 2 || data[0] != Version {
+		return packet{}, ErrInvalidPacket
+	}
+	p := packet{kind: data[1]}
+	body := data[2:]
+	if p.kind == packetData {
+		p.fragment = body
+		return p, nil
+	}
+
+	if len(body) < topayz512.IDSize {
+		return packet{}, ErrInvalidPacket
+	}
+	copy(p.id[:], body)
+	body = body[topayz512.IDSize:]
+	switch p.kind {
+	case packetDone:
+		if len(body) != 0 {
+			return packet{}, ErrInvalidPacket
+		}
+		return p, nil
+	case packetPoll, packetStatus:
+		if len(body) < 4 {
+			return packet{}, ErrInvalidPacket
+		}
+		p.total = binary.BigEndian.Uint32(body)
+		body = body[4:]
+		if p.total == 0 || p.total > topayz512.MaxFragments {
+			return packet{}, ErrInvalidPacket
+		}
+		if p.kind == packetPoll && len(body) == 0 {
+			return p, nil
+		}
+		if p.kind == packetStatus && len(body) == bitmapSize(p.total) {
+			p.received = body
+			return p, nil
+		}
+	}
+	return packet{}, ErrInvalidPacket
+}
+
+// bitmapSize returns the bytes of a bitmap of total fragments
+func bitmapSize(total uint32) int {
+	return int(total+7) / 8
+}
+
+// bitmapHas reports whether bit i is set
+func bitmapHas(bitmap []byte, i uint32) bool {
+	return bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// bitmapSet sets bit i
+func bitmapSet(bitmap []byte, i uint32) {
+	bitmap[i/8] |= 1 << (i % 8)
+}
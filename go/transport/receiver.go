@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// DefaultRemembered is the number of completed transfers a Receiver
+// remembers, so it can answer polls whose done notice was lost
+const DefaultRemembered = 1024
+
+// ReceiverOptions configures a Receiver
+type ReceiverOptions struct {
+	// Assembler configures the receiver's FragmentAssembler: its checksum
+	// key and memory limits
+	Assembler *topayz512.AssemblerOptions
+	// Remembered is the number of completed transfers remembered; zero
+	// uses DefaultRemembered
+	Remembered int
+}
+
+// Receiver assembles payloads sent with Send to a UDP socket. Call Receive
+// in a loop from one goroutine; the assembler interleaves the transfers.
+type Receiver struct {
+	conn       net.PacketConn
+	assembler  *topayz512.FragmentAssembler
+	remembered int
+	completed  map[topayz512.ID]struct{}
+	order      []topayz512.ID
+}
+
+// NewReceiver creates a receiver reading from conn; nil options use the
+// defaults
+func NewReceiver(conn net.PacketConn, opts *ReceiverOptions) *Receiver {
+	var options ReceiverOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.Remembered <= 0 {
+		options.Remembered = DefaultRemembered
+	}
+	return &Receiver{
+		conn:       conn,
+		assembler:  topayz512.NewFragmentAssembler(options.Assembler),
+		remembered: options.Remembered,
+		completed:  make(map[topayz512.ID]struct{}),
+	}
+}
+
+// Assembler returns the receiver's assembler, to inspect or expire
+// transfers in progress
+func (r *Receiver) Assembler() *topayz512.FragmentAssembler {
+	return r.assembler
+}
+
+// Receive handles datagrams until a payload completes, and returns it with
+// the address of its sender. Invalid datagrams and fragments the assembler
+// rejects are dropped; the sender retransmits. It returns the context's
+// error when ctx ends first, or the socket's error.
+func (r *Receiver) Receive(ctx context.Context) (*topayz512.AssembledPayload, net.Addr, error) {
+	defer r.conn.SetReadDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { r.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, from, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			return nil, nil, err
+		}
+		p, err := decodePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch p.kind {
+		case packetData:
+			payload, err := r.assembler.AddSerialized(p.fragment)
+			if err != nil || payload == nil {
+				continue
+			}
+			r.remember(payload.ID)
+			r.conn.WriteTo(encodeDone(payload.ID), from)
+			return payload, from, nil
+		case packetPoll:
+			r.conn.WriteTo(r.status(p.id, p.total), from)
+		}
+	}
+}
+
+// status returns the reply to a poll
+func (r *Receiver) status(id topayz512.ID, total uint32) []byte {
+	if _, done := r.completed[id]; done {
+		return encodeDone(id)
+	}
+
+	received := make([]byte, bitmapSize(total))
+	if status, ok := r.assembler.Status(id); ok && status.Total == total {
+		for i := uint32(0); i < total; i++ {
+			bitmapSet(received, i)
+		}
+		for _, index := range r.assembler.Missing(id) {
+			received[index/8] &^= 1 << (index % 8)
+		}
+	}
+	return encodeStatus(id, total, received)
+}
+
+// remember records a completed transfer, forgetting the oldest beyond the
+// limit
+func (r *Receiver) remember(id topayz512.ID) {
+	r.completed[id] = struct{}{}
+	r.order = append(r.order, id)
+	if len(r.order) > r.remembered {
+		delete(r.completed, r.order[0])
+		r.order = r.order[1:]
+	}
+}
@@ -0,0 +1,279 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// Sender defaults
+const (
+	// DefaultInitialWindow is the number of fragments in the first round
+	DefaultInitialWindow = 4
+
+	// DefaultMaxWindow caps the congestion window
+	DefaultMaxWindow = 256
+
+	// DefaultInitialRTT is the round-trip estimate before the first status
+	DefaultInitialRTT = 100 * time.Millisecond
+
+	// DefaultMinTimeout is the shortest wait for a status
+	DefaultMinTimeout = 20 * time.Millisecond
+
+	// DefaultMaxRetries is the number of consecutive rounds without progress
+	// before a transfer times out
+	DefaultMaxRetries = 10
+)
+
+// SenderOptions configures Send
+type SenderOptions struct {
+	// InitialWindow is the number of fragments in the first round; zero
+	// uses DefaultInitialWindow
+	InitialWindow int
+	// MaxWindow caps the fragments per round; zero uses DefaultMaxWindow
+	MaxWindow int
+	// InitialRTT seeds the round-trip estimate; zero uses DefaultInitialRTT
+	InitialRTT time.Duration
+	// MinTimeout bounds the wait for a status from below; zero uses
+	// DefaultMinTimeout
+	MinTimeout time.Duration
+	// MaxRetries is the number of consecutive rounds without progress
+	// before Send returns ErrTimeout; zero uses DefaultMaxRetries
+	MaxRetries int
+}
+
+// SendStats describes a finished transfer
+type SendStats struct {
+	// Packets is the number of data packets sent, and Retransmissions how
+	// many of them repeated a fragment
+	Packets         int
+	Retransmissions int
+	// Rounds is the number of polls sent
+	Rounds int
+	// Window is the final congestion window
+	Window int
+	// RTT is the final smoothed round-trip estimate
+	RTT time.Duration
+}
+
+// Send transmits a payload's fragments to the Receiver at addr and returns
+// once it reports the payload complete. fragments must be every fragment of
+// one payload, as FragmentData returns them. Send reads the receiver's
+// replies from conn, so conn must not be shared with another Send at the
+// same time. It returns ErrTimeout after MaxRetries rounds without
+// progress and the context's error when ctx ends first.
+func Send(ctx context.Context, conn net.PacketConn, addr net.Addr, fragments []topayz512.Fragment, opts *SenderOptions) (SendStats, error) {
+	options := senderDefaults(opts)
+	if len(fragments) == 0 {
+		return SendStats{}, topayz512.ErrEmptyData
+	}
+	id, total := fragments[0].ID, fragments[0].Total
+	if len(fragments) != int(total) {
+		return SendStats{}, topayz512.ErrInvalidFragmentCount
+	}
+	packets := make([][]byte, total)
+	for _, fragment := range fragments {
+		if fragment.ID != id || fragment.Total != total || fragment.Index >= total || packets[fragment.Index] != nil {
+			return SendStats{}, topayz512.ErrInvalidFragmentCount
+		}
+		packets[fragment.Index] = encodeData(fragment)
+		if len(packets[fragment.Index]) > MaxDatagramSize {
+			return SendStats{}, fmt.Errorf("%w: fragment %d is %d bytes", ErrPacketTooLarge, fragment.Index, len(fragment.Data))
+		}
+	}
+
+	defer conn.SetReadDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	s := &sender{
+		ctx:     ctx,
+		conn:    conn,
+		addr:    addr,
+		id:      id,
+		total:   total,
+		packets: packets,
+		acked:   make([]byte, bitmapSize(total)),
+		sent:    make([]byte, bitmapSize(total)),
+		options: options,
+		stats:   SendStats{Window: options.InitialWindow, RTT: options.InitialRTT},
+	}
+	err := s.run()
+	return s.stats, err
+}
+
+// senderDefaults fills in the defaults of opts
+func senderDefaults(opts *SenderOptions) SenderOptions {
+	var options SenderOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.InitialWindow <= 0 {
+		options.InitialWindow = DefaultInitialWindow
+	}
+	if options.MaxWindow <= 0 {
+		options.MaxWindow = DefaultMaxWindow
+	}
+	options.InitialWindow = min(options.InitialWindow, options.MaxWindow)
+	if options.InitialRTT <= 0 {
+		options.InitialRTT = DefaultInitialRTT
+	}
+	if options.MinTimeout <= 0 {
+		options.MinTimeout = DefaultMinTimeout
+	}
+	if options.MaxRetries <= 0 {
+		options.MaxRetries = DefaultMaxRetries
+	}
+	return options
+}
+
+// sender is the state of one Send
+type sender struct {
+	ctx     context.Context
+	conn    net.PacketConn
+	addr    net.Addr
+	id      topayz512.ID
+	total   uint32
+	packets [][]byte
+	acked   []byte
+	sent    []byte
+	options SenderOptions
+	stats   SendStats
+}
+
+// run sends rounds until the receiver reports the payload complete
+func (s *sender) run() error {
+	stalled := 0
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		batch := s.nextBatch()
+		if err := s.sendBatch(batch); err != nil {
+			return err
+		}
+
+		polled := time.Now()
+		if _, err := s.conn.WriteTo(encodePoll(s.id, s.total), s.addr); err != nil {
+			return err
+		}
+		s.stats.Rounds++
+		reply, err := s.awaitReply(polled.Add(max(s.options.MinTimeout, 2*s.stats.RTT)))
+		if errors.Is(err, ErrTimeout) {
+			// Neither the round nor its status arrived in time
+			s.stats.Window = max(1, s.stats.Window/2)
+			if stalled++; stalled >= s.options.MaxRetries {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		s.stats.RTT = (7*s.stats.RTT + time.Since(polled)) / 8
+		if reply.kind == packetDone {
+			return nil
+		}
+
+		progress, lost := false, false
+		for i := uint32(0); i < s.total; i++ {
+			if bitmapHas(reply.received, i) && !bitmapHas(s.acked, i) {
+				bitmapSet(s.acked, i)
+				progress = true
+			}
+		}
+		for _, index := range batch {
+			if !bitmapHas(s.acked, index) {
+				lost = true
+			}
+		}
+		if lost {
+			s.stats.Window = max(1, s.stats.Window/2)
+		} else {
+			s.stats.Window = min(2*s.stats.Window, s.options.MaxWindow)
+		}
+		if progress {
+			stalled = 0
+		} else if stalled++; stalled >= s.options.MaxRetries {
+			return ErrTimeout
+		}
+	}
+}
+
+// nextBatch returns up to a window of unacknowledged fragment indices
+func (s *sender) nextBatch() []uint32 {
+	var batch []uint32
+	for i := uint32(0); i < s.total && len(batch) < s.stats.Window; i++ {
+		if !bitmapHas(s.acked, i) {
+			batch = append(batch, i)
+		}
+	}
+	return batch
+}
+
+// sendBatch sends the fragments of a round spread evenly over one RTT
+func (s *sender) sendBatch(batch []uint32) error {
+	var pacing *time.Ticker
+	if len(batch) > 1 {
+		pacing = time.NewTicker(max(s.stats.RTT/time.Duration(len(batch)), time.Microsecond))
+		defer pacing.Stop()
+	}
+	for i, index := range batch {
+		if i > 0 {
+			select {
+			case <-pacing.C:
+			case <-s.ctx.Done():
+				return s.ctx.Err()
+			}
+		}
+		if _, err := s.conn.WriteTo(s.packets[index], s.addr); err != nil {
+			return err
+		}
+		s.stats.Packets++
+		if bitmapHas(s.sent, index) {
+			s.stats.Retransmissions++
+		}
+		bitmapSet(s.sent, index)
+	}
+	return nil
+}
+
+// awaitReply reads until a status or done for this transfer arrives from
+// the receiver, returning ErrTimeout at deadline
+func (s *sender) awaitReply(deadline time.Time) (packet, error) {
+	if err := s.ctx.Err(); err != nil {
+		return packet{}, err
+	}
+	if err := s.conn.SetReadDeadline(deadline); err != nil {
+		return packet{}, err
+	}
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return packet{}, s.ctx.Err()
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return packet{}, ErrTimeout
+			}
+			return packet{}, err
+		}
+		if from.String() != s.addr.String() {
+			continue
+		}
+		reply, err := decodePacket(buf[:n])
+		if err != nil || reply.id != s.id {
+			continue
+		}
+		if reply.kind == packetDone || (reply.kind == packetStatus && reply.total == s.total) {
+			return reply, nil
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	topayz512 "github.com/TOPAY-FOUNDATION/TOPAY_Z512/go"
+)
+
+// lossyConn drops outgoing datagrams chosen by drop
+type lossyConn struct {
+	net.PacketConn
+	mutex sync.Mutex
+	count int
+	drop  func(n int, p []byte) bool
+}
+
+func (c *lossyConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mutex.Lock()
+	c.count++
+	drop := c.drop(c.count, p)
+	c.mutex.Unlock()
+	if drop {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func listen(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receiveAll runs a receiver until it has n payloads
+func receiveAll(t *testing.T, receiver *Receiver, n int) <-chan map[topayz512.ID][]byte {
+	results := make(chan map[topayz512.ID][]byte, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		payloads := map[topayz512.ID][]byte{}
+		for len(payloads) < n {
+			payload, _, err := receiver.Receive(ctx)
+			if err != nil {
+				t.Errorf("Receive failed: %v", err)
+				break
+			}
+			payloads[payload.ID] = payload.Data
+		}
+		results <- payloads
+	}()
+	return results
+}
+
+// Test concurrent transfers to one receiver over a lossy link
+func TestSendReceive(t *testing.T) {
+	receiverConn := listen(t)
+	receiver := NewReceiver(receiverConn, nil)
+
+	payloads := [][]byte{
+		bytes.Repeat([]byte("lossless "), 400),
+		bytes.Repeat([]byte("lossy "), 2000),
+	}
+	received := receiveAll(t, receiver, len(payloads))
+
+	// The second sender loses every third datagram, polls included
+	conns := []net.PacketConn{
+		listen(t),
+		&lossyConn{PacketConn: listen(t), drop: func(n int, p []byte) bool { return n%3 == 0 }},
+	}
+	var wg sync.WaitGroup
+	stats := make([]SendStats, len(payloads))
+	ids := make([]topayz512.ID, len(payloads))
+	for i, payload := range payloads {
+		result, err := topayz512.FragmentData(payload)
+		if err != nil {
+			t.Fatalf("FragmentData failed: %v", err)
+		}
+		ids[i] = result.Fragments[0].ID
+		wg.Add(1)
+		go func(i int, fragments []topayz512.Fragment) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var err error
+			stats[i], err = Send(ctx, conns[i], receiverConn.LocalAddr(), fragments, &SenderOptions{InitialRTT: 5 * time.Millisecond})
+			if err != nil {
+				t.Errorf("Send %d failed: %v", i, err)
+			}
+		}(i, result.Fragments)
+	}
+	wg.Wait()
+
+	got := <-received
+	for i, payload := range payloads {
+		if !bytes.Equal(got[ids[i]], payload) {
+			t.Errorf("Payload %d wasn't received intact", i)
+		}
+	}
+	if stats[0].Retransmissions != 0 {
+		t.Errorf("Lossless transfer retransmitted %d fragments", stats[0].Retransmissions)
+	}
+	if stats[1].Retransmissions == 0 || stats[1].Packets <= len(payloads[1])/topayz512.FragmentSize {
+		t.Errorf("Lossy transfer: %+v", stats[1])
+	}
+}
+
+// Test that a sender gives up on a silent receiver and honors its context
+func TestSendTimeout(t *testing.T) {
+	conn := listen(t)
+	silent := listen(t)
+	result, _ := topayz512.FragmentData(bytes.Repeat([]byte("unheard "), 100))
+	options := &SenderOptions{InitialRTT: time.Millisecond, MinTimeout: time.Millisecond, MaxRetries: 3}
+
+	stats, err := Send(context.Background(), conn, silent.LocalAddr(), result.Fragments, options)
+	if !errors.Is(err, ErrTimeout) || stats.Rounds != 3 || stats.Window != 1 {
+		t.Errorf("Got %+v, %v; want ErrTimeout after 3 rounds", stats, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	options = &SenderOptions{MinTimeout: time.Hour}
+	if _, err := Send(ctx, conn, silent.LocalAddr(), result.Fragments, options); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v, want context.DeadlineExceeded", err)
+	}
+
+	if _, err := Send(context.Background(), conn, silent.LocalAddr(), result.Fragments[1:], nil); err != topayz512.ErrInvalidFragmentCount {
+		t.Errorf("Incomplete fragments: got %v, want ErrInvalidFragmentCount", err)
+	}
+	huge, _ := topayz512.FragmentData(make([]byte, MaxDatagramSize), topayz512.WithTargetCount(1))
+	if _, err := Send(context.Background(), conn, silent.LocalAddr(), huge.Fragments, nil); !errors.Is(err, ErrPacketTooLarge) {
+		t.Errorf("Oversized fragment: got %v, want ErrPacketTooLarge", err)
+	}
+}
+
+// Test that the receiver answers polls and honors its context
+func TestReceiverPolls(t *testing.T) {
+	receiverConn := listen(t)
+	receiver := NewReceiver(receiverConn, nil)
+	conn := listen(t)
+	result, _ := topayz512.FragmentData(bytes.Repeat([]byte("polled "), 200))
+	id, total := result.Fragments[0].ID, result.Fragments[0].Total
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := receiver.Receive(ctx)
+		done <- err
+	}()
+
+	conn.WriteTo(encodeData(result.Fragments[1]), receiverConn.LocalAddr())
+	conn.WriteTo([]byte{Version, 0x7f}, receiverConn.LocalAddr())
+	conn.WriteTo(encodePoll(id, total), receiverConn.LocalAddr())
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, MaxDatagramSize)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No status: %v", err)
+	}
+	status, err := decodePacket(buf[:n])
+	if err != nil || status.kind != packetStatus || status.id != id {
+		t.Fatalf("Got %+v, %v; want a status", status, err)
+	}
+	for i := uint32(0); i < total; i++ {
+		if bitmapHas(status.received, i) != (i == 1) {
+			t.Errorf("Status reports fragment %d wrongly", i)
+		}
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %v, want context.Canceled", err)
+	}
+}
+
+// Test packet decoding
+func TestDecodePacket(t *testing.T) {
+	var id topayz512.ID
+	id[0] = 1
+	for _, encoded := range [][]byte{encodePoll(id, 9), encodeStatus(id, 9, []byte{0xff, 0x01}), encodeDone(id)} {
+		p, err := decodePacket(encoded)
+		if err != nil || p.id != id {
+			t.Errorf("decodePacket(%x) = %+v, %v", encoded, p, err)
+		}
+	}
+	for _, invalid := range [][]byte{
+		nil,
+		{2, packetData},
+		{Version, packetPoll},
+		append(encodePoll(id, 9), 0),
+		encodePoll(id, 0),
+		encodeStatus(id, 9, []byte{0xff}),
+		append(encodeDone(id), 0),
+	} {
+		if _, err := decodePacket(invalid); err != ErrInvalidPacket {
+			t.Errorf("decodePacket(%x) = %v, want ErrInvalidPacket", invalid, err)
+		}
+	}
+}
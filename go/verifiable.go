@@ -0,0 +1,369 @@
+package topayz512
+
+// Verifiable encryption of secret shares to auditors
+//
+// The dealer publishes a chain of hiding commitments to the shares and a
+// transcript of each encrypted share: its auditor, KEM ciphertext, sealed
+// share and wrapping key commitment. Anyone can check that an encrypted
+// share is the one the chain records. The auditor checks on decryption that
+// the share opens its commitment; if it doesn't, the auditor reveals the KEM
+// message in a complaint. Encapsulation is deterministic in the message, so
+// anyone can re-encapsulate it to the auditor, rebuild the wrapping key and
+// confirm the dealer cheated. Auditors never reveal their KEM secret keys.
+//
+// A ciphertext encapsulated to another key is provable from its public
+// recipient tag. A malformed ciphertext carrying the auditor's tag, which
+// the dealer can only build on purpose, fails Open with
+// ErrDecapsulationFailed but can't be proven without the auditor's key.
+
+// verifiableShareDomain separates verifiable share commitments and keys from other uses
+const verifiableShareDomain = "TOPAY-Z512-VERIFIABLE-SHARE"
+
+// verifiableBlindingSize is the size of the random blinding hiding each share commitment
+const verifiableBlindingSize = 32
+
+// ShareCommitments is the public commitment chain to a verifiably shared secret
+type ShareCommitments struct {
+	SetID            Hash   `json:"set_id"`
+	Threshold        uint8  `json:"threshold"`
+	SecretCommitment Hash   `json:"secret_commitment"`
+	Commitments      []Hash `json:"commitments"`
+	Transcripts      []Hash `json:"transcripts"`
+	Head             Hash   `json:"head"`
+}
+
+// VerifiableShare is one share encrypted to an auditor, identified by the
+// hash of their KEM public key
+type VerifiableShare struct {
+	SetID         Hash       `json:"set_id"`
+	Index         uint8      `json:"index"`
+	Recipient     Hash       `json:"recipient"`
+	Ciphertext    Ciphertext `json:"ciphertext"`
+	Sealed        []byte     `json:"sealed"`
+	KeyCommitment Hash       `json:"key_commitment"`
+}
+
+// ShareComplaint is an auditor's proof that the dealer encrypted a share not
+// matching its commitment. Message is the KEM message the auditor decrypted,
+// empty if the ciphertext wasn't encapsulated to them.
+type ShareComplaint struct {
+	Share   VerifiableShare `json:"share"`
+	Auditor KEMPublicKey    `json:"auditor"`
+	Message []byte          `json:"message,omitempty"`
+}
+
+// VerifiableSplit splits secret into Shamir shares, one per auditor, any
+// threshold of which recover it. It returns the public commitments and the
+// share encrypted to each auditor, in auditor order.
+func VerifiableSplit(secret []byte, auditors []KEMPublicKey, threshold int) (*ShareCommitments, []VerifiableShare, error) {
+	if len(auditors) == 0 {
+		return nil, nil, ErrNoRecipients
+	}
+	if len(secret) == 0 {
+		return nil, nil, ErrEmptyData
+	}
+
+	// The secret commitment is blinded so a guessable secret can't be
+	// confirmed from it. The blinding is shared along with the secret, so
+	// only a threshold of auditors learns it.
+	blinded, err := SecureRandom(verifiableBlindingSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	blinded = append(blinded, secret...)
+	defer SecureZero(blinded)
+
+	shares, err := SplitSecret(blinded, len(auditors), threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		for _, share := range shares {
+			SecureZero(share.Value)
+		}
+	}()
+
+	idBytes, err := SecureRandom(HashSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	setID := ComputeHash(idBytes)
+
+	blindings := make([][]byte, len(shares))
+	defer func() {
+		for _, blinding := range blindings {
+			SecureZero(blinding)
+		}
+	}()
+
+	commitments := &ShareCommitments{
+		SetID:            setID,
+		Threshold:        uint8(threshold),
+		SecretCommitment: verifiableSecretCommitment(setID, blinded),
+		Commitments:      make([]Hash, len(shares)),
+		Transcripts:      make([]Hash, len(shares)),
+	}
+	for i, share := range shares {
+		if blindings[i], err = SecureRandom(verifiableBlindingSize); err != nil {
+			return nil, nil, err
+		}
+		commitments.Commitments[i] = verifiableShareCommitment(setID, share, blindings[i])
+	}
+
+	encrypted := make([]VerifiableShare, len(shares))
+	for i, auditor := range auditors {
+		message, err := SecureRandom(kemMessageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		ciphertext, sharedSecret, err := kemEncapsulateMessage(auditor, message)
+		SecureZero(message)
+		if err != nil {
+			return nil, nil, err
+		}
+		auditKEM(KEMOpEncapsulate, func() KEMPublicKey { return auditor }, &ciphertext, nil)
+
+		key := kemWrapKey(verifiableShareDomain, sharedSecret, setID)
+		SecureEraseSharedSecret(&sharedSecret)
+
+		plaintext := append(append([]byte(nil), blindings[i]...), shares[i].Value...)
+		sealed, err := sealAESGCM(key, recoveryNonce(shares[i].Index), plaintext, commitments.shareAAD(shares[i].Index))
+		SecureZero(plaintext)
+		if err != nil {
+			SecureZero(key)
+			return nil, nil, err
+		}
+
+		encrypted[i] = VerifiableShare{
+			SetID:         setID,
+			Index:         shares[i].Index,
+			Recipient:     ComputeHash(auditor[:]),
+			Ciphertext:    ciphertext,
+			Sealed:        sealed,
+			KeyCommitment: verifiableKeyCommitment(setID, shares[i].Index, key),
+		}
+		SecureZero(key)
+		commitments.Transcripts[i] = verifiableTranscript(&encrypted[i])
+	}
+	commitments.Head = commitments.chainHead()
+
+	return commitments, encrypted, nil
+}
+
+// sharesHead folds the share commitments into the head the sealed shares
+// are bound to
+func (sc *ShareCommitments) sharesHead() Hash {
+	head := HashMultiple([]byte(verifiableShareDomain), sc.SetID[:], []byte{sc.Threshold}, sc.SecretCommitment[:])
+	for _, commitment := range sc.Commitments {
+		head = HashMultiple(head[:], commitment[:])
+	}
+	return head
+}
+
+// chainHead folds the encrypted share transcripts into the shares head
+func (sc *ShareCommitments) chainHead() Hash {
+	head := sc.sharesHead()
+	for _, transcript := range sc.Transcripts {
+		head = HashMultiple(head[:], transcript[:])
+	}
+	return head
+}
+
+// shareAAD binds a sealed share to the share commitments and its index
+func (sc *ShareCommitments) shareAAD(index uint8) []byte {
+	head := sc.sharesHead()
+	return append(head[:], index)
+}
+
+// commitment returns the commitment to the share at index
+func (sc *ShareCommitments) commitment(index uint8) (Hash, bool) {
+	if index == 0 || int(index) > len(sc.Commitments) {
+		return Hash{}, false
+	}
+	return sc.Commitments[index-1], true
+}
+
+// Verify checks that the chain head matches the commitments
+func (sc *ShareCommitments) Verify() error {
+	if len(sc.Transcripts) != len(sc.Commitments) || !HashEqual(sc.chainHead(), sc.Head) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyShare publicly checks that an encrypted share is the one this
+// commitment chain records, without decrypting it
+func (sc *ShareCommitments) VerifyShare(share *VerifiableShare) error {
+	if err := sc.Verify(); err != nil {
+		return err
+	}
+	if share.SetID != sc.SetID {
+		return ErrInvalidShare
+	}
+	if _, ok := sc.commitment(share.Index); !ok {
+		return ErrInvalidShare
+	}
+	if !HashEqual(verifiableTranscript(share), sc.Transcripts[share.Index-1]) {
+		return ErrInvalidShare
+	}
+	return nil
+}
+
+// Open is run by the auditor to decrypt their share and check it against
+// its commitment. ErrInvalidShare means the dealer cheated; Complain then
+// produces a proof of it.
+func (vs *VerifiableShare) Open(auditorSecret KEMSecretKey, commitments *ShareCommitments) (SecretShare, error) {
+	auditor, message, err := vs.decryptMessage(auditorSecret, commitments)
+	if err != nil {
+		return SecretShare{}, err
+	}
+	defer SecureZero(message)
+
+	key, err := vs.wrapKey(auditor, message)
+	if err != nil {
+		return SecretShare{}, err
+	}
+	defer SecureZero(key)
+
+	return vs.open(key, commitments)
+}
+
+// Complain reveals the KEM message of a share that failed to open, so
+// anyone can confirm with VerifyComplaint that the dealer cheated. The
+// message opens only this share.
+func (vs *VerifiableShare) Complain(auditorSecret KEMSecretKey, commitments *ShareCommitments) (*ShareComplaint, error) {
+	auditor, message, err := vs.decryptMessage(auditorSecret, commitments)
+	switch {
+	case err == ErrWrongRecipient && auditor != KEMPublicKey{}:
+		// The ciphertext's recipient tag names another key, which anyone
+		// can check
+	case err != nil:
+		return nil, err
+	}
+	return &ShareComplaint{Share: *vs, Auditor: auditor, Message: message}, nil
+}
+
+// decryptMessage checks that a share is recorded for the auditor holding
+// auditorSecret and decrypts its KEM message. ErrWrongRecipient comes with
+// the auditor's key only if the share is theirs but the ciphertext was
+// encapsulated to another key.
+func (vs *VerifiableShare) decryptMessage(auditorSecret KEMSecretKey, commitments *ShareCommitments) (KEMPublicKey, []byte, error) {
+	if err := commitments.VerifyShare(vs); err != nil {
+		return KEMPublicKey{}, nil, err
+	}
+
+	auditor := deriveKEMPublicKey(auditorSecret)
+	if !HashEqual(ComputeHash(auditor[:]), vs.Recipient) {
+		return KEMPublicKey{}, nil, ErrWrongRecipient
+	}
+	message, err := kemDecryptMessage(auditorSecret, vs.Ciphertext)
+	auditKEM(KEMOpDecapsulate, func() KEMPublicKey { return auditor }, &vs.Ciphertext, err)
+	return auditor, message, err
+}
+
+// wrapKey re-encapsulates message to auditor and derives the share's
+// wrapping key, failing unless that reproduces the share's ciphertext
+func (vs *VerifiableShare) wrapKey(auditor KEMPublicKey, message []byte) ([]byte, error) {
+	if len(message) != kemMessageSize {
+		return nil, ErrDecapsulationFailed
+	}
+	ciphertext, sharedSecret, err := kemEncapsulateMessage(auditor, message)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureEraseSharedSecret(&sharedSecret)
+	if !ConstantTimeEqual(ciphertext[:], vs.Ciphertext[:]) {
+		return nil, ErrDecapsulationFailed
+	}
+	return kemWrapKey(verifiableShareDomain, sharedSecret, vs.SetID), nil
+}
+
+// open checks the wrapping key against the dealer's key commitment, then
+// decrypts the share and checks its commitment
+func (vs *VerifiableShare) open(key []byte, commitments *ShareCommitments) (SecretShare, error) {
+	if !HashEqual(verifiableKeyCommitment(vs.SetID, vs.Index, key), vs.KeyCommitment) {
+		return SecretShare{}, ErrInvalidShare
+	}
+	plaintext, err := openAESGCM(key, recoveryNonce(vs.Index), vs.Sealed, commitments.shareAAD(vs.Index))
+	if err != nil || len(plaintext) < verifiableBlindingSize {
+		return SecretShare{}, ErrInvalidShare
+	}
+
+	share := SecretShare{Index: vs.Index, Value: append([]byte(nil), plaintext[verifiableBlindingSize:]...)}
+	commitment, _ := commitments.commitment(vs.Index)
+	ok := HashEqual(verifiableShareCommitment(vs.SetID, share, plaintext[:verifiableBlindingSize]), commitment)
+	SecureZero(plaintext)
+	if !ok {
+		SecureZero(share.Value)
+		return SecretShare{}, ErrInvalidShare
+	}
+	return share, nil
+}
+
+// VerifyComplaint reports whether a complaint proves the dealer encrypted a
+// share inconsistent with its commitment
+func VerifyComplaint(commitments *ShareCommitments, complaint *ShareComplaint) bool {
+	share := &complaint.Share
+	if commitments.VerifyShare(share) != nil || !HashEqual(ComputeHash(complaint.Auditor[:]), share.Recipient) {
+		return false
+	}
+	if !CiphertextMatchesRecipient(share.Ciphertext, complaint.Auditor) {
+		return true
+	}
+
+	// A message that doesn't reproduce the ciphertext proves nothing
+	key, err := share.wrapKey(complaint.Auditor, complaint.Message)
+	if err != nil {
+		return false
+	}
+	defer SecureZero(key)
+
+	opened, err := share.open(key, commitments)
+	if err != nil {
+		return true
+	}
+	SecureZero(opened.Value)
+	return false
+}
+
+// CombineVerifiedShares recovers the secret from opened shares and checks it
+// against the secret commitment
+func CombineVerifiedShares(commitments *ShareCommitments, shares []SecretShare) ([]byte, error) {
+	if len(shares) < int(commitments.Threshold) {
+		return nil, ErrInvalidThreshold
+	}
+
+	blinded, err := CombineShares(shares[:commitments.Threshold])
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(blinded)
+	if len(blinded) <= verifiableBlindingSize ||
+		!HashEqual(verifiableSecretCommitment(commitments.SetID, blinded), commitments.SecretCommitment) {
+		return nil, ErrReconstructionFailed
+	}
+	return append([]byte(nil), blinded[verifiableBlindingSize:]...), nil
+}
+
+// verifiableSecretCommitment is the hiding commitment to the secret, given
+// with its blinding prepended
+func verifiableSecretCommitment(setID Hash, blinded []byte) Hash {
+	return HashMultiple([]byte(verifiableShareDomain+"-SECRET"), setID[:], blinded)
+}
+
+// verifiableShareCommitment is the hiding commitment to one share
+func verifiableShareCommitment(setID Hash, share SecretShare, blinding []byte) Hash {
+	return HashMultiple([]byte(verifiableShareDomain), setID[:], []byte{share.Index}, blinding, share.Value)
+}
+
+// verifiableKeyCommitment commits the dealer to a share's wrapping key
+func verifiableKeyCommitment(setID Hash, index uint8, key []byte) Hash {
+	return HashMultiple([]byte(verifiableShareDomain+"-KEY"), setID[:], []byte{index}, key)
+}
+
+// verifiableTranscript commits to everything the dealer sent for a share
+func verifiableTranscript(share *VerifiableShare) Hash {
+	sealed := ComputeHash(share.Sealed)
+	return HashMultiple([]byte(verifiableShareDomain+"-TRANSCRIPT"), share.SetID[:], []byte{share.Index},
+		share.Recipient[:], share.Ciphertext[:], sealed[:], share.KeyCommitment[:])
+}
@@ -0,0 +1,492 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+
+	"github.com/TOPAY-FOUNDATION/TOPAY_Z512/go/params"
+)
+
+// Winternitz one-time signatures (WOTS+) over the Z512 hash
+
+// WOTS constants
+const (
+	// WOTSHashSize is the security parameter n: the size of every chain value,
+	// seed and compressed public key in bytes
+	WOTSHashSize = int(params.WOTSHashSize)
+
+	// DefaultWOTSWinternitz is the default Winternitz parameter
+	DefaultWOTSWinternitz = 16
+
+	// wotsMessageDomain separates WOTS message digests from other uses of the hash
+	wotsMessageDomain = "TOPAY-Z512-WOTS-MSG"
+
+	// wotsPRFDomain separates WOTS secret chain starts from other uses of the hash
+	wotsPRFDomain = "TOPAY-Z512-WOTS-PRF"
+)
+
+// Hash address types, which make every tweakable hash call unique
+const (
+	addrTypeWOTSHash uint8 = iota
+	addrTypeWOTSPK
+	addrTypeTree
+	addrTypePRF
+	addrTypeFORSTree
+	addrTypeFORSRoots
+	addrTypeFORSPRF
+)
+
+// hashAddress locates a tweakable hash call within a key:
+// layer(1) | tree(8) | type(1) | keypair or tree index(4) | chain or tree height(1) | hash(1)
+// FORS addresses put the hypertree keypair in the last byte instead of the hash
+type hashAddress [16]byte
+
+func (a *hashAddress) setLayer(layer uint8) {
+	a[0] = layer
+}
+
+func (a *hashAddress) setTree(tree uint64) {
+	binary.BigEndian.PutUint64(a[1:9], tree)
+}
+
+// setType changes the address type and clears the type-specific fields
+func (a *hashAddress) setType(addrType uint8) {
+	a[9] = addrType
+	for i := 10; i < len(a); i++ {
+		a[i] = 0
+	}
+}
+
+func (a *hashAddress) setKeyPair(keyPair uint32) {
+	binary.BigEndian.PutUint32(a[10:14], keyPair)
+}
+
+func (a *hashAddress) setChain(chain uint8) {
+	a[14] = chain
+}
+
+func (a *hashAddress) setHash(hash uint8) {
+	a[15] = hash
+}
+
+func (a *hashAddress) setTreeIndex(index uint32) {
+	binary.BigEndian.PutUint32(a[10:14], index)
+}
+
+func (a *hashAddress) setTreeHeight(height uint8) {
+	a[14] = height
+}
+
+func (a *hashAddress) setFORSKeyPair(keyPair uint8) {
+	a[15] = keyPair
+}
+
+// thash is the tweakable hash: the Z512 hash of the public seed, the address
+// and the inputs, truncated to WOTSHashSize bytes
+func thash(pubSeed []byte, adrs *hashAddress, inputs ...[]byte) [WOTSHashSize]byte {
+	hs := GetHashState()
+	defer PutHashState(hs)
+
+	hs.Update(pubSeed)
+	hs.Update(adrs[:])
+	for _, input := range inputs {
+		hs.Update(input)
+	}
+
+	digest := hs.Finalize()
+	var out [WOTSHashSize]byte
+	copy(out[:], digest[:WOTSHashSize])
+	return out
+}
+
+// prfSecret derives the secret value for an address from the secret seed
+func prfSecret(skSeed, pubSeed []byte, adrs *hashAddress) [WOTSHashSize]byte {
+	digest := HashMultiple([]byte(wotsPRFDomain), skSeed, pubSeed, adrs[:])
+
+	var out [WOTSHashSize]byte
+	copy(out[:], digest[:WOTSHashSize])
+	return out
+}
+
+// WOTSParams selects the Winternitz parameter w, trading signature size for
+// signing and verification time
+type WOTSParams struct {
+	// W is the Winternitz parameter: 4, 16 or 256
+	W int
+}
+
+// DefaultWOTSParams returns the default WOTS parameters
+func DefaultWOTSParams() WOTSParams {
+	return WOTSParams{W: DefaultWOTSWinternitz}
+}
+
+// Validate checks that the Winternitz parameter is supported
+func (p WOTSParams) Validate() error {
+	switch p.W {
+	case 4, 16, 256:
+		return nil
+	}
+	return ErrInvalidWinternitz
+}
+
+// logW returns log2(w)
+func (p WOTSParams) logW() int {
+	return bits.TrailingZeros(uint(p.W))
+}
+
+// Len1 returns the number of chains signing the message digest
+func (p WOTSParams) Len1() int {
+	return (8*WOTSHashSize + p.logW() - 1) / p.logW()
+}
+
+// Len2 returns the number of chains signing the checksum
+func (p WOTSParams) Len2() int {
+	maxChecksum := p.Len1() * (p.W - 1)
+	return (bits.Len(uint(maxChecksum))-1)/p.logW() + 1
+}
+
+// Len returns the total number of chains
+func (p WOTSParams) Len() int {
+	return p.Len1() + p.Len2()
+}
+
+// SignatureSize returns the size of a WOTS signature in bytes
+func (p WOTSParams) SignatureSize() int {
+	return p.Len() * WOTSHashSize
+}
+
+// paramByte encodes the parameters in serialized keys and signatures
+func (p WOTSParams) paramByte() byte {
+	return byte(p.logW())
+}
+
+// wotsParamsFromByte decodes a serialized parameter byte
+func wotsParamsFromByte(b byte) (WOTSParams, error) {
+	if b == 0 || b > 8 {
+		return WOTSParams{}, ErrInvalidWinternitz
+	}
+	params := WOTSParams{W: 1 << b}
+	return params, params.Validate()
+}
+
+// baseW splits data into outLen base-w digits, most significant first
+func (p WOTSParams) baseW(data []byte, outLen int) []int {
+	logW := uint(p.logW())
+	digits := make([]int, outLen)
+
+	var total uint
+	var available uint
+	in := 0
+	for i := range digits {
+		if available == 0 {
+			total = uint(data[in])
+			in++
+			available = 8
+		}
+		available -= logW
+		digits[i] = int(total>>available) & (p.W - 1)
+	}
+	return digits
+}
+
+// chainLengths returns how far along each chain the signature for digest lies
+func (p WOTSParams) chainLengths(digest []byte) []int {
+	lengths := p.baseW(digest, p.Len1())
+
+	checksum := 0
+	for _, digit := range lengths {
+		checksum += p.W - 1 - digit
+	}
+
+	// Left-align the checksum so baseW consumes exactly Len2 digits
+	checksumBits := p.Len2() * p.logW()
+	checksum <<= uint((8 - checksumBits%8) % 8)
+	checksumBytes := make([]byte, (checksumBits+7)/8)
+	for i := len(checksumBytes) - 1; i >= 0; i-- {
+		checksumBytes[i] = byte(checksum)
+		checksum >>= 8
+	}
+
+	return append(lengths, p.baseW(checksumBytes, p.Len2())...)
+}
+
+// wotsChain applies steps iterations of the chain function starting at position start
+func wotsChain(value [WOTSHashSize]byte, start, steps int, pubSeed []byte, adrs *hashAddress) [WOTSHashSize]byte {
+	for i := start; i < start+steps; i++ {
+		adrs.setHash(uint8(i))
+		value = thash(pubSeed, adrs, value[:])
+	}
+	return value
+}
+
+// wotsSecretAddress returns the PRF address for the chains of a WOTS key
+func wotsSecretAddress(adrs hashAddress) hashAddress {
+	keyPair := binary.BigEndian.Uint32(adrs[10:14])
+	adrs.setType(addrTypePRF)
+	adrs.setKeyPair(keyPair)
+	return adrs
+}
+
+// wotsCompress hashes the chain ends into the n-byte public key
+func wotsCompress(ends []byte, pubSeed []byte, adrs hashAddress) [WOTSHashSize]byte {
+	keyPair := binary.BigEndian.Uint32(adrs[10:14])
+	adrs.setType(addrTypeWOTSPK)
+	adrs.setKeyPair(keyPair)
+	return thash(pubSeed, &adrs, ends)
+}
+
+// wotsPublicKeyGen computes the compressed public key of the WOTS key at adrs
+func wotsPublicKeyGen(params WOTSParams, skSeed, pubSeed []byte, adrs hashAddress) [WOTSHashSize]byte {
+	skAdrs := wotsSecretAddress(adrs)
+	ends := make([]byte, params.Len()*WOTSHashSize)
+
+	for i := 0; i < params.Len(); i++ {
+		skAdrs.setChain(uint8(i))
+		secret := prfSecret(skSeed, pubSeed, &skAdrs)
+		adrs.setChain(uint8(i))
+		end := wotsChain(secret, 0, params.W-1, pubSeed, &adrs)
+		copy(ends[i*WOTSHashSize:], end[:])
+		SecureZero(secret[:])
+	}
+
+	return wotsCompress(ends, pubSeed, adrs)
+}
+
+// wotsSign signs an n-byte digest with the WOTS key at adrs
+func wotsSign(params WOTSParams, digest, skSeed, pubSeed []byte, adrs hashAddress) []byte {
+	skAdrs := wotsSecretAddress(adrs)
+	lengths := params.chainLengths(digest)
+	signature := make([]byte, params.Len()*WOTSHashSize)
+
+	for i, length := range lengths {
+		skAdrs.setChain(uint8(i))
+		secret := prfSecret(skSeed, pubSeed, &skAdrs)
+		adrs.setChain(uint8(i))
+		value := wotsChain(secret, 0, length, pubSeed, &adrs)
+		copy(signature[i*WOTSHashSize:], value[:])
+		SecureZero(secret[:])
+	}
+
+	return signature
+}
+
+// wotsPublicKeyFromSignature completes every chain of a signature and returns
+// the compressed public key it implies
+func wotsPublicKeyFromSignature(params WOTSParams, signature, digest, pubSeed []byte, adrs hashAddress) [WOTSHashSize]byte {
+	lengths := params.chainLengths(digest)
+	ends := make([]byte, params.Len()*WOTSHashSize)
+
+	for i, length := range lengths {
+		var value [WOTSHashSize]byte
+		copy(value[:], signature[i*WOTSHashSize:])
+		adrs.setChain(uint8(i))
+		end := wotsChain(value, length, params.W-1-length, pubSeed, &adrs)
+		copy(ends[i*WOTSHashSize:], end[:])
+	}
+
+	return wotsCompress(ends, pubSeed, adrs)
+}
+
+// WOTSPublicKey is a WOTS+ public key: the public seed and the compressed
+// hash of every chain end
+type WOTSPublicKey struct {
+	Params  WOTSParams
+	PubSeed [WOTSHashSize]byte
+	Root    [WOTSHashSize]byte
+}
+
+// messageDigest hashes a message to the n-byte value signed by a WOTS key,
+// binding it to the public key
+func (pk WOTSPublicKey) messageDigest(message []byte) []byte {
+	digest := HashMultiple([]byte(wotsMessageDomain), pk.PubSeed[:], pk.Root[:], message)
+	return digest[:WOTSHashSize]
+}
+
+// Verify checks a signature on message
+func (pk WOTSPublicKey) Verify(message []byte, signature WOTSSignature) bool {
+	if signature.Params != pk.Params || pk.Params.Validate() != nil {
+		return false
+	}
+	if len(signature.Chains) != pk.Params.SignatureSize() {
+		return false
+	}
+
+	root := wotsPublicKeyFromSignature(pk.Params, signature.Chains, pk.messageDigest(message), pk.PubSeed[:], hashAddress{})
+	return ConstantTimeEqual(root[:], pk.Root[:])
+}
+
+// Bytes serializes the public key as w | PubSeed | Root
+func (pk WOTSPublicKey) Bytes() []byte {
+	out := make([]byte, 0, 1+2*WOTSHashSize)
+	out = append(out, pk.Params.paramByte())
+	out = append(out, pk.PubSeed[:]...)
+	return append(out, pk.Root[:]...)
+}
+
+// WOTSPublicKeyFromBytes parses a serialized WOTS public key
+func WOTSPublicKeyFromBytes(data []byte) (WOTSPublicKey, error) {
+	if len(data) != 1+2*WOTSHashSize {
+		return WOTSPublicKey{}, ErrInvalidKeySize
+	}
+
+	params, err := wotsParamsFromByte(data[0])
+	if err != nil {
+		return WOTSPublicKey{}, err
+	}
+
+	pk := WOTSPublicKey{Params: params}
+	copy(pk.PubSeed[:], data[1:])
+	copy(pk.Root[:], data[1+WOTSHashSize:])
+	return pk, nil
+}
+
+// WOTSSignature is a WOTS+ signature: one value per chain
+type WOTSSignature struct {
+	Params WOTSParams
+	Chains []byte
+}
+
+// Bytes serializes the signature as w | chain values
+func (s WOTSSignature) Bytes() []byte {
+	out := make([]byte, 0, 1+len(s.Chains))
+	out = append(out, s.Params.paramByte())
+	return append(out, s.Chains...)
+}
+
+// WOTSSignatureFromBytes parses a serialized WOTS signature
+func WOTSSignatureFromBytes(data []byte) (WOTSSignature, error) {
+	if len(data) == 0 {
+		return WOTSSignature{}, ErrInvalidSignatureSize
+	}
+
+	params, err := wotsParamsFromByte(data[0])
+	if err != nil {
+		return WOTSSignature{}, err
+	}
+	if len(data)-1 != params.SignatureSize() {
+		return WOTSSignature{}, ErrInvalidSignatureSize
+	}
+
+	return WOTSSignature{Params: params, Chains: append([]byte(nil), data[1:]...)}, nil
+}
+
+// WOTSPrivateKey is a WOTS+ private key. It signs at most one message: signing
+// a second message would reveal enough chain values to forge signatures.
+type WOTSPrivateKey struct {
+	skSeed [WOTSHashSize]byte
+	public WOTSPublicKey
+	used   bool
+	erased bool
+	mutex  sync.Mutex
+}
+
+// GenerateWOTSKey generates a fresh WOTS+ key pair
+func GenerateWOTSKey(params WOTSParams) (*WOTSPrivateKey, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	seeds, err := SecureRandom(2 * WOTSHashSize)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(seeds)
+
+	return newWOTSPrivateKey(params, seeds[:WOTSHashSize], seeds[WOTSHashSize:], false), nil
+}
+
+// newWOTSPrivateKey builds a private key from its seeds and computes its public key
+func newWOTSPrivateKey(params WOTSParams, skSeed, pubSeed []byte, used bool) *WOTSPrivateKey {
+	sk := &WOTSPrivateKey{used: used}
+	copy(sk.skSeed[:], skSeed)
+	sk.public.Params = params
+	copy(sk.public.PubSeed[:], pubSeed)
+	sk.public.Root = wotsPublicKeyGen(params, skSeed, pubSeed, hashAddress{})
+	return sk
+}
+
+// Public returns the public key
+func (sk *WOTSPrivateKey) Public() WOTSPublicKey {
+	return sk.public
+}
+
+// Used reports whether the key has already signed a message
+func (sk *WOTSPrivateKey) Used() bool {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+	return sk.used
+}
+
+// Sign signs message. The key is marked used before the signature is computed,
+// and any further call returns ErrKeyAlreadyUsed, or ErrKeyDestroyed after
+// Wipe.
+func (sk *WOTSPrivateKey) Sign(message []byte) (WOTSSignature, error) {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+
+	if sk.erased {
+		return WOTSSignature{}, ErrKeyDestroyed
+	}
+	if sk.used {
+		return WOTSSignature{}, ErrKeyAlreadyUsed
+	}
+	sk.used = true
+
+	params := sk.public.Params
+	chains := wotsSign(params, sk.public.messageDigest(message), sk.skSeed[:], sk.public.PubSeed[:], hashAddress{})
+	return WOTSSignature{Params: params, Chains: chains}, nil
+}
+
+// Bytes serializes the private key as w | used | SKSeed | PubSeed. The usage
+// flag is part of the encoding, so a key persisted after signing stays spent;
+// callers must not restore an encoding taken before the key was used.
+func (sk *WOTSPrivateKey) Bytes() []byte {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+
+	out := make([]byte, 0, 2+2*WOTSHashSize)
+	out = append(out, sk.public.Params.paramByte())
+	if sk.used {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+	out = append(out, sk.skSeed[:]...)
+	return append(out, sk.public.PubSeed[:]...)
+}
+
+// WOTSPrivateKeyFromBytes parses a serialized WOTS private key
+func WOTSPrivateKeyFromBytes(data []byte) (*WOTSPrivateKey, error) {
+	if len(data) != 2+2*WOTSHashSize || data[1] > 1 {
+		return nil, ErrInvalidKeySize
+	}
+
+	params, err := wotsParamsFromByte(data[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return newWOTSPrivateKey(params, data[2:2+WOTSHashSize], data[2+WOTSHashSize:], data[1] == 1), nil
+}
+
+// Wipe erases the secret seed and marks the key used. It does nothing for a
+// nil key.
+func (sk *WOTSPrivateKey) Wipe() {
+	if sk == nil {
+		return
+	}
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+
+	SecureZero(sk.skSeed[:])
+	sk.used = true
+	sk.erased = true
+}
+
+// Erased reports whether Wipe has been called
+func (sk *WOTSPrivateKey) Erased() bool {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+	return sk.erased
+}
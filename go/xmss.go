@@ -0,0 +1,461 @@
+package topayz512
+
+import (
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Stateful many-time hash-based signatures (XMSS-style) built on WOTS+
+
+// XMSS constants
+const (
+	// DefaultXMSSHeight is the default tree height, allowing 1024 signatures
+	DefaultXMSSHeight = 10
+
+	// MaxXMSSHeight is the largest supported tree height. The whole tree is
+	// kept in memory, which takes 2^(height+1) * WOTSHashSize bytes.
+	MaxXMSSHeight = 20
+
+	// xmssMessageDomain separates XMSS message digests from other uses of the hash
+	xmssMessageDomain = "TOPAY-Z512-XMSS-MSG"
+
+	// xmssRandomnessDomain separates XMSS signature randomness from other uses of the hash
+	xmssRandomnessDomain = "TOPAY-Z512-XMSS-RAND"
+)
+
+// XMSSParams selects the tree height and the WOTS parameters of the leaves
+type XMSSParams struct {
+	// Height is the tree height; a key signs at most 2^Height messages
+	Height int
+	// WOTS configures the one-time keys at the leaves
+	WOTS WOTSParams
+}
+
+// DefaultXMSSParams returns the default XMSS parameters
+func DefaultXMSSParams() XMSSParams {
+	return XMSSParams{Height: DefaultXMSSHeight, WOTS: DefaultWOTSParams()}
+}
+
+// Validate checks the tree height and WOTS parameters
+func (p XMSSParams) Validate() error {
+	if p.Height < 1 || p.Height > MaxXMSSHeight {
+		return ErrInvalidTreeHeight
+	}
+	return p.WOTS.Validate()
+}
+
+// MaxSignatures returns how many messages a key can sign
+func (p XMSSParams) MaxSignatures() uint64 {
+	return uint64(1) << uint(p.Height)
+}
+
+// SignatureSize returns the size of an XMSS signature in bytes
+func (p XMSSParams) SignatureSize() int {
+	return 4 + WOTSHashSize + p.WOTS.SignatureSize() + p.Height*WOTSHashSize
+}
+
+// xmssLeafAddress returns the WOTS address of leaf index
+func xmssLeafAddress(index uint32) hashAddress {
+	var adrs hashAddress
+	adrs.setType(addrTypeWOTSHash)
+	adrs.setKeyPair(index)
+	return adrs
+}
+
+// xmssNode hashes two children into the node at height and index
+func xmssNode(pubSeed []byte, height uint8, index uint32, left, right []byte) [WOTSHashSize]byte {
+	var adrs hashAddress
+	adrs.setType(addrTypeTree)
+	return treeNode(pubSeed, adrs, height, index, left, right)
+}
+
+// treeNode hashes two children into the node at height and index of the tree
+// addressed by adrs, whose type is already set
+func treeNode(pubSeed []byte, adrs hashAddress, height uint8, index uint32, left, right []byte) [WOTSHashSize]byte {
+	adrs.setTreeHeight(height)
+	adrs.setTreeIndex(index)
+	return thash(pubSeed, &adrs, left, right)
+}
+
+// xmssBuildTree computes every node of the tree; nodes[0] holds the leaves
+// and nodes[height] the root. Leaves are computed in parallel.
+func xmssBuildTree(params XMSSParams, skSeed, pubSeed []byte) [][][WOTSHashSize]byte {
+	nodes := make([][][WOTSHashSize]byte, params.Height+1)
+	leaves := make([][WOTSHashSize]byte, params.MaxSignatures())
+
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for i := offset; i < len(leaves); i += workers {
+				leaves[i] = wotsPublicKeyGen(params.WOTS, skSeed, pubSeed, xmssLeafAddress(uint32(i)))
+			}
+		}(w)
+	}
+	wg.Wait()
+	nodes[0] = leaves
+
+	for height := 1; height <= params.Height; height++ {
+		below := nodes[height-1]
+		level := make([][WOTSHashSize]byte, len(below)/2)
+		for i := range level {
+			level[i] = xmssNode(pubSeed, uint8(height), uint32(i), below[2*i][:], below[2*i+1][:])
+		}
+		nodes[height] = level
+	}
+
+	return nodes
+}
+
+// xmssRootFromAuthPath climbs from a leaf to the root using its authentication path
+func xmssRootFromAuthPath(leaf [WOTSHashSize]byte, index uint32, authPath, pubSeed []byte) [WOTSHashSize]byte {
+	var adrs hashAddress
+	adrs.setType(addrTypeTree)
+	return rootFromAuthPath(leaf, index, authPath, pubSeed, adrs)
+}
+
+// rootFromAuthPath climbs from a leaf to the root of the tree addressed by
+// adrs using its authentication path
+func rootFromAuthPath(leaf [WOTSHashSize]byte, index uint32, authPath, pubSeed []byte, adrs hashAddress) [WOTSHashSize]byte {
+	node := leaf
+	for height := 0; height < len(authPath)/WOTSHashSize; height++ {
+		sibling := authPath[height*WOTSHashSize : (height+1)*WOTSHashSize]
+		parent := index >> 1
+		if index&1 == 0 {
+			node = treeNode(pubSeed, adrs, uint8(height+1), parent, node[:], sibling)
+		} else {
+			node = treeNode(pubSeed, adrs, uint8(height+1), parent, sibling, node[:])
+		}
+		index = parent
+	}
+	return node
+}
+
+// xmssMessageDigest hashes a message to the n-byte value signed by leaf index
+func xmssMessageDigest(randomness, root []byte, index uint32, message []byte) []byte {
+	var indexBytes [8]byte
+	binary.BigEndian.PutUint64(indexBytes[:], uint64(index))
+	digest := HashMultiple([]byte(xmssMessageDomain), randomness, root, indexBytes[:], message)
+	return digest[:WOTSHashSize]
+}
+
+// XMSSPublicKey is an XMSS public key: the public seed and the tree root
+type XMSSPublicKey struct {
+	Params  XMSSParams
+	PubSeed [WOTSHashSize]byte
+	Root    [WOTSHashSize]byte
+}
+
+// Verify checks a signature on message
+func (pk XMSSPublicKey) Verify(message []byte, signature XMSSSignature) bool {
+	params := pk.Params
+	if params.Validate() != nil || uint64(signature.Index) >= params.MaxSignatures() {
+		return false
+	}
+	if len(signature.WOTS) != params.WOTS.SignatureSize() || len(signature.AuthPath) != params.Height*WOTSHashSize {
+		return false
+	}
+
+	digest := xmssMessageDigest(signature.Randomness[:], pk.Root[:], signature.Index, message)
+	leaf := wotsPublicKeyFromSignature(params.WOTS, signature.WOTS, digest, pk.PubSeed[:], xmssLeafAddress(signature.Index))
+	root := xmssRootFromAuthPath(leaf, signature.Index, signature.AuthPath, pk.PubSeed[:])
+	return ConstantTimeEqual(root[:], pk.Root[:])
+}
+
+// Bytes serializes the public key as height | w | PubSeed | Root
+func (pk XMSSPublicKey) Bytes() []byte {
+	out := make([]byte, 0, 2+2*WOTSHashSize)
+	out = append(out, byte(pk.Params.Height), pk.Params.WOTS.paramByte())
+	out = append(out, pk.PubSeed[:]...)
+	return append(out, pk.Root[:]...)
+}
+
+// XMSSPublicKeyFromBytes parses a serialized XMSS public key
+func XMSSPublicKeyFromBytes(data []byte) (XMSSPublicKey, error) {
+	if len(data) != 2+2*WOTSHashSize {
+		return XMSSPublicKey{}, ErrInvalidKeySize
+	}
+
+	params, err := xmssParamsFromBytes(data[0], data[1])
+	if err != nil {
+		return XMSSPublicKey{}, err
+	}
+
+	pk := XMSSPublicKey{Params: params}
+	copy(pk.PubSeed[:], data[2:])
+	copy(pk.Root[:], data[2+WOTSHashSize:])
+	return pk, nil
+}
+
+// xmssParamsFromBytes decodes the serialized height and WOTS parameter
+func xmssParamsFromBytes(height, w byte) (XMSSParams, error) {
+	wots, err := wotsParamsFromByte(w)
+	if err != nil {
+		return XMSSParams{}, err
+	}
+	params := XMSSParams{Height: int(height), WOTS: wots}
+	return params, params.Validate()
+}
+
+// XMSSSignature is an XMSS signature: the leaf index, the message randomness,
+// the WOTS signature of the leaf and the authentication path to the root
+type XMSSSignature struct {
+	Index      uint32
+	Randomness [WOTSHashSize]byte
+	WOTS       []byte
+	AuthPath   []byte
+}
+
+// Bytes serializes the signature as index | randomness | WOTS signature | auth path
+func (s XMSSSignature) Bytes() []byte {
+	out := make([]byte, 4, 4+WOTSHashSize+len(s.WOTS)+len(s.AuthPath))
+	binary.BigEndian.PutUint32(out, s.Index)
+	out = append(out, s.Randomness[:]...)
+	out = append(out, s.WOTS...)
+	return append(out, s.AuthPath...)
+}
+
+// XMSSSignatureFromBytes parses a serialized XMSS signature for the given parameters
+func XMSSSignatureFromBytes(params XMSSParams, data []byte) (XMSSSignature, error) {
+	if err := params.Validate(); err != nil {
+		return XMSSSignature{}, err
+	}
+	if len(data) != params.SignatureSize() {
+		return XMSSSignature{}, ErrInvalidSignatureSize
+	}
+
+	var signature XMSSSignature
+	signature.Index = binary.BigEndian.Uint32(data)
+	offset := 4
+	copy(signature.Randomness[:], data[offset:])
+	offset += WOTSHashSize
+	signature.WOTS = append([]byte(nil), data[offset:offset+params.WOTS.SignatureSize()]...)
+	offset += params.WOTS.SignatureSize()
+	signature.AuthPath = append([]byte(nil), data[offset:]...)
+	return signature, nil
+}
+
+// XMSSOptions configures the state handling of an XMSS private key
+type XMSSOptions struct {
+	// Store persists the index of the next unused leaf. Use a durable store
+	// such as FileCounterStore: nil keeps the index in memory only, and a
+	// restarted signer would then reuse leaves. GenerateXMSSKey initialises
+	// an empty store; LoadXMSSKey refuses one.
+	Store CounterStore
+	// Reservation is how many leaves are persisted ahead of use. Zero persists
+	// before every signature; larger values trade leaves skipped after a crash
+	// for fewer writes.
+	Reservation uint64
+}
+
+// XMSSPrivateKey is a stateful XMSS signing key. Every signature consumes one
+// leaf, and the index of the next leaf is persisted through the state store
+// before the signature is produced, so no leaf is ever used twice even across
+// restarts.
+type XMSSPrivateKey struct {
+	params   XMSSParams
+	skSeed   [WOTSHashSize]byte
+	skPRF    [WOTSHashSize]byte
+	pubSeed  [WOTSHashSize]byte
+	tree     [][][WOTSHashSize]byte
+	opts     XMSSOptions
+	next     uint64
+	reserved uint64
+	erased   bool
+	mutex    sync.Mutex
+}
+
+// GenerateXMSSKey generates a fresh XMSS key pair. An empty state store is
+// initialised at leaf 0; a store that already holds an index is resumed from.
+func GenerateXMSSKey(params XMSSParams, opts *XMSSOptions) (*XMSSPrivateKey, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	seeds, err := SecureRandom(3 * WOTSHashSize)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(seeds)
+
+	return newXMSSPrivateKey(params, seeds, opts, true)
+}
+
+// LoadXMSSKey restores a private key serialized with Bytes. The leaf index is
+// read from the state store, which must be the store the key was used with.
+// A store with no index returns ErrStateNotFound rather than restarting at
+// leaf 0, which could reuse leaves.
+func LoadXMSSKey(data []byte, opts *XMSSOptions) (*XMSSPrivateKey, error) {
+	if len(data) != 2+3*WOTSHashSize {
+		return nil, ErrInvalidKeySize
+	}
+
+	params, err := xmssParamsFromBytes(data[0], data[1])
+	if err != nil {
+		return nil, err
+	}
+	return newXMSSPrivateKey(params, data[2:], opts, false)
+}
+
+// newXMSSPrivateKey builds a key from SKSeed | SKPRF | PubSeed and loads its
+// state, initialising an empty store for a fresh key
+func newXMSSPrivateKey(params XMSSParams, seeds []byte, opts *XMSSOptions, fresh bool) (*XMSSPrivateKey, error) {
+	var options XMSSOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.Store == nil {
+		options.Store = &MemoryCounterStore{}
+	}
+
+	next, err := options.Store.Load()
+	if fresh && errors.Is(err, ErrStateNotFound) {
+		next, err = 0, options.Store.Store(0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sk := &XMSSPrivateKey{
+		params:   params,
+		opts:     options,
+		next:     next,
+		reserved: next,
+	}
+	copy(sk.skSeed[:], seeds)
+	copy(sk.skPRF[:], seeds[WOTSHashSize:])
+	copy(sk.pubSeed[:], seeds[2*WOTSHashSize:])
+	sk.tree = xmssBuildTree(params, sk.skSeed[:], sk.pubSeed[:])
+	return sk, nil
+}
+
+// Params returns the key parameters
+func (sk *XMSSPrivateKey) Params() XMSSParams {
+	return sk.params
+}
+
+// Public returns the public key
+func (sk *XMSSPrivateKey) Public() XMSSPublicKey {
+	return XMSSPublicKey{
+		Params:  sk.params,
+		PubSeed: sk.pubSeed,
+		Root:    sk.tree[sk.params.Height][0],
+	}
+}
+
+// Index returns the index of the next unused leaf
+func (sk *XMSSPrivateKey) Index() uint64 {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+	return sk.next
+}
+
+// Remaining returns how many signatures the key can still produce
+func (sk *XMSSPrivateKey) Remaining() uint64 {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+
+	if sk.next >= sk.params.MaxSignatures() {
+		return 0
+	}
+	return sk.params.MaxSignatures() - sk.next
+}
+
+// Sign signs message with the next unused leaf. The new index is persisted
+// before signing; if the store fails no signature is produced. It returns
+// ErrKeyDestroyed after Wipe.
+func (sk *XMSSPrivateKey) Sign(message []byte) (XMSSSignature, error) {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+
+	if sk.erased {
+		return XMSSSignature{}, ErrKeyDestroyed
+	}
+	if sk.tree == nil {
+		return XMSSSignature{}, ErrKeyExhausted
+	}
+
+	index := sk.next
+	if err := sk.claim(index); err != nil {
+		return XMSSSignature{}, err
+	}
+	leaf := uint32(index)
+
+	var indexBytes [8]byte
+	binary.BigEndian.PutUint64(indexBytes[:], index)
+	randomness := HashMultiple([]byte(xmssRandomnessDomain), sk.skPRF[:], indexBytes[:], message)
+
+	signature := XMSSSignature{Index: leaf}
+	copy(signature.Randomness[:], randomness[:WOTSHashSize])
+
+	root := sk.tree[sk.params.Height][0]
+	digest := xmssMessageDigest(signature.Randomness[:], root[:], leaf, message)
+	signature.WOTS = wotsSign(sk.params.WOTS, digest, sk.skSeed[:], sk.pubSeed[:], xmssLeafAddress(leaf))
+
+	signature.AuthPath = make([]byte, 0, sk.params.Height*WOTSHashSize)
+	for height := 0; height < sk.params.Height; height++ {
+		sibling := sk.tree[height][(leaf>>uint(height))^1]
+		signature.AuthPath = append(signature.AuthPath, sibling[:]...)
+	}
+
+	return signature, nil
+}
+
+// claim marks leaf index as used, persisting a new reservation first if needed;
+// the caller holds the mutex
+func (sk *XMSSPrivateKey) claim(index uint64) error {
+	max := sk.params.MaxSignatures()
+	if index >= max {
+		return ErrKeyExhausted
+	}
+
+	if index+1 > sk.reserved {
+		reserved := index + 1 + sk.opts.Reservation
+		if reserved > max {
+			reserved = max
+		}
+		if err := sk.opts.Store.Store(reserved); err != nil {
+			return err
+		}
+		sk.reserved = reserved
+	}
+
+	sk.next = index + 1
+	return nil
+}
+
+// Bytes serializes the private key as height | w | SKSeed | SKPRF | PubSeed.
+// The leaf index is not included; it lives in the state store.
+func (sk *XMSSPrivateKey) Bytes() []byte {
+	out := make([]byte, 0, 2+3*WOTSHashSize)
+	out = append(out, byte(sk.params.Height), sk.params.WOTS.paramByte())
+	out = append(out, sk.skSeed[:]...)
+	out = append(out, sk.skPRF[:]...)
+	return append(out, sk.pubSeed[:]...)
+}
+
+// Wipe erases the secret seeds and the cached tree; the key can no longer
+// sign. It does nothing for a nil key.
+func (sk *XMSSPrivateKey) Wipe() {
+	if sk == nil {
+		return
+	}
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+
+	SecureZero(sk.skSeed[:])
+	SecureZero(sk.skPRF[:])
+	sk.tree = nil
+	sk.erased = true
+}
+
+// Erased reports whether Wipe has been called
+func (sk *XMSSPrivateKey) Erased() bool {
+	sk.mutex.Lock()
+	defer sk.mutex.Unlock()
+	return sk.erased
+}